@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"create-order-saga/internal/embedded"
+	"create-order-saga/internal/logging"
+	"create-order-saga/internal/orchestrator"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/server"
+	shippingservice "create-order-saga/internal/shipping"
+	"create-order-saga/pkg/grpc_clients"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+var (
+	latencyMin          = flag.Duration("latency-min", 0, "Minimum simulated latency added to every RPC")
+	latencyMax          = flag.Duration("latency-max", 0, "Maximum simulated latency added to every RPC")
+	paymentFailureRate  = flag.Float64("payment-failure-rate", paymentservice.DefaultFailureRate, "Probability (0-1) that a valid payment is declined")
+	paymentOutageRate   = flag.Float64("payment-outage-rate", 0, "Probability (0-1) that the simulated payment gateway is unavailable")
+	shippingFailureRate = flag.Float64("shipping-failure-rate", shippingservice.DefaultFailureRate, "Probability (0-1) that arranging shipping fails")
+	maxAmount           = flag.String("max-amount", "", "Payments above this amount (e.g. 500.00, in "+money.DefaultCurrency+") are held for manual review (no limit if empty)")
+	sagas               = flag.Int("sagas", 1, "Number of sample sagas to run")
+
+	logLevel  = flag.String("log-level", "info", "Least severe log level written: debug, info, warn or error")
+	logSample = flag.Int("log-sample", 0, "Write at most this many info logs a second from each line of code, dropping the rest (all if 0)")
+)
+
+func main() {
+	flag.Parse()
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
+	logging.Setup(logging.Config{Level: level, Sampling: logging.PerSecond(*logSample)})
+	log.Println("Starting all-in-one Saga demo...")
+
+	var limit *commonpb.Money
+	if *maxAmount != "" {
+		var err error
+		if limit, err = money.Parse(money.DefaultCurrency, *maxAmount); err != nil {
+			log.Fatalf("Invalid -max-amount: %v", err)
+		}
+	}
+
+	// Cancelled on SIGINT/SIGTERM
+	sigCtx, stop := server.SignalContext()
+	defer stop()
+
+	// Run every service in this process
+	stack, err := embedded.Start(embedded.Config{
+		LatencyMin:          *latencyMin,
+		LatencyMax:          *latencyMax,
+		PaymentFailureRate:  *paymentFailureRate,
+		PaymentOutageRate:   *paymentOutageRate,
+		ShippingFailureRate: *shippingFailureRate,
+		MaxAmount:           limit,
+	})
+	if err != nil {
+		log.Fatalf("Failed to start embedded services: %v", err)
+	}
+	defer stack.Stop()
+
+	clients, err := stack.Clients(grpc_clients.WithKeepalive(grpc_clients.DefaultKeepalive))
+	if err != nil {
+		log.Fatalf("Failed to create service clients: %v", err)
+	}
+	defer clients.Close()
+	sagaOrchestrator := orchestrator.NewOrchestrator(clients)
+	defer sagaOrchestrator.Close()
+
+	succeeded, failed, violations := 0, 0, 0
+	for i := 0; i < *sagas && sigCtx.Err() == nil; i++ {
+		ctx, cancel := context.WithTimeout(sigCtx, 30*time.Second) // Set a deadline for the saga
+		state, err := sagaOrchestrator.RunCreateOrderSaga(ctx, sampleOrder(i), samplePayment(), sampleAddress())
+		cancel()
+		if err == nil {
+			succeeded++
+			continue
+		}
+		failed++
+		log.Printf("Saga %d failed: %v", i, err)
+		if msg := checkCompensated(stack, state); msg != "" {
+			violations++
+			log.Printf("INVARIANT VIOLATED for saga %s: %s", state.SagaID, msg)
+		}
+	}
+
+	fmt.Printf("sagas=%d succeeded=%d failed=%d invariant_violations=%d\n", succeeded+failed, succeeded, failed, violations)
+	if violations > 0 {
+		os.Exit(1)
+	}
+}
+
+// checkCompensated verifies a failed saga left its order CANCELLED and its
+// payment (if any) not in SUCCESS. It returns a description of any violation.
+func checkCompensated(stack *embedded.Stack, state *orchestrator.SagaState) string {
+	if state == nil || state.OrderID == nil {
+		return "" // Nothing was created
+	}
+	ctx := interceptors.WithTenant(context.Background(), interceptors.DefaultTenant)
+	if order, ok := stack.Order.Lookup(ctx, state.OrderID.Id); ok && order.Status != orderpb.OrderStatus_CANCELLED {
+		return fmt.Sprintf("order %s is %s, want CANCELLED", order.Id, order.Status)
+	}
+	if state.PaymentID != "" {
+		if payment, ok := stack.Payment.Lookup(ctx, state.PaymentID); ok && (payment.Status == paymentpb.PaymentStatus_SUCCESS || payment.Status == paymentpb.PaymentStatus_PARTIALLY_REFUNDED) {
+			return fmt.Sprintf("payment %s is still %s", payment.Id, payment.Status)
+		}
+	}
+	return ""
+}
+
+func sampleOrder(i int) *commonpb.OrderDetails {
+	return &commonpb.OrderDetails{
+		UserId: fmt.Sprintf("user-%d", i), // Order IDs derive from the user, so keep them unique
+		Items: []*commonpb.Item{
+			{ProductId: "prod-A", Name: "Widget", Sku: "WID-A-001", WeightGrams: 250, Quantity: 2, Price: money.MustParse(money.DefaultCurrency, "10.50")},
+			{ProductId: "prod-B", Name: "Gadget", Sku: "GAD-B-002", WeightGrams: 1200, Quantity: 1, Price: money.MustParse(money.DefaultCurrency, "25.00")},
+		},
+	}
+}
+
+func samplePayment() *commonpb.PaymentInfo {
+	return &commonpb.PaymentInfo{
+		CardNumber: "4242-4242-4242-4242", // Dummy data (a Luhn-valid test number)
+		ExpiryDate: "12/30",
+		Cvv:        "123",
+		Amount:     money.MustParse(money.DefaultCurrency, "46.00"), // 2*10.50 + 25.00
+	}
+}
+
+func sampleAddress() *commonpb.ShippingAddress {
+	return &commonpb.ShippingAddress{
+		Street:  "123 Saga Lane",
+		City:    "Orchestration City",
+		State:   "Workflow",
+		ZipCode: "98765",
+		Country: "GoLand",
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+
+	"create-order-saga/internal/orchestrator"
+)
+
+// validationResult is the JSON line printed for every order in dry-run mode.
+type validationResult struct {
+	Index    int                              `json:"index"`
+	Valid    bool                             `json:"valid"`
+	Error    string                           `json:"error,omitempty"`
+	Problems []orchestrator.ValidationProblem `json:"problems,omitempty"`
+	Skipped  []string                         `json:"skipped,omitempty"`
+}
+
+// validateOrders checks every order without running its saga, writing one JSON
+// result line per order to out. It reports whether every order is valid.
+func validateOrders(ctx context.Context, o *orchestrator.Orchestrator, orders []*orderInput, out io.Writer) bool {
+	enc := json.NewEncoder(out)
+	allOK := true
+	for i, in := range orders {
+		callCtx, cancel := context.WithTimeout(ctx, sagaTimeout)
+		report, err := o.ValidateCreateOrder(callCtx, in.Details, in.PaymentInfo, in.ShippingAddress)
+		cancel()
+
+		res := validationResult{Index: i, Valid: err == nil && report.Valid()}
+		if err != nil {
+			log.Printf("Validation failed for order %d: %v", i, err)
+			res.Error = err.Error()
+		}
+		if report != nil {
+			res.Problems = report.Problems
+			res.Skipped = report.Skipped
+		}
+		allOK = allOK && res.Valid
+		if err := enc.Encode(res); err != nil {
+			log.Printf("Failed to write result for order %d: %v", i, err)
+		}
+	}
+	return allOK
+}
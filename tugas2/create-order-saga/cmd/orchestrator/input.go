@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+)
+
+// orderInput is one order request read from --input. In JSON it looks like
+//
+//	{"details": {...}, "payment_info": {...}, "shipping_address": {...}}
+//
+// where each field uses the protojson form of the matching common message.
+type orderInput struct {
+	Details         *commonpb.OrderDetails
+	PaymentInfo     *commonpb.PaymentInfo
+	ShippingAddress *commonpb.ShippingAddress
+}
+
+func (in *orderInput) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Details         json.RawMessage `json:"details"`
+		PaymentInfo     json.RawMessage `json:"payment_info"`
+		ShippingAddress json.RawMessage `json:"shipping_address"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	in.Details = &commonpb.OrderDetails{}
+	in.PaymentInfo = &commonpb.PaymentInfo{}
+	in.ShippingAddress = &commonpb.ShippingAddress{}
+	if err := unmarshalField("details", raw.Details, in.Details); err != nil {
+		return err
+	}
+	if err := unmarshalField("payment_info", raw.PaymentInfo, in.PaymentInfo); err != nil {
+		return err
+	}
+	return unmarshalField("shipping_address", raw.ShippingAddress, in.ShippingAddress)
+}
+
+// unmarshalField decodes a required field holding a protojson message.
+func unmarshalField(name string, data json.RawMessage, m proto.Message) error {
+	if len(data) == 0 || string(data) == "null" {
+		return fmt.Errorf("missing %q", name)
+	}
+	if err := protojson.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("invalid %q: %w", name, err)
+	}
+	return nil
+}
+
+// parseOrders reads either a single order object or an array of orders.
+func parseOrders(r io.Reader) ([]*orderInput, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("no orders in input")
+	}
+
+	if data[0] != '[' {
+		var in orderInput
+		if err := json.Unmarshal(data, &in); err != nil {
+			return nil, fmt.Errorf("order 0: %w", err)
+		}
+		return []*orderInput{&in}, nil
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	if len(raws) == 0 {
+		return nil, errors.New("no orders in input")
+	}
+	orders := make([]*orderInput, len(raws))
+	for i, raw := range raws {
+		orders[i] = &orderInput{}
+		if err := json.Unmarshal(raw, orders[i]); err != nil {
+			return nil, fmt.Errorf("order %d: %w", i, err)
+		}
+	}
+	return orders, nil
+}
+
+// readOrders parses orders from the named file, or from stdin if path is "-".
+func readOrders(path string) ([]*orderInput, error) {
+	if path == "-" {
+		return parseOrders(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseOrders(f)
+}
+
+// simulatedOrder is the sample order run when no --input is given.
+func simulatedOrder() *orderInput {
+	return &orderInput{
+		Details: &commonpb.OrderDetails{
+			UserId: "user-123",
+			Items: []*commonpb.Item{
+				{ProductId: "prod-A", Name: "Widget", Sku: "WID-A-001", WeightGrams: 250, Quantity: 2, Price: money.MustParse(money.DefaultCurrency, "10.50")},
+				{ProductId: "prod-B", Name: "Gadget", Sku: "GAD-B-002", WeightGrams: 1200, Quantity: 1, Price: money.MustParse(money.DefaultCurrency, "25.00")},
+			},
+		},
+		PaymentInfo: &commonpb.PaymentInfo{
+			CardNumber: "4242-4242-4242-4242", // Dummy data (a Luhn-valid test number)
+			ExpiryDate: "12/30",
+			Cvv:        "123",
+			Amount:     money.MustParse(money.DefaultCurrency, "46.00"), // 2*10.50 + 25.00
+		},
+		ShippingAddress: &commonpb.ShippingAddress{
+			Street:  "123 Saga Lane",
+			City:    "Orchestration City",
+			State:   "Workflow",
+			ZipCode: "98765",
+			Country: "GoLand",
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"create-order-saga/internal/sagatest"
+)
+
+// sampleOrderJSON is an order in --input form, with the card number given.
+func sampleOrderJSON(card string) string {
+	return `{
+		"details": {"user_id": "user-1", "items": [{"product_id": "prod-A", "sku": "WID-A-001", "quantity": 2, "price": {"currency_code": "USD", "units": 10, "nanos": 500000000}}]},
+		"payment_info": {"card_number": "` + card + `", "expiry_date": "12/30", "cvv": "123", "amount": {"currency_code": "USD", "units": 21}},
+		"shipping_address": {"street": "1 Main St", "city": "Springfield", "state": "Workflow", "zip_code": "12345", "country": "GoLand"}
+	}`
+}
+
+func TestParseOrders(t *testing.T) {
+	order := sampleOrderJSON("4242424242424242")
+	for _, tc := range []struct {
+		name    string
+		input   string
+		want    int
+		wantErr string
+	}{
+		{"single order", order, 1, ""},
+		{"array", "[" + order + "," + order + "]", 2, ""},
+		{"empty input", "  \n", 0, "no orders"},
+		{"empty array", "[]", 0, "no orders"},
+		{"malformed JSON", `{"details": `, 0, "order 0"},
+		{"malformed array", "[" + order + ",", 0, "unexpected end"},
+		{"unknown field", `{"details": {}, "payment_info": {}, "shipping_address": {}, "coupon": "X"}`, 0, `unknown field "coupon"`},
+		{"missing field", `{"details": {}, "payment_info": {}}`, 0, `missing "shipping_address"`},
+		{"invalid message", `{"details": {"user_id": 7}, "payment_info": {}, "shipping_address": {}}`, 0, `invalid "details"`},
+		{"second order invalid", "[" + order + `, {"details": {}}]`, 0, "order 1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			orders, err := parseOrders(strings.NewReader(tc.input))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("parseOrders = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || len(orders) != tc.want {
+				t.Fatalf("parseOrders = %d orders, %v; want %d", len(orders), err, tc.want)
+			}
+			in := orders[0]
+			if in.Details.GetUserId() != "user-1" || in.Details.GetItems()[0].GetQuantity() != 2 ||
+				in.PaymentInfo.GetAmount().GetUnits() != 21 || in.ShippingAddress.GetCity() != "Springfield" {
+				t.Errorf("first order = %+v, want the sample order's fields", in)
+			}
+		})
+	}
+}
+
+// TestRunOrdersFromFile runs a valid and an invalid order read from a temp
+// file against in-process services: each gets a JSON result line, and the
+// run reports failure.
+func TestRunOrdersFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.json")
+	input := "[" + sampleOrderJSON("4242424242424242") + "," + sampleOrderJSON("4242424242424241") + "]"
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := readOrders(path)
+	if err != nil {
+		t.Fatalf("readOrders: %v", err)
+	}
+
+	h := sagatest.New(t)
+	var out bytes.Buffer
+	if runOrders(context.Background(), h.Orchestrator, orders, 2, &out) {
+		t.Error("runOrders reported success with an invalid card")
+	}
+	results := make(map[int]sagaResult)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var res sagaResult
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("result line %q: %v", line, err)
+		}
+		results[res.Index] = res
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %v, want one per order", results)
+	}
+	if ok := results[0]; !ok.Success || ok.SagaID == "" || ok.OrderID == "" || ok.PaymentID == "" || len(ok.ShipmentIDs) == 0 {
+		t.Errorf("first result = %+v, want a successful saga with its IDs", ok)
+	}
+	if failed := results[1]; failed.Success || failed.Error == "" || failed.OrderID == "" {
+		t.Errorf("second result = %+v, want a failed saga with its error and order ID", failed)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"create-order-saga/internal/loadtest"
+	"create-order-saga/internal/orchestrator"
+)
+
+// runLoad fires synthetic sagas according to cfg, prints a summary table to
+// stdout and, if reportPath is set, writes the report there as JSON. A
+// cancelled ctx stops the run early with a partial report. It reports whether
+// every saga succeeded.
+func runLoad(ctx context.Context, o *orchestrator.Orchestrator, cfg loadtest.Config, reportPath string) bool {
+	log.Printf("Load test: %d sagas, duration %v, concurrency %d", cfg.Total, cfg.Duration, cfg.Concurrency)
+	gen := loadtest.NewGenerator(time.Now().UnixNano())
+	report := loadtest.RunSagas(ctx, o, gen, cfg, sagaTimeout)
+	if ctx.Err() != nil {
+		log.Println("Load test interrupted; reporting partial results.")
+	}
+
+	report.WriteTable(os.Stdout)
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(reportPath, data, 0o644)
+		}
+		if err != nil {
+			log.Printf("Failed to write load report to %s: %v", reportPath, err)
+		}
+	}
+	return report.Failed == 0
+}
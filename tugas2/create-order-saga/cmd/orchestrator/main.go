@@ -2,12 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"net/http"
+	"os"
 	"time"
 
+	"google.golang.org/grpc/keepalive"
+
+	"create-order-saga/internal/buildinfo"
+	"create-order-saga/internal/loadtest"
+	"create-order-saga/internal/logging"
 	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/server"
 	"create-order-saga/pkg/grpc_clients"
-	commonpb "create-order-saga/proto/common"
+	"create-order-saga/pkg/ids"
 )
 
 const (
@@ -16,53 +25,282 @@ const (
 	shippingServiceAddr = "localhost:50053"
 )
 
+var (
+	auditLog        = flag.String("audit-log", "", "Append saga audit entries to this JSONL file (in memory if empty)")
+	apiKey          = flag.String("api-key", os.Getenv("SAGA_API_KEY"), "API key sent to the services (none if empty)")
+	orderAPIKey     = flag.String("order-api-key", os.Getenv("SAGA_ORDER_API_KEY"), "API key sent to the Order service, overriding --api-key")
+	paymentAPIKey   = flag.String("payment-api-key", os.Getenv("SAGA_PAYMENT_API_KEY"), "API key sent to the Payment service, overriding --api-key")
+	shippingAPIKey  = flag.String("shipping-api-key", os.Getenv("SAGA_SHIPPING_API_KEY"), "API key sent to the Shipping service, overriding --api-key")
+	completionLog   = flag.String("completion-log", "", "Keep orders still to be marked COMPLETED in this JSONL file so retries survive a restart (in memory if empty)")
+	completionRetry = flag.Duration("completion-retry-interval", 5*time.Second, "How often orders that failed to be marked COMPLETED are retried")
+	eventLog        = flag.String("event-log", "", "Append the saga event log to this JSONL file (in-memory ring buffer if empty)")
+	eventHooks      = flag.String("event-webhooks", "", "Also POST every saga event as JSON to these comma-separated URLs (none if empty)")
+	eventHookKey    = flag.String("event-webhook-secret", os.Getenv("SAGA_EVENT_WEBHOOK_SECRET"), "Sign event webhook deliveries with HMAC-SHA256 under this secret (unsigned if empty)")
+	sagaIDs         = flag.String("saga-ids", "random", "How saga IDs are generated: random (saga-<uuid>), ulid (sortable by start time) or sequence (saga-1, saga-2, ...)")
+	poolSize        = flag.Int("pool-size", grpc_clients.DefaultPoolSize, "Connections opened to each service; calls are spread over them round-robin")
+	keepaliveTime   = flag.Duration("keepalive-time", grpc_clients.DefaultKeepalive.Time, "Ping each service connection after this long idle so intermediaries keep it open; must not be below the services' --keepalive-min-time (0 = no pings)")
+	keepaliveWait   = flag.Duration("keepalive-timeout", grpc_clients.DefaultKeepalive.Timeout, "Reconnect if a keepalive ping is not answered within this long")
+	dedupTTL        = flag.Duration("dedup-ttl", 0, "Return the outcome of an identical order (same client reference, or user, items and amount) submitted within this long instead of running it again (0 = off)")
+	httpAddr        = flag.String("http-addr", "", "Serve the orchestrator HTTP API (e.g. saga cancellation) on this address")
+	cancelWindow    = flag.Duration("cancel-window", orchestrator.DefaultCancellationWindow, "How long after shipping a customer may still cancel an order over the HTTP API (0 = no limit)")
+	compTimeout     = flag.Duration("compensation-timeout", orchestrator.DefaultCompensationTimeout, "Timeout of each compensation call, including its retries")
+	parallelSteps   = flag.Bool("parallel-steps", false, "Reserve shipping and take the payment concurrently (shipping is still only confirmed once both succeed)")
+	asyncComplete   = flag.Bool("async-complete", false, "Report a saga as succeeded once shipping is confirmed and mark its order COMPLETED in the background")
+	notifyURL       = flag.String("notify-url", "", "POST a JSON notification to this webhook when an order saga completes or fails (only logged if empty)")
+	notifyAttempts  = flag.Int("notify-attempts", orchestrator.DefaultWebhookAttempts, "Attempts per webhook notification before it is given up and logged")
+	shutdownLimit   = flag.Duration("shutdown-deadline", 30*time.Second, "How long compensations of sagas cancelled on shutdown may run before they are abandoned and queued for follow-up (0 = no limit)")
+
+	retryBudget     = flag.Int("retry-budget", 0, "Retries a saga's forward steps may make in total (0 = only per-call limits)")
+	retryBudgetTime = flag.Duration("retry-budget-time", 0, "Time a saga's forward steps may spend retrying in total (0 = only per-call limits)")
+
+	maxSagas     = flag.Int("max-sagas", 0, "Sagas allowed to run at the same time (0 = no limit)")
+	maxSagasWait = flag.Duration("max-sagas-wait", time.Second, "How long a saga waits for a free slot under --max-sagas before it is rejected")
+
+	input       = flag.String("input", "", "Read orders (one object or an array) from this JSON file, or - for stdin; runs a sample order if empty")
+	concurrency = flag.Int("concurrency", 1, "Number of sagas (from --input or --load) to run at the same time")
+	dryRun      = flag.Bool("dry-run", false, "Only validate the orders (locally and with each service) without running any saga")
+	reconcile   = flag.Bool("reconcile", false, "Only check that cancelled and completed orders agree with their payments and shipments, printing the report as JSON; exits non-zero on any violation")
+
+	load       = flag.Int("load", 0, "Load-test mode: run this many synthetic sagas (0 = unlimited when --duration is set)")
+	duration   = flag.Duration("duration", 0, "Load-test mode: stop starting new sagas after this long")
+	loadReport = flag.String("load-report", "", "Load-test mode: also write the summary report as JSON to this file")
+
+	logLevel  = flag.String("log-level", "info", "Least severe log level written: debug, info, warn or error")
+	logSample = flag.Int("log-sample", 0, "Write at most this many info logs a second from each line of code, dropping the rest (all if 0)")
+)
+
 func main() {
+	flag.Parse()
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
+	logging.Setup(logging.Config{Level: level, Sampling: logging.PerSecond(*logSample)})
 	log.Println("Starting Saga Orchestrator...")
 
+	// Parse the orders up front so bad input fails before connecting anywhere
+	orders := []*orderInput{simulatedOrder()}
+	if *input != "" {
+		var err error
+		if orders, err = readOrders(*input); err != nil {
+			log.Fatalf("Failed to read orders from %s: %v", *input, err)
+		}
+		log.Printf("Read %d order(s) from %s", len(orders), *input)
+	} else if *load == 0 && *duration == 0 {
+		// In a real application, this might come from an API gateway or message queue.
+		log.Println("No --input given, simulating an incoming order request...")
+	}
+
+	// Cancelled on SIGINT/SIGTERM
+	sigCtx, stop := server.SignalContext()
+	defer stop()
+
 	// Connect to downstream services
-	clients, err := grpc_clients.NewServiceClients(orderServiceAddr, paymentServiceAddr, shippingServiceAddr)
+	clientOpts := []grpc_clients.Option{
+		grpc_clients.WithStateWatcher(),
+		grpc_clients.WithPoolSize(*poolSize),
+		grpc_clients.WithKeepalive(keepalive.ClientParameters{Time: *keepaliveTime, Timeout: *keepaliveWait, PermitWithoutStream: true}),
+	}
+	if *apiKey != "" {
+		clientOpts = append(clientOpts, grpc_clients.WithAPIKey(*apiKey))
+	}
+	for service, key := range map[string]string{
+		grpc_clients.OrderService:    *orderAPIKey,
+		grpc_clients.PaymentService:  *paymentAPIKey,
+		grpc_clients.ShippingService: *shippingAPIKey,
+	} {
+		if key != "" {
+			clientOpts = append(clientOpts, grpc_clients.WithServiceAPIKey(service, key))
+		}
+	}
+	clients, err := grpc_clients.NewServiceClients(orderServiceAddr, paymentServiceAddr, shippingServiceAddr, clientOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create service clients: %v", err)
 	}
-	// Note: Connections are not closed in this simple example.
+
+	// Make sure every downstream service is reachable before accepting work
+	readyCtx, readyCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = clients.WaitReady(readyCtx)
+	readyCancel()
+	if err != nil {
+		log.Fatalf("Downstream services not ready: %v", err)
+	}
+
+	// Record what each downstream service is running; a service too old to
+	// report it is not a reason to stop
+	infoCtx, infoCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	serviceInfo, err := clients.ServiceInfo(infoCtx)
+	infoCancel()
+	if err != nil {
+		log.Printf("WARNING: Build info of some services unavailable: %v", err)
+	}
+	for _, info := range serviceInfo {
+		log.Printf("Downstream build: %s", buildinfo.String(info))
+	}
+	selfInfo := buildinfo.Info("orchestrator", map[string]string{
+		"tls":            "off",
+		"audit_log":      fileOrMemory(*auditLog),
+		"event_log":      fileOrMemory(*eventLog),
+		"parallel_steps": buildinfo.OnOff(*parallelSteps),
+		"async_complete": buildinfo.OnOff(*asyncComplete),
+		"dedup":          buildinfo.OnOff(*dedupTTL > 0),
+		"notify_webhook": buildinfo.OnOff(*notifyURL != ""),
+		"event_webhooks": buildinfo.OnOff(*eventHooks != ""),
+	})
+	log.Printf("Orchestrator build: %s", buildinfo.String(selfInfo))
 
 	// Create the orchestrator instance
-	sagaOrchestrator := orchestrator.NewOrchestrator(clients)
-
-	// --- Simulate an incoming order request ---
-	// In a real application, this might come from an API gateway or message queue.
-	log.Println("Simulating incoming order request...")
-	orderDetails := &commonpb.OrderDetails{
-		UserId: "user-123",
-		Items: []*commonpb.Item{
-			{ProductId: "prod-A", Quantity: 2, Price: 10.50},
-			{ProductId: "prod-B", Quantity: 1, Price: 25.00},
-		},
-	}
-	paymentInfo := &commonpb.PaymentInfo{
-		CardNumber: "xxxx-xxxx-xxxx-1234", // Dummy data
-		ExpiryDate: "12/26",
-		Cvv:        "123",
-		Amount:     46.00, // 2*10.50 + 25.00
-	}
-	shippingAddress := &commonpb.ShippingAddress{
-		Street:  "123 Saga Lane",
-		City:    "Orchestration City",
-		State:   "Workflow",
-		ZipCode: "98765",
-		Country: "GoLand",
-	}
-
-	// Execute the saga
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second) // Set a deadline for the saga
-	defer cancel()
-
-	err = sagaOrchestrator.ExecuteCreateOrderSaga(ctx, orderDetails, paymentInfo, shippingAddress)
+	var orchestratorOpts []orchestrator.Option
+	sagaIDGen, err := ids.Parse(*sagaIDs)
 	if err != nil {
-		log.Printf("Saga Execution Failed: %v", err)
+		log.Fatalf("Invalid -saga-ids: %v", err)
+	}
+	orchestratorOpts = append(orchestratorOpts, orchestrator.WithIDGenerator(sagaIDGen))
+	if *auditLog != "" {
+		auditStore, err := orchestrator.NewFileAuditStore(*auditLog)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithAuditStore(auditStore))
+	}
+	var eventSink orchestrator.EventSink
+	if *eventLog != "" {
+		if eventSink, err = orchestrator.NewFileEventSink(*eventLog); err != nil {
+			log.Fatalf("Failed to open event log: %v", err)
+		}
+	}
+	if *eventHooks != "" {
+		urls, err := orchestrator.ParseWebhookURLs(*eventHooks)
+		if err != nil {
+			log.Fatalf("Invalid -event-webhooks: %v", err)
+		}
+		if *eventHookKey == "" {
+			log.Println("WARNING: No -event-webhook-secret set, event webhook deliveries are unsigned")
+		}
+		if eventSink == nil {
+			eventSink = orchestrator.NewRingBufferEventSink(orchestrator.DefaultEventBufferSize)
+		}
+		eventSink = orchestrator.NewWebhookEventSink(eventSink, orchestrator.EventWebhookConfig{URLs: urls, Secret: *eventHookKey})
+		log.Printf("Delivering saga events to %d webhook(s)", len(urls))
+	}
+	if eventSink != nil {
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithEventSink(eventSink))
+	}
+	if *completionLog != "" {
+		completionStore, err := orchestrator.NewFileCompletionStore(*completionLog)
+		if err != nil {
+			log.Fatalf("Failed to open completion log: %v", err)
+		}
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithCompletionStore(completionStore))
+	}
+	if *retryBudget > 0 || *retryBudgetTime > 0 {
+		budget := grpc_clients.RetryBudgetConfig{MaxRetries: *retryBudget, MaxRetryTime: *retryBudgetTime}
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithRetryBudget(budget))
+	}
+	if *maxSagas > 0 {
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithMaxConcurrentSagas(*maxSagas, *maxSagasWait))
+	}
+	if *notifyURL != "" {
+		webhook := orchestrator.WebhookConfig{URL: *notifyURL, MaxAttempts: *notifyAttempts}
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithNotifier(orchestrator.NewWebhookNotifier(webhook)))
 	} else {
-		log.Println("Saga Execution Completed Successfully.")
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithNotifier(orchestrator.LogNotifier{}))
+	}
+	if *dedupTTL > 0 {
+		orchestratorOpts = append(orchestratorOpts, orchestrator.WithDeduplication(*dedupTTL))
+	}
+	orchestratorOpts = append(orchestratorOpts,
+		orchestrator.WithCancellationWindow(*cancelWindow),
+		orchestrator.WithCompensationTimeout(*compTimeout),
+		orchestrator.WithShutdownDeadline(*shutdownLimit),
+		orchestrator.WithParallelSteps(*parallelSteps),
+		orchestrator.WithAsyncComplete(*asyncComplete),
+		orchestrator.WithBuildInfo(selfInfo),
+		orchestrator.WithServiceInfo(serviceInfo),
+	)
+	sagaOrchestrator := orchestrator.NewOrchestrator(clients, orchestratorOpts...)
+	if pending, err := sagaOrchestrator.PendingCompletions(); err == nil && len(pending) > 0 {
+		log.Printf("Resuming %d pending order completion(s)", len(pending))
+	}
+
+	// Keep retrying orders that could not be marked COMPLETED until shutdown
+	go sagaOrchestrator.RunCompletionRetrier(sigCtx, *completionRetry)
+
+	// On shutdown, cancel in-flight sagas so they compensate before we exit
+	go func() {
+		<-sigCtx.Done()
+		log.Println("Shutdown requested: cancelling in-flight sagas...")
+		sagaOrchestrator.CancelAllSagas()
+	}()
+
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		httpServer = &http.Server{Addr: *httpAddr, Handler: sagaOrchestrator.HTTPHandler()}
+		go func() {
+			log.Printf("Orchestrator HTTP API listening on %s", *httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("HTTP API stopped: %v", err)
+			}
+		}()
+	}
+
+	var allOK bool
+	if *dryRun {
+		// Check the orders without creating, charging or shipping anything
+		allOK = validateOrders(sigCtx, sagaOrchestrator, orders, os.Stdout)
+	} else if *reconcile {
+		// Check the orders already there against their payments and shipments
+		allOK = reconcileOrders(sigCtx, sagaOrchestrator, os.Stdout)
+	} else if *load > 0 || *duration > 0 {
+		// Fire synthetic sagas and print a summary
+		cfg := loadtest.Config{Total: *load, Duration: *duration, Concurrency: *concurrency}
+		allOK = runLoad(sigCtx, sagaOrchestrator, cfg, *loadReport)
+	} else {
+		// Execute the sagas, printing one JSON result line per order
+		allOK = runOrders(sigCtx, sagaOrchestrator, orders, *concurrency, os.Stdout)
+	}
+
+	if httpServer != nil {
+		// Keep serving the HTTP API until interrupted
+		log.Println("Sagas finished; HTTP API still running, press Ctrl-C to exit.")
+		<-sigCtx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), server.DefaultDrainTimeout)
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP API shutdown: %v", err)
+		}
+		shutdownCancel()
+	}
+
+	// Every saga has finished or been cancelled; once the orders still being
+	// completed in the background are too, the stores can be flushed
+	if n := len(sagaOrchestrator.CompletingSagas()); n > 0 {
+		log.Printf("Waiting for %d background order completion(s)...", n)
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), server.DefaultDrainTimeout)
+		if err := sagaOrchestrator.WaitForCompletions(waitCtx); err != nil {
+			log.Printf("WARNING: Background order completions still running: %v", err)
+		}
+		waitCancel()
+	}
+	log.Println("Flushing saga stores...")
+	if err := sagaOrchestrator.Close(); err != nil {
+		log.Printf("Closing saga stores: %v", err)
+	}
+
+	log.Println("Closing downstream connections...")
+	if err := clients.Close(); err != nil {
+		log.Printf("Closing clients: %v", err)
 	}
 
 	log.Println("Orchestrator finished.")
+	if !allOK {
+		os.Exit(1)
+	}
+}
+
+// fileOrMemory describes where a store whose file flag is path keeps its data.
+func fileOrMemory(path string) string {
+	if path == "" {
+		return "memory"
+	}
+	return "file"
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+
+	"create-order-saga/internal/orchestrator"
+)
+
+// reconcileOrders checks the services' orders against their payments and
+// shipments, writing the report as JSON to out. It reports whether the check
+// ran and found no violations.
+func reconcileOrders(ctx context.Context, o *orchestrator.Orchestrator, out io.Writer) bool {
+	report, err := o.Reconcile(ctx)
+	if err != nil {
+		log.Printf("Reconciliation failed: %v", err)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Printf("Failed to write reconciliation report: %v", err)
+		return false
+	}
+	return err == nil && report.Consistent()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+)
+
+// sagaTimeout is the deadline given to each saga.
+const sagaTimeout = 30 * time.Second
+
+// sagaResult is the JSON line printed for every order.
+type sagaResult struct {
+	Index       int      `json:"index"`
+	SagaID      string   `json:"saga_id,omitempty"`
+	Success     bool     `json:"success"`
+	Error       string   `json:"error,omitempty"`
+	OrderID     string   `json:"order_id,omitempty"`
+	PaymentID   string   `json:"payment_id,omitempty"`
+	ShipmentIDs []string `json:"shipment_ids,omitempty"`
+}
+
+// runOrders executes a saga per order, at most concurrency at a time, writing
+// one JSON result line per order to out as each finishes. It reports whether
+// every saga succeeded.
+func runOrders(ctx context.Context, o *orchestrator.Orchestrator, orders []*orderInput, concurrency int, out io.Writer) bool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		mu    sync.Mutex // Guards enc and allOK
+		enc   = json.NewEncoder(out)
+		allOK = true
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, concurrency)
+	)
+	for i, in := range orders {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := runOrder(ctx, o, i, in)
+
+			mu.Lock()
+			defer mu.Unlock()
+			allOK = allOK && res.Success
+			if err := enc.Encode(res); err != nil {
+				log.Printf("Failed to write result for order %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return allOK
+}
+
+// runOrder executes the saga for a single order.
+func runOrder(ctx context.Context, o *orchestrator.Orchestrator, index int, in *orderInput) sagaResult {
+	ctx, cancel := context.WithTimeout(ctx, sagaTimeout) // Set a deadline for the saga
+	defer cancel()
+
+	state, err := o.RunCreateOrderSaga(ctx, in.Details, in.PaymentInfo, in.ShippingAddress)
+	res := sagaResult{Index: index, Success: err == nil}
+	if err != nil {
+		log.Printf("Saga Execution Failed for order %d: %v", index, err)
+		res.Error = err.Error()
+	} else {
+		log.Printf("Saga Execution Completed Successfully for order %d.", index)
+	}
+	if state != nil {
+		res.SagaID = state.SagaID
+		res.OrderID = state.OrderID.GetId()
+		res.PaymentID = state.PaymentID
+		res.ShipmentIDs = state.ShipmentIDs
+	}
+	return res
+}
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"flag"
 	"log"
-	"net"
+	"net/http"
+	"os"
+	"strings"
 
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
+	"create-order-saga/internal/buildinfo"
+	"create-order-saga/internal/logging"
 	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/server"
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/metrics"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
+	infopb "create-order-saga/proto/info"
 	orderpb "create-order-saga/proto/order"
 )
 
@@ -14,26 +26,153 @@ const (
 	port = ":50051" // Port for the Order service
 )
 
+var (
+	latencyMin = flag.Duration("latency-min", 0, "Minimum simulated latency added to every RPC")
+	latencyMax = flag.Duration("latency-max", 0, "Maximum simulated latency added to every RPC")
+	maxItems   = flag.Int("max-items", orderservice.DefaultMaxItems, "Maximum line items per order (0 disables the limit)")
+	maxQty     = flag.Int("max-quantity", orderservice.DefaultMaxQuantityPerItem, "Maximum quantity per line item (0 disables the limit)")
+	taxRates   = flag.String("tax-rates", "", "Tax percent by destination country or country-state, e.g. US-CA=7.25,DE=19 (no tax if empty)")
+	catalog    = flag.String("catalog", "", "Unit price by product ID in "+money.DefaultCurrency+", e.g. prod-A=10.50,prod-B=25; other products are refused (prices trusted if empty)")
+	srvPricing = flag.Bool("server-pricing", true, "Charge the -catalog prices instead of the submitted ones (if false, orders with other prices are refused)")
+	stock      = flag.String("stock", "", "Units in stock by product ID, e.g. p1=10,p2=5; orders for more are refused (stock not tracked if empty)")
+	outboxPoll = flag.Duration("outbox-interval", orderservice.DefaultOutboxPollInterval, "How often OrderCreated events are relayed from the outbox (to the log)")
+
+	addr             = flag.String("addr", port, "Address the gRPC server listens on (the orchestrator dials the default)")
+	apiKeys          = flag.String("api-keys", os.Getenv("SAGA_API_KEYS"), "Comma-separated API keys accepted from callers (authentication disabled if empty)")
+	metricsAddr      = flag.String("metrics-addr", ":9101", "Serve Prometheus metrics at /metrics on this address (disabled if empty)")
+	enableReflection = flag.Bool("reflection", false, "Register the gRPC reflection service (for grpcurl and similar tools)")
+	enableAdmin      = flag.Bool("enable-admin", false, "Register the InventoryAdmin, OrderAdmin and FailureAdmin services for changing stock levels, archiving or purging old orders and simulating latency or failures at runtime")
+	drainTimeout     = flag.Duration("drain-timeout", server.DefaultDrainTimeout, "Time allowed for in-flight RPCs to finish on shutdown")
+	slowRequest      = flag.Duration("slow-request", 0, "Log every RPC that takes at least this long to handle (disabled if 0)")
+	rateLimit        = flag.Float64("rate-limit", 0, "Requests per second allowed per tenant; the excess is refused with RESOURCE_EXHAUSTED and a retry hint (unlimited if 0)")
+	rateBurst        = flag.Int("rate-burst", 10, "Requests a tenant may make at once under -rate-limit")
+	chaos            = flag.String("chaos", "", "Chaos testing: inject failures/latency per method, e.g. CreateOrder=0.3@100ms (disabled if empty)")
+
+	maxRecvMsg    = flag.Int("max-recv-msg-size", 0, "Largest request accepted, in bytes; larger ones are rejected with RESOURCE_EXHAUSTED (gRPC's 4 MiB if 0)")
+	maxSendMsg    = flag.Int("max-send-msg-size", 0, "Largest response sent, in bytes (unlimited if 0)")
+	maxStreams    = flag.Uint("max-concurrent-streams", 0, "Concurrent RPCs allowed per client connection (unlimited if 0)")
+	keepaliveMin  = flag.Duration("keepalive-min-time", server.DefaultKeepaliveMinTime, "Disconnect clients sending keepalive pings more often than this (gRPC's 5m if 0)")
+	keepaliveIdle = flag.Bool("keepalive-without-calls", true, "Accept keepalive pings on connections without RPCs in flight, so idle connections stay open")
+	keepaliveTime = flag.Duration("keepalive-time", 0, "Ping clients after this long without activity (gRPC's 2h if 0)")
+	keepaliveWait = flag.Duration("keepalive-timeout", 0, "Close a connection whose ping is not answered within this long (gRPC's 20s if 0)")
+
+	logLevel  = flag.String("log-level", "info", "Least severe log level written: debug, info, warn or error")
+	logSample = flag.Int("log-sample", 0, "Write at most this many info logs a second from each line of code, dropping the rest (all if 0)")
+)
+
 func main() {
-	log.Printf("Starting Order Service on port %s", port)
+	flag.Parse()
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
+	logging.Setup(logging.Config{Level: level, Sampling: logging.PerSecond(*logSample)})
+	log.Printf("Starting Order Service on %s", *addr)
+	rates, err := orderservice.ParseTaxRates(*taxRates)
+	if err != nil {
+		log.Fatalf("Invalid -tax-rates: %v", err)
+	}
+	prices, err := orderservice.ParseCatalog(*catalog, money.DefaultCurrency)
+	if err != nil {
+		log.Fatalf("Invalid -catalog: %v", err)
+	}
+	levels, err := orderservice.ParseStock(*stock)
+	if err != nil {
+		log.Fatalf("Invalid -stock: %v", err)
+	}
 
-	lis, err := net.Listen("tcp", port)
+	lis, err := server.Listen("Order Service", *addr)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		log.Fatal(err)
 	}
 
-	// Create a new gRPC server
-	s := grpc.NewServer()
+	// Create a new gRPC server; it installs the interceptors in a fixed order
+	rpcMetrics := metrics.NewRegistry()
+	cfg := server.Config{
+		MaxRecvMsgSize:       *maxRecvMsg,
+		MaxSendMsgSize:       *maxSendMsg,
+		MaxConcurrentStreams: uint32(*maxStreams),
+		KeepaliveMinTime:     *keepaliveMin,
+		KeepaliveNoStream:    *keepaliveIdle,
+		KeepaliveTime:        *keepaliveTime,
+		KeepaliveTimeout:     *keepaliveWait,
+		Metrics:              rpcMetrics,
+		SlowRequest:          *slowRequest,
+	}
+	if *apiKeys != "" {
+		cfg.Auth = interceptors.NewStaticKeys(strings.Split(*apiKeys, ",")...)
+	} else {
+		log.Println("WARNING: No API keys configured, accepting unauthenticated calls")
+	}
+	if *rateLimit > 0 {
+		cfg.RateLimit = interceptors.NewRateLimiter(*rateLimit, *rateBurst, nil)
+	}
+	if *chaos != "" {
+		rules, err := simulation.ParseChaosRules(*chaos)
+		if err != nil {
+			log.Fatalf("Invalid -chaos: %v", err)
+		}
+		log.Printf("WARNING: Chaos testing enabled, injecting faults into %d method(s)", len(rules))
+		cfg.Unary = append(cfg.Unary, simulation.ChaosUnaryServerInterceptor(rules))
+	}
+	s := server.NewGRPCServer(cfg)
 
 	// Create an instance of our Order service implementation
-	orderServer := orderservice.NewServer()
+	orderOpts := []orderservice.Option{
+		orderservice.WithSimulatedLatency(*latencyMin, *latencyMax),
+		orderservice.WithMaxItems(*maxItems),
+		orderservice.WithMaxQuantityPerItem(int32(*maxQty)),
+		orderservice.WithTaxRates(rates),
+		orderservice.WithStock(levels),
+	}
+	if len(prices) > 0 {
+		log.Printf("Pricing %d product(s) from the catalog (server pricing %s)", len(prices), buildinfo.OnOff(*srvPricing))
+		orderOpts = append(orderOpts, orderservice.WithPriceCatalog(prices), orderservice.WithServerPricing(*srvPricing))
+	}
+	orderServer := orderservice.NewServer(orderOpts...)
 
 	// Register the Order service with the gRPC server
 	orderpb.RegisterOrderServiceServer(s, orderServer)
+	if *enableAdmin {
+		log.Println("WARNING: InventoryAdmin, OrderAdmin and FailureAdmin services enabled, stock levels can be changed, old orders archived or purged and latency or failures injected at runtime")
+		adminpb.RegisterInventoryAdminServer(s, orderServer.InventoryAdmin())
+		adminpb.RegisterOrderAdminServer(s, orderServer.OrderAdmin())
+		adminpb.RegisterFailureAdminServer(s, orderServer.FailureAdmin())
+	}
+
+	// Report the build and how optional features are set, for telling deployments apart
+	info := buildinfo.Info("order", map[string]string{
+		"tls":         "off",
+		"persistence": "memory",
+		"auth":        buildinfo.OnOff(*apiKeys != ""),
+		"chaos":       buildinfo.OnOff(*chaos != ""),
+		"rate_limit":  cfg.RateLimit.String(),
+		"stock":       buildinfo.OnOff(*stock != ""),
+		"catalog":     buildinfo.OnOff(len(prices) > 0),
+		"admin":       buildinfo.OnOff(*enableAdmin),
+	})
+	infopb.RegisterInfoServiceServer(s, buildinfo.NewServer(info))
+	log.Printf("Order Service build: %s", buildinfo.String(info))
+
+	// Register the standard health service, and reflection if requested
+	hs := server.RegisterHealth(s, orderpb.OrderService_ServiceDesc.ServiceName)
+	if *enableReflection {
+		reflection.Register(s)
+	}
+
+	// Expose per-RPC metrics over HTTP
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", rpcMetrics)
+	closeMetrics, err := server.ListenHTTP("Order Service metrics", *metricsAddr, mux)
+	if err != nil {
+		log.Fatalf("Failed to start metrics server: %v", err)
+	}
 
-	log.Printf("Order Service listening at %v", lis.Addr())
-	// Start serving requests
-	if err := s.Serve(lis); err != nil {
+	// Start serving requests until SIGINT/SIGTERM, then drain gracefully
+	ctx, stop := server.SignalContext()
+	defer stop()
+	go orderservice.NewOutboxRelay(orderServer, orderservice.LogPublisher, *outboxPoll).Run(ctx)
+	if err := server.Serve(ctx, "Order Service", s, hs, lis, *drainTimeout, closeMetrics); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"flag"
 	"log"
-	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
+	"create-order-saga/internal/buildinfo"
+	"create-order-saga/internal/logging"
 	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/server"
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/metrics"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
+	commonpb "create-order-saga/proto/common"
+	infopb "create-order-saga/proto/info"
 	paymentpb "create-order-saga/proto/payment"
 )
 
@@ -14,26 +28,173 @@ const (
 	port = ":50052" // Port for the Payment service (different from Order service)
 )
 
+var (
+	latencyMin  = flag.Duration("latency-min", 0, "Minimum simulated latency added to every RPC")
+	latencyMax  = flag.Duration("latency-max", 0, "Maximum simulated latency added to every RPC")
+	failureRate = flag.Float64("failure-rate", paymentservice.DefaultFailureRate, "Probability (0-1) that a valid payment is declined")
+	outageRate  = flag.Float64("outage-rate", 0, "Probability (0-1) that the simulated payment gateway is unavailable")
+	gateways    = flag.String("gateways", "", "Comma-separated simulated gateways tried in order, as name[=outage rate], e.g. primary=0.5,backup (one gateway if empty)")
+	failover    = flag.Bool("gateway-failover", true, "Charge through the next gateway in -gateways when one is unavailable")
+	maxAmount   = flag.String("max-amount", "", "Payments above this amount (e.g. 500.00, in "+money.DefaultCurrency+") are held for manual review (no limit if empty)")
+	dupWindow   = flag.Duration("duplicate-window", 0, "Refuse to charge a card or account the same amount again for another order within this long, unless the request allows it (0 = off)")
+	dupStrict   = flag.Bool("strict-duplicates", false, "Answer suspected duplicate payments with FAILED instead of DUPLICATE_SUSPECTED")
+	currencies  = flag.String("currencies", "", "Comma-separated currencies payments are accepted in, e.g. USD,EUR (any if empty)")
+
+	addr             = flag.String("addr", port, "Address the gRPC server listens on (the orchestrator dials the default)")
+	apiKeys          = flag.String("api-keys", os.Getenv("SAGA_API_KEYS"), "Comma-separated API keys accepted from callers (authentication disabled if empty)")
+	metricsAddr      = flag.String("metrics-addr", ":9102", "Serve Prometheus metrics at /metrics on this address (disabled if empty)")
+	enableAdmin      = flag.Bool("enable-admin", false, "Register the FailureAdmin service for changing latency and failure simulation at runtime")
+	enableReflection = flag.Bool("reflection", false, "Register the gRPC reflection service (for grpcurl and similar tools)")
+	drainTimeout     = flag.Duration("drain-timeout", server.DefaultDrainTimeout, "Time allowed for in-flight RPCs to finish on shutdown")
+	slowRequest      = flag.Duration("slow-request", 0, "Log every RPC that takes at least this long to handle (disabled if 0)")
+	rateLimit        = flag.Float64("rate-limit", 0, "Requests per second allowed per tenant; the excess is refused with RESOURCE_EXHAUSTED and a retry hint (unlimited if 0)")
+	rateBurst        = flag.Int("rate-burst", 10, "Requests a tenant may make at once under -rate-limit")
+	chaos            = flag.String("chaos", "", "Chaos testing: inject failures/latency per method, e.g. ProcessPayment=0.3@100ms (disabled if empty)")
+
+	maxRecvMsg    = flag.Int("max-recv-msg-size", 0, "Largest request accepted, in bytes; larger ones are rejected with RESOURCE_EXHAUSTED (gRPC's 4 MiB if 0)")
+	maxSendMsg    = flag.Int("max-send-msg-size", 0, "Largest response sent, in bytes (unlimited if 0)")
+	maxStreams    = flag.Uint("max-concurrent-streams", 0, "Concurrent RPCs allowed per client connection (unlimited if 0)")
+	keepaliveMin  = flag.Duration("keepalive-min-time", server.DefaultKeepaliveMinTime, "Disconnect clients sending keepalive pings more often than this (gRPC's 5m if 0)")
+	keepaliveIdle = flag.Bool("keepalive-without-calls", true, "Accept keepalive pings on connections without RPCs in flight, so idle connections stay open")
+	keepaliveTime = flag.Duration("keepalive-time", 0, "Ping clients after this long without activity (gRPC's 2h if 0)")
+	keepaliveWait = flag.Duration("keepalive-timeout", 0, "Close a connection whose ping is not answered within this long (gRPC's 20s if 0)")
+
+	logLevel  = flag.String("log-level", "info", "Least severe log level written: debug, info, warn or error")
+	logSample = flag.Int("log-sample", 0, "Write at most this many info logs a second from each line of code, dropping the rest (all if 0)")
+)
+
 func main() {
-	log.Printf("Starting Payment Service on port %s", port)
+	flag.Parse()
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
+	logging.Setup(logging.Config{Level: level, Sampling: logging.PerSecond(*logSample)})
+	log.Printf("Starting Payment Service on %s", *addr)
+
+	var limit *commonpb.Money
+	if *maxAmount != "" {
+		var err error
+		if limit, err = money.Parse(money.DefaultCurrency, *maxAmount); err != nil {
+			log.Fatalf("Invalid -max-amount: %v", err)
+		}
+	}
 
-	lis, err := net.Listen("tcp", port)
+	accepted, err := money.ParseCurrencies(*currencies)
+	if err != nil {
+		log.Fatalf("Invalid -currencies: %v", err)
+	}
+	backends, err := paymentservice.ParseSimulatedGateways(*gateways, *failureRate, *outageRate)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		log.Fatalf("Invalid -gateways: %v", err)
 	}
 
-	// Create a new gRPC server
-	s := grpc.NewServer()
+	lis, err := server.Listen("Payment Service", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create a new gRPC server; it installs the interceptors in a fixed order
+	rpcMetrics := metrics.NewRegistry()
+	cfg := server.Config{
+		MaxRecvMsgSize:       *maxRecvMsg,
+		MaxSendMsgSize:       *maxSendMsg,
+		MaxConcurrentStreams: uint32(*maxStreams),
+		KeepaliveMinTime:     *keepaliveMin,
+		KeepaliveNoStream:    *keepaliveIdle,
+		KeepaliveTime:        *keepaliveTime,
+		KeepaliveTimeout:     *keepaliveWait,
+		Metrics:              rpcMetrics,
+		SlowRequest:          *slowRequest,
+	}
+	if *apiKeys != "" {
+		cfg.Auth = interceptors.NewStaticKeys(strings.Split(*apiKeys, ",")...)
+	} else {
+		log.Println("WARNING: No API keys configured, accepting unauthenticated calls")
+	}
+	if *rateLimit > 0 {
+		cfg.RateLimit = interceptors.NewRateLimiter(*rateLimit, *rateBurst, nil)
+	}
+	if *chaos != "" {
+		rules, err := simulation.ParseChaosRules(*chaos)
+		if err != nil {
+			log.Fatalf("Invalid -chaos: %v", err)
+		}
+		log.Printf("WARNING: Chaos testing enabled, injecting faults into %d method(s)", len(rules))
+		cfg.Unary = append(cfg.Unary, simulation.ChaosUnaryServerInterceptor(rules))
+	}
+	s := server.NewGRPCServer(cfg)
 
 	// Create an instance of our Payment service implementation
-	paymentServer := paymentservice.NewServer()
+	paymentServer := paymentservice.NewServer(
+		paymentservice.WithSimulatedLatency(*latencyMin, *latencyMax),
+		paymentservice.WithGateways(backends...),
+		paymentservice.WithGatewayFailover(*failover),
+		paymentservice.WithMaxAmount(limit),
+		paymentservice.WithFailureRate(*failureRate),
+		paymentservice.WithOutageRate(*outageRate),
+		paymentservice.WithDuplicateWindow(*dupWindow),
+		paymentservice.WithStrictDuplicates(*dupStrict),
+		paymentservice.WithCurrencies(accepted),
+	)
 
 	// Register the Payment service with the gRPC server
 	paymentpb.RegisterPaymentServiceServer(s, paymentServer)
+	if *enableAdmin {
+		log.Println("WARNING: FailureAdmin service enabled, latency and failures can be injected at runtime")
+		adminpb.RegisterFailureAdminServer(s, paymentServer.FailureAdmin())
+	}
+
+	// Report the build and how optional features are set, for telling deployments apart
+	info := buildinfo.Info("payment", map[string]string{
+		"tls":           "off",
+		"persistence":   "memory",
+		"auth":          buildinfo.OnOff(*apiKeys != ""),
+		"chaos":         buildinfo.OnOff(*chaos != ""),
+		"rate_limit":    cfg.RateLimit.String(),
+		"failure_rate":  strconv.FormatFloat(*failureRate, 'g', -1, 64),
+		"failure_admin": buildinfo.OnOff(*enableAdmin),
+		"gateways":      orSimulated(*gateways),
+		"failover":      buildinfo.OnOff(*failover),
+		"currencies":    orAny(*currencies),
+	})
+	infopb.RegisterInfoServiceServer(s, buildinfo.NewServer(info))
+	log.Printf("Payment Service build: %s", buildinfo.String(info))
 
-	log.Printf("Payment Service listening at %v", lis.Addr())
-	// Start serving requests
-	if err := s.Serve(lis); err != nil {
+	// Register the standard health service, and reflection if requested
+	hs := server.RegisterHealth(s, paymentpb.PaymentService_ServiceDesc.ServiceName)
+	if *enableReflection {
+		reflection.Register(s)
+	}
+
+	// Expose per-RPC metrics over HTTP
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", rpcMetrics)
+	closeMetrics, err := server.ListenHTTP("Payment Service metrics", *metricsAddr, mux)
+	if err != nil {
+		log.Fatalf("Failed to start metrics server: %v", err)
+	}
+
+	// Start serving requests until SIGINT/SIGTERM, then drain gracefully
+	ctx, stop := server.SignalContext()
+	defer stop()
+	if err := server.Serve(ctx, "Payment Service", s, hs, lis, *drainTimeout, closeMetrics); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
+
+// orAny renders an allowlist flag for build info, "any" if empty.
+func orAny(list string) string {
+	if list == "" {
+		return "any"
+	}
+	return list
+}
+
+// orSimulated names the gateways of -gateways for build info.
+func orSimulated(list string) string {
+	if list == "" {
+		return paymentservice.SimulatedGatewayName
+	}
+	return list
+}
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"flag"
 	"log"
-	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
+	"create-order-saga/internal/buildinfo"
+	"create-order-saga/internal/logging"
+	"create-order-saga/internal/server"
 	shippingservice "create-order-saga/internal/shipping"
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/metrics"
+	adminpb "create-order-saga/proto/admin"
+	infopb "create-order-saga/proto/info"
 	shippingpb "create-order-saga/proto/shipping"
 )
 
@@ -14,26 +26,142 @@ const (
 	port = ":50053" // Port for the Shipping service (different from others)
 )
 
+var (
+	latencyMin  = flag.Duration("latency-min", 0, "Minimum simulated latency added to every RPC")
+	latencyMax  = flag.Duration("latency-max", 0, "Maximum simulated latency added to every RPC")
+	failureRate = flag.Float64("failure-rate", shippingservice.DefaultFailureRate, "Probability (0-1) that arranging shipping fails")
+	warehouses  = flag.String("warehouses", "", "Warehouse stocking each product, e.g. prod-A=east,prod-B=west (unlisted products ship from \""+shippingservice.DefaultWarehouse+"\")")
+
+	addr             = flag.String("addr", port, "Address the gRPC server listens on (the orchestrator dials the default)")
+	apiKeys          = flag.String("api-keys", os.Getenv("SAGA_API_KEYS"), "Comma-separated API keys accepted from callers (authentication disabled if empty)")
+	metricsAddr      = flag.String("metrics-addr", ":9103", "Serve Prometheus metrics at /metrics on this address (disabled if empty)")
+	carrierAddr      = flag.String("carrier-webhook-addr", "", "Accept carrier tracking updates at POST /carrier/webhook on this address (disabled if empty)")
+	carrierSecret    = flag.String("carrier-webhook-secret", os.Getenv("SAGA_CARRIER_WEBHOOK_SECRET"), "Secret carriers sign tracking updates with (HMAC-SHA256); required with -carrier-webhook-addr")
+	enableAdmin      = flag.Bool("enable-admin", false, "Register the FailureAdmin service for changing latency and failure simulation at runtime")
+	enableReflection = flag.Bool("reflection", false, "Register the gRPC reflection service (for grpcurl and similar tools)")
+	drainTimeout     = flag.Duration("drain-timeout", server.DefaultDrainTimeout, "Time allowed for in-flight RPCs to finish on shutdown")
+	slowRequest      = flag.Duration("slow-request", 0, "Log every RPC that takes at least this long to handle (disabled if 0)")
+	rateLimit        = flag.Float64("rate-limit", 0, "Requests per second allowed per tenant; the excess is refused with RESOURCE_EXHAUSTED and a retry hint (unlimited if 0)")
+	rateBurst        = flag.Int("rate-burst", 10, "Requests a tenant may make at once under -rate-limit")
+	chaos            = flag.String("chaos", "", "Chaos testing: inject failures/latency per method, e.g. ArrangeShipping=0.3@100ms (disabled if empty)")
+
+	maxRecvMsg    = flag.Int("max-recv-msg-size", 0, "Largest request accepted, in bytes; larger ones are rejected with RESOURCE_EXHAUSTED (gRPC's 4 MiB if 0)")
+	maxSendMsg    = flag.Int("max-send-msg-size", 0, "Largest response sent, in bytes (unlimited if 0)")
+	maxStreams    = flag.Uint("max-concurrent-streams", 0, "Concurrent RPCs allowed per client connection (unlimited if 0)")
+	keepaliveMin  = flag.Duration("keepalive-min-time", server.DefaultKeepaliveMinTime, "Disconnect clients sending keepalive pings more often than this (gRPC's 5m if 0)")
+	keepaliveIdle = flag.Bool("keepalive-without-calls", true, "Accept keepalive pings on connections without RPCs in flight, so idle connections stay open")
+	keepaliveTime = flag.Duration("keepalive-time", 0, "Ping clients after this long without activity (gRPC's 2h if 0)")
+	keepaliveWait = flag.Duration("keepalive-timeout", 0, "Close a connection whose ping is not answered within this long (gRPC's 20s if 0)")
+
+	logLevel  = flag.String("log-level", "info", "Least severe log level written: debug, info, warn or error")
+	logSample = flag.Int("log-sample", 0, "Write at most this many info logs a second from each line of code, dropping the rest (all if 0)")
+)
+
 func main() {
-	log.Printf("Starting Shipping Service on port %s", port)
+	flag.Parse()
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
+	logging.Setup(logging.Config{Level: level, Sampling: logging.PerSecond(*logSample)})
+	log.Printf("Starting Shipping Service on %s", *addr)
 
-	lis, err := net.Listen("tcp", port)
+	stock, err := shippingservice.ParseWarehouses(*warehouses)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		log.Fatalf("Invalid -warehouses: %v", err)
 	}
 
-	// Create a new gRPC server
-	s := grpc.NewServer()
+	lis, err := server.Listen("Shipping Service", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create a new gRPC server; it installs the interceptors in a fixed order
+	rpcMetrics := metrics.NewRegistry()
+	cfg := server.Config{
+		MaxRecvMsgSize:       *maxRecvMsg,
+		MaxSendMsgSize:       *maxSendMsg,
+		MaxConcurrentStreams: uint32(*maxStreams),
+		KeepaliveMinTime:     *keepaliveMin,
+		KeepaliveNoStream:    *keepaliveIdle,
+		KeepaliveTime:        *keepaliveTime,
+		KeepaliveTimeout:     *keepaliveWait,
+		Metrics:              rpcMetrics,
+		SlowRequest:          *slowRequest,
+	}
+	if *apiKeys != "" {
+		cfg.Auth = interceptors.NewStaticKeys(strings.Split(*apiKeys, ",")...)
+	} else {
+		log.Println("WARNING: No API keys configured, accepting unauthenticated calls")
+	}
+	if *rateLimit > 0 {
+		cfg.RateLimit = interceptors.NewRateLimiter(*rateLimit, *rateBurst, nil)
+	}
+	if *chaos != "" {
+		rules, err := simulation.ParseChaosRules(*chaos)
+		if err != nil {
+			log.Fatalf("Invalid -chaos: %v", err)
+		}
+		log.Printf("WARNING: Chaos testing enabled, injecting faults into %d method(s)", len(rules))
+		cfg.Unary = append(cfg.Unary, simulation.ChaosUnaryServerInterceptor(rules))
+	}
+	s := server.NewGRPCServer(cfg)
 
 	// Create an instance of our Shipping service implementation
-	shippingServer := shippingservice.NewServer()
+	shippingServer := shippingservice.NewServer(
+		shippingservice.WithSimulatedLatency(*latencyMin, *latencyMax),
+		shippingservice.WithFailureRate(*failureRate),
+		shippingservice.WithWarehouses(stock),
+	)
 
 	// Register the Shipping service with the gRPC server
 	shippingpb.RegisterShippingServiceServer(s, shippingServer)
+	if *enableAdmin {
+		log.Println("WARNING: FailureAdmin service enabled, latency and failures can be injected at runtime")
+		adminpb.RegisterFailureAdminServer(s, shippingServer.FailureAdmin())
+	}
+
+	// Report the build and how optional features are set, for telling deployments apart
+	info := buildinfo.Info("shipping", map[string]string{
+		"tls":           "off",
+		"persistence":   "memory",
+		"auth":          buildinfo.OnOff(*apiKeys != ""),
+		"chaos":         buildinfo.OnOff(*chaos != ""),
+		"rate_limit":    cfg.RateLimit.String(),
+		"failure_rate":  strconv.FormatFloat(*failureRate, 'g', -1, 64),
+		"failure_admin": buildinfo.OnOff(*enableAdmin),
+		"carrier_hook":  buildinfo.OnOff(*carrierAddr != ""),
+	})
+	infopb.RegisterInfoServiceServer(s, buildinfo.NewServer(info))
+	log.Printf("Shipping Service build: %s", buildinfo.String(info))
+
+	// Register the standard health service, and reflection if requested
+	hs := server.RegisterHealth(s, shippingpb.ShippingService_ServiceDesc.ServiceName)
+	if *enableReflection {
+		reflection.Register(s)
+	}
+
+	// Expose per-RPC metrics over HTTP
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", rpcMetrics)
+	closeMetrics, err := server.ListenHTTP("Shipping Service metrics", *metricsAddr, mux)
+	if err != nil {
+		log.Fatalf("Failed to start metrics server: %v", err)
+	}
+
+	// Accept tracking updates pushed by carriers, signed so no one else can move shipments on
+	if *carrierAddr != "" && *carrierSecret == "" {
+		log.Fatalf("-carrier-webhook-addr requires -carrier-webhook-secret")
+	}
+	closeCarrier, err := server.ListenHTTP("Shipping Service carrier webhook", *carrierAddr, shippingServer.CarrierWebhookHandler(*carrierSecret))
+	if err != nil {
+		log.Fatalf("Failed to start carrier webhook server: %v", err)
+	}
 
-	log.Printf("Shipping Service listening at %v", lis.Addr())
-	// Start serving requests
-	if err := s.Serve(lis); err != nil {
+	// Start serving requests until SIGINT/SIGTERM, then drain gracefully
+	ctx, stop := server.SignalContext()
+	defer stop()
+	if err := server.Serve(ctx, "Shipping Service", s, hs, lis, *drainTimeout, closeMetrics, closeCarrier); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
@@ -0,0 +1,87 @@
+package buildinfo_test
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"create-order-saga/internal/buildinfo"
+	infopb "create-order-saga/proto/info"
+)
+
+// inject sets the version fields as -ldflags -X would, until the test ends.
+func inject(t *testing.T, version, commit, buildTime string) {
+	t.Helper()
+	old := [3]string{buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime}
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = version, commit, buildTime
+	t.Cleanup(func() { buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = old[0], old[1], old[2] })
+}
+
+// TestGetInfo serves a binary's info over gRPC and checks GetInfo returns the
+// injected version fields and the features it was created with.
+func TestGetInfo(t *testing.T) {
+	inject(t, "v1.4.0", "1a2b3c4d5e6f7a8b9c0d", "2024-05-01T10:00:00Z")
+	features := map[string]string{"tls": "off", "persistence": "memory"}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	infopb.RegisterInfoServiceServer(s, buildinfo.NewServer(buildinfo.Info("payment", features)))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	features["tls"] = "on" // Changed after the fact, which the served info must not see
+
+	conn, err := grpc.NewClient("passthrough:///payment",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer conn.Close()
+	got, err := infopb.NewInfoServiceClient(conn).GetInfo(context.Background(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("GetInfo: %v", err)
+	}
+	want := &infopb.ServiceInfo{
+		Service:   "payment",
+		Version:   "v1.4.0",
+		Commit:    "1a2b3c4d5e6f7a8b9c0d",
+		BuildTime: "2024-05-01T10:00:00Z",
+		GoVersion: runtime.Version(),
+		Features:  map[string]string{"tls": "off", "persistence": "memory"},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("GetInfo = %v, want %v", got, want)
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		info *infopb.ServiceInfo
+		want string
+	}{
+		{
+			name: "release",
+			info: &infopb.ServiceInfo{Service: "order", Version: "v1.4.0", Commit: "1a2b3c4d5e6f7a8b9c0d", BuildTime: "2024-05-01T10:00:00Z", GoVersion: "go1.24.1", Features: map[string]string{"tls": "off", "auth": "on"}},
+			want: "order v1.4.0 (commit 1a2b3c4d5e6f, built 2024-05-01T10:00:00Z, go1.24.1; auth=on tls=off)",
+		},
+		{
+			name: "unknown build",
+			info: &infopb.ServiceInfo{Service: "shipping", Version: "dev", GoVersion: "go1.24.1"},
+			want: "shipping dev (commit unknown, built unknown, go1.24.1)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := buildinfo.String(tc.info); got != tc.want {
+				t.Errorf("String = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package embedded runs the Order, Payment and Shipping services in-process on
+// ephemeral localhost ports, for the all-in-one demo binary and end-to-end tests.
+package embedded
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"create-order-saga/internal/buildinfo"
+	orderservice "create-order-saga/internal/order"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/server"
+	shippingservice "create-order-saga/internal/shipping"
+	"create-order-saga/pkg/grpc_clients"
+	commonpb "create-order-saga/proto/common"
+	infopb "create-order-saga/proto/info"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// Config holds the simulation settings passed through to each embedded service.
+type Config struct {
+	LatencyMin          time.Duration
+	LatencyMax          time.Duration
+	PaymentFailureRate  float64
+	PaymentOutageRate   float64 // Probability that the simulated payment gateway is unavailable
+	ShippingFailureRate float64
+	MaxAmount           *commonpb.Money // Payment amount limit; nil disables it
+}
+
+// DefaultConfig matches the defaults of the standalone service binaries.
+func DefaultConfig() Config {
+	return Config{
+		PaymentFailureRate:  paymentservice.DefaultFailureRate,
+		ShippingFailureRate: shippingservice.DefaultFailureRate,
+	}
+}
+
+// Stack is a running set of the three saga services.
+type Stack struct {
+	Order    *orderservice.Server
+	Payment  *paymentservice.Server
+	Shipping *shippingservice.Server
+
+	OrderAddr    string
+	PaymentAddr  string
+	ShippingAddr string
+
+	servers []*grpc.Server
+}
+
+// Start creates the three services and serves each on its own ephemeral port.
+func Start(cfg Config) (*Stack, error) {
+	st := &Stack{
+		Order: orderservice.NewServer(orderservice.WithSimulatedLatency(cfg.LatencyMin, cfg.LatencyMax)),
+		Payment: paymentservice.NewServer(
+			paymentservice.WithSimulatedLatency(cfg.LatencyMin, cfg.LatencyMax),
+			paymentservice.WithFailureRate(cfg.PaymentFailureRate),
+			paymentservice.WithOutageRate(cfg.PaymentOutageRate),
+			paymentservice.WithMaxAmount(cfg.MaxAmount),
+		),
+		Shipping: shippingservice.NewServer(
+			shippingservice.WithSimulatedLatency(cfg.LatencyMin, cfg.LatencyMax),
+			shippingservice.WithFailureRate(cfg.ShippingFailureRate),
+		),
+	}
+
+	services := []struct {
+		name     string
+		addr     *string
+		register func(*grpc.Server)
+	}{
+		{"order", &st.OrderAddr, func(s *grpc.Server) { orderpb.RegisterOrderServiceServer(s, st.Order) }},
+		{"payment", &st.PaymentAddr, func(s *grpc.Server) { paymentpb.RegisterPaymentServiceServer(s, st.Payment) }},
+		{"shipping", &st.ShippingAddr, func(s *grpc.Server) { shippingpb.RegisterShippingServiceServer(s, st.Shipping) }},
+	}
+	for _, svc := range services {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			st.Stop()
+			return nil, fmt.Errorf("listening for embedded %s service: %w", svc.name, err)
+		}
+		s := server.NewGRPCServer(server.Config{KeepaliveMinTime: server.DefaultKeepaliveMinTime, KeepaliveNoStream: true})
+		svc.register(s)
+		infopb.RegisterInfoServiceServer(s, buildinfo.NewServer(buildinfo.Info(svc.name, map[string]string{"embedded": "on"})))
+		*svc.addr = lis.Addr().String()
+		st.servers = append(st.servers, s)
+		go func() {
+			if err := s.Serve(lis); err != nil {
+				log.Printf("Embedded %s service stopped: %v", svc.name, err)
+			}
+		}()
+		log.Printf("Embedded %s service listening at %s", svc.name, *svc.addr)
+	}
+	return st, nil
+}
+
+// Clients connects ServiceClients to the embedded services.
+func (st *Stack) Clients(opts ...grpc_clients.Option) (*grpc_clients.ServiceClients, error) {
+	return grpc_clients.NewServiceClients(st.OrderAddr, st.PaymentAddr, st.ShippingAddr, opts...)
+}
+
+// Stop gracefully stops every embedded service.
+func (st *Stack) Stop() {
+	for _, s := range st.servers {
+		s.GracefulStop()
+	}
+}
@@ -0,0 +1,75 @@
+// Package loadtest generates synthetic orders, fires sagas at a fixed
+// concurrency and aggregates latency and outcome statistics.
+package loadtest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+)
+
+// Order is one synthetic saga input.
+type Order struct {
+	Details         *commonpb.OrderDetails
+	PaymentInfo     *commonpb.PaymentInfo
+	ShippingAddress *commonpb.ShippingAddress
+}
+
+// Generator produces randomized orders. It is safe for concurrent use.
+type Generator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+	next int
+}
+
+// NewGenerator creates a generator; the same seed yields the same orders.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Next returns a new order with 1-4 random items. User IDs are unique per
+// generator because order IDs are derived from them.
+func (g *Generator) Next() Order {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+
+	items := make([]*commonpb.Item, 1+g.rand.Intn(4))
+	var amount int64 // In cents
+	for i := range items {
+		price := int64(1 + g.rand.Intn(10000)) // 0.01 - 100.00
+		qty := int32(1 + g.rand.Intn(3))
+		product := g.rand.Intn(100)
+		items[i] = &commonpb.Item{
+			ProductId:   fmt.Sprintf("prod-%d", product),
+			Name:        fmt.Sprintf("Product %d", product),
+			Sku:         fmt.Sprintf("SKU-%03d", product),
+			WeightGrams: int32(50 + g.rand.Intn(5000)), // 0.05 - 5.05 kg
+			Quantity:    qty,
+			Price:       money.FromMinor(money.DefaultCurrency, price),
+		}
+		amount += price * int64(qty)
+	}
+	return Order{
+		Details: &commonpb.OrderDetails{
+			UserId: fmt.Sprintf("load-user-%d-%04d", g.next, g.rand.Intn(10000)),
+			Items:  items,
+		},
+		PaymentInfo: &commonpb.PaymentInfo{
+			CardNumber: "4242-4242-4242-4242", // Luhn-valid test number
+			ExpiryDate: "12/30",
+			Cvv:        "123",
+			Amount:     money.FromMinor(money.DefaultCurrency, amount),
+		},
+		ShippingAddress: &commonpb.ShippingAddress{
+			Street:  fmt.Sprintf("%d Load Street", 1+g.rand.Intn(999)),
+			City:    "Benchmark City",
+			State:   "Stress",
+			ZipCode: fmt.Sprintf("%05d", g.rand.Intn(100000)),
+			Country: "GoLand",
+		},
+	}
+}
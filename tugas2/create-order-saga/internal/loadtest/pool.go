@@ -0,0 +1,58 @@
+package loadtest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Config bounds a load run. A run stops at whichever limit is reached first;
+// at least one of Total or Duration should be set, or the run lasts until ctx is done.
+type Config struct {
+	Total       int           // Number of jobs to run; 0 means unlimited
+	Duration    time.Duration // Stop starting new jobs after this long; 0 means unlimited
+	Concurrency int           // Jobs running at once (at least 1)
+}
+
+// Run calls job with increasing indexes from Concurrency workers until a limit
+// in cfg is reached or ctx is done, then waits for running jobs to return.
+// Jobs receive ctx itself, so they are not cut short when Duration elapses.
+// It returns the number of jobs started.
+func Run(ctx context.Context, cfg Config, job func(ctx context.Context, i int)) int {
+	workers := cfg.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	dispatchCtx := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		dispatchCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				job(ctx, i)
+			}
+		}()
+	}
+
+	started := 0
+dispatch:
+	for cfg.Total <= 0 || started < cfg.Total {
+		select {
+		case <-dispatchCtx.Done():
+			break dispatch
+		case jobs <- started:
+			started++
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return started
+}
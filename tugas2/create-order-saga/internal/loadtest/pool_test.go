@@ -0,0 +1,91 @@
+package loadtest_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/loadtest"
+)
+
+// TestRunTotal runs a fixed number of jobs and checks each index is run once
+// and no more than Concurrency jobs run at a time.
+func TestRunTotal(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		total, workers  int
+		wantConcurrency int32
+	}{
+		{"one worker", 20, 1, 1},
+		{"four workers", 40, 4, 4},
+		{"no concurrency set", 5, 0, 1},
+		{"more workers than jobs", 3, 10, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var running, peak atomic.Int32
+			var mu sync.Mutex
+			seen := make(map[int]int)
+			started := loadtest.Run(context.Background(), loadtest.Config{Total: tc.total, Concurrency: tc.workers}, func(ctx context.Context, i int) {
+				n := running.Add(1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				time.Sleep(5 * time.Millisecond) // Give the other workers time to overlap
+				running.Add(-1)
+				mu.Lock()
+				seen[i]++
+				mu.Unlock()
+			})
+
+			if started != tc.total || len(seen) != tc.total {
+				t.Errorf("started %d jobs with %d distinct indexes, want %d", started, len(seen), tc.total)
+			}
+			for i := range tc.total {
+				if seen[i] != 1 {
+					t.Errorf("job %d ran %d times, want once", i, seen[i])
+				}
+			}
+			if got := peak.Load(); got != tc.wantConcurrency {
+				t.Errorf("at most %d jobs ran at once, want %d", got, tc.wantConcurrency)
+			}
+		})
+	}
+}
+
+// TestRunDuration stops starting jobs once Duration has elapsed, but lets
+// running jobs finish with a live context.
+func TestRunDuration(t *testing.T) {
+	var finished atomic.Int32
+	start := time.Now()
+	started := loadtest.Run(context.Background(), loadtest.Config{Duration: 50 * time.Millisecond, Concurrency: 2}, func(ctx context.Context, i int) {
+		time.Sleep(10 * time.Millisecond)
+		if ctx.Err() != nil {
+			t.Errorf("job %d got a done context", i)
+		}
+		finished.Add(1)
+	})
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("run took %v, want about its 50ms duration", elapsed)
+	}
+	if started == 0 || int(finished.Load()) != started {
+		t.Errorf("started %d jobs and %d finished, want some, all finished", started, finished.Load())
+	}
+}
+
+// TestRunCancelled stops a run without limits when its context is cancelled
+// and waits for the jobs that were running.
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var finished atomic.Int32
+	started := loadtest.Run(ctx, loadtest.Config{Concurrency: 3}, func(ctx context.Context, i int) {
+		if i == 2 { // Every worker is busy now
+			cancel()
+		}
+		<-ctx.Done()
+		finished.Add(1)
+	})
+	if started < 3 || int(finished.Load()) != started {
+		t.Errorf("started %d jobs and %d finished, want at least 3, all finished", started, finished.Load())
+	}
+}
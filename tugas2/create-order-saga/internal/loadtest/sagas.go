@@ -0,0 +1,31 @@
+package loadtest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+)
+
+// RunSagas runs a saga on o for every order gen produces, as bounded by cfg,
+// each with its own timeout, and aggregates their results. A cancelled ctx
+// stops the run early; the report then covers the sagas that were started.
+func RunSagas(ctx context.Context, o *orchestrator.Orchestrator, gen *Generator, cfg Config, timeout time.Duration) Report {
+	stats := NewStats()
+	start := time.Now()
+	Run(ctx, cfg, func(ctx context.Context, i int) {
+		order := gen.Next()
+		sagaCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		began := time.Now()
+		state, err := o.RunCreateOrderSaga(sagaCtx, order.Details, order.PaymentInfo, order.ShippingAddress)
+		d := time.Since(began)
+		trail, trailErr := o.GetAuditTrail(state.SagaID)
+		if trailErr != nil {
+			log.Printf("Load test: no audit trail for saga %s: %v", state.SagaID, trailErr)
+		}
+		stats.Record(ResultFromTrail(trail, d, err))
+	})
+	return stats.Report(time.Since(start))
+}
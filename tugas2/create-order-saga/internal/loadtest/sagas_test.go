@@ -0,0 +1,41 @@
+package loadtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/loadtest"
+	"create-order-saga/internal/sagatest"
+)
+
+// TestRunSagas fires generated orders at the end-to-end harness and checks
+// the report counts every saga and times its steps.
+func TestRunSagas(t *testing.T) {
+	for _, tc := range []struct {
+		name                 string
+		opts                 []sagatest.Option
+		succeeded, failed    int
+		wantCompensatedSagas int
+	}{
+		{name: "all succeed", succeeded: 20},
+		{name: "all declined", opts: []sagatest.Option{sagatest.WithPaymentFailure()}, failed: 20, wantCompensatedSagas: 20},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := sagatest.New(t, tc.opts...)
+			cfg := loadtest.Config{Total: 20, Concurrency: 4}
+			r := loadtest.RunSagas(context.Background(), h.Orchestrator, loadtest.NewGenerator(1), cfg, 10*time.Second)
+
+			if r.Sagas != 20 || r.Succeeded != tc.succeeded || r.Failed != tc.failed || r.Compensated != tc.wantCompensatedSagas {
+				t.Errorf("report = %d sagas, %d succeeded, %d failed, %d compensated; want 20, %d, %d, %d (errors: %v)",
+					r.Sagas, r.Succeeded, r.Failed, r.Compensated, tc.succeeded, tc.failed, tc.wantCompensatedSagas, r.Errors)
+			}
+			if r.Saga.Count != 20 || r.Saga.Max <= 0 {
+				t.Errorf("saga latency = %+v, want 20 timed sagas", r.Saga)
+			}
+			if got := r.Steps["CreateOrder"].Count; got != 20 {
+				t.Errorf("CreateOrder timed %d times, want 20", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+)
+
+// Result is the outcome of one saga.
+type Result struct {
+	Duration      time.Duration
+	Err           error
+	Steps         map[string]time.Duration // Duration of each step and compensation, by name
+	Compensations int                      // Compensating actions attempted
+}
+
+// ResultFromTrail fills Steps and Compensations from a saga's audit trail,
+// timing each step from its STARTED (or COMPENSATION_ATTEMPTED) entry to the
+// entry that finished it.
+func ResultFromTrail(trail []orchestrator.AuditEntry, d time.Duration, err error) Result {
+	res := Result{Duration: d, Err: err, Steps: make(map[string]time.Duration)}
+	started := make(map[string]time.Time)
+	for _, e := range trail {
+		switch e.Type {
+		case orchestrator.AuditStepStarted:
+			started[e.Step] = e.Timestamp
+		case orchestrator.AuditCompensationAttempted:
+			started[e.Step] = e.Timestamp
+			res.Compensations++
+		case orchestrator.AuditStepSucceeded, orchestrator.AuditStepFailed,
+			orchestrator.AuditCompensationSucceeded, orchestrator.AuditCompensationFailed:
+			if t, ok := started[e.Step]; ok {
+				res.Steps[e.Step] = e.Timestamp.Sub(t)
+				delete(started, e.Step)
+			}
+		}
+	}
+	return res
+}
+
+// Stats aggregates results. It is safe for concurrent use.
+type Stats struct {
+	mu            sync.Mutex
+	total         []time.Duration
+	steps         map[string][]time.Duration
+	succeeded     int
+	failed        int
+	compensated   int // Failed sagas that attempted at least one compensation
+	compensations int
+	errors        map[string]int
+}
+
+// NewStats creates an empty aggregator.
+func NewStats() *Stats {
+	return &Stats{steps: make(map[string][]time.Duration), errors: make(map[string]int)}
+}
+
+// Record adds one saga result.
+func (s *Stats) Record(res Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total = append(s.total, res.Duration)
+	for step, d := range res.Steps {
+		s.steps[step] = append(s.steps[step], d)
+	}
+	s.compensations += res.Compensations
+	if res.Err == nil {
+		s.succeeded++
+		return
+	}
+	s.failed++
+	s.errors[res.Err.Error()]++
+	if res.Compensations > 0 {
+		s.compensated++
+	}
+}
+
+// Latency summarizes a set of durations.
+type Latency struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50_ns"`
+	P90   time.Duration `json:"p90_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// Report is a snapshot of the aggregated statistics.
+type Report struct {
+	Sagas         int                `json:"sagas"`
+	Succeeded     int                `json:"succeeded"`
+	Failed        int                `json:"failed"`
+	Compensated   int                `json:"compensated"`
+	Compensations int                `json:"compensations"`
+	Elapsed       time.Duration      `json:"elapsed_ns"`
+	Throughput    float64            `json:"throughput_per_sec"`
+	Saga          Latency            `json:"saga_latency"`
+	Steps         map[string]Latency `json:"step_latency"`
+	Errors        map[string]int     `json:"errors,omitempty"`
+}
+
+// Report summarizes everything recorded so far; elapsed is the wall time of the run.
+func (s *Stats) Report(elapsed time.Duration) Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := Report{
+		Sagas:         len(s.total),
+		Succeeded:     s.succeeded,
+		Failed:        s.failed,
+		Compensated:   s.compensated,
+		Compensations: s.compensations,
+		Elapsed:       elapsed,
+		Saga:          summarize(s.total),
+		Steps:         make(map[string]Latency, len(s.steps)),
+		Errors:        make(map[string]int, len(s.errors)),
+	}
+	if elapsed > 0 {
+		r.Throughput = float64(r.Sagas) / elapsed.Seconds()
+	}
+	for step, ds := range s.steps {
+		r.Steps[step] = summarize(ds)
+	}
+	for msg, n := range s.errors {
+		r.Errors[msg] = n
+	}
+	return r
+}
+
+func summarize(ds []time.Duration) Latency {
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	l := Latency{Count: len(sorted)}
+	if len(sorted) == 0 {
+		return l
+	}
+	l.P50 = Percentile(sorted, 50)
+	l.P90 = Percentile(sorted, 90)
+	l.P95 = Percentile(sorted, 95)
+	l.P99 = Percentile(sorted, 99)
+	l.Max = sorted[len(sorted)-1]
+	return l
+}
+
+// Percentile returns the p-th percentile (0-100) of sorted using the
+// nearest-rank method, or 0 for an empty slice.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// WriteTable prints the report as a human-readable summary table.
+func (r Report) WriteTable(w io.Writer) {
+	fmt.Fprintf(w, "Sagas: %d  succeeded: %d  failed: %d  compensated: %d  compensations: %d\n",
+		r.Sagas, r.Succeeded, r.Failed, r.Compensated, r.Compensations)
+	fmt.Fprintf(w, "Elapsed: %v  throughput: %.1f sagas/s\n\n", r.Elapsed.Round(time.Millisecond), r.Throughput)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tCOUNT\tP50\tP90\tP95\tP99\tMAX")
+	row := func(name string, l Latency) {
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%v\t%v\t%v\n", name, l.Count, l.P50, l.P90, l.P95, l.P99, l.Max)
+	}
+	row("(saga)", r.Saga)
+	names := make([]string, 0, len(r.Steps))
+	for name := range r.Steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		row(name, r.Steps[name])
+	}
+	tw.Flush()
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(w, "\nErrors:")
+		msgs := make([]string, 0, len(r.Errors))
+		for msg := range r.Errors {
+			msgs = append(msgs, msg)
+		}
+		sort.Strings(msgs)
+		for _, msg := range msgs {
+			fmt.Fprintf(w, "  %6d  %s\n", r.Errors[msg], msg)
+		}
+	}
+}
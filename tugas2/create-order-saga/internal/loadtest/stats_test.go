@@ -0,0 +1,120 @@
+package loadtest_test
+
+import (
+	"errors"
+	"maps"
+	"math/rand"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/loadtest"
+	"create-order-saga/internal/orchestrator"
+)
+
+// ms returns n milliseconds.
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+// upTo returns 1ms, 2ms, ... n ms.
+func upTo(n int) []time.Duration {
+	ds := make([]time.Duration, n)
+	for i := range ds {
+		ds[i] = ms(i + 1)
+	}
+	return ds
+}
+
+// TestPercentile checks the nearest-rank percentiles of known samples,
+// including the empty, single and two sample cases.
+func TestPercentile(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		sorted        []time.Duration
+		p50, p95, p99 time.Duration
+	}{
+		{"no samples", nil, 0, 0, 0},
+		{"one sample", []time.Duration{ms(7)}, ms(7), ms(7), ms(7)},
+		{"two samples", []time.Duration{ms(1), ms(2)}, ms(1), ms(2), ms(2)},
+		{"ten samples", upTo(10), ms(5), ms(10), ms(10)},
+		{"hundred samples", upTo(100), ms(50), ms(95), ms(99)},
+		{"thousand samples", upTo(1000), ms(500), ms(950), ms(990)},
+		{"equal samples", []time.Duration{ms(3), ms(3), ms(3)}, ms(3), ms(3), ms(3)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, want := range []struct {
+				p float64
+				d time.Duration
+			}{{50, tc.p50}, {95, tc.p95}, {99, tc.p99}} {
+				if got := loadtest.Percentile(tc.sorted, want.p); got != want.d {
+					t.Errorf("p%v = %v, want %v", want.p, got, want.d)
+				}
+			}
+		})
+	}
+	if got := loadtest.Percentile(upTo(10), 0); got != ms(1) {
+		t.Errorf("p0 = %v, want the smallest sample", got)
+	}
+	if got := loadtest.Percentile(upTo(10), 100); got != ms(10) {
+		t.Errorf("p100 = %v, want the largest sample", got)
+	}
+}
+
+// TestStatsReport records 100 sagas in random order, every tenth failing
+// after two compensations, and checks the counts and latency summaries.
+func TestStatsReport(t *testing.T) {
+	stats := loadtest.NewStats()
+	declined := errors.New("payment declined")
+	for _, i := range rand.New(rand.NewSource(1)).Perm(100) {
+		res := loadtest.Result{Duration: ms(i + 1), Steps: map[string]time.Duration{"CreateOrder": ms(i%10 + 1)}}
+		if i%10 == 9 {
+			res.Err, res.Compensations = declined, 2
+		}
+		stats.Record(res)
+	}
+
+	r := stats.Report(2 * time.Second)
+	if r.Sagas != 100 || r.Succeeded != 90 || r.Failed != 10 || r.Compensated != 10 || r.Compensations != 20 {
+		t.Errorf("report = %d sagas, %d succeeded, %d failed, %d compensated, %d compensations; want 100, 90, 10, 10, 20",
+			r.Sagas, r.Succeeded, r.Failed, r.Compensated, r.Compensations)
+	}
+	if r.Throughput != 50 {
+		t.Errorf("throughput = %v, want 50 sagas/s", r.Throughput)
+	}
+	if want := (loadtest.Latency{Count: 100, P50: ms(50), P90: ms(90), P95: ms(95), P99: ms(99), Max: ms(100)}); r.Saga != want {
+		t.Errorf("saga latency = %+v, want %+v", r.Saga, want)
+	}
+	if want := (loadtest.Latency{Count: 100, P50: ms(5), P90: ms(9), P95: ms(10), P99: ms(10), Max: ms(10)}); r.Steps["CreateOrder"] != want {
+		t.Errorf("CreateOrder latency = %+v, want %+v", r.Steps["CreateOrder"], want)
+	}
+	if want := map[string]int{"payment declined": 10}; !maps.Equal(r.Errors, want) {
+		t.Errorf("errors = %v, want %v", r.Errors, want)
+	}
+
+	if empty := loadtest.NewStats().Report(0); empty.Sagas != 0 || empty.Throughput != 0 || empty.Saga != (loadtest.Latency{}) {
+		t.Errorf("empty report = %+v, want all zero", empty)
+	}
+}
+
+// TestResultFromTrail times steps and compensations from an audit trail.
+func TestResultFromTrail(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(n int) time.Time { return start.Add(ms(n)) }
+	trail := []orchestrator.AuditEntry{
+		{Timestamp: at(0), Type: orchestrator.AuditSagaStarted},
+		{Timestamp: at(0), Type: orchestrator.AuditStepStarted, Step: "CreateOrder"},
+		{Timestamp: at(5), Type: orchestrator.AuditStepSucceeded, Step: "CreateOrder"},
+		{Timestamp: at(5), Type: orchestrator.AuditStepStarted, Step: "ProcessPayment"},
+		{Timestamp: at(25), Type: orchestrator.AuditStepFailed, Step: "ProcessPayment"},
+		{Timestamp: at(25), Type: orchestrator.AuditCompensationAttempted, Step: "CancelOrder"},
+		{Timestamp: at(28), Type: orchestrator.AuditCompensationSucceeded, Step: "CancelOrder"},
+		{Timestamp: at(28), Type: orchestrator.AuditSagaFailed, Step: "ProcessPayment"},
+	}
+	declined := errors.New("payment declined")
+
+	res := loadtest.ResultFromTrail(trail, ms(30), declined)
+	if res.Duration != ms(30) || res.Err != declined || res.Compensations != 1 {
+		t.Errorf("result = %+v, want 30ms, the error and one compensation", res)
+	}
+	if want := map[string]time.Duration{"CreateOrder": ms(5), "ProcessPayment": ms(20), "CancelOrder": ms(3)}; !maps.Equal(res.Steps, want) {
+		t.Errorf("steps = %v, want %v", res.Steps, want)
+	}
+}
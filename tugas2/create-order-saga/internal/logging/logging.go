@@ -0,0 +1,183 @@
+// Package logging routes the saga binaries' log output through log/slog, with
+// a minimum level and optional sampling of repetitive info logs.
+//
+// The services log with the standard log package. Once Setup has run, a
+// message starting with "DEBUG: ", "WARNING: ", "ERROR: " or "CRITICAL: " is
+// logged at the matching level with the prefix dropped; any other message is
+// logged at info.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q: want debug, info, warn or error", name)
+}
+
+// Sampling limits the info logs written from one call site: the first First
+// in each Period are written, then every Thereafter-th (none if 0). The next
+// log written from the site reports how many were dropped. The zero value
+// writes everything.
+type Sampling struct {
+	Period     time.Duration
+	First      int
+	Thereafter int
+}
+
+// PerSecond writes at most n info logs a second from each call site (all if n is 0).
+func PerSecond(n int) Sampling {
+	if n <= 0 {
+		return Sampling{}
+	}
+	return Sampling{Period: time.Second, First: n}
+}
+
+// Config configures the log output.
+type Config struct {
+	Level    slog.Level // Least severe level written (slog.LevelInfo by default)
+	Sampling Sampling
+}
+
+// Setup makes a handler writing to stderr the default slog handler and
+// routes the standard log package through it.
+func Setup(cfg Config) {
+	// Capture the caller of log.Printf, which sampling keys on
+	log.SetFlags(log.Flags() | log.Lshortfile)
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, cfg)))
+}
+
+// NewHandler returns a handler writing text logs to w as configured by cfg.
+func NewHandler(w io.Writer, cfg Config) slog.Handler {
+	h := &handler{
+		next:  slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		level: cfg.Level,
+	}
+	if cfg.Sampling.Period > 0 && cfg.Sampling.First > 0 {
+		h.sampler = &sampler{cfg: cfg.Sampling, sites: make(map[uintptr]*site)}
+	}
+	return h
+}
+
+// levelPrefixes maps the prefixes the services mark log.Printf messages
+// with to their level.
+var levelPrefixes = []struct {
+	prefix string
+	level  slog.Level
+}{
+	{"DEBUG: ", slog.LevelDebug},
+	{"WARNING: ", slog.LevelWarn},
+	{"ERROR: ", slog.LevelError},
+	{"CRITICAL: ", slog.LevelError},
+}
+
+// handler filters records by level and samples info records before passing
+// them on.
+type handler struct {
+	next    slog.Handler
+	level   slog.Level
+	sampler *sampler // Shared with the handlers derived by WithAttrs and WithGroup; nil if not sampling
+}
+
+// Enabled implements slog.Handler. Info is always enabled: a record bridged
+// from the log package arrives at info and may turn out to be a warning.
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level || level == slog.LevelInfo
+}
+
+// Handle implements slog.Handler.
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelInfo {
+		for _, p := range levelPrefixes {
+			if msg, ok := strings.CutPrefix(r.Message, p.prefix); ok {
+				leveled := slog.NewRecord(r.Time, p.level, msg, r.PC)
+				r.Attrs(func(a slog.Attr) bool {
+					leveled.AddAttrs(a)
+					return true
+				})
+				r = leveled
+				break
+			}
+		}
+	}
+	if r.Level < h.level {
+		return nil
+	}
+	if r.Level == slog.LevelInfo && h.sampler != nil && r.PC != 0 {
+		write, dropped := h.sampler.sample(r.PC, r.Time)
+		if !write {
+			return nil
+		}
+		if dropped > 0 {
+			r.AddAttrs(slog.Int("sampled_out", dropped))
+		}
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{next: h.next.WithAttrs(attrs), level: h.level, sampler: h.sampler}
+}
+
+// WithGroup implements slog.Handler.
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), level: h.level, sampler: h.sampler}
+}
+
+// sampler counts the info records from each call site per period. Records
+// whose call site is unknown are not sampled.
+type sampler struct {
+	cfg Sampling
+
+	mu    sync.Mutex
+	sites map[uintptr]*site // By call site PC
+}
+
+type site struct {
+	start   time.Time // When the current period began
+	n       int       // Records seen this period
+	dropped int       // Records dropped since the last one written
+}
+
+// sample reports whether to write a record from key at time t and, if so,
+// how many records from key were dropped before it.
+func (s *sampler) sample(key uintptr, t time.Time) (write bool, dropped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.sites[key]
+	if !ok || t.Sub(st.start) >= s.cfg.Period {
+		if !ok {
+			st = &site{}
+			s.sites[key] = st
+		}
+		st.start, st.n = t, 0
+	}
+	st.n++
+	write = st.n <= s.cfg.First || (s.cfg.Thereafter > 0 && (st.n-s.cfg.First)%s.cfg.Thereafter == 0)
+	if !write {
+		st.dropped++
+		return false, 0
+	}
+	dropped, st.dropped = st.dropped, 0
+	return true, dropped
+}
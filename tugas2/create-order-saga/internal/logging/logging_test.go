@@ -0,0 +1,139 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/logging"
+)
+
+// useHandler routes slog and the standard log package to a handler writing
+// to the returned buffer until the test ends.
+func useHandler(t *testing.T, cfg logging.Config) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev, flags := slog.Default(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		log.SetFlags(flags)
+	})
+	slog.SetDefault(slog.New(logging.NewHandler(&buf, cfg)))
+	return &buf
+}
+
+// TestLevel logs at each level through slog and through the log package's
+// prefixes: only records at or above the configured level are written, at
+// their own level with the prefix dropped, so debug logs are suppressed at
+// the default info level.
+func TestLevel(t *testing.T) {
+	for _, tc := range []struct {
+		level slog.Level
+		want  []string // Lines written, as "LEVEL msg"
+	}{
+		{slog.LevelDebug, []string{"DEBUG slog", "DEBUG log", "INFO slog", "INFO log", "WARN slog", "WARN log", "ERROR slog", "ERROR log", "ERROR critical"}},
+		{slog.LevelInfo, []string{"INFO slog", "INFO log", "WARN slog", "WARN log", "ERROR slog", "ERROR log", "ERROR critical"}},
+		{slog.LevelWarn, []string{"WARN slog", "WARN log", "ERROR slog", "ERROR log", "ERROR critical"}},
+		{slog.LevelError, []string{"ERROR slog", "ERROR log", "ERROR critical"}},
+	} {
+		t.Run(tc.level.String(), func(t *testing.T) {
+			buf := useHandler(t, logging.Config{Level: tc.level})
+			slog.Debug("slog")
+			log.Print("DEBUG: log")
+			slog.Info("slog")
+			log.Print("log")
+			slog.Warn("slog")
+			log.Print("WARNING: log")
+			slog.Error("slog")
+			log.Print("ERROR: log")
+			log.Print("CRITICAL: critical")
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				level, msg := field(line, "level"), field(line, "msg")
+				got = append(got, level+" "+msg)
+			}
+			if strings.Join(got, ", ") != strings.Join(tc.want, ", ") {
+				t.Errorf("at %s wrote %q, want %q", tc.level, got, tc.want)
+			}
+		})
+	}
+}
+
+// field returns the value of key in a text handler line.
+func field(line, key string) string {
+	for _, f := range strings.Fields(line) {
+		if v, ok := strings.CutPrefix(f, key+"="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{
+		"debug": slog.LevelDebug, "": slog.LevelInfo, "info": slog.LevelInfo, " INFO ": slog.LevelInfo,
+		"warn": slog.LevelWarn, "warning": slog.LevelWarn, "error": slog.LevelError,
+	} {
+		if got, err := logging.ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded, want an error")
+	}
+}
+
+// TestSampling sends info records from one call site through a handler
+// sampling the first 2 a second, then every 3rd: the rest are dropped, the
+// next record written reports how many, and a new second starts afresh.
+// Warnings and records without a call site are never sampled.
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	h := logging.NewHandler(&buf, logging.Config{Sampling: logging.Sampling{Period: time.Second, First: 2, Thereafter: 3}})
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	send := func(at time.Duration, level slog.Level, pc uintptr, msg string) {
+		if err := h.Handle(context.Background(), slog.NewRecord(start.Add(at), level, msg, pc)); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+	for i := range 7 {
+		send(time.Duration(i)*time.Millisecond, slog.LevelInfo, 1, "step"+strconv.Itoa(i+1))
+	}
+	send(10*time.Millisecond, slog.LevelInfo, 2, "other")
+	send(20*time.Millisecond, slog.LevelWarn, 1, "warning")
+	send(30*time.Millisecond, slog.LevelInfo, 0, "unsited")
+	send(30*time.Millisecond, slog.LevelInfo, 0, "unsited")
+	send(time.Second, slog.LevelInfo, 1, "next")
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		entry := field(line, "msg")
+		if n := field(line, "sampled_out"); n != "" {
+			entry += " sampled_out=" + n
+		}
+		got = append(got, entry)
+	}
+	want := []string{"step1", "step2", "step5 sampled_out=2", "other", "warning", "unsited", "unsited", "next sampled_out=2"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+// TestPerSecond checks PerSecond samples by the second, and not at all for 0.
+func TestPerSecond(t *testing.T) {
+	if got := logging.PerSecond(5); got != (logging.Sampling{Period: time.Second, First: 5}) {
+		t.Errorf("PerSecond(5) = %+v", got)
+	}
+	if got := logging.PerSecond(0); got != (logging.Sampling{}) {
+		t.Errorf("PerSecond(0) = %+v, want no sampling", got)
+	}
+}
@@ -0,0 +1,51 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// UpdateShippingAddress sends an order's shipments to a new address, e.g. to fix
+// a typo right after ordering, and returns them as updated. Cancelled shipments
+// are left alone. Shipments can change until the carrier picks them up, even
+// once SHIPPED. The order is refused with codes.FailedPrecondition before
+// anything changes if the carrier has one of its shipments, and with
+// codes.NotFound if it has no shipment to update.
+func (o *Orchestrator) UpdateShippingAddress(ctx context.Context, orderID string, addr *commonpb.ShippingAddress) ([]*shippingpb.Shipment, error) {
+	resp, err := o.clients.Shipping.ListShipments(ctx, &shippingpb.ListShipmentsRequest{OrderId: &commonpb.OrderID{Id: orderID}})
+	if err != nil {
+		return nil, fmt.Errorf("ListShipments %s: %w", orderID, err)
+	}
+	var active []*shippingpb.Shipment
+	for _, shipment := range resp.GetShipments() {
+		switch shipment.GetStatus() {
+		case shippingpb.ShippingStatus_CANCELLED:
+			continue
+		case shippingpb.ShippingStatus_PENDING, shippingpb.ShippingStatus_RESERVED, shippingpb.ShippingStatus_SHIPPED:
+			active = append(active, shipment)
+		default:
+			return nil, status.Errorf(codes.FailedPrecondition, "shipment %s of order %s is %s, its address can no longer change", shipment.GetId(), orderID, shipment.GetStatus())
+		}
+	}
+	if len(active) == 0 {
+		return nil, status.Errorf(codes.NotFound, "order %s has no shipment to update", orderID)
+	}
+
+	updated := make([]*shippingpb.Shipment, 0, len(active))
+	for _, shipment := range active {
+		res, err := o.clients.Shipping.UpdateShippingAddress(ctx, &shippingpb.UpdateShippingAddressRequest{ShipmentId: shipment.GetId(), Address: addr})
+		if err != nil {
+			return updated, fmt.Errorf("UpdateShippingAddress %s: %w", shipment.GetId(), err)
+		}
+		updated = append(updated, res)
+	}
+	log.Printf("Order %s: %d shipment(s) now ship to %s", orderID, len(updated), addr.GetCity())
+	return updated, nil
+}
@@ -0,0 +1,101 @@
+package orchestrator_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// TestUpdateShippingAddressHTTP changes the address of a completed order
+// shipping from two warehouses through PATCH /orders/{id}/shipping-address,
+// and checks the refusals: a bad body or address, an unknown order or
+// another tenant's, and a shipment already picked up.
+func TestUpdateShippingAddressHTTP(t *testing.T) {
+	newAddr := sagatest.SampleAddress()
+	newAddr.City = "Compensation Town"
+	noCity := sagatest.SampleAddress()
+	noCity.City = ""
+	body := func(addr *commonpb.ShippingAddress) string {
+		data, err := protojson.Marshal(addr)
+		if err != nil {
+			t.Fatalf("marshalling the address: %v", err)
+		}
+		return string(data)
+	}
+	for _, tc := range []struct {
+		name     string
+		body     string
+		orderID  string // The saga's order if empty
+		tenant   string
+		pickedUp bool
+		wantCode int
+	}{
+		{name: "updated", body: body(newAddr), wantCode: http.StatusOK},
+		{name: "malformed body", body: `{"city": 7}`, wantCode: http.StatusBadRequest},
+		{name: "invalid address", body: body(noCity), wantCode: http.StatusBadRequest},
+		{name: "unknown order", body: body(newAddr), orderID: "order-missing", wantCode: http.StatusNotFound},
+		{name: "other tenant", body: body(newAddr), tenant: "globex", wantCode: http.StatusNotFound},
+		{name: "picked up", body: body(newAddr), pickedUp: true, wantCode: http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := sagatest.New(t, sagatest.WithWarehouses(map[string]string{"prod-A": "east", "prod-B": "west"}))
+			saga := completedOrder(t, h)
+			if len(saga.ShipmentIDs) != 2 {
+				t.Fatalf("saga shipments = %v, want one per warehouse", saga.ShipmentIDs)
+			}
+			if tc.pickedUp {
+				shipment, _ := h.Shipping.Lookup(context.Background(), saga.ShipmentIDs[1])
+				if _, _, err := h.Shipping.ApplyCarrierEvent(shipment.GetTrackingNumber(), "in_transit", time.Time{}); err != nil {
+					t.Fatalf("ApplyCarrierEvent: %v", err)
+				}
+			}
+			orderID := tc.orderID
+			if orderID == "" {
+				orderID = saga.OrderID.GetId()
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/orders/"+orderID+"/shipping-address", strings.NewReader(tc.body))
+			if tc.tenant != "" {
+				req.Header.Set(interceptors.TenantHeader, tc.tenant)
+			}
+			w := httptest.NewRecorder()
+			h.Orchestrator.HTTPHandler().ServeHTTP(w, req)
+			if w.Code != tc.wantCode {
+				t.Fatalf("PATCH shipping-address = %d %s, want %d", w.Code, w.Body, tc.wantCode)
+			}
+
+			wantCity := sagatest.SampleAddress().GetCity()
+			if tc.wantCode == http.StatusOK {
+				wantCity = newAddr.GetCity()
+				var resp shippingpb.ListShipmentsResponse
+				if err := protojson.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decoding the response %s: %v", w.Body, err)
+				}
+				if len(resp.GetShipments()) != 2 {
+					t.Errorf("response lists %d shipments, want both", len(resp.GetShipments()))
+				}
+				for _, shipment := range resp.GetShipments() {
+					if shipment.GetAddress().GetCity() != wantCity || len(shipment.GetAddressHistory()) != 1 {
+						t.Errorf("returned shipment %s ships to %q with %d earlier addresses, want %q and 1", shipment.GetId(), shipment.GetAddress().GetCity(), len(shipment.GetAddressHistory()), wantCity)
+					}
+				}
+			}
+			for _, id := range saga.ShipmentIDs { // A refusal changes none of them
+				shipment, _ := h.Shipping.Lookup(context.Background(), id)
+				if got := shipment.GetAddress().GetCity(); got != wantCity {
+					t.Errorf("shipment %s ships to %q, want %q", id, got, wantCity)
+				}
+			}
+		})
+	}
+}
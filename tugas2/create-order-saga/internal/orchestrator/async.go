@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+)
+
+// WithAsyncComplete makes a succeeded saga return as soon as its core steps
+// are done, marking the order as COMPLETED in the background (false by
+// default), for deployments that treat CompleteOrder as advisory. The
+// background completion is audited, logged as an event and retried like a
+// synchronous one; until it has finished, the saga is listed by
+// CompletingSagas. The customer is notified when the saga returns, without
+// waiting for it.
+func WithAsyncComplete(enabled bool) Option {
+	return func(o *Orchestrator) {
+		o.asyncComplete = enabled
+	}
+}
+
+// asyncCompletionStats counts background completions for the metrics endpoint.
+type asyncCompletionStats struct {
+	succeeded atomic.Uint64
+	failed    atomic.Uint64 // Left to the completion retrier or the failed-operation queue
+}
+
+// completeOrderAsync starts marking the order of the succeeded saga in ctx as
+// COMPLETED in the background, tracked in the registry until it has finished.
+func (o *Orchestrator) completeOrderAsync(ctx context.Context, orderID *commonpb.OrderID) {
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	// The saga's context ends when it returns, and so may its caller's
+	// progress callback: keep the values but neither
+	detached, stop := o.detach(context.WithValue(ctx, progressKey{}, &progressReporter{}))
+	r := o.registry
+	r.mu.Lock()
+	r.completing[sagaID] = orderID.Id
+	r.completion.Add(1)
+	r.mu.Unlock()
+	log.Printf("Saga %s returns before Order %s is marked as COMPLETED", sagaID, orderID.Id)
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.completing, sagaID)
+			r.mu.Unlock()
+			r.completion.Done()
+		}()
+		defer stop()
+		if o.completeOrder(detached, detached, orderID) {
+			o.asyncCompletions.succeeded.Add(1)
+		} else {
+			o.asyncCompletions.failed.Add(1)
+		}
+	}()
+}
+
+// CompletingSagas returns the IDs of the sagas that have returned but whose
+// order is still being marked as COMPLETED in the background (see
+// WithAsyncComplete).
+func (o *Orchestrator) CompletingSagas() []string {
+	o.registry.mu.RLock()
+	defer o.registry.mu.RUnlock()
+	ids := make([]string, 0, len(o.registry.completing))
+	for id := range o.registry.completing {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// WaitForCompletions waits until every background completion has finished,
+// or ctx is done. Call it before Close, as the completions still write to the
+// saga stores.
+func (o *Orchestrator) WaitForCompletions(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		o.registry.completion.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
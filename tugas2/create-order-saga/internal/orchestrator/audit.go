@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEventType identifies a saga transition recorded in the audit trail.
+type AuditEventType string
+
+const (
+	AuditSagaStarted           AuditEventType = "SAGA_STARTED"
+	AuditStepStarted           AuditEventType = "STEP_STARTED"
+	AuditStepSucceeded         AuditEventType = "STEP_SUCCEEDED"
+	AuditStepFailed            AuditEventType = "STEP_FAILED"
+	AuditCompensationAttempted AuditEventType = "COMPENSATION_ATTEMPTED"
+	AuditCompensationSucceeded AuditEventType = "COMPENSATION_SUCCEEDED"
+	AuditCompensationFailed    AuditEventType = "COMPENSATION_FAILED"
+	AuditSagaCompleted         AuditEventType = "SAGA_COMPLETED"
+	AuditSagaFailed            AuditEventType = "SAGA_FAILED"
+	AuditNotificationSent      AuditEventType = "NOTIFICATION_SENT"
+	AuditNotificationFailed    AuditEventType = "NOTIFICATION_FAILED"
+)
+
+// AuditEntry is a single record in a saga's audit trail.
+type AuditEntry struct {
+	SagaID    string         `json:"saga_id"`
+	Timestamp time.Time      `json:"timestamp"`
+	Type      AuditEventType `json:"type"`
+	Step      string         `json:"step,omitempty"`   // e.g. "CreateOrder" or "RefundPayment"
+	Detail    string         `json:"detail,omitempty"` // IDs or the error message
+}
+
+// AuditStore persists audit entries in the order they are appended.
+type AuditStore interface {
+	Append(entry AuditEntry) error
+	Trail(sagaID string) ([]AuditEntry, error)
+	Close() error // Flushes and releases the store; it must not be used afterwards
+}
+
+// MemoryAuditStore keeps audit entries in memory. It is the default store.
+type MemoryAuditStore struct {
+	mu      sync.RWMutex
+	entries map[string][]AuditEntry
+}
+
+// NewMemoryAuditStore creates an empty in-memory audit store.
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{entries: make(map[string][]AuditEntry)}
+}
+
+// Append records an entry.
+func (s *MemoryAuditStore) Append(entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.SagaID] = append(s.entries[entry.SagaID], entry)
+	return nil
+}
+
+// Trail returns a copy of the entries recorded for a saga.
+func (s *MemoryAuditStore) Trail(sagaID string) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]AuditEntry(nil), s.entries[sagaID]...), nil
+}
+
+// Close is a no-op; entries stay readable.
+func (s *MemoryAuditStore) Close() error { return nil }
+
+// FileAuditStore appends audit entries as JSON lines to a file, syncing after
+// every write so the trail survives a crash.
+type FileAuditStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileAuditStore opens (or creates) a JSONL audit file for appending.
+func NewFileAuditStore(path string) (*FileAuditStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open audit file: %w", err)
+	}
+	return &FileAuditStore{path: path, file: f}, nil
+}
+
+// Append writes an entry as one JSON line and fsyncs the file.
+func (s *FileAuditStore) Append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Trail replays the file and returns the entries recorded for a saga, in order.
+func (s *FileAuditStore) Trail(sagaID string) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var trail []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("corrupt audit line: %w", err)
+		}
+		if entry.SagaID == sagaID {
+			trail = append(trail, entry)
+		}
+	}
+	return trail, scanner.Err()
+}
+
+// Close fsyncs and closes the underlying file.
+func (s *FileAuditStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	syncErr := s.file.Sync()
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return syncErr
+}
@@ -0,0 +1,238 @@
+package orchestrator_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// transitions renders a trail as "TYPE Step" lines.
+func transitions(trail []orchestrator.AuditEntry) []string {
+	out := make([]string, len(trail))
+	for i, e := range trail {
+		out[i] = strings.TrimSpace(string(e.Type) + " " + e.Step)
+	}
+	return out
+}
+
+// TestAuditTrailOrder runs sagas that succeed or fail at different steps,
+// compensating one at a time, and checks their trails list every step and
+// compensation in the order they ran.
+func TestAuditTrailOrder(t *testing.T) {
+	forward := []string{
+		"SAGA_STARTED",
+		"STEP_STARTED QuoteShipping", "STEP_SUCCEEDED QuoteShipping",
+		"STEP_STARTED CreateOrder", "STEP_SUCCEEDED CreateOrder",
+		"STEP_STARTED ReserveShipping", "STEP_SUCCEEDED ReserveShipping",
+		"STEP_STARTED ProcessPayment",
+	}
+	for _, tc := range []struct {
+		name string
+		fail func(*fakeStack)
+		want []string // After forward
+	}{
+		{
+			name: "completed",
+			want: []string{
+				"STEP_SUCCEEDED ProcessPayment",
+				"STEP_STARTED ConfirmShipping", "STEP_SUCCEEDED ConfirmShipping",
+				"STEP_STARTED CompleteOrder", "STEP_SUCCEEDED CompleteOrder",
+				"SAGA_COMPLETED",
+			},
+		},
+		{
+			name: "payment declined",
+			fail: func(f *fakeStack) {
+				f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+					Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED, Message: "card declined"},
+				})
+			},
+			want: []string{
+				"STEP_FAILED ProcessPayment",
+				"COMPENSATION_ATTEMPTED CancelShipping", "COMPENSATION_SUCCEEDED CancelShipping",
+				"COMPENSATION_ATTEMPTED CancelOrder", "COMPENSATION_SUCCEEDED CancelOrder",
+				"SAGA_FAILED ProcessPayment",
+			},
+		},
+		{
+			name: "ConfirmShipping failed",
+			fail: func(f *fakeStack) {
+				f.shipping.ConfirmShippingFunc = fakes.Script[*shippingpb.ConfirmShippingRequest](fakes.Result[*shippingpb.ArrangeShippingResponse]{
+					Err: status.Error(codes.FailedPrecondition, "reservation expired"),
+				})
+			},
+			want: []string{
+				"STEP_SUCCEEDED ProcessPayment",
+				"STEP_STARTED ConfirmShipping", "STEP_FAILED ConfirmShipping",
+				"COMPENSATION_ATTEMPTED CancelShipping", "COMPENSATION_SUCCEEDED CancelShipping",
+				"COMPENSATION_ATTEMPTED RefundPayment", "COMPENSATION_SUCCEEDED RefundPayment",
+				"COMPENSATION_ATTEMPTED CancelOrder", "COMPENSATION_SUCCEEDED CancelOrder",
+				"SAGA_FAILED ConfirmShipping",
+			},
+		},
+		{
+			name: "compensation failed",
+			fail: func(f *fakeStack) {
+				f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+					Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED, Message: "card declined"},
+				})
+				f.shipping.CancelShippingFunc = fakes.Script[*shippingpb.CancelShippingRequest](fakes.Result[*commonpb.CompensationResponse]{
+					Err: status.Error(codes.Internal, "carrier unreachable"),
+				})
+			},
+			want: []string{
+				"STEP_FAILED ProcessPayment",
+				"COMPENSATION_ATTEMPTED CancelShipping", "COMPENSATION_FAILED CancelShipping",
+				"COMPENSATION_ATTEMPTED CancelOrder", "COMPENSATION_SUCCEEDED CancelOrder",
+				"SAGA_FAILED ProcessPayment",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeStack(t, orchestrator.WithCompensationConcurrency(1))
+			if tc.fail != nil {
+				tc.fail(f)
+			}
+			f.run("saga-1")
+
+			trail, err := f.orch.GetAuditTrail("saga-1")
+			if err != nil {
+				t.Fatalf("GetAuditTrail: %v", err)
+			}
+			if got, want := transitions(trail), append(slices.Clone(forward), tc.want...); !slices.Equal(got, want) {
+				t.Errorf("trail =\n  %s\nwant\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+			}
+			for i, e := range trail {
+				if e.SagaID != "saga-1" || e.Timestamp.IsZero() || (i > 0 && e.Timestamp.Before(trail[i-1].Timestamp)) {
+					t.Errorf("entry %d = %+v, want it stamped for saga-1 no earlier than the one before", i, e)
+				}
+			}
+		})
+	}
+}
+
+// TestFileAuditStoreRoundTrip appends the entries of two sagas, reopens the
+// file and reads each saga's trail back unchanged and in order.
+func TestFileAuditStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	store, err := orchestrator.NewFileAuditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var want []orchestrator.AuditEntry
+	for i, typ := range []orchestrator.AuditEventType{orchestrator.AuditSagaStarted, orchestrator.AuditStepStarted, orchestrator.AuditStepFailed, orchestrator.AuditSagaFailed} {
+		for _, sagaID := range []string{"saga-1", "saga-2"} {
+			e := orchestrator.AuditEntry{SagaID: sagaID, Timestamp: start.Add(time.Duration(i) * time.Millisecond), Type: typ, Step: "CreateOrder", Detail: "order_id=order-1 \"quoted\"\n"}
+			if err := store.Append(e); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			if sagaID == "saga-1" {
+				want = append(want, e)
+			}
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := orchestrator.NewFileAuditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	got, err := reopened.Trail("saga-1")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Trail after reopening = %+v, %v; want %+v", got, err, want)
+	}
+	if got, err := reopened.Trail("saga-3"); err != nil || len(got) != 0 {
+		t.Errorf("Trail of an unknown saga = %v, %v; want none", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Trail("saga-1"); err == nil {
+		t.Error("Trail of a corrupt file succeeded, want an error")
+	}
+}
+
+// TestFileAuditStoreSaga records a saga in a JSONL file and checks an
+// orchestrator opened on the file later serves the same trail.
+func TestFileAuditStoreSaga(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	store, err := orchestrator.NewFileAuditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFakeStack(t, orchestrator.WithAuditStore(store))
+	if _, err := f.run("saga-1"); err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	want, _ := f.orch.GetAuditTrail("saga-1")
+	f.orch.Close()
+
+	reopened, err := orchestrator.NewFileAuditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := newFakeStack(t, orchestrator.WithAuditStore(reopened))
+	got, err := later.orch.GetAuditTrail("saga-1")
+	if err != nil || len(got) == 0 || !reflect.DeepEqual(transitions(got), transitions(want)) {
+		t.Errorf("trail after restart = %v, %v; want %v", transitions(got), err, transitions(want))
+	}
+}
+
+// TestAuditRefundOutcome fails ConfirmShipping so the payment is refunded and
+// checks the trail records whether the refund moved money: a refunded charge
+// and a payment with nothing to refund both compensate successfully, but only
+// the first is audited as refunded.
+func TestAuditRefundOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		resp *commonpb.CompensationResponse
+		want string
+	}{
+		{"refunded", &commonpb.CompensationResponse{Success: true, Code: commonpb.CompensationCode_COMPLETED, Refunded: true}, "refunded=true"},
+		{"nothing to refund", &commonpb.CompensationResponse{Success: true, Code: commonpb.CompensationCode_ALREADY_DONE, Message: "payment failed; nothing to refund"}, "refunded=false"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeStack(t)
+			f.shipping.ConfirmShippingFunc = fakes.Script[*shippingpb.ConfirmShippingRequest](fakes.Result[*shippingpb.ArrangeShippingResponse]{
+				Err: status.Error(codes.FailedPrecondition, "reservation expired"),
+			})
+			f.payment.RefundPaymentFunc = fakes.Script[*paymentpb.RefundPaymentRequest](fakes.Result[*commonpb.CompensationResponse]{Resp: tc.resp})
+			if _, err := f.run("saga-1"); !errors.Is(err, orchestrator.ErrShippingFailed) || errors.Is(err, orchestrator.ErrCompensationFailed) {
+				t.Fatalf("saga error = %v, want ErrShippingFailed with compensation succeeding", err)
+			}
+
+			trail, err := f.orch.GetAuditTrail("saga-1")
+			if err != nil {
+				t.Fatalf("GetAuditTrail: %v", err)
+			}
+			var got []string
+			for _, e := range trail {
+				if e.Type == orchestrator.AuditCompensationSucceeded && e.Step == "RefundPayment" {
+					got = append(got, e.Detail)
+				}
+			}
+			if len(got) != 1 || got[0] != tc.want {
+				t.Errorf("RefundPayment audited as %q, want one entry %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	commonpb "create-order-saga/proto/common"
+)
+
+// Defaults for ExecuteCreateOrderBatch when BatchOptions leaves a field zero.
+const (
+	DefaultBatchConcurrency = 4
+	DefaultBatchTimeout     = time.Minute
+)
+
+// Outcomes of a batch entry.
+const (
+	BatchOutcomeSucceeded = "SUCCEEDED" // The saga completed
+	BatchOutcomeFailed    = "FAILED"    // The saga ran and failed; its completed steps were compensated
+	BatchOutcomeInvalid   = "INVALID"   // The entry was rejected before any saga ran
+	BatchOutcomeSkipped   = "SKIPPED"   // The batch ran out of time before the entry was started
+)
+
+// BatchOrder is one order of a batch: the input of one Create Order saga.
+type BatchOrder struct {
+	Details         *commonpb.OrderDetails
+	PaymentInfo     *commonpb.PaymentInfo
+	ShippingAddress *commonpb.ShippingAddress
+}
+
+// BatchOptions configures ExecuteCreateOrderBatch.
+type BatchOptions struct {
+	Concurrency int           // Sagas run at the same time (DefaultBatchConcurrency if zero)
+	Timeout     time.Duration // Deadline for the whole batch (DefaultBatchTimeout if zero)
+}
+
+// BatchResult is the outcome of one batch entry.
+type BatchResult struct {
+	Index       int      `json:"index"` // Position of the entry in the batch
+	SagaID      string   `json:"saga_id,omitempty"`
+	Outcome     string   `json:"outcome"` // One of the BatchOutcome* constants
+	OrderID     string   `json:"order_id,omitempty"`
+	PaymentID   string   `json:"payment_id,omitempty"`
+	ShipmentIDs []string `json:"shipment_ids,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Err         error    `json:"-"` // The error behind Error, for errors.Is and errors.As
+}
+
+// ExecuteCreateOrderBatch runs a Create Order saga per entry, at most
+// opts.Concurrency at a time, and returns one result per entry in batch order.
+// Entries are independent: one failing never affects the others. Entries that
+// fail the orchestrator's local checks (see ValidateCreateOrder) are rejected
+// as INVALID without running a saga. The whole batch shares one deadline;
+// sagas still running when it passes are compensated, and entries not started
+// by then are SKIPPED.
+func (o *Orchestrator) ExecuteCreateOrderBatch(ctx context.Context, orders []BatchOrder, opts BatchOptions) []BatchResult {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultBatchConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultBatchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	log.Printf("Starting batch of %d order(s), %d at a time", len(orders), opts.Concurrency)
+
+	results := make([]BatchResult, len(orders))
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, order := range orders {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i] = BatchResult{Index: i, Outcome: BatchOutcomeSkipped, Error: ctx.Err().Error(), Err: ctx.Err()}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = o.runBatchEntry(ctx, i, order)
+		}()
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Outcome]++
+	}
+	log.Printf("Batch of %d order(s) finished: %d succeeded, %d failed, %d invalid, %d skipped", len(orders),
+		counts[BatchOutcomeSucceeded], counts[BatchOutcomeFailed], counts[BatchOutcomeInvalid], counts[BatchOutcomeSkipped])
+	return results
+}
+
+// runBatchEntry checks one entry locally, then runs its saga.
+func (o *Orchestrator) runBatchEntry(ctx context.Context, index int, order BatchOrder) BatchResult {
+	res := BatchResult{Index: index}
+	report := &ValidationReport{}
+	validateLocally(report, order.Details, order.PaymentInfo, order.ShippingAddress)
+	if !report.Valid() {
+		p := report.Problems[0]
+		res.Outcome = BatchOutcomeInvalid
+		res.Err = fmt.Errorf("%s: %s", p.Field, p.Description)
+		res.Error = res.Err.Error()
+		log.Printf("Batch entry %d rejected: %v", index, res.Err)
+		return res
+	}
+
+	state, err := o.RunCreateOrderSaga(ctx, order.Details, order.PaymentInfo, order.ShippingAddress)
+	if state != nil { // A duplicate still waiting for its original when ctx ends has no state
+		res.SagaID = state.SagaID
+		res.OrderID = state.OrderID.GetId()
+		res.PaymentID = state.PaymentID
+		res.ShipmentIDs = state.ShipmentIDs
+	}
+	res.Outcome = BatchOutcomeSucceeded
+	if err != nil {
+		res.Outcome = BatchOutcomeFailed
+		res.Err = err
+		res.Error = err.Error()
+	}
+	return res
+}
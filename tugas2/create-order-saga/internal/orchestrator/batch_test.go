@@ -0,0 +1,206 @@
+package orchestrator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"create-order-saga/internal/orchestrator"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// declinedCard is a Luhn-valid card number decliningGateway refuses.
+const declinedCard = "4000-0000-0000-0002"
+
+// decliningGateway approves every charge except those on declinedCard.
+var decliningGateway = paymentservice.GatewayFunc(func(_ context.Context, orderID string, info *commonpb.PaymentInfo) (string, error) {
+	if info.GetCardNumber() == declinedCard {
+		return "", paymentservice.ErrDeclined
+	}
+	return "txn-" + orderID, nil
+})
+
+// batchOrder returns a valid batch entry for userID.
+func batchOrder(userID string) orchestrator.BatchOrder {
+	return orchestrator.BatchOrder{
+		Details:         sagatest.SampleOrder(userID),
+		PaymentInfo:     sagatest.SamplePayment(),
+		ShippingAddress: sagatest.SampleAddress(),
+	}
+}
+
+// TestBatchIndependentOutcomes runs a batch holding an entry with no city in
+// its address and one whose card is declined between two valid ones, and
+// checks each entry gets its own outcome: the invalid one runs no saga, the
+// declined one is compensated, and the valid ones complete regardless.
+func TestBatchIndependentOutcomes(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithPaymentGateway(decliningGateway))
+	orders := []orchestrator.BatchOrder{batchOrder("user-1"), batchOrder("user-2"), batchOrder("user-3"), batchOrder("user-4")}
+	orders[1].ShippingAddress.City = ""
+	orders[2].PaymentInfo.CardNumber = declinedCard
+
+	results := h.Orchestrator.ExecuteCreateOrderBatch(context.Background(), orders, orchestrator.BatchOptions{})
+	if len(results) != len(orders) {
+		t.Fatalf("%d results for %d orders", len(results), len(orders))
+	}
+	for i, want := range []string{
+		orchestrator.BatchOutcomeSucceeded,
+		orchestrator.BatchOutcomeInvalid,
+		orchestrator.BatchOutcomeFailed,
+		orchestrator.BatchOutcomeSucceeded,
+	} {
+		if r := results[i]; r.Index != i || r.Outcome != want {
+			t.Errorf("result %d = index %d, %s (%v); want %s", i, r.Index, r.Outcome, r.Err, want)
+		}
+	}
+
+	for _, i := range []int{0, 3} {
+		r := results[i]
+		if status, _ := h.OrderStatus(r.OrderID); status != orderpb.OrderStatus_COMPLETED || r.Err != nil || r.SagaID == "" {
+			t.Errorf("entry %d: order %q is %v (%v), want COMPLETED", i, r.OrderID, status, r.Err)
+		}
+		if status, _ := h.PaymentStatus(r.PaymentID); status != paymentpb.PaymentStatus_SUCCESS {
+			t.Errorf("entry %d: payment %q is %v, want %v", i, r.PaymentID, status, paymentpb.PaymentStatus_SUCCESS)
+		}
+	}
+
+	invalid := results[1]
+	if invalid.SagaID != "" || invalid.OrderID != "" || !strings.Contains(invalid.Error, "address.city") {
+		t.Errorf("invalid entry = %+v, want no saga and the missing city reported", invalid)
+	}
+	if orders, _ := h.Order.ListOrders(context.Background(), &orderpb.ListOrdersRequest{}); len(orders.GetOrders()) != 3 {
+		t.Errorf("%d orders created, want one per entry except the invalid one", len(orders.GetOrders()))
+	}
+
+	declined := results[2]
+	if !errors.Is(declined.Err, orchestrator.ErrPaymentFailed) || declined.Error == "" {
+		t.Errorf("declined entry error = %v, want ErrPaymentFailed", declined.Err)
+	}
+	if status, _ := h.OrderStatus(declined.OrderID); status != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("declined entry's order is %v, want CANCELLED", status)
+	}
+	for _, id := range declined.ShipmentIDs {
+		if status, _ := h.ShipmentStatus(id); status != shippingpb.ShippingStatus_CANCELLED {
+			t.Errorf("declined entry's shipment %s is %v, want CANCELLED", id, status)
+		}
+	}
+}
+
+// TestBatchConcurrencyLimit counts the charges in flight while a batch of
+// slow payments runs and checks they never exceed the batch's concurrency,
+// but do reach it.
+func TestBatchConcurrencyLimit(t *testing.T) {
+	var (
+		mu             sync.Mutex
+		inFlight, most int
+	)
+	h := sagatest.New(t, sagatest.WithPaymentGateway(paymentservice.GatewayFunc(
+		func(_ context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+			mu.Lock()
+			inFlight++
+			most = max(most, inFlight)
+			mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return "txn-" + orderID, nil
+		})))
+
+	var orders []orchestrator.BatchOrder
+	for i := range 8 {
+		orders = append(orders, batchOrder(fmt.Sprintf("user-%d", i)))
+	}
+	results := h.Orchestrator.ExecuteCreateOrderBatch(context.Background(), orders, orchestrator.BatchOptions{Concurrency: 3})
+	for _, r := range results {
+		if r.Outcome != orchestrator.BatchOutcomeSucceeded {
+			t.Errorf("entry %d = %s (%v), want SUCCEEDED", r.Index, r.Outcome, r.Err)
+		}
+	}
+	if most != 3 {
+		t.Errorf("at most %d charges in flight, want the concurrency of 3", most)
+	}
+}
+
+// TestBatchDeadline runs a batch one entry at a time against a gateway that
+// never answers: the first saga is compensated when the batch's deadline
+// passes and the entries never started are skipped.
+func TestBatchDeadline(t *testing.T) {
+	gateway, _ := stuckGateway()
+	h := sagatest.New(t, sagatest.WithPaymentGateway(gateway))
+	orders := []orchestrator.BatchOrder{batchOrder("user-1"), batchOrder("user-2"), batchOrder("user-3")}
+
+	results := h.Orchestrator.ExecuteCreateOrderBatch(context.Background(), orders, orchestrator.BatchOptions{Concurrency: 1, Timeout: 200 * time.Millisecond})
+	var stepErr *orchestrator.StepError
+	if r := results[0]; r.Outcome != orchestrator.BatchOutcomeFailed || !errors.As(r.Err, &stepErr) || stepErr.Status.Code() != codes.DeadlineExceeded {
+		t.Errorf("first entry = %s (%v), want FAILED at the deadline", r.Outcome, r.Err)
+	} else if status, _ := h.OrderStatus(r.OrderID); status != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("first entry's order is %v, want CANCELLED", status)
+	}
+	for _, r := range results[1:] {
+		if r.Outcome != orchestrator.BatchOutcomeSkipped || r.SagaID != "" {
+			t.Errorf("entry %d = %s, saga %q; want SKIPPED without a saga", r.Index, r.Outcome, r.SagaID)
+		}
+	}
+}
+
+func TestBatchHTTP(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithPaymentGateway(decliningGateway))
+	srv := httptest.NewServer(h.Orchestrator.HTTPHandler())
+	defer srv.Close()
+
+	entry := func(order orchestrator.BatchOrder) string {
+		details, _ := protojson.Marshal(order.Details)
+		payment, _ := protojson.Marshal(order.PaymentInfo)
+		address, _ := protojson.Marshal(order.ShippingAddress)
+		return `{"details":` + string(details) + `,"payment_info":` + string(payment) + `,"shipping_address":` + string(address) + `}`
+	}
+	declined := batchOrder("user-2")
+	declined.PaymentInfo.CardNumber = declinedCard
+	body := "[" + entry(batchOrder("user-1")) + `,{"details":{}},` + entry(declined) + "]"
+
+	resp, err := http.Post(srv.URL+"/orders:batch?concurrency=2", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Results []orchestrator.BatchResult `json:"results"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&got) != nil {
+		t.Fatalf("POST /orders:batch = %s, want a JSON result per entry", resp.Status)
+	}
+	var outcomes []string
+	for _, r := range got.Results {
+		outcomes = append(outcomes, fmt.Sprintf("%d:%s", r.Index, r.Outcome))
+	}
+	if want := "0:SUCCEEDED 1:INVALID 2:FAILED"; strings.Join(outcomes, " ") != want {
+		t.Errorf("outcomes = %v, want %s", outcomes, want)
+	}
+
+	for _, query := range []string{"?concurrency=0", "?timeout=soon"} {
+		resp, err := http.Post(srv.URL+"/orders:batch"+query, "application/json", strings.NewReader("[]"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST /orders:batch%s = %s, want 400", query, resp.Status)
+		}
+	}
+}
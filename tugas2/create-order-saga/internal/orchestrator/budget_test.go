@@ -0,0 +1,117 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/grpc_clients"
+	orderpb "create-order-saga/proto/order"
+)
+
+// flakyCalls is a client interceptor failing the first calls to each method
+// with Unavailable, as many as failures[method], and counting every attempt.
+type flakyCalls struct {
+	failures map[string]int
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (f *flakyCalls) intercept(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	f.mu.Lock()
+	f.attempts[method]++
+	fail := f.attempts[method] <= f.failures[method]
+	f.mu.Unlock()
+	if fail {
+		return status.Error(codes.Unavailable, "flaky")
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// TestRetryBudgetShared fails CreateOrder twice and ConfirmShipping twice,
+// with up to 4 attempts per call. Without a budget both recover; with a
+// saga-wide budget of 3 retries, CreateOrder spends 2, leaving ConfirmShipping
+// a single retry, so it gives up and the saga compensates.
+func TestRetryBudgetShared(t *testing.T) {
+	const createOrder, confirmShipping = "/order.OrderService/CreateOrder", "/shipping.ShippingService/ConfirmShipping"
+	fast := grpc_clients.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, Multiplier: 1, Timeout: time.Second}
+	retries := grpc_clients.ServiceRetryConfig{Forward: fast, Compensation: fast}
+	for _, tc := range []struct {
+		name        string
+		budget      *grpc_clients.RetryBudgetConfig
+		wantConfirm int // Attempts at ConfirmShipping
+		wantErr     error
+	}{
+		{"no budget", nil, 3, nil},
+		{"shared budget", &grpc_clients.RetryBudgetConfig{MaxRetries: 3}, 2, orchestrator.ErrShippingFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flaky := &flakyCalls{failures: map[string]int{createOrder: 2, confirmShipping: 2}, attempts: make(map[string]int)}
+			var orchOpts []orchestrator.Option
+			if tc.budget != nil {
+				orchOpts = append(orchOpts, orchestrator.WithRetryBudget(*tc.budget))
+			}
+			h := sagatest.New(t,
+				sagatest.WithClientOptions(
+					grpc_clients.WithServiceRetryConfig(grpc_clients.OrderService, retries),
+					grpc_clients.WithServiceRetryConfig(grpc_clients.ShippingService, retries),
+					grpc_clients.WithDialOptions(grpc.WithChainUnaryInterceptor(flaky.intercept)),
+				),
+				sagatest.WithOrchestratorOptions(orchOpts...),
+			)
+
+			state, err := h.Run(context.Background(), "user-1")
+			if tc.wantErr == nil && err != nil || tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("saga error = %v, want %v", err, tc.wantErr)
+			}
+			if got := flaky.attempts[createOrder]; got != 3 {
+				t.Errorf("CreateOrder attempts = %d, want 3", got)
+			}
+			if got := flaky.attempts[confirmShipping]; got != tc.wantConfirm {
+				t.Errorf("ConfirmShipping attempts = %d, want %d", got, tc.wantConfirm)
+			}
+			want := orderpb.OrderStatus_COMPLETED
+			if tc.wantErr != nil {
+				want = orderpb.OrderStatus_CANCELLED
+			}
+			if got, _ := h.OrderStatus(state.OrderID.GetId()); got != want {
+				t.Errorf("order is %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// TestRetryBudgetIgnoredByCompensation exhausts the budget on CreateOrder,
+// then fails the saga: the compensation still gets its own retries.
+func TestRetryBudgetIgnoredByCompensation(t *testing.T) {
+	const createOrder, cancelOrder = "/order.OrderService/CreateOrder", "/order.OrderService/CancelOrder"
+	fast := grpc_clients.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, Multiplier: 1, Timeout: time.Second}
+	flaky := &flakyCalls{failures: map[string]int{createOrder: 1, cancelOrder: 2}, attempts: make(map[string]int)}
+	h := sagatest.New(t,
+		sagatest.WithPaymentFailure(),
+		sagatest.WithClientOptions(
+			grpc_clients.WithServiceRetryConfig(grpc_clients.OrderService, grpc_clients.ServiceRetryConfig{Forward: fast, Compensation: fast}),
+			grpc_clients.WithDialOptions(grpc.WithChainUnaryInterceptor(flaky.intercept)),
+		),
+		sagatest.WithOrchestratorOptions(orchestrator.WithRetryBudget(grpc_clients.RetryBudgetConfig{MaxRetries: 1})),
+	)
+
+	state, err := h.Run(context.Background(), "user-1")
+	if !errors.Is(err, orchestrator.ErrPaymentFailed) || errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Fatalf("saga error = %v, want ErrPaymentFailed with compensation succeeding", err)
+	}
+	if got := flaky.attempts[cancelOrder]; got != 3 {
+		t.Errorf("CancelOrder attempts = %d, want 3 despite the spent budget", got)
+	}
+	if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("order is %s, want CANCELLED", got)
+	}
+}
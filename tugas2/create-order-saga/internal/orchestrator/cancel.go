@@ -0,0 +1,196 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// DefaultCancellationWindow is how long after a shipment was arranged its
+// order can still be cancelled by the customer.
+const DefaultCancellationWindow = time.Hour
+
+// CancelReasonCustomerRequest is the reason given to the services when a
+// customer cancels a completed order through ExecuteCancelOrderSaga.
+const CancelReasonCustomerRequest = "customer_cancelled"
+
+// ErrOrderNotCancellable is matched by errors from ExecuteCancelOrderSaga when
+// the order can no longer be cancelled (still being processed, picked up by
+// the carrier, or shipped longer ago than the cancellation window). Nothing
+// was changed.
+var ErrOrderNotCancellable = errors.New("order cannot be cancelled")
+
+// WithCancellationWindow sets how long after a shipment was arranged its order
+// can still be cancelled (DefaultCancellationWindow by default). A window of
+// zero or less never blocks a cancellation.
+func WithCancellationWindow(d time.Duration) Option {
+	return func(o *Orchestrator) {
+		o.cancellationWindow = d
+	}
+}
+
+// CancelOrderSagaState tracks a cancel-order saga: what it has undone so far.
+type CancelOrderSagaState struct {
+	SagaID               string
+	OrderID              string
+	CancelledShipmentIDs []string // Shipments cancelled by this saga, in order
+	RefundedPaymentIDs   []string // Payments refunded by this saga, in order
+	OrderCancelled       bool     // The order is CANCELLED, by this saga or before it
+	AlreadyCancelled     bool     // The order was cancelled before this saga; nothing was done
+}
+
+// String renders the state compactly for log lines, e.g.
+// "saga=saga-1 order=order-u1 shipments=ship-1 payments=pay-1 order_cancelled=true".
+func (s *CancelOrderSagaState) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("saga=%s order=%s shipments=%s payments=%s order_cancelled=%t",
+		orDash(s.SagaID), orDash(s.OrderID),
+		orDash(strings.Join(s.CancelledShipmentIDs, ",")), orDash(strings.Join(s.RefundedPaymentIDs, ",")),
+		s.OrderCancelled)
+}
+
+// CancellationError reports a cancel-order saga that stopped part-way: the
+// steps recorded in its state were applied and are not undone, and the failed
+// one is on the failed-operation queue for follow-up.
+type CancellationError struct {
+	Step   string // RPC that failed, e.g. "RefundPayment"
+	Target string // ID it failed on
+	Err    error
+}
+
+func (e *CancellationError) Error() string {
+	return "order cancellation stopped at " + e.Err.Error() // Err names the step and target
+}
+
+func (e *CancellationError) Unwrap() error {
+	return e.Err
+}
+
+// ExecuteCancelOrderSaga cancels a completed order at the customer's request,
+// undoing the create-order saga in reverse: it cancels the order's shipments,
+// refunds its payments and finally cancels the order, stopping at the first
+// step that fails (reported as a *CancellationError). It refuses orders still
+// being processed, orders with a shipment the carrier has picked up, and
+// orders with a shipment arranged longer ago than the cancellation window
+// (ErrOrderNotCancellable) before changing anything. An
+// order that is already cancelled is reported as such without any change.
+//
+// The state is never nil. Once the first change is made the saga runs to the
+// end even if ctx is cancelled, so the order is not left half-cancelled.
+func (o *Orchestrator) ExecuteCancelOrderSaga(ctx context.Context, orderID string) (*CancelOrderSagaState, error) {
+	sagaID, ok := interceptors.SagaIDFromContext(ctx)
+	if !ok {
+		sagaID = o.ids.NewID("saga", "")
+		ctx = interceptors.WithSagaID(ctx, sagaID)
+	}
+	state := &CancelOrderSagaState{SagaID: sagaID, OrderID: orderID}
+	log.Printf("Starting Cancel Order Saga %s for order %s...", sagaID, orderID)
+	o.record(ctx, AuditSagaStarted, "", o.withVersions("cancel order_id="+orderID))
+
+	shipments, payments, err := o.cancellationTargets(ctx, state)
+	if err != nil || state.AlreadyCancelled {
+		if err != nil {
+			log.Printf("Cancel Order Saga %s refused for order %s: %v", sagaID, orderID, err)
+			o.record(ctx, AuditSagaFailed, "", err.Error())
+		} else {
+			log.Printf("Cancel Order Saga %s: order %s was already cancelled", sagaID, orderID)
+			o.record(ctx, AuditSagaCompleted, "", "already cancelled")
+		}
+		return state, err
+	}
+
+	// From here on every step is applied even if the caller goes away
+	ctx, stop := o.detach(ctx)
+	defer stop()
+	id := &commonpb.OrderID{Id: orderID}
+	reason := CancelReasonCustomerRequest
+	for _, shipmentID := range shipments {
+		if err := o.compensateArrangeShipping(ctx, id, shipmentID, reason); err != nil {
+			return state, o.cancellationFailed(ctx, state, "CancelShipping", shipmentID, err)
+		}
+		state.CancelledShipmentIDs = append(state.CancelledShipmentIDs, shipmentID)
+	}
+	for _, paymentID := range payments {
+		if err := o.compensateProcessPayment(ctx, id, paymentID, reason); err != nil {
+			return state, o.cancellationFailed(ctx, state, "RefundPayment", paymentID, err)
+		}
+		state.RefundedPaymentIDs = append(state.RefundedPaymentIDs, paymentID)
+	}
+	if err := o.compensateCreateOrder(ctx, id, reason); err != nil {
+		return state, o.cancellationFailed(ctx, state, "CancelOrder", orderID, err)
+	}
+	state.OrderCancelled = true
+
+	log.Printf("Cancel Order Saga %s completed: %s", sagaID, state)
+	o.record(ctx, AuditSagaCompleted, "", state.String())
+	return state, nil
+}
+
+// cancellationTargets checks that the order can be cancelled and returns the
+// shipments to cancel and the payments to refund. Shipments already cancelled
+// or returned to the sender, and payments that were never charged (or already
+// refunded), are left out.
+func (o *Orchestrator) cancellationTargets(ctx context.Context, state *CancelOrderSagaState) (shipments, payments []string, err error) {
+	id := &commonpb.OrderID{Id: state.OrderID}
+	order, err := o.clients.Order.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: id})
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetOrder %s: %w", state.OrderID, err)
+	}
+	switch order.GetStatus() {
+	case orderpb.OrderStatus_CANCELLED:
+		state.OrderCancelled, state.AlreadyCancelled = true, true
+		return nil, nil, nil
+	case orderpb.OrderStatus_COMPLETED:
+	default:
+		return nil, nil, fmt.Errorf("%w: order %s is %s, not COMPLETED", ErrOrderNotCancellable, state.OrderID, order.GetStatus())
+	}
+
+	shipResp, err := o.clients.Shipping.ListShipments(ctx, &shippingpb.ListShipmentsRequest{OrderId: id})
+	if err != nil {
+		return nil, nil, fmt.Errorf("ListShipments %s: %w", state.OrderID, err)
+	}
+	now := o.clock.Now()
+	for _, shipment := range shipResp.GetShipments() {
+		switch shipment.GetStatus() {
+		case shippingpb.ShippingStatus_CANCELLED, shippingpb.ShippingStatus_RETURNED:
+			continue // Nothing left to stop; the payment is still refunded
+		case shippingpb.ShippingStatus_IN_TRANSIT, shippingpb.ShippingStatus_OUT_FOR_DELIVERY, shippingpb.ShippingStatus_DELIVERED:
+			return nil, nil, fmt.Errorf("%w: shipment %s is %s", ErrOrderNotCancellable, shipment.GetId(), shipment.GetStatus())
+		}
+		if o.cancellationWindow > 0 && now.Sub(shipment.GetCreatedAt().AsTime()) > o.cancellationWindow {
+			return nil, nil, fmt.Errorf("%w: shipment %s was arranged more than %v ago", ErrOrderNotCancellable, shipment.GetId(), o.cancellationWindow)
+		}
+		shipments = append(shipments, shipment.GetId())
+	}
+
+	payResp, err := o.clients.Payment.ListPayments(ctx, &paymentpb.ListPaymentsRequest{OrderId: id})
+	if err != nil {
+		return nil, nil, fmt.Errorf("ListPayments %s: %w", state.OrderID, err)
+	}
+	for _, payment := range payResp.GetPayments() {
+		// A partly refunded payment has the rest refunded
+		if st := payment.GetStatus(); st == paymentpb.PaymentStatus_SUCCESS || st == paymentpb.PaymentStatus_PARTIALLY_REFUNDED {
+			payments = append(payments, payment.GetId())
+		}
+	}
+	return shipments, payments, nil
+}
+
+// cancellationFailed records a cancel-order saga stopped by a failed step. The
+// step itself was already escalated by its compensation function.
+func (o *Orchestrator) cancellationFailed(ctx context.Context, state *CancelOrderSagaState, step, target string, err error) error {
+	log.Printf("Cancel Order Saga %s stopped at %s %s: %v (done: %s)", state.SagaID, step, target, err, state)
+	o.record(ctx, AuditSagaFailed, step, state.String())
+	return &CancellationError{Step: step, Target: target, Err: err}
+}
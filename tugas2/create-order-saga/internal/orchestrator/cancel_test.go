@@ -0,0 +1,143 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/clock"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// completedOrder runs a saga to completion on h and returns its state.
+func completedOrder(t *testing.T, h *sagatest.Harness) *orchestrator.SagaState {
+	t.Helper()
+	state, err := h.Run(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	return state
+}
+
+func TestCancelCompletedOrder(t *testing.T) {
+	h := sagatest.New(t)
+	saga := completedOrder(t, h)
+
+	state, err := h.Orchestrator.ExecuteCancelOrderSaga(context.Background(), saga.OrderID.GetId())
+	if err != nil {
+		t.Fatalf("ExecuteCancelOrderSaga: %v", err)
+	}
+	if !state.OrderCancelled || state.AlreadyCancelled {
+		t.Errorf("state = %s, want the order cancelled by this saga", state)
+	}
+	if got, _ := h.OrderStatus(saga.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("order is %s, want CANCELLED", got)
+	}
+	if got, _ := h.PaymentStatus(saga.PaymentID); got != paymentpb.PaymentStatus_REFUNDED {
+		t.Errorf("payment is %s, want REFUNDED", got)
+	}
+	for _, id := range saga.ShipmentIDs {
+		if got, _ := h.ShipmentStatus(id); got != shippingpb.ShippingStatus_CANCELLED {
+			t.Errorf("shipment %s is %s, want CANCELLED", id, got)
+		}
+	}
+
+	again, err := h.Orchestrator.ExecuteCancelOrderSaga(context.Background(), saga.OrderID.GetId())
+	if err != nil || !again.AlreadyCancelled {
+		t.Errorf("repeated cancellation = %s, %v; want it reported as already cancelled", again, err)
+	}
+}
+
+func TestCancelRefusedAfterWindow(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	h := sagatest.New(t,
+		sagatest.WithClock(fake),
+		sagatest.WithOrchestratorOptions(orchestrator.WithCancellationWindow(time.Hour)),
+	)
+	saga := completedOrder(t, h)
+	fake.Advance(time.Hour + time.Minute)
+
+	_, err := h.Orchestrator.ExecuteCancelOrderSaga(context.Background(), saga.OrderID.GetId())
+	if !errors.Is(err, orchestrator.ErrOrderNotCancellable) {
+		t.Fatalf("ExecuteCancelOrderSaga after the window = %v, want ErrOrderNotCancellable", err)
+	}
+	assertUntouched(t, h, saga)
+}
+
+// TestCancelAtWindowEdge drives every service off one fake clock: the
+// shipment is stamped with the fake time, and a cancellation exactly the
+// window after it was reserved is still accepted.
+func TestCancelAtWindowEdge(t *testing.T) {
+	reserved := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(reserved)
+	h := sagatest.New(t,
+		sagatest.WithClock(fake),
+		sagatest.WithOrchestratorOptions(orchestrator.WithCancellationWindow(time.Hour)),
+	)
+	saga := completedOrder(t, h)
+	shipment, ok := h.Shipping.Lookup(context.Background(), saga.ShipmentIDs[0])
+	if !ok {
+		t.Fatalf("shipment %s not found", saga.ShipmentIDs[0])
+	}
+	if got := shipment.GetCreatedAt().AsTime(); !got.Equal(reserved) {
+		t.Fatalf("shipment created at %v, want the fake clock's %v", got, reserved)
+	}
+	fake.Advance(time.Hour)
+
+	state, err := h.Orchestrator.ExecuteCancelOrderSaga(context.Background(), saga.OrderID.GetId())
+	if err != nil || !state.OrderCancelled {
+		t.Fatalf("ExecuteCancelOrderSaga at the window's edge = %s, %v; want the order cancelled", state, err)
+	}
+}
+
+func TestCancelRefusedOncePickedUp(t *testing.T) {
+	for _, events := range [][]string{
+		{"in_transit"},
+		{"in_transit", "out_for_delivery"},
+		{"in_transit", "out_for_delivery", "delivered"},
+	} {
+		t.Run(events[len(events)-1], func(t *testing.T) {
+			h := sagatest.New(t)
+			saga := completedOrder(t, h)
+			shipment, _ := h.Shipping.Lookup(context.Background(), saga.ShipmentIDs[0])
+			for _, event := range events {
+				if _, _, err := h.Shipping.ApplyCarrierEvent(shipment.GetTrackingNumber(), event, time.Time{}); err != nil {
+					t.Fatalf("ApplyCarrierEvent %q: %v", event, err)
+				}
+			}
+
+			_, err := h.Orchestrator.ExecuteCancelOrderSaga(context.Background(), saga.OrderID.GetId())
+			if !errors.Is(err, orchestrator.ErrOrderNotCancellable) {
+				t.Fatalf("ExecuteCancelOrderSaga = %v, want ErrOrderNotCancellable", err)
+			}
+			if got, _ := h.OrderStatus(saga.OrderID.GetId()); got != orderpb.OrderStatus_COMPLETED {
+				t.Errorf("order is %s, want COMPLETED", got)
+			}
+			if got, _ := h.PaymentStatus(saga.PaymentID); got != paymentpb.PaymentStatus_SUCCESS {
+				t.Errorf("payment is %s, want SUCCESS", got)
+			}
+		})
+	}
+}
+
+// assertUntouched checks that a refused cancellation left the saga's order,
+// payment and shipments as the saga completed them.
+func assertUntouched(t *testing.T, h *sagatest.Harness, saga *orchestrator.SagaState) {
+	t.Helper()
+	if got, _ := h.OrderStatus(saga.OrderID.GetId()); got != orderpb.OrderStatus_COMPLETED {
+		t.Errorf("order is %s, want COMPLETED", got)
+	}
+	if got, _ := h.PaymentStatus(saga.PaymentID); got != paymentpb.PaymentStatus_SUCCESS {
+		t.Errorf("payment is %s, want SUCCESS", got)
+	}
+	for _, id := range saga.ShipmentIDs {
+		if got, _ := h.ShipmentStatus(id); got != shippingpb.ShippingStatus_SHIPPED {
+			t.Errorf("shipment %s is %s, want SHIPPED", id, got)
+		}
+	}
+}
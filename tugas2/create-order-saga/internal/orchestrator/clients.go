@@ -0,0 +1,66 @@
+package orchestrator
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"create-order-saga/pkg/grpc_clients"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// OrderClient is the subset of the Order service the orchestrator calls.
+type OrderClient interface {
+	CreateOrder(ctx context.Context, in *orderpb.CreateOrderRequest, opts ...grpc.CallOption) (*orderpb.CreateOrderResponse, error)
+	CancelOrder(ctx context.Context, in *orderpb.CancelOrderRequest, opts ...grpc.CallOption) (*commonpb.CompensationResponse, error)
+	CompleteOrder(ctx context.Context, in *orderpb.CompleteOrderRequest, opts ...grpc.CallOption) (*commonpb.CompensationResponse, error)
+	ValidateOrder(ctx context.Context, in *orderpb.ValidateOrderRequest, opts ...grpc.CallOption) (*commonpb.ValidationResponse, error)
+	GetOrder(ctx context.Context, in *orderpb.GetOrderRequest, opts ...grpc.CallOption) (*orderpb.Order, error)
+	ListOrders(ctx context.Context, in *orderpb.ListOrdersRequest, opts ...grpc.CallOption) (*orderpb.ListOrdersResponse, error)
+}
+
+// PaymentClient is the subset of the Payment service the orchestrator calls.
+type PaymentClient interface {
+	ProcessPayment(ctx context.Context, in *paymentpb.ProcessPaymentRequest, opts ...grpc.CallOption) (*paymentpb.ProcessPaymentResponse, error)
+	RefundPayment(ctx context.Context, in *paymentpb.RefundPaymentRequest, opts ...grpc.CallOption) (*commonpb.CompensationResponse, error)
+	ValidatePayment(ctx context.Context, in *paymentpb.ValidatePaymentRequest, opts ...grpc.CallOption) (*commonpb.ValidationResponse, error)
+	ListPayments(ctx context.Context, in *paymentpb.ListPaymentsRequest, opts ...grpc.CallOption) (*paymentpb.ListPaymentsResponse, error)
+}
+
+// ShippingClient is the subset of the Shipping service the orchestrator calls.
+type ShippingClient interface {
+	ReserveShipping(ctx context.Context, in *shippingpb.ArrangeShippingRequest, opts ...grpc.CallOption) (*shippingpb.ArrangeShippingResponse, error)
+	ConfirmShipping(ctx context.Context, in *shippingpb.ConfirmShippingRequest, opts ...grpc.CallOption) (*shippingpb.ArrangeShippingResponse, error)
+	CancelShipping(ctx context.Context, in *shippingpb.CancelShippingRequest, opts ...grpc.CallOption) (*commonpb.CompensationResponse, error)
+	ValidateShipping(ctx context.Context, in *shippingpb.ValidateShippingRequest, opts ...grpc.CallOption) (*commonpb.ValidationResponse, error)
+	QuoteShipping(ctx context.Context, in *shippingpb.QuoteShippingRequest, opts ...grpc.CallOption) (*shippingpb.QuoteShippingResponse, error)
+	ListShipments(ctx context.Context, in *shippingpb.ListShipmentsRequest, opts ...grpc.CallOption) (*shippingpb.ListShipmentsResponse, error)
+	UpdateShippingAddress(ctx context.Context, in *shippingpb.UpdateShippingAddressRequest, opts ...grpc.CallOption) (*shippingpb.Shipment, error)
+}
+
+// Clients groups the downstream clients used by the orchestrator.
+// Tests can fill it with the fakes from pkg/grpc_clients/fakes.
+type Clients struct {
+	Order    OrderClient
+	Payment  PaymentClient
+	Shipping ShippingClient
+}
+
+// ClientsFrom adapts the real gRPC ServiceClients to the orchestrator's Clients.
+func ClientsFrom(sc *grpc_clients.ServiceClients) Clients {
+	return Clients{
+		Order:    sc.Order,
+		Payment:  sc.Payment,
+		Shipping: sc.Shipping,
+	}
+}
+
+// The generated clients must keep satisfying the narrow interfaces.
+var (
+	_ OrderClient    = orderpb.OrderServiceClient(nil)
+	_ PaymentClient  = paymentpb.PaymentServiceClient(nil)
+	_ ShippingClient = shippingpb.ShippingServiceClient(nil)
+)
@@ -0,0 +1,173 @@
+package orchestrator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// runAdvancing runs a saga under sagaID, advancing fake past every backoff
+// the saga waits for, and returns its outcome.
+func (f *fakeStack) runAdvancing(fake *clock.Fake, sagaID string) (*orchestrator.SagaState, error) {
+	type outcome struct {
+		state *orchestrator.SagaState
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		state, err := f.run(sagaID)
+		done <- outcome{state, err}
+	}()
+	for {
+		select {
+		case o := <-done:
+			return o.state, o.err
+		case <-time.After(time.Millisecond):
+			if fake.Waiters() > 0 {
+				fake.Advance(time.Second)
+			}
+		}
+	}
+}
+
+// TestSagaCompleteOrderRetried fails the first CompleteOrder with a transient
+// error: the saga retries it, the order is completed and nothing is left to
+// retry in the background or escalate.
+func TestSagaCompleteOrderRetried(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	f := newFakeStack(t, orchestrator.WithClock(fake))
+	f.order.CompleteOrderFunc = fakes.Script[*orderpb.CompleteOrderRequest](
+		fakes.Result[*commonpb.CompensationResponse]{Err: status.Error(codes.Unavailable, "order service restarting")},
+		fakes.Result[*commonpb.CompensationResponse]{Resp: &commonpb.CompensationResponse{Success: true}},
+	)
+	if _, err := f.runAdvancing(fake, "saga-1"); err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	if got := f.calls(fakes.CompleteOrder); got != 2 {
+		t.Errorf("CompleteOrder called %d times, want 2", got)
+	}
+	if pending, _ := f.orch.PendingCompletions(); len(pending) != 0 {
+		t.Errorf("pending completions = %+v, want none", pending)
+	}
+	if ops, _ := f.orch.FailedOperations(); len(ops) != 0 {
+		t.Errorf("failed operations = %+v, want none", ops)
+	}
+	trail, err := f.orch.GetAuditTrail("saga-1")
+	if err != nil {
+		t.Fatalf("GetAuditTrail: %v", err)
+	}
+	var outcomes []orchestrator.AuditEventType
+	for _, e := range trail {
+		if e.Step == "CompleteOrder" && e.Type != orchestrator.AuditStepStarted {
+			outcomes = append(outcomes, e.Type)
+		}
+	}
+	if len(outcomes) != 1 || outcomes[0] != orchestrator.AuditStepSucceeded {
+		t.Errorf("CompleteOrder audit outcomes = %v, want a single success", outcomes)
+	}
+}
+
+// TestSagaCompleteOrderRetryHint refuses the first CompleteOrder as rate
+// limited with a 3s RetryInfo hint: the saga waits the hinted time, not its
+// own shorter backoff, before completing the order.
+func TestSagaCompleteOrderRetryHint(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	f := newFakeStack(t, orchestrator.WithClock(fake))
+	limited, err := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.order.CompleteOrderFunc = fakes.Script[*orderpb.CompleteOrderRequest](
+		fakes.Result[*commonpb.CompensationResponse]{Err: limited.Err()},
+		fakes.Result[*commonpb.CompensationResponse]{Resp: &commonpb.CompensationResponse{Success: true}},
+	)
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.run("saga-1")
+		done <- err
+	}()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	fake.Advance(2 * time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("saga finished %v before the hinted wait: %v", 2*time.Second, err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := f.calls(fakes.CompleteOrder); got != 1 {
+		t.Errorf("CompleteOrder called %d times before the hinted wait, want 1", got)
+	}
+	fake.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	if got := f.calls(fakes.CompleteOrder); got != 2 {
+		t.Errorf("CompleteOrder called %d times, want 2", got)
+	}
+}
+
+// TestSagaCompleteOrderQueued keeps CompleteOrder failing: the saga still
+// succeeds after its attempts, queuing the completion, which a later
+// background retry applies. A non-transient failure is escalated at once.
+func TestSagaCompleteOrderQueued(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	f := newFakeStack(t, orchestrator.WithClock(fake))
+	f.order.CompleteOrderFunc = fakes.Script[*orderpb.CompleteOrderRequest](
+		fakes.Result[*commonpb.CompensationResponse]{Err: status.Error(codes.Unavailable, "order service down")},
+	)
+	state, err := f.runAdvancing(fake, "saga-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	if got := f.calls(fakes.CompleteOrder); got != 3 {
+		t.Errorf("CompleteOrder called %d times, want 3", got)
+	}
+	pending, _ := f.orch.PendingCompletions()
+	if len(pending) != 1 || pending[0].OrderID != state.OrderID.GetId() || pending[0].SagaID != "saga-1" {
+		t.Fatalf("pending completions = %+v, want the saga's order", pending)
+	}
+
+	f.order.CompleteOrderFunc = fakes.Script[*orderpb.CompleteOrderRequest](
+		fakes.Result[*commonpb.CompensationResponse]{Resp: &commonpb.CompensationResponse{Success: true}},
+	)
+	if n := f.orch.RetryPendingCompletions(context.Background()); n != 0 {
+		t.Errorf("RetryPendingCompletions before the backoff = %d, want 0", n)
+	}
+	fake.Advance(time.Second)
+	if n := f.orch.RetryPendingCompletions(context.Background()); n != 1 {
+		t.Errorf("RetryPendingCompletions = %d, want 1", n)
+	}
+	if pending, _ := f.orch.PendingCompletions(); len(pending) != 0 {
+		t.Errorf("pending completions after the retry = %+v, want none", pending)
+	}
+
+	f.order.CompleteOrderFunc = fakes.Script[*orderpb.CompleteOrderRequest](
+		fakes.Result[*commonpb.CompensationResponse]{Err: status.Error(codes.FailedPrecondition, "order was cancelled")},
+	)
+	before := f.calls(fakes.CompleteOrder)
+	if _, err := f.runAdvancing(fake, "saga-2"); err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	if got := f.calls(fakes.CompleteOrder) - before; got != 1 {
+		t.Errorf("non-transient CompleteOrder called %d times, want 1", got)
+	}
+	if pending, _ := f.orch.PendingCompletions(); len(pending) != 0 {
+		t.Errorf("pending completions = %+v, want none for a non-transient failure", pending)
+	}
+	if ops, _ := f.orch.FailedOperations(); len(ops) != 1 || ops[0].Step != "CompleteOrder" || ops[0].SagaID != "saga-2" {
+		t.Errorf("failed operations = %+v, want saga-2's CompleteOrder", ops)
+	}
+}
@@ -0,0 +1,297 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// PendingCompletion is a succeeded saga whose order could not be marked as
+// COMPLETED yet. It is retried in the background until the Order service accepts it.
+type PendingCompletion struct {
+	SagaID      string    `json:"saga_id"`
+	OrderID     string    `json:"order_id"`
+	Tenant      string    `json:"tenant"`
+	Attempts    int       `json:"attempts"` // Background attempts made so far
+	LastError   string    `json:"last_error"`
+	QueuedAt    time.Time `json:"queued_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// CompletionStore persists pending completions, keyed by tenant and order ID.
+type CompletionStore interface {
+	Put(c PendingCompletion) error
+	Delete(tenant, orderID string) error
+	List() ([]PendingCompletion, error)
+	Close() error // Flushes and releases the store; it must not be used afterwards
+}
+
+type completionKey struct {
+	tenant  string
+	orderID string
+}
+
+// MemoryCompletionStore keeps pending completions in memory. It is the default store.
+type MemoryCompletionStore struct {
+	mu      sync.Mutex
+	pending map[completionKey]PendingCompletion
+}
+
+// NewMemoryCompletionStore creates an empty in-memory completion store.
+func NewMemoryCompletionStore() *MemoryCompletionStore {
+	return &MemoryCompletionStore{pending: make(map[completionKey]PendingCompletion)}
+}
+
+// Put adds or replaces a pending completion.
+func (s *MemoryCompletionStore) Put(c PendingCompletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[completionKey{c.Tenant, c.OrderID}] = c
+	return nil
+}
+
+// Delete removes a pending completion, if present.
+func (s *MemoryCompletionStore) Delete(tenant, orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, completionKey{tenant, orderID})
+	return nil
+}
+
+// List returns the pending completions, oldest first.
+func (s *MemoryCompletionStore) List() ([]PendingCompletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]PendingCompletion, 0, len(s.pending))
+	for _, c := range s.pending {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].QueuedAt.Before(list[j].QueuedAt) })
+	return list, nil
+}
+
+// Close is a no-op; pending completions stay readable.
+func (s *MemoryCompletionStore) Close() error { return nil }
+
+// completionRecord is one line of a FileCompletionStore.
+type completionRecord struct {
+	Deleted    bool              `json:"deleted,omitempty"`
+	Completion PendingCompletion `json:"completion"`
+}
+
+// FileCompletionStore keeps pending completions in memory and appends every
+// change as a JSON line to a file, syncing after every write, so the backlog
+// survives a restart.
+type FileCompletionStore struct {
+	mu   sync.Mutex // Serialises writes so the file and memory apply changes in the same order
+	mem  *MemoryCompletionStore
+	file *os.File
+}
+
+// NewFileCompletionStore opens (or creates) a JSONL completion log and replays
+// it to restore the pending completions.
+func NewFileCompletionStore(path string) (*FileCompletionStore, error) {
+	mem := NewMemoryCompletionStore()
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec completionRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("corrupt completion line: %w", err)
+			}
+			if rec.Deleted {
+				mem.Delete(rec.Completion.Tenant, rec.Completion.OrderID)
+			} else {
+				mem.Put(rec.Completion)
+			}
+		}
+		err := scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read completion log: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("open completion log: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open completion log: %w", err)
+	}
+	return &FileCompletionStore{mem: mem, file: f}, nil
+}
+
+// Put records a pending completion and fsyncs the file.
+func (s *FileCompletionStore) Put(c PendingCompletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.appendLocked(completionRecord{Completion: c}); err != nil {
+		return err
+	}
+	return s.mem.Put(c)
+}
+
+// Delete records the removal of a pending completion and fsyncs the file.
+func (s *FileCompletionStore) Delete(tenant, orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.appendLocked(completionRecord{Deleted: true, Completion: PendingCompletion{Tenant: tenant, OrderID: orderID}}); err != nil {
+		return err
+	}
+	return s.mem.Delete(tenant, orderID)
+}
+
+// List returns the pending completions, oldest first.
+func (s *FileCompletionStore) List() ([]PendingCompletion, error) {
+	return s.mem.List()
+}
+
+// appendLocked writes one record and fsyncs the file. Caller holds s.mu.
+func (s *FileCompletionStore) appendLocked(rec completionRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close fsyncs and closes the underlying file.
+func (s *FileCompletionStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	syncErr := s.file.Sync()
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// Background retry schedule for pending completions: the delay before the
+// next attempt doubles from completionRetryBackoff up to completionRetryMaxBackoff.
+// After maxCompletionAttempts the completion is moved to the failed-operation queue.
+const (
+	completionRetryBackoff    = time.Second
+	completionRetryMaxBackoff = 5 * time.Minute
+	maxCompletionAttempts     = 20
+)
+
+// PendingCompletions returns the completions waiting to be retried, oldest first.
+func (o *Orchestrator) PendingCompletions() ([]PendingCompletion, error) {
+	return o.completions.List()
+}
+
+// queueCompletion records that the order of a succeeded saga still has to be
+// marked as COMPLETED. If the store fails, the completion goes to the
+// failed-operation queue instead so it is not lost.
+func (o *Orchestrator) queueCompletion(ctx context.Context, orderID string, err error) {
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	now := o.clock.Now()
+	c := PendingCompletion{
+		SagaID:      sagaID,
+		OrderID:     orderID,
+		Tenant:      interceptors.TenantFromContext(ctx),
+		LastError:   err.Error(),
+		QueuedAt:    now,
+		NextAttempt: now.Add(completionRetryBackoff),
+	}
+	if putErr := o.completions.Put(c); putErr != nil {
+		log.Printf("WARNING: Failed to queue completion of order %s for saga %s: %v", orderID, sagaID, putErr)
+		o.escalate(ctx, "CompleteOrder", orderID, err)
+	}
+}
+
+// RetryPendingCompletions makes one attempt at every pending completion that
+// is due and returns how many orders were completed. Completions that fail
+// with a non-transient error, or too many times, go to the failed-operation queue.
+func (o *Orchestrator) RetryPendingCompletions(ctx context.Context) int {
+	pending, err := o.completions.List()
+	if err != nil {
+		log.Printf("WARNING: Failed to list pending completions: %v", err)
+		return 0
+	}
+	completed := 0
+	for _, c := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		if o.clock.Now().Before(c.NextAttempt) {
+			continue
+		}
+		if o.retryCompletion(ctx, c) {
+			completed++
+		}
+	}
+	return completed
+}
+
+// retryCompletion makes one attempt at a pending completion and updates the store.
+func (o *Orchestrator) retryCompletion(ctx context.Context, c PendingCompletion) bool {
+	callCtx := interceptors.WithTenant(ctx, c.Tenant)
+	if c.SagaID != "" {
+		callCtx = interceptors.WithSagaID(callCtx, c.SagaID)
+	}
+	callCtx, cancel := context.WithTimeout(callCtx, o.compensationTimeout)
+	_, err := o.clients.Order.CompleteOrder(callCtx, &orderpb.CompleteOrderRequest{OrderId: &commonpb.OrderID{Id: c.OrderID}})
+	cancel()
+
+	c.Attempts++
+	if err == nil {
+		log.Printf("Order %s marked as COMPLETED after %d background attempt(s)", c.OrderID, c.Attempts)
+		o.forgetCompletion(c)
+		return true
+	}
+	if !isTransient(err) || c.Attempts >= maxCompletionAttempts {
+		log.Printf("ERROR: Giving up on completing order %s after %d background attempt(s): %v", c.OrderID, c.Attempts, err)
+		o.forgetCompletion(c)
+		o.escalate(callCtx, "CompleteOrder", c.OrderID, err)
+		return false
+	}
+
+	backoff := completionRetryBackoff << min(c.Attempts, 16)
+	if backoff > completionRetryMaxBackoff {
+		backoff = completionRetryMaxBackoff
+	}
+	c.LastError = err.Error()
+	c.NextAttempt = o.clock.Now().Add(backoff)
+	log.Printf("Completing order %s failed (attempt %d), next attempt in %v: %v", c.OrderID, c.Attempts, backoff, err)
+	if err := o.completions.Put(c); err != nil {
+		log.Printf("WARNING: Failed to update pending completion of order %s: %v", c.OrderID, err)
+	}
+	return false
+}
+
+func (o *Orchestrator) forgetCompletion(c PendingCompletion) {
+	if err := o.completions.Delete(c.Tenant, c.OrderID); err != nil {
+		log.Printf("WARNING: Failed to remove pending completion of order %s: %v", c.OrderID, err)
+	}
+}
+
+// RunCompletionRetrier retries due pending completions every interval until
+// ctx is done. Run it in its own goroutine.
+func (o *Orchestrator) RunCompletionRetrier(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.clock.After(interval):
+		}
+		if n := o.RetryPendingCompletions(ctx); n > 0 {
+			log.Printf("Completion retrier completed %d pending order(s)", n)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// stuckCancelShipping makes every CancelShipping call report on the returned
+// channel and then hang until its context is done.
+func (f *fakeStack) stuckCancelShipping() <-chan struct{} {
+	cancelling := make(chan struct{}, 10)
+	f.shipping.CancelShippingFunc = func(ctx context.Context, _ *shippingpb.CancelShippingRequest) (*commonpb.CompensationResponse, error) {
+		cancelling <- struct{}{}
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return cancelling
+}
+
+// failedOp returns the failed operation queued for step, failing the test if
+// there is none.
+func (f *fakeStack) failedOp(t *testing.T, step string) orchestrator.FailedOperation {
+	t.Helper()
+	ops, err := f.orch.FailedOperations()
+	if err != nil {
+		t.Fatalf("FailedOperations: %v", err)
+	}
+	for _, op := range ops {
+		if op.Step == step {
+			return op
+		}
+	}
+	t.Fatalf("failed operations = %+v, want one for %s", ops, step)
+	return orchestrator.FailedOperation{}
+}
+
+// TestCompensationTimeout gives compensations 20ms and makes CancelShipping
+// hang: the saga gives up on it after the timeout, still cancels the order,
+// and records the timed out compensation in its audit trail and the
+// failed-operation queue.
+func TestCompensationTimeout(t *testing.T) {
+	f := newFakeStack(t, orchestrator.WithCompensationTimeout(20*time.Millisecond))
+	f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+		Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED, Message: "card declined"},
+	})
+	f.stuckCancelShipping()
+
+	start := time.Now()
+	_, err := f.run("saga-1")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("saga took %v with a 20ms compensation timeout", elapsed)
+	}
+	if !errors.Is(err, orchestrator.ErrPaymentFailed) || !errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Fatalf("saga error = %v, want ErrPaymentFailed and ErrCompensationFailed", err)
+	}
+	if got := f.calls(fakes.CancelOrder); got != 1 {
+		t.Errorf("CancelOrder called %d times, want 1 despite CancelShipping timing out", got)
+	}
+	if op := f.failedOp(t, "CancelShipping"); !strings.Contains(op.Error, "DeadlineExceeded") {
+		t.Errorf("queued CancelShipping failed with %q, want a deadline error", op.Error)
+	}
+	trail, err := f.orch.GetAuditTrail("saga-1")
+	if err != nil {
+		t.Fatalf("GetAuditTrail: %v", err)
+	}
+	var timedOut bool
+	for _, e := range trail {
+		if e.Type == orchestrator.AuditCompensationFailed && e.Step == "CancelShipping" && strings.Contains(e.Detail, "DeadlineExceeded") {
+			timedOut = true
+		}
+	}
+	if !timedOut {
+		t.Errorf("audit trail %+v has no timed out CancelShipping", trail)
+	}
+}
+
+// TestShutdownDeadlineAbandonsCompensation cancels every saga while one is
+// charging the payment, with a compensation timeout far beyond the shutdown
+// deadline: once the deadline passes on the fake clock, the hanging
+// CancelShipping is abandoned and queued, and the saga returns.
+func TestShutdownDeadlineAbandonsCompensation(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	f := newFakeStack(t,
+		orchestrator.WithClock(fake),
+		orchestrator.WithCompensationTimeout(time.Hour),
+		orchestrator.WithShutdownDeadline(time.Minute),
+	)
+	charging := make(chan struct{}, 1)
+	f.payment.ProcessPaymentFunc = func(ctx context.Context, _ *paymentpb.ProcessPaymentRequest) (*paymentpb.ProcessPaymentResponse, error) {
+		charging <- struct{}{}
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	cancelling := f.stuckCancelShipping()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.run("saga-1")
+		done <- err
+	}()
+	<-charging
+	f.orch.CancelAllSagas()
+	<-cancelling
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("saga returned %v before the shutdown deadline", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	fake.Advance(time.Minute)
+	select {
+	case err := <-done:
+		if !errors.Is(err, orchestrator.ErrCompensationFailed) || !errors.Is(err, orchestrator.ErrShutdownDeadline) {
+			t.Errorf("saga error = %v, want ErrCompensationFailed caused by ErrShutdownDeadline", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("saga still compensating after the shutdown deadline")
+	}
+	if op := f.failedOp(t, "CancelShipping"); !strings.Contains(op.Error, orchestrator.ErrShutdownDeadline.Error()) {
+		t.Errorf("queued CancelShipping failed with %q, want the shutdown deadline", op.Error)
+	}
+}
@@ -0,0 +1,160 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+)
+
+// WithDeduplication makes duplicate submissions of an order share one saga
+// (off by default). A submission is identified by its client reference ID, or
+// when it has none by its user, items and payment amount, within its tenant.
+// A duplicate arriving while the saga runs waits for its outcome; one arriving
+// within ttl after the saga finished gets the remembered outcome, successful
+// or not, without running anything.
+func WithDeduplication(ttl time.Duration) Option {
+	return func(o *Orchestrator) {
+		o.dedup = newSagaDeduper(ttl)
+	}
+}
+
+// errSagaAbandoned is the outcome shared with duplicates when the saga they
+// waited for ended without returning one, i.e. it panicked.
+var errSagaAbandoned = errors.New("saga for the duplicate submission ended without an outcome")
+
+// dedupEntry is the outcome of one submission, shared by its duplicates.
+type dedupEntry struct {
+	done       chan struct{} // Closed once state and err are set
+	state      *SagaState
+	err        error
+	finishedAt time.Time
+}
+
+// sagaDeduper remembers running and recently finished sagas by submission key.
+type sagaDeduper struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+func newSagaDeduper(ttl time.Duration) *sagaDeduper {
+	return &sagaDeduper{ttl: ttl, entries: make(map[string]*dedupEntry)}
+}
+
+// claim returns the entry for key and whether the caller owns it, i.e. must
+// run the saga and then call finish. Expired entries are dropped first.
+func (d *sagaDeduper) claim(key string, now time.Time) (*dedupEntry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, e := range d.entries {
+		if !e.finishedAt.IsZero() && now.Sub(e.finishedAt) >= d.ttl {
+			delete(d.entries, k)
+		}
+	}
+	if e, ok := d.entries[key]; ok {
+		return e, false
+	}
+	e := &dedupEntry{done: make(chan struct{})}
+	d.entries[key] = e
+	return e, true
+}
+
+// finish records the outcome of key's entry and wakes its duplicates. An
+// abandoned saga is not remembered, so a later submission runs again.
+func (d *sagaDeduper) finish(key string, e *dedupEntry, state *SagaState, err error, now time.Time) {
+	d.mu.Lock()
+	e.state, e.err, e.finishedAt = state, err, now
+	if errors.Is(err, errSagaAbandoned) && d.entries[key] == e {
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+	close(e.done)
+}
+
+// submissionKey identifies an order submission for deduplication.
+func submissionKey(ctx context.Context, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo) string {
+	tenant := interceptors.TenantFromContext(ctx)
+	if ref := details.GetClientReferenceId(); ref != "" {
+		return tenant + "/ref/" + ref
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", details.GetUserId())
+	for _, item := range details.GetItems() {
+		fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00", item.GetProductId(), item.GetSku(), item.GetQuantity(), money.Format(item.GetPrice()))
+	}
+	fmt.Fprintf(h, "%s", money.Format(paymentInfo.GetAmount()))
+	return tenant + "/hash/" + hex.EncodeToString(h.Sum(nil))
+}
+
+// runDeduplicated runs the saga unless a duplicate of the submission is
+// running or finished recently, in which case it returns that saga's outcome.
+func (o *Orchestrator) runDeduplicated(ctx context.Context, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo, shippingAddr *commonpb.ShippingAddress) (*SagaState, error) {
+	key := submissionKey(ctx, details, paymentInfo)
+	entry, owner := o.dedup.claim(key, o.clock.Now())
+	if owner {
+		// Deferred so that duplicates are released even if the saga panics
+		var state *SagaState
+		err := errSagaAbandoned
+		defer func() { o.dedup.finish(key, entry, state.clone(), err, o.clock.Now()) }()
+		state, err = o.runCreateOrderSaga(ctx, details, paymentInfo, shippingAddr)
+		return state, err
+	}
+
+	select {
+	case <-entry.done:
+	default:
+		log.Printf("Duplicate order submission (%s); waiting for the saga already running", describeKey(key))
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	log.Printf("Duplicate order submission (%s); returning the outcome of saga %s", describeKey(key), sagaIDOf(entry.state))
+	return entry.state.clone(), entry.err
+}
+
+// describeKey shortens a submission key for log lines.
+func describeKey(key string) string {
+	if tenantAndKind, hash, ok := strings.Cut(key, "/hash/"); ok {
+		return tenantAndKind + "/hash/" + hash[:12]
+	}
+	return key
+}
+
+// sagaIDOf returns the saga's ID, or "-" for a nil state.
+func sagaIDOf(s *SagaState) string {
+	if s == nil {
+		return "-"
+	}
+	return s.SagaID
+}
+
+// clone returns a deep copy of the state, so duplicates never share one.
+func (s *SagaState) clone() *SagaState {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if s.OrderID != nil {
+		c.OrderID = proto.Clone(s.OrderID).(*commonpb.OrderID)
+	}
+	c.ShipmentIDs = slices.Clone(s.ShipmentIDs)
+	c.StepDurations = maps.Clone(s.StepDurations)
+	return &c
+}
@@ -0,0 +1,216 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// submit runs a saga for details on f as a client submitting the order would.
+func (f *fakeStack) submit(details *commonpb.OrderDetails) (*orchestrator.SagaState, error) {
+	return f.orch.RunCreateOrderSaga(context.Background(), details, sagatest.SamplePayment(), sagatest.SampleAddress())
+}
+
+// referenced returns user-1's sample order with client reference ref.
+func referenced(ref string) *commonpb.OrderDetails {
+	details := sagatest.SampleOrder("user-1")
+	details.ClientReferenceId = ref
+	return details
+}
+
+// TestDeduplicateConcurrentSubmissions submits one order ten times while the
+// first submission's saga is running: one order is created and every
+// submission gets that saga's outcome.
+func TestDeduplicateConcurrentSubmissions(t *testing.T) {
+	f := newFakeStack(t, orchestrator.WithDeduplication(time.Minute))
+	started, release := f.holdCreateOrder(t)
+
+	const n = 10
+	states := make([]*orchestrator.SagaState, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	submit := func(i int) {
+		defer wg.Done()
+		states[i], errs[i] = f.submit(referenced("ref-1"))
+	}
+	wg.Add(1)
+	go submit(0)
+	<-started
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go submit(i)
+	}
+	release()
+	wg.Wait()
+
+	if got := f.calls(fakes.CreateOrder); got != 1 {
+		t.Errorf("CreateOrder called %d times, want once", got)
+	}
+	for i := range n {
+		if errs[i] != nil {
+			t.Errorf("submission %d failed: %v", i, errs[i])
+			continue
+		}
+		if states[i].SagaID != states[0].SagaID || states[i].OrderID.GetId() != states[0].OrderID.GetId() {
+			t.Errorf("submission %d got %s, want the outcome of %s", i, states[i], states[0])
+		}
+		if i > 0 && states[i] == states[0] {
+			t.Errorf("submission %d shares the first submission's state", i)
+		}
+	}
+}
+
+// TestDeduplicateSequentialSubmission resubmits a finished order: within the
+// TTL the remembered outcome, failures included, is returned without calling
+// any service; after it the order runs again.
+func TestDeduplicateSequentialSubmission(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		details func() *commonpb.OrderDetails
+		decline bool
+	}{
+		{"client reference", func() *commonpb.OrderDetails { return referenced("ref-1") }, false},
+		{"same contents without reference", func() *commonpb.OrderDetails { return sagatest.SampleOrder("user-1") }, false},
+		{"failed saga", func() *commonpb.OrderDetails { return referenced("ref-1") }, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+			f := newFakeStack(t, orchestrator.WithDeduplication(time.Minute), orchestrator.WithClock(fake))
+			if tc.decline {
+				f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+					Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED, Message: "card declined"},
+				})
+			}
+			first, firstErr := f.submit(tc.details())
+			if (firstErr != nil) != tc.decline {
+				t.Fatalf("first submission = %v, want declined %t", firstErr, tc.decline)
+			}
+			calls := len(f.rec.Methods())
+
+			fake.Advance(59 * time.Second)
+			again, err := f.submit(tc.details())
+			if again.SagaID != first.SagaID || !errors.Is(err, firstErr) {
+				t.Errorf("resubmission = %s, %v; want the remembered %s, %v", again, err, first, firstErr)
+			}
+			if got := f.rec.Methods()[calls:]; len(got) != 0 {
+				t.Errorf("resubmission called %v, want no calls", got)
+			}
+
+			fake.Advance(time.Second)
+			if later, _ := f.submit(tc.details()); later.SagaID == first.SagaID {
+				t.Errorf("submission after the TTL returned saga %s again, want a new saga", later.SagaID)
+			}
+			if got := f.calls(fakes.CreateOrder); got != 2 {
+				t.Errorf("CreateOrder called %d times, want twice", got)
+			}
+		})
+	}
+}
+
+// TestDeduplicateDistinctSubmissions submits two different orders at once:
+// both sagas run, neither waiting for the other.
+func TestDeduplicateDistinctSubmissions(t *testing.T) {
+	moreUnits := sagatest.SampleOrder("user-1")
+	moreUnits.Items[0].Quantity++
+	for _, tc := range []struct {
+		name        string
+		first, next *commonpb.OrderDetails
+	}{
+		{"different references", referenced("ref-1"), referenced("ref-2")},
+		{"different users", sagatest.SampleOrder("user-1"), sagatest.SampleOrder("user-2")},
+		{"different items", sagatest.SampleOrder("user-1"), moreUnits},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeStack(t, orchestrator.WithDeduplication(time.Minute))
+			started, release := f.holdCreateOrder(t)
+
+			states := make([]*orchestrator.SagaState, 2)
+			var wg sync.WaitGroup
+			for i, details := range []*commonpb.OrderDetails{tc.first, tc.next} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var err error
+					if states[i], err = f.submit(details); err != nil {
+						t.Errorf("submission %d failed: %v", i, err)
+					}
+				}()
+			}
+			// Both sagas reach CreateOrder while the other is still held there
+			for range 2 {
+				select {
+				case <-started:
+				case <-time.After(5 * time.Second):
+					t.Fatal("a saga did not start while the other was running")
+				}
+			}
+			release()
+			wg.Wait()
+
+			if t.Failed() {
+				return
+			}
+			if states[0].SagaID == states[1].SagaID {
+				t.Errorf("both submissions got saga %s", states[0].SagaID)
+			}
+		})
+	}
+}
+
+// TestDeduplicateSagaPanic makes the first saga of a submission panic in
+// CreateOrder: a duplicate waiting for it is released with an error instead
+// of hanging, and the submission is not remembered, so it can run again.
+func TestDeduplicateSagaPanic(t *testing.T) {
+	f := newFakeStack(t, orchestrator.WithDeduplication(time.Minute))
+	started, release := f.holdCreateOrder(t)
+	held := f.order.CreateOrderFunc
+	var calls int
+	var mu sync.Mutex
+	f.order.CreateOrderFunc = func(ctx context.Context, req *orderpb.CreateOrderRequest) (*orderpb.CreateOrderResponse, error) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		resp, err := held(ctx, req)
+		if first {
+			panic("order store corrupted")
+		}
+		return resp, err
+	}
+
+	recovered := make(chan any, 1)
+	go func() {
+		defer func() { recovered <- recover() }()
+		f.submit(referenced("ref-1"))
+	}()
+	<-started
+	duplicate := make(chan error, 1)
+	go func() {
+		_, err := f.submit(referenced("ref-1"))
+		duplicate <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the duplicate start waiting for the first saga
+	release()
+
+	if r := <-recovered; r != "order store corrupted" {
+		t.Errorf("first submission recovered %v, want the saga's panic", r)
+	}
+	select {
+	case <-duplicate:
+	case <-time.After(5 * time.Second):
+		t.Fatal("duplicate still waiting 5s after the saga it waited for panicked")
+	}
+	if _, err := f.submit(referenced("ref-1")); err != nil {
+		t.Errorf("submission after the panic = %v, want it to run again and succeed", err)
+	}
+}
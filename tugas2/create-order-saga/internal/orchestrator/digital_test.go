@@ -0,0 +1,163 @@
+package orchestrator_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/grpc_clients"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// callLog records the full method name of every RPC the orchestrator makes.
+type callLog struct {
+	mu      sync.Mutex
+	methods []string
+}
+
+// option makes a harness's clients record their calls in l.
+func (l *callLog) option() sagatest.Option {
+	return sagatest.WithClientOptions(grpc_clients.WithDialOptions(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			l.mu.Lock()
+			l.methods = append(l.methods, method)
+			l.mu.Unlock()
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})))
+}
+
+// shipping returns the recorded calls to the Shipping service.
+func (l *callLog) shipping() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var calls []string
+	for _, m := range l.methods {
+		if strings.HasPrefix(m, "/"+shippingpb.ShippingService_ServiceDesc.ServiceName+"/") {
+			calls = append(calls, m)
+		}
+	}
+	return calls
+}
+
+// runDigital runs a saga for a DIGITAL sample order with no shipping address.
+func runDigital(h *sagatest.Harness) (*orchestrator.SagaState, error) {
+	details := sagatest.SampleOrder("user-1")
+	details.FulfillmentType = commonpb.FulfillmentType_DIGITAL
+	return h.Orchestrator.RunCreateOrderSaga(context.Background(), details, sagatest.SamplePayment(), nil)
+}
+
+// TestDigitalOrderSaga runs digital and physical orders end to end, with the
+// payment approved or declined, and checks digital sagas never call the
+// Shipping service, not even for a quote, and compensate only the steps
+// they ran.
+func TestDigitalOrderSaga(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		digital   bool
+		declined  bool
+		wantTrail []string
+	}{
+		{
+			name:    "digital",
+			digital: true,
+			wantTrail: []string{
+				"SAGA_STARTED",
+				"STEP_STARTED CreateOrder", "STEP_SUCCEEDED CreateOrder",
+				"STEP_STARTED ProcessPayment", "STEP_SUCCEEDED ProcessPayment",
+				"STEP_STARTED CompleteOrder", "STEP_SUCCEEDED CompleteOrder",
+				"SAGA_COMPLETED",
+			},
+		},
+		{
+			name:     "digital declined",
+			digital:  true,
+			declined: true,
+			wantTrail: []string{
+				"SAGA_STARTED",
+				"STEP_STARTED CreateOrder", "STEP_SUCCEEDED CreateOrder",
+				"STEP_STARTED ProcessPayment", "STEP_FAILED ProcessPayment",
+				"COMPENSATION_ATTEMPTED CancelOrder", "COMPENSATION_SUCCEEDED CancelOrder",
+				"SAGA_FAILED ProcessPayment",
+			},
+		},
+		{
+			name: "physical",
+			wantTrail: []string{
+				"SAGA_STARTED",
+				"STEP_STARTED QuoteShipping", "STEP_SUCCEEDED QuoteShipping",
+				"STEP_STARTED CreateOrder", "STEP_SUCCEEDED CreateOrder",
+				"STEP_STARTED ReserveShipping", "STEP_SUCCEEDED ReserveShipping",
+				"STEP_STARTED ProcessPayment", "STEP_SUCCEEDED ProcessPayment",
+				"STEP_STARTED ConfirmShipping", "STEP_SUCCEEDED ConfirmShipping",
+				"STEP_STARTED CompleteOrder", "STEP_SUCCEEDED CompleteOrder",
+				"SAGA_COMPLETED",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := &callLog{}
+			opts := []sagatest.Option{calls.option()}
+			if tc.declined {
+				opts = append(opts, sagatest.WithPaymentFailure())
+			}
+			h := sagatest.New(t, opts...)
+
+			var (
+				state *orchestrator.SagaState
+				err   error
+			)
+			if tc.digital {
+				state, err = runDigital(h)
+			} else {
+				state, err = h.Run(context.Background(), "user-1")
+			}
+			if (err != nil) != tc.declined {
+				t.Fatalf("saga error = %v, want failure %v", err, tc.declined)
+			}
+			if state.Digital != tc.digital {
+				t.Errorf("state.Digital = %v, want %v", state.Digital, tc.digital)
+			}
+
+			trail, err := h.Orchestrator.GetAuditTrail(state.SagaID)
+			if err != nil {
+				t.Fatalf("GetAuditTrail: %v", err)
+			}
+			if got := transitions(trail); !slices.Equal(got, tc.wantTrail) {
+				t.Errorf("trail =\n  %s\nwant\n  %s", strings.Join(got, "\n  "), strings.Join(tc.wantTrail, "\n  "))
+			}
+
+			shippingCalls := calls.shipping()
+			if tc.digital {
+				if len(shippingCalls) != 0 || len(state.ShipmentIDs) != 0 {
+					t.Errorf("digital saga called %v and holds shipments %v, want no shipping at all", shippingCalls, state.ShipmentIDs)
+				}
+				if shipments := h.Shipping.OrderShipments(context.Background(), state.OrderID.GetId()); len(shipments) != 0 {
+					t.Errorf("Shipping service holds %d shipments for a digital order", len(shipments))
+				}
+			} else if len(shippingCalls) == 0 {
+				t.Error("physical saga never called the Shipping service; the call log is not recording")
+			}
+
+			order, _ := h.Order.Lookup(context.Background(), state.OrderID.GetId())
+			wantOrder, wantPayment := orderpb.OrderStatus_COMPLETED, paymentpb.PaymentStatus_SUCCESS
+			if tc.declined {
+				wantOrder, wantPayment = orderpb.OrderStatus_CANCELLED, paymentpb.PaymentStatus_FAILED
+			}
+			if order.GetStatus() != wantOrder || (order.GetFulfillmentType() == commonpb.FulfillmentType_DIGITAL) != tc.digital {
+				t.Errorf("order is %v, %v; want %v", order.GetStatus(), order.GetFulfillmentType(), wantOrder)
+			}
+			if payments := h.Payment.OrderPayments(context.Background(), state.OrderID.GetId()); len(payments) != 1 || payments[0].GetStatus() != wantPayment {
+				t.Errorf("payments = %v, want one %v", payments, wantPayment)
+			}
+		})
+	}
+}
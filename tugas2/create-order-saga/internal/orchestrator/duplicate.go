@@ -0,0 +1,26 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrDuplicatePayment is matched by the error of a saga whose payment the
+// Payment service refused to charge as a likely duplicate of another order's
+// (see payment.WithDuplicateWindow). Nothing was charged; the customer should
+// confirm the order before it is submitted again with WithDuplicatePaymentAllowed.
+var ErrDuplicatePayment = errors.New("payment suspected to be a duplicate")
+
+type allowDuplicateKey struct{}
+
+// WithDuplicatePaymentAllowed returns a context whose saga charges the payment
+// even if it looks like a duplicate of another order's.
+func WithDuplicatePaymentAllowed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowDuplicateKey{}, true)
+}
+
+// duplicatePaymentAllowed reports whether ctx came from WithDuplicatePaymentAllowed.
+func duplicatePaymentAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(allowDuplicateKey{}).(bool)
+	return allowed
+}
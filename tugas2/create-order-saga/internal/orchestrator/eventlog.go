@@ -0,0 +1,288 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+)
+
+// EventType classifies an entry in the event log.
+type EventType string
+
+const (
+	EventStepSucceeded         EventType = "STEP_SUCCEEDED"
+	EventStepFailed            EventType = "STEP_FAILED"
+	EventCompensationSucceeded EventType = "COMPENSATION_SUCCEEDED"
+	EventCompensationSkipped   EventType = "COMPENSATION_SKIPPED" // Nothing to undo: the step never produced an ID
+	// EventCompensationCritical marks a compensation that failed, leaving the
+	// system inconsistent until someone intervenes manually.
+	EventCompensationCritical EventType = "COMPENSATION_CRITICAL"
+)
+
+// Event is one decision of a saga: a forward step or a compensation.
+type Event struct {
+	SagaID      string            `json:"saga_id"`
+	Timestamp   time.Time         `json:"timestamp"` // When the call started
+	Type        EventType         `json:"type"`
+	Step        string            `json:"step"`                   // e.g. "ProcessPayment" or "RefundPayment"
+	Request     string            `json:"request,omitempty"`      // Redacted summary of the request
+	ResponseIDs map[string]string `json:"response_ids,omitempty"` // IDs returned by the call
+	Duration    time.Duration     `json:"duration_ns"`
+	Outcome     string            `json:"outcome"`          // "ok", "skipped" or the error message
+	Reason      string            `json:"reason,omitempty"` // Failure reason reported by the service, e.g. "OUT_OF_STOCK"
+}
+
+// EventSink stores event log entries.
+type EventSink interface {
+	Write(event Event) error
+	Events(sagaID string) ([]Event, error)
+	Close() error // Flushes and releases the sink; it must not be used afterwards
+}
+
+// DefaultEventBufferSize is the capacity of the default in-memory event sink.
+const DefaultEventBufferSize = 10000
+
+// RingBufferEventSink keeps the most recent events in memory, dropping the
+// oldest once full. It is the default sink.
+type RingBufferEventSink struct {
+	mu     sync.RWMutex
+	events []Event
+	next   int // Index the next event is written to
+	full   bool
+}
+
+// NewRingBufferEventSink creates a sink holding at most size events.
+func NewRingBufferEventSink(size int) *RingBufferEventSink {
+	if size < 1 {
+		size = 1
+	}
+	return &RingBufferEventSink{events: make([]Event, size)}
+}
+
+// Write stores an event, overwriting the oldest one if the buffer is full.
+func (s *RingBufferEventSink) Write(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[s.next] = event
+	s.next = (s.next + 1) % len(s.events)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+// Events returns the buffered events of a saga, oldest first.
+func (s *RingBufferEventSink) Events(sagaID string) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	start, n := 0, s.next
+	if s.full {
+		start, n = s.next, len(s.events)
+	}
+	var out []Event
+	for i := 0; i < n; i++ {
+		if e := s.events[(start+i)%len(s.events)]; e.SagaID == sagaID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// Close is a no-op; buffered events stay readable.
+func (s *RingBufferEventSink) Close() error { return nil }
+
+// FileEventSink appends events as JSON lines to a file, syncing after every
+// write so the log survives a crash.
+type FileEventSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileEventSink opens (or creates) a JSONL event log for appending.
+func NewFileEventSink(path string) (*FileEventSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open event log: %w", err)
+	}
+	return &FileEventSink{path: path, file: f}, nil
+}
+
+// Write appends an event as one JSON line and fsyncs the file.
+func (s *FileEventSink) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Events replays the file and returns the events of a saga, in order.
+func (s *FileEventSink) Events(sagaID string) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("corrupt event line: %w", err)
+		}
+		if event.SagaID == sagaID {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// Close fsyncs and closes the underlying file.
+func (s *FileEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	syncErr := s.file.Sync()
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// ExportSaga returns the event log of a saga, oldest first.
+func (o *Orchestrator) ExportSaga(sagaID string) ([]Event, error) {
+	return o.events.Events(sagaID)
+}
+
+// logEvent writes an event for the saga identified in ctx, timing it from
+// start, and reports it to the saga's progress callback (see WithProgress) and
+// watchers (see WatchSaga). Sink failures are logged but never fail the saga.
+func (o *Orchestrator) logEvent(ctx context.Context, typ EventType, step, request string, ids map[string]string, start time.Time, err error) {
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	outcome, reason := "ok", ""
+	switch {
+	case err != nil:
+		outcome = err.Error()
+		if info, ok := errinfo.From(err); ok {
+			reason = info.GetReason()
+			log.Printf("%s failed for saga %s: %s", step, sagaID, errinfo.Format(info))
+		}
+	case typ == EventCompensationSkipped:
+		outcome = "skipped"
+	}
+	event := Event{
+		SagaID:      sagaID,
+		Timestamp:   start,
+		Type:        typ,
+		Step:        step,
+		Request:     request,
+		ResponseIDs: ids,
+		Duration:    o.clock.Now().Sub(start),
+		Outcome:     outcome,
+		Reason:      reason,
+	}
+	if timings, ok := ctx.Value(stepTimingsKey{}).(*stepTimings); ok && typ != EventCompensationSkipped {
+		timings.add(step, event.Duration)
+	}
+	if werr := o.events.Write(event); werr != nil {
+		log.Printf("WARNING: Failed to write event %s/%s for saga %s: %v", typ, step, sagaID, werr)
+	}
+	reportProgress(ctx, event)
+	if s, ok := o.registry.get(sagaID); ok {
+		s.watch.publish(event)
+	}
+}
+
+type stepTimingsKey struct{}
+
+// stepTimings accumulates the duration of each step and compensation of one
+// saga. Compensations run concurrently, so it is safe for concurrent use.
+type stepTimings struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+}
+
+// withStepTimings returns a context in which logEvent records step durations.
+func withStepTimings(ctx context.Context) (context.Context, *stepTimings) {
+	t := &stepTimings{durations: make(map[string]time.Duration)}
+	return context.WithValue(ctx, stepTimingsKey{}, t), t
+}
+
+func (t *stepTimings) add(step string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.durations[step] += d
+}
+
+func (t *stepTimings) snapshot() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]time.Duration, len(t.durations))
+	for step, d := range t.durations {
+		out[step] = d
+	}
+	return out
+}
+
+// formatDurations renders step durations sorted by step name, e.g.
+// "CreateOrder=12ms ProcessPayment=40ms", or "no steps" if there are none.
+func formatDurations(durations map[string]time.Duration) string {
+	if len(durations) == 0 {
+		return "no steps"
+	}
+	steps := make([]string, 0, len(durations))
+	for step := range durations {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	parts := make([]string, len(steps))
+	for i, step := range steps {
+		parts[i] = fmt.Sprintf("%s=%v", step, durations[step])
+	}
+	return strings.Join(parts, " ")
+}
+
+// millis converts d to fractional milliseconds for JSON output.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// maskCard redacts a card number down to its last four characters.
+func maskCard(number string) string {
+	if len(number) <= 4 {
+		return "****"
+	}
+	return "****" + number[len(number)-4:]
+}
+
+// maskPaymentMethod describes how a payment is made without revealing the
+// account, e.g. "card=****4242", "wallet=paypal" or "bank_transfer=****3000".
+func maskPaymentMethod(info *commonpb.PaymentInfo) string {
+	switch info.GetMethodType() {
+	case commonpb.PaymentMethodType_WALLET:
+		return "wallet=" + info.GetWallet().GetProvider()
+	case commonpb.PaymentMethodType_BANK_TRANSFER:
+		return "bank_transfer=" + maskCard(info.GetBankTransfer().GetIban())
+	default:
+		return "card=" + maskCard(info.GetCardNumber())
+	}
+}
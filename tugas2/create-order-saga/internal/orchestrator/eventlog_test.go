@@ -0,0 +1,125 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// declinedPaymentEvents is the event log of a saga on fakes whose payment is
+// declined, at 2024-05-01 10:00 UTC on a clock that never moves. ending is
+// the JSON of its last two events, the compensations that do something.
+func declinedPaymentEvents(ending string) string {
+	return `[
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"STEP_SUCCEEDED","step":"QuoteShipping","request":"city=Orchestration City country=GoLand items=2","response_ids":{"cost":"0.00 USD"},"duration_ns":0,"outcome":"ok"},
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"STEP_SUCCEEDED","step":"CreateOrder","request":"user=user-1 items=2","response_ids":{"order_id":"order-user-1"},"duration_ns":0,"outcome":"ok"},
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"STEP_SUCCEEDED","step":"ReserveShipping","request":"order=order-user-1 city=Orchestration City country=GoLand items=2","response_ids":{"shipment_ids":"ship-order-user-1"},"duration_ns":0,"outcome":"ok"},
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"STEP_FAILED","step":"ProcessPayment","request":"order=order-user-1 amount=46.00 USD card=****4242","duration_ns":0,"outcome":"payment FAILED: Payment failed: card declined."},
+` + ending + `
+]`
+}
+
+// TestExportCompensatedSaga declines the payment of a saga logging to a
+// JSON-lines file, then checks the exported events, and the file itself,
+// match the expected sequence exactly. Compensations run one at a time so
+// their order is fixed.
+func TestExportCompensatedSaga(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		cancelShipping error
+		ending         string
+	}{
+		{
+			name: "compensated",
+			ending: `{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"COMPENSATION_SUCCEEDED","step":"CancelShipping","request":"order=order-user-1 shipment=ship-order-user-1","duration_ns":0,"outcome":"ok"},
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"COMPENSATION_SKIPPED","step":"RefundPayment","request":"order=order-user-1","duration_ns":0,"outcome":"skipped"},
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"COMPENSATION_SUCCEEDED","step":"CancelOrder","request":"order=order-user-1","duration_ns":0,"outcome":"ok"}`,
+		},
+		{
+			name:           "compensation failed",
+			cancelShipping: status.Error(codes.FailedPrecondition, "shipment is locked"),
+			ending: `{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"COMPENSATION_CRITICAL","step":"CancelShipping","request":"order=order-user-1 shipment=ship-order-user-1","duration_ns":0,"outcome":"rpc error: code = FailedPrecondition desc = shipment is locked"},
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"COMPENSATION_SKIPPED","step":"RefundPayment","request":"order=order-user-1","duration_ns":0,"outcome":"skipped"},
+{"saga_id":"saga-1","timestamp":"2024-05-01T10:00:00Z","type":"COMPENSATION_SUCCEEDED","step":"CancelOrder","request":"order=order-user-1","duration_ns":0,"outcome":"ok"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.jsonl")
+			sink, err := orchestrator.NewFileEventSink(path)
+			if err != nil {
+				t.Fatalf("NewFileEventSink: %v", err)
+			}
+			f := newFakeStack(t,
+				orchestrator.WithEventSink(sink),
+				orchestrator.WithClock(clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))),
+				orchestrator.WithCompensationConcurrency(1),
+			)
+			f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+				Resp: &paymentpb.ProcessPaymentResponse{PaymentId: "pay-1", Status: paymentpb.PaymentStatus_FAILED, Message: "Payment failed: card declined."},
+			})
+			if tc.cancelShipping != nil {
+				f.shipping.CancelShippingFunc = fakes.Script[*shippingpb.CancelShippingRequest](fakes.Result[*commonpb.CompensationResponse]{Err: tc.cancelShipping})
+			}
+			f.run("saga-1")
+			f.run("saga-2") // Logged to the same file, but not exported with saga-1
+
+			var want bytes.Buffer
+			if err := json.Compact(&want, []byte(declinedPaymentEvents(tc.ending))); err != nil {
+				t.Fatalf("expected events: %v", err)
+			}
+			events, err := f.orch.ExportSaga("saga-1")
+			if err != nil {
+				t.Fatalf("ExportSaga: %v", err)
+			}
+			got, _ := json.Marshal(events)
+			if string(got) != want.String() {
+				t.Errorf("exported events:\n%s\nwant:\n%s", got, want.String())
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				if strings.Contains(line, `"saga_id":"saga-1"`) {
+					lines = append(lines, line)
+				}
+			}
+			if got := "[" + strings.Join(lines, ",") + "]"; got != want.String() {
+				t.Errorf("event log file:\n%s\nwant:\n%s", got, want.String())
+			}
+		})
+	}
+}
+
+// TestRingBufferEventSinkWraps overfills the buffer: only the newest events
+// survive, still oldest first.
+func TestRingBufferEventSinkWraps(t *testing.T) {
+	sink := orchestrator.NewRingBufferEventSink(3)
+	for _, step := range []string{"a", "b", "c", "d", "e"} {
+		sink.Write(orchestrator.Event{SagaID: "saga-1", Step: step})
+	}
+	sink.Write(orchestrator.Event{SagaID: "saga-2", Step: "f"})
+	events, _ := sink.Events("saga-1")
+	var steps []string
+	for _, e := range events {
+		steps = append(steps, e.Step)
+	}
+	if got := strings.Join(steps, ","); got != "d,e" {
+		t.Errorf("saga-1 events after wrapping = %s, want d,e", got)
+	}
+}
@@ -0,0 +1,53 @@
+package orchestrator
+
+import (
+	"sync"
+	"time"
+)
+
+// FailedOperation is a downstream operation the orchestrator gave up on and
+// that needs follow-up, e.g. a compensation whose target record was not found.
+type FailedOperation struct {
+	SagaID   string    `json:"saga_id"`
+	Step     string    `json:"step"`           // e.g. "RefundPayment"
+	Target   string    `json:"target"`         // ID of the record the operation applies to
+	Code     string    `json:"code,omitempty"` // CompensationCode reported by the service, if it answered
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// FailedOperationQueue collects failed operations for manual or background handling.
+type FailedOperationQueue interface {
+	Enqueue(op FailedOperation) error
+	Pending() ([]FailedOperation, error)
+	Close() error // Flushes and releases the queue; it must not be used afterwards
+}
+
+// MemoryFailedOperationQueue keeps failed operations in memory. It is the default queue.
+type MemoryFailedOperationQueue struct {
+	mu  sync.Mutex
+	ops []FailedOperation
+}
+
+// NewMemoryFailedOperationQueue creates an empty in-memory queue.
+func NewMemoryFailedOperationQueue() *MemoryFailedOperationQueue {
+	return &MemoryFailedOperationQueue{}
+}
+
+// Enqueue adds an operation to the queue.
+func (q *MemoryFailedOperationQueue) Enqueue(op FailedOperation) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ops = append(q.ops, op)
+	return nil
+}
+
+// Pending returns a copy of the queued operations, oldest first.
+func (q *MemoryFailedOperationQueue) Pending() ([]FailedOperation, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]FailedOperation(nil), q.ops...), nil
+}
+
+// Close is a no-op; queued operations stay readable.
+func (q *MemoryFailedOperationQueue) Close() error { return nil }
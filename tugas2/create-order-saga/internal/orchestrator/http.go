@@ -0,0 +1,374 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// streamSagaTimeout is the deadline given to each saga started over HTTP.
+const streamSagaTimeout = 30 * time.Second
+
+// HTTPHandler returns the orchestrator's HTTP API:
+//
+//	POST  /sagas/stream                  run a saga, streaming its progress as server-sent events
+//	GET   /sagas/{id}/events             watch a saga's progress as server-sent events (404 if unknown)
+//	GET   /sagas/{id}/state              the IDs and current phase of an in-flight saga (404 if not in flight)
+//	POST  /sagas/{id}/cancel             cancel an in-flight saga (202, or 404 if unknown)
+//	POST  /orders/{id}/cancel            cancel a completed order, refunding and cancelling shipping (409 if too late)
+//	PATCH /orders/{id}/shipping-address  change the address of an order's shipments before pickup (409 if too late)
+//	POST  /orders:batch                  run a saga per order of a JSON array, returning each one's outcome
+//	GET   /completions/pending           list orders still waiting to be marked COMPLETED
+//	GET   /metrics                       saga concurrency, notification and background completion metrics in the Prometheus text format
+//	GET   /info                          build and version of the orchestrator and the downstream services
+//	GET   /readyz                        whether every downstream service is reachable (200, or 503 naming those that are not)
+func (o *Orchestrator) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sagas/stream", o.handleStreamSaga)
+	mux.HandleFunc("GET /sagas/{id}/events", o.handleWatchSaga)
+	mux.HandleFunc("GET /sagas/{id}/state", o.handleSagaState)
+	mux.HandleFunc("POST /sagas/{id}/cancel", o.handleCancelSaga)
+	mux.HandleFunc("POST /orders/{id}/cancel", o.handleCancelOrder)
+	mux.HandleFunc("PATCH /orders/{id}/shipping-address", o.handleUpdateShippingAddress)
+	mux.HandleFunc("POST /orders:batch", o.handleBatch)
+	mux.HandleFunc("GET /completions/pending", o.handlePendingCompletions)
+	mux.HandleFunc("GET /metrics", o.handleMetrics)
+	mux.HandleFunc("GET /info", o.handleInfo)
+	mux.HandleFunc("GET /readyz", o.handleReady)
+	return mux
+}
+
+func (o *Orchestrator) handlePendingCompletions(w http.ResponseWriter, r *http.Request) {
+	pending, err := o.PendingCompletions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pending); err != nil {
+		log.Printf("Writing pending completions: %v", err)
+	}
+}
+
+// sagaStateResult is the body of a GET /sagas/{id}/state response.
+type sagaStateResult struct {
+	Phase string     `json:"phase"`
+	State *SagaState `json:"state"`
+}
+
+func (o *Orchestrator) handleSagaState(w http.ResponseWriter, r *http.Request) {
+	state, phase, ok := o.GetSagaState(r.PathValue("id"))
+	if !ok {
+		http.Error(w, ErrSagaNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sagaStateResult{Phase: phase, State: state}); err != nil {
+		log.Printf("Writing saga state: %v", err)
+	}
+}
+
+func (o *Orchestrator) handleCancelSaga(w http.ResponseWriter, r *http.Request) {
+	sagaID := r.PathValue("id")
+	if err := o.CancelSaga(sagaID); err != nil {
+		if errors.Is(err, ErrSagaNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Saga %s cancellation requested via HTTP", sagaID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// cancelOrderResult is the body of every POST /orders/{id}/cancel response.
+type cancelOrderResult struct {
+	Success bool                  `json:"success"`
+	Error   string                `json:"error,omitempty"`
+	State   *CancelOrderSagaState `json:"state"`
+}
+
+// handleCancelOrder runs a cancel-order saga. It answers 200 once the order is
+// cancelled, 404 if there is no such order, 409 if it can no longer be
+// cancelled, 500 if the saga stopped part-way and 502 if the services could
+// not be asked; the body always carries the saga's state. The tenant is taken
+// from the X-Tenant-ID header.
+func (o *Orchestrator) handleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if tenant := r.Header.Get(interceptors.TenantHeader); tenant != "" {
+		ctx = interceptors.WithTenant(ctx, tenant)
+	}
+	state, err := o.ExecuteCancelOrderSaga(ctx, r.PathValue("id"))
+	result := cancelOrderResult{Success: err == nil, State: state}
+	code := http.StatusOK
+	if err != nil {
+		result.Error = err.Error()
+		var partial *CancellationError
+		switch {
+		case errors.As(err, &partial):
+			code = http.StatusInternalServerError
+		case errors.Is(err, ErrOrderNotCancellable):
+			code = http.StatusConflict
+		case status.Code(err) == codes.NotFound:
+			code = http.StatusNotFound
+		default:
+			code = http.StatusBadGateway
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Writing cancel order result: %v", err)
+	}
+}
+
+// handleUpdateShippingAddress changes the address of an order's shipments. The
+// body is the protojson form of a common.ShippingAddress; the response lists the
+// updated shipments as a protojson shipping.ListShipmentsResponse. It answers
+// 400 for an invalid address, 404 if the order has no shipment, 409 if the
+// carrier has picked one up and 502 if the services could not be asked. The tenant is
+// taken from the X-Tenant-ID header.
+func (o *Orchestrator) handleUpdateShippingAddress(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "reading request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr := &commonpb.ShippingAddress{}
+	if err := protojson.Unmarshal(body, addr); err != nil {
+		http.Error(w, "invalid shipping address: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if tenant := r.Header.Get(interceptors.TenantHeader); tenant != "" {
+		ctx = interceptors.WithTenant(ctx, tenant)
+	}
+	shipments, err := o.UpdateShippingAddress(ctx, r.PathValue("id"), addr)
+	if err != nil {
+		code := http.StatusBadGateway
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			code = http.StatusBadRequest
+		case codes.NotFound:
+			code = http.StatusNotFound
+		case codes.FailedPrecondition:
+			code = http.StatusConflict
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	data, err := protojson.Marshal(&shippingpb.ListShipmentsResponse{Shipments: shipments})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Writing updated shipments: %v", err)
+	}
+}
+
+// sagaRequest is the body of POST /sagas/stream, e.g.
+//
+//	{"details": {...}, "payment_info": {...}, "shipping_address": {...}}
+//
+// where each field uses the protojson form of the matching common message.
+type sagaRequest struct {
+	Details         json.RawMessage `json:"details"`
+	PaymentInfo     json.RawMessage `json:"payment_info"`
+	ShippingAddress json.RawMessage `json:"shipping_address"`
+}
+
+// decode unmarshals every field of the request, all of which are required.
+func (req sagaRequest) decode() (BatchOrder, error) {
+	order := BatchOrder{Details: &commonpb.OrderDetails{}, PaymentInfo: &commonpb.PaymentInfo{}, ShippingAddress: &commonpb.ShippingAddress{}}
+	for _, f := range []struct {
+		name string
+		data json.RawMessage
+		msg  proto.Message
+	}{
+		{"details", req.Details, order.Details},
+		{"payment_info", req.PaymentInfo, order.PaymentInfo},
+		{"shipping_address", req.ShippingAddress, order.ShippingAddress},
+	} {
+		if len(f.data) == 0 || string(f.data) == "null" {
+			return BatchOrder{}, fmt.Errorf("missing %q", f.name)
+		}
+		if err := protojson.Unmarshal(f.data, f.msg); err != nil {
+			return BatchOrder{}, fmt.Errorf("invalid %q: %v", f.name, err)
+		}
+	}
+	return order, nil
+}
+
+// batchResponse is the body of a POST /orders:batch response.
+type batchResponse struct {
+	Results []BatchResult `json:"results"` // One per entry, in request order
+}
+
+// handleBatch runs a batch of sagas (see ExecuteCreateOrderBatch). The body is
+// a JSON array of objects shaped like the body of POST /sagas/stream; entries
+// that cannot be decoded are reported as INVALID without affecting the rest.
+// The optional concurrency and timeout query parameters (e.g. "?concurrency=8&timeout=2m")
+// override the batch defaults. Sagas carry on if the client disconnects. The
+// tenant is taken from the X-Tenant-ID header.
+func (o *Orchestrator) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var opts BatchOptions
+	if v := r.URL.Query().Get("concurrency"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid concurrency: "+v, http.StatusBadRequest)
+			return
+		}
+		opts.Concurrency = n
+	}
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid timeout: "+v, http.StatusBadRequest)
+			return
+		}
+		opts.Timeout = d
+	}
+	var reqs []sagaRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&reqs); err != nil {
+		http.Error(w, "invalid batch request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]BatchResult, len(reqs))
+	var (
+		orders  []BatchOrder
+		indexes []int // Batch index of each decoded order
+	)
+	for i, req := range reqs {
+		order, err := req.decode()
+		if err != nil {
+			results[i] = BatchResult{Index: i, Outcome: BatchOutcomeInvalid, Error: err.Error(), Err: err}
+			continue
+		}
+		orders = append(orders, order)
+		indexes = append(indexes, i)
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	if tenant := r.Header.Get(interceptors.TenantHeader); tenant != "" {
+		ctx = interceptors.WithTenant(ctx, tenant)
+	}
+	for j, res := range o.ExecuteCreateOrderBatch(ctx, orders, opts) {
+		res.Index = indexes[j]
+		results[res.Index] = res
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(batchResponse{Results: results}); err != nil {
+		log.Printf("Writing batch results: %v", err)
+	}
+}
+
+// sagaResult is the final server-sent event of a streamed saga.
+type sagaResult struct {
+	Success bool       `json:"success"`
+	Error   string     `json:"error,omitempty"`
+	State   *SagaState `json:"state"`
+}
+
+// handleStreamSaga runs one saga and streams a "progress" event per finished
+// step and compensation, then a "result" event. The saga is not cancelled if
+// the client disconnects; use POST /sagas/{id}/cancel for that. The tenant is
+// taken from the X-Tenant-ID header.
+func (o *Orchestrator) handleStreamSaga(w http.ResponseWriter, r *http.Request) {
+	var req sagaRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid saga request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	order, err := req.decode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	send := startEventStream(w)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), streamSagaTimeout)
+	defer cancel()
+	if tenant := r.Header.Get(interceptors.TenantHeader); tenant != "" {
+		ctx = interceptors.WithTenant(ctx, tenant)
+	}
+	ctx = WithProgress(ctx, func(p SagaProgress) { send("progress", p) })
+	state, err := o.RunCreateOrderSaga(ctx, order.Details, order.PaymentInfo, order.ShippingAddress)
+	result := sagaResult{Success: err == nil, State: state}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	send("result", result)
+}
+
+// sagaEnd is the final server-sent event of a watched saga.
+type sagaEnd struct {
+	SagaID string `json:"saga_id"`
+	Status string `json:"status,omitempty"` // SagaStatusCompleted or SagaStatusCompensated; empty if unknown
+}
+
+// handleWatchSaga streams a "progress" event per step and compensation of a
+// saga, replaying those already recorded, then an "end" event once it has
+// finished. Watching stops when the client disconnects.
+func (o *Orchestrator) handleWatchSaga(w http.ResponseWriter, r *http.Request) {
+	sagaID := r.PathValue("id")
+	progress, err := o.WatchSaga(r.Context(), sagaID)
+	if err != nil {
+		if errors.Is(err, ErrSagaNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	send := startEventStream(w)
+	for p := range progress {
+		send("progress", p)
+	}
+	if r.Context().Err() == nil {
+		send("end", sagaEnd{SagaID: sagaID, Status: o.SagaStatus(sagaID)})
+	}
+}
+
+// startEventStream writes the headers of a server-sent event stream and
+// returns a func sending one JSON-encoded event on it.
+func startEventStream(w http.ResponseWriter) func(event string, v any) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	return func(event string, v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("Encoding %s event: %v", event, err)
+			return
+		}
+		// Write errors mean the client went away; the saga carries on regardless
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
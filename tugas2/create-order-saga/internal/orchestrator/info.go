@@ -0,0 +1,93 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"create-order-saga/internal/buildinfo"
+	infopb "create-order-saga/proto/info"
+)
+
+// WithBuildInfo sets what the orchestrator reports about itself at GET /info
+// (its build with no features listed by default).
+func WithBuildInfo(info *infopb.ServiceInfo) Option {
+	return func(o *Orchestrator) {
+		o.buildInfo = info
+	}
+}
+
+// WithServiceInfo records the build information of the downstream services,
+// keyed by service name (see grpc_clients.ServiceClients.ServiceInfo). Their
+// versions are added to the SAGA_STARTED audit entry of every saga and
+// reported at GET /info.
+func WithServiceInfo(services map[string]*infopb.ServiceInfo) Option {
+	return func(o *Orchestrator) {
+		o.serviceInfo = maps.Clone(services)
+		o.serviceVersions = describeVersions(services)
+	}
+}
+
+// describeVersions renders the services' versions for audit entries, e.g.
+// "versions=order:v1.4.0@1a2b3c4d,payment:dev,shipping:dev", or "" for none.
+func describeVersions(services map[string]*infopb.ServiceInfo) string {
+	if len(services) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(services))
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		info := services[name]
+		part := name + ":" + info.GetVersion()
+		if commit := info.GetCommit(); commit != "" {
+			part += "@" + commit[:min(len(commit), 8)]
+		}
+		parts = append(parts, part)
+	}
+	return "versions=" + strings.Join(parts, ",")
+}
+
+// withVersions appends the downstream versions, if known, to an audit detail.
+func (o *Orchestrator) withVersions(detail string) string {
+	if o.serviceVersions == "" {
+		return detail
+	}
+	if detail == "" {
+		return o.serviceVersions
+	}
+	return detail + " " + o.serviceVersions
+}
+
+// infoResult is the body of a GET /info response.
+type infoResult struct {
+	Orchestrator json.RawMessage            `json:"orchestrator"`
+	Services     map[string]json.RawMessage `json:"services,omitempty"`
+}
+
+func (o *Orchestrator) handleInfo(w http.ResponseWriter, r *http.Request) {
+	self := o.buildInfo
+	if self == nil {
+		self = buildinfo.Info("orchestrator", nil)
+	}
+	result := infoResult{Orchestrator: mustProtoJSON(self), Services: make(map[string]json.RawMessage, len(o.serviceInfo))}
+	for name, info := range o.serviceInfo {
+		result.Services[name] = mustProtoJSON(info)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Writing build info: %v", err)
+	}
+}
+
+// mustProtoJSON encodes a ServiceInfo, which cannot fail for its plain fields.
+func mustProtoJSON(info *infopb.ServiceInfo) json.RawMessage {
+	b, err := protojson.Marshal(info)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return b
+}
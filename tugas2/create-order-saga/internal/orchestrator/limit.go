@@ -0,0 +1,119 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/interceptors"
+)
+
+// WithMaxConcurrentSagas limits how many sagas run at the same time (no limit
+// by default, or if n <= 0), so bursts cannot exhaust the downstream services.
+// A saga started while n are running waits up to wait for one to finish and
+// then fails with codes.ResourceExhausted; with a zero wait it fails at once.
+func WithMaxConcurrentSagas(n int, wait time.Duration) Option {
+	return func(o *Orchestrator) {
+		if n <= 0 {
+			o.limiter = &sagaLimiter{}
+			return
+		}
+		o.limiter = &sagaLimiter{slots: make(chan struct{}, n), wait: wait}
+	}
+}
+
+// sagaLimiter counts running sagas and, if limited, bounds them.
+type sagaLimiter struct {
+	slots chan struct{} // One element per running saga; nil means no limit
+	wait  time.Duration // How long a saga waits for a free slot
+
+	inFlight atomic.Int64
+	rejected atomic.Uint64
+}
+
+// acquireSagaSlot counts a starting saga and, if sagas are limited, takes a
+// slot for it, waiting up to the limiter's wait for one to free up. The
+// returned func releases it once the saga has finished.
+func (o *Orchestrator) acquireSagaSlot(ctx context.Context) (release func(), err error) {
+	l := o.limiter
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if err := l.waitForSlot(ctx, o); err != nil {
+				sagaID, _ := interceptors.SagaIDFromContext(ctx)
+				log.Printf("Rejecting saga %s: %v", sagaID, err)
+				l.rejected.Add(1)
+				return nil, err
+			}
+		}
+	}
+	l.inFlight.Add(1)
+	return func() {
+		l.inFlight.Add(-1)
+		if l.slots != nil {
+			<-l.slots
+		}
+	}, nil
+}
+
+// waitForSlot waits up to l.wait for a slot once all are taken.
+func (l *sagaLimiter) waitForSlot(ctx context.Context, o *Orchestrator) error {
+	if l.wait <= 0 {
+		return status.Errorf(codes.ResourceExhausted, "%d sagas already in flight", cap(l.slots))
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-o.clock.After(l.wait):
+		return status.Errorf(codes.ResourceExhausted, "no saga slot freed up within %v (limit %d)", l.wait, cap(l.slots))
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SagasInFlight returns how many sagas are running right now.
+func (o *Orchestrator) SagasInFlight() int {
+	return int(o.limiter.inFlight.Load())
+}
+
+// handleMetrics writes the saga concurrency, notification and background
+// completion metrics in the Prometheus text exposition format.
+func (o *Orchestrator) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	l := o.limiter
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP saga_in_flight Number of sagas currently running.")
+	fmt.Fprintln(w, "# TYPE saga_in_flight gauge")
+	fmt.Fprintf(w, "saga_in_flight %d\n", l.inFlight.Load())
+	if l.slots != nil {
+		fmt.Fprintln(w, "# HELP saga_max_concurrent Maximum number of sagas allowed to run at once.")
+		fmt.Fprintln(w, "# TYPE saga_max_concurrent gauge")
+		fmt.Fprintf(w, "saga_max_concurrent %d\n", cap(l.slots))
+	}
+	fmt.Fprintln(w, "# HELP saga_rejected_total Sagas rejected because too many were in flight.")
+	fmt.Fprintln(w, "# TYPE saga_rejected_total counter")
+	fmt.Fprintf(w, "saga_rejected_total %d\n", l.rejected.Load())
+	fmt.Fprintln(w, "# HELP saga_notifications_total Customer notifications sent for finished sagas.")
+	fmt.Fprintln(w, "# TYPE saga_notifications_total counter")
+	fmt.Fprintf(w, "saga_notifications_total %d\n", o.notifications.sent.Load())
+	fmt.Fprintln(w, "# HELP saga_notification_failures_total Customer notifications that could not be sent.")
+	fmt.Fprintln(w, "# TYPE saga_notification_failures_total counter")
+	fmt.Fprintf(w, "saga_notification_failures_total %d\n", o.notifications.failed.Load())
+	if o.asyncComplete {
+		fmt.Fprintln(w, "# HELP saga_async_completions_in_flight Orders of returned sagas still being marked as COMPLETED.")
+		fmt.Fprintln(w, "# TYPE saga_async_completions_in_flight gauge")
+		fmt.Fprintf(w, "saga_async_completions_in_flight %d\n", len(o.CompletingSagas()))
+		fmt.Fprintln(w, "# HELP saga_async_completions_total Orders marked as COMPLETED after their saga returned.")
+		fmt.Fprintln(w, "# TYPE saga_async_completions_total counter")
+		fmt.Fprintf(w, "saga_async_completions_total %d\n", o.asyncCompletions.succeeded.Load())
+		fmt.Fprintln(w, "# HELP saga_async_completion_failures_total Background completions that failed and were left for retry or follow-up.")
+		fmt.Fprintln(w, "# TYPE saga_async_completion_failures_total counter")
+		fmt.Fprintf(w, "saga_async_completion_failures_total %d\n", o.asyncCompletions.failed.Load())
+	}
+}
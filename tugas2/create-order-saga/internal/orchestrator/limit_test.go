@@ -0,0 +1,117 @@
+package orchestrator_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients/fakes"
+)
+
+// TestMaxConcurrentSagas holds two sagas in CreateOrder under a limit of two
+// and starts a third: it is rejected with ResourceExhausted, at once or once
+// its wait has passed, without calling any service, or runs once a slot frees
+// up while it waits.
+func TestMaxConcurrentSagas(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		wait    time.Duration
+		advance time.Duration // Fake time passed while the third saga waits
+		free    bool          // Finish the held sagas while it waits
+		wantErr codes.Code
+	}{
+		{name: "no wait", wantErr: codes.ResourceExhausted},
+		{name: "wait times out", wait: time.Second, advance: time.Second, wantErr: codes.ResourceExhausted},
+		{name: "slot frees up in time", wait: time.Second, free: true, wantErr: codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+			f := newFakeStack(t, orchestrator.WithMaxConcurrentSagas(2, tc.wait), orchestrator.WithClock(fake))
+			started, release := f.holdCreateOrder(t)
+
+			held := make(chan error, 2)
+			for i := range 2 {
+				go func() {
+					_, err := f.run(fmt.Sprintf("saga-%d", i))
+					held <- err
+				}()
+				<-started
+			}
+			if got := f.orch.SagasInFlight(); got != 2 {
+				t.Errorf("SagasInFlight = %d with the limit reached, want 2", got)
+			}
+
+			waiters := fake.Waiters()
+			third := make(chan error, 1)
+			go func() {
+				_, err := f.run("saga-3")
+				third <- err
+			}()
+			if tc.wait > 0 {
+				for fake.Waiters() == waiters {
+					time.Sleep(time.Millisecond)
+				}
+				if tc.free {
+					release()
+				}
+				fake.Advance(tc.advance)
+			}
+
+			err := <-third
+			if got := status.Code(err); got != tc.wantErr {
+				t.Fatalf("third saga = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != codes.OK {
+				if got := f.calls(fakes.QuoteShipping); got != 2 {
+					t.Errorf("QuoteShipping called %d times, want only by the two running sagas", got)
+				}
+			}
+			release()
+			for range 2 {
+				if err := <-held; err != nil {
+					t.Errorf("held saga failed: %v", err)
+				}
+			}
+			if got := f.orch.SagasInFlight(); got != 0 {
+				t.Errorf("SagasInFlight = %d after every saga returned, want 0", got)
+			}
+		})
+	}
+}
+
+// TestMaxConcurrentSagasUnlimited checks a limit of zero or less means no
+// limit rather than rejecting every saga or panicking.
+func TestMaxConcurrentSagasUnlimited(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			f := newFakeStack(t, orchestrator.WithMaxConcurrentSagas(n, 0))
+			started, release := f.holdCreateOrder(t)
+
+			done := make(chan error, 3)
+			for i := range 3 {
+				go func() {
+					_, err := f.run(fmt.Sprintf("saga-%d", i))
+					done <- err
+				}()
+			}
+			for range 3 {
+				select {
+				case <-started:
+				case err := <-done:
+					t.Fatalf("saga returned before release: %v", err)
+				}
+			}
+			release()
+			for range 3 {
+				if err := <-done; err != nil {
+					t.Errorf("saga failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/interceptors"
+)
+
+// Notifier tells the customer how their order turned out. It is called once
+// a create-order saga has finished: after CompleteOrder if it succeeded, or
+// after its compensations if it failed.
+type Notifier interface {
+	NotifyOrderCompleted(ctx context.Context, state *SagaState) error
+	NotifyOrderFailed(ctx context.Context, state *SagaState, reason string) error
+}
+
+// WithNotifier sets who is notified of finished sagas (no one by default).
+// Notification failures never fail the saga: they are logged, audited as
+// NOTIFICATION_FAILED and counted in saga_notification_failures_total.
+func WithNotifier(n Notifier) Option {
+	return func(o *Orchestrator) {
+		o.notifier = n
+	}
+}
+
+// Notification events, as sent in a notification's "event" field.
+const (
+	NotificationOrderCompleted = "order.completed"
+	NotificationOrderFailed    = "order.failed"
+)
+
+// Notification is the JSON body of a webhook notification.
+type Notification struct {
+	Event  string     `json:"event"`
+	Reason string     `json:"reason,omitempty"` // Why the saga failed; empty for completed orders
+	Saga   *SagaState `json:"saga"`
+}
+
+// notificationStats counts notifications for the metrics endpoint.
+type notificationStats struct {
+	sent   atomic.Uint64
+	failed atomic.Uint64
+}
+
+// notify tells the notifier, if any, how the saga ended: completed if err is
+// nil, failed otherwise.
+func (o *Orchestrator) notify(ctx context.Context, state *SagaState, err error) {
+	if o.notifier == nil {
+		return
+	}
+	event := NotificationOrderCompleted
+	var notifyErr error
+	if err == nil {
+		notifyErr = o.notifier.NotifyOrderCompleted(ctx, state)
+	} else {
+		event = NotificationOrderFailed
+		notifyErr = o.notifier.NotifyOrderFailed(ctx, state, failureReason(err))
+	}
+	if notifyErr != nil {
+		log.Printf("WARNING: Failed to send %s notification for saga %s: %v", event, state.SagaID, notifyErr)
+		o.notifications.failed.Add(1)
+		o.record(ctx, AuditNotificationFailed, "", event+": "+notifyErr.Error())
+		return
+	}
+	o.notifications.sent.Add(1)
+	o.record(ctx, AuditNotificationSent, "", event)
+}
+
+// failureReason describes why a saga failed for its notification: the
+// machine-readable reason the failing service gave, if any, else the error.
+func failureReason(err error) string {
+	var stepErr *StepError
+	if errors.As(err, &stepErr) && stepErr.Info != nil {
+		return stepErr.Info.GetReason()
+	}
+	return err.Error()
+}
+
+// LogNotifier only logs notifications. It is meant for deployments without a
+// webhook, so outcomes still show up somewhere.
+type LogNotifier struct{}
+
+// NotifyOrderCompleted implements Notifier.
+func (LogNotifier) NotifyOrderCompleted(ctx context.Context, state *SagaState) error {
+	log.Printf("Notification %s: %s", NotificationOrderCompleted, state)
+	return nil
+}
+
+// NotifyOrderFailed implements Notifier.
+func (LogNotifier) NotifyOrderFailed(ctx context.Context, state *SagaState, reason string) error {
+	log.Printf("Notification %s (%s): %s", NotificationOrderFailed, reason, state)
+	return nil
+}
+
+// Defaults of WebhookConfig.
+const (
+	DefaultWebhookAttempts = 3
+	DefaultWebhookBackoff  = 500 * time.Millisecond
+	DefaultWebhookTimeout  = 5 * time.Second
+)
+
+// WebhookConfig configures a WebhookNotifier. Zero fields take their defaults.
+type WebhookConfig struct {
+	URL         string        // Where notifications are POSTed
+	MaxAttempts int           // Attempts per notification (DefaultWebhookAttempts)
+	Backoff     time.Duration // Wait before the first retry, doubled for each further one (DefaultWebhookBackoff)
+	Timeout     time.Duration // Timeout of each attempt (DefaultWebhookTimeout)
+	Clock       clock.Clock   // Clock the backoff waits on (the real clock)
+}
+
+// WebhookNotifier POSTs every notification as JSON to a URL, retrying
+// network errors, 429 and 5xx responses. A notification it gives up on is
+// logged in full so it is not lost.
+type WebhookNotifier struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier for cfg.
+func NewWebhookNotifier(cfg WebhookConfig) *WebhookNotifier {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultWebhookAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultWebhookBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultWebhookTimeout
+	}
+	cfg.Clock = clock.OrReal(cfg.Clock)
+	return &WebhookNotifier{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// NotifyOrderCompleted implements Notifier.
+func (n *WebhookNotifier) NotifyOrderCompleted(ctx context.Context, state *SagaState) error {
+	return n.send(ctx, Notification{Event: NotificationOrderCompleted, Saga: state})
+}
+
+// NotifyOrderFailed implements Notifier.
+func (n *WebhookNotifier) NotifyOrderFailed(ctx context.Context, state *SagaState, reason string) error {
+	return n.send(ctx, Notification{Event: NotificationOrderFailed, Reason: reason, Saga: state})
+}
+
+// send POSTs the notification, retrying until it is accepted, it is refused
+// for good or the attempts run out.
+func (n *WebhookNotifier) send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("encoding notification: %w", err)
+	}
+	backoff := n.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := postJSON(ctx, n.client, n.cfg.URL, body, sagaHeader(ctx))
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == n.cfg.MaxAttempts {
+			log.Printf("Giving up on webhook notification after %d attempt(s), logging it instead: %s", attempt, body)
+			return fmt.Errorf("webhook notification gave up after %d attempt(s): %w", attempt, err)
+		}
+		log.Printf("Webhook notification attempt %d failed, retrying in %v: %v", attempt, backoff, err)
+		select {
+		case <-n.cfg.Clock.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("webhook notification abandoned: %w", ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+// sagaHeader returns the X-Saga-ID header for the saga identified in ctx, if any.
+func sagaHeader(ctx context.Context) http.Header {
+	header := make(http.Header)
+	if sagaID, ok := interceptors.SagaIDFromContext(ctx); ok {
+		header.Set("X-Saga-ID", sagaID)
+	}
+	return header
+}
+
+// postJSON makes one attempt at POSTing body to url with the given headers,
+// reporting whether a failed one is worth retrying: network errors, 429 and
+// 5xx responses are.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook answered %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook refused the delivery: %s", resp.Status)
+	}
+}
@@ -0,0 +1,205 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// webhook is a notification endpoint answering each delivery attempt with
+// the next of its statuses, repeating the last, and recording what it got.
+type webhook struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	headers  []http.Header
+	sagaIDs  []string // X-Saga-ID header of each attempt
+}
+
+func newWebhook(t *testing.T, statuses ...int) *webhook {
+	t.Helper()
+	w := &webhook{statuses: statuses}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.bodies = append(w.bodies, string(body))
+		w.headers = append(w.headers, r.Header.Clone())
+		w.sagaIDs = append(w.sagaIDs, r.Header.Get("X-Saga-ID"))
+		code := w.statuses[min(len(w.bodies), len(w.statuses))-1]
+		rw.WriteHeader(code)
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+// attempts returns the bodies of the delivery attempts so far.
+func (w *webhook) attempts() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.bodies)
+}
+
+// attemptHeaders returns the headers of the delivery attempts so far.
+func (w *webhook) attemptHeaders() []http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.headers)
+}
+
+// notificationAudit returns the notification entries of sagaID's audit trail
+// as "TYPE detail".
+func notificationAudit(t *testing.T, o *orchestrator.Orchestrator, sagaID string) []string {
+	t.Helper()
+	trail, err := o.GetAuditTrail(sagaID)
+	if err != nil {
+		t.Fatalf("GetAuditTrail: %v", err)
+	}
+	var entries []string
+	for _, entry := range trail {
+		if entry.Type == orchestrator.AuditNotificationSent || entry.Type == orchestrator.AuditNotificationFailed {
+			entries = append(entries, string(entry.Type)+" "+entry.Detail)
+		}
+	}
+	return entries
+}
+
+// notificationMetrics returns the sent and failed notification counters
+// served at /metrics.
+func notificationMetrics(t *testing.T, o *orchestrator.Orchestrator) (sent, failed string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	o.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, "saga_notifications_total "); ok {
+			sent = v
+		}
+		if v, ok := strings.CutPrefix(line, "saga_notification_failures_total "); ok {
+			failed = v
+		}
+	}
+	return sent, failed
+}
+
+// TestWebhookNotificationPayload runs a saga that completes and one whose
+// shipping fails with a carrier error, each notifying a webhook: the JSON
+// posted names the outcome, the failure's reason and the saga's IDs.
+func TestWebhookNotificationPayload(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		failing    bool
+		wantEvent  string
+		wantReason string
+	}{
+		{"completed", false, orchestrator.NotificationOrderCompleted, ""},
+		{"failed", true, orchestrator.NotificationOrderFailed, errinfo.ReasonCarrierUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := newWebhook(t, http.StatusNoContent)
+			f := newFakeStack(t, orchestrator.WithNotifier(orchestrator.NewWebhookNotifier(orchestrator.WebhookConfig{URL: hook.URL})))
+			if tc.failing {
+				info := errinfo.New(errinfo.DomainShipping, errinfo.ReasonCarrierUnavailable, map[string]string{"order_id": "order-user-1"})
+				f.shipping.ReserveShippingFunc = fakes.Script[*shippingpb.ArrangeShippingRequest](fakes.Result[*shippingpb.ArrangeShippingResponse]{
+					Err: errinfo.Errorf(codes.Internal, info, "carrier unavailable"),
+				})
+			}
+			state, err := f.run("saga-1")
+			if (err != nil) != tc.failing {
+				t.Fatalf("saga error = %v, want failing %t", err, tc.failing)
+			}
+
+			attempts := hook.attempts()
+			if len(attempts) != 1 {
+				t.Fatalf("webhook got %d deliveries, want 1: %q", len(attempts), attempts)
+			}
+			var got struct {
+				Event  string
+				Reason string
+				Saga   struct {
+					SagaID    string `json:"saga_id"`
+					OrderID   string `json:"order_id"`
+					PaymentID string `json:"payment_id"`
+				}
+			}
+			if err := json.Unmarshal([]byte(attempts[0]), &got); err != nil {
+				t.Fatalf("decoding %s: %v", attempts[0], err)
+			}
+			if got.Event != tc.wantEvent || got.Reason != tc.wantReason {
+				t.Errorf("notification = %s, want event %q with reason %q", attempts[0], tc.wantEvent, tc.wantReason)
+			}
+			if got.Saga.SagaID != "saga-1" || got.Saga.OrderID != state.OrderID.GetId() || got.Saga.PaymentID != state.PaymentID {
+				t.Errorf("notification = %s, want saga-1's IDs %s", attempts[0], state)
+			}
+			if hook.sagaIDs[0] != "saga-1" {
+				t.Errorf("X-Saga-ID = %q, want saga-1", hook.sagaIDs[0])
+			}
+			if got, want := notificationAudit(t, f.orch, "saga-1"), []string{"NOTIFICATION_SENT " + tc.wantEvent}; !slices.Equal(got, want) {
+				t.Errorf("notification audit = %q, want %q", got, want)
+			}
+			if sent, failed := notificationMetrics(t, f.orch); sent != "1" || failed != "0" {
+				t.Errorf("notifications sent %s, failed %s; want 1 and 0", sent, failed)
+			}
+		})
+	}
+}
+
+// TestWebhookNotificationRetries answers the webhook's delivery attempts with
+// the given statuses: 429 and 5xx are retried until the attempts run out,
+// other refusals are not, and a notification given up on is audited and
+// counted as failed while the saga still completes.
+func TestWebhookNotificationRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		statuses      []int
+		wantAttempts  int
+		wantDelivered bool
+	}{
+		{"retried until accepted", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, true},
+		{"gives up", []int{http.StatusServiceUnavailable}, 3, false},
+		{"refused", []int{http.StatusBadRequest}, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := newWebhook(t, tc.statuses...)
+			notifier := orchestrator.NewWebhookNotifier(orchestrator.WebhookConfig{URL: hook.URL, MaxAttempts: 3, Backoff: time.Millisecond})
+			f := newFakeStack(t, orchestrator.WithNotifier(notifier))
+			if _, err := f.run("saga-1"); err != nil {
+				t.Fatalf("saga = %v, want it completed whatever happens to the notification", err)
+			}
+
+			attempts := hook.attempts()
+			if len(attempts) != tc.wantAttempts {
+				t.Errorf("webhook got %d attempts, want %d", len(attempts), tc.wantAttempts)
+			}
+			for _, body := range attempts[1:] {
+				if body != attempts[0] {
+					t.Errorf("retried with %s, want the same body %s", body, attempts[0])
+				}
+			}
+			audit := notificationAudit(t, f.orch, "saga-1")
+			sent, failed := notificationMetrics(t, f.orch)
+			if tc.wantDelivered {
+				if want := []string{"NOTIFICATION_SENT " + orchestrator.NotificationOrderCompleted}; !slices.Equal(audit, want) || sent != "1" || failed != "0" {
+					t.Errorf("audit %q, sent %s, failed %s; want %q, 1 and 0", audit, sent, failed, want)
+				}
+				return
+			}
+			if len(audit) != 1 || !strings.HasPrefix(audit[0], "NOTIFICATION_FAILED "+orchestrator.NotificationOrderCompleted+": ") || sent != "0" || failed != "1" {
+				t.Errorf("audit %q, sent %s, failed %s; want one NOTIFICATION_FAILED, 0 and 1", audit, sent, failed)
+			}
+		})
+	}
+}
@@ -2,14 +2,29 @@ package orchestrator
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/errinfo"
 	"create-order-saga/pkg/grpc_clients"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
 	commonpb "create-order-saga/proto/common"
+	infopb "create-order-saga/proto/info"
 	orderpb "create-order-saga/proto/order"
 	paymentpb "create-order-saga/proto/payment"
 	shippingpb "create-order-saga/proto/shipping"
@@ -17,170 +32,1075 @@ import (
 
 // Orchestrator manages the execution of the Create Order Saga.
 type Orchestrator struct {
-	clients *grpc_clients.ServiceClients
+	clients  Clients
+	audit    AuditStore
+	registry *sagaRegistry
+	clock    clock.Clock
+	ids      ids.Generator
+	events   EventSink
+	failed   FailedOperationQueue
+
+	completions CompletionStore // Succeeded sagas whose order still has to be marked COMPLETED
+
+	compensationConcurrency int                             // Independent compensations run at once; 0 means no limit
+	retryBudget             *grpc_clients.RetryBudgetConfig // Retries shared by a saga's forward calls; nil means per-call limits only
+	dedup                   *sagaDeduper                    // Running and recent sagas by submission; nil disables deduplication
+	limiter                 *sagaLimiter                    // Counts running sagas and bounds them if configured
+	health                  HealthChecker                   // Checks the downstream services for readiness; nil means always ready
+	readiness               readinessCache
+	cancellationWindow      time.Duration // How long after shipping an order can be cancelled; 0 means no limit
+	compensationTimeout     time.Duration // Timeout of each compensation and CompleteOrder call
+	shutdownDeadline        time.Duration // How long compensations may run after CancelAllSagas; 0 means no limit
+	parallelSteps           bool          // Reserve shipping and take the payment concurrently
+	asyncComplete           bool          // Return from a succeeded saga before its order is marked COMPLETED
+	asyncCompletions        asyncCompletionStats
+	notifier                Notifier // Told how each create-order saga ended; nil notifies no one
+	notifications           notificationStats
+
+	buildInfo       *infopb.ServiceInfo            // Reported at GET /info; nil means the plain build information
+	serviceInfo     map[string]*infopb.ServiceInfo // Downstream build information by service name, if known
+	serviceVersions string                         // serviceInfo rendered for audit entries
+
+	// halt is cancelled once the shutdown deadline has passed, abandoning the
+	// compensations still running (see detach)
+	halt     context.Context
+	haltWith context.CancelCauseFunc
+}
+
+// Option configures an Orchestrator.
+type Option func(*Orchestrator)
+
+// WithAuditStore sets where saga audit entries are written (in memory by default).
+func WithAuditStore(store AuditStore) Option {
+	return func(o *Orchestrator) {
+		o.audit = store
+	}
+}
+
+// WithClock sets the clock used for audit timestamps and saga start times
+// (the real clock by default).
+func WithClock(c clock.Clock) Option {
+	return func(o *Orchestrator) {
+		o.clock = c
+	}
+}
+
+// WithIDGenerator sets how saga IDs are generated (random UUIDs, "saga-<uuid>", by default).
+func WithIDGenerator(g ids.Generator) Option {
+	return func(o *Orchestrator) {
+		o.ids = g
+	}
 }
 
-// NewOrchestrator creates a new saga orchestrator.
-func NewOrchestrator(clients *grpc_clients.ServiceClients) *Orchestrator {
-	return &Orchestrator{clients: clients}
+// WithEventSink sets where the saga event log is written (an in-memory ring
+// buffer of DefaultEventBufferSize events by default).
+func WithEventSink(sink EventSink) Option {
+	return func(o *Orchestrator) {
+		o.events = sink
+	}
+}
+
+// WithFailedOperationQueue sets where compensations that could not be applied
+// are queued for follow-up (in memory by default).
+func WithFailedOperationQueue(q FailedOperationQueue) Option {
+	return func(o *Orchestrator) {
+		o.failed = q
+	}
+}
+
+// WithCompletionStore sets where orders that could not be marked as COMPLETED
+// are kept until a background retry succeeds (in memory by default). Use a
+// FileCompletionStore for the backlog to survive a restart.
+func WithCompletionStore(store CompletionStore) Option {
+	return func(o *Orchestrator) {
+		o.completions = store
+	}
+}
+
+// WithCompensationConcurrency limits how many independent compensations run
+// at the same time (no limit by default). Pass 1 to compensate sequentially.
+func WithCompensationConcurrency(n int) Option {
+	return func(o *Orchestrator) {
+		o.compensationConcurrency = n
+	}
+}
+
+// DefaultCompensationTimeout is the default timeout of each compensation call.
+const DefaultCompensationTimeout = 5 * time.Second
+
+// WithCompensationTimeout sets the timeout of each compensation and
+// CompleteOrder call, including the client's retries of it
+// (DefaultCompensationTimeout by default). A call that times out fails like
+// any other: it is recorded and queued for follow-up.
+func WithCompensationTimeout(d time.Duration) Option {
+	return func(o *Orchestrator) {
+		o.compensationTimeout = d
+	}
+}
+
+// WithRetryBudget gives every saga a retry budget shared by all its forward
+// calls (none by default), so retries spent on early steps leave fewer for
+// later ones. A budget already present in the saga's context takes precedence.
+func WithRetryBudget(cfg grpc_clients.RetryBudgetConfig) Option {
+	return func(o *Orchestrator) {
+		o.retryBudget = &cfg
+	}
+}
+
+// NewOrchestrator creates a new saga orchestrator using the real gRPC clients.
+func NewOrchestrator(clients *grpc_clients.ServiceClients, opts ...Option) *Orchestrator {
+	return NewOrchestratorWithClients(ClientsFrom(clients), append([]Option{WithHealthChecker(clients)}, opts...)...)
+}
+
+// NewOrchestratorWithClients creates a saga orchestrator from any implementation
+// of the downstream client interfaces (e.g. fakes in tests).
+func NewOrchestratorWithClients(clients Clients, opts ...Option) *Orchestrator {
+	o := &Orchestrator{
+		clients:  clients,
+		audit:    NewMemoryAuditStore(),
+		registry: newSagaRegistry(),
+		clock:    clock.Real(),
+		ids:      ids.Random(),
+		events:   NewRingBufferEventSink(DefaultEventBufferSize),
+		failed:   NewMemoryFailedOperationQueue(),
+
+		completions: NewMemoryCompletionStore(),
+		limiter:     &sagaLimiter{},
+
+		cancellationWindow:  DefaultCancellationWindow,
+		compensationTimeout: DefaultCompensationTimeout,
+	}
+	o.halt, o.haltWith = context.WithCancelCause(context.Background())
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// GetAuditTrail returns the ordered audit entries recorded for a saga.
+func (o *Orchestrator) GetAuditTrail(sagaID string) ([]AuditEntry, error) {
+	return o.audit.Trail(sagaID)
+}
+
+// FailedOperations returns the operations queued for follow-up, oldest first.
+func (o *Orchestrator) FailedOperations() ([]FailedOperation, error) {
+	return o.failed.Pending()
+}
+
+// Close flushes and closes the audit store, event sink, failed-operation
+// queue and completion store. Call it once no saga is running anymore.
+func (o *Orchestrator) Close() error {
+	return errors.Join(
+		o.audit.Close(),
+		o.events.Close(),
+		o.failed.Close(),
+		o.completions.Close(),
+	)
+}
+
+// record appends an audit entry for the saga identified in ctx. Audit failures
+// are logged but never fail the saga.
+func (o *Orchestrator) record(ctx context.Context, typ AuditEventType, step, detail string) {
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	entry := AuditEntry{SagaID: sagaID, Timestamp: o.clock.Now(), Type: typ, Step: step, Detail: detail}
+	if err := o.audit.Append(entry); err != nil {
+		log.Printf("WARNING: Failed to write audit entry %s/%s for saga %s: %v", typ, step, sagaID, err)
+	}
 }
 
 // SagaState holds the intermediate results during saga execution.
 type SagaState struct {
-	OrderID    *commonpb.OrderID
-	PaymentID  string
-	ShipmentID string
+	SagaID            string
+	ClientReferenceID string // Echoed from the order details; empty if the caller set none
+	OrderID           *commonpb.OrderID
+	OrderNumber       string // Customer-facing number of the order, once created
+	PaymentID         string
+	ShipmentIDs       []string // One per warehouse the order ships from
+	Digital           bool     // The order is DIGITAL, so its saga has no shipping step
+
+	// Set once the saga has finished: its total wall-clock time and the time
+	// spent in each step and compensation that ran, keyed by RPC name.
+	Duration      time.Duration
+	StepDurations map[string]time.Duration
+}
+
+// String renders the saga's IDs compactly for log lines, e.g.
+// "saga=saga-1 order=order-u1 payment=pay-order-u1 shipment=-". IDs not yet
+// assigned (including a nil OrderID) are shown as "-", several shipments are
+// comma-separated, and a client reference is appended as " ref=..." when set.
+func (s *SagaState) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+	out := fmt.Sprintf("saga=%s order=%s payment=%s shipment=%s",
+		orDash(s.SagaID), orDash(s.OrderID.GetId()), orDash(s.PaymentID), orDash(strings.Join(s.ShipmentIDs, ",")))
+	if s.ClientReferenceID != "" {
+		out += " ref=" + s.ClientReferenceID
+	}
+	return out
+}
+
+// MarshalJSON renders the saga's IDs as flat JSON, omitting those not yet
+// assigned (including a nil OrderID), followed by its timings in milliseconds.
+func (s *SagaState) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	var stepMillis map[string]float64
+	if len(s.StepDurations) > 0 {
+		stepMillis = make(map[string]float64, len(s.StepDurations))
+		for step, d := range s.StepDurations {
+			stepMillis[step] = millis(d)
+		}
+	}
+	return json.Marshal(struct {
+		SagaID            string             `json:"saga_id,omitempty"`
+		ClientReferenceID string             `json:"client_reference_id,omitempty"`
+		OrderID           string             `json:"order_id,omitempty"`
+		OrderNumber       string             `json:"order_number,omitempty"`
+		PaymentID         string             `json:"payment_id,omitempty"`
+		ShipmentIDs       []string           `json:"shipment_ids,omitempty"`
+		Digital           bool               `json:"digital,omitempty"`
+		DurationMs        float64            `json:"duration_ms,omitempty"`
+		StepDurationsMs   map[string]float64 `json:"step_durations_ms,omitempty"`
+	}{s.SagaID, s.ClientReferenceID, s.OrderID.GetId(), s.OrderNumber, s.PaymentID, s.ShipmentIDs, s.Digital, millis(s.Duration), stepMillis})
+}
+
+// isDigital reports whether an order is delivered electronically, so its saga
+// skips quoting and arranging shipping.
+func isDigital(details *commonpb.OrderDetails) bool {
+	return details.GetFulfillmentType() == commonpb.FulfillmentType_DIGITAL
+}
+
+func orDash(id string) string {
+	if id == "" {
+		return "-"
+	}
+	return id
 }
 
 // ExecuteCreateOrderSaga runs the distributed transaction for creating an order.
+// The saga ID is taken from ctx (see interceptors.WithSagaID) or generated, and
+// is propagated to every downstream call and audit entry.
 func (o *Orchestrator) ExecuteCreateOrderSaga(ctx context.Context, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo, shippingAddr *commonpb.ShippingAddress) error {
-	log.Println("Starting Create Order Saga...")
-	state := &SagaState{}
-	var err error
+	_, err := o.RunCreateOrderSaga(ctx, details, paymentInfo, shippingAddr)
+	return err
+}
+
+// RunCreateOrderSaga is like ExecuteCreateOrderSaga but also returns the saga's
+// state: its ID and the IDs created by each step. On failure the state holds
+// the IDs of the steps that completed (and were then compensated). With
+// WithDeduplication, a duplicate submission returns the original saga's outcome.
+func (o *Orchestrator) RunCreateOrderSaga(ctx context.Context, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo, shippingAddr *commonpb.ShippingAddress) (*SagaState, error) {
+	if o.dedup != nil {
+		return o.runDeduplicated(ctx, details, paymentInfo, shippingAddr)
+	}
+	return o.runCreateOrderSaga(ctx, details, paymentInfo, shippingAddr)
+}
+
+func (o *Orchestrator) runCreateOrderSaga(ctx context.Context, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo, shippingAddr *commonpb.ShippingAddress) (state *SagaState, err error) {
+	sagaID, ok := interceptors.SagaIDFromContext(ctx)
+	if !ok {
+		sagaID = o.ids.NewID("saga", "")
+		ctx = interceptors.WithSagaID(ctx, sagaID)
+	}
+	release, err := o.acquireSagaSlot(ctx)
+	if err != nil {
+		return &SagaState{SagaID: sagaID, ClientReferenceID: details.GetClientReferenceId()}, err
+	}
+	defer release()
+	if _, ok := grpc_clients.RetryBudgetFromContext(ctx); !ok && o.retryBudget != nil {
+		budget := grpc_clients.NewRetryBudget(*o.retryBudget)
+		ctx = grpc_clients.ContextWithRetryBudget(ctx, budget)
+		defer func() { log.Printf("Saga %s finished with retry budget: %s", sagaID, budget) }()
+	}
+	// Every step and compensation adds its duration to the saga's timings (see logEvent)
+	sagaStart := o.clock.Now()
+	ctx, timings := withStepTimings(ctx)
+	// Compensations must run even if ctx was cancelled, but keep its values (saga ID, tenant, retry budget, timings)
+	compCtx, stopComp := o.detach(ctx)
+	defer stopComp()
+
+	// The customer hears of the outcome last, once completion or compensation is done
+	defer func() { o.notify(compCtx, state, err) }()
+	state = &SagaState{SagaID: sagaID, ClientReferenceID: details.GetClientReferenceId(), Digital: isDigital(details)}
+	defer func() {
+		state.Duration = o.clock.Now().Sub(sagaStart)
+		state.StepDurations = timings.snapshot()
+		log.Printf("Saga %s took %v: %s", sagaID, state.Duration, formatDurations(state.StepDurations))
+	}()
+	if state.ClientReferenceID != "" {
+		log.Printf("Starting Create Order Saga %s for client reference %s...", sagaID, state.ClientReferenceID)
+		o.record(ctx, AuditSagaStarted, "", o.withVersions("client_reference_id="+state.ClientReferenceID))
+	} else {
+		log.Printf("Starting Create Order Saga %s...", sagaID)
+		o.record(ctx, AuditSagaStarted, "", o.withVersions(""))
+	}
+
+	// Register the saga so it can be cancelled externally (see CancelSaga)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	o.registry.add(&runningSaga{id: sagaID, startedAt: o.clock.Now(), cancel: cancel, snapshot: state.clone(), phase: PhaseStarting})
+	defer o.registry.remove(sagaID)
 
 	// --- Step 1: Create Order ---
+	if ctx.Err() != nil {
+		return state, o.abortCancelled(ctx, compCtx, state, "CreateOrder")
+	}
+	// Shipping is charged with the order, so it is priced first; digital orders ship nothing
+	var shippingCost *commonpb.Money
+	if !state.Digital {
+		o.enterPhase(ctx, state, "QuoteShipping")
+		shippingCost, err = o.quoteShipping(ctx, details, shippingAddr)
+		if err != nil {
+			log.Printf("Saga Failed: quoting shipping failed: %v", err)
+			o.record(ctx, AuditSagaFailed, "QuoteShipping", state.String())
+			return state, stepError(ctx, "QuoteShipping", err)
+		}
+	}
 	log.Println("Step 1: Creating Order...")
-	createOrderResp, err := o.clients.Order.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: details})
+	o.enterPhase(ctx, state, "CreateOrder")
+	o.record(ctx, AuditStepStarted, "CreateOrder", "")
+	createOrderSummary := fmt.Sprintf("user=%s items=%d", details.GetUserId(), len(details.GetItems()))
+	start := o.clock.Now()
+	// The request ID is stable for the saga, so a retried CreateOrder never creates a second order
+	createOrderResp, err := o.clients.Order.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		Details:         details,
+		RequestId:       sagaID + "/CreateOrder",
+		ShippingAddress: shippingAddr,
+		ShippingCost:    shippingCost,
+	})
 	if err != nil {
 		log.Printf("Saga Failed: Step 1 (CreateOrder) failed: %v", err)
+		o.record(ctx, AuditStepFailed, "CreateOrder", err.Error())
+		o.logEvent(ctx, EventStepFailed, "CreateOrder", createOrderSummary, nil, start, err)
 		// --- Modified Logic ---
 		// Attempt compensation for consistency, even though order likely wasn't created
-		o.compensateCreateOrder(state.OrderID) // state.OrderID will be nil here
-		return errors.New("failed to create order")
+		compErr := o.compensate(compCtx, state, cancellationReason(ctx, CancelReasonOrderFailed)) // state.OrderID will be nil here
+		o.record(ctx, AuditSagaFailed, "CreateOrder", state.String())
+		return state, withCompensation(stepError(ctx, "CreateOrder", err), compErr)
 	}
 	state.OrderID = createOrderResp.OrderId // ID assigned *after* successful call
+	state.OrderNumber = createOrderResp.GetOrderNumber()
 	log.Printf("Step 1 Success: Order created with ID: %s", state.OrderID.Id)
+	o.record(ctx, AuditStepSucceeded, "CreateOrder", "order_id="+state.OrderID.Id)
+	o.logEvent(ctx, EventStepSucceeded, "CreateOrder", createOrderSummary, map[string]string{"order_id": state.OrderID.Id}, start, nil)
+
+	// --- Step 2: Reserve Shipping (physical orders only) ---
+	// Carrier capacity is held before the payment is taken and only confirmed
+	// once it is, so a declined payment releases a reservation instead of
+	// cancelling a shipment
+	if ctx.Err() != nil {
+		return state, o.abortCancelled(ctx, compCtx, state, "ReserveShipping")
+	}
+	paymentInfo = chargeOrderTotal(paymentInfo, createOrderResp.GetTotal())
+	var shippingSummary string
+	if !state.Digital {
+		shippingSummary = fmt.Sprintf("order=%s city=%s country=%s items=%d", state.OrderID.Id, shippingAddr.GetCity(), shippingAddr.GetCountry(), len(details.GetItems()))
+	}
+	if o.parallelSteps && !state.Digital {
+		// Steps 2 and 3 together; the saga goes on from step 4 once both succeeded
+		if err := o.reserveAndPay(ctx, compCtx, state, details, paymentInfo, shippingAddr, shippingSummary); err != nil {
+			return state, err
+		}
+	} else {
+		if state.Digital {
+			log.Printf("Step 2 Skipped: Order %s is digital, nothing to ship", state.OrderID.Id)
+		} else {
+			o.enterPhase(ctx, state, "ReserveShipping")
+			reserveShippingResp, err := o.reserveShipping(ctx, state.OrderID, details, shippingAddr, shippingSummary)
+			if err != nil {
+				// Shipments reserved before the failure (for other warehouses) must be released too
+				state.ShipmentIDs = partialShipmentIDs(err)
+				// Also attempt to compensate the failed shipping step itself (ShipmentIDs might
+				// be empty here), then the preceding successful steps
+				compErr := o.compensate(compCtx, state, cancellationReason(ctx, CancelReasonShippingFailed))
+				o.record(ctx, AuditSagaFailed, "ReserveShipping", state.String())
+				return state, withCompensation(stepError(ctx, "ReserveShipping", err), compErr)
+			}
+			state.ShipmentIDs = shipmentIDs(reserveShippingResp) // IDs are assigned *after* successful call
+		}
 
-	// --- Step 2: Process Payment ---
-	log.Println("Step 2: Processing Payment...")
-	processPaymentReq := &paymentpb.ProcessPaymentRequest{
-		OrderId:     state.OrderID,
-		PaymentInfo: paymentInfo, // Use the provided payment info
+		// --- Step 3: Process Payment ---
+		if ctx.Err() != nil {
+			return state, o.abortCancelled(ctx, compCtx, state, "ProcessPayment")
+		}
+		o.enterPhase(ctx, state, "ProcessPayment")
+		processPaymentResp, err := o.processPayment(ctx, state.OrderID, details, paymentInfo)
+		if err != nil {
+			// Also attempt to compensate the failed payment step itself (PaymentID might
+			// be empty here), then the preceding successful steps, releasing the
+			// reserved shipping capacity
+			compErr := o.compensate(compCtx, state, cancellationReason(ctx, CancelReasonPaymentFailed))
+			o.record(ctx, AuditSagaFailed, "ProcessPayment", state.String())
+			return state, withCompensation(stepError(ctx, "ProcessPayment", err), compErr)
+		}
+		state.PaymentID = processPaymentResp.PaymentId // ID is assigned *after* successful call
 	}
-	processPaymentResp, err := o.clients.Payment.ProcessPayment(ctx, processPaymentReq)
-	// Check for gRPC error OR explicit failure status in response
-	paymentFailed := err != nil || (processPaymentResp != nil && processPaymentResp.Status == paymentpb.PaymentStatus_FAILED)
 
-	if paymentFailed {
-		log.Printf("Saga Failed: Step 2 (ProcessPayment) failed. Error: %v, Response Status: %s", err, processPaymentResp.GetStatus()) // GetStatus() is safe even if processPaymentResp is nil
-		// --- Modified Logic ---
-		// Also attempt to compensate the failed payment step itself
-		o.compensateProcessPayment(state.OrderID, state.PaymentID) // PaymentID might be empty here
+	// --- Step 4: Confirm Shipping (physical orders only) ---
+	if ctx.Err() != nil {
+		return state, o.abortCancelled(ctx, compCtx, state, "ConfirmShipping")
+	}
+	if !state.Digital {
+		log.Println("Step 4: Confirming Shipping...")
+		o.enterPhase(ctx, state, "ConfirmShipping")
+		o.record(ctx, AuditStepStarted, "ConfirmShipping", "")
+		shipments := strings.Join(state.ShipmentIDs, ",")
+		start = o.clock.Now()
+		_, err := o.clients.Shipping.ConfirmShipping(ctx, &shippingpb.ConfirmShippingRequest{
+			OrderId:     state.OrderID,
+			ShipmentIds: state.ShipmentIDs,
+		})
+		if err != nil {
+			log.Printf("Saga Failed: Step 4 (ConfirmShipping) failed: %v", err)
+			o.record(ctx, AuditStepFailed, "ConfirmShipping", err.Error())
+			o.logEvent(ctx, EventStepFailed, "ConfirmShipping", shippingSummary, nil, start, err)
+			// The payment was taken, so it is refunded along with releasing the shipments
+			compErr := o.compensate(compCtx, state, cancellationReason(ctx, CancelReasonShippingFailed))
+			o.record(ctx, AuditSagaFailed, "ConfirmShipping", state.String())
+			return state, withCompensation(stepError(ctx, "ConfirmShipping", err), compErr)
+		}
+		log.Printf("Step 4 Success: Shipping confirmed for ID(s): %s", shipments)
+		o.record(ctx, AuditStepSucceeded, "ConfirmShipping", "shipment_ids="+shipments)
+		o.logEvent(ctx, EventStepSucceeded, "ConfirmShipping", shippingSummary, map[string]string{"shipment_ids": shipments}, start, nil)
+	}
+
+	// --- Saga Success ---
+	log.Printf("Saga Completed Successfully: %s", state)
+
+	// Final step: Mark the order as completed in the Order service, in the
+	// background if the saga need not wait for it (see WithAsyncComplete)
+	if o.asyncComplete {
+		o.completeOrderAsync(ctx, state.OrderID)
+	} else {
+		o.enterPhase(ctx, state, "CompleteOrder")
+		o.completeOrder(ctx, compCtx, state.OrderID)
+	}
+
+	o.record(ctx, AuditSagaCompleted, "", state.String())
+	return state, nil // Return success even if the final CompleteOrder call failed (core transaction was okay)
+}
+
+// completeOrder marks the order of a succeeded saga as COMPLETED and reports
+// whether it is. ctx carries the saga's values for the audit trail and event
+// log; compCtx is used for the calls. A failure never fails the saga: the
+// completion is retried in the background (see RunCompletionRetrier), or
+// queued for follow-up if retrying cannot help.
+func (o *Orchestrator) completeOrder(ctx, compCtx context.Context, orderID *commonpb.OrderID) bool {
+	log.Printf("Marking Order %s as COMPLETED...", orderID.Id)
+	o.record(ctx, AuditStepStarted, "CompleteOrder", "")
+	completeSummary := "order=" + orderID.Id
+	start := o.clock.Now()
+	completeResp, completeErr := o.callCompleteOrder(compCtx, orderID)
+	if completeErr != nil {
+		o.record(ctx, AuditStepFailed, "CompleteOrder", completeErr.Error())
+		o.logEvent(ctx, EventStepFailed, "CompleteOrder", completeSummary, nil, start, completeErr)
+		if isTransient(completeErr) {
+			log.Printf("ERROR: Saga succeeded, but failed to mark Order %s as COMPLETED; will retry in the background: %v", orderID.Id, completeErr)
+			o.queueCompletion(compCtx, orderID.Id, completeErr)
+		} else {
+			log.Printf("ERROR: Saga succeeded, but failed to mark Order %s as COMPLETED; queued for follow-up: %v", orderID.Id, completeErr)
+			o.escalate(compCtx, "CompleteOrder", orderID.Id, completeErr)
+		}
+		return false
+	}
+	if completeResp.AlreadyApplied {
+		// Should not happen in a single saga run; indicates the order was completed twice.
+		log.Printf("WARNING: Order %s was already COMPLETED (duplicate completion).", orderID.Id)
+		o.record(ctx, AuditStepSucceeded, "CompleteOrder", "already completed")
+	} else {
+		log.Printf("Order %s successfully marked as COMPLETED.", orderID.Id)
+		o.record(ctx, AuditStepSucceeded, "CompleteOrder", "")
+	}
+	o.logEvent(ctx, EventStepSucceeded, "CompleteOrder", completeSummary, nil, start, nil)
+	return true
+}
+
+// ErrCompensationFailed matches a *CompensationError with errors.Is.
+var ErrCompensationFailed = errors.New("compensation failed")
+
+// CompensationError reports every compensation that failed for a saga.
+// Manual intervention may be needed to restore consistency.
+type CompensationError struct {
+	Errs []error
+}
+
+func (e *CompensationError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%v: %s", ErrCompensationFailed, strings.Join(msgs, "; "))
+}
+
+// Is lets errors.Is(err, ErrCompensationFailed) match.
+func (e *CompensationError) Is(target error) bool {
+	return target == ErrCompensationFailed
+}
+
+// Unwrap exposes the individual compensation errors.
+func (e *CompensationError) Unwrap() []error {
+	return e.Errs
+}
+
+// withCompensation appends a compensation failure, if any, to a step error.
+func withCompensation(err, compErr error) error {
+	if compErr == nil {
+		return err
+	}
+	return fmt.Errorf("%w (%w)", err, compErr)
+}
+
+// Sentinels matched with errors.Is by the *StepError of the step that failed a saga.
+var (
+	ErrCreateOrderFailed = errors.New("failed to create order")
+	ErrPaymentFailed     = errors.New("failed to process payment")
+	ErrShippingFailed    = errors.New("failed to arrange shipping")
+)
+
+// stepSentinels maps each forward step to its sentinel.
+var stepSentinels = map[string]error{
+	"CreateOrder":     ErrCreateOrderFailed,
+	"ProcessPayment":  ErrPaymentFailed,
+	"ArrangeShipping": ErrShippingFailed,
+	"ReserveShipping": ErrShippingFailed,
+	"ConfirmShipping": ErrShippingFailed,
+	"QuoteShipping":   ErrShippingFailed, // Shipping could not be priced, so the order was never created
+}
+
+// StepError reports the forward step that failed a saga. It matches the
+// step's sentinel (e.g. ErrPaymentFailed) with errors.Is and unwraps to the
+// underlying error.
+type StepError struct {
+	Step   string                // RPC of the failed step, e.g. "ProcessPayment"
+	Status *status.Status        // Status returned by the downstream service; nil if the step failed without one (e.g. a declined payment)
+	Info   *errdetails.ErrorInfo // Machine-readable reason attached to Status by the service, e.g. OUT_OF_STOCK; nil if none
+	Err    error                 // The step's error, or the saga's cancellation cause if it was cancelled
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%v: %v", stepSentinels[e.Step], e.Err)
+}
+
+// Is lets errors.Is(err, ErrPaymentFailed) and friends match the failed step.
+func (e *StepError) Is(target error) bool {
+	return target == stepSentinels[e.Step]
+}
 
-		// Compensate preceding successful steps (as before)
-		o.compensateCreateOrder(state.OrderID) // Compensate Step 1
-		return errors.New("failed to process payment")
+// Unwrap exposes the underlying error, e.g. ErrSagaCancelled or grpc_clients.ErrCircuitOpen.
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// stepError builds the error returned for a failed step. If the saga was
+// cancelled by an operator or a shutdown, the cancellation is the cause.
+func stepError(ctx context.Context, step string, err error) error {
+	stepErr := &StepError{Step: step, Err: err}
+	if st, ok := status.FromError(err); ok && err != nil {
+		stepErr.Status = st
+		stepErr.Info, _ = errinfo.From(err)
 	}
-	// If successful:
-	state.PaymentID = processPaymentResp.PaymentId // ID is assigned *after* successful call
-	log.Printf("Step 2 Success: Payment processed with ID: %s", state.PaymentID)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrSagaCancelled) || errors.Is(cause, ErrShuttingDown) {
+		stepErr.Err = cause
+	} else if errors.Is(err, grpc_clients.ErrCircuitOpen) {
+		log.Printf("Saga failed fast: %v", err)
+	}
+	return stepErr
+}
 
-	// --- Step 3: Arrange Shipping ---
-	log.Println("Step 3: Arranging Shipping...")
-	arrangeShippingReq := &shippingpb.ArrangeShippingRequest{
-		OrderId: state.OrderID,
-		Address: shippingAddr, // Use the provided shipping address
+// quoteShipping prices shipping the order's items, recording the call like a
+// step. A Shipping service without quotes yields no cost, so the order is
+// charged without shipping.
+func (o *Orchestrator) quoteShipping(ctx context.Context, details *commonpb.OrderDetails, shippingAddr *commonpb.ShippingAddress) (*commonpb.Money, error) {
+	o.record(ctx, AuditStepStarted, "QuoteShipping", "")
+	summary := fmt.Sprintf("city=%s country=%s items=%d", shippingAddr.GetCity(), shippingAddr.GetCountry(), len(details.GetItems()))
+	start := o.clock.Now()
+	req := &shippingpb.QuoteShippingRequest{Address: shippingAddr, Items: details.GetItems()}
+	if currency, err := money.ItemsCurrency(details.GetItems()); err == nil {
+		req.CurrencyCode = currency // Quoted in the order's currency, so it adds up with the items
+	}
+	resp, err := o.clients.Shipping.QuoteShipping(ctx, req)
+	if status.Code(err) == codes.Unimplemented {
+		log.Printf("Shipping service cannot quote; charging the order without shipping: %v", err)
+		o.record(ctx, AuditStepSucceeded, "QuoteShipping", "not supported")
+		return nil, nil
 	}
-	arrangeShippingResp, err := o.clients.Shipping.ArrangeShipping(ctx, arrangeShippingReq)
+	if err != nil {
+		o.record(ctx, AuditStepFailed, "QuoteShipping", err.Error())
+		o.logEvent(ctx, EventStepFailed, "QuoteShipping", summary, nil, start, err)
+		return nil, err
+	}
+	cost := money.Format(resp.GetCost())
+	o.record(ctx, AuditStepSucceeded, "QuoteShipping", "cost="+cost)
+	o.logEvent(ctx, EventStepSucceeded, "QuoteShipping", summary, map[string]string{"cost": cost}, start, nil)
+	return resp.GetCost(), nil
+}
+
+// reserveShipping runs the ReserveShipping step, recording its outcome. The
+// caller compensates a failure.
+func (o *Orchestrator) reserveShipping(ctx context.Context, orderID *commonpb.OrderID, details *commonpb.OrderDetails, shippingAddr *commonpb.ShippingAddress, summary string) (*shippingpb.ArrangeShippingResponse, error) {
+	log.Println("Step 2: Reserving Shipping...")
+	o.record(ctx, AuditStepStarted, "ReserveShipping", "")
+	req := &shippingpb.ArrangeShippingRequest{
+		OrderId: orderID,
+		Address: shippingAddr,       // Use the provided shipping address
+		Items:   details.GetItems(), // Weighed by the Shipping service to pick a carrier
+	}
+	start := o.clock.Now()
+	resp, err := o.clients.Shipping.ReserveShipping(ctx, req)
 	if err != nil {
 		// Check if the error is a gRPC status error (indicating service-level failure)
 		grpcStatus, ok := status.FromError(err)
 		if ok {
-			log.Printf("Saga Failed: Step 3 (ArrangeShipping) failed with gRPC status: %s - %s", grpcStatus.Code(), grpcStatus.Message())
+			log.Printf("Saga Failed: Step 2 (ReserveShipping) failed with gRPC status: %s - %s", grpcStatus.Code(), grpcStatus.Message())
 		} else {
-			log.Printf("Saga Failed: Step 3 (ArrangeShipping) failed with non-gRPC error: %v", err)
+			log.Printf("Saga Failed: Step 2 (ReserveShipping) failed with non-gRPC error: %v", err)
 		}
-		// --- Modified Logic ---
-		// Also attempt to compensate the failed shipping step itself
-		o.compensateArrangeShipping(state.OrderID, state.ShipmentID) // ShipmentID might be empty here
+		o.record(ctx, AuditStepFailed, "ReserveShipping", err.Error())
+		o.logEvent(ctx, EventStepFailed, "ReserveShipping", summary, nil, start, err)
+		return nil, err
+	}
+	shipments := strings.Join(shipmentIDs(resp), ",")
+	log.Printf("Step 2 Success: Shipping reserved with ID(s): %s (carrier %s, cost %s)", shipments, orDash(resp.Carrier), money.Format(resp.Cost))
+	o.record(ctx, AuditStepSucceeded, "ReserveShipping", "shipment_ids="+shipments)
+	o.logEvent(ctx, EventStepSucceeded, "ReserveShipping", summary, map[string]string{"shipment_ids": shipments}, start, nil)
+	return resp, nil
+}
 
-		// Compensate preceding successful steps (as before)
-		o.compensateProcessPayment(state.OrderID, state.PaymentID) // Compensate Step 2
-		o.compensateCreateOrder(state.OrderID)                     // Compensate Step 1
-		return errors.New("failed to arrange shipping")
+// processPayment runs the ProcessPayment step, recording its outcome. A
+// payment that is not SUCCESS is returned as an error along with the
+// response. The caller compensates a failure.
+func (o *Orchestrator) processPayment(ctx context.Context, orderID *commonpb.OrderID, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo) (*paymentpb.ProcessPaymentResponse, error) {
+	log.Println("Step 3: Processing Payment...")
+	o.record(ctx, AuditStepStarted, "ProcessPayment", "")
+	req := &paymentpb.ProcessPaymentRequest{
+		OrderId:        orderID,
+		PaymentInfo:    paymentInfo,        // Use the provided payment info
+		Items:          details.GetItems(), // Listed on the payment's receipt
+		AllowDuplicate: duplicatePaymentAllowed(ctx),
+	}
+	summary := fmt.Sprintf("order=%s amount=%s %s", orderID.Id, money.Format(paymentInfo.GetAmount()), maskPaymentMethod(paymentInfo))
+	start := o.clock.Now()
+	resp, err := o.clients.Payment.ProcessPayment(ctx, req)
+	// Check for gRPC error OR explicit failure status in response. A gRPC error means the
+	// gateways were unavailable; the client never retries ProcessPayment, so a lost response
+	// cannot charge twice. Declines come back as FAILED
+	// Anything but SUCCESS (FAILED, PENDING_REVIEW for amounts over the limit, or
+	// DUPLICATE_SUSPECTED for a likely double submission) fails the saga
+	if err != nil || resp.GetStatus() != paymentpb.PaymentStatus_SUCCESS {
+		log.Printf("Saga Failed: Step 3 (ProcessPayment) failed. Error: %v, Response Status: %s", err, resp.GetStatus()) // GetStatus() is safe even if resp is nil
+		o.record(ctx, AuditStepFailed, "ProcessPayment", fmt.Sprintf("error=%v status=%s", err, resp.GetStatus()))
+		if err == nil && resp.GetDuplicateSuspected() {
+			err = fmt.Errorf("%w: %s", ErrDuplicatePayment, resp.GetMessage())
+		} else if err == nil {
+			err = fmt.Errorf("payment %s: %s", resp.GetStatus(), resp.GetMessage())
+		}
+		o.logEvent(ctx, EventStepFailed, "ProcessPayment", summary, nil, start, err)
+		return resp, err
 	}
-	state.ShipmentID = arrangeShippingResp.ShipmentId // ID is assigned *after* successful call
-	log.Printf("Step 3 Success: Shipping arranged with ID: %s", state.ShipmentID)
+	log.Printf("Step 3 Success: Payment processed with ID: %s", resp.PaymentId)
+	o.record(ctx, AuditStepSucceeded, "ProcessPayment", "payment_id="+resp.PaymentId)
+	o.logEvent(ctx, EventStepSucceeded, "ProcessPayment", summary, map[string]string{"payment_id": resp.PaymentId}, start, nil)
+	return resp, nil
+}
 
-	// --- Saga Success ---
-	log.Printf("Saga Completed Successfully for Order ID: %s", state.OrderID.Id)
+// chargeOrderTotal returns the payment info to charge for an order: the
+// caller's, marked with the order's currency and with the amount replaced by
+// the order's grand total (items, tax and shipping) if the Order service
+// reported one. An amount in another currency is left as it is for the
+// Payment service to refuse: the customer never agreed to pay in the order's.
+func chargeOrderTotal(paymentInfo *commonpb.PaymentInfo, total *orderpb.OrderTotal) *commonpb.PaymentInfo {
+	if paymentInfo == nil || total.GetTotal() == nil {
+		return paymentInfo
+	}
+	charge := proto.Clone(paymentInfo).(*commonpb.PaymentInfo)
+	charge.CurrencyCode = total.GetTotal().GetCurrencyCode()
+	cmp, err := money.Compare(paymentInfo.GetAmount(), total.GetTotal())
+	if err != nil {
+		log.Printf("Not charging the order total %s: the requested %s is in another currency", money.Format(total.GetTotal()), money.Format(paymentInfo.GetAmount()))
+		return charge
+	}
+	if cmp != 0 {
+		log.Printf("Charging the order total %s (subtotal %s + tax %s + shipping %s) instead of the requested %s",
+			money.Format(total.GetTotal()), money.Format(total.GetSubtotal()), money.Format(total.GetTax()), money.Format(total.GetShipping()), money.Format(paymentInfo.GetAmount()))
+	}
+	charge.Amount = total.GetTotal()
+	return charge
+}
 
-	// Final step: Mark the order as completed in the Order service
-	log.Printf("Marking Order %s as COMPLETED...", state.OrderID.Id)
-	completeCtx, completeCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer completeCancel()
-	_, completeErr := o.clients.Order.CompleteOrder(completeCtx, &orderpb.CompleteOrderRequest{OrderId: state.OrderID})
-	if completeErr != nil {
-		// Log this failure, but the core saga succeeded. Might need monitoring/alerting.
-		log.Printf("WARNING: Saga succeeded, but failed to mark Order %s as COMPLETED: %v", state.OrderID.Id, completeErr)
-	} else {
-		log.Printf("Order %s successfully marked as COMPLETED.", state.OrderID.Id)
+// abortCancelled ends a saga whose context was done before step could start:
+// the steps completed so far are compensated under compCtx and a
+// *CancelledError is returned.
+func (o *Orchestrator) abortCancelled(ctx, compCtx context.Context, state *SagaState, step string) error {
+	cause := context.Cause(ctx)
+	log.Printf("Saga Cancelled: %s not started: %v", step, cause)
+	o.record(ctx, AuditStepFailed, step, "not started: "+cause.Error())
+	var completed []string
+	if state.OrderID != nil {
+		completed = append(completed, "CreateOrder")
+	}
+	if len(state.ShipmentIDs) > 0 {
+		completed = append(completed, "ReserveShipping")
 	}
+	if state.PaymentID != "" {
+		completed = append(completed, "ProcessPayment")
+	}
+	var compErr error
+	if len(completed) > 0 {
+		compErr = o.compensate(compCtx, state, cancellationReason(ctx, CancelReasonSagaCancelled))
+	}
+	o.record(ctx, AuditSagaFailed, step, state.String())
+	return withCompensation(&CancelledError{Before: step, Compensated: completed, Cause: cause}, compErr)
+}
 
-	return nil // Return success even if the final CompleteOrder call failed (core transaction was okay)
+// Reasons the orchestrator gives the services when compensating a saga.
+const (
+	CancelReasonOrderFailed    = "order_failed"
+	CancelReasonPaymentFailed  = "payment_failed"
+	CancelReasonShippingFailed = "shipping_failed"
+	CancelReasonSagaCancelled  = "saga_cancelled" // Cancelled through CancelSaga
+	CancelReasonShutdown       = "shutdown"       // Cancelled by CancelAllSagas
+	CancelReasonSagaTimeout    = "saga_timeout"   // The saga's deadline passed
+)
+
+// cancellationReason returns why a saga that failed at a step is being
+// compensated: failedStep, unless the saga was cancelled or timed out.
+func cancellationReason(ctx context.Context, failedStep string) string {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrSagaCancelled):
+		return CancelReasonSagaCancelled
+	case errors.Is(cause, ErrShuttingDown):
+		return CancelReasonShutdown
+	case errors.Is(cause, context.DeadlineExceeded):
+		return CancelReasonSagaTimeout
+	}
+	return failedStep
+}
+
+// compensationCause maps a cancellation reason to the cause sent with every
+// compensation request. A failed CreateOrder has no cause of its own.
+func compensationCause(reason string) commonpb.CompensationCause {
+	switch reason {
+	case CancelReasonPaymentFailed:
+		return commonpb.CompensationCause_PAYMENT_FAILED
+	case CancelReasonShippingFailed:
+		return commonpb.CompensationCause_SHIPPING_FAILED
+	case CancelReasonSagaTimeout:
+		return commonpb.CompensationCause_SAGA_TIMEOUT
+	case CancelReasonSagaCancelled, CancelReasonShutdown, CancelReasonCustomerRequest:
+		return commonpb.CompensationCause_MANUAL
+	default:
+		return commonpb.CompensationCause_COMPENSATION_CAUSE_UNSPECIFIED
+	}
 }
 
 // --- Compensation Functions ---
+// Each takes a context that is never cancelled by the caller but carries the
+// saga's values (saga ID, tenant); the per-call timeout is applied here.
 
-func (o *Orchestrator) compensateCreateOrder(orderID *commonpb.OrderID) {
+// compensate undoes every step recorded in state. Refunding the payment and
+// cancelling the shipment are independent, so they run concurrently (up to
+// the configured compensation concurrency); the order is cancelled last since
+// the other compensations refer to it. Every compensation is attempted and all
+// failures are returned together as a *CompensationError. Every service is
+// told the given reason and its compensationCause.
+func (o *Orchestrator) compensate(ctx context.Context, state *SagaState, reason string) error {
+	o.enterPhase(ctx, state, PhaseCompensating)
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	collect := func(err error) {
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+	}
+
+	var g errgroup.Group
+	if o.compensationConcurrency > 0 {
+		g.SetLimit(o.compensationConcurrency)
+	}
+	shipmentIDs := state.ShipmentIDs
+	if len(shipmentIDs) == 0 && !state.Digital { // A digital order's saga never ships, so there is nothing to skip
+		shipmentIDs = []string{""} // Logs the skipped compensation
+	}
+	for _, shipmentID := range shipmentIDs {
+		g.Go(func() error {
+			collect(o.compensateArrangeShipping(ctx, state.OrderID, shipmentID, reason))
+			return nil // Never abort the group: every compensation must be attempted
+		})
+	}
+	g.Go(func() error {
+		collect(o.compensateProcessPayment(ctx, state.OrderID, state.PaymentID, reason))
+		return nil
+	})
+	_ = g.Wait()
+	collect(o.compensateCreateOrder(ctx, state.OrderID, reason))
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &CompensationError{Errs: errs}
+}
+
+// compensationAttempts is how many times a compensation the service reports
+// as retryable is attempted before giving up.
+const compensationAttempts = 3
+
+// compensationBackoff is the wait before the first retry of a retryable
+// compensation; it doubles with every further attempt.
+const compensationBackoff = 200 * time.Millisecond
+
+// CompensationRejectedError reports a compensation the service answered but
+// did not apply, with the CompensationCode it gave.
+type CompensationRejectedError struct {
+	Code    commonpb.CompensationCode
+	Message string
+}
+
+func (e *CompensationRejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// appliedBy describes when and by what a service says it applied a
+// compensation, e.g. "compensated_at=2024-05-01T10:00:00Z actor=saga-orchestrator",
+// leaving out what it did not report.
+func appliedBy(resp *commonpb.CompensationResponse) string {
+	var parts []string
+	if resp.GetCompensatedAt() != nil {
+		parts = append(parts, "compensated_at="+resp.GetCompensatedAt().AsTime().Format(time.RFC3339Nano))
+	}
+	if resp.GetActor() != "" {
+		parts = append(parts, "actor="+resp.GetActor())
+	}
+	return strings.Join(parts, " ")
+}
+
+// callCompensation invokes a compensation RPC with a per-call timeout. A
+// response without Success is returned as a *CompensationRejectedError and is
+// retried with backoff only if the service marked it retryable; transport
+// errors are already retried by the clients' retry interceptor.
+func (o *Orchestrator) callCompensation(ctx context.Context, step string, call func(context.Context) (*commonpb.CompensationResponse, error)) (*commonpb.CompensationResponse, error) {
+	backoff := compensationBackoff
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, o.compensationTimeout) // Detached from the saga's cancellation
+		resp, err := call(callCtx)
+		cancel()
+		if err != nil && ctx.Err() != nil { // Abandoned at the shutdown deadline
+			return nil, fmt.Errorf("%w: %w", context.Cause(ctx), err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.GetSuccess() {
+			return resp, nil
+		}
+		rejected := &CompensationRejectedError{Code: resp.GetCode(), Message: resp.GetMessage()}
+		if !resp.GetRetryable() || attempt >= compensationAttempts {
+			return resp, rejected
+		}
+		log.Printf("%s attempt %d/%d was rejected (%v), retrying in %v", step, attempt, compensationAttempts, rejected, backoff)
+		select {
+		case <-o.clock.After(backoff):
+		case <-ctx.Done(): // The shutdown deadline passed
+			return resp, fmt.Errorf("%w; not retried: %w", rejected, context.Cause(ctx))
+		}
+		backoff *= 2
+	}
+}
+
+// completeOrderAttempts is how many times CompleteOrder is attempted when it
+// fails with a transient error before the completion is queued for follow-up.
+const completeOrderAttempts = 3
+
+// callCompleteOrder marks the order as completed, retrying transient failures
+// with the same backoff as compensations, or after the wait the error hints
+// at (e.g. when rate limited). Each attempt has its own timeout.
+func (o *Orchestrator) callCompleteOrder(ctx context.Context, orderID *commonpb.OrderID) (*commonpb.CompensationResponse, error) {
+	backoff := compensationBackoff
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, o.compensationTimeout)
+		resp, err := o.clients.Order.CompleteOrder(callCtx, &orderpb.CompleteOrderRequest{OrderId: orderID})
+		cancel()
+		if err == nil || !isTransient(err) || attempt >= completeOrderAttempts {
+			return resp, err
+		}
+		wait := backoff
+		if hint, ok := grpc_clients.RetryDelay(err); ok {
+			wait = hint
+		}
+		log.Printf("CompleteOrder attempt %d/%d for order %s failed (%v), retrying in %v", attempt, completeOrderAttempts, orderID.Id, err, wait)
+		select {
+		case <-o.clock.After(wait):
+		case <-ctx.Done(): // The shutdown deadline passed
+			return resp, err
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether a failed call may succeed if retried.
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// escalate puts an operation that could not be applied (a compensation or the
+// final CompleteOrder) on the failed-operation queue. A missing target (NOT_FOUND) is flagged loudly: the saga believed it
+// existed, so the services disagree about what happened.
+func (o *Orchestrator) escalate(ctx context.Context, step, target string, err error) {
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	op := FailedOperation{SagaID: sagaID, Step: step, Target: target, Error: err.Error(), FailedAt: o.clock.Now()}
+	var rejected *CompensationRejectedError
+	if errors.As(err, &rejected) {
+		op.Code = rejected.Code.String()
+		if rejected.Code == commonpb.CompensationCode_NOT_FOUND {
+			log.Printf("CRITICAL: %s target %s not found for saga %s; escalating for manual review", step, target, sagaID)
+		}
+	}
+	if err := o.failed.Enqueue(op); err != nil {
+		log.Printf("WARNING: Failed to enqueue failed %s for saga %s: %v", step, sagaID, err)
+	}
+}
+
+func (o *Orchestrator) compensateCreateOrder(ctx context.Context, orderID *commonpb.OrderID, reason string) error {
 	// Handle cases where CreateOrder failed before generating an ID
 	if orderID == nil || orderID.Id == "" {
 		log.Printf("Attempting Order compensation, but OrderID was not generated (step failed early). Skipping CancelOrder call.")
-		return // Skip compensation if no ID was generated
+		o.logEvent(ctx, EventCompensationSkipped, "CancelOrder", "", nil, o.clock.Now(), nil)
+		return nil // Skip compensation if no ID was generated
 	}
 
-	log.Printf("Compensating: Cancelling Order %s", orderID.Id)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // Use a background context for compensation
-	defer cancel()
+	log.Printf("Compensating: Cancelling Order %s (reason: %s)", orderID.Id, reason)
+	o.record(ctx, AuditCompensationAttempted, "CancelOrder", "order_id="+orderID.Id+" reason="+reason)
 
-	_, err := o.clients.Order.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: orderID})
+	summary := "order=" + orderID.Id
+	start := o.clock.Now()
+	resp, err := o.callCompensation(ctx, "CancelOrder", func(callCtx context.Context) (*commonpb.CompensationResponse, error) {
+		return o.clients.Order.CancelOrder(callCtx, &orderpb.CancelOrderRequest{OrderId: orderID, Reason: reason, Cause: compensationCause(reason)})
+	})
 	if err != nil {
 		// Log critical error: Compensation failed! Manual intervention might be needed.
 		log.Printf("CRITICAL: Failed to compensate CreateOrder for Order ID %s: %v", orderID.Id, err)
-	} else {
-		log.Printf("Compensation Success: Order %s cancelled.", orderID.Id)
+		o.record(ctx, AuditCompensationFailed, "CancelOrder", err.Error())
+		o.logEvent(ctx, EventCompensationCritical, "CancelOrder", summary, nil, start, err)
+		o.escalate(ctx, "CancelOrder", orderID.Id, err)
+		return fmt.Errorf("CancelOrder %s: %w", orderID.Id, err)
 	}
+	log.Printf("Compensation Success: Order %s cancelled (%s) %s", orderID.Id, resp.GetCode(), appliedBy(resp))
+	o.record(ctx, AuditCompensationSucceeded, "CancelOrder", appliedBy(resp))
+	o.logEvent(ctx, EventCompensationSucceeded, "CancelOrder", summary, nil, start, nil)
+	return nil
 }
 
 // Note: compensateProcessPayment is now also called if ProcessPayment itself fails.
-func (o *Orchestrator) compensateProcessPayment(orderID *commonpb.OrderID, paymentID string) {
+func (o *Orchestrator) compensateProcessPayment(ctx context.Context, orderID *commonpb.OrderID, paymentID, reason string) error {
 	// Handle cases where ProcessPayment failed before generating an ID
 	if paymentID == "" {
-		log.Printf("Attempting Payment compensation for Order %s, but PaymentID was not generated (step failed early). Skipping specific RefundPayment call.", orderID.Id)
+		log.Printf("Attempting Payment compensation for Order %s, but PaymentID was not generated (step failed early). Skipping specific RefundPayment call.", orderID.GetId())
 		// Depending on PaymentService implementation, RefundPayment might handle lookup by OrderID if PaymentID is empty.
-		return // Skip compensation if no ID was generated
+		o.logEvent(ctx, EventCompensationSkipped, "RefundPayment", "order="+orderID.GetId(), nil, o.clock.Now(), nil)
+		return nil // Skip compensation if no ID was generated
 	}
 
-	log.Printf("Compensating: Refunding Payment %s for Order %s", paymentID, orderID.Id)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	log.Printf("Compensating: Refunding Payment %s for Order %s (reason: %s)", paymentID, orderID.Id, reason)
+	o.record(ctx, AuditCompensationAttempted, "RefundPayment", "payment_id="+paymentID+" reason="+reason)
 
-	_, err := o.clients.Payment.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{OrderId: orderID, PaymentId: paymentID})
+	summary := fmt.Sprintf("order=%s payment=%s", orderID.Id, paymentID)
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	start := o.clock.Now()
+	resp, err := o.callCompensation(ctx, "RefundPayment", func(callCtx context.Context) (*commonpb.CompensationResponse, error) {
+		return o.clients.Payment.RefundPayment(callCtx, &paymentpb.RefundPaymentRequest{
+			OrderId:   orderID,
+			PaymentId: paymentID,
+			Reason:    reason,
+			Cause:     compensationCause(reason),
+			// Stable for the saga and payment, so a retried refund is answered from the service's cache
+			RequestId: sagaID + "/RefundPayment/" + paymentID,
+		})
+	})
 	if err != nil {
 		log.Printf("CRITICAL: Failed to compensate ProcessPayment for Order ID %s, Payment ID %s: %v", orderID.Id, paymentID, err)
+		o.record(ctx, AuditCompensationFailed, "RefundPayment", err.Error())
+		o.logEvent(ctx, EventCompensationCritical, "RefundPayment", summary, nil, start, err)
+		o.escalate(ctx, "RefundPayment", paymentID, err)
+		return fmt.Errorf("RefundPayment %s: %w", paymentID, err)
+	}
+	// Success covers payments with nothing to refund; only Refunded says money moved
+	if resp.GetRefunded() {
+		log.Printf("Compensation Success: Payment %s refunded (%s) %s", paymentID, resp.GetCode(), appliedBy(resp))
 	} else {
-		log.Printf("Compensation Success: Payment %s refunded.", paymentID)
+		log.Printf("Compensation Success: Payment %s had nothing to refund (%s: %s) %s", paymentID, resp.GetCode(), resp.GetMessage(), appliedBy(resp))
 	}
+	o.record(ctx, AuditCompensationSucceeded, "RefundPayment", strings.TrimSpace(fmt.Sprintf("refunded=%t %s", resp.GetRefunded(), appliedBy(resp))))
+	o.logEvent(ctx, EventCompensationSucceeded, "RefundPayment", summary, nil, start, nil)
+	return nil
 }
 
-// Note: compensateArrangeShipping is now also called if ArrangeShipping itself fails.
-func (o *Orchestrator) compensateArrangeShipping(orderID *commonpb.OrderID, shipmentID string) {
+// shipmentIDs returns every shipment in an ArrangeShipping response, falling
+// back to shipment_id for services that predate multi-warehouse shipments.
+func shipmentIDs(resp *shippingpb.ArrangeShippingResponse) []string {
+	if ids := resp.GetShipmentIds(); len(ids) > 0 {
+		return slices.Clone(ids)
+	}
+	if id := resp.GetShipmentId(); id != "" {
+		return []string{id}
+	}
+	return nil
+}
+
+// partialShipmentIDs returns the shipments a failed ArrangeShipping created
+// before failing, from its PartialShipmentFailure status detail.
+func partialShipmentIDs(err error) []string {
+	for _, detail := range status.Convert(err).Details() {
+		if partial, ok := detail.(*shippingpb.PartialShipmentFailure); ok {
+			return slices.Clone(partial.GetShipmentIds())
+		}
+	}
+	return nil
+}
+
+// Note: compensateArrangeShipping is now also called if ArrangeShipping itself fails,
+// once per shipment created for the order.
+func (o *Orchestrator) compensateArrangeShipping(ctx context.Context, orderID *commonpb.OrderID, shipmentID, reason string) error {
 	// Handle cases where ArrangeShipping failed before generating an ID
 	if shipmentID == "" {
-		log.Printf("Attempting Shipping compensation for Order %s, but ShipmentID was not generated (step failed early). Skipping specific CancelShipping call.", orderID.Id)
+		log.Printf("Attempting Shipping compensation for Order %s, but ShipmentID was not generated (step failed early). Skipping specific CancelShipping call.", orderID.GetId())
 		// Depending on ShippingService implementation, a different compensation might be needed,
 		// or CancelShipping might handle lookup by OrderID if ShipmentID is empty.
-		return // Skip compensation if no ID was generated
+		o.logEvent(ctx, EventCompensationSkipped, "CancelShipping", "order="+orderID.GetId(), nil, o.clock.Now(), nil)
+		return nil // Skip compensation if no ID was generated
 	}
 
-	log.Printf("Compensating: Cancelling Shipping %s for Order %s", shipmentID, orderID.Id)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	log.Printf("Compensating: Cancelling Shipping %s for Order %s (reason: %s)", shipmentID, orderID.Id, reason)
+	o.record(ctx, AuditCompensationAttempted, "CancelShipping", "shipment_id="+shipmentID+" reason="+reason)
 
-	_, err := o.clients.Shipping.CancelShipping(ctx, &shippingpb.CancelShippingRequest{OrderId: orderID, ShipmentId: shipmentID})
+	summary := fmt.Sprintf("order=%s shipment=%s", orderID.Id, shipmentID)
+	start := o.clock.Now()
+	resp, err := o.callCompensation(ctx, "CancelShipping", func(callCtx context.Context) (*commonpb.CompensationResponse, error) {
+		return o.clients.Shipping.CancelShipping(callCtx, &shippingpb.CancelShippingRequest{
+			OrderId:    orderID,
+			ShipmentId: shipmentID,
+			Reason:     reason,
+			Cause:      compensationCause(reason),
+		})
+	})
 	if err != nil {
 		log.Printf("CRITICAL: Failed to compensate ArrangeShipping for Order ID %s, Shipment ID %s: %v", orderID.Id, shipmentID, err)
-	} else {
-		log.Printf("Compensation Success: Shipment %s cancelled.", shipmentID)
+		o.record(ctx, AuditCompensationFailed, "CancelShipping", err.Error())
+		o.logEvent(ctx, EventCompensationCritical, "CancelShipping", summary, nil, start, err)
+		o.escalate(ctx, "CancelShipping", shipmentID, err)
+		return fmt.Errorf("CancelShipping %s: %w", shipmentID, err)
 	}
+	log.Printf("Compensation Success: Shipment %s cancelled (%s) %s", shipmentID, resp.GetCode(), appliedBy(resp))
+	o.record(ctx, AuditCompensationSucceeded, "CancelShipping", appliedBy(resp))
+	o.logEvent(ctx, EventCompensationSucceeded, "CancelShipping", summary, nil, start, nil)
+	return nil
 }
@@ -0,0 +1,436 @@
+package orchestrator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// fakeStack is an orchestrator wired to fake clients sharing one recorder.
+type fakeStack struct {
+	rec      *fakes.Recorder
+	order    *fakes.OrderClient
+	payment  *fakes.PaymentClient
+	shipping *fakes.ShippingClient
+	orch     *orchestrator.Orchestrator
+}
+
+// newFakeStack returns an orchestrator on fakes whose calls all succeed until
+// scripted otherwise.
+func newFakeStack(t *testing.T, opts ...orchestrator.Option) *fakeStack {
+	t.Helper()
+	rec := fakes.NewRecorder()
+	f := &fakeStack{
+		rec:      rec,
+		order:    fakes.NewOrderClient(rec),
+		payment:  fakes.NewPaymentClient(rec),
+		shipping: fakes.NewShippingClient(rec),
+	}
+	f.orch = orchestrator.NewOrchestratorWithClients(orchestrator.Clients{Order: f.order, Payment: f.payment, Shipping: f.shipping}, opts...)
+	t.Cleanup(func() { f.orch.Close() })
+	return f
+}
+
+// run executes a saga for user-1 under sagaID.
+func (f *fakeStack) run(sagaID string) (*orchestrator.SagaState, error) {
+	ctx := interceptors.WithSagaID(context.Background(), sagaID)
+	return f.orch.RunCreateOrderSaga(ctx, sagatest.SampleOrder("user-1"), sagatest.SamplePayment(), sagatest.SampleAddress())
+}
+
+// holdCreateOrder makes every CreateOrder call announce its request on the
+// returned channel and wait for release (called at the latest when the test
+// ends) before succeeding.
+func (f *fakeStack) holdCreateOrder(t *testing.T) (<-chan *orderpb.CreateOrderRequest, func()) {
+	t.Helper()
+	started := make(chan *orderpb.CreateOrderRequest, 100)
+	gate := make(chan struct{})
+	var once sync.Once
+	release := func() { once.Do(func() { close(gate) }) }
+	t.Cleanup(release)
+	f.order.CreateOrderFunc = func(ctx context.Context, req *orderpb.CreateOrderRequest) (*orderpb.CreateOrderResponse, error) {
+		started <- req
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return &orderpb.CreateOrderResponse{OrderId: &commonpb.OrderID{Id: "order-" + req.GetDetails().GetUserId()}, Status: orderpb.OrderStatus_PENDING}, nil
+	}
+	return started, release
+}
+
+// calls counts the recorded calls of method.
+func (f *fakeStack) calls(method string) int {
+	n := 0
+	for _, m := range f.rec.Methods() {
+		if m == method {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSagaCallSequence(t *testing.T) {
+	f := newFakeStack(t)
+	state, err := f.run("saga-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	want := []string{fakes.QuoteShipping, fakes.CreateOrder, fakes.ReserveShipping, fakes.ProcessPayment, fakes.ConfirmShipping, fakes.CompleteOrder}
+	if got := f.rec.Methods(); !slices.Equal(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+	if state.OrderID.GetId() != "order-user-1" || state.PaymentID != "pay-order-user-1" || !slices.Equal(state.ShipmentIDs, []string{"ship-order-user-1"}) {
+		t.Errorf("state = %s, want the IDs the fakes returned", state)
+	}
+	for _, call := range f.rec.Calls() {
+		if req, ok := call.Request.(*orderpb.CreateOrderRequest); ok && req.GetRequestId() != "saga-1/CreateOrder" {
+			t.Errorf("CreateOrder request ID = %q, want one stable for the saga", req.GetRequestId())
+		}
+	}
+}
+
+// TestSagaStepFailureCompensates fails each forward step in turn and checks
+// the saga undoes exactly the steps that completed before it.
+func TestSagaStepFailureCompensates(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "service down")
+	for _, tc := range []struct {
+		name        string
+		fail        func(*fakeStack)
+		failed      string // Last forward call made
+		wantErr     error
+		wantUndone  []string // Compensations called after it, in any order but CancelOrder last
+		wantPayment bool     // Whether the state records a payment
+	}{
+		{
+			name: "CreateOrder",
+			fail: func(f *fakeStack) {
+				f.order.CreateOrderFunc = fakes.Script[*orderpb.CreateOrderRequest](fakes.Result[*orderpb.CreateOrderResponse]{Err: unavailable})
+			},
+			failed: fakes.CreateOrder, wantErr: orchestrator.ErrCreateOrderFailed,
+		},
+		{
+			name: "ReserveShipping",
+			fail: func(f *fakeStack) {
+				f.shipping.ReserveShippingFunc = fakes.Script[*shippingpb.ArrangeShippingRequest](fakes.Result[*shippingpb.ArrangeShippingResponse]{Err: unavailable})
+			},
+			failed: fakes.ReserveShipping, wantErr: orchestrator.ErrShippingFailed,
+			wantUndone: []string{fakes.CancelOrder},
+		},
+		{
+			name: "payment declined",
+			fail: func(f *fakeStack) {
+				f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+					Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED, Message: "card declined"},
+				})
+			},
+			failed: fakes.ProcessPayment, wantErr: orchestrator.ErrPaymentFailed,
+			wantUndone: []string{fakes.CancelShipping, fakes.CancelOrder},
+		},
+		{
+			name: "ConfirmShipping",
+			fail: func(f *fakeStack) {
+				f.shipping.ConfirmShippingFunc = fakes.Script[*shippingpb.ConfirmShippingRequest](fakes.Result[*shippingpb.ArrangeShippingResponse]{Err: unavailable})
+			},
+			failed: fakes.ConfirmShipping, wantErr: orchestrator.ErrShippingFailed,
+			wantUndone: []string{fakes.CancelShipping, fakes.RefundPayment, fakes.CancelOrder}, wantPayment: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeStack(t)
+			tc.fail(f)
+			state, err := f.run("saga-1")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("saga error = %v, want %v", err, tc.wantErr)
+			}
+			if errors.Is(err, orchestrator.ErrCompensationFailed) {
+				t.Errorf("compensation failed: %v", err)
+			}
+			if (state.PaymentID != "") != tc.wantPayment {
+				t.Errorf("state = %s, payment recorded = %t, want %t", state, state.PaymentID != "", tc.wantPayment)
+			}
+			methods := f.rec.Methods()
+			i := slices.Index(methods, tc.failed)
+			if i < 0 {
+				t.Fatalf("%s was never called: %v", tc.failed, methods)
+			}
+			undone := methods[i+1:]
+			if len(undone) > 0 && undone[len(undone)-1] != fakes.CancelOrder {
+				t.Errorf("compensations %v, want CancelOrder last", undone)
+			}
+			slices.Sort(undone)
+			want := slices.Sorted(slices.Values(tc.wantUndone))
+			if !slices.Equal(undone, want) {
+				t.Errorf("calls after %s = %v, want %v", tc.failed, undone, want)
+			}
+		})
+	}
+}
+
+func TestSagaCompensationFailureEscalated(t *testing.T) {
+	f := newFakeStack(t)
+	f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+		Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED},
+	})
+	f.order.CancelOrderFunc = fakes.Script[*orderpb.CancelOrderRequest](fakes.Result[*commonpb.CompensationResponse]{
+		Err: status.Error(codes.FailedPrecondition, "order is locked"),
+	})
+
+	_, err := f.run("saga-1")
+	if !errors.Is(err, orchestrator.ErrPaymentFailed) || !errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Fatalf("saga error = %v, want ErrPaymentFailed with ErrCompensationFailed", err)
+	}
+	ops, err := f.orch.FailedOperations()
+	if err != nil {
+		t.Fatalf("FailedOperations: %v", err)
+	}
+	if len(ops) != 1 || ops[0].Step != "CancelOrder" || ops[0].Target != "order-user-1" || ops[0].SagaID != "saga-1" {
+		t.Errorf("failed operations = %+v, want the CancelOrder of order-user-1", ops)
+	}
+}
+
+// TestCompensationResponseCodes declines the payment and answers the
+// shipment's cancellation with each kind of CompensationResponse: only a
+// retryable rejection is retried, and any rejection left is escalated with
+// its code.
+func TestCompensationResponseCodes(t *testing.T) {
+	completed := fakes.Result[*commonpb.CompensationResponse]{Resp: &commonpb.CompensationResponse{Success: true, Code: commonpb.CompensationCode_COMPLETED}}
+	rejected := func(code commonpb.CompensationCode, retryable bool) fakes.Result[*commonpb.CompensationResponse] {
+		return fakes.Result[*commonpb.CompensationResponse]{Resp: &commonpb.CompensationResponse{Code: code, Retryable: retryable, Message: code.String()}}
+	}
+	for _, tc := range []struct {
+		name          string
+		responses     []fakes.Result[*commonpb.CompensationResponse]
+		wantCalls     int
+		wantEscalated string // Code of the failed operation queued, if any
+	}{
+		{"completed", []fakes.Result[*commonpb.CompensationResponse]{completed}, 1, ""},
+		{"already done", []fakes.Result[*commonpb.CompensationResponse]{{Resp: &commonpb.CompensationResponse{Success: true, AlreadyApplied: true, Code: commonpb.CompensationCode_ALREADY_DONE}}}, 1, ""},
+		{"retryable, then completed", []fakes.Result[*commonpb.CompensationResponse]{rejected(commonpb.CompensationCode_TRANSIENT_FAILURE, true), completed}, 2, ""},
+		{"retryable every time", []fakes.Result[*commonpb.CompensationResponse]{rejected(commonpb.CompensationCode_TRANSIENT_FAILURE, true)}, 3, "TRANSIENT_FAILURE"},
+		{"not found", []fakes.Result[*commonpb.CompensationResponse]{rejected(commonpb.CompensationCode_NOT_FOUND, false)}, 1, "NOT_FOUND"},
+		{"conflict", []fakes.Result[*commonpb.CompensationResponse]{rejected(commonpb.CompensationCode_CONFLICT, false)}, 1, "CONFLICT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeStack(t)
+			f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+				Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED},
+			})
+			f.shipping.CancelShippingFunc = fakes.Script[*shippingpb.CancelShippingRequest](tc.responses...)
+
+			_, err := f.run("saga-1")
+			if !errors.Is(err, orchestrator.ErrPaymentFailed) {
+				t.Fatalf("saga error = %v, want ErrPaymentFailed", err)
+			}
+			if got := errors.Is(err, orchestrator.ErrCompensationFailed); got != (tc.wantEscalated != "") {
+				t.Errorf("saga error = %v, compensation failed = %t, want %t", err, got, tc.wantEscalated != "")
+			}
+			calls := 0
+			for _, method := range f.rec.Methods() {
+				if method == fakes.CancelShipping {
+					calls++
+				}
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("CancelShipping called %d times, want %d", calls, tc.wantCalls)
+			}
+			ops, _ := f.orch.FailedOperations()
+			switch {
+			case tc.wantEscalated == "" && len(ops) != 0:
+				t.Errorf("failed operations = %+v, want none", ops)
+			case tc.wantEscalated != "" && (len(ops) != 1 || ops[0].Step != "CancelShipping" || ops[0].Code != tc.wantEscalated):
+				t.Errorf("failed operations = %+v, want CancelShipping with code %s", ops, tc.wantEscalated)
+			}
+		})
+	}
+}
+
+// TestSagaCompleteOrderAlreadyCompleted answers CompleteOrder as if the order
+// had been completed before: the saga still succeeds, without escalating,
+// and its audit trail records the duplicate completion.
+func TestSagaCompleteOrderAlreadyCompleted(t *testing.T) {
+	f := newFakeStack(t)
+	f.order.CompleteOrderFunc = fakes.Script[*orderpb.CompleteOrderRequest](fakes.Result[*commonpb.CompensationResponse]{
+		Resp: &commonpb.CompensationResponse{Success: true, AlreadyApplied: true, Code: commonpb.CompensationCode_ALREADY_DONE, Message: "Order already completed"},
+	})
+	if _, err := f.run("saga-1"); err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	trail, err := f.orch.GetAuditTrail("saga-1")
+	if err != nil {
+		t.Fatalf("GetAuditTrail: %v", err)
+	}
+	var completed *orchestrator.AuditEntry
+	for i, e := range trail {
+		if e.Type == orchestrator.AuditStepSucceeded && e.Step == "CompleteOrder" {
+			completed = &trail[i]
+		}
+	}
+	if completed == nil || completed.Detail != "already completed" {
+		t.Errorf("CompleteOrder audit entry = %+v, want it marked already completed", completed)
+	}
+	if ops, _ := f.orch.FailedOperations(); len(ops) != 0 {
+		t.Errorf("failed operations = %+v, want none for a duplicate completion", ops)
+	}
+}
+
+// TestSagaCancelledMidway cancels the saga right after a step succeeds: the
+// next step is never started, and every completed step, shipping included,
+// is compensated and reported.
+func TestSagaCancelledMidway(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		after           string // Step whose success is followed by the cancellation
+		wantBefore      string
+		wantCompensated []string
+		wantNotCalled   string
+	}{
+		{"after ReserveShipping", fakes.ReserveShipping, "ProcessPayment", []string{"CreateOrder", "ReserveShipping"}, fakes.ProcessPayment},
+		{"after ProcessPayment", fakes.ProcessPayment, "ConfirmShipping", []string{"CreateOrder", "ReserveShipping", "ProcessPayment"}, fakes.ConfirmShipping},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeStack(t)
+			const sagaID = "saga-1"
+			cancelSaga := func() {
+				if err := f.orch.CancelSaga(sagaID); err != nil {
+					t.Errorf("CancelSaga: %v", err)
+				}
+			}
+			switch tc.after {
+			case fakes.ReserveShipping:
+				f.shipping.ReserveShippingFunc = func(context.Context, *shippingpb.ArrangeShippingRequest) (*shippingpb.ArrangeShippingResponse, error) {
+					cancelSaga()
+					return &shippingpb.ArrangeShippingResponse{ShipmentId: "ship-1", ShipmentIds: []string{"ship-1"}, Status: shippingpb.ShippingStatus_RESERVED}, nil
+				}
+			case fakes.ProcessPayment:
+				f.payment.ProcessPaymentFunc = func(context.Context, *paymentpb.ProcessPaymentRequest) (*paymentpb.ProcessPaymentResponse, error) {
+					cancelSaga()
+					return &paymentpb.ProcessPaymentResponse{PaymentId: "pay-1", Status: paymentpb.PaymentStatus_SUCCESS}, nil
+				}
+			}
+
+			_, err := f.run(sagaID)
+			var cancelled *orchestrator.CancelledError
+			if !errors.As(err, &cancelled) || !errors.Is(err, orchestrator.ErrSagaCancelled) {
+				t.Fatalf("saga error = %v, want a *CancelledError", err)
+			}
+			if cancelled.Before != tc.wantBefore {
+				t.Errorf("cancelled before %s, want %s", cancelled.Before, tc.wantBefore)
+			}
+			if !slices.Equal(cancelled.Compensated, tc.wantCompensated) {
+				t.Errorf("compensated %v, want %v", cancelled.Compensated, tc.wantCompensated)
+			}
+			methods := f.rec.Methods()
+			if slices.Contains(methods, tc.wantNotCalled) {
+				t.Errorf("%s was called after the cancellation: %v", tc.wantNotCalled, methods)
+			}
+			for _, want := range []string{fakes.CancelShipping, fakes.CancelOrder} {
+				if !slices.Contains(methods, want) {
+					t.Errorf("%s was not called: %v", want, methods)
+				}
+			}
+			if tc.after == fakes.ProcessPayment && !slices.Contains(methods, fakes.RefundPayment) {
+				t.Errorf("payment was not refunded: %v", methods)
+			}
+			for _, call := range f.rec.Calls() {
+				if req, ok := call.Request.(*orderpb.CancelOrderRequest); ok && req.GetCause() != commonpb.CompensationCause_MANUAL {
+					t.Errorf("CancelOrder cause = %s, want MANUAL", req.GetCause())
+				}
+			}
+		})
+	}
+}
+
+// TestSagaStateRendering renders states from empty to fully populated,
+// including the nil OrderID a saga has before CreateOrder succeeds.
+func TestSagaStateRendering(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		state      *orchestrator.SagaState
+		wantString string
+		wantJSON   string
+	}{
+		{"nil", nil, "<nil>", "null"},
+		{"empty", &orchestrator.SagaState{}, "saga=- order=- payment=- shipment=-", "{}"},
+		{
+			"before CreateOrder",
+			&orchestrator.SagaState{SagaID: "saga-1", ClientReferenceID: "ref-9"},
+			"saga=saga-1 order=- payment=- shipment=- ref=ref-9",
+			`{"saga_id":"saga-1","client_reference_id":"ref-9"}`,
+		},
+		{
+			"complete",
+			&orchestrator.SagaState{
+				SagaID:        "saga-1",
+				OrderID:       &commonpb.OrderID{Id: "order-1"},
+				PaymentID:     "pay-1",
+				ShipmentIDs:   []string{"ship-1", "ship-2"},
+				Duration:      1500 * time.Microsecond,
+				StepDurations: map[string]time.Duration{"CreateOrder": time.Millisecond},
+			},
+			"saga=saga-1 order=order-1 payment=pay-1 shipment=ship-1,ship-2",
+			`{"saga_id":"saga-1","order_id":"order-1","payment_id":"pay-1","shipment_ids":["ship-1","ship-2"],"duration_ms":1.5,"step_durations_ms":{"CreateOrder":1}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.state.String(); got != tc.wantString {
+				t.Errorf("String() = %q, want %q", got, tc.wantString)
+			}
+			got, err := json.Marshal(tc.state)
+			if err != nil || string(got) != tc.wantJSON {
+				t.Errorf("json.Marshal = %s, %v; want %s", got, err, tc.wantJSON)
+			}
+		})
+	}
+}
+
+// TestSagaPartialShipmentFailure fails ReserveShipping after two of an order's
+// shipments were created: the saga cancels exactly those two, then the order.
+func TestSagaPartialShipmentFailure(t *testing.T) {
+	f := newFakeStack(t, orchestrator.WithCompensationConcurrency(1))
+	st, err := status.New(codes.Internal, "carrier unavailable for warehouse north").WithDetails(&shippingpb.PartialShipmentFailure{ShipmentIds: []string{"ship-east", "ship-west"}})
+	if err != nil {
+		t.Fatalf("WithDetails: %v", err)
+	}
+	f.shipping.ReserveShippingFunc = fakes.Script[*shippingpb.ArrangeShippingRequest](fakes.Result[*shippingpb.ArrangeShippingResponse]{Err: st.Err()})
+
+	state, err := f.run("saga-1")
+	if !errors.Is(err, orchestrator.ErrShippingFailed) || errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Fatalf("saga error = %v, want ErrShippingFailed with compensation succeeding", err)
+	}
+	if !slices.Equal(state.ShipmentIDs, []string{"ship-east", "ship-west"}) {
+		t.Errorf("saga holds shipments %v, want the two created", state.ShipmentIDs)
+	}
+	var cancelled []string
+	for _, call := range f.rec.Calls() {
+		if call.Method == fakes.CancelShipping {
+			cancelled = append(cancelled, call.Request.(*shippingpb.CancelShippingRequest).GetShipmentId())
+		}
+	}
+	slices.Sort(cancelled)
+	if !slices.Equal(cancelled, []string{"ship-east", "ship-west"}) {
+		t.Errorf("cancelled shipments %v, want ship-east and ship-west", cancelled)
+	}
+	if got := f.calls(fakes.CancelOrder); got != 1 {
+		t.Errorf("CancelOrder called %d times, want 1", got)
+	}
+	if got := f.calls(fakes.ProcessPayment); got != 0 {
+		t.Errorf("ProcessPayment called %d times after shipping failed, want 0", got)
+	}
+}
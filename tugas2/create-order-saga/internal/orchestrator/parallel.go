@@ -0,0 +1,130 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// WithParallelSteps makes a physical order's saga reserve shipping and take
+// the payment at the same time instead of one after the other (false by
+// default), saving a round trip. Shipping is still only confirmed, and the
+// order completed, once both have succeeded. If either fails, the other is
+// cancelled and whatever the two did is compensated. Digital orders are not
+// affected.
+func WithParallelSteps(enabled bool) Option {
+	return func(o *Orchestrator) {
+		o.parallelSteps = enabled
+	}
+}
+
+// reserveAndPay runs the ReserveShipping and ProcessPayment steps concurrently
+// and records their IDs in state. The first step to fail cancels the other;
+// the saga then compensates and the failure is returned.
+//
+// A step cancelled mid-call may have taken effect without its response
+// arriving, so before compensating, the order's shipments and payments are
+// looked up to find what it did. A service still finishing the cancelled call
+// after the lookup can escape it, as with any call that times out.
+func (o *Orchestrator) reserveAndPay(ctx, compCtx context.Context, state *SagaState, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo, shippingAddr *commonpb.ShippingAddress, shippingSummary string) error {
+	log.Println("Steps 2 and 3: Reserving Shipping and Processing Payment concurrently...")
+	o.enterPhase(ctx, state, "ReserveShipping+ProcessPayment")
+
+	var (
+		mu          sync.Mutex
+		failedStep  string // The step that failed first; the other one was cancelled
+		reserveResp *shippingpb.ArrangeShippingResponse
+		paymentResp *paymentpb.ProcessPaymentResponse
+		reserveErr  error
+		paymentErr  error
+	)
+	failed := func(step string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failedStep == "" {
+			failedStep = step
+		}
+	}
+	g, stepCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		if reserveResp, reserveErr = o.reserveShipping(stepCtx, state.OrderID, details, shippingAddr, shippingSummary); reserveErr != nil {
+			failed("ReserveShipping")
+		}
+		return reserveErr
+	})
+	g.Go(func() error {
+		if paymentResp, paymentErr = o.processPayment(stepCtx, state.OrderID, details, paymentInfo); paymentErr != nil {
+			failed("ProcessPayment")
+		}
+		return paymentErr
+	})
+	g.Wait()
+
+	if reserveErr != nil {
+		// Shipments reserved before the failure (for other warehouses) must be released too
+		state.ShipmentIDs = partialShipmentIDs(reserveErr)
+	} else {
+		state.ShipmentIDs = shipmentIDs(reserveResp) // IDs are assigned *after* successful call
+	}
+	if paymentErr == nil {
+		state.PaymentID = paymentResp.PaymentId // ID is assigned *after* successful call
+	}
+	if failedStep == "" {
+		return nil
+	}
+
+	step, err, reason := "ReserveShipping", reserveErr, CancelReasonShippingFailed
+	if failedStep == "ProcessPayment" {
+		step, err, reason = "ProcessPayment", paymentErr, CancelReasonPaymentFailed
+	}
+	log.Printf("Saga Failed: %s failed while running concurrently: %v", step, err)
+	if reserveErr != nil && failedStep != "ReserveShipping" {
+		o.findShipments(compCtx, state)
+	}
+	if paymentErr != nil && failedStep != "ProcessPayment" {
+		o.findPayment(compCtx, state)
+	}
+	compErr := o.compensate(compCtx, state, cancellationReason(ctx, reason))
+	o.record(ctx, AuditSagaFailed, step, state.String())
+	return withCompensation(stepError(ctx, step, err), compErr)
+}
+
+// findShipments adds to state the order's shipments still in effect that a
+// cancelled ReserveShipping call created.
+func (o *Orchestrator) findShipments(ctx context.Context, state *SagaState) {
+	resp, err := o.clients.Shipping.ListShipments(ctx, &shippingpb.ListShipmentsRequest{OrderId: state.OrderID})
+	if err != nil {
+		log.Printf("WARNING: Could not look up shipments of order %s reserved by the cancelled ReserveShipping call: %v", state.OrderID.GetId(), err)
+		return
+	}
+	for _, shipment := range resp.GetShipments() {
+		if shipment.GetStatus() != shippingpb.ShippingStatus_CANCELLED && !slices.Contains(state.ShipmentIDs, shipment.GetId()) {
+			log.Printf("Found shipment %s reserved by the cancelled ReserveShipping call for order %s", shipment.GetId(), state.OrderID.GetId())
+			state.ShipmentIDs = append(state.ShipmentIDs, shipment.GetId())
+		}
+	}
+}
+
+// findPayment records in state the order's payment that a cancelled
+// ProcessPayment call took, if any.
+func (o *Orchestrator) findPayment(ctx context.Context, state *SagaState) {
+	resp, err := o.clients.Payment.ListPayments(ctx, &paymentpb.ListPaymentsRequest{OrderId: state.OrderID})
+	if err != nil {
+		log.Printf("WARNING: Could not look up payments of order %s taken by the cancelled ProcessPayment call: %v", state.OrderID.GetId(), err)
+		return
+	}
+	for _, payment := range resp.GetPayments() {
+		if payment.GetStatus() == paymentpb.PaymentStatus_SUCCESS {
+			log.Printf("Found payment %s taken by the cancelled ProcessPayment call for order %s", payment.GetId(), state.OrderID.GetId())
+			state.PaymentID = payment.GetId()
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+)
+
+// SagaProgress reports one step or compensation of a running saga as soon as
+// it has finished.
+type SagaProgress struct {
+	Seq int `json:"seq"` // 1-based position in the saga's progress, in execution order
+	Event
+}
+
+// ProgressFunc receives a saga's progress. Calls are serialised, so it needs
+// no locking of its own, but it should return quickly: the saga waits for it.
+type ProgressFunc func(SagaProgress)
+
+type progressKey struct{}
+
+// progressReporter numbers and serialises the progress of one saga.
+type progressReporter struct {
+	mu  sync.Mutex
+	seq int
+	fn  ProgressFunc
+}
+
+// WithProgress returns a context whose saga reports every finished step and
+// compensation to fn, e.g. to stream them to a client.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progressReporter{fn: fn})
+}
+
+// reportProgress passes event to the progress callback in ctx, if any.
+func reportProgress(ctx context.Context, event Event) {
+	p, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok || p.fn == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	p.fn(SagaProgress{Seq: p.seq, Event: event})
+}
@@ -0,0 +1,146 @@
+package orchestrator_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	"create-order-saga/pkg/interceptors"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// TestProgressFailedSaga collects the progress of a saga whose payment is
+// declined: every step and compensation is reported once, numbered in the
+// order it finished.
+func TestProgressFailedSaga(t *testing.T) {
+	f := newFakeStack(t, orchestrator.WithCompensationConcurrency(1))
+	f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+		Resp: &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED, Message: "card declined"},
+	})
+	var got []orchestrator.SagaProgress
+	ctx := orchestrator.WithProgress(interceptors.WithSagaID(context.Background(), "saga-1"), func(p orchestrator.SagaProgress) {
+		got = append(got, p)
+	})
+	if _, err := f.orch.RunCreateOrderSaga(ctx, sagatest.SampleOrder("user-1"), sagatest.SamplePayment(), sagatest.SampleAddress()); err == nil {
+		t.Fatal("saga succeeded, want the payment declined")
+	}
+
+	want := []string{
+		"STEP_SUCCEEDED QuoteShipping",
+		"STEP_SUCCEEDED CreateOrder",
+		"STEP_SUCCEEDED ReserveShipping",
+		"STEP_FAILED ProcessPayment",
+		"COMPENSATION_SUCCEEDED CancelShipping",
+		"COMPENSATION_SKIPPED RefundPayment", // Nothing was charged
+		"COMPENSATION_SUCCEEDED CancelOrder",
+	}
+	var steps []string
+	for i, p := range got {
+		steps = append(steps, string(p.Type)+" "+p.Step)
+		if p.Seq != i+1 || p.SagaID != "saga-1" {
+			t.Errorf("progress %d = seq %d of saga %q, want seq %d of saga-1", i, p.Seq, p.SagaID, i+1)
+		}
+	}
+	if !slices.Equal(steps, want) {
+		t.Errorf("progress =\n  %s\nwant\n  %s", strings.Join(steps, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+// sse is one server-sent event.
+type sse struct {
+	event string
+	data  string
+}
+
+// readEvents splits a server-sent event stream into its events.
+func readEvents(t *testing.T, r io.Reader) []sse {
+	t.Helper()
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []sse
+	for _, block := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+		var e sse
+		for _, line := range strings.Split(block, "\n") {
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				e.event = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				e.data = v
+			}
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// TestStreamSagaHTTP posts a saga whose payment is declined to /sagas/stream:
+// its progress arrives in the order of the saga's event log, followed by a
+// failed result.
+func TestStreamSagaHTTP(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithPaymentFailure())
+	srv := httptest.NewServer(h.Orchestrator.HTTPHandler())
+	defer srv.Close()
+
+	details, _ := protojson.Marshal(sagatest.SampleOrder("user-1"))
+	payment, _ := protojson.Marshal(sagatest.SamplePayment())
+	address, _ := protojson.Marshal(sagatest.SampleAddress())
+	body := `{"details":` + string(details) + `,"payment_info":` + string(payment) + `,"shipping_address":` + string(address) + `}`
+	resp, err := http.Post(srv.URL+"/sagas/stream", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := readEvents(t, resp.Body)
+	if len(events) < 2 {
+		t.Fatalf("stream has %d events, want progress and a result", len(events))
+	}
+
+	var streamed []orchestrator.SagaProgress
+	for _, e := range events[:len(events)-1] {
+		var p orchestrator.SagaProgress
+		if e.event != "progress" || json.Unmarshal([]byte(e.data), &p) != nil {
+			t.Fatalf("event %+v, want progress events before the result", e)
+		}
+		streamed = append(streamed, p)
+	}
+	var result struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	if last := events[len(events)-1]; last.event != "result" || json.Unmarshal([]byte(last.data), &result) != nil || result.Success || result.Error == "" {
+		t.Fatalf("last event = %+v, want a failed result", last)
+	}
+
+	logged, err := h.Orchestrator.WatchSaga(context.Background(), streamed[0].SagaID)
+	if err != nil {
+		t.Fatalf("WatchSaga: %v", err)
+	}
+	var want []string
+	for p := range logged {
+		want = append(want, p.Step)
+	}
+	var got []string
+	for i, p := range streamed {
+		got = append(got, p.Step)
+		if p.Seq != i+1 {
+			t.Errorf("progress %d has seq %d, want %d", i, p.Seq, i+1)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("streamed %v, want the event log's order %v", got, want)
+	}
+	if got[len(got)-1] != "CancelOrder" {
+		t.Errorf("last progress is %s, want the order cancelled last", got[len(got)-1])
+	}
+}
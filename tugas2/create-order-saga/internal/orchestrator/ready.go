@@ -0,0 +1,111 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"create-order-saga/pkg/grpc_clients"
+)
+
+// Readiness checks are cached for readinessCacheTTL so frequent probes do not
+// hammer the services; each service gets readinessTimeout to answer.
+const (
+	readinessCacheTTL = 2 * time.Second
+	readinessTimeout  = time.Second
+)
+
+// HealthChecker checks whether a downstream service is ready to take calls,
+// returning an error describing why not. *grpc_clients.ServiceClients
+// implements it with the services' gRPC health checks.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context, service string) error
+}
+
+// WithHealthChecker sets how readiness checks the downstream services.
+// NewOrchestrator uses its gRPC clients; without a checker the orchestrator
+// always reports ready.
+func WithHealthChecker(h HealthChecker) Option {
+	return func(o *Orchestrator) {
+		o.health = h
+	}
+}
+
+// Readiness statuses, see Readiness.
+const (
+	StatusReady    = "READY"
+	StatusNotReady = "NOT_READY"
+)
+
+// Readiness is the outcome of checking every downstream service.
+type Readiness struct {
+	Status    string            `json:"status"`              // StatusReady if every service is ready, StatusNotReady otherwise
+	NotReady  []string          `json:"not_ready,omitempty"` // Services that are not ready, in saga step order
+	Errors    map[string]string `json:"errors,omitempty"`    // Why each of them is not ready
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+// readinessCache holds the last readiness result.
+type readinessCache struct {
+	mu   sync.Mutex
+	last *Readiness
+}
+
+// Ready reports whether all three downstream services are reachable and
+// serving, naming those that are not. Results are cached briefly.
+func (o *Orchestrator) Ready(ctx context.Context) Readiness {
+	o.readiness.mu.Lock()
+	defer o.readiness.mu.Unlock() // Concurrent probes wait for one check rather than each making their own
+	now := o.clock.Now()
+	if last := o.readiness.last; last != nil && now.Sub(last.CheckedAt) < readinessCacheTTL {
+		return *last
+	}
+
+	services := []string{grpc_clients.OrderService, grpc_clients.PaymentService, grpc_clients.ShippingService}
+	errs := make([]error, len(services))
+	if o.health != nil {
+		var wg sync.WaitGroup
+		for i, service := range services {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+				defer cancel()
+				errs[i] = o.health.CheckHealth(checkCtx, service)
+			}()
+		}
+		wg.Wait()
+	}
+
+	r := &Readiness{Status: StatusReady, CheckedAt: now}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if r.Errors == nil {
+			r.Status, r.Errors = StatusNotReady, make(map[string]string)
+		}
+		r.NotReady = append(r.NotReady, services[i])
+		r.Errors[services[i]] = err.Error()
+	}
+	if r.Status != StatusReady {
+		log.Printf("Orchestrator not ready: %v", r.Errors)
+	}
+	o.readiness.last = r
+	return *r
+}
+
+// handleReady reports readiness as JSON: 200 if ready, 503 otherwise.
+func (o *Orchestrator) handleReady(w http.ResponseWriter, r *http.Request) {
+	readiness := o.Ready(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if readiness.Status != StatusReady {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(readiness); err != nil {
+		log.Printf("Writing readiness: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package orchestrator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/server"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients"
+	orderpb "create-order-saga/proto/order"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// TestReadyNamesUnavailableService runs health checks for the Order and
+// Shipping services, leaves the Payment service unreachable, and checks
+// readiness is NOT_READY naming only the Payment service, both from Ready
+// and from GET /readyz. Shipping then stops serving and is named too.
+func TestReadyNamesUnavailableService(t *testing.T) {
+	listeners := make(map[string]*bufconn.Listener)
+	var shippingHealth *health.Server
+	for service, name := range map[string]string{
+		grpc_clients.OrderService:    orderpb.OrderService_ServiceDesc.ServiceName,
+		grpc_clients.ShippingService: shippingpb.ShippingService_ServiceDesc.ServiceName,
+	} {
+		lis := bufconn.Listen(1 << 20)
+		s := server.NewGRPCServer(server.Config{})
+		if hs := server.RegisterHealth(s, name); service == grpc_clients.ShippingService {
+			shippingHealth = hs
+		}
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+		listeners[service] = lis
+	}
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		lis, ok := listeners[addr]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		return lis.DialContext(ctx)
+	}
+	clients, err := grpc_clients.NewServiceClients(
+		"passthrough:///"+grpc_clients.OrderService,
+		"passthrough:///"+grpc_clients.PaymentService,
+		"passthrough:///"+grpc_clients.ShippingService,
+		grpc_clients.WithDialOptions(grpc.WithContextDialer(dialer)),
+	)
+	if err != nil {
+		t.Fatalf("NewServiceClients: %v", err)
+	}
+	t.Cleanup(func() { clients.Close() })
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	o := orchestrator.NewOrchestrator(clients, orchestrator.WithClock(fake))
+	t.Cleanup(func() { o.Close() })
+
+	r := o.Ready(context.Background())
+	if r.Status != orchestrator.StatusNotReady || !slices.Equal(r.NotReady, []string{grpc_clients.PaymentService}) {
+		t.Fatalf("Ready = %+v, want NOT_READY naming only payment", r)
+	}
+	if msg := r.Errors[grpc_clients.PaymentService]; !strings.Contains(msg, "payment service") || !strings.Contains(msg, "unreachable") {
+		t.Errorf("payment error = %q, want it reported unreachable", msg)
+	}
+
+	srv := httptest.NewServer(o.HTTPHandler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body orchestrator.Readiness
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("GET /readyz = %s, %v; want 503 with a JSON body", resp.Status, err)
+	}
+	if body.Status != orchestrator.StatusNotReady || !slices.Equal(body.NotReady, []string{grpc_clients.PaymentService}) {
+		t.Errorf("GET /readyz body = %+v, want NOT_READY naming payment", body)
+	}
+
+	shippingHealth.SetServingStatus(shippingpb.ShippingService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	fake.Advance(3 * time.Second) // Past the cached result
+	r = o.Ready(context.Background())
+	if want := []string{grpc_clients.PaymentService, grpc_clients.ShippingService}; !slices.Equal(r.NotReady, want) {
+		t.Errorf("NotReady = %v, want %v", r.NotReady, want)
+	}
+	if msg := r.Errors[grpc_clients.ShippingService]; !strings.Contains(msg, "not serving") {
+		t.Errorf("shipping error = %q, want it reported not serving", msg)
+	}
+}
+
+// countingChecker fails the services in down and counts the checks made.
+type countingChecker struct {
+	mu     sync.Mutex
+	down   map[string]bool
+	checks int
+}
+
+func (c *countingChecker) CheckHealth(_ context.Context, service string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks++
+	if c.down[service] {
+		return errors.New(service + " down")
+	}
+	return nil
+}
+
+// TestReadyCached checks readiness is checked once per cache period however
+// often it is asked for, and picks up a recovered service after it.
+func TestReadyCached(t *testing.T) {
+	checker := &countingChecker{down: map[string]bool{grpc_clients.ShippingService: true}}
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	f := newFakeStack(t, orchestrator.WithHealthChecker(checker), orchestrator.WithClock(fake))
+
+	for range 5 {
+		if r := f.orch.Ready(context.Background()); r.Status != orchestrator.StatusNotReady || !slices.Equal(r.NotReady, []string{grpc_clients.ShippingService}) {
+			t.Fatalf("Ready = %+v, want NOT_READY naming shipping", r)
+		}
+		fake.Advance(300 * time.Millisecond)
+	}
+	if checker.checks != 3 {
+		t.Errorf("%d health checks within the cache period, want one per service", checker.checks)
+	}
+
+	checker.mu.Lock()
+	checker.down = nil
+	checker.mu.Unlock()
+	fake.Advance(time.Second)
+	if r := f.orch.Ready(context.Background()); r.Status != orchestrator.StatusReady || len(r.NotReady) != 0 || !r.CheckedAt.Equal(fake.Now()) {
+		t.Errorf("Ready after the cache expired = %+v, want READY checked now", r)
+	}
+	if checker.checks != 6 {
+		t.Errorf("%d health checks, want the services checked again", checker.checks)
+	}
+}
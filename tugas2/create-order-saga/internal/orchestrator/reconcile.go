@@ -0,0 +1,161 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// ViolationKind names an inconsistency Reconcile looks for.
+type ViolationKind string
+
+const (
+	ViolationCancelledCharged      ViolationKind = "CANCELLED_ORDER_CHARGED"         // A cancelled order still has a charged payment
+	ViolationCancelledShipped      ViolationKind = "CANCELLED_ORDER_SHIPMENT_ACTIVE" // A cancelled order still has a shipment that is not cancelled or returned
+	ViolationCompletedNotCharged   ViolationKind = "COMPLETED_ORDER_NOT_CHARGED"     // A completed order has no charged payment
+	ViolationCompletedChargedTwice ViolationKind = "COMPLETED_ORDER_CHARGED_TWICE"   // A completed order has more than one charged payment
+	ViolationCompletedNotShipped   ViolationKind = "COMPLETED_ORDER_NOT_SHIPPED"     // A completed physical order has no live shipment
+	ViolationCompletedShippedTwice ViolationKind = "COMPLETED_ORDER_SHIPPED_TWICE"   // A completed order has two live shipments from one warehouse
+)
+
+// ReconciliationViolation is one inconsistency between an order and its
+// payments or shipments.
+type ReconciliationViolation struct {
+	Kind        ViolationKind `json:"kind"`
+	OrderID     string        `json:"order_id"`
+	OrderStatus string        `json:"order_status"`
+	PaymentIDs  []string      `json:"payment_ids,omitempty"`  // The payments involved
+	ShipmentIDs []string      `json:"shipment_ids,omitempty"` // The shipments involved
+}
+
+// ReconciliationReport lists every violation Reconcile found.
+type ReconciliationReport struct {
+	OrdersChecked int                       `json:"orders_checked"`
+	Violations    []ReconciliationViolation `json:"violations"`
+}
+
+// Consistent reports whether no violations were found.
+func (r *ReconciliationReport) Consistent() bool {
+	return len(r.Violations) == 0
+}
+
+// reconcilePageSize is how many orders Reconcile asks for at a time.
+const reconcilePageSize = 100
+
+// Reconcile checks that the orders in the caller's tenant that reached a
+// final status agree with their payments and shipments: a CANCELLED order
+// has no charged payment and no active shipment, and a COMPLETED order has
+// exactly one charged payment and, unless it is digital, one live shipment
+// per warehouse it ships from. Archived orders are checked too. An error is
+// returned if a service could not be asked, with the violations found so far.
+func (o *Orchestrator) Reconcile(ctx context.Context) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{Violations: []ReconciliationViolation{}}
+	req := &orderpb.ListOrdersRequest{
+		Statuses:        []orderpb.OrderStatus{orderpb.OrderStatus_CANCELLED, orderpb.OrderStatus_COMPLETED},
+		IncludeArchived: true,
+		PageSize:        reconcilePageSize,
+	}
+	for {
+		page, err := o.clients.Order.ListOrders(ctx, req)
+		if err != nil {
+			return report, fmt.Errorf("ListOrders: %w", err)
+		}
+		for _, order := range page.GetOrders() {
+			if err := o.reconcileOrder(ctx, order, report); err != nil {
+				return report, err
+			}
+			report.OrdersChecked++
+		}
+		if page.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = page.GetNextPageToken()
+	}
+	if report.Consistent() {
+		log.Printf("Reconciliation checked %d order(s): consistent", report.OrdersChecked)
+	} else {
+		log.Printf("WARNING: Reconciliation checked %d order(s): %d violation(s)", report.OrdersChecked, len(report.Violations))
+	}
+	return report, nil
+}
+
+// reconcileOrder adds the violations of one order to report.
+func (o *Orchestrator) reconcileOrder(ctx context.Context, order *orderpb.Order, report *ReconciliationReport) error {
+	id := &commonpb.OrderID{Id: order.GetId()}
+	payments, err := o.clients.Payment.ListPayments(ctx, &paymentpb.ListPaymentsRequest{OrderId: id})
+	if err != nil {
+		return fmt.Errorf("ListPayments %s: %w", order.GetId(), err)
+	}
+	shipments, err := o.clients.Shipping.ListShipments(ctx, &shippingpb.ListShipmentsRequest{OrderId: id})
+	if err != nil {
+		return fmt.Errorf("ListShipments %s: %w", order.GetId(), err)
+	}
+
+	var charged []string
+	for _, payment := range payments.GetPayments() {
+		if isCharged(payment.GetStatus()) {
+			charged = append(charged, payment.GetId())
+		}
+	}
+	var active []string
+	byWarehouse := make(map[string][]string)
+	for _, shipment := range shipments.GetShipments() {
+		if isActiveShipment(shipment.GetStatus()) {
+			active = append(active, shipment.GetId())
+			byWarehouse[shipment.GetWarehouse()] = append(byWarehouse[shipment.GetWarehouse()], shipment.GetId())
+		}
+	}
+
+	add := func(kind ViolationKind, paymentIDs, shipmentIDs []string) {
+		log.Printf("WARNING: Reconciliation: order %s (%s): %s", order.GetId(), order.GetStatus(), kind)
+		report.Violations = append(report.Violations, ReconciliationViolation{
+			Kind: kind, OrderID: order.GetId(), OrderStatus: order.GetStatus().String(), PaymentIDs: paymentIDs, ShipmentIDs: shipmentIDs,
+		})
+	}
+	switch order.GetStatus() {
+	case orderpb.OrderStatus_CANCELLED:
+		if len(charged) > 0 {
+			add(ViolationCancelledCharged, charged, nil)
+		}
+		if len(active) > 0 {
+			add(ViolationCancelledShipped, nil, active)
+		}
+	case orderpb.OrderStatus_COMPLETED:
+		switch {
+		case len(charged) == 0:
+			add(ViolationCompletedNotCharged, nil, nil)
+		case len(charged) > 1:
+			add(ViolationCompletedChargedTwice, charged, nil)
+		}
+		if order.GetFulfillmentType() == commonpb.FulfillmentType_DIGITAL {
+			break
+		}
+		if len(active) == 0 {
+			add(ViolationCompletedNotShipped, nil, nil)
+		}
+		for _, warehouse := range slices.Sorted(maps.Keys(byWarehouse)) {
+			if ids := byWarehouse[warehouse]; len(ids) > 1 {
+				add(ViolationCompletedShippedTwice, nil, ids)
+			}
+		}
+	}
+	return nil
+}
+
+// isCharged reports whether a payment in status holds the customer's money.
+func isCharged(status paymentpb.PaymentStatus) bool {
+	return status == paymentpb.PaymentStatus_SUCCESS || status == paymentpb.PaymentStatus_PARTIALLY_REFUNDED
+}
+
+// isActiveShipment reports whether a shipment in status is, or will be, on
+// its way to the customer.
+func isActiveShipment(status shippingpb.ShippingStatus) bool {
+	return status != shippingpb.ShippingStatus_CANCELLED && status != shippingpb.ShippingStatus_RETURNED
+}
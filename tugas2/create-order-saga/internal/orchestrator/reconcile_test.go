@@ -0,0 +1,217 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// reconcileFixture is an order seeded into the fake services, with the
+// payments and shipments listed for it.
+type reconcileFixture struct {
+	order     *orderpb.Order
+	payments  []*paymentpb.Payment
+	shipments []*shippingpb.Shipment
+}
+
+// seedReconcile makes the fake services list fixtures, pageSize orders at a
+// time, and returns the ListOrders requests they were asked.
+func seedReconcile(t *testing.T, f *fakeStack, pageSize int, fixtures ...reconcileFixture) *[]*orderpb.ListOrdersRequest {
+	t.Helper()
+	var requests []*orderpb.ListOrdersRequest
+	byOrder := make(map[string]reconcileFixture)
+	for _, fx := range fixtures {
+		byOrder[fx.order.GetId()] = fx
+	}
+	f.order.ListOrdersFunc = func(_ context.Context, req *orderpb.ListOrdersRequest) (*orderpb.ListOrdersResponse, error) {
+		requests = append(requests, req)
+		start := 0
+		if req.GetPageToken() != "" {
+			start, _ = strconv.Atoi(req.GetPageToken())
+		}
+		end := min(start+pageSize, len(fixtures))
+		resp := &orderpb.ListOrdersResponse{}
+		for _, fx := range fixtures[start:end] {
+			resp.Orders = append(resp.Orders, fx.order)
+		}
+		if end < len(fixtures) {
+			resp.NextPageToken = strconv.Itoa(end)
+		}
+		return resp, nil
+	}
+	f.payment.ListPaymentsFunc = func(_ context.Context, req *paymentpb.ListPaymentsRequest) (*paymentpb.ListPaymentsResponse, error) {
+		return &paymentpb.ListPaymentsResponse{Payments: byOrder[req.GetOrderId().GetId()].payments}, nil
+	}
+	f.shipping.ListShipmentsFunc = func(_ context.Context, req *shippingpb.ListShipmentsRequest) (*shippingpb.ListShipmentsResponse, error) {
+		return &shippingpb.ListShipmentsResponse{Shipments: byOrder[req.GetOrderId().GetId()].shipments}, nil
+	}
+	return &requests
+}
+
+func reconcileOrder(id string, st orderpb.OrderStatus) *orderpb.Order {
+	return &orderpb.Order{Id: id, Status: st}
+}
+
+func reconcilePayment(id string, st paymentpb.PaymentStatus) *paymentpb.Payment {
+	return &paymentpb.Payment{Id: id, Status: st}
+}
+
+func reconcileShipment(id, warehouse string, st shippingpb.ShippingStatus) *shippingpb.Shipment {
+	return &shippingpb.Shipment{Id: id, Warehouse: warehouse, Status: st}
+}
+
+// TestReconcileViolations seeds the fake services with consistent orders and
+// one order for each violation, listed over several pages, and checks
+// Reconcile reports exactly those violations with the records involved.
+func TestReconcileViolations(t *testing.T) {
+	const (
+		cancelled = orderpb.OrderStatus_CANCELLED
+		completed = orderpb.OrderStatus_COMPLETED
+	)
+	digital := reconcileOrder("digital", completed)
+	digital.FulfillmentType = commonpb.FulfillmentType_DIGITAL
+	f := newFakeStack(t)
+	requests := seedReconcile(t, f, 3,
+		reconcileFixture{
+			order:     reconcileOrder("cancelled-ok", cancelled),
+			payments:  []*paymentpb.Payment{reconcilePayment("pay-1", paymentpb.PaymentStatus_REFUNDED), reconcilePayment("pay-2", paymentpb.PaymentStatus_FAILED)},
+			shipments: []*shippingpb.Shipment{reconcileShipment("ship-1", "east", shippingpb.ShippingStatus_CANCELLED), reconcileShipment("ship-2", "east", shippingpb.ShippingStatus_RETURNED)},
+		},
+		reconcileFixture{
+			order:     reconcileOrder("completed-ok", completed),
+			payments:  []*paymentpb.Payment{reconcilePayment("pay-3", paymentpb.PaymentStatus_PARTIALLY_REFUNDED), reconcilePayment("pay-4", paymentpb.PaymentStatus_FAILED)},
+			shipments: []*shippingpb.Shipment{reconcileShipment("ship-3", "east", shippingpb.ShippingStatus_DELIVERED), reconcileShipment("ship-4", "west", shippingpb.ShippingStatus_SHIPPED)},
+		},
+		reconcileFixture{order: digital, payments: []*paymentpb.Payment{reconcilePayment("pay-5", paymentpb.PaymentStatus_SUCCESS)}},
+		reconcileFixture{
+			order:    reconcileOrder("cancelled-charged", cancelled),
+			payments: []*paymentpb.Payment{reconcilePayment("pay-6", paymentpb.PaymentStatus_SUCCESS), reconcilePayment("pay-7", paymentpb.PaymentStatus_REFUNDED)},
+		},
+		reconcileFixture{
+			order:     reconcileOrder("cancelled-shipped", cancelled),
+			shipments: []*shippingpb.Shipment{reconcileShipment("ship-5", "east", shippingpb.ShippingStatus_IN_TRANSIT), reconcileShipment("ship-6", "west", shippingpb.ShippingStatus_CANCELLED)},
+		},
+		reconcileFixture{
+			order:     reconcileOrder("completed-unpaid", completed),
+			payments:  []*paymentpb.Payment{reconcilePayment("pay-8", paymentpb.PaymentStatus_REFUNDED)},
+			shipments: []*shippingpb.Shipment{reconcileShipment("ship-7", "east", shippingpb.ShippingStatus_SHIPPED)},
+		},
+		reconcileFixture{
+			order:     reconcileOrder("completed-paid-twice", completed),
+			payments:  []*paymentpb.Payment{reconcilePayment("pay-9", paymentpb.PaymentStatus_SUCCESS), reconcilePayment("pay-10", paymentpb.PaymentStatus_SUCCESS)},
+			shipments: []*shippingpb.Shipment{reconcileShipment("ship-8", "east", shippingpb.ShippingStatus_SHIPPED)},
+		},
+		reconcileFixture{
+			order:     reconcileOrder("completed-unshipped", completed),
+			payments:  []*paymentpb.Payment{reconcilePayment("pay-11", paymentpb.PaymentStatus_SUCCESS)},
+			shipments: []*shippingpb.Shipment{reconcileShipment("ship-9", "east", shippingpb.ShippingStatus_CANCELLED)},
+		},
+		reconcileFixture{
+			order:    reconcileOrder("completed-shipped-twice", completed),
+			payments: []*paymentpb.Payment{reconcilePayment("pay-12", paymentpb.PaymentStatus_SUCCESS)},
+			shipments: []*shippingpb.Shipment{
+				reconcileShipment("ship-10", "west", shippingpb.ShippingStatus_SHIPPED),
+				reconcileShipment("ship-11", "east", shippingpb.ShippingStatus_RESERVED),
+				reconcileShipment("ship-12", "east", shippingpb.ShippingStatus_PENDING),
+			},
+		},
+	)
+
+	report, err := f.orch.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := []orchestrator.ReconciliationViolation{
+		{Kind: orchestrator.ViolationCancelledCharged, OrderID: "cancelled-charged", OrderStatus: "CANCELLED", PaymentIDs: []string{"pay-6"}},
+		{Kind: orchestrator.ViolationCancelledShipped, OrderID: "cancelled-shipped", OrderStatus: "CANCELLED", ShipmentIDs: []string{"ship-5"}},
+		{Kind: orchestrator.ViolationCompletedNotCharged, OrderID: "completed-unpaid", OrderStatus: "COMPLETED"},
+		{Kind: orchestrator.ViolationCompletedChargedTwice, OrderID: "completed-paid-twice", OrderStatus: "COMPLETED", PaymentIDs: []string{"pay-9", "pay-10"}},
+		{Kind: orchestrator.ViolationCompletedNotShipped, OrderID: "completed-unshipped", OrderStatus: "COMPLETED"},
+		{Kind: orchestrator.ViolationCompletedShippedTwice, OrderID: "completed-shipped-twice", OrderStatus: "COMPLETED", ShipmentIDs: []string{"ship-11", "ship-12"}},
+	}
+	if report.OrdersChecked != 9 || !reflect.DeepEqual(report.Violations, want) {
+		t.Errorf("report = %d orders, %+v\nwant 9 orders, %+v", report.OrdersChecked, report.Violations, want)
+	}
+	if report.Consistent() {
+		t.Error("report with violations is Consistent")
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("ListOrders asked %d times, want 3 pages", len(*requests))
+	}
+	for _, req := range *requests {
+		if !req.GetIncludeArchived() || !reflect.DeepEqual(req.GetStatuses(), []orderpb.OrderStatus{cancelled, completed}) {
+			t.Errorf("ListOrders request = %v, want CANCELLED and COMPLETED orders, archived included", req)
+		}
+	}
+}
+
+// TestReconcileServiceError checks a service that cannot be asked stops
+// Reconcile with an error, returning the violations found before it.
+func TestReconcileServiceError(t *testing.T) {
+	f := newFakeStack(t)
+	seedReconcile(t, f, 10,
+		reconcileFixture{order: reconcileOrder("completed-unpaid", orderpb.OrderStatus_COMPLETED)},
+		reconcileFixture{order: reconcileOrder("completed-ok", orderpb.OrderStatus_COMPLETED)},
+	)
+	unavailable := status.Error(codes.Unavailable, "payment service down")
+	listPayments := f.payment.ListPaymentsFunc
+	f.payment.ListPaymentsFunc = func(ctx context.Context, req *paymentpb.ListPaymentsRequest) (*paymentpb.ListPaymentsResponse, error) {
+		if req.GetOrderId().GetId() == "completed-ok" {
+			return nil, unavailable
+		}
+		return listPayments(ctx, req)
+	}
+
+	report, err := f.orch.Reconcile(context.Background())
+	if !errors.Is(err, unavailable) {
+		t.Fatalf("Reconcile = %v, want the ListPayments error", err)
+	}
+	if report.OrdersChecked != 1 || len(report.Violations) != 2 || report.Violations[0].OrderID != "completed-unpaid" {
+		t.Errorf("partial report = %d orders, %+v; want the first order's violations", report.OrdersChecked, report.Violations)
+	}
+}
+
+// TestSagaReconcile runs a completed and a failed saga through the real
+// services and checks they reconcile cleanly, then refunds the completed
+// order's payment behind the saga's back and checks it is reported.
+func TestSagaReconcile(t *testing.T) {
+	h := sagatest.New(t)
+	ctx := context.Background()
+	state, err := h.Run(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	failed := sagatest.New(t, sagatest.WithShippingFailure())
+	if _, err := failed.Run(ctx, "user-2"); err == nil {
+		t.Fatal("saga with shipping failing succeeded")
+	}
+	for name, harness := range map[string]*sagatest.Harness{"completed": h, "failed": failed} {
+		if report, err := harness.Orchestrator.Reconcile(ctx); err != nil || report.OrdersChecked != 1 || !report.Consistent() {
+			t.Errorf("%s saga reconciled as %+v, %v; want one consistent order", name, report, err)
+		}
+	}
+
+	if _, err := h.Clients.Payment.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{OrderId: state.OrderID, PaymentId: state.PaymentID, Reason: "manual"}); err != nil {
+		t.Fatalf("RefundPayment: %v", err)
+	}
+	report, err := h.Orchestrator.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := []orchestrator.ReconciliationViolation{{Kind: orchestrator.ViolationCompletedNotCharged, OrderID: state.OrderID.GetId(), OrderStatus: "COMPLETED"}}
+	if !reflect.DeepEqual(report.Violations, want) {
+		t.Errorf("violations after the refund = %+v, want %+v", report.Violations, want)
+	}
+}
@@ -0,0 +1,207 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"create-order-saga/pkg/interceptors"
+)
+
+// ErrSagaNotFound is returned when no in-flight saga has the given ID.
+var ErrSagaNotFound = errors.New("saga not found")
+
+// ErrSagaCancelled is the cancellation cause set by CancelSaga. Every
+// *CancelledError matches it too.
+var ErrSagaCancelled = errors.New("saga cancelled by operator")
+
+// ErrShuttingDown is the cancellation cause set by CancelAllSagas.
+var ErrShuttingDown = errors.New("orchestrator shutting down")
+
+// ErrShutdownDeadline is the cause of compensation calls abandoned because the
+// shutdown deadline passed (see WithShutdownDeadline).
+var ErrShutdownDeadline = errors.New("shutdown deadline passed")
+
+// WithShutdownDeadline bounds how long the compensations of cancelled sagas
+// may run after CancelAllSagas (no limit by default). Compensations still
+// running when it passes are abandoned: their calls fail with
+// ErrShutdownDeadline as the cause and are queued for follow-up like any
+// failed compensation, so the orchestrator can exit.
+func WithShutdownDeadline(d time.Duration) Option {
+	return func(o *Orchestrator) {
+		o.shutdownDeadline = d
+	}
+}
+
+// detach returns a context with ctx's values (saga ID, tenant, timings) but
+// not its cancellation, for compensations that must run even after the saga
+// was cancelled. It is cancelled only once the shutdown deadline has passed.
+// Call stop when done with it.
+func (o *Orchestrator) detach(ctx context.Context) (detached context.Context, stop func()) {
+	detached, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stopHalt := context.AfterFunc(o.halt, func() { cancel(context.Cause(o.halt)) })
+	return detached, func() {
+		stopHalt()
+		cancel(nil)
+	}
+}
+
+// CancelledError is returned by a saga whose context was done between two
+// steps: the next step was not started and the completed ones were compensated.
+// It matches ErrSagaCancelled with errors.Is and unwraps to the cancellation
+// cause (e.g. context.DeadlineExceeded or ErrShuttingDown).
+type CancelledError struct {
+	Before      string   // Step that was not started, e.g. "ProcessPayment"
+	Compensated []string // Completed steps that were compensated, in saga order (failures are reported alongside as a *CompensationError)
+	Cause       error
+}
+
+func (e *CancelledError) Error() string {
+	msg := fmt.Sprintf("saga cancelled before %s: %v", e.Before, e.Cause)
+	if len(e.Compensated) > 0 {
+		msg += "; compensated " + strings.Join(e.Compensated, ", ")
+	}
+	return msg
+}
+
+// Is lets errors.Is(err, ErrSagaCancelled) match however the saga was cancelled.
+func (e *CancelledError) Is(target error) bool {
+	return target == ErrSagaCancelled
+}
+
+func (e *CancelledError) Unwrap() error {
+	return e.Cause
+}
+
+// Phases GetSagaState reports besides the step in progress.
+const (
+	PhaseStarting     = "starting"     // Registered, no step started yet
+	PhaseCompensating = "compensating" // Undoing the completed steps after a failure or cancellation
+)
+
+// runningSaga is the registry entry for an in-flight saga.
+type runningSaga struct {
+	id        string
+	startedAt time.Time
+	cancel    context.CancelCauseFunc
+	watch     sagaWatch // Streams the saga's events to WatchSaga callers
+
+	mu       sync.Mutex
+	snapshot *SagaState // Copy of the saga's state as of entering phase
+	phase    string     // Step in progress, e.g. "ProcessPayment", or one of the Phase constants
+}
+
+// sagaRegistry tracks in-flight sagas so they can be inspected or cancelled,
+// and the completions still running for sagas that have returned (see
+// WithAsyncComplete).
+type sagaRegistry struct {
+	mu         sync.RWMutex
+	sagas      map[string]*runningSaga
+	completing map[string]string // Order ID by saga ID
+	completion sync.WaitGroup    // One per entry in completing
+}
+
+func newSagaRegistry() *sagaRegistry {
+	return &sagaRegistry{sagas: make(map[string]*runningSaga), completing: make(map[string]string)}
+}
+
+func (r *sagaRegistry) add(s *runningSaga) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sagas[s.id] = s
+}
+
+// remove forgets a finished saga and ends its watches.
+func (r *sagaRegistry) remove(id string) {
+	r.mu.Lock()
+	s, ok := r.sagas[id]
+	delete(r.sagas, id)
+	r.mu.Unlock()
+	if ok {
+		s.watch.close()
+	}
+}
+
+func (r *sagaRegistry) get(id string) (*runningSaga, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sagas[id]
+	return s, ok
+}
+
+// enterPhase records that the saga in ctx has moved on to phase, along with a
+// copy of its state so far. Only the saga's own goroutine changes its state,
+// so it must be the caller.
+func (o *Orchestrator) enterPhase(ctx context.Context, state *SagaState, phase string) {
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	s, ok := o.registry.get(sagaID)
+	if !ok {
+		return
+	}
+	snapshot := state.clone()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot, s.phase = snapshot, phase
+}
+
+// GetSagaState returns a copy of an in-flight saga's state as of the start of
+// its current phase, and that phase: the step in progress (its RPC name, e.g.
+// "ProcessPayment"), PhaseStarting or PhaseCompensating. IDs assigned by the
+// step in progress show up once the next phase starts. It returns false if no
+// saga with that ID is in flight.
+func (o *Orchestrator) GetSagaState(sagaID string) (*SagaState, string, bool) {
+	s, ok := o.registry.get(sagaID)
+	if !ok {
+		return nil, "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot.clone(), s.phase, true
+}
+
+// InFlightSagas returns the IDs of the sagas currently executing.
+func (o *Orchestrator) InFlightSagas() []string {
+	o.registry.mu.RLock()
+	defer o.registry.mu.RUnlock()
+	ids := make([]string, 0, len(o.registry.sagas))
+	for id := range o.registry.sagas {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// CancelSaga aborts an in-flight saga. Its context is cancelled, so the step in
+// progress fails and the saga compensates whatever steps already completed.
+// CancelSaga returns immediately; compensation runs in the saga's own goroutine.
+func (o *Orchestrator) CancelSaga(sagaID string) error {
+	s, ok := o.registry.get(sagaID)
+	if !ok {
+		return ErrSagaNotFound
+	}
+	s.cancel(ErrSagaCancelled)
+	return nil
+}
+
+// CancelAllSagas cancels every in-flight saga (used on shutdown) so each one
+// compensates its completed steps before returning. With WithShutdownDeadline,
+// compensations still running once the deadline has passed are abandoned.
+func (o *Orchestrator) CancelAllSagas() {
+	o.registry.mu.RLock()
+	defer o.registry.mu.RUnlock()
+	for _, s := range o.registry.sagas {
+		s.cancel(ErrShuttingDown)
+	}
+	if o.shutdownDeadline > 0 {
+		go func() {
+			<-o.clock.After(o.shutdownDeadline)
+			if o.halt.Err() == nil {
+				log.Printf("Shutdown deadline of %v passed: abandoning compensations still running (they are queued for follow-up)", o.shutdownDeadline)
+			}
+			o.haltWith(ErrShutdownDeadline)
+		}()
+	}
+}
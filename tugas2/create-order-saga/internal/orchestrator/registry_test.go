@@ -0,0 +1,121 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"create-order-saga/internal/orchestrator"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// stuckGateway returns a payment gateway that reports each charge on the
+// returned channel and then blocks until the call is abandoned.
+func stuckGateway() (paymentservice.Gateway, <-chan string) {
+	charging := make(chan string, 1)
+	return paymentservice.GatewayFunc(func(ctx context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+		charging <- orderID
+		<-ctx.Done()
+		return "", ctx.Err()
+	}), charging
+}
+
+// TestCancelInFlightSaga cancels a saga stuck charging the payment, through
+// CancelSaga or its HTTP endpoint: the saga returns a cancellation, undoes
+// the order and its shipments, and is no longer in flight.
+func TestCancelInFlightSaga(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cancel func(t *testing.T, o *orchestrator.Orchestrator, sagaID string)
+	}{
+		{"CancelSaga", func(t *testing.T, o *orchestrator.Orchestrator, sagaID string) {
+			if err := o.CancelSaga(sagaID); err != nil {
+				t.Fatalf("CancelSaga: %v", err)
+			}
+		}},
+		{"HTTP", func(t *testing.T, o *orchestrator.Orchestrator, sagaID string) {
+			w := httptest.NewRecorder()
+			o.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sagas/"+sagaID+"/cancel", nil))
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("POST /sagas/%s/cancel = %d, want 202", sagaID, w.Code)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway, charging := stuckGateway()
+			h := sagatest.New(t, sagatest.WithPaymentGateway(gateway))
+			type outcome struct {
+				state *orchestrator.SagaState
+				err   error
+			}
+			done := make(chan outcome, 1)
+			go func() {
+				state, err := h.Run(interceptors.WithSagaID(context.Background(), "saga-1"), "user-1")
+				done <- outcome{state, err}
+			}()
+			<-charging
+
+			if _, phase, ok := h.Orchestrator.GetSagaState("saga-1"); !ok || phase != "ProcessPayment" {
+				t.Fatalf("GetSagaState = %q, %t; want saga-1 in flight at ProcessPayment", phase, ok)
+			}
+			tc.cancel(t, h.Orchestrator, "saga-1")
+			res := <-done
+
+			if !errors.Is(res.err, orchestrator.ErrSagaCancelled) {
+				t.Fatalf("saga error = %v, want ErrSagaCancelled", res.err)
+			}
+			if errors.Is(res.err, orchestrator.ErrCompensationFailed) {
+				t.Errorf("compensation failed: %v", res.err)
+			}
+			order, _ := h.Order.Lookup(context.Background(), res.state.OrderID.GetId())
+			if order.GetStatus() != orderpb.OrderStatus_CANCELLED || order.GetCancellationReason() != orchestrator.CancelReasonSagaCancelled {
+				t.Errorf("order is %s (%q), want CANCELLED as %q", order.GetStatus(), order.GetCancellationReason(), orchestrator.CancelReasonSagaCancelled)
+			}
+			if len(res.state.ShipmentIDs) == 0 {
+				t.Fatal("saga reserved no shipment before paying")
+			}
+			for _, id := range res.state.ShipmentIDs {
+				if got, _ := h.ShipmentStatus(id); got != shippingpb.ShippingStatus_CANCELLED {
+					t.Errorf("shipment %s is %s, want CANCELLED", id, got)
+				}
+			}
+			for _, payment := range h.Payment.OrderPayments(context.Background(), res.state.OrderID.GetId()) {
+				if payment.GetStatus() == paymentpb.PaymentStatus_SUCCESS {
+					t.Errorf("payment %s was taken for a cancelled saga", payment.GetId())
+				}
+			}
+
+			if ids := h.Orchestrator.InFlightSagas(); len(ids) != 0 {
+				t.Errorf("in flight after returning: %v", ids)
+			}
+			if _, _, ok := h.Orchestrator.GetSagaState("saga-1"); ok {
+				t.Error("GetSagaState still finds the finished saga")
+			}
+			if err := h.Orchestrator.CancelSaga("saga-1"); !errors.Is(err, orchestrator.ErrSagaNotFound) {
+				t.Errorf("cancelling it again = %v, want ErrSagaNotFound", err)
+			}
+		})
+	}
+}
+
+// TestCancelUnknownSaga checks cancelling a saga that is not in flight is
+// reported as not found, both by CancelSaga and over HTTP.
+func TestCancelUnknownSaga(t *testing.T) {
+	h := sagatest.New(t)
+	if err := h.Orchestrator.CancelSaga("no-such-saga"); !errors.Is(err, orchestrator.ErrSagaNotFound) {
+		t.Errorf("CancelSaga = %v, want ErrSagaNotFound", err)
+	}
+	w := httptest.NewRecorder()
+	h.Orchestrator.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sagas/no-such-saga/cancel", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("POST /sagas/no-such-saga/cancel = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,111 @@
+package orchestrator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"create-order-saga/internal/orchestrator"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// holdReserveShipping makes ReserveShipping wait for the returned release
+// func (called at the latest when the test ends) and then reserve shipment
+// "ship-1", reporting on the returned channel when it has been called.
+func (f *fakeStack) holdReserveShipping(t *testing.T) (<-chan struct{}, func()) {
+	t.Helper()
+	started := make(chan struct{}, 1)
+	gate := make(chan struct{})
+	t.Cleanup(func() {
+		select {
+		case <-gate:
+		default:
+			close(gate)
+		}
+	})
+	f.shipping.ReserveShippingFunc = func(context.Context, *shippingpb.ArrangeShippingRequest) (*shippingpb.ArrangeShippingResponse, error) {
+		started <- struct{}{}
+		<-gate
+		return &shippingpb.ArrangeShippingResponse{ShipmentId: "ship-1", Status: shippingpb.ShippingStatus_RESERVED, ShipmentIds: []string{"ship-1"}}, nil
+	}
+	return started, func() { close(gate) }
+}
+
+// sagaState returns the phase and order ID of sagaID as served by
+// GET /sagas/{id}/state.
+func sagaState(t *testing.T, o *orchestrator.Orchestrator, sagaID string) (phase, orderID string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	o.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sagas/"+sagaID+"/state", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /sagas/%s/state = %d, want 200", sagaID, w.Code)
+	}
+	var body struct {
+		Phase string
+		State struct {
+			OrderID string `json:"order_id"`
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding the saga state: %v\n%s", err, w.Body)
+	}
+	return body.Phase, body.State.OrderID
+}
+
+// TestGetSagaStateSnapshot stops a saga in ReserveShipping and then in
+// ProcessPayment: each snapshot shows the IDs assigned so far and no more,
+// is a copy the caller may change, and is gone once the saga finishes.
+func TestGetSagaStateSnapshot(t *testing.T) {
+	f := newFakeStack(t)
+	reserving, releaseReserve := f.holdReserveShipping(t)
+	paying, releasePayment := f.holdPayment(t)
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.run("saga-1")
+		done <- err
+	}()
+
+	<-reserving
+	state, phase, ok := f.orch.GetSagaState("saga-1")
+	if !ok || phase != "ReserveShipping" {
+		t.Fatalf("GetSagaState = %q, %t; want saga-1 in ReserveShipping", phase, ok)
+	}
+	orderID := state.OrderID.GetId()
+	if orderID == "" || state.PaymentID != "" || len(state.ShipmentIDs) != 0 {
+		t.Errorf("snapshot in ReserveShipping = %s, want only the order set", state)
+	}
+	state.OrderID.Id, state.ShipmentIDs = "changed", []string{"changed"}
+	if again, _, _ := f.orch.GetSagaState("saga-1"); again.OrderID.GetId() != orderID || len(again.ShipmentIDs) != 0 {
+		t.Errorf("snapshot after changing the last one = %s, want it unchanged", again)
+	}
+	if phase, id := sagaState(t, f.orch, "saga-1"); phase != "ReserveShipping" || id != orderID {
+		t.Errorf("GET /sagas/saga-1/state = %q with order %q, want ReserveShipping with %q", phase, id, orderID)
+	}
+
+	releaseReserve()
+	<-paying
+	state, phase, ok = f.orch.GetSagaState("saga-1")
+	if !ok || phase != "ProcessPayment" {
+		t.Fatalf("GetSagaState = %q, %t; want saga-1 in ProcessPayment", phase, ok)
+	}
+	if state.OrderID.GetId() != orderID || state.PaymentID != "" || !slices.Equal(state.ShipmentIDs, []string{"ship-1"}) {
+		t.Errorf("snapshot in ProcessPayment = %s, want the order and shipment ship-1 but no payment", state)
+	}
+
+	releasePayment()
+	if err := <-done; !errors.Is(err, orchestrator.ErrPaymentFailed) {
+		t.Fatalf("saga = %v, want ErrPaymentFailed", err)
+	}
+	if _, _, ok := f.orch.GetSagaState("saga-1"); ok {
+		t.Error("GetSagaState still finds the finished saga")
+	}
+	w := httptest.NewRecorder()
+	f.orch.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sagas/saga-1/state", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /sagas/saga-1/state after the saga = %d, want 404", w.Code)
+	}
+}
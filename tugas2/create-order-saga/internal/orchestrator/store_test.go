@@ -0,0 +1,96 @@
+package orchestrator_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+)
+
+// TestCloseFlushesFileStores runs a saga against file-backed audit, event
+// and completion stores, closes the orchestrator as a shutting-down binary
+// does, and checks stores reopened on the same files hold everything written
+// before Close, while the closed stores refuse further writes.
+func TestCloseFlushesFileStores(t *testing.T) {
+	dir := t.TempDir()
+	auditPath, eventPath, completionPath := filepath.Join(dir, "audit.jsonl"), filepath.Join(dir, "events.jsonl"), filepath.Join(dir, "completions.jsonl")
+	audit, err := orchestrator.NewFileAuditStore(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := orchestrator.NewFileEventSink(eventPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completions, err := orchestrator.NewFileCompletionStore(completionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFakeStack(t, orchestrator.WithAuditStore(audit), orchestrator.WithEventSink(events), orchestrator.WithCompletionStore(completions))
+	if _, err := f.run("saga-1"); err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	queued := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, c := range []orchestrator.PendingCompletion{
+		{SagaID: "saga-2", OrderID: "order-2", Tenant: "acme", Attempts: 2, LastError: "unavailable", QueuedAt: queued, NextAttempt: queued.Add(time.Minute)},
+		{SagaID: "saga-3", OrderID: "order-3", Tenant: "acme", QueuedAt: queued, NextAttempt: queued},
+	} {
+		if err := completions.Put(c); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if err := completions.Delete("acme", "order-3"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	wantTrail, _ := f.orch.GetAuditTrail("saga-1")
+	wantEvents, _ := f.orch.ExportSaga("saga-1")
+	wantPending, _ := f.orch.PendingCompletions()
+	if len(wantTrail) == 0 || len(wantEvents) == 0 || len(wantPending) != 1 {
+		t.Fatalf("before Close: %d audit entries, %d events, %d pending completions; want some of each and one completion",
+			len(wantTrail), len(wantEvents), len(wantPending))
+	}
+
+	if err := f.orch.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := audit.Append(orchestrator.AuditEntry{SagaID: "saga-1"}); err == nil {
+		t.Error("Append after Close succeeded, want an error")
+	}
+	if err := events.Write(orchestrator.Event{SagaID: "saga-1"}); err == nil {
+		t.Error("Write after Close succeeded, want an error")
+	}
+	if err := completions.Put(orchestrator.PendingCompletion{OrderID: "order-4"}); err == nil {
+		t.Error("Put after Close succeeded, want an error")
+	}
+
+	reopenedAudit, err := orchestrator.NewFileAuditStore(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopenedEvents, err := orchestrator.NewFileEventSink(eventPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopenedCompletions, err := orchestrator.NewFileCompletionStore(completionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := newFakeStack(t, orchestrator.WithAuditStore(reopenedAudit), orchestrator.WithEventSink(reopenedEvents), orchestrator.WithCompletionStore(reopenedCompletions))
+	if got, err := later.orch.GetAuditTrail("saga-1"); err != nil || !reflect.DeepEqual(transitions(got), transitions(wantTrail)) {
+		t.Errorf("audit trail after reopening = %v, %v; want %v", transitions(got), err, transitions(wantTrail))
+	}
+	if got, err := later.orch.ExportSaga("saga-1"); err != nil || len(got) != len(wantEvents) {
+		t.Errorf("events after reopening = %d, %v; want %d", len(got), err, len(wantEvents))
+	} else {
+		for i := range got {
+			if got[i].Type != wantEvents[i].Type || got[i].Step != wantEvents[i].Step || !got[i].Timestamp.Equal(wantEvents[i].Timestamp) {
+				t.Errorf("event %d after reopening = %+v, want %+v", i, got[i], wantEvents[i])
+			}
+		}
+	}
+	if got, err := later.orch.PendingCompletions(); err != nil || !reflect.DeepEqual(got, wantPending) {
+		t.Errorf("pending completions after reopening = %+v, %v; want %+v", got, err, wantPending)
+	}
+}
@@ -0,0 +1,70 @@
+package orchestrator_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// TestSagaStepDurations gives every fake RPC a latency and checks the saga
+// reports a duration of at least that for each step and compensation that
+// ran, keyed by RPC name, adding up to most of its total duration.
+func TestSagaStepDurations(t *testing.T) {
+	const latency = 10 * time.Millisecond
+	for _, tc := range []struct {
+		name    string
+		payFail bool
+		wantErr error
+	}{
+		{"completed", false, nil},
+		{"compensated", true, orchestrator.ErrPaymentFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeStack(t, orchestrator.WithCompensationConcurrency(1))
+			f.order.Latency, f.payment.Latency, f.shipping.Latency = latency, latency, latency
+			if tc.payFail {
+				f.payment.ProcessPaymentFunc = fakes.Script[*paymentpb.ProcessPaymentRequest](fakes.Result[*paymentpb.ProcessPaymentResponse]{
+					Err: status.Error(codes.FailedPrecondition, "card declined"),
+				})
+			}
+			state, err := f.run("saga-1")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("saga error = %v, want %v", err, tc.wantErr)
+			}
+
+			var want []string
+			for _, method := range f.rec.Methods() {
+				_, rpc, _ := strings.Cut(method, ".")
+				if !slices.Contains(want, rpc) {
+					want = append(want, rpc)
+				}
+			}
+			slices.Sort(want)
+			steps := make([]string, 0, len(state.StepDurations))
+			var sum time.Duration
+			for step, d := range state.StepDurations {
+				steps = append(steps, step)
+				sum += d
+				if d < latency {
+					t.Errorf("%s took %v, want at least the %v latency", step, d, latency)
+				}
+			}
+			slices.Sort(steps)
+			if !slices.Equal(steps, want) {
+				t.Errorf("timed steps = %v, want every RPC called: %v", steps, want)
+			}
+			if sum > state.Duration || sum < state.Duration*3/4 {
+				t.Errorf("steps took %v in total of the saga's %v, want most of it", sum, state.Duration)
+			}
+		})
+	}
+}
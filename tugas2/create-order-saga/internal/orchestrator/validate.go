@@ -0,0 +1,137 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// ValidationSourceOrchestrator marks problems found by the orchestrator's own checks;
+// other problems carry the name of the service that reported them.
+const ValidationSourceOrchestrator = "orchestrator"
+
+// ValidationProblem is one problem found while validating a saga's input.
+type ValidationProblem struct {
+	Source      string `json:"source"`
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// ValidationReport lists every problem ValidateCreateOrder found.
+type ValidationReport struct {
+	Problems []ValidationProblem `json:"problems"`
+	Skipped  []string            `json:"skipped,omitempty"` // Services that do not implement validation
+}
+
+// Valid reports whether no problems were found.
+func (r *ValidationReport) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+// add appends a problem unless the same field already has the same description,
+// so a local check and a service check for the same rule are reported once.
+func (r *ValidationReport) add(source, field, description string) {
+	for _, p := range r.Problems {
+		if p.Field == field && p.Description == description {
+			return
+		}
+	}
+	r.Problems = append(r.Problems, ValidationProblem{Source: source, Field: field, Description: description})
+}
+
+// ValidateCreateOrder checks the input of a Create Order saga without running it:
+// nothing is created, charged or shipped. The orchestrator's own checks (items
+// present, payment amount matching the order total, address complete) always run;
+// then each service validates its part through its Validate* RPC (the Shipping
+// service is not asked about digital orders). Services that don't implement the
+// RPC are listed in Skipped. An error is returned only if a service could not
+// be asked, together with the problems found so far.
+func (o *Orchestrator) ValidateCreateOrder(ctx context.Context, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo, shippingAddr *commonpb.ShippingAddress) (*ValidationReport, error) {
+	report := &ValidationReport{}
+	validateLocally(report, details, paymentInfo, shippingAddr)
+
+	remote := []struct {
+		service  string
+		validate func() (*commonpb.ValidationResponse, error)
+	}{
+		{"order", func() (*commonpb.ValidationResponse, error) {
+			return o.clients.Order.ValidateOrder(ctx, &orderpb.ValidateOrderRequest{Details: details})
+		}},
+		{"payment", func() (*commonpb.ValidationResponse, error) {
+			return o.clients.Payment.ValidatePayment(ctx, &paymentpb.ValidatePaymentRequest{PaymentInfo: paymentInfo})
+		}},
+		{"shipping", func() (*commonpb.ValidationResponse, error) {
+			return o.clients.Shipping.ValidateShipping(ctx, &shippingpb.ValidateShippingRequest{Address: shippingAddr})
+		}},
+	}
+	if isDigital(details) { // Nothing is shipped, so the address is not the Shipping service's concern
+		remote = remote[:2]
+	}
+	for _, r := range remote {
+		resp, err := r.validate()
+		if status.Code(err) == codes.Unimplemented {
+			log.Printf("Validation: %s service does not support validation, skipping", r.service)
+			report.Skipped = append(report.Skipped, r.service)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("validating with %s service: %w", r.service, err)
+		}
+		for _, v := range resp.GetViolations() {
+			report.add(r.service, v.GetField(), v.GetDescription())
+		}
+	}
+	return report, nil
+}
+
+// validateLocally runs the checks that need no service: the order has items,
+// the payment is in the order's currency and, unless the order is digital, the
+// address is complete. The amount itself is not compared: the saga charges the
+// order's grand total, which includes tax and shipping only the services can
+// work out.
+// Field names follow the downstream requests so duplicates with service checks collapse.
+func validateLocally(report *ValidationReport, details *commonpb.OrderDetails, paymentInfo *commonpb.PaymentInfo, shippingAddr *commonpb.ShippingAddress) {
+	const src = ValidationSourceOrchestrator
+	if len(details.GetItems()) == 0 {
+		report.add(src, "details.items", "order must contain at least one item")
+	}
+	if paymentInfo == nil {
+		report.add(src, "payment_info", "payment info is missing")
+	} else if total, err := money.ItemsTotal(details.GetItems()); err == nil && money.Validate(paymentInfo.Amount) == nil {
+		// Malformed prices and amounts are left to the Order and Payment services to report
+		amount := paymentInfo.Amount
+		if _, err := money.Compare(amount, total); err != nil {
+			report.add(src, "payment_info.amount.currency_code", fmt.Sprintf("currency %s does not match the order currency %s", amount.GetCurrencyCode(), total.GetCurrencyCode()))
+		}
+		if c := paymentInfo.GetCurrencyCode(); c != "" && c != total.GetCurrencyCode() {
+			report.add(src, "payment_info.currency_code", fmt.Sprintf("currency %s does not match the order currency %s", c, total.GetCurrencyCode()))
+		}
+	}
+	if isDigital(details) {
+		return
+	}
+	if shippingAddr == nil {
+		report.add(src, "address", "shipping address is missing")
+		return
+	}
+	for _, f := range []struct{ name, value string }{
+		{"street", shippingAddr.GetStreet()},
+		{"city", shippingAddr.GetCity()},
+		{"zip_code", shippingAddr.GetZipCode()},
+		{"country", shippingAddr.GetCountry()},
+	} {
+		if strings.TrimSpace(f.value) == "" {
+			report.add(src, "address."+f.name, f.name+" is required")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package orchestrator_test
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"create-order-saga/internal/orchestrator"
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/ids"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// TestValidateCreateOrderReport checks problems from the orchestrator and
+// each service end up in one report, each under its source.
+func TestValidateCreateOrderReport(t *testing.T) {
+	h := sagatest.New(t)
+	details := sagatest.SampleOrder("user-1")
+	details.Items[0].Quantity = 0
+	payment := sagatest.SamplePayment()
+	payment.Cvv = "1"
+	address := sagatest.SampleAddress()
+	address.City = ""
+
+	report, err := h.Orchestrator.ValidateCreateOrder(context.Background(), details, payment, address)
+	if err != nil {
+		t.Fatalf("ValidateCreateOrder: %v", err)
+	}
+	sources := make(map[string]string) // Field to source
+	for _, p := range report.Problems {
+		sources[p.Field] = p.Source
+	}
+	for field, source := range map[string]string{
+		"details.items[0].quantity": "order",
+		"payment_info.cvv":          "payment",
+		"address.city":              orchestrator.ValidationSourceOrchestrator,
+	} {
+		if got, ok := sources[field]; !ok || got != source {
+			t.Errorf("problem with %s reported by %q (found %v), want %q", field, got, ok, source)
+		}
+	}
+	if report.Valid() || len(report.Skipped) != 0 {
+		t.Errorf("report = %+v, want it invalid with no service skipped", report)
+	}
+
+	report, err = h.Orchestrator.ValidateCreateOrder(context.Background(), sagatest.SampleOrder("user-1"), sagatest.SamplePayment(), sagatest.SampleAddress())
+	if err != nil || !report.Valid() {
+		t.Errorf("ValidateCreateOrder of the sample order = %+v, %v; want it valid", report, err)
+	}
+}
+
+// TestValidateCreateOrderNoSideEffects validates valid, invalid and digital
+// orders against stores sharing one ID sequence, then checks no order,
+// outbox event, stock, payment or shipment was touched and no ID was taken.
+func TestValidateCreateOrderNoSideEffects(t *testing.T) {
+	seq := ids.NewSequence()
+	stock := map[string]int64{"prod-A": 10, "prod-B": 10}
+	h := sagatest.New(t, sagatest.WithIDGenerator(seq), sagatest.WithOrderOptions(orderservice.WithStock(stock)))
+	ctx := context.Background()
+
+	invalid := sagatest.SamplePayment()
+	invalid.CardNumber = "4242424242424241"
+	digital := sagatest.SampleOrder("user-1")
+	digital.FulfillmentType = commonpb.FulfillmentType_DIGITAL
+	for _, tc := range []struct {
+		details *commonpb.OrderDetails
+		payment *commonpb.PaymentInfo
+	}{
+		{sagatest.SampleOrder("user-1"), sagatest.SamplePayment()},
+		{sagatest.SampleOrder("user-1"), invalid},
+		{digital, sagatest.SamplePayment()},
+	} {
+		if _, err := h.Orchestrator.ValidateCreateOrder(ctx, tc.details, tc.payment, sagatest.SampleAddress()); err != nil {
+			t.Fatalf("ValidateCreateOrder: %v", err)
+		}
+	}
+
+	orders, err := h.Order.ListOrders(ctx, &orderpb.ListOrdersRequest{})
+	if err != nil || len(orders.GetOrders()) != 0 {
+		t.Errorf("orders after validating = %v, %v; want none", orders.GetOrders(), err)
+	}
+	if events := h.Order.OutboxEvents(); len(events) != 0 {
+		t.Errorf("outbox events after validating = %v, want none", events)
+	}
+	if got := h.Order.Stock(ctx); !maps.Equal(got, stock) {
+		t.Errorf("stock after validating = %v, want %v", got, stock)
+	}
+	if payments := h.Payment.OrderPayments(ctx, "order-1"); len(payments) != 0 {
+		t.Errorf("payments after validating = %v, want none", payments)
+	}
+	if shipments := h.Shipping.OrderShipments(ctx, "order-1"); len(shipments) != 0 {
+		t.Errorf("shipments after validating = %v, want none", shipments)
+	}
+	for kind, want := range map[string]string{"saga": "saga-1", "order": "order-1", "pay": "pay-1", "ship": "ship-1"} {
+		if got := seq.NewID(kind, ""); got != want {
+			t.Errorf("next %s ID = %s, want %s: validating took IDs", kind, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// watchBuffer is how many events a watcher may fall behind a running saga
+// before it is dropped, so a slow watcher never holds the saga up.
+const watchBuffer = 64
+
+// Final statuses of a watched saga, see SagaStatus.
+const (
+	SagaStatusCompleted   = "COMPLETED"
+	SagaStatusCompensated = "COMPENSATED"
+)
+
+// sagaWatch fans the events of one running saga out to its watchers.
+type sagaWatch struct {
+	mu       sync.Mutex
+	history  []Event                           // Every event so far, replayed to new watchers
+	watchers map[chan SagaProgress]func() bool // Watcher -> stops its disconnect hook
+	closed   bool
+}
+
+// subscribe returns a channel replaying the saga's events so far and then
+// receiving new ones until the saga finishes or ctx is done. It reports false
+// if the saga has already finished.
+func (w *sagaWatch) subscribe(ctx context.Context) (<-chan SagaProgress, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, false
+	}
+	ch := make(chan SagaProgress, len(w.history)+watchBuffer)
+	for i, event := range w.history {
+		ch <- SagaProgress{Seq: i + 1, Event: event}
+	}
+	if w.watchers == nil {
+		w.watchers = make(map[chan SagaProgress]func() bool)
+	}
+	w.watchers[ch] = context.AfterFunc(ctx, func() { w.unsubscribe(ch) })
+	return ch, true
+}
+
+func (w *sagaWatch) unsubscribe(ch chan SagaProgress) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watchers[ch]; ok {
+		delete(w.watchers, ch)
+		close(ch)
+	}
+}
+
+// publish records an event and passes it to every watcher.
+func (w *sagaWatch) publish(event Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.history = append(w.history, event)
+	p := SagaProgress{Seq: len(w.history), Event: event}
+	for ch, stop := range w.watchers {
+		select {
+		case ch <- p:
+		default:
+			log.Printf("WARNING: Dropping a watcher of saga %s that fell %d events behind", event.SagaID, watchBuffer)
+			stop()
+			delete(w.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// close ends every watch once the saga has finished.
+func (w *sagaWatch) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	for ch, stop := range w.watchers {
+		stop()
+		close(ch)
+	}
+	w.watchers = nil
+}
+
+// WatchSaga returns the progress of a saga: the events recorded so far, then,
+// while it runs, every new event as it happens. The channel is closed once the
+// saga has finished (see SagaStatus for its outcome) or ctx is done. Watching
+// a finished saga replays its event log. It returns ErrSagaNotFound if the
+// saga is neither running nor in the event log.
+func (o *Orchestrator) WatchSaga(ctx context.Context, sagaID string) (<-chan SagaProgress, error) {
+	if s, ok := o.registry.get(sagaID); ok {
+		if ch, ok := s.watch.subscribe(ctx); ok {
+			return ch, nil
+		}
+		// Finished meanwhile; its events are all in the log now
+	}
+	events, err := o.events.Events(sagaID)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrSagaNotFound
+	}
+	ch := make(chan SagaProgress, len(events))
+	for i, event := range events {
+		ch <- SagaProgress{Seq: i + 1, Event: event}
+	}
+	close(ch)
+	return ch, nil
+}
+
+// SagaStatus returns SagaStatusCompleted or SagaStatusCompensated for a
+// finished saga, or "" while it runs or if its audit trail is unknown.
+func (o *Orchestrator) SagaStatus(sagaID string) string {
+	trail, err := o.audit.Trail(sagaID)
+	if err != nil {
+		return ""
+	}
+	for i := len(trail) - 1; i >= 0; i-- {
+		switch trail[i].Type {
+		case AuditSagaCompleted:
+			return SagaStatusCompleted
+		case AuditSagaFailed:
+			return SagaStatusCompensated
+		}
+	}
+	return ""
+}
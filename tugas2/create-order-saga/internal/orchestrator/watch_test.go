@@ -0,0 +1,257 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/grpc_clients/fakes"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// steps returns the step of each progress event read from ch until it closes.
+func steps(ch <-chan orchestrator.SagaProgress) []string {
+	var got []string
+	for p := range ch {
+		got = append(got, p.Step)
+	}
+	return got
+}
+
+// watchStarted watches sagaID, failing the test if it cannot.
+func watchStarted(t *testing.T, ctx context.Context, o *orchestrator.Orchestrator, sagaID string) <-chan orchestrator.SagaProgress {
+	t.Helper()
+	ch, err := o.WatchSaga(ctx, sagaID)
+	if err != nil {
+		t.Fatalf("WatchSaga(%s): %v", sagaID, err)
+	}
+	return ch
+}
+
+// TestWatchRunningSaga watches a saga held in CreateOrder: the finished
+// QuoteShipping is replayed, nothing else arrives until the saga moves on,
+// and then every step follows in order before the channel closes.
+func TestWatchRunningSaga(t *testing.T) {
+	f := newFakeStack(t)
+	started, release := f.holdCreateOrder(t)
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.run("saga-1")
+		done <- err
+	}()
+	<-started
+
+	progress := watchStarted(t, context.Background(), f.orch, "saga-1")
+	if p := <-progress; p.Seq != 1 || p.Step != "QuoteShipping" || p.Type != orchestrator.EventStepSucceeded {
+		t.Errorf("first progress = %+v, want the succeeded QuoteShipping", p)
+	}
+	select {
+	case p := <-progress:
+		t.Fatalf("got %s while the saga is held in CreateOrder", p.Step)
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+
+	want := []string{"CreateOrder", "ReserveShipping", "ProcessPayment", "ConfirmShipping", "CompleteOrder"}
+	if got := steps(progress); !slices.Equal(got, want) {
+		t.Errorf("live progress = %v, want %v", got, want)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	if got := f.orch.SagaStatus("saga-1"); got != orchestrator.SagaStatusCompleted {
+		t.Errorf("SagaStatus = %q, want %q", got, orchestrator.SagaStatusCompleted)
+	}
+}
+
+// TestWatchFinishedSaga watches sagas that have already finished: their
+// event log is replayed in order, numbered from 1, and the channel closed.
+func TestWatchFinishedSaga(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		opts       []sagatest.Option
+		want       []string
+		wantStatus string
+	}{
+		{
+			name:       "completed",
+			want:       []string{"QuoteShipping", "CreateOrder", "ReserveShipping", "ProcessPayment", "ConfirmShipping", "CompleteOrder"},
+			wantStatus: orchestrator.SagaStatusCompleted,
+		},
+		{
+			name:       "compensated",
+			opts:       []sagatest.Option{sagatest.WithPaymentFailure()},
+			want:       []string{"QuoteShipping", "CreateOrder", "ReserveShipping", "ProcessPayment", "CancelShipping", "RefundPayment", "CancelOrder"},
+			wantStatus: orchestrator.SagaStatusCompensated,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := sagatest.New(t, tc.opts...)
+			saga, _ := h.Run(context.Background(), "user-1")
+
+			var got []string
+			for p := range watchStarted(t, context.Background(), h.Orchestrator, saga.SagaID) {
+				if p.Seq != len(got)+1 || p.SagaID != saga.SagaID {
+					t.Errorf("progress %d = %+v, want seq %d of saga %s", len(got), p, len(got)+1, saga.SagaID)
+				}
+				got = append(got, p.Step)
+			}
+			if tc.wantStatus == orchestrator.SagaStatusCompensated {
+				slices.Sort(got[4:6]) // The shipment and payment are undone concurrently
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("replay = %v, want %v", got, tc.want)
+			}
+			if got := h.Orchestrator.SagaStatus(saga.SagaID); got != tc.wantStatus {
+				t.Errorf("SagaStatus = %q, want %q", got, tc.wantStatus)
+			}
+		})
+	}
+}
+
+// TestWatchUnknownSaga checks an unknown saga is reported as not found, both
+// by WatchSaga and by its HTTP endpoint.
+func TestWatchUnknownSaga(t *testing.T) {
+	h := sagatest.New(t)
+	if _, err := h.Orchestrator.WatchSaga(context.Background(), "no-such-saga"); !errors.Is(err, orchestrator.ErrSagaNotFound) {
+		t.Errorf("WatchSaga = %v, want ErrSagaNotFound", err)
+	}
+
+	srv := httptest.NewServer(h.Orchestrator.HTTPHandler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/sagas/no-such-saga/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /sagas/no-such-saga/events = %s, want 404", resp.Status)
+	}
+}
+
+// TestWatchSagaHTTP streams a finished saga over HTTP: one progress event
+// per step, then the end event with its outcome.
+func TestWatchSagaHTTP(t *testing.T) {
+	h := sagatest.New(t)
+	saga := completedOrder(t, h)
+	srv := httptest.NewServer(h.Orchestrator.HTTPHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/sagas/" + saga.SagaID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(body), "event: progress\n"); got != 6 {
+		t.Errorf("stream has %d progress events, want 6:\n%s", got, body)
+	}
+	wantEnd := fmt.Sprintf("event: end\ndata: {\"saga_id\":%q,\"status\":%q}\n\n", saga.SagaID, orchestrator.SagaStatusCompleted)
+	if !strings.HasSuffix(string(body), wantEnd) {
+		t.Errorf("stream ends with %q, want %q", body[max(0, len(body)-len(wantEnd)):], wantEnd)
+	}
+}
+
+// holdPayment makes ProcessPayment wait for the returned release func and
+// then decline, reporting on the returned channel when it has been called.
+func (f *fakeStack) holdPayment(t *testing.T) (<-chan struct{}, func()) {
+	t.Helper()
+	started := make(chan struct{}, 1)
+	gate := make(chan struct{})
+	t.Cleanup(func() {
+		select {
+		case <-gate:
+		default:
+			close(gate)
+		}
+	})
+	f.payment.ProcessPaymentFunc = func(ctx context.Context, _ *paymentpb.ProcessPaymentRequest) (*paymentpb.ProcessPaymentResponse, error) {
+		started <- struct{}{}
+		<-gate
+		return &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_FAILED, Message: "card declined"}, nil
+	}
+	return started, func() { close(gate) }
+}
+
+// TestWatchDisconnect stops watching a running saga: its channel is closed
+// while the saga carries on and completes its compensation.
+func TestWatchDisconnect(t *testing.T) {
+	f := newFakeStack(t)
+	started, release := f.holdPayment(t)
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.run("saga-1")
+		done <- err
+	}()
+	<-started
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	progress := watchStarted(t, ctx, f.orch, "saga-1")
+	disconnect()
+	if got, want := steps(progress), []string{"QuoteShipping", "CreateOrder", "ReserveShipping"}; !slices.Equal(got, want) {
+		t.Errorf("progress before disconnecting = %v, want the replayed %v", got, want)
+	}
+
+	release()
+	if err := <-done; !errors.Is(err, orchestrator.ErrPaymentFailed) {
+		t.Fatalf("saga = %v, want ErrPaymentFailed", err)
+	}
+	if got := f.orch.SagaStatus("saga-1"); got != orchestrator.SagaStatusCompensated {
+		t.Errorf("SagaStatus = %q, want %q", got, orchestrator.SagaStatusCompensated)
+	}
+}
+
+// TestWatchDropsSlowWatcher cancels 100 shipments after a declined payment
+// while one watcher reads nothing: it is dropped once its buffer of 64 events
+// is full instead of holding the saga up, and the events it missed are still
+// in the log.
+func TestWatchDropsSlowWatcher(t *testing.T) {
+	f := newFakeStack(t)
+	shipments := make([]string, 100)
+	for i := range shipments {
+		shipments[i] = fmt.Sprintf("ship-%d", i)
+	}
+	f.shipping.ReserveShippingFunc = fakes.Script[*shippingpb.ArrangeShippingRequest](fakes.Result[*shippingpb.ArrangeShippingResponse]{
+		Resp: &shippingpb.ArrangeShippingResponse{ShipmentId: shipments[0], ShipmentIds: shipments, Status: shippingpb.ShippingStatus_PENDING},
+	})
+	started, release := f.holdPayment(t)
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.run("saga-1")
+		done <- err
+	}()
+	<-started
+
+	slow := watchStarted(t, context.Background(), f.orch, "saga-1")
+	release()
+	select {
+	case err := <-done:
+		if !errors.Is(err, orchestrator.ErrPaymentFailed) {
+			t.Fatalf("saga = %v, want ErrPaymentFailed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("saga held up by a watcher that reads nothing")
+	}
+
+	// 3 steps replayed on subscribing and 64 buffered events
+	if got := len(steps(slow)); got != 3+64 {
+		t.Errorf("slow watcher got %d events before being dropped, want %d", got, 3+64)
+	}
+	// QuoteShipping, CreateOrder, ReserveShipping, ProcessPayment, 100 CancelShipping, RefundPayment, CancelOrder
+	if got := len(steps(watchStarted(t, context.Background(), f.orch, "saga-1"))); got != 106 {
+		t.Errorf("replay has %d events, want all 106", got)
+	}
+}
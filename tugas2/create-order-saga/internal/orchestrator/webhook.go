@@ -0,0 +1,238 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"create-order-saga/pkg/clock"
+)
+
+// Headers of event webhook deliveries.
+const (
+	WebhookSignatureHeader = "X-Saga-Signature" // "sha256=" and the hex HMAC-SHA256 of the body under the shared secret
+	WebhookDeliveryHeader  = "X-Saga-Delivery"  // Unique per event and stable across retries, for receivers to drop duplicates
+)
+
+// Defaults of EventWebhookConfig.
+const (
+	DefaultEventWebhookQueueSize    = 1000
+	DefaultEventWebhookAttempts     = 5
+	DefaultEventWebhookBackoff      = time.Second
+	DefaultEventWebhookMaxBackoff   = 30 * time.Second
+	DefaultEventWebhookDrainTimeout = 5 * time.Second
+)
+
+// EventWebhookConfig configures a WebhookEventSink. Zero fields take their
+// defaults.
+type EventWebhookConfig struct {
+	URLs         []string      // Endpoints every event is delivered to
+	Secret       string        // Key the deliveries are signed with; empty sends them unsigned
+	QueueSize    int           // Events waiting per endpoint before new ones are dropped (DefaultEventWebhookQueueSize)
+	MaxAttempts  int           // Attempts per delivery (DefaultEventWebhookAttempts)
+	Backoff      time.Duration // Wait before the first retry, doubled for each further one (DefaultEventWebhookBackoff)
+	MaxBackoff   time.Duration // Longest wait between retries (DefaultEventWebhookMaxBackoff)
+	Timeout      time.Duration // Timeout of each attempt (DefaultWebhookTimeout)
+	DrainTimeout time.Duration // How long Close waits for queued deliveries (DefaultEventWebhookDrainTimeout)
+	Clock        clock.Clock   // Clock the backoff waits on (the real clock)
+}
+
+// SignWebhookBody returns the signature header value of a delivery body.
+func SignWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether signature is the signature of body
+// under secret, comparing in constant time.
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(SignWebhookBody(secret, body)))
+}
+
+// WebhookEventSink writes events to another sink and also delivers each one
+// as JSON to every configured endpoint, at least once unless the endpoint
+// keeps failing or falls too far behind. Each endpoint has its own queue and
+// worker, so a slow or dead endpoint never holds up the others, or the saga:
+// Write only enqueues.
+type WebhookEventSink struct {
+	next      EventSink
+	cfg       EventWebhookConfig
+	client    *http.Client
+	endpoints []*webhookEndpoint
+	seq       atomic.Uint64 // Numbers deliveries for WebhookDeliveryHeader
+
+	closeOnce sync.Once
+	stop      context.CancelFunc // Abandons deliveries still being retried once the drain timeout passes
+	ctx       context.Context
+	wg        sync.WaitGroup
+}
+
+// webhookEndpoint is one endpoint's queue of pending deliveries.
+type webhookEndpoint struct {
+	url   string
+	queue chan webhookDelivery
+}
+
+type webhookDelivery struct {
+	id   string
+	body []byte
+}
+
+// NewWebhookEventSink creates a sink writing to next and delivering to the
+// endpoints of cfg. It starts one worker per endpoint; Close stops them.
+func NewWebhookEventSink(next EventSink, cfg EventWebhookConfig) *WebhookEventSink {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultEventWebhookQueueSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultEventWebhookAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultEventWebhookBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultEventWebhookMaxBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultWebhookTimeout
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = DefaultEventWebhookDrainTimeout
+	}
+	cfg.Clock = clock.OrReal(cfg.Clock)
+	s := &WebhookEventSink{next: next, cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+	s.ctx, s.stop = context.WithCancel(context.Background())
+	for _, url := range cfg.URLs {
+		ep := &webhookEndpoint{url: url, queue: make(chan webhookDelivery, cfg.QueueSize)}
+		s.endpoints = append(s.endpoints, ep)
+		s.wg.Add(1)
+		go s.deliverAll(ep)
+	}
+	return s
+}
+
+// Write writes the event to the next sink and queues its delivery to every
+// endpoint. An endpoint whose queue is full misses the event, which is
+// logged; that never fails the write.
+func (s *WebhookEventSink) Write(event Event) error {
+	err := s.next.Write(event)
+	body, merr := json.Marshal(event)
+	if merr != nil {
+		return errors.Join(err, fmt.Errorf("encoding event for webhooks: %w", merr))
+	}
+	delivery := webhookDelivery{id: fmt.Sprintf("%s-%d", event.SagaID, s.seq.Add(1)), body: body}
+	for _, ep := range s.endpoints {
+		select {
+		case ep.queue <- delivery:
+		default:
+			log.Printf("WARNING: Event webhook %s is %d deliveries behind, dropping %s/%s of saga %s", ep.url, cap(ep.queue), event.Type, event.Step, event.SagaID)
+		}
+	}
+	return err
+}
+
+// Events returns the events of a saga from the next sink.
+func (s *WebhookEventSink) Events(sagaID string) ([]Event, error) {
+	return s.next.Events(sagaID)
+}
+
+// Close stops accepting events, waits up to the drain timeout for the queued
+// ones to be delivered, abandoning the rest, and closes the next sink.
+func (s *WebhookEventSink) Close() error {
+	s.closeOnce.Do(func() {
+		for _, ep := range s.endpoints {
+			close(ep.queue)
+		}
+		done := make(chan struct{})
+		go func() {
+			s.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-s.cfg.Clock.After(s.cfg.DrainTimeout):
+			log.Printf("WARNING: Event webhooks not drained within %v, abandoning the remaining deliveries", s.cfg.DrainTimeout)
+			s.stop()
+			<-done
+		}
+		s.stop()
+	})
+	return s.next.Close()
+}
+
+// deliverAll delivers an endpoint's queued events in order until the queue is
+// closed and empty, or the sink gives up draining it.
+func (s *WebhookEventSink) deliverAll(ep *webhookEndpoint) {
+	defer s.wg.Done()
+	abandoned := 0
+	for delivery := range ep.queue {
+		if s.ctx.Err() != nil {
+			abandoned++
+			continue
+		}
+		s.deliver(ep, delivery)
+	}
+	if abandoned > 0 {
+		log.Printf("WARNING: Abandoned %d queued event deliveries to %s", abandoned, ep.url)
+	}
+}
+
+// deliver POSTs one event, retrying with backoff until the endpoint accepts
+// it, refuses it for good or the attempts run out.
+func (s *WebhookEventSink) deliver(ep *webhookEndpoint, delivery webhookDelivery) {
+	header := make(http.Header)
+	header.Set(WebhookDeliveryHeader, delivery.id)
+	if s.cfg.Secret != "" {
+		header.Set(WebhookSignatureHeader, SignWebhookBody(s.cfg.Secret, delivery.body))
+	}
+	backoff := s.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := postJSON(s.ctx, s.client, ep.url, delivery.body, header)
+		if err == nil {
+			return
+		}
+		if s.ctx.Err() != nil {
+			log.Printf("WARNING: Abandoned event delivery %s to %s: %v", delivery.id, ep.url, err)
+			return
+		}
+		if !retry || attempt == s.cfg.MaxAttempts {
+			log.Printf("WARNING: Giving up on event delivery %s to %s after %d attempt(s): %v", delivery.id, ep.url, attempt, err)
+			return
+		}
+		select {
+		case <-s.cfg.Clock.After(backoff):
+		case <-s.ctx.Done():
+			log.Printf("WARNING: Abandoned event delivery %s to %s: %v", delivery.id, ep.url, err)
+			return
+		}
+		backoff = min(2*backoff, s.cfg.MaxBackoff)
+	}
+}
+
+// ParseWebhookURLs splits a comma-separated list of endpoint URLs, which must
+// be http or https.
+func ParseWebhookURLs(spec string) ([]string, error) {
+	var urls []string
+	for _, url := range strings.Split(spec, ",") {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return nil, fmt.Errorf("webhook %q: want an http or https URL", url)
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
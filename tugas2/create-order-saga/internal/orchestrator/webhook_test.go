@@ -0,0 +1,176 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"create-order-saga/internal/orchestrator"
+)
+
+// runEventHooks runs saga-1 on fakes with its events delivered per cfg, then
+// closes the sink, which waits for the deliveries, and returns the events.
+func runEventHooks(t *testing.T, cfg orchestrator.EventWebhookConfig) []orchestrator.Event {
+	t.Helper()
+	sink := orchestrator.NewWebhookEventSink(orchestrator.NewRingBufferEventSink(100), cfg)
+	f := newFakeStack(t, orchestrator.WithEventSink(sink))
+	if _, err := f.run("saga-1"); err != nil {
+		t.Fatalf("saga: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	events, err := sink.Events("saga-1")
+	if err != nil || len(events) == 0 {
+		t.Fatalf("Events = %v, %v; want the saga's events", events, err)
+	}
+	return events
+}
+
+// checkDelivered checks body is the JSON of want.
+func checkDelivered(t *testing.T, body string, want orchestrator.Event) {
+	t.Helper()
+	var got orchestrator.Event
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	if got.SagaID != want.SagaID || got.Type != want.Type || got.Step != want.Step || !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("delivered %s, want %s/%s of %s", body, want.Type, want.Step, want.SagaID)
+	}
+}
+
+// TestEventWebhookSignature delivers a saga's events to an endpoint with and
+// without a shared secret: every event arrives once, in order, under its own
+// delivery ID, and signed deliveries verify under the secret and no other.
+func TestEventWebhookSignature(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		secret string
+	}{
+		{"signed", "s3cret"},
+		{"unsigned", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := newWebhook(t, http.StatusOK)
+			events := runEventHooks(t, orchestrator.EventWebhookConfig{URLs: []string{hook.URL}, Secret: tc.secret})
+
+			bodies, headers := hook.attempts(), hook.attemptHeaders()
+			if len(bodies) != len(events) {
+				t.Fatalf("webhook got %d deliveries, want one per event (%d)", len(bodies), len(events))
+			}
+			ids := make(map[string]bool)
+			for i, body := range bodies {
+				checkDelivered(t, body, events[i])
+				id := headers[i].Get(orchestrator.WebhookDeliveryHeader)
+				if id == "" || ids[id] {
+					t.Errorf("delivery %d has ID %q, want a new one", i, id)
+				}
+				ids[id] = true
+				sig := headers[i].Get(orchestrator.WebhookSignatureHeader)
+				if tc.secret == "" {
+					if sig != "" {
+						t.Errorf("unsigned delivery %d has signature %q", i, sig)
+					}
+					continue
+				}
+				if !orchestrator.VerifyWebhookSignature(tc.secret, []byte(body), sig) {
+					t.Errorf("signature %q of delivery %d does not verify", sig, i)
+				}
+				if orchestrator.VerifyWebhookSignature("other", []byte(body), sig) || orchestrator.VerifyWebhookSignature(tc.secret, []byte(body+" "), sig) {
+					t.Errorf("signature %q of delivery %d verifies another secret or body", sig, i)
+				}
+			}
+		})
+	}
+}
+
+// TestEventWebhookRedelivery answers the first delivery attempts with 500:
+// the event is redelivered with the same body and delivery ID until the
+// endpoint accepts it or the attempts run out, and the later events still
+// follow.
+func TestEventWebhookRedelivery(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		retries  int // Extra attempts of the first event
+		perEvent int // Attempts of every other event
+	}{
+		{"accepted on the third attempt", []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK}, 2, 1},
+		{"gives up", []int{http.StatusInternalServerError}, 2, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := newWebhook(t, tc.statuses...)
+			events := runEventHooks(t, orchestrator.EventWebhookConfig{URLs: []string{hook.URL}, MaxAttempts: 3, Backoff: time.Millisecond})
+
+			bodies, headers := hook.attempts(), hook.attemptHeaders()
+			if want := 1 + tc.retries + (len(events)-1)*tc.perEvent; len(bodies) != want {
+				t.Fatalf("webhook got %d attempts, want %d", len(bodies), want)
+			}
+			first := headers[0].Get(orchestrator.WebhookDeliveryHeader)
+			for i := 1; i <= tc.retries; i++ {
+				if bodies[i] != bodies[0] || headers[i].Get(orchestrator.WebhookDeliveryHeader) != first {
+					t.Errorf("attempt %d = %s as %q, want the first event again as %q", i, bodies[i], headers[i].Get(orchestrator.WebhookDeliveryHeader), first)
+				}
+			}
+			checkDelivered(t, bodies[0], events[0])
+			for i, event := range events[1:] {
+				checkDelivered(t, bodies[1+tc.retries+i*tc.perEvent], event)
+			}
+		})
+	}
+}
+
+// TestEventWebhookDeadEndpoint delivers to an endpoint that never answers
+// and to a healthy one: the saga and the healthy endpoint's deliveries go
+// through without waiting on the dead one, and Close abandons it after the
+// drain timeout.
+func TestEventWebhookDeadEndpoint(t *testing.T) {
+	hung := make(chan struct{}, 100)
+	gate := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		hung <- struct{}{}
+		<-gate
+	}))
+	t.Cleanup(dead.Close)
+	t.Cleanup(func() { close(gate) })
+	healthy := newWebhook(t, http.StatusOK)
+
+	sink := orchestrator.NewWebhookEventSink(orchestrator.NewRingBufferEventSink(100), orchestrator.EventWebhookConfig{
+		URLs:         []string{dead.URL, healthy.URL},
+		Timeout:      time.Minute,
+		DrainTimeout: 100 * time.Millisecond,
+	})
+	f := newFakeStack(t, orchestrator.WithEventSink(sink))
+	start := time.Now()
+	if _, err := f.run("saga-1"); err != nil {
+		t.Fatalf("saga: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("saga took %v with a dead event webhook, want it unaffected", elapsed)
+	}
+	events, _ := sink.Events("saga-1")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(healthy.attempts()) < len(events) {
+		if time.Now().After(deadline) {
+			t.Fatalf("healthy webhook got %d of %d events while the other hung", len(healthy.attempts()), len(events))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	<-hung
+
+	start = time.Now()
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close took %v, want about the 100ms drain timeout", elapsed)
+	}
+	if got := len(hung); got != 0 {
+		t.Errorf("dead webhook got %d more attempts, want only the first that hung", got)
+	}
+	for i, body := range healthy.attempts() {
+		checkDelivered(t, body, events[i])
+	}
+}
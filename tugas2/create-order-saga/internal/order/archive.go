@@ -0,0 +1,177 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"create-order-saga/pkg/interceptors"
+	adminpb "create-order-saga/proto/admin"
+	orderpb "create-order-saga/proto/order"
+)
+
+// terminalStatuses are the statuses an order never leaves, the only ones
+// OrderAdmin archives or purges.
+var terminalStatuses = map[orderpb.OrderStatus]bool{
+	orderpb.OrderStatus_COMPLETED: true,
+	orderpb.OrderStatus_CANCELLED: true,
+}
+
+// retirementFilter selects the orders ArchiveOrders and PurgeOrders act on.
+type retirementFilter struct {
+	before   time.Time
+	statuses map[orderpb.OrderStatus]bool
+}
+
+// parseRetirementFilter checks the cutoff and statuses of an ArchiveOrders or
+// PurgeOrders request. No statuses means every terminal status; any other
+// status, PENDING included, is refused.
+func parseRetirementFilter(op string, before *timestamppb.Timestamp, statuses []orderpb.OrderStatus) (retirementFilter, error) {
+	if before == nil || !before.IsValid() {
+		return retirementFilter{}, status.Errorf(codes.InvalidArgument, "%s: a valid before time is required", op)
+	}
+	f := retirementFilter{before: before.AsTime(), statuses: make(map[orderpb.OrderStatus]bool)}
+	for _, st := range statuses {
+		if !terminalStatuses[st] {
+			return retirementFilter{}, status.Errorf(codes.InvalidArgument, "%s: status %s is not terminal, only COMPLETED and CANCELLED orders can be retired", op, st)
+		}
+		f.statuses[st] = true
+	}
+	if len(f.statuses) == 0 {
+		f.statuses = terminalStatuses
+	}
+	return f, nil
+}
+
+// matches reports whether order is in one of f's statuses and last changed
+// before f's cutoff.
+func (f retirementFilter) matches(order *orderpb.Order) bool {
+	if !f.statuses[order.GetStatus()] {
+		return false
+	}
+	changed := order.GetUpdatedAt()
+	if changed == nil {
+		changed = order.GetCreatedAt()
+	}
+	return changed != nil && changed.AsTime().Before(f.before)
+}
+
+// archivedError refuses a change to an archived order.
+func archivedError(orderID string) error {
+	return status.Errorf(codes.FailedPrecondition, "order %s is archived and can no longer be changed", orderID)
+}
+
+// archiveLocked moves the orders in tenant matching f to the archive and
+// returns how many it moved. Stock taken for them stays taken, as archived
+// orders cannot be cancelled. Caller holds s.mu for writing.
+func (s *Server) archiveLocked(tenant string, f retirementFilter) int64 {
+	var n int64
+	for key, order := range s.orders {
+		if key.tenant != tenant || !f.matches(order) {
+			continue
+		}
+		order.Archived = true
+		s.archived[key] = order
+		delete(s.orders, key)
+		delete(s.stockTaken, key)
+		n++
+	}
+	return n
+}
+
+// purgeLocked deletes the orders in tenant matching f, live or archived, with
+// the client references, CreateOrder responses and user index entries
+// pointing at them, and returns how many it deleted. Caller holds s.mu for writing.
+func (s *Server) purgeLocked(tenant string, f retirementFilter) int64 {
+	purged := make(map[string]bool)
+	for _, store := range []map[orderKey]*orderpb.Order{s.orders, s.archived} {
+		for key, order := range store {
+			if key.tenant != tenant || !f.matches(order) {
+				continue
+			}
+			delete(store, key)
+			delete(s.stockTaken, key)
+			purged[key.id] = true
+		}
+	}
+	if len(purged) == 0 {
+		return 0
+	}
+	for key, orderID := range s.references {
+		if key.tenant == tenant && purged[orderID] {
+			delete(s.references, key)
+		}
+	}
+	for key, resp := range s.created {
+		if key.tenant == tenant && purged[resp.GetOrderId().GetId()] {
+			delete(s.created, key)
+		}
+	}
+	for key, orderIDs := range s.byUser {
+		if key.tenant != tenant {
+			continue
+		}
+		if kept := slices.DeleteFunc(orderIDs, func(id string) bool { return purged[id] }); len(kept) > 0 {
+			s.byUser[key] = kept
+		} else {
+			delete(s.byUser, key)
+		}
+	}
+	return int64(len(purged))
+}
+
+// OrderAdmin returns the admin service for archiving and purging old orders
+// at runtime.
+func (s *Server) OrderAdmin() adminpb.OrderAdminServer {
+	return orderAdmin{s: s}
+}
+
+// orderAdmin implements the OrderAdmin service for a Server.
+type orderAdmin struct {
+	adminpb.UnimplementedOrderAdminServer
+	s *Server
+}
+
+// ArchiveOrders implements the OrderAdmin service.
+func (a orderAdmin) ArchiveOrders(ctx context.Context, req *adminpb.ArchiveOrdersRequest) (*adminpb.ArchiveOrdersResponse, error) {
+	log.Printf("Received ArchiveOrders request for %v orders before %s", req.GetStatuses(), req.GetBefore().AsTime().Format(time.RFC3339))
+	f, err := parseRetirementFilter("ArchiveOrders", req.GetBefore(), req.GetStatuses())
+	if err != nil {
+		return nil, err
+	}
+	tenant := interceptors.TenantFromContext(ctx)
+	a.s.mu.Lock()
+	n := a.s.archiveLocked(tenant, f)
+	a.s.mu.Unlock()
+	log.Printf("Archived %d order(s) last changed before %s%s", n, f.before.Format(time.RFC3339), tenantSuffix(tenant))
+	return &adminpb.ArchiveOrdersResponse{Archived: n}, nil
+}
+
+// PurgeOrders implements the OrderAdmin service.
+func (a orderAdmin) PurgeOrders(ctx context.Context, req *adminpb.PurgeOrdersRequest) (*adminpb.PurgeOrdersResponse, error) {
+	log.Printf("Received PurgeOrders request for %v orders before %s", req.GetStatuses(), req.GetBefore().AsTime().Format(time.RFC3339))
+	f, err := parseRetirementFilter("PurgeOrders", req.GetBefore(), req.GetStatuses())
+	if err != nil {
+		return nil, err
+	}
+	tenant := interceptors.TenantFromContext(ctx)
+	a.s.mu.Lock()
+	n := a.s.purgeLocked(tenant, f)
+	a.s.mu.Unlock()
+	log.Printf("WARNING: Purged %d order(s) last changed before %s%s", n, f.before.Format(time.RFC3339), tenantSuffix(tenant))
+	return &adminpb.PurgeOrdersResponse{Purged: n}, nil
+}
+
+// tenantSuffix names tenant for a log line, if there is one.
+func tenantSuffix(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return fmt.Sprintf(" in tenant %s", tenant)
+}
@@ -0,0 +1,257 @@
+package order_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/internal/server"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	adminpb "create-order-saga/proto/admin"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// retireStart is when seedRetirement's first order is created.
+var retireStart = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// seedRetirement creates four orders in ctx's tenant on a fake clock, one an
+// hour, each last changed at the given hour after retireStart:
+//
+//	order-1 COMPLETED at +1h
+//	order-2 CANCELLED at +2h
+//	order-3 PENDING   at +2h (created then)
+//	order-4 COMPLETED at +4h
+func seedRetirement(t *testing.T, s *orderservice.Server, fake *clock.Fake, ctx context.Context) {
+	t.Helper()
+	create := func() *commonpb.OrderID {
+		resp, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")})
+		if err != nil {
+			t.Fatalf("CreateOrder: %v", err)
+		}
+		return resp.GetOrderId()
+	}
+	complete := func(id *commonpb.OrderID) {
+		if _, err := s.CompleteOrder(ctx, &orderpb.CompleteOrderRequest{OrderId: id}); err != nil {
+			t.Fatalf("CompleteOrder %s: %v", id.GetId(), err)
+		}
+	}
+	at := func(hours int) { fake.Set(retireStart.Add(time.Duration(hours) * time.Hour)) }
+
+	at(0)
+	first := create()
+	at(1)
+	complete(first)
+	second := create()
+	at(2)
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: second}); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	create()
+	at(3)
+	fourth := create()
+	at(4)
+	complete(fourth)
+}
+
+// newRetirementServer returns an Order server on a fake clock numbering its
+// orders from order-1.
+func newRetirementServer() (*orderservice.Server, *clock.Fake) {
+	fake := clock.NewFake(retireStart)
+	return orderservice.NewServer(orderservice.WithClock(fake), orderservice.WithIDGenerator(ids.NewSequence())), fake
+}
+
+// before returns the cutoff hours after retireStart.
+func before(hours int) *timestamppb.Timestamp {
+	return timestamppb.New(retireStart.Add(time.Duration(hours) * time.Hour))
+}
+
+// getOrder returns GetOrder's answer for orderID.
+func getOrder(s *orderservice.Server, ctx context.Context, orderID string) (*orderpb.Order, error) {
+	return s.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: &commonpb.OrderID{Id: orderID}})
+}
+
+// TestArchiveOrders archives the seeded orders with growing cutoffs: only
+// terminal orders last changed strictly before the cutoff, and in the chosen
+// statuses, are archived. They stay readable with archived set but can no
+// longer be changed, and PENDING orders are never archived.
+func TestArchiveOrders(t *testing.T) {
+	s, fake := newRetirementServer()
+	ctx := context.Background()
+	seedRetirement(t, s, fake, ctx)
+	admin := s.OrderAdmin()
+
+	for _, tc := range []struct {
+		name     string
+		req      *adminpb.ArchiveOrdersRequest
+		want     int64
+		archived []string // Orders archived so far
+	}{
+		{"cutoff on a change is exclusive", &adminpb.ArchiveOrdersRequest{Before: before(2)}, 1, []string{"order-1"}},
+		{"already archived", &adminpb.ArchiveOrdersRequest{Before: before(2)}, 0, []string{"order-1"}},
+		{"only the statuses asked for", &adminpb.ArchiveOrdersRequest{Before: before(5), Statuses: []orderpb.OrderStatus{orderpb.OrderStatus_CANCELLED}}, 1, []string{"order-1", "order-2"}},
+		{"every terminal status", &adminpb.ArchiveOrdersRequest{Before: before(100)}, 1, []string{"order-1", "order-2", "order-4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := admin.ArchiveOrders(ctx, tc.req)
+			if err != nil || resp.GetArchived() != tc.want {
+				t.Fatalf("ArchiveOrders = %v, %v; want %d archived", resp, err, tc.want)
+			}
+			archived := make(map[string]bool)
+			for _, id := range tc.archived {
+				archived[id] = true
+			}
+			for _, id := range []string{"order-1", "order-2", "order-3", "order-4"} {
+				order, err := getOrder(s, ctx, id)
+				if err != nil || order.GetArchived() != archived[id] {
+					t.Errorf("GetOrder(%s) = archived %t, %v; want archived %t", id, order.GetArchived(), err, archived[id])
+				}
+			}
+		})
+	}
+
+	if order, _ := getOrder(s, ctx, "order-3"); order.GetStatus() != orderpb.OrderStatus_PENDING {
+		t.Errorf("order-3 is %s, want still PENDING", order.GetStatus())
+	}
+	id := &commonpb.OrderID{Id: "order-1"}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: id}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("CancelOrder of an archived order = %v, want FailedPrecondition", err)
+	}
+	if _, err := s.CompleteOrder(ctx, &orderpb.CompleteOrderRequest{OrderId: id}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("CompleteOrder of an archived order = %v, want FailedPrecondition", err)
+	}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: &commonpb.OrderID{Id: "order-3"}}); err != nil {
+		t.Errorf("CancelOrder of the PENDING order: %v", err)
+	}
+}
+
+// TestPurgeOrders purges the seeded orders, live and archived: purge honours
+// the same cutoff and statuses as archiving, purged orders are gone, and
+// the PENDING order survives a cutoff past every order.
+func TestPurgeOrders(t *testing.T) {
+	s, fake := newRetirementServer()
+	ctx := context.Background()
+	seedRetirement(t, s, fake, ctx)
+	admin := s.OrderAdmin()
+	if _, err := admin.ArchiveOrders(ctx, &adminpb.ArchiveOrdersRequest{Before: before(100), Statuses: []orderpb.OrderStatus{orderpb.OrderStatus_COMPLETED}}); err != nil {
+		t.Fatalf("ArchiveOrders: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		req   *adminpb.PurgeOrdersRequest
+		want  int64
+		alive []string // Orders left
+	}{
+		{"cutoff on a change is exclusive", &adminpb.PurgeOrdersRequest{Before: before(2)}, 1, []string{"order-2", "order-3", "order-4"}},
+		{"only the statuses asked for", &adminpb.PurgeOrdersRequest{Before: before(100), Statuses: []orderpb.OrderStatus{orderpb.OrderStatus_CANCELLED}}, 1, []string{"order-3", "order-4"}},
+		{"every terminal status", &adminpb.PurgeOrdersRequest{Before: before(100)}, 1, []string{"order-3"}},
+		{"nothing left but PENDING", &adminpb.PurgeOrdersRequest{Before: before(100)}, 0, []string{"order-3"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := admin.PurgeOrders(ctx, tc.req)
+			if err != nil || resp.GetPurged() != tc.want {
+				t.Fatalf("PurgeOrders = %v, %v; want %d purged", resp, err, tc.want)
+			}
+			alive := make(map[string]bool)
+			for _, id := range tc.alive {
+				alive[id] = true
+			}
+			for _, id := range []string{"order-1", "order-2", "order-3", "order-4"} {
+				_, err := getOrder(s, ctx, id)
+				if alive[id] && err != nil {
+					t.Errorf("GetOrder(%s) = %v, want it kept", id, err)
+				}
+				if !alive[id] && status.Code(err) != codes.NotFound {
+					t.Errorf("GetOrder(%s) = %v, want NotFound once purged", id, err)
+				}
+			}
+		})
+	}
+	if n := orderCount(t, s); n != 1 {
+		t.Errorf("%d orders listed, want only the PENDING one", n)
+	}
+}
+
+// TestRetireOrdersRequests checks ArchiveOrders and PurgeOrders refuse a
+// missing cutoff and any non-terminal status, PENDING above all, without
+// touching a single order, and only act in the caller's tenant.
+func TestRetireOrdersRequests(t *testing.T) {
+	s, fake := newRetirementServer()
+	tenantA, tenantB := interceptors.WithTenant(context.Background(), "tenant-a"), interceptors.WithTenant(context.Background(), "tenant-b")
+	seedRetirement(t, s, fake, tenantA)
+	admin := s.OrderAdmin()
+
+	pending := []orderpb.OrderStatus{orderpb.OrderStatus_COMPLETED, orderpb.OrderStatus_PENDING}
+	if _, err := admin.ArchiveOrders(tenantA, &adminpb.ArchiveOrdersRequest{Before: before(100), Statuses: pending}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ArchiveOrders of PENDING orders = %v, want InvalidArgument", err)
+	}
+	if _, err := admin.PurgeOrders(tenantA, &adminpb.PurgeOrdersRequest{Before: before(100), Statuses: pending}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("PurgeOrders of PENDING orders = %v, want InvalidArgument", err)
+	}
+	if _, err := admin.ArchiveOrders(tenantA, &adminpb.ArchiveOrdersRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ArchiveOrders without a cutoff = %v, want InvalidArgument", err)
+	}
+	if _, err := admin.PurgeOrders(tenantA, &adminpb.PurgeOrdersRequest{Before: &timestamppb.Timestamp{Seconds: -1 << 62}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("PurgeOrders with an invalid cutoff = %v, want InvalidArgument", err)
+	}
+	if resp, err := admin.PurgeOrders(tenantB, &adminpb.PurgeOrdersRequest{Before: before(100)}); err != nil || resp.GetPurged() != 0 {
+		t.Errorf("PurgeOrders in another tenant = %v, %v; want 0 purged", resp, err)
+	}
+	for _, id := range []string{"order-1", "order-2", "order-3", "order-4"} {
+		if order, err := getOrder(s, tenantA, id); err != nil || order.GetArchived() {
+			t.Errorf("GetOrder(%s) = %v, %v; want it untouched", id, order, err)
+		}
+	}
+}
+
+// TestOrderAdminRequiresAPIKey serves OrderAdmin behind API keys, as the
+// Order service does with -enable-admin: calls without the key are refused
+// before reaching it.
+func TestOrderAdminRequiresAPIKey(t *testing.T) {
+	s, fake := newRetirementServer()
+	seedRetirement(t, s, fake, context.Background())
+	lis := bufconn.Listen(1 << 20)
+	srv := server.NewGRPCServer(server.Config{Auth: interceptors.NewStaticKeys("secret")})
+	adminpb.RegisterOrderAdminServer(srv, s.OrderAdmin())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///order",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := adminpb.NewOrderAdminClient(conn)
+
+	req := &adminpb.PurgeOrdersRequest{Before: before(100)}
+	if _, err := client.PurgeOrders(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("PurgeOrders without a key = %v, want Unauthenticated", err)
+	}
+	wrong := metadata.AppendToOutgoingContext(context.Background(), interceptors.APIKeyHeader, "guess")
+	if _, err := client.PurgeOrders(wrong, req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("PurgeOrders with a wrong key = %v, want Unauthenticated", err)
+	}
+	if n := orderCount(t, s); n != 4 {
+		t.Fatalf("%d orders left after refused purges, want 4", n)
+	}
+	authorized := metadata.AppendToOutgoingContext(context.Background(), interceptors.APIKeyHeader, "secret")
+	if resp, err := client.PurgeOrders(authorized, req); err != nil || resp.GetPurged() != 3 {
+		t.Errorf("PurgeOrders with the key = %v, %v; want 3 purged", resp, err)
+	}
+}
@@ -0,0 +1,64 @@
+package order_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/pkg/clock"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// TestCancelOrderRecordsReason cancels an order with a reason and cause: GetOrder
+// reports both with the time of the cancellation, in the order and its status
+// history, and a repeated cancellation keeps the first reason.
+func TestCancelOrderRecordsReason(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(created)
+	s := orderservice.NewServer(orderservice.WithClock(fake))
+	ctx := context.Background()
+	resp, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": 1}))
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	get := func() *orderpb.Order {
+		t.Helper()
+		order, err := s.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: resp.GetOrderId()})
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		return order
+	}
+	if order := get(); order.GetCancellationReason() != "" || order.GetCancelledAt() != nil || order.GetCancellationCause() != commonpb.CompensationCause_COMPENSATION_CAUSE_UNSPECIFIED {
+		t.Errorf("pending order has cancellation reason %q at %v (%s), want none", order.GetCancellationReason(), order.GetCancelledAt(), order.GetCancellationCause())
+	}
+
+	fake.Advance(5 * time.Minute)
+	cancelled := fake.Now()
+	cancel, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: resp.GetOrderId(), Reason: "payment_failed", Cause: commonpb.CompensationCause_PAYMENT_FAILED})
+	if err != nil || !cancel.GetSuccess() {
+		t.Fatalf("CancelOrder = %v, %v", cancel, err)
+	}
+	order := get()
+	if order.GetStatus() != orderpb.OrderStatus_CANCELLED || order.GetCancellationReason() != "payment_failed" || order.GetCancellationCause() != commonpb.CompensationCause_PAYMENT_FAILED {
+		t.Errorf("order is %s (%q, %s), want CANCELLED for payment_failed", order.GetStatus(), order.GetCancellationReason(), order.GetCancellationCause())
+	}
+	if !order.GetCancelledAt().AsTime().Equal(cancelled) || !cancel.GetCompensatedAt().AsTime().Equal(cancelled) {
+		t.Errorf("cancelled at %v (response %v), want %v", order.GetCancelledAt().AsTime(), cancel.GetCompensatedAt().AsTime(), cancelled)
+	}
+	history := order.GetStatusHistory()
+	if last := history[len(history)-1]; last.GetStatus() != orderpb.OrderStatus_CANCELLED || last.GetReason() != "payment_failed" || last.GetCause() != commonpb.CompensationCause_PAYMENT_FAILED || !last.GetChangedAt().AsTime().Equal(cancelled) {
+		t.Errorf("last status change = %v, want the cancellation", last)
+	}
+
+	fake.Advance(time.Minute)
+	again, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: resp.GetOrderId(), Reason: "customer_cancelled", Cause: commonpb.CompensationCause_MANUAL})
+	if err != nil || !again.GetAlreadyApplied() || !again.GetCompensatedAt().AsTime().Equal(cancelled) {
+		t.Fatalf("repeated CancelOrder = %v, %v; want it already applied at %v", again, err, cancelled)
+	}
+	if order := get(); order.GetCancellationReason() != "payment_failed" || !order.GetCancelledAt().AsTime().Equal(cancelled) || len(order.GetStatusHistory()) != len(history) {
+		t.Errorf("after a repeated cancellation the order is %q at %v with %d status changes, want the first cancellation kept", order.GetCancellationReason(), order.GetCancelledAt().AsTime(), len(order.GetStatusHistory()))
+	}
+}
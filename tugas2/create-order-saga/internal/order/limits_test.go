@@ -0,0 +1,82 @@
+package order_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// itemsOrder returns an order of n line items of quantity units each.
+func itemsOrder(n int, quantity int32) *commonpb.OrderDetails {
+	details := &commonpb.OrderDetails{UserId: "user-1"}
+	for i := range n {
+		details.Items = append(details.Items, &commonpb.Item{
+			ProductId: fmt.Sprintf("prod-%d", i),
+			Sku:       fmt.Sprintf("SKU-%d", i),
+			Quantity:  quantity,
+			Price:     money.MustParse(money.DefaultCurrency, "1.00"),
+		})
+	}
+	return details
+}
+
+// TestCreateOrderLimits creates orders at and just over each limit: an order
+// at the limit is accepted, one over it is rejected with InvalidArgument and
+// an ORDER_TOO_LARGE reason naming the field, and ValidateOrder flags the
+// same field. A limit of 0 disables it.
+func TestCreateOrderLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		opts      []orderservice.Option
+		details   *commonpb.OrderDetails
+		wantField string // Empty if the order is accepted
+	}{
+		{"items at limit", []orderservice.Option{orderservice.WithMaxItems(3)}, itemsOrder(3, 1), ""},
+		{"items over limit", []orderservice.Option{orderservice.WithMaxItems(3)}, itemsOrder(4, 1), "details.items"},
+		{"items unlimited", []orderservice.Option{orderservice.WithMaxItems(0)}, itemsOrder(orderservice.DefaultMaxItems+1, 1), ""},
+		{"items at default limit", nil, itemsOrder(orderservice.DefaultMaxItems, 1), ""},
+		{"items over default limit", nil, itemsOrder(orderservice.DefaultMaxItems+1, 1), "details.items"},
+		{"quantity at limit", []orderservice.Option{orderservice.WithMaxQuantityPerItem(5)}, itemsOrder(2, 5), ""},
+		{"quantity over limit", []orderservice.Option{orderservice.WithMaxQuantityPerItem(5)}, itemsOrder(1, 6), "details.items[0].quantity"},
+		{"quantity unlimited", []orderservice.Option{orderservice.WithMaxQuantityPerItem(0)}, itemsOrder(1, orderservice.DefaultMaxQuantityPerItem+1), ""},
+		{"quantity at default limit", nil, itemsOrder(1, orderservice.DefaultMaxQuantityPerItem), ""},
+		{"quantity over default limit", nil, itemsOrder(1, orderservice.DefaultMaxQuantityPerItem+1), "details.items[0].quantity"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := orderservice.NewServer(tc.opts...)
+			ctx := context.Background()
+			validation, err := s.ValidateOrder(ctx, &orderpb.ValidateOrderRequest{Details: tc.details})
+			if err != nil {
+				t.Fatalf("ValidateOrder: %v", err)
+			}
+			_, err = s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: tc.details})
+			if tc.wantField == "" {
+				if err != nil || !validation.GetValid() {
+					t.Errorf("CreateOrder = %v, ValidateOrder = %v; want the order accepted", err, validation)
+				}
+				return
+			}
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("CreateOrder = %v, want InvalidArgument", err)
+			}
+			if info, _ := errinfo.From(err); info.GetReason() != errinfo.ReasonOrderTooLarge || info.GetMetadata()["field"] != tc.wantField {
+				t.Errorf("error info = %v, want %s for %s", info, errinfo.ReasonOrderTooLarge, tc.wantField)
+			}
+			if n := orderCount(t, s); n != 0 {
+				t.Errorf("%d orders stored, want none", n)
+			}
+			if v := validation.GetViolations(); len(v) != 1 || v[0].GetField() != tc.wantField {
+				t.Errorf("ValidateOrder violations = %v, want one for %s", v, tc.wantField)
+			}
+		})
+	}
+}
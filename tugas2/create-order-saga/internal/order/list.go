@@ -0,0 +1,174 @@
+package order
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/interceptors"
+	orderpb "create-order-saga/proto/order"
+)
+
+// ListOrders page sizes.
+const (
+	DefaultOrderPageSize = 50
+	MaxOrderPageSize     = 500
+)
+
+// orderPosition is where an order sorts in ListOrders: by creation time, then ID.
+type orderPosition struct {
+	created int64 // Unix nanoseconds
+	id      string
+}
+
+func positionOf(order *orderpb.Order) orderPosition {
+	return orderPosition{created: order.GetCreatedAt().AsTime().UnixNano(), id: order.Id}
+}
+
+func (p orderPosition) compare(q orderPosition) int {
+	if c := cmp.Compare(p.created, q.created); c != 0 {
+		return c
+	}
+	return strings.Compare(p.id, q.id)
+}
+
+// String encodes p as a page token, e.g. "1712345678000000000/order-u1".
+func (p orderPosition) String() string {
+	return fmt.Sprintf("%d/%s", p.created, p.id)
+}
+
+// parseOrderPosition decodes a page token made by orderPosition.String.
+func parseOrderPosition(token string) (orderPosition, error) {
+	created, id, ok := strings.Cut(token, "/")
+	n, err := strconv.ParseInt(created, 10, 64)
+	if !ok || err != nil || id == "" {
+		return orderPosition{}, status.Errorf(codes.InvalidArgument, "invalid page token %q", token)
+	}
+	return orderPosition{created: n, id: id}, nil
+}
+
+// ListOrders returns the orders in the caller's tenant in the requested
+// statuses, oldest first, a page at a time. Archived orders are left out
+// unless asked for.
+func (s *Server) ListOrders(ctx context.Context, req *orderpb.ListOrdersRequest) (*orderpb.ListOrdersResponse, error) {
+	log.Printf("Received ListOrders request for statuses: %v, archived: %t", req.GetStatuses(), req.GetIncludeArchived())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ListOrders aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "page size %d must not be negative", pageSize)
+	case pageSize == 0:
+		pageSize = DefaultOrderPageSize
+	case pageSize > MaxOrderPageSize:
+		pageSize = MaxOrderPageSize
+	}
+	var after *orderPosition
+	if token := req.GetPageToken(); token != "" {
+		p, err := parseOrderPosition(token)
+		if err != nil {
+			return nil, err
+		}
+		after = &p
+	}
+	statuses := make(map[orderpb.OrderStatus]bool)
+	for _, st := range req.GetStatuses() {
+		statuses[st] = true
+	}
+
+	tenant := interceptors.TenantFromContext(ctx)
+	stores := []map[orderKey]*orderpb.Order{s.orders}
+	if req.GetIncludeArchived() {
+		stores = append(stores, s.archived)
+	}
+	var orders []*orderpb.Order
+	s.mu.RLock()
+	for _, store := range stores {
+		for key, order := range store {
+			if key.tenant != tenant || (len(statuses) > 0 && !statuses[order.GetStatus()]) {
+				continue
+			}
+			if after != nil && positionOf(order).compare(*after) <= 0 {
+				continue
+			}
+			orders = append(orders, proto.Clone(order).(*orderpb.Order))
+		}
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(orders, func(a, b *orderpb.Order) int {
+		return positionOf(a).compare(positionOf(b))
+	})
+
+	resp := &orderpb.ListOrdersResponse{Orders: orders}
+	if len(orders) > pageSize {
+		resp.Orders = orders[:pageSize]
+		resp.NextPageToken = positionOf(resp.Orders[pageSize-1]).String()
+	}
+	return resp, nil
+}
+
+// GetOrdersByUser streams the orders of a user in the caller's tenant,
+// archived ones included, oldest first, optionally only those in the
+// requested statuses. The orders are copied when the call starts, so orders
+// created while streaming are left out. Streaming stops when the caller goes
+// away.
+func (s *Server) GetOrdersByUser(req *orderpb.GetOrdersByUserRequest, stream orderpb.OrderService_GetOrdersByUserServer) error {
+	ctx := stream.Context()
+	userID := req.GetUserId()
+	log.Printf("Received GetOrdersByUser request for user ID: %s, statuses: %v", userID, req.GetStatusFilter())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("GetOrdersByUser aborted during simulated latency: %v", err)
+		return err
+	}
+
+	if userID == "" {
+		return status.Error(codes.InvalidArgument, "user ID is required")
+	}
+	statuses := make(map[orderpb.OrderStatus]bool)
+	for _, st := range req.GetStatusFilter() {
+		statuses[st] = true
+	}
+
+	tenant := interceptors.TenantFromContext(ctx)
+	var orders []*orderpb.Order
+	s.mu.RLock()
+	for _, orderID := range s.byUser[keyFor(ctx, userID)] {
+		key := orderKey{tenant: tenant, id: orderID}
+		order, ok := s.orders[key]
+		if !ok {
+			order, ok = s.archived[key]
+		}
+		if !ok || (len(statuses) > 0 && !statuses[order.GetStatus()]) {
+			continue
+		}
+		orders = append(orders, proto.Clone(order).(*orderpb.Order))
+	}
+	s.mu.RUnlock()
+
+	for _, order := range orders {
+		if err := ctx.Err(); err != nil {
+			log.Printf("GetOrdersByUser for user %s stopped: %v", userID, err)
+			return status.FromContextError(err).Err()
+		}
+		if err := stream.Send(order); err != nil {
+			return err
+		}
+	}
+	log.Printf("Streamed %d order(s) of user %s", len(orders), userID)
+	return nil
+}
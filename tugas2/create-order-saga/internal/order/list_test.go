@@ -0,0 +1,202 @@
+package order_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// dialOrders serves s on a bufconn listener, with the server's tenant
+// interceptors and any extra stream interceptors, and returns a client for it.
+func dialOrders(t *testing.T, s *orderservice.Server, stream ...grpc.StreamServerInterceptor) orderpb.OrderServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors.TenantUnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(append([]grpc.StreamServerInterceptor{interceptors.TenantStreamServerInterceptor()}, stream...)...),
+	)
+	orderpb.RegisterOrderServiceServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///order",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithChainUnaryInterceptor(interceptors.TenantUnaryClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return orderpb.NewOrderServiceClient(conn)
+}
+
+// inTenant returns a context whose calls are made in tenant.
+func inTenant(tenant string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), interceptors.TenantHeader, tenant)
+}
+
+// createOrders creates n orders for userID in ctx's tenant and returns their IDs.
+func createOrders(t *testing.T, client orderpb.OrderServiceClient, ctx context.Context, userID string, n int) []string {
+	t.Helper()
+	orderIDs := make([]string, n)
+	for i := range orderIDs {
+		resp, err := client.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder(userID)})
+		if err != nil {
+			t.Fatalf("CreateOrder %d for %s: %v", i, userID, err)
+		}
+		orderIDs[i] = resp.GetOrderId().GetId()
+	}
+	return orderIDs
+}
+
+// streamedIDs reads a GetOrdersByUser stream to its end and returns the IDs
+// of the orders it sent.
+func streamedIDs(t *testing.T, client orderpb.OrderServiceClient, ctx context.Context, req *orderpb.GetOrdersByUserRequest) []string {
+	t.Helper()
+	stream, err := client.GetOrdersByUser(ctx, req)
+	if err != nil {
+		t.Fatalf("GetOrdersByUser: %v", err)
+	}
+	var orderIDs []string
+	for {
+		order, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return orderIDs
+		}
+		if err != nil {
+			t.Fatalf("receiving orders: %v", err)
+		}
+		orderIDs = append(orderIDs, order.GetId())
+	}
+}
+
+func TestGetOrdersByUserContents(t *testing.T) {
+	client := dialOrders(t, orderservice.NewServer(orderservice.WithIDGenerator(ids.NewSequence())))
+	tenantA, tenantB := inTenant("tenant-a"), inTenant("tenant-b")
+	mine := createOrders(t, client, tenantA, "user-1", 4)
+	createOrders(t, client, tenantA, "user-2", 2)
+	createOrders(t, client, tenantB, "user-1", 3)
+	if _, err := client.CancelOrder(tenantA, &orderpb.CancelOrderRequest{OrderId: &commonpb.OrderID{Id: mine[1]}, Reason: "changed my mind"}); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		filter  []orderpb.OrderStatus
+		wantIDs []string
+	}{
+		{"every status", nil, mine},
+		{"pending", []orderpb.OrderStatus{orderpb.OrderStatus_PENDING}, []string{mine[0], mine[2], mine[3]}},
+		{"cancelled", []orderpb.OrderStatus{orderpb.OrderStatus_CANCELLED}, []string{mine[1]}},
+		{"completed", []orderpb.OrderStatus{orderpb.OrderStatus_COMPLETED}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := streamedIDs(t, client, tenantA, &orderpb.GetOrdersByUserRequest{UserId: "user-1", StatusFilter: tc.filter})
+			if !slices.Equal(got, tc.wantIDs) {
+				t.Errorf("streamed %v, want %v oldest first", got, tc.wantIDs)
+			}
+		})
+	}
+	if got := streamedIDs(t, client, tenantA, &orderpb.GetOrdersByUserRequest{UserId: "user-3"}); len(got) != 0 {
+		t.Errorf("streamed %v for a user without orders, want none", got)
+	}
+}
+
+// TestListOrdersPages walks ListOrders page by page and checks the pages
+// hold every order of the tenant once, in the order GetOrdersByUser streams
+// them.
+func TestListOrdersPages(t *testing.T) {
+	client := dialOrders(t, orderservice.NewServer(orderservice.WithIDGenerator(ids.NewSequence())))
+	ctx := inTenant("tenant-a")
+	want := createOrders(t, client, ctx, "user-1", 7)
+	createOrders(t, client, inTenant("tenant-b"), "user-1", 2)
+
+	var got []string
+	var sizes []int
+	token := ""
+	for {
+		page, err := client.ListOrders(ctx, &orderpb.ListOrdersRequest{PageSize: 3, PageToken: token})
+		if err != nil {
+			t.Fatalf("ListOrders page %d: %v", len(sizes)+1, err)
+		}
+		sizes = append(sizes, len(page.GetOrders()))
+		for _, order := range page.GetOrders() {
+			got = append(got, order.GetId())
+		}
+		if token = page.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	if !slices.Equal(sizes, []int{3, 3, 1}) {
+		t.Errorf("page sizes %v, want [3 3 1]", sizes)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("pages held %v, want %v", got, want)
+	}
+	if streamed := streamedIDs(t, client, ctx, &orderpb.GetOrdersByUserRequest{UserId: "user-1"}); !slices.Equal(streamed, got) {
+		t.Errorf("GetOrdersByUser streamed %v, ListOrders paged %v", streamed, got)
+	}
+
+	_, err := client.ListOrders(ctx, &orderpb.ListOrdersRequest{PageToken: "not-a-token"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListOrders with a bad token returned %v, want InvalidArgument", err)
+	}
+}
+
+// TestGetOrdersByUserStopsWhenClientCancels cancels a stream too long to fit
+// in the transport's buffers after its first order, and checks the handler
+// returns instead of staying blocked on the departed client.
+func TestGetOrdersByUserStopsWhenClientCancels(t *testing.T) {
+	returned := make(chan error, 1)
+	watch := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		returned <- err
+		return err
+	}
+	s := orderservice.NewServer(orderservice.WithIDGenerator(ids.NewSequence()))
+	const n = 2000
+	for i := range n {
+		if _, err := s.CreateOrder(context.Background(), &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")}); err != nil {
+			t.Fatalf("CreateOrder %d: %v", i, err)
+		}
+	}
+	client := dialOrders(t, s, watch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.GetOrdersByUser(ctx, &orderpb.GetOrdersByUserRequest{UserId: "user-1"})
+	if err != nil {
+		t.Fatalf("GetOrdersByUser: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("receiving the first order: %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-returned:
+		if err == nil {
+			t.Errorf("handler finished streaming %d orders to a cancelled client", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still running 5s after the client cancelled")
+	}
+}
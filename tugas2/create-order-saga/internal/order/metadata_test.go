@@ -0,0 +1,98 @@
+package order_test
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/interceptors"
+	orderpb "create-order-saga/proto/order"
+)
+
+// metadataOf returns n metadata keys each holding a value of size bytes.
+func metadataOf(n, size int) map[string]string {
+	md := make(map[string]string, n)
+	for i := range n {
+		md[fmt.Sprintf("key-%02d", i)] = strings.Repeat("v", size)
+	}
+	return md
+}
+
+// TestCreateOrderMetadataLimits creates orders with metadata at and just over
+// the key count and value size limits.
+func TestCreateOrderMetadataLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		metadata  map[string]string
+		wantField string // Empty if the order is accepted
+	}{
+		{"keys at limit", metadataOf(orderservice.MaxMetadataKeys, 1), ""},
+		{"keys over limit", metadataOf(orderservice.MaxMetadataKeys+1, 1), "details.metadata"},
+		{"value at limit", metadataOf(1, orderservice.MaxMetadataValueBytes), ""},
+		{"value over limit", metadataOf(1, orderservice.MaxMetadataValueBytes+1), `details.metadata["key-00"]`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := orderservice.NewServer()
+			details := sagatest.SampleOrder("user-1")
+			details.Metadata = tc.metadata
+			resp, err := s.CreateOrder(context.Background(), &orderpb.CreateOrderRequest{Details: details})
+			if tc.wantField == "" {
+				if err != nil {
+					t.Fatalf("CreateOrder: %v", err)
+				}
+				order, _ := s.Lookup(context.Background(), resp.GetOrderId().GetId())
+				if !maps.Equal(order.GetMetadata(), tc.metadata) {
+					t.Errorf("stored metadata = %v, want it as submitted", order.GetMetadata())
+				}
+				return
+			}
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("CreateOrder = %v, want InvalidArgument", err)
+			}
+			if info, _ := errinfo.From(err); info.GetMetadata()["field"] != tc.wantField {
+				t.Errorf("error info = %v, want it to name %s", info, tc.wantField)
+			}
+			if n := orderCount(t, s); n != 0 {
+				t.Errorf("%d orders stored, want none", n)
+			}
+		})
+	}
+}
+
+func TestGetOrderByClientReference(t *testing.T) {
+	s := orderservice.NewServer()
+	acme := interceptors.WithTenant(context.Background(), "acme")
+	details := sagatest.SampleOrder("user-1")
+	details.ClientReferenceId = "web-1001"
+	created, err := s.CreateOrder(acme, &orderpb.CreateOrderRequest{Details: details})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	order, err := s.GetOrderByClientReference(acme, &orderpb.GetOrderByClientReferenceRequest{ClientReferenceId: "web-1001"})
+	if err != nil || order.GetId() != created.GetOrderId().GetId() || order.GetClientReferenceId() != "web-1001" {
+		t.Errorf("GetOrderByClientReference = %v, %v; want order %s", order, err, created.GetOrderId().GetId())
+	}
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		ref  string
+		want codes.Code
+	}{
+		{"unknown reference", acme, "web-9999", codes.NotFound},
+		{"other tenant", interceptors.WithTenant(context.Background(), "globex"), "web-1001", codes.NotFound},
+		{"empty reference", acme, "", codes.InvalidArgument},
+	} {
+		if _, err := s.GetOrderByClientReference(tc.ctx, &orderpb.GetOrderByClientReferenceRequest{ClientReferenceId: tc.ref}); status.Code(err) != tc.want {
+			t.Errorf("%s: GetOrderByClientReference = %v, want %s", tc.name, err, tc.want)
+		}
+	}
+}
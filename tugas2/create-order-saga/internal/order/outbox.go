@@ -0,0 +1,174 @@
+package order
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	orderpb "create-order-saga/proto/order"
+)
+
+// EventOrderCreated is the type of the outbox event written for every new order.
+const EventOrderCreated = "OrderCreated"
+
+// DefaultOutboxPollInterval is how often an OutboxRelay looks for unpublished events.
+const DefaultOutboxPollInterval = time.Second
+
+// outboxBatchSize caps the events an OutboxRelay publishes per poll.
+const outboxBatchSize = 100
+
+// OutboxEvent is a row of the order service's outbox: an event written in the
+// same critical section as the change it describes, so it exists if and only
+// if the change does, and published later by an OutboxRelay.
+type OutboxEvent struct {
+	ID          int64
+	Type        string // e.g. EventOrderCreated
+	Tenant      string
+	OrderID     string
+	Payload     []byte // The order as protojson, as it was when the event was written
+	CreatedAt   time.Time
+	PublishedAt time.Time // Zero until published
+	Attempts    int       // Failed publish attempts so far
+	LastError   string
+}
+
+// Published reports whether the event has been published.
+func (e OutboxEvent) Published() bool {
+	return !e.PublishedAt.IsZero()
+}
+
+// appendOutboxLocked writes an event about order to the outbox. Caller holds s.mu.
+func (s *Server) appendOutboxLocked(tenant, typ string, order *orderpb.Order, now time.Time) {
+	payload, err := protojson.Marshal(order)
+	if err != nil { // Cannot happen for a well-formed order; keep the event without its payload
+		log.Printf("WARNING: Encoding %s event for order %s: %v", typ, order.GetId(), err)
+	}
+	s.outboxSeq++
+	s.outbox = append(s.outbox, &OutboxEvent{
+		ID:        s.outboxSeq,
+		Type:      typ,
+		Tenant:    tenant,
+		OrderID:   order.GetId(),
+		Payload:   payload,
+		CreatedAt: now,
+	})
+}
+
+// OutboxEvents returns copies of every outbox event, oldest first, for
+// in-process inspection.
+func (s *Server) OutboxEvents() []OutboxEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := make([]OutboxEvent, len(s.outbox))
+	for i, e := range s.outbox {
+		events[i] = *e
+	}
+	return events
+}
+
+// pendingOutbox returns copies of up to limit unpublished events, oldest first.
+func (s *Server) pendingOutbox(limit int) []OutboxEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var events []OutboxEvent
+	for _, e := range s.outbox[s.outboxSent:] {
+		if len(events) == limit {
+			break
+		}
+		if !e.Published() {
+			events = append(events, *e)
+		}
+	}
+	return events
+}
+
+// markOutbox records the outcome of publishing event id.
+func (s *Server) markOutbox(id int64, publishErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.outbox[id-1] // IDs count up from 1 and rows are never removed
+	if publishErr != nil {
+		e.Attempts++
+		e.LastError = publishErr.Error()
+		return
+	}
+	e.PublishedAt = s.clock.Now()
+	e.LastError = ""
+	// Advance past the published prefix so polls skip it
+	for s.outboxSent < len(s.outbox) && s.outbox[s.outboxSent].Published() {
+		s.outboxSent++
+	}
+}
+
+// Publisher delivers outbox events, e.g. to a message broker.
+type Publisher interface {
+	Publish(ctx context.Context, event OutboxEvent) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface.
+type PublisherFunc func(ctx context.Context, event OutboxEvent) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(ctx context.Context, event OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// LogPublisher "publishes" events by logging them, for running without a broker.
+var LogPublisher = PublisherFunc(func(ctx context.Context, event OutboxEvent) error {
+	log.Printf("Published %s event %d for order %s (tenant %q): %s", event.Type, event.ID, event.OrderID, event.Tenant, event.Payload)
+	return nil
+})
+
+// OutboxRelay publishes a Server's outbox events in order and marks them
+// published. Delivery is at least once: an event whose publication fails, or
+// whose success is not recorded before a crash, is published again, so
+// consumers must tolerate duplicates (the event ID identifies them).
+type OutboxRelay struct {
+	server    *Server
+	publisher Publisher
+	interval  time.Duration
+}
+
+// NewOutboxRelay creates a relay polling s every interval
+// (DefaultOutboxPollInterval if zero or less) and publishing through p.
+func NewOutboxRelay(s *Server, p Publisher, interval time.Duration) *OutboxRelay {
+	if interval <= 0 {
+		interval = DefaultOutboxPollInterval
+	}
+	return &OutboxRelay{server: s, publisher: p, interval: interval}
+}
+
+// RelayOnce publishes a batch of unpublished events, oldest first, and returns
+// how many were published. It stops at the first failure so events are
+// published in order; the failed event is retried on the next poll.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) int {
+	published := 0
+	for _, event := range r.server.pendingOutbox(outboxBatchSize) {
+		if ctx.Err() != nil {
+			break
+		}
+		err := r.publisher.Publish(ctx, event)
+		r.server.markOutbox(event.ID, err)
+		if err != nil {
+			log.Printf("Publishing %s event %d for order %s failed (attempt %d), retrying in %v: %v",
+				event.Type, event.ID, event.OrderID, event.Attempts+1, r.interval, err)
+			break
+		}
+		published++
+	}
+	return published
+}
+
+// Run relays events every poll interval until ctx is done. Run it in its own goroutine.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.server.clock.After(r.interval):
+		}
+		r.RelayOnce(ctx)
+	}
+}
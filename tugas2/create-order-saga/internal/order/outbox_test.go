@@ -0,0 +1,214 @@
+package order_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/interceptors"
+	orderpb "create-order-saga/proto/order"
+)
+
+// TestOutboxWrittenWithOrder checks CreateOrder writes exactly one
+// OrderCreated event carrying the new order, and none for a refused order or
+// a repeated request.
+func TestOutboxWrittenWithOrder(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	s := orderservice.NewServer(orderservice.WithClock(fake), orderservice.WithStock(map[string]int64{"prod-A": 2}))
+	ctx := interceptors.WithTenant(context.Background(), "acme")
+
+	req := &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1"), RequestId: "req-1"}
+	resp, err := s.CreateOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if _, err := s.CreateOrder(ctx, req); err != nil {
+		t.Fatalf("repeated CreateOrder: %v", err)
+	}
+	if _, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-2")}); err == nil {
+		t.Fatal("CreateOrder with prod-A out of stock succeeded")
+	}
+
+	events := s.OutboxEvents()
+	if len(events) != 1 {
+		t.Fatalf("outbox holds %d events, want one for the one order created", len(events))
+	}
+	e := events[0]
+	orderID := resp.GetOrderId().GetId()
+	if e.ID != 1 || e.Type != orderservice.EventOrderCreated || e.Tenant != "acme" || e.OrderID != orderID || !e.CreatedAt.Equal(fake.Now()) {
+		t.Errorf("event = %+v, want OrderCreated 1 for %s in acme at %v", e, orderID, fake.Now())
+	}
+	if e.Published() || e.Attempts != 0 {
+		t.Errorf("new event already published or attempted: %+v", e)
+	}
+	var payload orderpb.Order
+	if err := protojson.Unmarshal(e.Payload, &payload); err != nil {
+		t.Fatalf("event payload: %v", err)
+	}
+	if order, _ := s.Lookup(ctx, orderID); !proto.Equal(&payload, order) {
+		t.Errorf("event payload = %v, want the created order %v", &payload, order)
+	}
+}
+
+// TestOutboxAtomicWithOrder creates orders from many goroutines while
+// readers compare the outbox with the stored orders, and checks neither is
+// ever seen without the other.
+func TestOutboxAtomicWithOrder(t *testing.T) {
+	s := orderservice.NewServer()
+	ctx := context.Background()
+	listed := func() map[string]bool {
+		resp, err := s.ListOrders(ctx, &orderpb.ListOrdersRequest{PageSize: 500})
+		if err != nil {
+			t.Errorf("ListOrders: %v", err)
+		}
+		ids := make(map[string]bool)
+		for _, order := range resp.GetOrders() {
+			ids[order.GetId()] = true
+		}
+		return ids
+	}
+	evented := func() map[string]bool {
+		ids := make(map[string]bool)
+		for _, e := range s.OutboxEvents() {
+			ids[e.OrderID] = true
+		}
+		return ids
+	}
+
+	const n = 200
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder(fmt.Sprintf("user-%d", i))}); err != nil {
+				t.Errorf("CreateOrder %d: %v", i, err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		// Orders and events are only ever added, so whichever is read first
+		// must be contained in the other
+		events, orders := evented(), listed()
+		for id := range events {
+			if !orders[id] {
+				t.Fatalf("event for order %s before the order exists", id)
+			}
+		}
+		orders, events = listed(), evented()
+		for id := range orders {
+			if !events[id] {
+				t.Fatalf("order %s exists without its event", id)
+			}
+		}
+	}
+	if got := len(s.OutboxEvents()); got != n {
+		t.Errorf("outbox holds %d events, want %d", got, n)
+	}
+}
+
+// TestOutboxRelayPublishes relays the outbox through a publisher that fails
+// once, and checks events are published in order, the failed one retried on
+// the next poll, and each marked published at the time it was.
+func TestOutboxRelayPublishes(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	s := orderservice.NewServer(orderservice.WithClock(fake))
+	ctx := context.Background()
+	var orderIDs []string
+	for i := range 3 {
+		resp, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder(fmt.Sprintf("user-%d", i))})
+		if err != nil {
+			t.Fatalf("CreateOrder: %v", err)
+		}
+		orderIDs = append(orderIDs, resp.GetOrderId().GetId())
+	}
+
+	var published []string
+	failNext := false
+	relay := orderservice.NewOutboxRelay(s, orderservice.PublisherFunc(func(_ context.Context, e orderservice.OutboxEvent) error {
+		if failNext {
+			failNext = false
+			return errors.New("broker unavailable")
+		}
+		published = append(published, e.OrderID)
+		return nil
+	}), time.Second)
+
+	failNext = true
+	if n := relay.RelayOnce(ctx); n != 0 {
+		t.Errorf("RelayOnce with the broker down published %d events, want 0", n)
+	}
+	if e := s.OutboxEvents()[0]; e.Published() || e.Attempts != 1 || e.LastError != "broker unavailable" {
+		t.Errorf("failed event = %+v, want one failed attempt recorded", e)
+	}
+
+	fake.Advance(time.Second)
+	if n := relay.RelayOnce(ctx); n != 3 {
+		t.Errorf("RelayOnce published %d events, want 3", n)
+	}
+	if fmt.Sprint(published) != fmt.Sprint(orderIDs) {
+		t.Errorf("published %v, want %v in order", published, orderIDs)
+	}
+	for _, e := range s.OutboxEvents() {
+		if !e.PublishedAt.Equal(fake.Now()) || e.LastError != "" {
+			t.Errorf("event %d = %+v, want published at %v", e.ID, e, fake.Now())
+		}
+	}
+	if n := relay.RelayOnce(ctx); n != 0 {
+		t.Errorf("RelayOnce with nothing pending published %d events", n)
+	}
+}
+
+// TestOutboxRelayRun checks a running relay publishes an order's event on
+// its next poll.
+func TestOutboxRelayRun(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	s := orderservice.NewServer(orderservice.WithClock(fake))
+	published := make(chan orderservice.OutboxEvent, 1)
+	relay := orderservice.NewOutboxRelay(s, orderservice.PublisherFunc(func(_ context.Context, e orderservice.OutboxEvent) error {
+		published <- e
+		return nil
+	}), 5*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+
+	resp, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(5 * time.Second)
+	select {
+	case e := <-published:
+		if e.OrderID != resp.GetOrderId().GetId() {
+			t.Errorf("published event for %s, want %s", e.OrderID, resp.GetOrderId().GetId())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not publish the event after its poll interval")
+	}
+	for !s.OutboxEvents()[0].Published() {
+		time.Sleep(time.Millisecond)
+	}
+}
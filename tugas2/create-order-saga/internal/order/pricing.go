@@ -0,0 +1,169 @@
+package order
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// PriceCatalog is the source of truth for product prices.
+type PriceCatalog interface {
+	// Price returns the unit price of a product, or false if it is not sold.
+	Price(productID string) (*commonpb.Money, bool)
+}
+
+// StaticCatalog is a PriceCatalog backed by a fixed map of product ID to unit price.
+type StaticCatalog map[string]*commonpb.Money
+
+// Price implements PriceCatalog.
+func (c StaticCatalog) Price(productID string) (*commonpb.Money, bool) {
+	price, ok := c[productID]
+	return price, ok
+}
+
+// ParseCatalog parses a comma-separated list of product=price entries in
+// currency, e.g. "prod-A=10.50,prod-B=25". An empty spec yields an empty catalog.
+func ParseCatalog(spec, currency string) (StaticCatalog, error) {
+	catalog := make(StaticCatalog)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		product, amount, ok := strings.Cut(entry, "=")
+		product = strings.TrimSpace(product)
+		if !ok || product == "" {
+			return nil, fmt.Errorf("catalog entry %q: want product=price", entry)
+		}
+		price, err := money.Parse(currency, amount)
+		if err != nil || money.IsNegative(price) {
+			return nil, fmt.Errorf("catalog entry %q: price must be a non-negative decimal amount", entry)
+		}
+		catalog[product] = price
+	}
+	return catalog, nil
+}
+
+// WithPriceCatalog makes CreateOrder check every item's price against catalog
+// (none by default, trusting the submitted prices). Orders with a product the
+// catalog does not sell are rejected with codes.InvalidArgument; orders with a
+// price that does not match are rejected with codes.FailedPrecondition and a
+// PriceMismatch detail, unless WithServerPricing is used.
+func WithPriceCatalog(catalog PriceCatalog) Option {
+	return func(s *Server) {
+		s.catalog = catalog
+	}
+}
+
+// WithServerPricing makes CreateOrder ignore the submitted item prices and
+// charge the catalog's instead (false by default). The catalog's prices are
+// stored with the order and make up the total in the response, which is the
+// amount the saga charges. It has no effect without WithPriceCatalog.
+func WithServerPricing(enabled bool) Option {
+	return func(s *Server) {
+		s.serverPricing = enabled
+	}
+}
+
+// priceItems checks the items of req against the catalog and returns the
+// request to create the order from: req itself, or under server pricing a copy
+// with the catalog's prices. Without a catalog req is returned unchanged.
+func (s *Server) priceItems(req *orderpb.CreateOrderRequest) (*orderpb.CreateOrderRequest, error) {
+	if s.catalog == nil {
+		return req, nil
+	}
+	for i, item := range req.GetDetails().GetItems() {
+		if _, ok := s.catalog.Price(item.GetProductId()); !ok {
+			field := fmt.Sprintf("details.items[%d].product_id", i)
+			info := errinfo.New(errinfo.DomainOrder, errinfo.ReasonUnknownProduct, map[string]string{"product_id": item.GetProductId(), "field": field})
+			return nil, errinfo.Errorf(codes.InvalidArgument, info, "%s: unknown product %q", field, item.GetProductId())
+		}
+	}
+	if s.serverPricing {
+		priced := proto.Clone(req).(*orderpb.CreateOrderRequest)
+		for _, item := range priced.GetDetails().GetItems() {
+			price, _ := s.catalog.Price(item.GetProductId())
+			item.Price = proto.Clone(price).(*commonpb.Money)
+		}
+		return priced, nil
+	}
+	mismatches := s.priceMismatches(req.GetDetails())
+	if len(mismatches) == 0 {
+		return req, nil
+	}
+	parts := make([]string, len(mismatches))
+	products := make([]string, len(mismatches))
+	for i, m := range mismatches {
+		parts[i] = fmt.Sprintf("%s costs %s, not %s", m.ProductId, money.Format(m.CatalogPrice), money.Format(m.SubmittedPrice))
+		products[i] = m.ProductId
+	}
+	st := status.Newf(codes.FailedPrecondition, "item prices do not match the catalog: %s", strings.Join(parts, "; "))
+	st = errinfo.Attach(st, errinfo.New(errinfo.DomainOrder, errinfo.ReasonPriceMismatch, map[string]string{"product_ids": strings.Join(products, ",")}))
+	if detailed, err := st.WithDetails(&orderpb.PriceMismatch{Items: mismatches}); err == nil {
+		st = detailed
+	} else {
+		log.Printf("WARNING: Attaching price mismatch detail: %v", err)
+	}
+	return nil, st.Err()
+}
+
+// unknownProducts reports every item whose product the catalog does not sell.
+func (s *Server) unknownProducts(details *commonpb.OrderDetails) []*commonpb.FieldViolation {
+	var violations []*commonpb.FieldViolation
+	for i, item := range details.GetItems() {
+		if _, ok := s.catalog.Price(item.GetProductId()); !ok {
+			violations = append(violations, &commonpb.FieldViolation{
+				Field:       fmt.Sprintf("details.items[%d].product_id", i),
+				Description: fmt.Sprintf("unknown product %q", item.GetProductId()),
+			})
+		}
+	}
+	return violations
+}
+
+// priceMismatches lists the items, all of whose products the catalog sells,
+// submitted at a price other than the catalog's.
+func (s *Server) priceMismatches(details *commonpb.OrderDetails) []*orderpb.ItemPrice {
+	var mismatches []*orderpb.ItemPrice
+	for i, item := range details.GetItems() {
+		price, _ := s.catalog.Price(item.GetProductId())
+		if cmp, err := money.Compare(item.GetPrice(), price); err == nil && cmp == 0 {
+			continue
+		}
+		mismatches = append(mismatches, &orderpb.ItemPrice{
+			Index:          int32(i),
+			ProductId:      item.GetProductId(),
+			SubmittedPrice: item.GetPrice(),
+			CatalogPrice:   price,
+		})
+	}
+	return mismatches
+}
+
+// catalogViolations reports the catalog problems CreateOrder would reject the
+// order for: unknown products and, without server pricing, wrong prices.
+func (s *Server) catalogViolations(details *commonpb.OrderDetails) []*commonpb.FieldViolation {
+	if s.catalog == nil {
+		return nil
+	}
+	if violations := s.unknownProducts(details); len(violations) > 0 || s.serverPricing {
+		return violations
+	}
+	var violations []*commonpb.FieldViolation
+	for _, m := range s.priceMismatches(details) {
+		violations = append(violations, &commonpb.FieldViolation{
+			Field:       fmt.Sprintf("details.items[%d].price", m.Index),
+			Description: fmt.Sprintf("price %s does not match the catalog price %s", money.Format(m.SubmittedPrice), money.Format(m.CatalogPrice)),
+		})
+	}
+	return violations
+}
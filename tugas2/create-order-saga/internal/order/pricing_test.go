@@ -0,0 +1,206 @@
+package order_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/internal/orchestrator"
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// catalog sells the sample order's products, prod-B for less than the 25.00
+// SampleOrder submits.
+func catalog() orderservice.StaticCatalog {
+	return orderservice.StaticCatalog{
+		"prod-A": money.MustParse(money.DefaultCurrency, "10.50"),
+		"prod-B": money.MustParse(money.DefaultCurrency, "20.00"),
+	}
+}
+
+// orderCount returns how many orders s holds.
+func orderCount(t *testing.T, s *orderservice.Server) int {
+	t.Helper()
+	resp, err := s.ListOrders(context.Background(), &orderpb.ListOrdersRequest{})
+	if err != nil {
+		t.Fatalf("ListOrders: %v", err)
+	}
+	return len(resp.GetOrders())
+}
+
+func TestCreateOrderPriceMismatch(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithPriceCatalog(catalog()))
+	details := sagatest.SampleOrder("user-1")
+	_, err := s.CreateOrder(context.Background(), &orderpb.CreateOrderRequest{Details: details})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("CreateOrder at the wrong price = %v, want FailedPrecondition", err)
+	}
+	if info, _ := errinfo.From(err); info.GetReason() != errinfo.ReasonPriceMismatch || info.GetMetadata()["product_ids"] != "prod-B" {
+		t.Errorf("error info = %v, want PRICE_MISMATCH for prod-B", info)
+	}
+	var mismatch *orderpb.PriceMismatch
+	for _, detail := range status.Convert(err).Details() {
+		if d, ok := detail.(*orderpb.PriceMismatch); ok {
+			mismatch = d
+		}
+	}
+	want := &orderpb.PriceMismatch{Items: []*orderpb.ItemPrice{{
+		Index:          1,
+		ProductId:      "prod-B",
+		SubmittedPrice: money.MustParse(money.DefaultCurrency, "25.00"),
+		CatalogPrice:   money.MustParse(money.DefaultCurrency, "20.00"),
+	}}}
+	if !proto.Equal(mismatch, want) {
+		t.Errorf("mismatch detail = %v, want %v", mismatch, want)
+	}
+	if n := orderCount(t, s); n != 0 {
+		t.Errorf("%d orders stored after a refused order, want none", n)
+	}
+
+	validation, err := s.ValidateOrder(context.Background(), &orderpb.ValidateOrderRequest{Details: details})
+	if err != nil {
+		t.Fatalf("ValidateOrder: %v", err)
+	}
+	if v := validation.GetViolations(); validation.GetValid() || len(v) != 1 || v[0].GetField() != "details.items[1].price" {
+		t.Errorf("ValidateOrder = %v, want the prod-B price flagged", validation)
+	}
+
+	details.Items[1].Price = money.MustParse(money.DefaultCurrency, "20")
+	resp, err := s.CreateOrder(context.Background(), &orderpb.CreateOrderRequest{Details: details})
+	if err != nil {
+		t.Fatalf("CreateOrder at the catalog prices: %v", err)
+	}
+	if want := money.MustParse(money.DefaultCurrency, "41.00"); !proto.Equal(resp.GetTotal().GetTotal(), want) {
+		t.Errorf("total = %s, want %s", money.Format(resp.GetTotal().GetTotal()), money.Format(want))
+	}
+}
+
+// TestCreateOrderServerPricing submits prices far below the catalog's and
+// checks that under server pricing the order is priced, stored and totalled
+// at the catalog's prices instead.
+func TestCreateOrderServerPricing(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithPriceCatalog(catalog()), orderservice.WithServerPricing(true))
+	details := sagatest.SampleOrder("user-1")
+	for _, item := range details.GetItems() {
+		item.Price = money.MustParse(money.DefaultCurrency, "0.01")
+	}
+	req := &orderpb.CreateOrderRequest{Details: details}
+	resp, err := s.CreateOrder(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if want := money.MustParse(money.DefaultCurrency, "41.00"); !proto.Equal(resp.GetTotal().GetTotal(), want) {
+		t.Errorf("total = %s, want %s", money.Format(resp.GetTotal().GetTotal()), money.Format(want))
+	}
+	order, _ := s.Lookup(context.Background(), resp.GetOrderId().GetId())
+	for _, item := range order.GetItems() {
+		if want, _ := catalog().Price(item.GetProductId()); !proto.Equal(item.GetPrice(), want) {
+			t.Errorf("stored %s at %s, want the catalog's %s", item.GetProductId(), money.Format(item.GetPrice()), money.Format(want))
+		}
+	}
+	if got := req.GetDetails().GetItems()[0].GetPrice(); !proto.Equal(got, money.MustParse(money.DefaultCurrency, "0.01")) {
+		t.Errorf("request repriced in place to %s", money.Format(got))
+	}
+	validation, err := s.ValidateOrder(context.Background(), &orderpb.ValidateOrderRequest{Details: details})
+	if err != nil || !validation.GetValid() {
+		t.Errorf("ValidateOrder = %v, %v; want the submitted prices ignored", validation, err)
+	}
+}
+
+// TestSagaChargesCatalogPrice runs a saga under server pricing and checks the
+// payment taken is the catalog total, not the amount the client offered.
+func TestSagaChargesCatalogPrice(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithOrderOptions(orderservice.WithPriceCatalog(catalog()), orderservice.WithServerPricing(true)))
+	state, err := h.Run(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	order, _ := h.Order.Lookup(context.Background(), state.OrderID.GetId())
+	payment, _ := h.Payment.Lookup(context.Background(), state.PaymentID)
+	if want := money.MustParse(money.DefaultCurrency, "41.00"); !proto.Equal(order.GetBreakdown().GetSubtotal(), want) {
+		t.Errorf("subtotal = %s, want %s", money.Format(order.GetBreakdown().GetSubtotal()), money.Format(want))
+	}
+	if !proto.Equal(payment.GetAmount(), order.GetTotalAmount()) {
+		t.Errorf("charged %s, want the order total %s", money.Format(payment.GetAmount()), money.Format(order.GetTotalAmount()))
+	}
+}
+
+// TestSagaUnknownProduct runs the sample order against a catalog parsed from
+// a -catalog spec that lacks prod-B: the saga fails at CreateOrder with the
+// product reported and no order is stored.
+func TestSagaUnknownProduct(t *testing.T) {
+	prices, err := orderservice.ParseCatalog("prod-A=10.50", money.DefaultCurrency)
+	if err != nil {
+		t.Fatalf("ParseCatalog: %v", err)
+	}
+	h := sagatest.New(t, sagatest.WithOrderOptions(orderservice.WithPriceCatalog(prices), orderservice.WithServerPricing(true)))
+	_, err = h.Run(context.Background(), "user-1")
+
+	var stepErr *orchestrator.StepError
+	if !errors.As(err, &stepErr) || !errors.Is(err, orchestrator.ErrCreateOrderFailed) || stepErr.Status.Code() != codes.InvalidArgument {
+		t.Fatalf("saga error = %v, want CreateOrder failing with InvalidArgument", err)
+	}
+	if stepErr.Info.GetReason() != errinfo.ReasonUnknownProduct || stepErr.Info.GetMetadata()["product_id"] != "prod-B" {
+		t.Errorf("error info = %v, want UNKNOWN_PRODUCT for prod-B", stepErr.Info)
+	}
+	if n := orderCount(t, h.Order); n != 0 {
+		t.Errorf("%d orders stored, want none", n)
+	}
+}
+
+func TestCreateOrderUnknownProduct(t *testing.T) {
+	for _, serverPricing := range []bool{false, true} {
+		s := orderservice.NewServer(orderservice.WithPriceCatalog(catalog()), orderservice.WithServerPricing(serverPricing))
+		details := sagatest.SampleOrder("user-1")
+		details.Items = append(details.Items, &commonpb.Item{ProductId: "prod-C", Sku: "SKU-C", Quantity: 1, Price: money.MustParse(money.DefaultCurrency, "1.00")})
+		_, err := s.CreateOrder(context.Background(), &orderpb.CreateOrderRequest{Details: details})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("server pricing %v: CreateOrder with an unknown product = %v, want InvalidArgument", serverPricing, err)
+			continue
+		}
+		info, _ := errinfo.From(err)
+		if info.GetReason() != errinfo.ReasonUnknownProduct || info.GetMetadata()["product_id"] != "prod-C" || info.GetMetadata()["field"] != "details.items[2].product_id" {
+			t.Errorf("server pricing %v: error info = %v, want UNKNOWN_PRODUCT for prod-C at items[2]", serverPricing, info)
+		}
+		if n := orderCount(t, s); n != 0 {
+			t.Errorf("server pricing %v: %d orders stored, want none", serverPricing, n)
+		}
+		validation, _ := s.ValidateOrder(context.Background(), &orderpb.ValidateOrderRequest{Details: details})
+		if v := validation.GetViolations(); len(v) == 0 || v[0].GetField() != "details.items[2].product_id" {
+			t.Errorf("server pricing %v: ValidateOrder = %v, want prod-C flagged", serverPricing, validation)
+		}
+	}
+}
+
+func TestParseCatalog(t *testing.T) {
+	got, err := orderservice.ParseCatalog(" prod-A=10.50, prod-B = 25 ,free=0,", "EUR")
+	if err != nil {
+		t.Fatalf("ParseCatalog: %v", err)
+	}
+	want := map[string]string{"prod-A": "10.50", "prod-B": "25", "free": "0"}
+	if len(got) != len(want) {
+		t.Errorf("ParseCatalog = %v, want %v", got, want)
+	}
+	for product, amount := range want {
+		if price, _ := got.Price(product); !proto.Equal(price, money.MustParse("EUR", amount)) {
+			t.Errorf("%s = %s, want EUR %s", product, money.Format(price), amount)
+		}
+	}
+	if empty, err := orderservice.ParseCatalog(" , ", "USD"); err != nil || len(empty) != 0 {
+		t.Errorf("ParseCatalog of a blank spec = %v, %v; want an empty catalog", empty, err)
+	}
+	for _, spec := range []string{"prod-A", "=1", "prod-A=", "prod-A=ten", "prod-A=-1"} {
+		if catalog, err := orderservice.ParseCatalog(spec, "USD"); err == nil {
+			t.Errorf("ParseCatalog(%q) = %v, want an error", spec, catalog)
+		}
+	}
+}
@@ -2,102 +2,393 @@ package order
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
 	commonpb "create-order-saga/proto/common"
 	orderpb "create-order-saga/proto/order"
 	"sync" // For safe concurrent map access
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// orderKey partitions stored orders by tenant so IDs never collide across tenants.
+type orderKey struct {
+	tenant string
+	id     string
+}
+
+// keyFor builds the store key for an order ID using the caller's tenant.
+func keyFor(ctx context.Context, orderID string) orderKey {
+	return orderKey{tenant: interceptors.TenantFromContext(ctx), id: orderID}
+}
+
 // Server implements the OrderServiceServer interface.
 type Server struct {
 	orderpb.UnimplementedOrderServiceServer // Embed for forward compatibility
-	orders                                  map[string]*orderpb.Order
-	mu                                      sync.RWMutex // Mutex to protect the orders map
+	orders                                  map[orderKey]*orderpb.Order
+	archived                                map[orderKey]*orderpb.Order               // Orders moved out of orders by OrderAdmin; read-only
+	created                                 map[orderKey]*orderpb.CreateOrderResponse // CreateOrder responses by request ID
+	references                              map[orderKey]string                       // Latest order ID by client reference ID
+	outbox                                  []*OutboxEvent                            // Events about orders, oldest first (see OutboxRelay)
+	outboxSeq                               int64                                     // ID of the last outbox event
+	outboxSent                              int                                       // Outbox events before this index are all published
+	mu                                      sync.RWMutex                              // Mutex to protect the orders, archived, created, references and byUser maps, the outbox and the stock
+	latency                                 simulation.Latency                        // Artificial delay applied to every RPC
+	maxItems                                int                                       // Line items allowed per order; 0 means no limit
+	maxQuantityPerItem                      int32                                     // Quantity allowed per line item; 0 means no limit
+	taxRates                                TaxRates                                  // Tax by destination; nil means no tax
+	catalog                                 PriceCatalog                              // Source of truth for item prices; nil trusts the submitted ones
+	serverPricing                           bool                                      // Charge the catalog's prices instead of checking the submitted ones
+	stockSeed                               map[string]int64                          // Units each tenant starts with by product ID; products not listed are not tracked
+	stock                                   map[string]map[string]int64               // Units on hand by tenant, then product ID, once a tenant's levels change
+	stockTaken                              map[orderKey]map[string]int64             // Units taken from stock by each order not yet cancelled
+	orderNumbers                            map[string]int64                          // Last order number issued in each tenant
+	byUser                                  map[orderKey][]string                     // IDs of each user's orders, oldest first, keyed by user ID
+	clock                                   clock.Clock
+	ids                                     ids.Generator
+	failures                                *simulation.FailureSimulator // Runtime-configurable latency, and failures injected into CreateOrder
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithSimulatedLatency delays every RPC by a random duration in [min, max]
+// to exercise client timeouts and retries. Pass max <= min for a fixed delay.
+func WithSimulatedLatency(min, max time.Duration) Option {
+	return func(s *Server) {
+		s.latency = simulation.Latency{Min: min, Max: max}
+	}
+}
+
+// Default order size limits, generous enough for any real order while keeping
+// a single request from exhausting memory.
+const (
+	DefaultMaxItems           = 1000
+	DefaultMaxQuantityPerItem = 10000
+)
+
+// Limits on the caller-defined metadata attached to an order.
+const (
+	MaxMetadataKeys       = 16
+	MaxMetadataValueBytes = 256
+)
+
+// WithMaxItems rejects orders with more than max line items
+// (DefaultMaxItems by default). A max of 0 disables the limit.
+func WithMaxItems(max int) Option {
+	return func(s *Server) {
+		s.maxItems = max
+	}
+}
+
+// WithMaxQuantityPerItem rejects orders where a line item's quantity exceeds
+// max (DefaultMaxQuantityPerItem by default). A max of 0 disables the limit.
+func WithMaxQuantityPerItem(max int32) Option {
+	return func(s *Server) {
+		s.maxQuantityPerItem = max
+	}
+}
+
+// WithIDGenerator sets how order IDs are generated (ids.Random by default,
+// "order-<uuid>"). ids.Derived keys them on the user, "order-<user ID>", so a
+// user's second order replaces the first: use it only where each user orders
+// once, e.g. in tests.
+func WithIDGenerator(g ids.Generator) Option {
+	return func(s *Server) {
+		s.ids = g
+	}
+}
+
+// WithFailureSimulator injects latency into every RPC and failures into
+// CreateOrder as configured on f, e.g. through the FailureAdmin service. By
+// default the server has its own simulator that injects nothing until configured.
+func WithFailureSimulator(f *simulation.FailureSimulator) Option {
+	return func(s *Server) {
+		s.failures = f
+	}
+}
+
+// WithClock sets the clock used for time-dependent behaviour (the real clock by default).
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
 }
 
 // NewServer creates a new Order service server.
-func NewServer() *Server {
-	return &Server{
-		orders: make(map[string]*orderpb.Order),
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		clock:              clock.Real(),
+		ids:                ids.Random(),
+		maxItems:           DefaultMaxItems,
+		maxQuantityPerItem: DefaultMaxQuantityPerItem,
+		orders:             make(map[orderKey]*orderpb.Order),
+		archived:           make(map[orderKey]*orderpb.Order),
+		created:            make(map[orderKey]*orderpb.CreateOrderResponse),
+		references:         make(map[orderKey]string),
+		stock:              make(map[string]map[string]int64),
+		stockTaken:         make(map[orderKey]map[string]int64),
+		orderNumbers:       make(map[string]int64),
+		byUser:             make(map[orderKey][]string),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	if s.failures == nil {
+		s.failures = simulation.NewFailureSimulator(s.clock)
+	}
+	s.latency.Clock = s.clock
+	return s
+}
+
+// FailureAdmin returns the FailureAdmin service controlling the latency
+// injected into every RPC and the failures injected into CreateOrder, for
+// registration on the server's gRPC server.
+func (s *Server) FailureAdmin() adminpb.FailureAdminServer {
+	return s.failures
+}
+
+// sleep simulates a slow service before an RPC is handled: the delay set by
+// WithSimulatedLatency, then any configured at runtime through the
+// FailureAdmin service. Either returns early with an error if ctx is done.
+func (s *Server) sleep(ctx context.Context) error {
+	if err := s.latency.Sleep(ctx); err != nil {
+		return err
+	}
+	return s.failures.Delay(ctx)
+}
+
+// Lookup returns a copy of the stored order in the caller's tenant, archived
+// or not, for in-process inspection (e.g. end-to-end checks in the all-in-one
+// binary).
+func (s *Server) Lookup(ctx context.Context, orderID string) (*orderpb.Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	order, ok := s.findLocked(keyFor(ctx, orderID))
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(order).(*orderpb.Order), true
+}
+
+// findLocked returns the order stored under key, looking in the archive if it
+// is not live. Caller holds s.mu.
+func (s *Server) findLocked(key orderKey) (*orderpb.Order, bool) {
+	if order, ok := s.orders[key]; ok {
+		return order, true
+	}
+	order, ok := s.archived[key]
+	return order, ok
 }
 
 // CreateOrder handles the creation of a new order.
 // In a real implementation, this would persist the order to a database.
+// A request carrying a request ID already seen (in the caller's tenant) returns
+// the original response without creating another order, so retries are safe.
 func (s *Server) CreateOrder(ctx context.Context, req *orderpb.CreateOrderRequest) (*orderpb.CreateOrderResponse, error) {
 	log.Printf("Received CreateOrder request for user: %s", req.Details.UserId)
 
-	// 1. Generate a unique order ID (e.g., using UUID)
-	//    For simplicity, we'll use a placeholder.
-	orderID := "order-" + req.Details.UserId // Replace with actual ID generation
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("CreateOrder aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	// Apply any failure configured at runtime through the FailureAdmin service
+	if err := s.failures.Inject(ctx, "CreateOrder"); err != nil {
+		return nil, err
+	}
+
+	// Reject oversized orders before doing any work on them
+	if violations := s.limitViolations(req.Details); len(violations) > 0 {
+		log.Printf("CreateOrder rejected for user %s: %s", req.Details.UserId, violations[0].Description)
+		info := errinfo.New(errinfo.DomainOrder, errinfo.ReasonOrderTooLarge, map[string]string{"field": violations[0].Field})
+		return nil, errinfo.Errorf(codes.InvalidArgument, info, "%s: %s", violations[0].Field, violations[0].Description)
+	}
+
+	// Items need a product, a SKU and a positive quantity (otherwise they would
+	// hand units to the stock instead of taking them), priced in one currency
+	if violations := validateOrderDetails(req.Details); len(violations) > 0 {
+		log.Printf("CreateOrder rejected for user %s: %s", req.Details.UserId, violations[0].Description)
+		return nil, invalidOrderError(violations)
+	}
+
+	// Prices must match the catalog, or are taken from it under server pricing
+	priced, err := s.priceItems(req)
+	if err != nil {
+		log.Printf("CreateOrder rejected for user %s: %v", req.Details.UserId, err)
+		return nil, err
+	}
+	req = priced
+
+	// Prices (and the shipping cost) must be valid and share one currency for the total to be exact
+	breakdown, err := s.totalFor(req)
+	if err != nil {
+		log.Printf("CreateOrder rejected for user %s: %v", req.Details.UserId, err)
+		return nil, errinfo.Errorf(codes.InvalidArgument, errinfo.New(errinfo.DomainOrder, errinfo.ReasonInvalidOrder, nil), "%v", err)
+	}
+
+	// 1. Generate the order ID
+	orderID := s.ids.NewID("order", req.Details.UserId)
 
 	// 2. Create the order object (in memory for now)
+	now := s.clock.Now()
 	newOrder := &orderpb.Order{
 		Id:     orderID,
 		UserId: req.Details.UserId,
-		Items:  req.Details.Items,
-		// Calculate total amount based on items
-		TotalAmount: calculateTotal(req.Details.Items),
-		Status:      orderpb.OrderStatus_PENDING, // Initial status
+		// Snapshot the items (name, SKU, weight, price) as they were when ordered
+		Items: snapshotItems(req.Details.Items),
+		// Items, tax at the destination's rate and shipping
+		TotalAmount:  breakdown.Total,
+		CurrencyCode: breakdown.Total.GetCurrencyCode(),
+		Breakdown:    breakdown,
+		Status:       orderpb.OrderStatus_PENDING, // Initial status
+		CreatedAt:    timestamppb.New(now),
+		UpdatedAt:    timestamppb.New(now),
+		// Keep the caller's tags and reference so the order can be found by them later
+		Metadata:          req.Details.Metadata,
+		ClientReferenceId: req.Details.ClientReferenceId,
+		FulfillmentType:   req.Details.GetFulfillmentType(),
+		StatusHistory: []*orderpb.OrderStatusChange{
+			{Status: orderpb.OrderStatus_PENDING, ChangedAt: timestamppb.New(now)},
+		},
+	}
+
+	resp := &orderpb.CreateOrderResponse{
+		OrderId: &commonpb.OrderID{Id: orderID},
+		Status:  newOrder.Status,
+		Total:   breakdown,
 	}
 
-	// 3. Persist the order
+	// 3. Persist the order, unless this request was already handled. Its
+	//    stock is taken in the same critical section, so concurrent orders
+	//    can never take more units than there are.
 	s.mu.Lock()
-	s.orders[orderID] = newOrder
+	requestKey := keyFor(ctx, req.RequestId)
+	if req.RequestId != "" {
+		if original, ok := s.created[requestKey]; ok {
+			s.mu.Unlock()
+			log.Printf("CreateOrder request %s already handled, returning order %s", req.RequestId, original.OrderId.GetId())
+			return proto.Clone(original).(*orderpb.CreateOrderResponse), nil
+		}
+	}
+	if err := s.takeStockLocked(keyFor(ctx, orderID), req.Details); err != nil {
+		s.mu.Unlock()
+		log.Printf("CreateOrder rejected for user %s: %v", req.Details.UserId, err)
+		return nil, err
+	}
+	newOrder.OrderNumber = s.nextOrderNumberLocked(interceptors.TenantFromContext(ctx), now)
+	resp.OrderNumber = newOrder.OrderNumber
+	if req.RequestId != "" {
+		s.created[requestKey] = proto.Clone(resp).(*orderpb.CreateOrderResponse)
+	}
+	s.indexByUserLocked(ctx, newOrder)
+	s.orders[keyFor(ctx, orderID)] = newOrder
+	if ref := newOrder.ClientReferenceId; ref != "" {
+		s.references[keyFor(ctx, ref)] = orderID
+	}
+	// The event is written with the order, so it exists if and only if the order does
+	s.appendOutboxLocked(interceptors.TenantFromContext(ctx), EventOrderCreated, newOrder, now)
 	s.mu.Unlock()
-	log.Printf("Order %s created and stored with status PENDING", orderID)
+	log.Printf("Order %s (%s) created and stored with status PENDING", orderID, newOrder.OrderNumber)
 
 	// 4. Return the response
-	return &orderpb.CreateOrderResponse{
-		OrderId: &commonpb.OrderID{Id: orderID},
-		Status:  newOrder.Status,
-	}, nil
+	return resp, nil
 }
 
 // CancelOrder handles the compensation action for cancelling an order.
 // In a real implementation, this would update the order status in the database.
 func (s *Server) CancelOrder(ctx context.Context, req *orderpb.CancelOrderRequest) (*commonpb.CompensationResponse, error) {
 	orderID := req.OrderId.Id
-	log.Printf("Received CancelOrder request for order ID: %s", orderID)
+	log.Printf("Received CancelOrder request for order ID: %s (reason: %q, cause: %s)", orderID, req.GetReason(), req.GetCause())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("CancelOrder aborted during simulated latency: %v", err)
+		return nil, err
+	}
 
-	// 1. Find the order (e.g., order, exists := s.orders[orderID])
-	// 1. Find the order
+	// 1. Find the order (only within the caller's tenant). The read lock is
+	//    enough to answer for a missing one and the write lock is only taken
+	//    to change an existing order, which is looked up again under it in
+	//    case OrderAdmin archived or purged it in between.
+	key := keyFor(ctx, orderID)
+	s.mu.RLock()
+	_, exists := s.orders[key]
+	_, archived := s.archived[key]
+	s.mu.RUnlock()
+	if archived {
+		log.Printf("CancelOrder failed: Order %s is archived", orderID)
+		return nil, archivedError(orderID)
+	}
+	if !exists {
+		log.Printf("CancelOrder failed: Order %s not found", orderID)
+		return &commonpb.CompensationResponse{Message: fmt.Sprintf("Order %s not found", orderID), Code: commonpb.CompensationCode_NOT_FOUND}, nil
+	}
 	s.mu.Lock()
-	order, exists := s.orders[orderID]
+	order, exists := s.orders[key]
 	if !exists {
 		s.mu.Unlock()
-		log.Printf("CancelOrder failed: Order %s not found", orderID)
-		return nil, status.Errorf(codes.NotFound, "Order %s not found", orderID)
+		log.Printf("CancelOrder failed: Order %s was retired meanwhile", orderID)
+		return nil, archivedError(orderID)
 	}
 
 	// 2. Check if cancellation is possible (e.g., already cancelled?)
 	if order.Status == orderpb.OrderStatus_CANCELLED {
+		cancelledAt := order.CancelledAt
 		s.mu.Unlock()
 		log.Printf("CancelOrder skipped: Order %s already cancelled", orderID)
 		// Return success as the desired state is achieved (idempotency)
-		return &commonpb.CompensationResponse{Success: true, Message: "Order already cancelled"}, nil
+		return &commonpb.CompensationResponse{
+			Success:        true,
+			Message:        "Order already cancelled",
+			AlreadyApplied: true,
+			Code:           commonpb.CompensationCode_ALREADY_DONE,
+			CompensatedAt:  cancelledAt,
+			Actor:          interceptors.ActorFromContext(ctx),
+		}, nil
 	}
 
-	// 3. Update the order status to CANCELLED
+	// 3. Update the order status to CANCELLED, recording why and when
+	now := timestamppb.New(s.clock.Now())
 	order.Status = orderpb.OrderStatus_CANCELLED
+	order.UpdatedAt = now
+	order.CancelledAt = now
+	order.CancellationReason = req.GetReason()
+	order.CancellationCause = req.GetCause()
+	order.StatusHistory = append(order.StatusHistory, &orderpb.OrderStatusChange{
+		Status:    orderpb.OrderStatus_CANCELLED,
+		ChangedAt: now,
+		Reason:    req.GetReason(),
+		Cause:     req.GetCause(),
+	})
+	s.returnStockLocked(key)
 	s.mu.Unlock() // Unlock before logging potentially slow operations
-	log.Printf("Order %s status updated to CANCELLED", orderID)
+	log.Printf("Order %s status updated to CANCELLED (reason: %q)", orderID, req.GetReason())
 
 	// 4. Return success response
 	return &commonpb.CompensationResponse{
-		Success: true,
-		Message: "Order cancelled successfully",
+		Success:       true,
+		Message:       "Order cancelled successfully",
+		Code:          commonpb.CompensationCode_COMPLETED,
+		CompensatedAt: now,
+		Actor:         interceptors.ActorFromContext(ctx),
 	}, nil
-
-	// Example error handling:
-	// if !exists {
-	// 	return nil, status.Errorf(codes.NotFound, "Order %s not found", orderID)
-	// }
-	// return nil, status.Errorf(codes.Internal, "Failed to cancel order %s", orderID)
 }
 
 // CompleteOrder marks an order as completed in the storage.
@@ -105,8 +396,20 @@ func (s *Server) CompleteOrder(ctx context.Context, req *orderpb.CompleteOrderRe
 	orderID := req.OrderId.Id
 	log.Printf("Received CompleteOrder request for order ID: %s", orderID)
 
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("CompleteOrder aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
 	s.mu.Lock()
-	order, exists := s.orders[orderID]
+	key := keyFor(ctx, orderID)
+	order, exists := s.orders[key]
+	if _, archived := s.archived[key]; archived {
+		s.mu.Unlock()
+		log.Printf("CompleteOrder failed: Order %s is archived", orderID)
+		return nil, archivedError(orderID)
+	}
 	if !exists {
 		s.mu.Unlock()
 		log.Printf("CompleteOrder failed: Order %s not found", orderID)
@@ -115,25 +418,222 @@ func (s *Server) CompleteOrder(ctx context.Context, req *orderpb.CompleteOrderRe
 	}
 
 	// Update status only if it makes sense (e.g., was PENDING)
-	if order.Status == orderpb.OrderStatus_PENDING {
+	switch order.Status {
+	case orderpb.OrderStatus_PENDING:
+		now := timestamppb.New(s.clock.Now())
 		order.Status = orderpb.OrderStatus_COMPLETED
+		order.UpdatedAt = now
+		order.StatusHistory = append(order.StatusHistory, &orderpb.OrderStatusChange{Status: orderpb.OrderStatus_COMPLETED, ChangedAt: now})
+		s.mu.Unlock()
 		log.Printf("Order %s status updated to COMPLETED", orderID)
-	} else {
-		log.Printf("CompleteOrder skipped: Order %s status was %s, not PENDING", orderID, order.Status)
+		return &commonpb.CompensationResponse{Success: true, Message: "Order completed", Code: commonpb.CompensationCode_COMPLETED}, nil
+	case orderpb.OrderStatus_COMPLETED:
+		s.mu.Unlock()
+		// A repeated completion is harmless, but report it so the caller can tell it apart
+		log.Printf("CompleteOrder skipped: Order %s already completed", orderID)
+		return &commonpb.CompensationResponse{Success: true, Message: "Order already completed", AlreadyApplied: true, Code: commonpb.CompensationCode_ALREADY_DONE}, nil
+	default:
+		currentStatus := order.Status
+		s.mu.Unlock()
+		log.Printf("CompleteOrder failed: Order %s status is %s, not PENDING", orderID, currentStatus)
+		return nil, status.Errorf(codes.FailedPrecondition, "Order %s cannot be completed from status %s", orderID, currentStatus)
 	}
-	s.mu.Unlock()
+}
 
-	return &commonpb.CompensationResponse{
-		Success: true,
-		Message: "Order completion processed", // Indicate processed, even if status wasn't PENDING
-	}, nil
+// ValidateOrder checks order details the way CreateOrder would receive them,
+// without creating or storing an order.
+func (s *Server) ValidateOrder(ctx context.Context, req *orderpb.ValidateOrderRequest) (*commonpb.ValidationResponse, error) {
+	log.Printf("Received ValidateOrder request for user: %s", req.GetDetails().GetUserId())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ValidateOrder aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	violations := append(validateOrderDetails(req.GetDetails()), s.limitViolations(req.GetDetails())...)
+	violations = append(violations, s.catalogViolations(req.GetDetails())...)
+	violations = append(violations, s.stockViolations(interceptors.TenantFromContext(ctx), req.GetDetails())...)
+	return &commonpb.ValidationResponse{Valid: len(violations) == 0, Violations: violations}, nil
+}
+
+// GetOrder returns a copy of an order in the caller's tenant, archived ones
+// included (with archived set).
+func (s *Server) GetOrder(ctx context.Context, req *orderpb.GetOrderRequest) (*orderpb.Order, error) {
+	orderID := req.GetOrderId().GetId()
+	log.Printf("Received GetOrder request for order ID: %s", orderID)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("GetOrder aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if orderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "order ID is required")
+	}
+	order, ok := s.Lookup(ctx, orderID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", orderID)
+	}
+	return order, nil
 }
 
-// Helper function to calculate total amount (replace with actual logic)
-func calculateTotal(items []*commonpb.Item) float32 {
-	var total float32 = 0.0
-	for _, item := range items {
-		total += item.Price * float32(item.Quantity)
+// GetOrderByClientReference returns the most recent order (in the caller's
+// tenant) created with the given client reference ID.
+func (s *Server) GetOrderByClientReference(ctx context.Context, req *orderpb.GetOrderByClientReferenceRequest) (*orderpb.Order, error) {
+	ref := req.GetClientReferenceId()
+	log.Printf("Received GetOrderByClientReference request for reference: %s", ref)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("GetOrderByClientReference aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if ref == "" {
+		return nil, status.Error(codes.InvalidArgument, "client reference ID is required")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	order, ok := s.findLocked(keyFor(ctx, s.references[keyFor(ctx, ref)]))
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no order with client reference %s", ref)
+	}
+	return proto.Clone(order).(*orderpb.Order), nil
+}
+
+// indexByUserLocked adds a new order to its user's orders. An order replacing
+// a stored one with the same ID (derived IDs reuse one per user) is already
+// indexed. Caller holds s.mu for writing.
+func (s *Server) indexByUserLocked(ctx context.Context, order *orderpb.Order) {
+	key := keyFor(ctx, order.Id)
+	if _, ok := s.orders[key]; ok {
+		return
+	}
+	if _, ok := s.archived[key]; ok {
+		return
+	}
+	userKey := keyFor(ctx, order.UserId)
+	s.byUser[userKey] = append(s.byUser[userKey], order.Id)
+}
+
+// nextOrderNumberLocked issues the next customer-facing order number in
+// tenant, e.g. "ORD-2024-000123": the year the order was created in, then a
+// sequence that only ever grows, so numbers never repeat even across years.
+// Caller holds s.mu for writing.
+func (s *Server) nextOrderNumberLocked(tenant string, created time.Time) string {
+	s.orderNumbers[tenant]++
+	return fmt.Sprintf("ORD-%d-%06d", created.Year(), s.orderNumbers[tenant])
+}
+
+// snapshotItems deep-copies the items so the stored order keeps them as ordered.
+func snapshotItems(items []*commonpb.Item) []*commonpb.Item {
+	snapshot := make([]*commonpb.Item, len(items))
+	for i, item := range items {
+		snapshot[i] = proto.Clone(item).(*commonpb.Item)
+	}
+	return snapshot
+}
+
+// validateOrderDetails lists every problem with the order details: a missing
+// user, no items, or items without a product or SKU, with a non-positive
+// quantity, a negative weight or a negative price.
+func validateOrderDetails(details *commonpb.OrderDetails) []*commonpb.FieldViolation {
+	if details == nil {
+		return []*commonpb.FieldViolation{{Field: "details", Description: "order details are missing"}}
+	}
+	var violations []*commonpb.FieldViolation
+	if details.UserId == "" {
+		violations = append(violations, &commonpb.FieldViolation{Field: "details.user_id", Description: "user ID is required"})
+	}
+	if len(details.Items) == 0 {
+		violations = append(violations, &commonpb.FieldViolation{Field: "details.items", Description: "order must contain at least one item"})
+	}
+	for i, item := range details.Items {
+		field := fmt.Sprintf("details.items[%d]", i)
+		if item.GetProductId() == "" {
+			violations = append(violations, &commonpb.FieldViolation{Field: field + ".product_id", Description: "product ID is required"})
+		}
+		if strings.TrimSpace(item.GetSku()) == "" {
+			violations = append(violations, &commonpb.FieldViolation{Field: field + ".sku", Description: "SKU is required"})
+		}
+		if item.GetWeightGrams() < 0 {
+			violations = append(violations, &commonpb.FieldViolation{Field: field + ".weight_grams", Description: "weight must not be negative"})
+		}
+		if item.GetQuantity() <= 0 {
+			violations = append(violations, &commonpb.FieldViolation{Field: field + ".quantity", Description: "quantity must be positive"})
+		}
+		if err := money.Validate(item.GetPrice()); err != nil {
+			violations = append(violations, &commonpb.FieldViolation{Field: field + ".price", Description: err.Error()})
+		} else if money.IsNegative(item.GetPrice()) {
+			violations = append(violations, &commonpb.FieldViolation{Field: field + ".price", Description: "price must not be negative"})
+		} else if currency := details.Items[0].GetPrice().GetCurrencyCode(); item.GetPrice().GetCurrencyCode() != currency {
+			violations = append(violations, &commonpb.FieldViolation{
+				Field:       field + ".price.currency_code",
+				Description: fmt.Sprintf("currency %s does not match the order currency %s", item.GetPrice().GetCurrencyCode(), currency),
+			})
+		}
+	}
+	return violations
+}
+
+// invalidOrderError is the InvalidArgument error CreateOrder returns for the
+// problems validateOrderDetails found: it names the first in its message and
+// ErrorInfo, and lists them all in a BadRequest detail.
+func invalidOrderError(violations []*commonpb.FieldViolation) error {
+	st := status.Newf(codes.InvalidArgument, "%s: %s", violations[0].Field, violations[0].Description)
+	st = errinfo.Attach(st, errinfo.New(errinfo.DomainOrder, errinfo.ReasonInvalidOrder, map[string]string{"field": violations[0].Field}))
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: v.Field, Description: v.Description})
+	}
+	if detailed, err := st.WithDetails(badRequest); err == nil {
+		st = detailed
+	} else {
+		log.Printf("WARNING: Attaching field violations: %v", err)
+	}
+	return st.Err()
+}
+
+// limitViolations reports an order exceeding the configured item count or
+// per-item quantity limits, or the metadata limits.
+func (s *Server) limitViolations(details *commonpb.OrderDetails) []*commonpb.FieldViolation {
+	var violations []*commonpb.FieldViolation
+	if n := len(details.GetItems()); s.maxItems > 0 && n > s.maxItems {
+		violations = append(violations, &commonpb.FieldViolation{
+			Field:       "details.items",
+			Description: fmt.Sprintf("order has %d items, more than the limit of %d", n, s.maxItems),
+		})
+	}
+	if s.maxQuantityPerItem > 0 {
+		for i, item := range details.GetItems() {
+			if item.GetQuantity() > s.maxQuantityPerItem {
+				violations = append(violations, &commonpb.FieldViolation{
+					Field:       fmt.Sprintf("details.items[%d].quantity", i),
+					Description: fmt.Sprintf("quantity %d exceeds the limit of %d", item.GetQuantity(), s.maxQuantityPerItem),
+				})
+			}
+		}
+	}
+	if n := len(details.GetMetadata()); n > MaxMetadataKeys {
+		violations = append(violations, &commonpb.FieldViolation{
+			Field:       "details.metadata",
+			Description: fmt.Sprintf("metadata has %d keys, more than the limit of %d", n, MaxMetadataKeys),
+		})
+	}
+	keys := make([]string, 0, len(details.GetMetadata()))
+	for key := range details.GetMetadata() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Report violations in a stable order
+	for _, key := range keys {
+		if n := len(details.Metadata[key]); n > MaxMetadataValueBytes {
+			violations = append(violations, &commonpb.FieldViolation{
+				Field:       fmt.Sprintf("details.metadata[%q]", key),
+				Description: fmt.Sprintf("value is %d bytes, more than the limit of %d", n, MaxMetadataValueBytes),
+			})
+		}
 	}
-	return total
+	return violations
 }
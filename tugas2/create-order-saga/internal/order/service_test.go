@@ -0,0 +1,366 @@
+package order_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// TestConcurrentCreateCancelRead creates orders from many goroutines while
+// others cancel every other one and read them back; run with -race.
+func TestConcurrentCreateCancelRead(t *testing.T) {
+	const n = 100
+	s := orderservice.NewServer(orderservice.WithIDGenerator(ids.NewSequence()))
+	ctx := context.Background()
+
+	orderIDs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+				Details:   sagatest.SampleOrder(fmt.Sprintf("user-%d", i)),
+				RequestId: fmt.Sprintf("req-%d", i),
+			})
+			if err != nil {
+				t.Errorf("CreateOrder %d: %v", i, err)
+				return
+			}
+			orderIDs[i] = resp.GetOrderId().GetId()
+			if i%2 == 0 {
+				if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: resp.GetOrderId(), Reason: "stress"}); err != nil {
+					t.Errorf("CancelOrder %d: %v", i, err)
+				}
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.ListOrders(ctx, &orderpb.ListOrdersRequest{}); err != nil {
+				t.Errorf("ListOrders: %v", err)
+			}
+			s.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: &commonpb.OrderID{Id: fmt.Sprintf("order-%d", i)}})
+			s.OutboxEvents()
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i, id := range orderIDs {
+		if seen[id] {
+			t.Fatalf("order ID %s issued twice", id)
+		}
+		seen[id] = true
+		order, err := s.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: &commonpb.OrderID{Id: id}})
+		if err != nil {
+			t.Fatalf("GetOrder %s: %v", id, err)
+		}
+		want := orderpb.OrderStatus_PENDING
+		if i%2 == 0 {
+			want = orderpb.OrderStatus_CANCELLED
+		}
+		if order.GetStatus() != want {
+			t.Errorf("order %s is %s, want %s", id, order.GetStatus(), want)
+		}
+	}
+	list, err := s.ListOrders(ctx, &orderpb.ListOrdersRequest{PageSize: n})
+	if err != nil {
+		t.Fatalf("ListOrders: %v", err)
+	}
+	if got := len(list.GetOrders()); got != n {
+		t.Errorf("ListOrders returned %d orders, want %d", got, n)
+	}
+	if got := len(s.OutboxEvents()); got != n {
+		t.Errorf("outbox holds %d events, want %d", got, n)
+	}
+}
+
+// TestConcurrentCancelSameOrder cancels one order from many goroutines at
+// once: exactly one cancellation applies, the rest report it already done.
+func TestConcurrentCancelSameOrder(t *testing.T) {
+	s := orderservice.NewServer()
+	ctx := context.Background()
+	resp, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	applied := 0
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cancelled, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: resp.GetOrderId()})
+			if err != nil || !cancelled.GetSuccess() {
+				t.Errorf("CancelOrder = %v, %v", cancelled, err)
+				return
+			}
+			if !cancelled.GetAlreadyApplied() {
+				mu.Lock()
+				applied++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if applied != 1 {
+		t.Errorf("%d cancellations applied, want 1", applied)
+	}
+	order, _ := s.Lookup(ctx, resp.GetOrderId().GetId())
+	if got := len(order.GetStatusHistory()); got != 2 {
+		t.Errorf("status history has %d entries, want 2 (PENDING, CANCELLED)", got)
+	}
+}
+
+// TestTenantIsolation checks that another tenant can neither read nor cancel
+// an order, even knowing its ID.
+func TestTenantIsolation(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithIDGenerator(ids.NewSequence()))
+	tenantA := interceptors.WithTenant(context.Background(), "tenant-a")
+	tenantB := interceptors.WithTenant(context.Background(), "tenant-b")
+	created, err := s.CreateOrder(tenantA, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	orderID := created.GetOrderId()
+
+	if _, err := s.GetOrder(tenantB, &orderpb.GetOrderRequest{OrderId: orderID}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetOrder from another tenant returned %v, want NotFound", err)
+	}
+	if list, err := s.ListOrders(tenantB, &orderpb.ListOrdersRequest{}); err != nil || len(list.GetOrders()) != 0 {
+		t.Errorf("ListOrders from another tenant = %v, %v; want no orders", list.GetOrders(), err)
+	}
+	resp, err := s.CancelOrder(tenantB, &orderpb.CancelOrderRequest{OrderId: orderID, Reason: "not mine"})
+	if err != nil || resp.GetSuccess() || resp.GetCode() != commonpb.CompensationCode_NOT_FOUND {
+		t.Errorf("CancelOrder from another tenant = %v, %v; want NOT_FOUND", resp, err)
+	}
+
+	order, err := s.GetOrder(tenantA, &orderpb.GetOrderRequest{OrderId: orderID})
+	if err != nil {
+		t.Fatalf("GetOrder from the owning tenant: %v", err)
+	}
+	if order.GetStatus() != orderpb.OrderStatus_PENDING {
+		t.Errorf("order is %s after another tenant's cancellation, want PENDING", order.GetStatus())
+	}
+}
+
+// TestConcurrentOrderNumbers creates orders in two tenants from many
+// goroutines at once: each tenant's order numbers are issued once each, with
+// no gaps; run with -race.
+func TestConcurrentOrderNumbers(t *testing.T) {
+	const n = 100 // Per tenant
+	s := orderservice.NewServer(
+		orderservice.WithIDGenerator(ids.NewSequence()),
+		orderservice.WithClock(clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))),
+	)
+	tenants := []string{"tenant-a", "tenant-b"}
+
+	var mu sync.Mutex
+	numbers := make(map[string]map[string]bool) // Order numbers issued, by tenant
+	var wg sync.WaitGroup
+	for _, tenant := range tenants {
+		numbers[tenant] = make(map[string]bool)
+		ctx := interceptors.WithTenant(context.Background(), tenant)
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder(fmt.Sprintf("user-%d", i))})
+				if err != nil {
+					t.Errorf("CreateOrder in %s: %v", tenant, err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if numbers[tenant][resp.GetOrderNumber()] {
+					t.Errorf("order number %s issued twice in %s", resp.GetOrderNumber(), tenant)
+				}
+				numbers[tenant][resp.GetOrderNumber()] = true
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, tenant := range tenants {
+		for i := 1; i <= n; i++ {
+			if want := fmt.Sprintf("ORD-2024-%06d", i); !numbers[tenant][want] {
+				t.Errorf("%s was never issued in %s", want, tenant)
+			}
+		}
+	}
+}
+
+// TestSecondOrderKeepsFirst creates two orders for one user with the default
+// ID generator: each gets its own ID and the first is not replaced.
+func TestSecondOrderKeepsFirst(t *testing.T) {
+	s := orderservice.NewServer()
+	ctx := context.Background()
+	var orderIDs []string
+	for i := range 2 {
+		resp, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1"), RequestId: fmt.Sprintf("req-%d", i)})
+		if err != nil {
+			t.Fatalf("CreateOrder %d: %v", i, err)
+		}
+		orderIDs = append(orderIDs, resp.GetOrderId().GetId())
+	}
+	if orderIDs[0] == orderIDs[1] {
+		t.Fatalf("both orders got ID %s", orderIDs[0])
+	}
+	for _, id := range orderIDs {
+		if order, ok := s.Lookup(ctx, id); !ok || order.GetUserId() != "user-1" {
+			t.Errorf("order %s = %v, want user-1's order", id, order)
+		}
+	}
+}
+
+// TestCancelOrderCodes checks the CompensationCode CancelOrder answers
+// with as an order is cancelled and cancelled again; none is retryable.
+func TestCancelOrderCodes(t *testing.T) {
+	s := orderservice.NewServer()
+	ctx := context.Background()
+	created, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		orderID     string
+		wantCode    commonpb.CompensationCode
+		wantSuccess bool
+		wantApplied bool // AlreadyApplied
+	}{
+		{"unknown order", "order-404", commonpb.CompensationCode_NOT_FOUND, false, false},
+		{"first cancellation", created.GetOrderId().GetId(), commonpb.CompensationCode_COMPLETED, true, false},
+		{"repeated cancellation", created.GetOrderId().GetId(), commonpb.CompensationCode_ALREADY_DONE, true, true},
+	} {
+		resp, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: &commonpb.OrderID{Id: tc.orderID}})
+		if err != nil {
+			t.Fatalf("%s: CancelOrder: %v", tc.name, err)
+		}
+		if resp.GetCode() != tc.wantCode || resp.GetSuccess() != tc.wantSuccess || resp.GetAlreadyApplied() != tc.wantApplied || resp.GetRetryable() {
+			t.Errorf("%s: CancelOrder = %v, want code %s, success %t, already applied %t, not retryable", tc.name, resp, tc.wantCode, tc.wantSuccess, tc.wantApplied)
+		}
+	}
+}
+
+// TestCompleteOrderTwice completes a PENDING order twice: the second
+// response reports the order already completed without completing it again,
+// and orders that are not PENDING or do not exist are refused.
+func TestCompleteOrderTwice(t *testing.T) {
+	s := orderservice.NewServer()
+	ctx := context.Background()
+	created, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		wantCode    commonpb.CompensationCode
+		wantApplied bool // AlreadyApplied
+		wantMessage string
+	}{
+		{"first completion", commonpb.CompensationCode_COMPLETED, false, "Order completed"},
+		{"second completion", commonpb.CompensationCode_ALREADY_DONE, true, "Order already completed"},
+	} {
+		resp, err := s.CompleteOrder(ctx, &orderpb.CompleteOrderRequest{OrderId: created.GetOrderId()})
+		if err != nil {
+			t.Fatalf("%s: CompleteOrder: %v", tc.name, err)
+		}
+		if !resp.GetSuccess() || resp.GetCode() != tc.wantCode || resp.GetAlreadyApplied() != tc.wantApplied || resp.GetMessage() != tc.wantMessage {
+			t.Errorf("%s: CompleteOrder = %v, want code %s, already applied %t, message %q", tc.name, resp, tc.wantCode, tc.wantApplied, tc.wantMessage)
+		}
+	}
+	order, _ := s.Lookup(ctx, created.GetOrderId().GetId())
+	var history []orderpb.OrderStatus
+	for _, change := range order.GetStatusHistory() {
+		history = append(history, change.GetStatus())
+	}
+	if order.GetStatus() != orderpb.OrderStatus_COMPLETED || !slices.Equal(history, []orderpb.OrderStatus{orderpb.OrderStatus_PENDING, orderpb.OrderStatus_COMPLETED}) {
+		t.Errorf("order is %s with history %v, want COMPLETED once", order.GetStatus(), history)
+	}
+
+	cancelled, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-2")})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: cancelled.GetOrderId()}); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if _, err := s.CompleteOrder(ctx, &orderpb.CompleteOrderRequest{OrderId: cancelled.GetOrderId()}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("CompleteOrder of a cancelled order = %v, want FailedPrecondition", err)
+	}
+	if _, err := s.CompleteOrder(ctx, &orderpb.CompleteOrderRequest{OrderId: &commonpb.OrderID{Id: "order-404"}}); status.Code(err) != codes.NotFound {
+		t.Errorf("CompleteOrder of an unknown order = %v, want NotFound", err)
+	}
+}
+
+// TestCreateOrderRejectsInvalidItems sends orders with a malformed item
+// through CreateOrder: each is refused with InvalidArgument listing the
+// offending field, and neither an order nor a stock change is left behind.
+func TestCreateOrderRejectsInvalidItems(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		breakItem func(*commonpb.Item)
+		wantField string
+	}{
+		{"no SKU", func(item *commonpb.Item) { item.Sku = "" }, "details.items[1].sku"},
+		{"blank SKU", func(item *commonpb.Item) { item.Sku = "  " }, "details.items[1].sku"},
+		{"no product", func(item *commonpb.Item) { item.ProductId = "" }, "details.items[1].product_id"},
+		{"zero quantity", func(item *commonpb.Item) { item.Quantity = 0 }, "details.items[1].quantity"},
+		{"negative weight", func(item *commonpb.Item) { item.WeightGrams = -1 }, "details.items[1].weight_grams"},
+		{"no price", func(item *commonpb.Item) { item.Price = nil }, "details.items[1].price"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := orderservice.NewServer(orderservice.WithStock(map[string]int64{"prod-A": 10}))
+			ctx := context.Background()
+			details := sagatest.SampleOrder("user-1")
+			tc.breakItem(details.Items[1])
+
+			_, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: details})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("CreateOrder = %v, want InvalidArgument", err)
+			}
+			var fields []string
+			for _, detail := range status.Convert(err).Details() {
+				if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+					for _, v := range badRequest.GetFieldViolations() {
+						fields = append(fields, v.GetField())
+					}
+				}
+			}
+			if len(fields) != 1 || fields[0] != tc.wantField {
+				t.Errorf("field violations = %v, want [%s]", fields, tc.wantField)
+			}
+			if list, _ := s.ListOrders(ctx, &orderpb.ListOrdersRequest{}); len(list.GetOrders()) != 0 {
+				t.Errorf("a refused order was stored: %v", list.GetOrders())
+			}
+			if got := s.Stock(ctx)["prod-A"]; got != 10 {
+				t.Errorf("prod-A stock = %d after a refused order, want 10", got)
+			}
+		})
+	}
+}
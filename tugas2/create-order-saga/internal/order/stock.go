@@ -0,0 +1,222 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/interceptors"
+	adminpb "create-order-saga/proto/admin"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// ParseStock parses a comma-separated list of product=units entries, e.g.
+// "p1=10,p2=0". An empty spec yields no stock levels.
+func ParseStock(spec string) (map[string]int64, error) {
+	stock := make(map[string]int64)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		product, units, ok := strings.Cut(entry, "=")
+		product = strings.TrimSpace(product)
+		if !ok || product == "" {
+			return nil, fmt.Errorf("stock %q: want product=units", entry)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(units), 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("stock %q: units must be a non-negative integer", entry)
+		}
+		stock[product] = n
+	}
+	return stock, nil
+}
+
+// WithStock makes CreateOrder take the ordered units of every product listed
+// in stock from its level, refusing orders there are not enough units for
+// with codes.FailedPrecondition and a StockShortage detail. CancelOrder puts
+// the units back. Every tenant starts with these levels and draws down its
+// own. Products not listed are not tracked and never run out; by default no
+// product is. A tenant's levels can be changed later through InventoryAdmin.
+func WithStock(stock map[string]int64) Option {
+	return func(s *Server) {
+		s.stockSeed = maps.Clone(stock)
+	}
+}
+
+// stockOfLocked returns tenant's stock levels, which must not be modified:
+// the seeded ones if the tenant's have not changed yet. Caller holds s.mu.
+func (s *Server) stockOfLocked(tenant string) map[string]int64 {
+	if stock, ok := s.stock[tenant]; ok {
+		return stock
+	}
+	return s.stockSeed
+}
+
+// mutableStockLocked returns tenant's stock levels for changing, copying the
+// seeded ones on first use. Caller holds s.mu for writing.
+func (s *Server) mutableStockLocked(tenant string) map[string]int64 {
+	stock, ok := s.stock[tenant]
+	if !ok {
+		stock = maps.Clone(s.stockSeed)
+		if stock == nil {
+			stock = make(map[string]int64)
+		}
+		s.stock[tenant] = stock
+	}
+	return stock
+}
+
+// unitsByProduct sums the quantities of the items of details by product, as
+// one product can appear in several items.
+func unitsByProduct(details *commonpb.OrderDetails) map[string]int64 {
+	units := make(map[string]int64)
+	for _, item := range details.GetItems() {
+		units[item.GetProductId()] += int64(item.GetQuantity())
+	}
+	return units
+}
+
+// shortagesLocked lists the tracked products there are fewer units of in
+// tenant's stock than wanted, by product ID. Caller holds s.mu.
+func (s *Server) shortagesLocked(tenant string, wanted map[string]int64) []*orderpb.ShortItem {
+	stock := s.stockOfLocked(tenant)
+	var short []*orderpb.ShortItem
+	for product, units := range wanted {
+		if available, tracked := stock[product]; tracked && units > available {
+			short = append(short, &orderpb.ShortItem{ProductId: product, Requested: units, Available: available})
+		}
+	}
+	sort.Slice(short, func(i, j int) bool { return short[i].ProductId < short[j].ProductId })
+	return short
+}
+
+// takeStockLocked takes the units of the tracked products in details from the
+// stock of key's tenant for order key, all or nothing: if any product is short
+// nothing is taken and the error lists every short one. An order the new one
+// replaces under key keeps its units out of stock, but they are no longer
+// returned with key: cancelling the new order returns only its own. Caller
+// holds s.mu for writing.
+func (s *Server) takeStockLocked(key orderKey, details *commonpb.OrderDetails) error {
+	if len(s.stockOfLocked(key.tenant)) == 0 {
+		return nil
+	}
+	wanted := unitsByProduct(details)
+	if short := s.shortagesLocked(key.tenant, wanted); len(short) > 0 {
+		parts := make([]string, len(short))
+		products := make([]string, len(short))
+		for i, item := range short {
+			parts[i] = fmt.Sprintf("%s (%d wanted, %d in stock)", item.ProductId, item.Requested, item.Available)
+			products[i] = item.ProductId
+		}
+		st := status.Newf(codes.FailedPrecondition, "not enough stock: %s", strings.Join(parts, "; "))
+		st = errinfo.Attach(st, errinfo.New(errinfo.DomainOrder, errinfo.ReasonOutOfStock, map[string]string{"product_ids": strings.Join(products, ",")}))
+		if detailed, err := st.WithDetails(&orderpb.StockShortage{Items: short}); err == nil {
+			st = detailed
+		} else {
+			log.Printf("WARNING: Attaching stock shortage detail: %v", err)
+		}
+		return st.Err()
+	}
+	stock := s.mutableStockLocked(key.tenant)
+	taken := make(map[string]int64)
+	for product, units := range wanted {
+		if _, tracked := stock[product]; tracked {
+			stock[product] -= units
+			taken[product] = units
+		}
+	}
+	delete(s.stockTaken, key)
+	if len(taken) > 0 {
+		s.stockTaken[key] = taken
+	}
+	return nil
+}
+
+// returnStockLocked puts the units taken for order key back in the stock of
+// its tenant, once. Products no longer tracked are left untracked. Caller
+// holds s.mu for writing.
+func (s *Server) returnStockLocked(key orderKey) {
+	taken, ok := s.stockTaken[key]
+	if !ok {
+		return
+	}
+	delete(s.stockTaken, key)
+	stock := s.mutableStockLocked(key.tenant)
+	for product, units := range taken {
+		if _, tracked := stock[product]; tracked {
+			stock[product] += units
+		}
+	}
+	log.Printf("Returned stock taken for order %s: %v", key.id, taken)
+}
+
+// stockViolations reports the products CreateOrder would currently refuse the
+// order for lack of stock in tenant. Stock may change before the order is created.
+func (s *Server) stockViolations(tenant string, details *commonpb.OrderDetails) []*commonpb.FieldViolation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var violations []*commonpb.FieldViolation
+	for _, item := range s.shortagesLocked(tenant, unitsByProduct(details)) {
+		violations = append(violations, &commonpb.FieldViolation{
+			Field:       "details.items",
+			Description: fmt.Sprintf("%d units of %q wanted, %d in stock", item.Requested, item.ProductId, item.Available),
+		})
+	}
+	return violations
+}
+
+// Stock returns a copy of the caller's tenant's stock levels by product ID,
+// for in-process inspection.
+func (s *Server) Stock(ctx context.Context) map[string]int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stock := make(map[string]int64)
+	maps.Copy(stock, s.stockOfLocked(interceptors.TenantFromContext(ctx)))
+	return stock
+}
+
+// InventoryAdmin returns the admin service for changing the server's stock
+// levels at runtime.
+func (s *Server) InventoryAdmin() adminpb.InventoryAdminServer {
+	return inventoryAdmin{s: s}
+}
+
+// inventoryAdmin implements the InventoryAdmin service for a Server.
+type inventoryAdmin struct {
+	adminpb.UnimplementedInventoryAdminServer
+	s *Server
+}
+
+// SetStock implements the InventoryAdmin service.
+func (a inventoryAdmin) SetStock(ctx context.Context, req *adminpb.SetStockRequest) (*adminpb.StockLevels, error) {
+	for product, units := range req.GetStock() {
+		if product == "" || units < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "stock of %q is %d: want a product ID and non-negative units", product, units)
+		}
+	}
+	tenant := interceptors.TenantFromContext(ctx)
+	a.s.mu.Lock()
+	if req.GetReplace() {
+		a.s.stock[tenant] = make(map[string]int64, len(req.GetStock()))
+	}
+	maps.Copy(a.s.mutableStockLocked(tenant), req.GetStock())
+	a.s.mu.Unlock()
+	log.Printf("Stock set for %d product(s) of tenant %s (replace=%t)", len(req.GetStock()), tenant, req.GetReplace())
+	return &adminpb.StockLevels{Stock: a.s.Stock(ctx)}, nil
+}
+
+// GetStock implements the InventoryAdmin service.
+func (a inventoryAdmin) GetStock(ctx context.Context, req *adminpb.GetStockRequest) (*adminpb.StockLevels, error) {
+	return &adminpb.StockLevels{Stock: a.s.Stock(ctx)}, nil
+}
@@ -0,0 +1,230 @@
+package order_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// unitsOrder returns an order for userID of the given units by product ID.
+func unitsOrder(userID string, units map[string]int32) *orderpb.CreateOrderRequest {
+	details := &commonpb.OrderDetails{UserId: userID}
+	for product, quantity := range units {
+		details.Items = append(details.Items, &commonpb.Item{
+			ProductId: product,
+			Sku:       "SKU-" + product,
+			Quantity:  quantity,
+			Price:     money.MustParse(money.DefaultCurrency, "1.00"),
+		})
+	}
+	return &orderpb.CreateOrderRequest{Details: details}
+}
+
+func TestCreateOrderTakesStockAllOrNothing(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithStock(map[string]int64{"p1": 5, "p2": 1}))
+	ctx := context.Background()
+
+	_, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": 2, "p2": 3}))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("CreateOrder short of p2 = %v, want FailedPrecondition", err)
+	}
+	var shortage *orderpb.StockShortage
+	for _, detail := range status.Convert(err).Details() {
+		if d, ok := detail.(*orderpb.StockShortage); ok {
+			shortage = d
+		}
+	}
+	if len(shortage.GetItems()) != 1 || shortage.GetItems()[0].GetProductId() != "p2" || shortage.GetItems()[0].GetAvailable() != 1 {
+		t.Errorf("shortage detail = %v, want p2 with 1 available", shortage)
+	}
+	if got := s.Stock(ctx); got["p1"] != 5 || got["p2"] != 1 {
+		t.Errorf("stock after a refused order = %v, want it untouched", got)
+	}
+
+	resp, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": 2, "p2": 1, "untracked": 100}))
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if got := s.Stock(ctx); got["p1"] != 3 || got["p2"] != 0 {
+		t.Errorf("stock after an order = %v, want p1=3 p2=0", got)
+	}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: resp.GetOrderId()}); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: resp.GetOrderId()}); err != nil {
+		t.Fatalf("repeated CancelOrder: %v", err)
+	}
+	if got := s.Stock(ctx); got["p1"] != 5 || got["p2"] != 1 {
+		t.Errorf("stock after cancelling = %v, want p1=5 p2=1", got)
+	}
+}
+
+func TestCreateOrderRejectsNonPositiveQuantity(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithStock(map[string]int64{"p1": 5}))
+	ctx := context.Background()
+	for _, quantity := range []int32{0, -3} {
+		_, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": quantity}))
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("CreateOrder of %d units = %v, want InvalidArgument", quantity, err)
+		}
+	}
+	if got := s.Stock(ctx)["p1"]; got != 5 {
+		t.Errorf("stock = %d, want 5", got)
+	}
+}
+
+func TestStockIsPerTenant(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithStock(map[string]int64{"p1": 3}))
+	acme := interceptors.WithTenant(context.Background(), "acme")
+	globex := interceptors.WithTenant(context.Background(), "globex")
+
+	if _, err := s.CreateOrder(acme, unitsOrder("user-1", map[string]int32{"p1": 3})); err != nil {
+		t.Fatalf("CreateOrder for acme: %v", err)
+	}
+	if _, err := s.CreateOrder(globex, unitsOrder("user-1", map[string]int32{"p1": 3})); err != nil {
+		t.Fatalf("CreateOrder for globex after acme drained its own stock: %v", err)
+	}
+	if got := s.Stock(acme)["p1"]; got != 0 {
+		t.Errorf("acme stock = %d, want 0", got)
+	}
+
+	admin := s.InventoryAdmin()
+	if _, err := admin.SetStock(acme, &adminpb.SetStockRequest{Stock: map[string]int64{"p1": 10}}); err != nil {
+		t.Fatalf("SetStock: %v", err)
+	}
+	levels, err := admin.GetStock(globex, &adminpb.GetStockRequest{})
+	if err != nil || levels.GetStock()["p1"] != 0 {
+		t.Errorf("globex stock after acme's SetStock = %v, %v; want p1=0", levels, err)
+	}
+}
+
+// TestRepeatOrderThenCancel creates a second order under the same derived
+// ID after the first completed: cancelling the second returns only its own
+// units, not the completed order's.
+func TestRepeatOrderThenCancel(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithStock(map[string]int64{"p1": 10}), orderservice.WithIDGenerator(ids.Derived()))
+	ctx := context.Background()
+	first, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": 2}))
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if _, err := s.CompleteOrder(ctx, &orderpb.CompleteOrderRequest{OrderId: first.GetOrderId()}); err != nil {
+		t.Fatalf("CompleteOrder: %v", err)
+	}
+	second, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": 3}))
+	if err != nil {
+		t.Fatalf("second CreateOrder: %v", err)
+	}
+	if second.GetOrderId().GetId() != first.GetOrderId().GetId() {
+		t.Fatalf("orders %s and %s: want the same derived ID", first.GetOrderId().GetId(), second.GetOrderId().GetId())
+	}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: second.GetOrderId()}); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if got := s.Stock(ctx)["p1"]; got != 8 {
+		t.Errorf("stock = %d, want 8: the completed order's 2 units stay taken", got)
+	}
+}
+
+// TestPurgedOrderStockNotReturned purges a completed order, then creates and
+// cancels a new one under its ID: only the new order's units come back.
+func TestPurgedOrderStockNotReturned(t *testing.T) {
+	s := orderservice.NewServer(orderservice.WithStock(map[string]int64{"p1": 10}), orderservice.WithIDGenerator(ids.Derived()))
+	ctx := context.Background()
+	first, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": 2}))
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if _, err := s.CompleteOrder(ctx, &orderpb.CompleteOrderRequest{OrderId: first.GetOrderId()}); err != nil {
+		t.Fatalf("CompleteOrder: %v", err)
+	}
+	purged, err := s.OrderAdmin().PurgeOrders(ctx, &adminpb.PurgeOrdersRequest{Before: timestamppb.New(time.Now().Add(time.Hour))})
+	if err != nil || purged.GetPurged() != 1 {
+		t.Fatalf("PurgeOrders = %v, %v; want 1 purged", purged, err)
+	}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: first.GetOrderId()}); err != nil {
+		t.Fatalf("CancelOrder of the purged order: %v", err)
+	}
+	if got := s.Stock(ctx)["p1"]; got != 8 {
+		t.Errorf("stock after cancelling a purged order = %d, want 8", got)
+	}
+
+	second, err := s.CreateOrder(ctx, unitsOrder("user-1", map[string]int32{"p1": 3}))
+	if err != nil {
+		t.Fatalf("second CreateOrder: %v", err)
+	}
+	if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: second.GetOrderId()}); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if got := s.Stock(ctx)["p1"]; got != 8 {
+		t.Errorf("stock = %d, want 8", got)
+	}
+}
+
+// TestConcurrentCreateOrderNeverOversells races many orders for the same
+// products against a small stock, cancelling some: the units taken never
+// exceed what was seeded, and every unit is accounted for.
+func TestConcurrentCreateOrderNeverOversells(t *testing.T) {
+	const seeded = 50
+	s := orderservice.NewServer(
+		orderservice.WithStock(map[string]int64{"p1": seeded, "p2": seeded}),
+		orderservice.WithIDGenerator(ids.NewSequence()),
+	)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	held := 0 // Units of p1 (and p2) held by orders not cancelled
+	var wg sync.WaitGroup
+	for i := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			units := int32(i%3 + 1)
+			resp, err := s.CreateOrder(ctx, unitsOrder(fmt.Sprintf("user-%d", i), map[string]int32{"p1": units, "p2": units}))
+			if status.Code(err) == codes.FailedPrecondition {
+				return
+			}
+			if err != nil {
+				t.Errorf("CreateOrder: %v", err)
+				return
+			}
+			if i%4 == 0 {
+				if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: resp.GetOrderId()}); err != nil {
+					t.Errorf("CancelOrder: %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			held += int(units)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	stock := s.Stock(ctx)
+	for _, product := range []string{"p1", "p2"} {
+		if stock[product] < 0 {
+			t.Errorf("%s stock went negative: %d", product, stock[product])
+		}
+		if got := seeded - stock[product]; got != int64(held) {
+			t.Errorf("%s: %d units taken, want the %d held by live orders", product, got, held)
+		}
+	}
+	if held > seeded {
+		t.Errorf("%d units held, more than the %d seeded", held, seeded)
+	}
+}
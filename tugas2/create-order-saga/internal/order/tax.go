@@ -0,0 +1,89 @@
+package order
+
+import (
+	"fmt"
+	"strings"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// TaxRates maps a destination to its tax rate in basis points (725 = 7.25%).
+// Keys are a country ("US") or a country and state ("US-CA"); a state's rate
+// takes precedence over its country's. Destinations not listed are not taxed.
+type TaxRates map[string]int32
+
+// rateFor returns the rate applying to an address.
+func (r TaxRates) rateFor(addr *commonpb.ShippingAddress) int32 {
+	country := strings.ToUpper(strings.TrimSpace(addr.GetCountry()))
+	if state := strings.ToUpper(strings.TrimSpace(addr.GetState())); state != "" {
+		if bps, ok := r[country+"-"+state]; ok {
+			return bps
+		}
+	}
+	return r[country]
+}
+
+// ParseTaxRates parses a comma-separated list of destination=percent entries,
+// e.g. "US-CA=7.25,US-NY=4,DE=19". Percentages have at most two decimals. An
+// empty spec yields no rates.
+func ParseTaxRates(spec string) (TaxRates, error) {
+	rates := make(TaxRates)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		dest, percent, ok := strings.Cut(entry, "=")
+		dest = strings.ToUpper(strings.TrimSpace(dest))
+		if !ok || dest == "" {
+			return nil, fmt.Errorf("tax rate %q: want destination=percent", entry)
+		}
+		// Parsed as an exact decimal so 7.25 is 725 basis points, not 724.99...
+		p, err := money.Parse("", percent)
+		if err != nil || money.IsNegative(p) || p.Units > 100 || (p.Units == 100 && p.Nanos != 0) || p.Nanos%10_000_000 != 0 {
+			return nil, fmt.Errorf("tax rate %q: percent must be in [0, 100] with at most two decimals", entry)
+		}
+		rates[dest] = int32(p.Units*100 + int64(p.Nanos/10_000_000))
+	}
+	return rates, nil
+}
+
+// WithTaxRates sets the tax charged by destination (none by default).
+func WithTaxRates(rates TaxRates) Option {
+	return func(s *Server) {
+		s.taxRates = rates
+	}
+}
+
+// totalFor breaks down the total of a new order: the items' subtotal, tax at
+// the destination's rate, and the quoted shipping cost. Everything is in the
+// items' currency, which the shipping cost must be quoted in too.
+func (s *Server) totalFor(req *orderpb.CreateOrderRequest) (*orderpb.OrderTotal, error) {
+	subtotal, err := money.ItemsTotal(req.GetDetails().GetItems())
+	if err != nil {
+		return nil, fmt.Errorf("invalid item prices: %w", err)
+	}
+	bps := s.taxRates.rateFor(req.GetShippingAddress())
+	breakdown := &orderpb.OrderTotal{
+		Subtotal:   subtotal,
+		Tax:        money.Rate(subtotal, int64(bps)),
+		Shipping:   req.GetShippingCost(),
+		TaxRateBps: bps,
+	}
+	if breakdown.Shipping == nil {
+		breakdown.Shipping = money.New(subtotal.GetCurrencyCode(), 0, 0)
+	} else if err := money.Validate(breakdown.Shipping); err != nil {
+		return nil, fmt.Errorf("invalid shipping cost: %w", err)
+	} else if c := breakdown.Shipping.GetCurrencyCode(); c != subtotal.GetCurrencyCode() {
+		return nil, fmt.Errorf("shipping cost is in %s, not the order currency %s: %w", c, subtotal.GetCurrencyCode(), money.ErrCurrencyMismatch)
+	}
+	if breakdown.Total, err = money.Add(subtotal, breakdown.Tax); err == nil {
+		breakdown.Total, err = money.Add(breakdown.Total, breakdown.Shipping)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid shipping cost: %w", err)
+	}
+	return breakdown, nil
+}
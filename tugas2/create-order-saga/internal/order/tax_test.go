@@ -0,0 +1,118 @@
+package order_test
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	orderservice "create-order-saga/internal/order"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// TestOrderTotalTax creates the 46.00 USD sample order for destinations
+// taxed at different rates and checks its breakdown adds up: subtotal, tax
+// at the destination's rate rounded to cents, and shipping make the total.
+func TestOrderTotalTax(t *testing.T) {
+	rates := orderservice.TaxRates{"US": 500, "US-CA": 725, "DE": 1900, "FR": 0}
+	for _, tc := range []struct {
+		name           string
+		country, state string
+		shipping       string // Quoted shipping cost; none if empty
+		wantBps        int32
+		wantTax        string
+		wantTotal      string
+	}{
+		{"state rate", "US", "CA", "", 725, "3.34", "49.34"}, // 3.335 rounds up
+		{"country rate for an unlisted state", "US", "NY", "", 500, "2.30", "48.30"},
+		{"country without states", "DE", "", "", 1900, "8.74", "54.74"},
+		{"lower-case address", "us", "ca", "", 725, "3.34", "49.34"},
+		{"zero rate", "FR", "", "", 0, "0", "46"},
+		{"untaxed destination", "GoLand", "Workflow", "", 0, "0", "46"},
+		{"with shipping", "US", "CA", "5.99", 725, "3.34", "55.33"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := orderservice.NewServer(orderservice.WithTaxRates(rates))
+			req := &orderpb.CreateOrderRequest{
+				Details:         sagatest.SampleOrder("user-1"),
+				ShippingAddress: &commonpb.ShippingAddress{Country: tc.country, State: tc.state},
+			}
+			if tc.shipping != "" {
+				req.ShippingCost = money.MustParse("USD", tc.shipping)
+			}
+			resp, err := s.CreateOrder(context.Background(), req)
+			if err != nil {
+				t.Fatalf("CreateOrder: %v", err)
+			}
+
+			total := resp.GetTotal()
+			if total.GetTaxRateBps() != tc.wantBps {
+				t.Errorf("tax rate = %d bps, want %d", total.GetTaxRateBps(), tc.wantBps)
+			}
+			for _, c := range []struct {
+				name string
+				got  *commonpb.Money
+				want string
+			}{
+				{"subtotal", total.GetSubtotal(), "46"},
+				{"tax", total.GetTax(), tc.wantTax},
+				{"total", total.GetTotal(), tc.wantTotal},
+			} {
+				if want := money.MustParse("USD", c.want); !proto.Equal(c.got, want) {
+					t.Errorf("%s = %s, want %s", c.name, money.Format(c.got), money.Format(want))
+				}
+			}
+			sum, _ := money.Add(total.GetSubtotal(), total.GetTax())
+			if sum, _ = money.Add(sum, total.GetShipping()); !proto.Equal(sum, total.GetTotal()) {
+				t.Errorf("subtotal + tax + shipping = %s, total %s", money.Format(sum), money.Format(total.GetTotal()))
+			}
+			order, _ := s.Lookup(context.Background(), resp.GetOrderId().GetId())
+			if !proto.Equal(order.GetBreakdown(), total) || !proto.Equal(order.GetTotalAmount(), total.GetTotal()) {
+				t.Errorf("stored order total = %s (%v), want the response's breakdown", money.Format(order.GetTotalAmount()), order.GetBreakdown())
+			}
+		})
+	}
+}
+
+// TestSagaChargesTaxedTotal runs a saga to a taxed destination and checks the
+// payment taken is the order's grand total, tax and shipping included,
+// rather than the items' price the client asked to charge.
+func TestSagaChargesTaxedTotal(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithTaxRates(orderservice.TaxRates{"GOLAND": 1000}))
+	state, err := h.Run(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	order, _ := h.Order.Lookup(context.Background(), state.OrderID.GetId())
+	payment, _ := h.Payment.Lookup(context.Background(), state.PaymentID)
+
+	total := order.GetBreakdown()
+	if want := money.MustParse("USD", "4.60"); !proto.Equal(total.GetTax(), want) {
+		t.Errorf("tax = %s, want %s", money.Format(total.GetTax()), money.Format(want))
+	}
+	sum, _ := money.Add(total.GetSubtotal(), total.GetTax())
+	sum, _ = money.Add(sum, total.GetShipping())
+	if !proto.Equal(payment.GetAmount(), sum) || !proto.Equal(payment.GetAmount(), total.GetTotal()) {
+		t.Errorf("charged %s, want subtotal + tax + shipping = %s (total %s)", money.Format(payment.GetAmount()), money.Format(sum), money.Format(total.GetTotal()))
+	}
+}
+
+func TestParseTaxRates(t *testing.T) {
+	rates, err := orderservice.ParseTaxRates(" us-ca=7.25, US-NY=4 ,DE=19,FR=0,UK=0.5,")
+	want := orderservice.TaxRates{"US-CA": 725, "US-NY": 400, "DE": 1900, "FR": 0, "UK": 50}
+	if err != nil || !maps.Equal(rates, want) {
+		t.Errorf("ParseTaxRates = %v, %v; want %v", rates, err, want)
+	}
+	if rates, err := orderservice.ParseTaxRates(""); err != nil || len(rates) != 0 {
+		t.Errorf("ParseTaxRates of an empty spec = %v, %v; want no rates", rates, err)
+	}
+	for _, spec := range []string{"US", "=5", "US=", "US=abc", "US=-1", "US=100.01", "US=101", "US=7.255"} {
+		if rates, err := orderservice.ParseTaxRates(spec); err == nil {
+			t.Errorf("ParseTaxRates(%q) = %v, want an error", spec, rates)
+		}
+	}
+}
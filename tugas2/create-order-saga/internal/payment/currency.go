@@ -0,0 +1,80 @@
+package payment
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+)
+
+// WithCurrencies accepts only payments in the given currencies, refusing
+// others with codes.InvalidArgument. By default any currency is accepted.
+func WithCurrencies(currencies []string) Option {
+	return func(s *Server) {
+		s.currencies = slices.Clone(currencies)
+	}
+}
+
+// orderCurrency returns the currency of the order info pays for: its
+// currency_code, or the amount's if that is unset.
+func orderCurrency(info *commonpb.PaymentInfo) string {
+	if info.GetCurrencyCode() != "" {
+		return info.GetCurrencyCode()
+	}
+	return info.GetAmount().GetCurrencyCode()
+}
+
+// accepts reports whether payments in currency are accepted.
+func (s *Server) accepts(currency string) bool {
+	return len(s.currencies) == 0 || slices.Contains(s.currencies, currency)
+}
+
+// checkCurrency refuses a payment in a currency that is not accepted with
+// codes.InvalidArgument, and one whose amount is not in the order's currency
+// with codes.FailedPrecondition. Malformed amounts are left to the payment
+// details check.
+func (s *Server) checkCurrency(orderID string, info *commonpb.PaymentInfo) error {
+	if money.Validate(info.GetAmount()) != nil {
+		return nil
+	}
+	paid, ordered := info.GetAmount().GetCurrencyCode(), orderCurrency(info)
+	if !s.accepts(paid) {
+		log.Printf("Payment for order %s refused: currency %s is not accepted", orderID, paid)
+		detail := errinfo.New(errinfo.DomainPayment, errinfo.ReasonCurrencyRejected, map[string]string{"order_id": orderID, "currency": paid})
+		return errinfo.Errorf(codes.InvalidArgument, detail, "currency %s is not accepted (accepted: %s)", paid, strings.Join(s.currencies, ", "))
+	}
+	if paid != ordered {
+		log.Printf("Payment for order %s refused: amount in %s, order in %s", orderID, paid, ordered)
+		detail := errinfo.New(errinfo.DomainPayment, errinfo.ReasonCurrencyMismatch, map[string]string{"order_id": orderID, "order_currency": ordered, "payment_currency": paid})
+		return errinfo.Errorf(codes.FailedPrecondition, detail, "payment amount is in %s but order %s is in %s", paid, orderID, ordered)
+	}
+	return nil
+}
+
+// currencyViolations reports what checkCurrency would refuse info for.
+func (s *Server) currencyViolations(info *commonpb.PaymentInfo) []*commonpb.FieldViolation {
+	if money.Validate(info.GetAmount()) != nil {
+		return nil
+	}
+	var violations []*commonpb.FieldViolation
+	paid, ordered := info.GetAmount().GetCurrencyCode(), orderCurrency(info)
+	if !s.accepts(paid) {
+		violations = append(violations, &commonpb.FieldViolation{
+			Field:       "payment_info.amount.currency_code",
+			Description: fmt.Sprintf("currency %s is not accepted (accepted: %s)", paid, strings.Join(s.currencies, ", ")),
+		})
+	}
+	if paid != ordered {
+		violations = append(violations, &commonpb.FieldViolation{
+			Field:       "payment_info.currency_code",
+			Description: fmt.Sprintf("payment amount is in %s but the order is in %s", paid, ordered),
+		})
+	}
+	return violations
+}
@@ -0,0 +1,201 @@
+package payment_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// paymentIn returns SamplePayment with its amount in paid for an order in
+// ordered (left unset if empty).
+func paymentIn(paid, ordered string) *commonpb.PaymentInfo {
+	info := sagatest.SamplePayment()
+	info.Amount = money.MustParse(paid, "46.00")
+	info.CurrencyCode = ordered
+	return info
+}
+
+// TestProcessPaymentCurrency charges amounts in accepted, refused and
+// mismatched currencies: only a payment in an accepted currency matching the
+// order's is charged, the others are refused before the gateway with the
+// reason why.
+func TestProcessPaymentCurrency(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		accepted   []string
+		info       *commonpb.PaymentInfo
+		wantCode   codes.Code
+		wantReason string
+	}{
+		{"any currency by default", nil, paymentIn("EUR", "EUR"), codes.OK, ""},
+		{"accepted", []string{"USD", "EUR"}, paymentIn("EUR", "EUR"), codes.OK, ""},
+		{"order currency unset", []string{"EUR"}, paymentIn("EUR", ""), codes.OK, ""},
+		{"not accepted", []string{"USD"}, paymentIn("EUR", "EUR"), codes.InvalidArgument, errinfo.ReasonCurrencyRejected},
+		{"mismatched", nil, paymentIn("USD", "EUR"), codes.FailedPrecondition, errinfo.ReasonCurrencyMismatch},
+		{"not accepted and mismatched", []string{"EUR"}, paymentIn("USD", "EUR"), codes.InvalidArgument, errinfo.ReasonCurrencyRejected},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := &recordingGateway{name: "card"}
+			s := newServer(paymentservice.WithGateway(gateway), paymentservice.WithCurrencies(tc.accepted))
+			resp, err := s.ProcessPayment(context.Background(), &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: tc.info})
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("ProcessPayment = %v, %v; want %s", resp, err, tc.wantCode)
+			}
+			if tc.wantCode == codes.OK {
+				if resp.GetStatus() != paymentpb.PaymentStatus_SUCCESS || len(gateway.charged) != 1 {
+					t.Errorf("ProcessPayment = %v with %d charges, want one successful charge", resp, len(gateway.charged))
+				}
+				return
+			}
+			if info, _ := errinfo.From(err); info.GetReason() != tc.wantReason || info.GetMetadata()["order_id"] != "order-1" {
+				t.Errorf("error info = %v, want %s for order-1", info, tc.wantReason)
+			}
+			if len(gateway.charged) != 0 {
+				t.Errorf("gateway charged %d times, want refused before charging", len(gateway.charged))
+			}
+			if payments := s.OrderPayments(context.Background(), "order-1"); len(payments) != 0 {
+				t.Errorf("payments stored = %v, want none", payments)
+			}
+		})
+	}
+}
+
+// TestValidatePaymentCurrency checks ValidatePayment reports a currency that
+// is not accepted and one that is not the order's, each on its own field.
+func TestValidatePaymentCurrency(t *testing.T) {
+	s := newServer(paymentservice.WithCurrencies([]string{"EUR"}))
+	for _, tc := range []struct {
+		name       string
+		info       *commonpb.PaymentInfo
+		wantFields []string
+	}{
+		{"valid", paymentIn("EUR", "EUR"), nil},
+		{"not accepted", paymentIn("USD", "USD"), []string{"payment_info.amount.currency_code"}},
+		{"mismatched", paymentIn("EUR", "USD"), []string{"payment_info.currency_code"}},
+		{"both", paymentIn("USD", "EUR"), []string{"payment_info.amount.currency_code", "payment_info.currency_code"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := s.ValidatePayment(context.Background(), &paymentpb.ValidatePaymentRequest{PaymentInfo: tc.info})
+			if err != nil {
+				t.Fatalf("ValidatePayment: %v", err)
+			}
+			var fields []string
+			for _, v := range resp.GetViolations() {
+				fields = append(fields, v.GetField())
+			}
+			if resp.GetValid() != (len(tc.wantFields) == 0) || !slices.Equal(fields, tc.wantFields) {
+				t.Errorf("ValidatePayment = %v, want violations of %q", resp, tc.wantFields)
+			}
+		})
+	}
+}
+
+// eurOrder returns SampleOrder priced in EUR.
+func eurOrder(userID string) *commonpb.OrderDetails {
+	details := sagatest.SampleOrder(userID)
+	for _, item := range details.Items {
+		item.Price.CurrencyCode = "EUR"
+	}
+	return details
+}
+
+// TestSagaCurrency runs sagas for a EUR order: paid in EUR it completes with
+// the order, charge and shipment all in EUR; paid in USD, or with the Payment
+// service taking only USD, the payment is refused with the reason and the
+// order cancelled.
+func TestSagaCurrency(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		accepted   []string
+		paid       string
+		wantCode   codes.Code
+		wantReason string
+	}{
+		{"paid in the order currency", nil, "EUR", codes.OK, ""},
+		{"paid in another currency", nil, "USD", codes.FailedPrecondition, errinfo.ReasonCurrencyMismatch},
+		{"currency not accepted", []string{"USD"}, "EUR", codes.InvalidArgument, errinfo.ReasonCurrencyRejected},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := sagatest.New(t, sagatest.WithPaymentOptions(paymentservice.WithCurrencies(tc.accepted)))
+			info := sagatest.SamplePayment()
+			info.Amount.CurrencyCode = tc.paid
+			ctx := context.Background()
+			state, err := h.Orchestrator.RunCreateOrderSaga(ctx, eurOrder("user-1"), info, sagatest.SampleAddress())
+
+			if tc.wantCode != codes.OK {
+				var stepErr *orchestrator.StepError
+				if !errors.As(err, &stepErr) || !errors.Is(err, orchestrator.ErrPaymentFailed) || stepErr.Status.Code() != tc.wantCode {
+					t.Fatalf("saga error = %v, want ProcessPayment failing with %s", err, tc.wantCode)
+				}
+				if stepErr.Info.GetReason() != tc.wantReason {
+					t.Errorf("error info = %v, want %s", stepErr.Info, tc.wantReason)
+				}
+				if st, _ := h.OrderStatus(state.OrderID.GetId()); st != orderpb.OrderStatus_CANCELLED {
+					t.Errorf("order is %s, want CANCELLED", st)
+				}
+				if payments := h.Payment.OrderPayments(ctx, state.OrderID.GetId()); len(payments) != 0 {
+					t.Errorf("payments stored = %v, want none", payments)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("saga: %v", err)
+			}
+			order, _ := h.Order.Lookup(ctx, state.OrderID.GetId())
+			if order.GetCurrencyCode() != "EUR" || order.GetTotalAmount().GetCurrencyCode() != "EUR" {
+				t.Errorf("order currency %q, total %s; want both in EUR", order.GetCurrencyCode(), money.Format(order.GetTotalAmount()))
+			}
+			payment, _ := h.Payment.Lookup(ctx, state.PaymentID)
+			if cmp, err := money.Compare(payment.GetAmount(), order.GetTotalAmount()); err != nil || cmp != 0 {
+				t.Errorf("charged %s, want the order total %s", money.Format(payment.GetAmount()), money.Format(order.GetTotalAmount()))
+			}
+			if len(state.ShipmentIDs) == 0 {
+				t.Fatal("saga reserved no shipment")
+			}
+			for _, id := range state.ShipmentIDs {
+				if shipment, _ := h.Shipping.Lookup(ctx, id); shipment.GetCost().GetCurrencyCode() != "EUR" {
+					t.Errorf("shipment %s costs %s, want EUR", id, money.Format(shipment.GetCost()))
+				}
+			}
+		})
+	}
+}
+
+// TestSagaMixedCurrency runs a saga for an order priced partly in EUR and
+// partly in USD: it is rejected when the order is created, before anything
+// is charged.
+func TestSagaMixedCurrency(t *testing.T) {
+	h := sagatest.New(t)
+	details := sagatest.SampleOrder("user-1")
+	details.Items[1].Price.CurrencyCode = "EUR"
+	ctx := context.Background()
+	_, err := h.Orchestrator.RunCreateOrderSaga(ctx, details, sagatest.SamplePayment(), sagatest.SampleAddress())
+
+	var stepErr *orchestrator.StepError
+	if !errors.As(err, &stepErr) || !errors.Is(err, orchestrator.ErrCreateOrderFailed) || stepErr.Status.Code() != codes.InvalidArgument {
+		t.Fatalf("saga error = %v, want CreateOrder failing with InvalidArgument", err)
+	}
+	if _, ok := h.OrderStatus("order-user-1"); ok {
+		t.Error("order stored, want none")
+	}
+	if payments := h.Payment.OrderPayments(ctx, "order-user-1"); len(payments) != 0 {
+		t.Errorf("payments stored = %v, want none", payments)
+	}
+	validation, err := h.Order.ValidateOrder(ctx, &orderpb.ValidateOrderRequest{Details: details})
+	if err != nil || validation.GetValid() {
+		t.Errorf("ValidateOrder = %v, %v; want the mixed currencies reported", validation, err)
+	}
+}
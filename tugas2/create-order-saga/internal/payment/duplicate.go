@@ -0,0 +1,91 @@
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// WithDuplicateWindow refuses to charge a payment method the same amount it
+// was charged within d for another order, unless the request sets
+// allow_duplicate (disabled by default). Such payments are answered with
+// DUPLICATE_SUSPECTED and never charged. A charge that was since refunded no
+// longer counts.
+func WithDuplicateWindow(d time.Duration) Option {
+	return func(s *Server) {
+		s.duplicateWindow = d
+	}
+}
+
+// WithStrictDuplicates answers suspected duplicates with FAILED rather than
+// DUPLICATE_SUSPECTED, for callers that only know the original statuses. The
+// response still sets duplicate_suspected.
+func WithStrictDuplicates(strict bool) Option {
+	return func(s *Server) {
+		s.strictDuplicates = strict
+	}
+}
+
+// recentCharge is the last successful charge of a payment fingerprint.
+type recentCharge struct {
+	paymentID string
+	orderID   string
+	at        time.Time
+}
+
+// fingerprint identifies the payment method and amount of info without
+// keeping the account details.
+func fingerprint(info *commonpb.PaymentInfo) string {
+	var account string
+	switch method := paymentMethod(info); method {
+	case commonpb.PaymentMethodType_WALLET:
+		account = info.GetWallet().GetProvider() + "/" + info.GetWallet().GetAccountId()
+	case commonpb.PaymentMethodType_BANK_TRANSFER:
+		account = info.GetBankTransfer().GetIban()
+	default:
+		account = info.GetCardNumber()
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%s|%s", paymentMethod(info), account, money.Format(info.GetAmount())))
+	return hex.EncodeToString(sum[:])
+}
+
+// duplicateOf returns the payment a charge of info for orderID would
+// duplicate: a charge still standing of the same fingerprint for another
+// order within the duplicate window.
+func (s *Server) duplicateOf(ctx context.Context, orderID string, info *commonpb.PaymentInfo) (string, bool) {
+	if s.duplicateWindow <= 0 {
+		return "", false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	recent, ok := s.recentCharges[keyFor(ctx, fingerprint(info))]
+	if !ok || recent.orderID == orderID || s.clock.Now().Sub(recent.at) >= s.duplicateWindow {
+		return "", false
+	}
+	switch s.payments[keyFor(ctx, recent.paymentID)].GetStatus() {
+	case paymentpb.PaymentStatus_SUCCESS, paymentpb.PaymentStatus_PARTIALLY_REFUNDED:
+	default:
+		return "", false // Refunded in full since
+	}
+	return recent.paymentID, true
+}
+
+// rememberChargeLocked records a successful charge for duplicate detection,
+// forgetting charges that left the window. Caller holds s.mu.
+func (s *Server) rememberChargeLocked(ctx context.Context, payment *paymentpb.Payment, info *commonpb.PaymentInfo, now time.Time) {
+	if s.duplicateWindow <= 0 {
+		return
+	}
+	for key, recent := range s.recentCharges {
+		if now.Sub(recent.at) >= s.duplicateWindow {
+			delete(s.recentCharges, key)
+		}
+	}
+	s.recentCharges[keyFor(ctx, fingerprint(info))] = recentCharge{paymentID: payment.Id, orderID: payment.GetOrderId().GetId(), at: now}
+}
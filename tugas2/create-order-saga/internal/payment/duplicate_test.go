@@ -0,0 +1,103 @@
+package payment_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// TestDuplicateWindow charges SamplePayment for order-1 and then for order-2
+// under a one-minute duplicate window: the second charge is held back as a
+// suspected duplicate only while order-1's charge is recent and standing, the
+// same account and amount, and not explicitly allowed.
+func TestDuplicateWindow(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		strict        bool
+		between       func(t *testing.T, s *paymentservice.Server, fake *clock.Fake, firstID string)
+		second        func(req *paymentpb.ProcessPaymentRequest)
+		wantStatus    paymentpb.PaymentStatus
+		wantSuspected bool
+	}{
+		{name: "within the window", between: advance(59 * time.Second), wantStatus: paymentpb.PaymentStatus_DUPLICATE_SUSPECTED, wantSuspected: true},
+		{name: "strict mode", strict: true, wantStatus: paymentpb.PaymentStatus_FAILED, wantSuspected: true},
+		{name: "outside the window", between: advance(time.Minute), wantStatus: paymentpb.PaymentStatus_SUCCESS},
+		{name: "allowed duplicate", second: func(req *paymentpb.ProcessPaymentRequest) { req.AllowDuplicate = true }, wantStatus: paymentpb.PaymentStatus_SUCCESS},
+		{name: "other amount", second: func(req *paymentpb.ProcessPaymentRequest) {
+			req.PaymentInfo.Amount = money.MustParse(money.DefaultCurrency, "46.01")
+		}, wantStatus: paymentpb.PaymentStatus_SUCCESS},
+		{name: "other card", second: func(req *paymentpb.ProcessPaymentRequest) {
+			req.PaymentInfo.CardNumber = "4000-0566-5566-5556"
+		}, wantStatus: paymentpb.PaymentStatus_SUCCESS},
+		{name: "first refunded", between: func(t *testing.T, s *paymentservice.Server, _ *clock.Fake, firstID string) {
+			t.Helper()
+			resp, err := s.RefundPayment(context.Background(), &paymentpb.RefundPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentId: firstID})
+			if err != nil || !resp.GetRefunded() {
+				t.Fatalf("RefundPayment = %v, %v", resp, err)
+			}
+		}, wantStatus: paymentpb.PaymentStatus_SUCCESS},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+			var charges atomic.Int32
+			s := newServer(
+				paymentservice.WithClock(fake),
+				paymentservice.WithDuplicateWindow(time.Minute),
+				paymentservice.WithStrictDuplicates(tc.strict),
+				paymentservice.WithGateway(paymentservice.GatewayFunc(func(_ context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+					charges.Add(1)
+					return "txn-" + orderID, nil
+				})),
+			)
+			ctx := context.Background()
+			first, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: sagatest.SamplePayment()})
+			if err != nil || first.GetStatus() != paymentpb.PaymentStatus_SUCCESS || first.GetDuplicateSuspected() {
+				t.Fatalf("first ProcessPayment = %v, %v; want SUCCESS", first, err)
+			}
+			if tc.between != nil {
+				tc.between(t, s, fake, first.GetPaymentId())
+			}
+
+			req := &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-2"}, PaymentInfo: sagatest.SamplePayment()}
+			if tc.second != nil {
+				tc.second(req)
+			}
+			second, err := s.ProcessPayment(ctx, req)
+			if err != nil {
+				t.Fatalf("second ProcessPayment: %v", err)
+			}
+			if second.GetStatus() != tc.wantStatus || second.GetDuplicateSuspected() != tc.wantSuspected {
+				t.Errorf("second ProcessPayment = %s (suspected %t, %q), want %s (suspected %t)", second.GetStatus(), second.GetDuplicateSuspected(), second.GetMessage(), tc.wantStatus, tc.wantSuspected)
+			}
+			wantCharges := int32(2)
+			if tc.wantSuspected {
+				wantCharges = 1
+			}
+			if charges.Load() != wantCharges {
+				t.Errorf("gateway charged %d times, want %d", charges.Load(), wantCharges)
+			}
+			if !tc.wantSuspected {
+				return
+			}
+
+			// A suspected duplicate was never charged, so there is nothing to refund
+			refund, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-2"}, PaymentId: second.GetPaymentId()})
+			if err != nil || refund.GetCode() != commonpb.CompensationCode_ALREADY_DONE || refund.GetRefunded() {
+				t.Errorf("refunding the suspected duplicate = %v, %v; want ALREADY_DONE without a refund", refund, err)
+			}
+		})
+	}
+}
+
+// advance returns a step moving the fake clock forward by d.
+func advance(d time.Duration) func(*testing.T, *paymentservice.Server, *clock.Fake, string) {
+	return func(_ *testing.T, _ *paymentservice.Server, fake *clock.Fake, _ string) { fake.Advance(d) }
+}
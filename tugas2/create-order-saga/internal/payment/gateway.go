@@ -0,0 +1,128 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	commonpb "create-order-saga/proto/common"
+)
+
+// ErrDeclined is returned (possibly wrapped) by a Gateway when the payment is
+// refused. It is a business outcome: the payment is recorded as FAILED.
+var ErrDeclined = errors.New("payment declined")
+
+// Gateway is the external payment processor the service charges payments
+// through. Several can be configured to fail over to one another (see
+// WithGateways), and each payment method can have its own (see
+// WithMethodGateway).
+//
+// Charge returns the gateway's transaction ID on success, an error matching
+// ErrDeclined when the charge is refused, and any other error when the gateway
+// could not process it (an outage). Outages are reported to the caller as
+// codes.Unavailable, which clients retry; declines are not retried.
+type Gateway interface {
+	Charge(ctx context.Context, orderID string, info *commonpb.PaymentInfo) (transactionID string, err error)
+}
+
+// GatewayFunc adapts a function to the Gateway interface.
+type GatewayFunc func(ctx context.Context, orderID string, info *commonpb.PaymentInfo) (string, error)
+
+// Charge calls f.
+func (f GatewayFunc) Charge(ctx context.Context, orderID string, info *commonpb.PaymentInfo) (string, error) {
+	return f(ctx, orderID, info)
+}
+
+// NamedGateway is a Gateway with the name payments record it under.
+type NamedGateway struct {
+	Name string
+	Gateway
+}
+
+// Gateway names used when none is given.
+const (
+	DefaultGatewayName   = "default"   // The gateway set by WithGateway
+	SimulatedGatewayName = "simulated" // The simulated gateway used when none is set
+)
+
+// gatewaysFor returns the gateways charging payments made by method, in the
+// order they are tried.
+func (s *Server) gatewaysFor(method commonpb.PaymentMethodType) []NamedGateway {
+	if g, ok := s.methodGateways[method]; ok {
+		return []NamedGateway{{Name: strings.ToLower(method.String()), Gateway: g}}
+	}
+	return s.gateways
+}
+
+// charge charges a payment made by method through its gateways, returning
+// the transaction ID and the name of the gateway that approved or declined
+// it. When a gateway is unavailable the next one is tried, if failover is on;
+// a decline is final. If no gateway could process the charge, the error
+// lists why for each gateway tried.
+func (s *Server) charge(ctx context.Context, method commonpb.PaymentMethodType, orderID string, info *commonpb.PaymentInfo) (transactionID, gateway string, err error) {
+	gateways := s.gatewaysFor(method)
+	var outages []string
+	for i, g := range gateways {
+		txn, err := g.Charge(ctx, orderID, info)
+		if err == nil || errors.Is(err, ErrDeclined) {
+			return txn, g.Name, err
+		}
+		outages = append(outages, g.Name+": "+err.Error())
+		if ctx.Err() != nil || !s.gatewayFailover || i == len(gateways)-1 {
+			break
+		}
+		log.Printf("WARNING: Gateway %s unavailable for order %s, failing over to %s: %v", g.Name, orderID, gateways[i+1].Name, err)
+	}
+	return "", "", errors.New(strings.Join(outages, "; "))
+}
+
+// ParseSimulatedGateways parses a comma-separated list of name[=outage rate]
+// entries into simulated gateways declining at declineRate, e.g.
+// "primary=0.5,backup". Gateways without a rate are unavailable at
+// outageRate. An empty spec yields no gateways.
+func ParseSimulatedGateways(spec string, declineRate, outageRate float64) ([]NamedGateway, error) {
+	var gateways []NamedGateway
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rateText, hasRate := strings.Cut(entry, "=")
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("gateway %q: want a unique name[=outage rate]", entry)
+		}
+		seen[name] = true
+		rate := outageRate
+		if hasRate {
+			var err error
+			if rate, err = strconv.ParseFloat(rateText, 64); err != nil || rate < 0 || rate > 1 {
+				return nil, fmt.Errorf("gateway %q: outage rate must be a number in [0, 1]", entry)
+			}
+		}
+		gateways = append(gateways, NamedGateway{Name: name, Gateway: &SimulatedGateway{DeclineRate: declineRate, OutageRate: rate}})
+	}
+	return gateways, nil
+}
+
+// SimulatedGateway randomly declines charges or fails as if unreachable.
+type SimulatedGateway struct {
+	DeclineRate float64 // Probability in [0, 1] that a charge is declined
+	OutageRate  float64 // Probability in [0, 1] that the gateway is unavailable
+}
+
+// Charge simulates a charge; the outage check runs first, so an unavailable
+// gateway never declines.
+func (g *SimulatedGateway) Charge(_ context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+	if rand.Float64() < g.OutageRate {
+		return "", errors.New("gateway connection refused (simulated outage)")
+	}
+	if rand.Float64() < g.DeclineRate {
+		return "", fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	}
+	return "txn-" + orderID, nil
+}
@@ -0,0 +1,145 @@
+package payment_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/orchestrator"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// scriptedGateway answers every charge with err, or approves it if err is
+// nil, and counts the charges it was asked for.
+type scriptedGateway struct {
+	name  string
+	err   error
+	calls atomic.Int32
+}
+
+func (g *scriptedGateway) Charge(_ context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+	g.calls.Add(1)
+	if g.err != nil {
+		return "", g.err
+	}
+	return g.name + "-" + orderID, nil
+}
+
+var (
+	errOutage  = errors.New("connection refused")
+	errDecline = errors.Join(paymentservice.ErrDeclined, errors.New("insufficient funds"))
+)
+
+// TestProcessPaymentFailover charges through a primary and a backup gateway
+// and checks an unavailable primary fails over to the backup only when
+// failover is on, a decline is final, and a payment records the gateway that
+// answered it.
+func TestProcessPaymentFailover(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		primary, backup    error
+		disableFailover    bool
+		wantCode           codes.Code
+		wantStatus         paymentpb.PaymentStatus
+		wantGateway        string
+		wantBackupCalls    int32
+		wantErrMentionsAll bool
+	}{
+		{name: "primary up", wantStatus: paymentpb.PaymentStatus_SUCCESS, wantGateway: "primary"},
+		{name: "primary down", primary: errOutage, wantStatus: paymentpb.PaymentStatus_SUCCESS, wantGateway: "backup", wantBackupCalls: 1},
+		{name: "primary declines", primary: errDecline, wantStatus: paymentpb.PaymentStatus_FAILED, wantGateway: "primary"},
+		{name: "failover off", primary: errOutage, disableFailover: true, wantCode: codes.Unavailable},
+		{name: "every gateway down", primary: errOutage, backup: errOutage, wantCode: codes.Unavailable, wantBackupCalls: 1, wantErrMentionsAll: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			primary, backup := &scriptedGateway{name: "primary", err: tc.primary}, &scriptedGateway{name: "backup", err: tc.backup}
+			s := newServer(
+				paymentservice.WithGateways(paymentservice.NamedGateway{Name: "primary", Gateway: primary}, paymentservice.NamedGateway{Name: "backup", Gateway: backup}),
+				paymentservice.WithGatewayFailover(!tc.disableFailover),
+			)
+			ctx := context.Background()
+			resp, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: sagatest.SamplePayment()})
+			if got := backup.calls.Load(); primary.calls.Load() != 1 || got != tc.wantBackupCalls {
+				t.Errorf("gateways charged %d and %d times, want 1 and %d", primary.calls.Load(), got, tc.wantBackupCalls)
+			}
+
+			if tc.wantCode != codes.OK {
+				if status.Code(err) != tc.wantCode {
+					t.Fatalf("ProcessPayment = %v, %v; want %s", resp, err, tc.wantCode)
+				}
+				if msg := status.Convert(err).Message(); tc.wantErrMentionsAll && (!strings.Contains(msg, "primary: ") || !strings.Contains(msg, "backup: ")) {
+					t.Errorf("error %q does not say why each gateway failed", msg)
+				}
+				if payments := s.OrderPayments(ctx, "order-1"); len(payments) != 0 {
+					t.Errorf("an unprocessed charge recorded payments %v", payments)
+				}
+				return
+			}
+			if err != nil || resp.GetStatus() != tc.wantStatus {
+				t.Fatalf("ProcessPayment = %v, %v; want %s", resp, err, tc.wantStatus)
+			}
+			payment, _ := s.Lookup(ctx, resp.GetPaymentId())
+			if payment.GetGateway() != tc.wantGateway {
+				t.Errorf("payment recorded gateway %q, want %q", payment.GetGateway(), tc.wantGateway)
+			}
+			if tc.wantStatus == paymentpb.PaymentStatus_SUCCESS && payment.GetTransactionId() != tc.wantGateway+"-order-1" {
+				t.Errorf("payment recorded transaction %q, want the %s gateway's", payment.GetTransactionId(), tc.wantGateway)
+			}
+		})
+	}
+}
+
+// TestSagaGatewayFailover runs a saga with the primary gateway down and checks
+// it completes, charged through the backup.
+func TestSagaGatewayFailover(t *testing.T) {
+	primary, backup := &scriptedGateway{name: "primary", err: errOutage}, &scriptedGateway{name: "backup"}
+	h := sagatest.New(t, sagatest.WithPaymentOptions(paymentservice.WithGateways(
+		paymentservice.NamedGateway{Name: "primary", Gateway: primary},
+		paymentservice.NamedGateway{Name: "backup", Gateway: backup},
+	)))
+	state, err := h.Run(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("saga with the primary gateway down = %v", err)
+	}
+	payment, _ := h.Payment.Lookup(context.Background(), state.PaymentID)
+	if payment.GetStatus() != paymentpb.PaymentStatus_SUCCESS || payment.GetGateway() != "backup" {
+		t.Errorf("payment is %s via %q, want SUCCESS via backup", payment.GetStatus(), payment.GetGateway())
+	}
+
+	backup.err = errOutage
+	if _, err := h.Run(context.Background(), "user-2"); !errors.Is(err, orchestrator.ErrPaymentFailed) {
+		t.Errorf("saga with every gateway down = %v, want ErrPaymentFailed", err)
+	}
+}
+
+func TestParseSimulatedGateways(t *testing.T) {
+	gateways, err := paymentservice.ParseSimulatedGateways(" primary=0.5 , backup", 0.1, 0.2)
+	if err != nil {
+		t.Fatalf("ParseSimulatedGateways: %v", err)
+	}
+	if len(gateways) != 2 || gateways[0].Name != "primary" || gateways[1].Name != "backup" {
+		t.Fatalf("gateways = %+v, want primary then backup", gateways)
+	}
+	for i, wantOutage := range []float64{0.5, 0.2} {
+		g, ok := gateways[i].Gateway.(*paymentservice.SimulatedGateway)
+		if !ok || g.OutageRate != wantOutage || g.DeclineRate != 0.1 {
+			t.Errorf("gateway %s = %+v, want outage rate %v and decline rate 0.1", gateways[i].Name, gateways[i].Gateway, wantOutage)
+		}
+	}
+	if gateways, err := paymentservice.ParseSimulatedGateways("", 0, 0); err != nil || len(gateways) != 0 {
+		t.Errorf("empty spec = %v, %v; want no gateways", gateways, err)
+	}
+	for _, spec := range []string{"=0.5", "primary,primary", "primary=1.5", "primary=-0.1", "primary=often"} {
+		if _, err := paymentservice.ParseSimulatedGateways(spec, 0, 0); err == nil {
+			t.Errorf("ParseSimulatedGateways(%q) succeeded, want an error", spec)
+		}
+	}
+}
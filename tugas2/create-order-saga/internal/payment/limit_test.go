@@ -0,0 +1,68 @@
+package payment_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// TestProcessPaymentMaxAmount charges SamplePayment's 46.00 against limits
+// above, at and below it: only an amount over the limit is held for review,
+// and a held payment is never charged.
+func TestProcessPaymentMaxAmount(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limit  string
+		want   paymentpb.PaymentStatus
+		charge bool
+	}{
+		{"below", "46.01", paymentpb.PaymentStatus_SUCCESS, true},
+		{"at", "46.00", paymentpb.PaymentStatus_SUCCESS, true},
+		{"above", "45.99", paymentpb.PaymentStatus_PENDING_REVIEW, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := &recordingGateway{name: "card"}
+			s := newServer(
+				paymentservice.WithGateway(gateway),
+				paymentservice.WithMaxAmount(money.MustParse(money.DefaultCurrency, tc.limit)),
+			)
+			ctx := context.Background()
+			resp, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: sagatest.SamplePayment()})
+			if err != nil || resp.GetStatus() != tc.want {
+				t.Fatalf("ProcessPayment with a limit of %s = %v, %v; want %s", tc.limit, resp, err, tc.want)
+			}
+			if charged := len(gateway.charged) > 0; charged != tc.charge {
+				t.Errorf("gateway charged = %v, want %v", charged, tc.charge)
+			}
+			if tc.charge {
+				return
+			}
+			if !strings.Contains(resp.GetMessage(), "manual review") {
+				t.Errorf("message = %q, want it to mention manual review", resp.GetMessage())
+			}
+			refund, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentId: resp.GetPaymentId()})
+			if err != nil || !refund.GetSuccess() || refund.GetCode() != commonpb.CompensationCode_ALREADY_DONE {
+				t.Errorf("RefundPayment of a held payment = %v, %v; want an ALREADY_DONE no-op", refund, err)
+			}
+		})
+	}
+}
+
+// TestValidatePaymentMaxAmount checks ValidatePayment reports an amount over
+// the limit, and only that.
+func TestValidatePaymentMaxAmount(t *testing.T) {
+	s := newServer(paymentservice.WithMaxAmount(money.MustParse(money.DefaultCurrency, "45.99")))
+	resp, err := s.ValidatePayment(context.Background(), &paymentpb.ValidatePaymentRequest{PaymentInfo: sagatest.SamplePayment()})
+	if err != nil {
+		t.Fatalf("ValidatePayment: %v", err)
+	}
+	if resp.GetValid() || len(resp.GetViolations()) != 1 || resp.GetViolations()[0].GetField() != "payment_info.amount" {
+		t.Errorf("ValidatePayment over the limit = %v, want one payment_info.amount violation", resp)
+	}
+}
@@ -0,0 +1,110 @@
+package payment_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// recordingGateway approves every charge and records the payment info of each.
+type recordingGateway struct {
+	name    string
+	mu      sync.Mutex
+	charged []*commonpb.PaymentInfo
+}
+
+func (g *recordingGateway) Charge(_ context.Context, orderID string, info *commonpb.PaymentInfo) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.charged = append(g.charged, info)
+	return g.name + "-" + orderID, nil
+}
+
+// walletPayment returns a PayPal wallet payment of SamplePayment's amount.
+func walletPayment() *commonpb.PaymentInfo {
+	return &commonpb.PaymentInfo{
+		MethodType: commonpb.PaymentMethodType_WALLET,
+		Wallet:     &commonpb.WalletDetails{Provider: "paypal", AccountId: "buyer@example.com"},
+		Amount:     sagatest.SamplePayment().GetAmount(),
+	}
+}
+
+// TestProcessPaymentMethods charges a card and a wallet through the same
+// ProcessPayment RPC and checks each is validated by its own rules, charged
+// through its own gateway, and recorded with its method.
+func TestProcessPaymentMethods(t *testing.T) {
+	cards, wallets := &recordingGateway{name: "card"}, &recordingGateway{name: "wallet"}
+	s := newServer(
+		paymentservice.WithGateway(cards),
+		paymentservice.WithMethodGateway(commonpb.PaymentMethodType_WALLET, wallets),
+	)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		orderID     string
+		info        *commonpb.PaymentInfo
+		wantMethod  commonpb.PaymentMethodType
+		wantDesc    string
+		wantGateway string
+		wantTxn     string
+	}{
+		{"order-card", sagatest.SamplePayment(), commonpb.PaymentMethodType_CARD, "card ****4242", paymentservice.DefaultGatewayName, "card-order-card"},
+		{"order-wallet", walletPayment(), commonpb.PaymentMethodType_WALLET, "wallet paypal", "wallet", "wallet-order-wallet"},
+	} {
+		resp, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: tc.orderID}, PaymentInfo: tc.info})
+		if err != nil || resp.GetStatus() != paymentpb.PaymentStatus_SUCCESS {
+			t.Fatalf("ProcessPayment %s = %v, %v; want SUCCESS", tc.orderID, resp, err)
+		}
+		payment, _ := s.Lookup(ctx, resp.GetPaymentId())
+		if payment.GetMethodType() != tc.wantMethod || payment.GetPaymentMethod() != tc.wantDesc ||
+			payment.GetGateway() != tc.wantGateway || payment.GetTransactionId() != tc.wantTxn {
+			t.Errorf("%s recorded as %v %q via %q (transaction %q), want %v %q via %q (transaction %q)", tc.orderID,
+				payment.GetMethodType(), payment.GetPaymentMethod(), payment.GetGateway(), payment.GetTransactionId(),
+				tc.wantMethod, tc.wantDesc, tc.wantGateway, tc.wantTxn)
+		}
+	}
+	if len(cards.charged) != 1 || cards.charged[0].GetCardNumber() == "" {
+		t.Errorf("card gateway charged %v, want the card payment only", cards.charged)
+	}
+	if len(wallets.charged) != 1 || wallets.charged[0].GetWallet().GetAccountId() != "buyer@example.com" {
+		t.Errorf("wallet gateway charged %v, want the wallet payment only", wallets.charged)
+	}
+}
+
+// TestProcessPaymentMethodValidation checks each method is held to its own
+// fields: a wallet needs no card but does need an account, and a card
+// payment still needs a valid card. Invalid details fail the payment without
+// charging it.
+func TestProcessPaymentMethodValidation(t *testing.T) {
+	gateway := &recordingGateway{name: "any"}
+	s := newServer(paymentservice.WithGateway(gateway))
+	noAccount := walletPayment()
+	noAccount.Wallet.AccountId = " "
+	badCard := sagatest.SamplePayment()
+	badCard.CardNumber = "4242-4242-4242-4241"
+	unknown := walletPayment()
+	unknown.MethodType = commonpb.PaymentMethodType(99)
+
+	for _, tc := range []struct {
+		name, field string
+		info        *commonpb.PaymentInfo
+	}{
+		{"wallet without account", "wallet account ID", noAccount},
+		{"card failing Luhn", "card number", badCard},
+		{"unknown method", "not supported", unknown},
+	} {
+		resp, err := s.ProcessPayment(context.Background(), &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: tc.info})
+		if err != nil || resp.GetStatus() != paymentpb.PaymentStatus_FAILED || !strings.Contains(resp.GetMessage(), tc.field) {
+			t.Errorf("%s: ProcessPayment = %v, %v; want FAILED over the %s", tc.name, resp, err, tc.field)
+		}
+	}
+	if len(gateway.charged) != 0 {
+		t.Errorf("gateway charged %d invalid payments", len(gateway.charged))
+	}
+}
@@ -0,0 +1,147 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// GetReceipt returns the receipt of a payment in the caller's tenant. Only
+// charged payments have one: a payment that failed or is held for review is
+// refused with codes.FailedPrecondition. A refunded payment's receipt ends
+// with the refund as a negative line.
+func (s *Server) GetReceipt(ctx context.Context, req *paymentpb.GetReceiptRequest) (*paymentpb.Receipt, error) {
+	paymentID := req.GetPaymentId()
+	log.Printf("Received GetReceipt request for payment ID: %s", paymentID)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("GetReceipt aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if paymentID == "" {
+		return nil, status.Error(codes.InvalidArgument, "payment ID is required")
+	}
+	payment, ok := s.Lookup(ctx, paymentID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "payment %s not found", paymentID)
+	}
+	switch payment.Status {
+	case paymentpb.PaymentStatus_SUCCESS, paymentpb.PaymentStatus_PARTIALLY_REFUNDED, paymentpb.PaymentStatus_REFUNDED:
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "payment %s is %s, it was never charged", paymentID, payment.Status)
+	}
+	return receiptFor(payment, s.PaymentRefunds(ctx, paymentID)), nil
+}
+
+// receiptFor builds the receipt of a charged payment. The items it was paid
+// for are listed first; whatever the charge covers beyond them (shipping,
+// tax) follows as one line, then one line per refund.
+func receiptFor(payment *paymentpb.Payment, refunds []*paymentpb.Refund) *paymentpb.Receipt {
+	receipt := &paymentpb.Receipt{
+		PaymentId:     payment.Id,
+		OrderId:       payment.OrderId,
+		TransactionId: payment.TransactionId,
+		PaymentMethod: payment.PaymentMethod,
+		Status:        payment.Status,
+		Charged:       payment.Amount,
+		Total:         payment.Amount,
+		ChargedAt:     payment.CreatedAt,
+	}
+	if len(payment.Items) == 0 {
+		receipt.Lines = append(receipt.Lines, &paymentpb.ReceiptLine{Description: "Order " + payment.GetOrderId().GetId(), Amount: payment.Amount})
+	}
+	for _, item := range payment.Items {
+		description := item.GetName()
+		if description == "" {
+			description = item.GetProductId()
+		}
+		receipt.Lines = append(receipt.Lines, &paymentpb.ReceiptLine{
+			Description: description,
+			Quantity:    item.GetQuantity(),
+			UnitPrice:   item.GetPrice(),
+			Amount:      money.Multiply(item.GetPrice(), int64(item.GetQuantity())),
+		})
+	}
+	if len(payment.Items) > 0 {
+		if subtotal, err := money.ItemsTotal(payment.Items); err != nil {
+			log.Printf("WARNING: Totalling the items of payment %s for its receipt: %v", payment.Id, err)
+		} else if cmp, err := money.Compare(payment.Amount, subtotal); err == nil && cmp > 0 {
+			rest, _ := money.Add(payment.Amount, money.Multiply(subtotal, -1))
+			receipt.Lines = append(receipt.Lines, &paymentpb.ReceiptLine{Description: "Shipping, tax and other charges", Amount: rest})
+		}
+	}
+	for _, refund := range refunds {
+		description := "Refund"
+		if refund.Reason != "" {
+			description += " (" + refund.Reason + ")"
+		}
+		receipt.Lines = append(receipt.Lines, &paymentpb.ReceiptLine{Description: description, Amount: money.Multiply(refund.Amount, -1)})
+	}
+	if refunded := payment.GetRefundedAmount(); refunded != nil {
+		if total, err := money.Add(payment.Amount, money.Multiply(refunded, -1)); err == nil {
+			receipt.Total = total
+		}
+		receipt.RefundedAt = payment.RefundedAt
+	}
+	receipt.Text = renderReceipt(receipt)
+	return receipt
+}
+
+// renderReceipt lays a receipt out as plain text, one line per receipt line
+// with the amounts right-aligned.
+func renderReceipt(r *paymentpb.Receipt) string {
+	const width = 40 // Of the description column
+	var b strings.Builder
+	fmt.Fprintf(&b, "Receipt for payment %s\n", r.PaymentId)
+	fmt.Fprintf(&b, "Order:       %s\n", r.GetOrderId().GetId())
+	if r.TransactionId != "" {
+		fmt.Fprintf(&b, "Transaction: %s\n", r.TransactionId)
+	}
+	fmt.Fprintf(&b, "Method:      %s\n", r.PaymentMethod)
+	fmt.Fprintf(&b, "Charged at:  %s\n", r.GetChargedAt().AsTime().Format(time.RFC3339))
+	if r.RefundedAt != nil {
+		fmt.Fprintf(&b, "Refunded at: %s\n", r.RefundedAt.AsTime().Format(time.RFC3339))
+	}
+	b.WriteString("\n")
+	for _, line := range r.Lines {
+		description := line.Description
+		if line.Quantity > 0 {
+			description = fmt.Sprintf("%d x %s @ %s", line.Quantity, line.Description, money.Format(line.UnitPrice))
+		}
+		fmt.Fprintf(&b, "%-*s %16s\n", width, description, money.Format(line.Amount))
+	}
+	fmt.Fprintf(&b, "%-*s %16s\n", width, "Total", money.Format(r.Total))
+	return b.String()
+}
+
+// describeMethod names how a payment is made without revealing the account,
+// e.g. "card ****4242", "wallet paypal" or "bank transfer ****3000".
+func describeMethod(info *commonpb.PaymentInfo) string {
+	switch paymentMethod(info) {
+	case commonpb.PaymentMethodType_WALLET:
+		return "wallet " + info.GetWallet().GetProvider()
+	case commonpb.PaymentMethodType_BANK_TRANSFER:
+		return "bank transfer " + lastFour(info.GetBankTransfer().GetIban())
+	default:
+		return "card " + lastFour(info.GetCardNumber())
+	}
+}
+
+// lastFour masks all but the last four characters of an account number.
+func lastFour(number string) string {
+	if len(number) <= 4 {
+		return "****"
+	}
+	return "****" + number[len(number)-4:]
+}
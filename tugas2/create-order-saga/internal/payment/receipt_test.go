@@ -0,0 +1,171 @@
+package payment_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// receiptLine is the part of a receipt line the tests compare.
+type receiptLine struct {
+	description string
+	quantity    int32
+	amount      string
+}
+
+// receiptLines flattens r's lines for comparison.
+func receiptLines(r *paymentpb.Receipt) []receiptLine {
+	var lines []receiptLine
+	for _, line := range r.GetLines() {
+		lines = append(lines, receiptLine{line.GetDescription(), line.GetQuantity(), money.Format(line.GetAmount())})
+	}
+	return lines
+}
+
+// chargeItems takes SamplePayment (46.00) for orderID as the payment for
+// 41.00 of items, leaving 5.00 of other charges, and returns the payment ID.
+func chargeItems(t *testing.T, s *paymentservice.Server, ctx context.Context, orderID string) string {
+	t.Helper()
+	resp, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{
+		OrderId:     &commonpb.OrderID{Id: orderID},
+		PaymentInfo: sagatest.SamplePayment(),
+		Items: []*commonpb.Item{
+			{ProductId: "prod-A", Name: "Widget", Quantity: 2, Price: money.MustParse(money.DefaultCurrency, "10.50")},
+			{ProductId: "prod-B", Quantity: 1, Price: money.MustParse(money.DefaultCurrency, "20.00")},
+		},
+	})
+	if err != nil || resp.GetStatus() != paymentpb.PaymentStatus_SUCCESS {
+		t.Fatalf("ProcessPayment %s = %v, %v", orderID, resp, err)
+	}
+	return resp.GetPaymentId()
+}
+
+// TestGetReceipt checks the receipt of a charged payment lists its items,
+// then the rest of the charge, and that each refund after it is a negative
+// line taken off the total.
+func TestGetReceipt(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	paymentID := chargeItems(t, s, ctx, "order-1")
+	items := []receiptLine{
+		{"Widget", 2, "21.00 USD"},
+		{"prod-B", 1, "20.00 USD"},
+		{"Shipping, tax and other charges", 0, "5.00 USD"},
+	}
+
+	receipt, err := s.GetReceipt(ctx, &paymentpb.GetReceiptRequest{PaymentId: paymentID})
+	if err != nil {
+		t.Fatalf("GetReceipt: %v", err)
+	}
+	if got := receiptLines(receipt); !slices.Equal(got, items) {
+		t.Errorf("lines = %v, want %v", got, items)
+	}
+	if receipt.GetPaymentMethod() != "card ****4242" || strings.Contains(receipt.GetText(), "4242-4242") {
+		t.Errorf("payment method %q, text:\n%s\nwant only the last four digits of the card", receipt.GetPaymentMethod(), receipt.GetText())
+	}
+	if got := money.Format(receipt.GetTotal()); got != "46.00 USD" || receipt.GetStatus() != paymentpb.PaymentStatus_SUCCESS || receipt.GetRefundedAt() != nil {
+		t.Errorf("total %s, status %s, refunded at %v; want 46.00 USD, SUCCESS and never refunded", got, receipt.GetStatus(), receipt.GetRefundedAt())
+	}
+	for _, want := range []string{"Receipt for payment " + paymentID, "Order:       order-1", "2 x Widget @ 10.50 USD", "Total"} {
+		if !strings.Contains(receipt.GetText(), want) {
+			t.Errorf("text is missing %q:\n%s", want, receipt.GetText())
+		}
+	}
+
+	for _, step := range []struct {
+		amount    *commonpb.Money // Nil refunds the rest
+		reason    string
+		line      receiptLine
+		status    paymentpb.PaymentStatus
+		wantTotal string
+	}{
+		{money.MustParse(money.DefaultCurrency, "6.00"), "damaged", receiptLine{"Refund (damaged)", 0, "-6.00 USD"}, paymentpb.PaymentStatus_PARTIALLY_REFUNDED, "40.00 USD"},
+		{nil, "", receiptLine{"Refund", 0, "-40.00 USD"}, paymentpb.PaymentStatus_REFUNDED, "0.00 USD"},
+	} {
+		if resp, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{
+			OrderId:   &commonpb.OrderID{Id: "order-1"},
+			PaymentId: paymentID,
+			Reason:    step.reason,
+			Amount:    step.amount,
+		}); err != nil || !resp.GetRefunded() {
+			t.Fatalf("RefundPayment %s = %v, %v", money.Format(step.amount), resp, err)
+		}
+		items = append(items, step.line)
+		receipt, err := s.GetReceipt(ctx, &paymentpb.GetReceiptRequest{PaymentId: paymentID})
+		if err != nil {
+			t.Fatalf("GetReceipt after refunding %s: %v", step.line.amount, err)
+		}
+		if got := receiptLines(receipt); !slices.Equal(got, items) {
+			t.Errorf("lines = %v, want %v", got, items)
+		}
+		if got := money.Format(receipt.GetTotal()); got != step.wantTotal || receipt.GetStatus() != step.status || receipt.GetRefundedAt() == nil {
+			t.Errorf("total %s, status %s, refunded at %v; want %s, %s and a refund time", got, receipt.GetStatus(), receipt.GetRefundedAt(), step.wantTotal, step.status)
+		}
+		if got := money.Format(receipt.GetCharged()); got != "46.00 USD" {
+			t.Errorf("charged %s, want 46.00 USD whatever is refunded", got)
+		}
+		if !strings.Contains(receipt.GetText(), step.line.description) || !strings.Contains(receipt.GetText(), "Refunded at:") {
+			t.Errorf("text is missing the refund %q:\n%s", step.line.description, receipt.GetText())
+		}
+	}
+}
+
+// TestGetReceiptWithoutItems checks a payment charged without its items has
+// a single line for the whole order.
+func TestGetReceiptWithoutItems(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	paymentID := charge(t, s, ctx, "order-1")
+	receipt, err := s.GetReceipt(ctx, &paymentpb.GetReceiptRequest{PaymentId: paymentID})
+	if err != nil {
+		t.Fatalf("GetReceipt: %v", err)
+	}
+	if got, want := receiptLines(receipt), []receiptLine{{"Order order-1", 0, "46.00 USD"}}; !slices.Equal(got, want) {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+}
+
+// TestGetReceiptCodes checks which payments have no receipt.
+func TestGetReceiptCodes(t *testing.T) {
+	s := newServer(paymentservice.WithGateway(paymentservice.GatewayFunc(func(_ context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+		if orderID == "declined" {
+			return "", paymentservice.ErrDeclined
+		}
+		return "txn-" + orderID, nil
+	})))
+	ctx := context.Background()
+	declined, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{
+		OrderId:     &commonpb.OrderID{Id: "declined"},
+		PaymentInfo: sagatest.SamplePayment(),
+	})
+	if err != nil || declined.GetStatus() != paymentpb.PaymentStatus_FAILED {
+		t.Fatalf("declined ProcessPayment = %v, %v; want a FAILED payment", declined, err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		paymentID string
+		want      codes.Code
+	}{
+		{"missing ID", "", codes.InvalidArgument},
+		{"unknown payment", "no-such-payment", codes.NotFound},
+		{"failed payment", declined.GetPaymentId(), codes.FailedPrecondition},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.GetReceipt(ctx, &paymentpb.GetReceiptRequest{PaymentId: tc.paymentID})
+			if got := status.Code(err); got != tc.want {
+				t.Errorf("GetReceipt(%q) = %v, want %s", tc.paymentID, err, tc.want)
+			}
+		})
+	}
+}
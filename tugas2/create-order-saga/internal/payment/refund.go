@@ -0,0 +1,227 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// ListRefunds page sizes.
+const (
+	DefaultRefundPageSize = 50
+	MaxRefundPageSize     = 500
+)
+
+// storedRefund is a refund in the order it was recorded, across tenants.
+type storedRefund struct {
+	seq    int64 // 1-based position in s.refundLog; page tokens resume after it
+	tenant string
+	refund *paymentpb.Refund
+}
+
+// statusAfterRefunds derives the status of a charged payment from how much
+// of it has been refunded in total.
+func statusAfterRefunds(charged, refunded *commonpb.Money) paymentpb.PaymentStatus {
+	switch cmp, err := money.Compare(refunded, charged); {
+	case isZero(refunded):
+		return paymentpb.PaymentStatus_SUCCESS
+	case err == nil && cmp >= 0:
+		return paymentpb.PaymentStatus_REFUNDED
+	default:
+		return paymentpb.PaymentStatus_PARTIALLY_REFUNDED
+	}
+}
+
+// isZero reports whether m is unset or zero.
+func isZero(m *commonpb.Money) bool {
+	return m.GetUnits() == 0 && m.GetNanos() == 0
+}
+
+// refundAmountLocked works out how much to refund of payment: requested, or
+// all that is left of it if nil. A requested amount must be positive, in the
+// payment's currency and no more than is left. Caller holds s.mu.
+func refundAmountLocked(payment *paymentpb.Payment, requested *commonpb.Money) (*commonpb.Money, error) {
+	charged := payment.GetAmount()
+	refunded := payment.GetRefundedAmount()
+	if refunded == nil {
+		refunded = money.New(charged.GetCurrencyCode(), 0, 0)
+	}
+	left, err := money.Add(charged, money.Multiply(refunded, -1))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "payment %s: %v", payment.Id, err)
+	}
+	if requested == nil {
+		return left, nil
+	}
+	if err := money.Validate(requested); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "refund amount: %v", err)
+	}
+	if requested.CurrencyCode != charged.GetCurrencyCode() {
+		return nil, status.Errorf(codes.InvalidArgument, "refund amount %s is not in the payment's currency %s", money.Format(requested), charged.GetCurrencyCode())
+	}
+	if money.IsNegative(requested) || isZero(requested) {
+		return nil, status.Errorf(codes.InvalidArgument, "refund amount %s must be positive", money.Format(requested))
+	}
+	if cmp, _ := money.Compare(requested, left); cmp > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "refund of %s exceeds the %s left to refund of payment %s", money.Format(requested), money.Format(left), payment.Id)
+	}
+	return requested, nil
+}
+
+// claimRefund returns a copy of the successful response to the RefundPayment
+// request stored under requestKey, or, if there is none, marks the request in
+// flight: the caller must then handle it and close and delete its
+// refundsInFlight entry. A request already in flight is waited for first, so
+// concurrent duplicates never both refund.
+func (s *Server) claimRefund(ctx context.Context, requestKey paymentKey) (*commonpb.CompensationResponse, error) {
+	for {
+		s.mu.Lock()
+		if original, ok := s.refunds[requestKey]; ok {
+			s.mu.Unlock()
+			return proto.Clone(original).(*commonpb.CompensationResponse), nil
+		}
+		done, busy := s.refundsInFlight[requestKey]
+		if !busy {
+			s.refundsInFlight[requestKey] = make(chan struct{})
+			s.mu.Unlock()
+			return nil, nil
+		}
+		s.mu.Unlock()
+		log.Printf("RefundPayment request %s is being handled, waiting for it", requestKey.id)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// recordRefundLocked records a refund of amount of payment for req and
+// brings the payment's refunded amount and status up to date. Caller holds
+// s.mu for writing.
+func (s *Server) recordRefundLocked(ctx context.Context, payment *paymentpb.Payment, amount *commonpb.Money, req *paymentpb.RefundPaymentRequest) *paymentpb.Refund {
+	key := keyFor(ctx, payment.Id)
+	now := timestamppb.New(s.clock.Now())
+	refund := &paymentpb.Refund{
+		Id:          s.ids.NewID("rfd", fmt.Sprintf("%s-%d", payment.Id, len(s.paymentRefunds[key])+1)),
+		PaymentId:   payment.Id,
+		OrderId:     payment.OrderId,
+		Amount:      amount,
+		Reason:      req.GetReason(),
+		Cause:       req.GetCause(),
+		CreatedAt:   now,
+		InitiatedBy: interceptors.ActorFromContext(ctx),
+	}
+	s.paymentRefunds[key] = append(s.paymentRefunds[key], refund)
+	s.refundLog = append(s.refundLog, storedRefund{seq: int64(len(s.refundLog)) + 1, tenant: key.tenant, refund: refund})
+
+	refunded := amount
+	if payment.RefundedAmount != nil {
+		refunded, _ = money.Add(payment.RefundedAmount, amount) // Same currency, checked by refundAmountLocked
+	}
+	payment.RefundedAmount = refunded
+	payment.Status = statusAfterRefunds(payment.Amount, refunded)
+	payment.UpdatedAt = now
+	payment.RefundedAt = now
+	payment.RefundReason = req.GetReason()
+	payment.RefundCause = req.GetCause()
+	return refund
+}
+
+// PaymentRefunds returns copies of the refunds of a payment in the caller's
+// tenant, oldest first, for in-process inspection.
+func (s *Server) PaymentRefunds(ctx context.Context, paymentID string) []*paymentpb.Refund {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var refunds []*paymentpb.Refund
+	for _, refund := range s.paymentRefunds[keyFor(ctx, paymentID)] {
+		refunds = append(refunds, proto.Clone(refund).(*paymentpb.Refund))
+	}
+	return refunds
+}
+
+// ListRefunds returns the refunds in the caller's tenant matching the
+// request's filters, oldest first, a page at a time.
+func (s *Server) ListRefunds(ctx context.Context, req *paymentpb.ListRefundsRequest) (*paymentpb.ListRefundsResponse, error) {
+	log.Printf("Received ListRefunds request for order ID: %q, payment ID: %q", req.GetOrderId().GetId(), req.GetPaymentId())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ListRefunds aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "page size %d must not be negative", pageSize)
+	case pageSize == 0:
+		pageSize = DefaultRefundPageSize
+	case pageSize > MaxRefundPageSize:
+		pageSize = MaxRefundPageSize
+	}
+	var after int64
+	if token := req.GetPageToken(); token != "" {
+		var err error
+		if after, err = strconv.ParseInt(token, 10, 64); err != nil || after < 0 { // The seq of the last refund sent
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page token %q", token)
+		}
+	}
+	from, err := optionalTime("created_after", req.GetCreatedAfter())
+	if err != nil {
+		return nil, err
+	}
+	until, err := optionalTime("created_before", req.GetCreatedBefore())
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := interceptors.TenantFromContext(ctx)
+	orderID, paymentID := req.GetOrderId().GetId(), req.GetPaymentId()
+	resp := &paymentpb.ListRefundsResponse{}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, stored := range s.refundLog[min(after, int64(len(s.refundLog))):] {
+		refund := stored.refund
+		created := refund.GetCreatedAt().AsTime()
+		if stored.tenant != tenant ||
+			(orderID != "" && refund.GetOrderId().GetId() != orderID) ||
+			(paymentID != "" && refund.PaymentId != paymentID) ||
+			(!from.IsZero() && created.Before(from)) ||
+			(!until.IsZero() && !created.Before(until)) {
+			continue
+		}
+		if len(resp.Refunds) == pageSize {
+			// Another refund matches, so there is a next page
+			resp.NextPageToken = strconv.FormatInt(after, 10)
+			break
+		}
+		resp.Refunds = append(resp.Refunds, proto.Clone(refund).(*paymentpb.Refund))
+		after = stored.seq
+	}
+	return resp, nil
+}
+
+// optionalTime converts the timestamp of the request field name, which may be
+// unset (the zero time).
+func optionalTime(name string, ts *timestamppb.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, status.Errorf(codes.InvalidArgument, "%s: %v", name, err)
+	}
+	return ts.AsTime(), nil
+}
@@ -0,0 +1,218 @@
+package payment_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+func TestRefundPaymentRepeatedRequestRefundsOnce(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	paymentID := charge(t, s, ctx, "order-1")
+	req := &paymentpb.RefundPaymentRequest{
+		OrderId:   &commonpb.OrderID{Id: "order-1"},
+		PaymentId: paymentID,
+		RequestId: "refund-1",
+		Amount:    money.MustParse(money.DefaultCurrency, "10.00"),
+	}
+
+	first, err := s.RefundPayment(ctx, req)
+	if err != nil || !first.GetSuccess() || !first.GetRefunded() {
+		t.Fatalf("first RefundPayment = %v, %v", first, err)
+	}
+	second, err := s.RefundPayment(ctx, req)
+	if err != nil {
+		t.Fatalf("second RefundPayment: %v", err)
+	}
+	if second.GetMessage() != first.GetMessage() || !second.GetCompensatedAt().AsTime().Equal(first.GetCompensatedAt().AsTime()) {
+		t.Errorf("second RefundPayment = %v, want the original response %v", second, first)
+	}
+	if got := len(s.PaymentRefunds(ctx, paymentID)); got != 1 {
+		t.Errorf("%d refunds recorded, want 1", got)
+	}
+	payment, _ := s.Lookup(ctx, paymentID)
+	if got := money.Format(payment.GetRefundedAmount()); got != "10.00 USD" {
+		t.Errorf("refunded amount = %s, want 10.00 USD", got)
+	}
+}
+
+// TestRefundPaymentConcurrentDuplicatesRefundOnce sends one partial refund
+// request from many goroutines at once: duplicates arriving while it is
+// handled wait for it instead of refunding again.
+func TestRefundPaymentConcurrentDuplicatesRefundOnce(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	paymentID := charge(t, s, ctx, "order-1")
+
+	const n = 50
+	responses := make([]*commonpb.CompensationResponse, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{
+				OrderId:   &commonpb.OrderID{Id: "order-1"},
+				PaymentId: paymentID,
+				RequestId: "refund-1",
+				Amount:    money.MustParse(money.DefaultCurrency, "5.00"),
+			})
+			if err != nil {
+				t.Errorf("RefundPayment: %v", err)
+			}
+			responses[i] = resp
+		}()
+	}
+	wg.Wait()
+	if got := len(s.PaymentRefunds(ctx, paymentID)); got != 1 {
+		t.Fatalf("%d refunds recorded, want 1", got)
+	}
+	payment, _ := s.Lookup(ctx, paymentID)
+	if payment.GetStatus() != paymentpb.PaymentStatus_PARTIALLY_REFUNDED {
+		t.Errorf("payment is %s, want PARTIALLY_REFUNDED", payment.GetStatus())
+	}
+	for _, resp := range responses {
+		if !resp.GetRefunded() || resp.GetAlreadyApplied() {
+			t.Errorf("duplicate got %v, want the original response", resp)
+		}
+	}
+}
+
+func TestRefundPaymentFailedRequestIsNotRemembered(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	paymentID := charge(t, s, ctx, "order-1")
+	req := &paymentpb.RefundPaymentRequest{
+		OrderId:   &commonpb.OrderID{Id: "order-1"},
+		PaymentId: paymentID,
+		RequestId: "refund-1",
+		Amount:    money.MustParse(money.DefaultCurrency, "1000.00"), // More than was charged
+	}
+	if _, err := s.RefundPayment(ctx, req); err == nil {
+		t.Fatal("RefundPayment of more than was charged succeeded")
+	}
+	req.Amount = nil
+	resp, err := s.RefundPayment(ctx, req)
+	if err != nil || !resp.GetRefunded() {
+		t.Fatalf("retried RefundPayment = %v, %v; want a full refund", resp, err)
+	}
+}
+
+// partialRefund refunds 1.00 of paymentID and returns the refund's ID.
+func partialRefund(t *testing.T, s *paymentservice.Server, ctx context.Context, orderID, paymentID string) string {
+	t.Helper()
+	resp, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{
+		OrderId:   &commonpb.OrderID{Id: orderID},
+		PaymentId: paymentID,
+		Amount:    money.MustParse(money.DefaultCurrency, "1.00"),
+	})
+	if err != nil || !resp.GetRefunded() {
+		t.Fatalf("RefundPayment %s = %v, %v", paymentID, resp, err)
+	}
+	refunds := s.PaymentRefunds(ctx, paymentID)
+	return refunds[len(refunds)-1].GetId()
+}
+
+// TestListRefunds follows each request's page tokens to the end and checks
+// the pages hold the refunds matching its filters, oldest first.
+func TestListRefunds(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(hours int) *timestamppb.Timestamp {
+		return timestamppb.New(start.Add(time.Duration(hours) * time.Hour))
+	}
+	fake := clock.NewFake(start)
+	s := newServer(paymentservice.WithClock(fake))
+	tenantA := interceptors.WithTenant(context.Background(), "tenant-a")
+	tenantB := interceptors.WithTenant(context.Background(), "tenant-b")
+	pay1, pay2 := charge(t, s, tenantA, "order-1"), charge(t, s, tenantA, "order-2")
+	payB := charge(t, s, tenantB, "order-1")
+	if t.Failed() {
+		return
+	}
+
+	// Tenant A's refunds a1..a4 are an hour apart; tenant B's is made between a2 and a3.
+	a1 := partialRefund(t, s, tenantA, "order-1", pay1)
+	fake.Advance(time.Hour)
+	a2 := partialRefund(t, s, tenantA, "order-2", pay2)
+	b1 := partialRefund(t, s, tenantB, "order-1", payB)
+	fake.Advance(time.Hour)
+	a3 := partialRefund(t, s, tenantA, "order-1", pay1)
+	fake.Advance(time.Hour)
+	a4 := partialRefund(t, s, tenantA, "order-2", pay2)
+
+	for _, tc := range []struct {
+		name      string
+		ctx       context.Context
+		req       *paymentpb.ListRefundsRequest // PageToken is filled in from page to page
+		wantPages [][]string
+	}{
+		{"every refund", tenantA, &paymentpb.ListRefundsRequest{}, [][]string{{a1, a2, a3, a4}}},
+		{"other tenant", tenantB, &paymentpb.ListRefundsRequest{}, [][]string{{b1}}},
+		{"tenant without refunds", interceptors.WithTenant(context.Background(), "tenant-c"), &paymentpb.ListRefundsRequest{}, [][]string{nil}},
+		{"by order", tenantA, &paymentpb.ListRefundsRequest{OrderId: &commonpb.OrderID{Id: "order-1"}}, [][]string{{a1, a3}}},
+		{"by payment", tenantA, &paymentpb.ListRefundsRequest{PaymentId: pay2}, [][]string{{a2, a4}}},
+		{"created after, inclusive", tenantA, &paymentpb.ListRefundsRequest{CreatedAfter: at(1)}, [][]string{{a2, a3, a4}}},
+		{"created before, exclusive", tenantA, &paymentpb.ListRefundsRequest{CreatedBefore: at(2)}, [][]string{{a1, a2}}},
+		{"between bounds", tenantA, &paymentpb.ListRefundsRequest{CreatedAfter: at(1), CreatedBefore: at(3)}, [][]string{{a2, a3}}},
+		{"after the last refund", tenantA, &paymentpb.ListRefundsRequest{CreatedAfter: at(4)}, [][]string{nil}},
+		{"pages of two", tenantA, &paymentpb.ListRefundsRequest{PageSize: 2}, [][]string{{a1, a2}, {a3, a4}}},
+		{"pages of three", tenantA, &paymentpb.ListRefundsRequest{PageSize: 3}, [][]string{{a1, a2, a3}, {a4}}},
+		{"pages skip other tenants", tenantB, &paymentpb.ListRefundsRequest{PageSize: 1}, [][]string{{b1}}},
+		{"filtered pages", tenantA, &paymentpb.ListRefundsRequest{PageSize: 1, OrderId: &commonpb.OrderID{Id: "order-1"}, CreatedAfter: at(1)}, [][]string{{a3}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var pages [][]string
+			for {
+				resp, err := s.ListRefunds(tc.ctx, tc.req)
+				if err != nil {
+					t.Fatalf("ListRefunds page %d: %v", len(pages)+1, err)
+				}
+				var page []string
+				for _, refund := range resp.GetRefunds() {
+					page = append(page, refund.GetId())
+				}
+				pages = append(pages, page)
+				if tc.req.PageToken = resp.GetNextPageToken(); tc.req.PageToken == "" || len(pages) > len(tc.wantPages) {
+					break
+				}
+			}
+			if !slices.EqualFunc(pages, tc.wantPages, slices.Equal) {
+				t.Errorf("pages = %v, want %v", pages, tc.wantPages)
+			}
+		})
+	}
+}
+
+func TestListRefundsInvalidRequests(t *testing.T) {
+	s := newServer()
+	for _, tc := range []struct {
+		name string
+		req  *paymentpb.ListRefundsRequest
+	}{
+		{"negative page size", &paymentpb.ListRefundsRequest{PageSize: -1}},
+		{"malformed page token", &paymentpb.ListRefundsRequest{PageToken: "page-2"}},
+		{"negative page token", &paymentpb.ListRefundsRequest{PageToken: "-1"}},
+		{"invalid created_after", &paymentpb.ListRefundsRequest{CreatedAfter: &timestamppb.Timestamp{Nanos: -1}}},
+		{"invalid created_before", &paymentpb.ListRefundsRequest{CreatedBefore: &timestamppb.Timestamp{Seconds: -1 << 62}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := s.ListRefunds(context.Background(), tc.req); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("ListRefunds returned %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
@@ -2,133 +2,535 @@ package payment
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"math/rand" // For simulating success/failure
+	"time"
 
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
 	commonpb "create-order-saga/proto/common"
 	paymentpb "create-order-saga/proto/payment"
 	"sync"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// paymentKey partitions stored payments by tenant so IDs never collide across tenants.
+type paymentKey struct {
+	tenant string
+	id     string
+}
+
+// keyFor builds the store key for a payment ID using the caller's tenant.
+func keyFor(ctx context.Context, paymentID string) paymentKey {
+	return paymentKey{tenant: interceptors.TenantFromContext(ctx), id: paymentID}
+}
+
 // Server implements the PaymentServiceServer interface.
 type Server struct {
 	paymentpb.UnimplementedPaymentServiceServer // Embed for forward compatibility
-	payments                                    map[string]*paymentpb.Payment
+	payments                                    map[paymentKey]*paymentpb.Payment
+	byOrder                                     map[paymentKey][]string                       // Payment IDs of each order, keyed by tenant and order ID
+	refunds                                     map[paymentKey]*commonpb.CompensationResponse // Successful RefundPayment responses by request ID
+	refundsInFlight                             map[paymentKey]chan struct{}                  // RefundPayment request IDs being handled; closed when done
+	paymentRefunds                              map[paymentKey][]*paymentpb.Refund            // Refunds of each payment, oldest first
+	refundLog                                   []storedRefund                                // Every refund, oldest first (see ListRefunds)
+	recentCharges                               map[paymentKey]recentCharge                   // Last charge of each payment fingerprint, keyed by tenant and fingerprint
+	duplicateWindow                             time.Duration                                 // Charges repeated within this are suspected duplicates; 0 disables the check
+	strictDuplicates                            bool                                          // Suspected duplicates are FAILED rather than DUPLICATE_SUSPECTED
 	mu                                          sync.RWMutex
+	latency                                     simulation.Latency                     // Artificial delay applied to every RPC
+	maxAmount                                   *commonpb.Money                        // Payments above this are held for review; nil means no limit
+	currencies                                  []string                               // Currencies accepted; any if empty
+	failureRate                                 float64                                // Decline rate of the default simulated gateway
+	outageRate                                  float64                                // Outage rate of the default simulated gateway
+	gateways                                    []NamedGateway                         // Tried in order, see charge
+	gatewayFailover                             bool                                   // Try the next gateway when one is unavailable
+	methodGateways                              map[commonpb.PaymentMethodType]Gateway // Overrides gateway for some payment methods
+	clock                                       clock.Clock
+	ids                                         ids.Generator
+	failures                                    *simulation.FailureSimulator // Runtime-configurable latency, and failures injected into ProcessPayment
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithSimulatedLatency delays every RPC by a random duration in [min, max]
+// to exercise client timeouts and retries. Pass max <= min for a fixed delay.
+func WithSimulatedLatency(min, max time.Duration) Option {
+	return func(s *Server) {
+		s.latency = simulation.Latency{Min: min, Max: max}
+	}
+}
+
+// DefaultFailureRate is the probability that a valid payment is declined.
+const DefaultFailureRate = 0.3
+
+// WithFailureRate sets the probability in [0, 1] that an otherwise valid
+// payment is declined (DefaultFailureRate by default). It configures the
+// default simulated gateway and is ignored when WithGateway or WithGateways is used.
+func WithFailureRate(rate float64) Option {
+	return func(s *Server) {
+		s.failureRate = rate
+	}
+}
+
+// WithOutageRate sets the probability in [0, 1] that the default simulated
+// gateway is unavailable (0 by default). It is ignored when WithGateway or
+// WithGateways is used.
+func WithOutageRate(rate float64) Option {
+	return func(s *Server) {
+		s.outageRate = rate
+	}
+}
+
+// WithGateway charges payments through g instead of the simulated gateway,
+// except those of a method given its own gateway with WithMethodGateway.
+// Payments record it as DefaultGatewayName.
+func WithGateway(g Gateway) Option {
+	return func(s *Server) {
+		s.gateways = []NamedGateway{{Name: DefaultGatewayName, Gateway: g}}
+	}
+}
+
+// WithGateways charges payments through gateways instead of the simulated
+// gateway, trying them in order: when one is unavailable the next is tried
+// (see WithGatewayFailover). Methods given their own gateway with
+// WithMethodGateway do not use them.
+func WithGateways(gateways ...NamedGateway) Option {
+	return func(s *Server) {
+		s.gateways = gateways
+	}
+}
+
+// WithGatewayFailover sets whether a charge moves on to the next gateway
+// when one is unavailable (true by default). Without failover, only the
+// first gateway is used.
+func WithGatewayFailover(enabled bool) Option {
+	return func(s *Server) {
+		s.gatewayFailover = enabled
+	}
+}
+
+// WithMethodGateway charges payments made by method through g. Methods without
+// a gateway of their own use the one set by WithGateway, or the simulated one.
+// An unspecified method is a card, so it is configured as CARD.
+func WithMethodGateway(method commonpb.PaymentMethodType, g Gateway) Option {
+	return func(s *Server) {
+		if s.methodGateways == nil {
+			s.methodGateways = make(map[commonpb.PaymentMethodType]Gateway)
+		}
+		s.methodGateways[method] = g
+	}
+}
+
+// WithMaxAmount holds any payment whose amount exceeds max for manual review
+// instead of processing it. Payments in another currency cannot be compared
+// with the limit and are held too. A nil max disables the limit.
+func WithMaxAmount(max *commonpb.Money) Option {
+	return func(s *Server) {
+		s.maxAmount = max
+	}
+}
+
+// WithFailureSimulator injects latency into every RPC and failures into
+// ProcessPayment as configured on f, e.g. through the FailureAdmin service. By default the server has its own
+// simulator that injects nothing until configured.
+func WithFailureSimulator(f *simulation.FailureSimulator) Option {
+	return func(s *Server) {
+		s.failures = f
+	}
+}
+
+// WithIDGenerator sets how payment IDs are generated (ids.Derived by default,
+// "pay-<order ID>").
+func WithIDGenerator(g ids.Generator) Option {
+	return func(s *Server) {
+		s.ids = g
+	}
+}
+
+// WithClock sets the clock used for time-dependent behaviour (the real clock by default).
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
 }
 
 // NewServer creates a new Payment service server.
-func NewServer() *Server {
-	return &Server{
-		payments: make(map[string]*paymentpb.Payment),
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		clock:           clock.Real(),
+		ids:             ids.Derived(),
+		failureRate:     DefaultFailureRate,
+		gatewayFailover: true,
+		payments:        make(map[paymentKey]*paymentpb.Payment),
+		byOrder:         make(map[paymentKey][]string),
+		refunds:         make(map[paymentKey]*commonpb.CompensationResponse),
+		refundsInFlight: make(map[paymentKey]chan struct{}),
+		paymentRefunds:  make(map[paymentKey][]*paymentpb.Refund),
+		recentCharges:   make(map[paymentKey]recentCharge),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.gateways) == 0 {
+		s.gateways = []NamedGateway{{Name: SimulatedGatewayName, Gateway: &SimulatedGateway{DeclineRate: s.failureRate, OutageRate: s.outageRate}}}
+	}
+	if s.failures == nil {
+		s.failures = simulation.NewFailureSimulator(s.clock)
+	}
+	s.latency.Clock = s.clock
+	return s
+}
+
+// FailureAdmin returns the FailureAdmin service controlling the latency
+// injected into every RPC and the failures injected into ProcessPayment, for
+// registration on the server's gRPC server.
+func (s *Server) FailureAdmin() adminpb.FailureAdminServer {
+	return s.failures
+}
+
+// sleep simulates a slow service before an RPC is handled: the delay set by
+// WithSimulatedLatency, then any configured at runtime through the
+// FailureAdmin service. Either returns early with an error if ctx is done.
+func (s *Server) sleep(ctx context.Context) error {
+	if err := s.latency.Sleep(ctx); err != nil {
+		return err
+	}
+	return s.failures.Delay(ctx)
+}
+
+// Lookup returns a copy of the stored payment in the caller's tenant, for
+// in-process inspection (e.g. end-to-end checks in the all-in-one binary).
+func (s *Server) Lookup(ctx context.Context, paymentID string) (*paymentpb.Payment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	payment, ok := s.payments[keyFor(ctx, paymentID)]
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(payment).(*paymentpb.Payment), true
+}
+
+// OrderPayments returns copies of the payments made for an order in the
+// caller's tenant, oldest first, for in-process inspection.
+func (s *Server) OrderPayments(ctx context.Context, orderID string) []*paymentpb.Payment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var payments []*paymentpb.Payment
+	for _, id := range s.byOrder[keyFor(ctx, orderID)] {
+		payments = append(payments, proto.Clone(s.payments[keyFor(ctx, id)]).(*paymentpb.Payment))
 	}
+	return payments
 }
 
 // ProcessPayment handles processing a payment for an order.
 // Simulates success or failure.
 func (s *Server) ProcessPayment(ctx context.Context, req *paymentpb.ProcessPaymentRequest) (*paymentpb.ProcessPaymentResponse, error) {
 	orderID := req.OrderId.Id
-	log.Printf("Received ProcessPayment request for order ID: %s, Amount: %.2f", orderID, req.PaymentInfo.Amount)
+	method := paymentMethod(req.PaymentInfo)
+	log.Printf("Received ProcessPayment request for order ID: %s, Amount: %s, Method: %s", orderID, money.Format(req.PaymentInfo.GetAmount()), method)
 
-	// 1. Generate a unique payment ID
-	paymentID := "pay-" + orderID // Replace with actual ID generation
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ProcessPayment aborted during simulated latency: %v", err)
+		return nil, err
+	}
 
-	// 2. Simulate payment processing (e.g., call a payment gateway)
-	//    Randomly succeed or fail for demonstration purposes.
-	succeeded := rand.Intn(10) > 2 // 70% chance of success
+	// Apply any failure configured at runtime through the FailureAdmin service
+	if err := s.failures.Inject(ctx, "ProcessPayment"); err != nil {
+		return nil, err
+	}
 
+	// Payments in a currency not accepted, or not the order's, are refused outright
+	if err := s.checkCurrency(orderID, req.PaymentInfo); err != nil {
+		return nil, err
+	}
+
+	// 1. Generate the payment ID
+	paymentID := s.ids.NewID("pay", orderID)
+
+	// 2. Check the details, then charge them through the payment method's gateway
 	paymentStatus := paymentpb.PaymentStatus_FAILED
-	message := "Payment failed due to insufficient funds." // Example failure message
-	if succeeded {
+	var message, transactionID, gateway string
+	duplicateOf, duplicate := "", false
+	if err := validatePaymentInfo(req.PaymentInfo, s.clock.Now()); err != nil {
+		// Invalid payment details are rejected outright, never charged
+		message = "Invalid payment details: " + err.Error()
+		log.Printf("Payment %s for order %s rejected: %v", paymentID, orderID, err)
+	} else if duplicateOf, duplicate = s.duplicateOf(ctx, orderID, req.PaymentInfo); duplicate && !req.AllowDuplicate {
+		// Likely a double submission: the customer must confirm it first
+		if !s.strictDuplicates {
+			paymentStatus = paymentpb.PaymentStatus_DUPLICATE_SUSPECTED
+		}
+		message = fmt.Sprintf("Payment looks like a duplicate of payment %s, charged the same amount less than %v ago; resubmit with allow_duplicate to charge it anyway.", duplicateOf, s.duplicateWindow)
+		log.Printf("Payment %s for order %s not charged: suspected duplicate of payment %s", paymentID, orderID, duplicateOf)
+	} else if s.overLimit(req.PaymentInfo.Amount) {
+		// Fraud check: large payments are never charged automatically
+		paymentStatus = paymentpb.PaymentStatus_PENDING_REVIEW
+		message = fmt.Sprintf("Payment of %s exceeds the limit of %s and requires manual review.", money.Format(req.PaymentInfo.Amount), money.Format(s.maxAmount))
+		log.Printf("Payment %s for order %s held for review: amount %s exceeds limit %s.", paymentID, orderID, money.Format(req.PaymentInfo.Amount), money.Format(s.maxAmount))
+	} else if txn, name, err := s.charge(ctx, method, orderID, req.PaymentInfo); err == nil {
 		paymentStatus = paymentpb.PaymentStatus_SUCCESS
+		transactionID, gateway = txn, name
 		message = "Payment processed successfully."
-		log.Printf("Payment %s for order %s succeeded.", paymentID, orderID)
+		log.Printf("Payment %s for order %s succeeded (transaction %s, gateway %s).", paymentID, orderID, txn, name)
+	} else if errors.Is(err, ErrDeclined) {
+		gateway = name
+		message = fmt.Sprintf("Payment failed: %v.", err)
+		log.Printf("Payment %s for order %s failed at gateway %s: %v", paymentID, orderID, name, err)
 	} else {
-		log.Printf("Payment %s for order %s failed.", paymentID, orderID)
+		// An outage is not a decline: nothing was charged or recorded, so the
+		// caller may safely retry
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, status.FromContextError(ctxErr).Err()
+		}
+		log.Printf("Payment %s for order %s not processed, gateway unavailable: %v", paymentID, orderID, err)
+		info := errinfo.New(errinfo.DomainPayment, errinfo.ReasonGatewayUnavailable, map[string]string{"order_id": orderID})
+		return nil, errinfo.Errorf(codes.Unavailable, info, "Payment gateway unavailable for order %s: %v", orderID, err)
 	}
 
 	// 3. Create and persist payment record (in memory for now)
+	now := s.clock.Now()
 	newPayment := &paymentpb.Payment{
-		Id:      paymentID,
-		OrderId: req.OrderId,
-		Amount:  req.PaymentInfo.Amount,
-		Status:  paymentStatus,
-		// TransactionId: // Get from gateway if successful
+		Id:            paymentID,
+		OrderId:       req.OrderId,
+		Amount:        req.PaymentInfo.Amount,
+		Status:        paymentStatus,
+		TransactionId: transactionID,
+		Gateway:       gateway,
+		MethodType:    method,
+		PaymentMethod: describeMethod(req.PaymentInfo),
+		Items:         req.GetItems(),
+		CreatedAt:     timestamppb.New(now),
+		UpdatedAt:     timestamppb.New(now),
 	}
 	// Persist
 	s.mu.Lock()
-	s.payments[paymentID] = newPayment
+	if _, replaced := s.payments[keyFor(ctx, paymentID)]; !replaced {
+		s.byOrder[keyFor(ctx, orderID)] = append(s.byOrder[keyFor(ctx, orderID)], paymentID)
+	}
+	s.payments[keyFor(ctx, paymentID)] = newPayment
+	if paymentStatus == paymentpb.PaymentStatus_SUCCESS {
+		s.rememberChargeLocked(ctx, newPayment, req.PaymentInfo, now)
+	}
 	s.mu.Unlock()
-	log.Printf("Payment record stored: %+v", newPayment)
+	log.Printf("DEBUG: Payment record stored: %+v", newPayment)
 
 	// 4. Return response
 	return &paymentpb.ProcessPaymentResponse{
-		PaymentId: paymentID,
-		Status:    paymentStatus,
-		Message:   message,
+		PaymentId:          paymentID,
+		Status:             paymentStatus,
+		Message:            message,
+		DuplicateSuspected: duplicate && !req.AllowDuplicate,
 	}, nil
-
-	// Note: In a real scenario, errors from the gateway should be handled
-	// and potentially returned as gRPC errors.
-	// return nil, status.Errorf(codes.Internal, "Payment gateway error")
 }
 
 // RefundPayment handles the compensation action for refunding a payment.
+// A request carrying a request ID already seen (in the caller's tenant) that
+// succeeded returns the original response without attempting the refund
+// again, so retried compensations are safe. A duplicate arriving while the
+// original is handled waits for it. Failed requests are not remembered: a
+// retry is evaluated afresh.
 func (s *Server) RefundPayment(ctx context.Context, req *paymentpb.RefundPaymentRequest) (*commonpb.CompensationResponse, error) {
+	log.Printf("Received RefundPayment request for order ID: %s, Payment ID: %s (reason: %q, cause: %s)", req.OrderId.Id, req.PaymentId, req.GetReason(), req.GetCause())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("RefundPayment aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if req.RequestId == "" {
+		return s.refundPayment(ctx, req)
+	}
+	requestKey := keyFor(ctx, req.RequestId)
+	original, err := s.claimRefund(ctx, requestKey)
+	if err != nil {
+		return nil, err
+	}
+	if original != nil {
+		log.Printf("RefundPayment request %s already handled, returning the original response", req.RequestId)
+		return original, nil
+	}
+	resp, err := s.refundPayment(ctx, req)
+	s.mu.Lock()
+	if err == nil && resp.GetSuccess() {
+		s.refunds[requestKey] = proto.Clone(resp).(*commonpb.CompensationResponse)
+	}
+	done := s.refundsInFlight[requestKey]
+	delete(s.refundsInFlight, requestKey)
+	s.mu.Unlock()
+	close(done)
+	return resp, err
+}
+
+// refundPayment refunds the amount asked for of a payment, or all that is left
+// of it, unless it was never charged or is already refunded in full. The
+// refund is recorded and the payment's status follows from its refunds.
+func (s *Server) refundPayment(ctx context.Context, req *paymentpb.RefundPaymentRequest) (*commonpb.CompensationResponse, error) {
 	orderID := req.OrderId.Id
 	paymentID := req.PaymentId
-	log.Printf("Received RefundPayment request for order ID: %s, Payment ID: %s", orderID, paymentID)
 
-	// 1. Find the payment record (e.g., payment, exists := s.payments[paymentID])
-	//    Ensure it belongs to the correct orderID.
-	// 1. Find the payment record
-	s.mu.Lock()
-	payment, exists := s.payments[paymentID]
+	// 1. Find the payment record (only within the caller's tenant)
+	//    Ensure it belongs to the correct orderID. Payments are never removed
+	//    and keep their order, so both checks only need the read lock; the
+	//    write lock is only taken to change the payment.
+	key := keyFor(ctx, paymentID)
+	s.mu.RLock()
+	payment, exists := s.payments[key]
+	ownerID := payment.GetOrderId().GetId()
+	s.mu.RUnlock()
 	if !exists {
-		s.mu.Unlock()
 		log.Printf("RefundPayment failed: Payment %s not found", paymentID)
-		return nil, status.Errorf(codes.NotFound, "Payment %s not found", paymentID)
+		return &commonpb.CompensationResponse{Message: fmt.Sprintf("Payment %s not found", paymentID), Code: commonpb.CompensationCode_NOT_FOUND}, nil
 	}
 	// Optional: Verify it belongs to the correct orderID
-	if payment.OrderId.Id != orderID {
-		s.mu.Unlock()
+	if ownerID != orderID {
 		log.Printf("RefundPayment failed: Payment %s does not belong to order %s", paymentID, orderID)
-		return nil, status.Errorf(codes.InvalidArgument, "Payment %s does not belong to order %s", paymentID, orderID)
+		return &commonpb.CompensationResponse{Message: fmt.Sprintf("Payment %s does not belong to order %s", paymentID, orderID), Code: commonpb.CompensationCode_CONFLICT}, nil
 	}
+	s.mu.Lock()
+	payment = s.payments[key] // ProcessPayment may have replaced the record since
 
 	// 2. Check if refund is possible
 	if payment.Status == paymentpb.PaymentStatus_REFUNDED {
+		refundedAt := payment.RefundedAt
 		s.mu.Unlock()
 		log.Printf("RefundPayment skipped: Payment %s already refunded", paymentID)
-		return &commonpb.CompensationResponse{Success: true, Message: "Payment already refunded"}, nil
+		return &commonpb.CompensationResponse{
+			Success:        true,
+			Message:        "Payment already refunded",
+			AlreadyApplied: true,
+			Code:           commonpb.CompensationCode_ALREADY_DONE,
+			CompensatedAt:  refundedAt,
+			Actor:          interceptors.ActorFromContext(ctx),
+		}, nil
+	}
+	if payment.Status == paymentpb.PaymentStatus_PENDING_REVIEW {
+		s.mu.Unlock()
+		log.Printf("RefundPayment skipped: Payment %s was held for review and never charged", paymentID)
+		return &commonpb.CompensationResponse{Success: true, Message: "Payment was held for review, no refund needed", Code: commonpb.CompensationCode_ALREADY_DONE}, nil
+	}
+	if payment.Status == paymentpb.PaymentStatus_DUPLICATE_SUSPECTED {
+		s.mu.Unlock()
+		log.Printf("RefundPayment skipped: Payment %s was a suspected duplicate and never charged", paymentID)
+		return &commonpb.CompensationResponse{Success: true, Message: "Payment was a suspected duplicate, no refund needed", Code: commonpb.CompensationCode_ALREADY_DONE}, nil
 	}
 	if payment.Status == paymentpb.PaymentStatus_FAILED {
 		s.mu.Unlock()
 		log.Printf("RefundPayment skipped: Payment %s originally failed", paymentID)
-		// Arguably, this should still be success from orchestrator's perspective
-		return &commonpb.CompensationResponse{Success: true, Message: "Payment originally failed, no refund needed"}, nil
+		// A success for the orchestrator, but Refunded stays false: no money moved
+		return &commonpb.CompensationResponse{Success: true, Message: "Payment originally failed, no refund needed", Code: commonpb.CompensationCode_ALREADY_DONE}, nil
 	}
 
-	// 3. Perform refund action (simulation)
-	// Assume refund is successful for this example.
+	// 3. Work out how much to refund: the amount asked for, or all that is left
+	amount, err := refundAmountLocked(payment, req.GetAmount())
+	if err != nil {
+		s.mu.Unlock()
+		log.Printf("RefundPayment failed: Payment %s: %v", paymentID, err)
+		return nil, err
+	}
 
-	// 4. Update payment status to REFUNDED
-	payment.Status = paymentpb.PaymentStatus_REFUNDED
+	// 4. Perform refund action (simulation), recording the refund; the
+	//    payment's status follows from its refunds
+	refund := s.recordRefundLocked(ctx, payment, amount, req)
+	paymentStatus := payment.Status
 	s.mu.Unlock() // Unlock before logging
-	log.Printf("Payment %s for order %s status updated to REFUNDED.", paymentID, orderID)
+	log.Printf("Payment %s for order %s refunded %s (refund %s), status updated to %s.", paymentID, orderID, money.Format(amount), refund.Id, paymentStatus)
 
 	// 5. Return success response
+	message := "Payment refunded successfully"
+	if paymentStatus == paymentpb.PaymentStatus_PARTIALLY_REFUNDED {
+		message = fmt.Sprintf("Payment partially refunded (%s)", money.Format(amount))
+	}
 	return &commonpb.CompensationResponse{
-		Success: true,
-		Message: "Payment refunded successfully",
+		Success:       true,
+		Message:       message,
+		Code:          commonpb.CompensationCode_COMPLETED,
+		CompensatedAt: refund.CreatedAt,
+		Actor:         interceptors.ActorFromContext(ctx),
+		Refunded:      true,
 	}, nil
+}
+
+// GetPayment returns a copy of a payment in the caller's tenant.
+func (s *Server) GetPayment(ctx context.Context, req *paymentpb.GetPaymentRequest) (*paymentpb.Payment, error) {
+	paymentID := req.GetPaymentId()
+	log.Printf("Received GetPayment request for payment ID: %s", paymentID)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("GetPayment aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if paymentID == "" {
+		return nil, status.Error(codes.InvalidArgument, "payment ID is required")
+	}
+	payment, ok := s.Lookup(ctx, paymentID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "payment %s not found", paymentID)
+	}
+	return payment, nil
+}
 
-	// Example error handling:
-	// if !exists {
-	// 	return nil, status.Errorf(codes.NotFound, "Payment %s not found", paymentID)
-	// }
-	// return nil, status.Errorf(codes.Internal, "Failed to refund payment %s", paymentID)
+// ListPayments returns the payments made for an order in the caller's tenant.
+func (s *Server) ListPayments(ctx context.Context, req *paymentpb.ListPaymentsRequest) (*paymentpb.ListPaymentsResponse, error) {
+	orderID := req.GetOrderId().GetId()
+	log.Printf("Received ListPayments request for order ID: %s", orderID)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ListPayments aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if orderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "order ID is required")
+	}
+	return &paymentpb.ListPaymentsResponse{Payments: s.OrderPayments(ctx, orderID)}, nil
+}
+
+// ValidatePayment checks payment details the way ProcessPayment would, without
+// charging or storing anything. Amounts over the limit are reported because
+// they would be held for review rather than charged.
+func (s *Server) ValidatePayment(ctx context.Context, req *paymentpb.ValidatePaymentRequest) (*commonpb.ValidationResponse, error) {
+	log.Printf("Received ValidatePayment request, Amount: %s", money.Format(req.GetPaymentInfo().GetAmount()))
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ValidatePayment aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	violations := paymentInfoViolations(req.GetPaymentInfo(), s.clock.Now())
+	violations = append(violations, s.currencyViolations(req.GetPaymentInfo())...)
+	if amount := req.GetPaymentInfo().GetAmount(); validateAmount(amount) == nil && s.overLimit(amount) {
+		violations = append(violations, &commonpb.FieldViolation{
+			Field:       "payment_info.amount",
+			Description: fmt.Sprintf("amount %s exceeds the limit of %s and would require manual review", money.Format(amount), money.Format(s.maxAmount)),
+		})
+	}
+	return &commonpb.ValidationResponse{Valid: len(violations) == 0, Violations: violations}, nil
+}
+
+// overLimit reports whether a payment must be held for review: its amount
+// exceeds the limit, or is in another currency and cannot be compared with it.
+func (s *Server) overLimit(amount *commonpb.Money) bool {
+	if s.maxAmount == nil {
+		return false
+	}
+	cmp, err := money.Compare(amount, s.maxAmount)
+	return err != nil || cmp > 0
 }
@@ -0,0 +1,205 @@
+package payment_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// newServer returns a Payment server whose charges always go through.
+func newServer(opts ...paymentservice.Option) *paymentservice.Server {
+	return paymentservice.NewServer(append([]paymentservice.Option{paymentservice.WithFailureRate(0)}, opts...)...)
+}
+
+// charge takes SamplePayment for orderID and returns the payment ID.
+func charge(t *testing.T, s *paymentservice.Server, ctx context.Context, orderID string) string {
+	t.Helper()
+	resp, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{
+		OrderId:        &commonpb.OrderID{Id: orderID},
+		PaymentInfo:    sagatest.SamplePayment(),
+		AllowDuplicate: true,
+	})
+	if err != nil {
+		t.Errorf("ProcessPayment %s: %v", orderID, err)
+		return ""
+	}
+	if resp.GetStatus() != paymentpb.PaymentStatus_SUCCESS {
+		t.Errorf("ProcessPayment %s: status %s (%s)", orderID, resp.GetStatus(), resp.GetMessage())
+	}
+	return resp.GetPaymentId()
+}
+
+// TestConcurrentChargeRefundRead charges payments from many goroutines while
+// others refund every other one and read them back; run with -race.
+func TestConcurrentChargeRefundRead(t *testing.T) {
+	const n = 100
+	s := newServer(paymentservice.WithIDGenerator(ids.NewSequence()))
+	ctx := context.Background()
+
+	paymentIDs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		orderID := fmt.Sprintf("order-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paymentIDs[i] = charge(t, s, ctx, orderID)
+			if i%2 == 0 && paymentIDs[i] != "" {
+				resp, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{
+					OrderId:   &commonpb.OrderID{Id: orderID},
+					PaymentId: paymentIDs[i],
+					RequestId: "refund-" + orderID,
+				})
+				if err != nil || !resp.GetSuccess() {
+					t.Errorf("RefundPayment %s = %v, %v", orderID, resp, err)
+				}
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.ListPayments(ctx, &paymentpb.ListPaymentsRequest{OrderId: &commonpb.OrderID{Id: orderID}}); err != nil {
+				t.Errorf("ListPayments: %v", err)
+			}
+			if _, err := s.ListRefunds(ctx, &paymentpb.ListRefundsRequest{}); err != nil {
+				t.Errorf("ListRefunds: %v", err)
+			}
+			s.OrderPayments(ctx, orderID)
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	for i, id := range paymentIDs {
+		payment, err := s.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: id})
+		if err != nil {
+			t.Fatalf("GetPayment %s: %v", id, err)
+		}
+		want := paymentpb.PaymentStatus_SUCCESS
+		if i%2 == 0 {
+			want = paymentpb.PaymentStatus_REFUNDED
+		}
+		if payment.GetStatus() != want {
+			t.Errorf("payment %s is %s, want %s", id, payment.GetStatus(), want)
+		}
+	}
+	refunds, err := s.ListRefunds(ctx, &paymentpb.ListRefundsRequest{PageSize: n})
+	if err != nil {
+		t.Fatalf("ListRefunds: %v", err)
+	}
+	if got := len(refunds.GetRefunds()); got != n/2 {
+		t.Errorf("ListRefunds returned %d refunds, want %d", got, n/2)
+	}
+}
+
+// TestConcurrentRefundSamePayment refunds one payment from many goroutines
+// without request IDs: exactly one refund is recorded.
+func TestConcurrentRefundSamePayment(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	paymentID := charge(t, s, ctx, "order-1")
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentId: paymentID})
+			if err != nil || !resp.GetSuccess() {
+				t.Errorf("RefundPayment = %v, %v", resp, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(s.PaymentRefunds(ctx, paymentID)); got != 1 {
+		t.Errorf("%d refunds recorded, want 1", got)
+	}
+}
+
+// TestTenantIsolation checks that another tenant can neither read nor refund
+// a payment, even knowing its ID.
+func TestTenantIsolation(t *testing.T) {
+	s := newServer()
+	tenantA := interceptors.WithTenant(context.Background(), "tenant-a")
+	tenantB := interceptors.WithTenant(context.Background(), "tenant-b")
+	orderID := &commonpb.OrderID{Id: "order-1"}
+	paymentID := charge(t, s, tenantA, orderID.GetId())
+	if t.Failed() {
+		return
+	}
+
+	if _, err := s.GetPayment(tenantB, &paymentpb.GetPaymentRequest{PaymentId: paymentID}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetPayment from another tenant returned %v, want NotFound", err)
+	}
+	if list, err := s.ListPayments(tenantB, &paymentpb.ListPaymentsRequest{OrderId: orderID}); err != nil || len(list.GetPayments()) != 0 {
+		t.Errorf("ListPayments from another tenant = %v, %v; want no payments", list.GetPayments(), err)
+	}
+	resp, err := s.RefundPayment(tenantB, &paymentpb.RefundPaymentRequest{OrderId: orderID, PaymentId: paymentID, Reason: "not mine"})
+	if err != nil || resp.GetSuccess() || resp.GetCode() != commonpb.CompensationCode_NOT_FOUND {
+		t.Errorf("RefundPayment from another tenant = %v, %v; want NOT_FOUND", resp, err)
+	}
+
+	payment, err := s.GetPayment(tenantA, &paymentpb.GetPaymentRequest{PaymentId: paymentID})
+	if err != nil {
+		t.Fatalf("GetPayment from the owning tenant: %v", err)
+	}
+	if payment.GetStatus() != paymentpb.PaymentStatus_SUCCESS {
+		t.Errorf("payment is %s after another tenant's refund, want SUCCESS", payment.GetStatus())
+	}
+}
+
+// TestRefundPaymentCodes checks the CompensationCode RefundPayment answers
+// with as a payment is refunded and refunded again; none is retryable.
+func TestRefundPaymentCodes(t *testing.T) {
+	// The gateway declines order-2's card
+	s := newServer(paymentservice.WithGateway(paymentservice.GatewayFunc(func(_ context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+		if orderID == "order-2" {
+			return "", fmt.Errorf("%w: insufficient funds", paymentservice.ErrDeclined)
+		}
+		return "txn-" + orderID, nil
+	})))
+	ctx := context.Background()
+	paymentID := charge(t, s, ctx, "order-1")
+	declined, err := s.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-2"}, PaymentInfo: sagatest.SamplePayment()})
+	if err != nil || declined.GetStatus() != paymentpb.PaymentStatus_FAILED {
+		t.Fatalf("ProcessPayment with a declined card = %v, %v; want FAILED", declined, err)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		orderID      string
+		paymentID    string
+		wantCode     commonpb.CompensationCode
+		wantSuccess  bool
+		wantApplied  bool // AlreadyApplied
+		wantRefunded bool
+	}{
+		{"unknown payment", "order-1", "pay-404", commonpb.CompensationCode_NOT_FOUND, false, false, false},
+		{"another order's payment", "order-9", paymentID, commonpb.CompensationCode_CONFLICT, false, false, false},
+		{"first refund", "order-1", paymentID, commonpb.CompensationCode_COMPLETED, true, false, true},
+		{"repeated refund", "order-1", paymentID, commonpb.CompensationCode_ALREADY_DONE, true, true, false},
+		{"declined payment", "order-2", declined.GetPaymentId(), commonpb.CompensationCode_ALREADY_DONE, true, false, false},
+	} {
+		resp, err := s.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{OrderId: &commonpb.OrderID{Id: tc.orderID}, PaymentId: tc.paymentID})
+		if err != nil {
+			t.Fatalf("%s: RefundPayment: %v", tc.name, err)
+		}
+		if resp.GetCode() != tc.wantCode || resp.GetSuccess() != tc.wantSuccess || resp.GetAlreadyApplied() != tc.wantApplied || resp.GetRefunded() != tc.wantRefunded || resp.GetRetryable() {
+			t.Errorf("%s: RefundPayment = %v, want code %s, success %t, already applied %t, refunded %t, not retryable",
+				tc.name, resp, tc.wantCode, tc.wantSuccess, tc.wantApplied, tc.wantRefunded)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+)
+
+// validatePaymentInfo performs basic sanity checks on the payment details:
+// a valid, non-negative amount and the fields of the payment method (see
+// fieldChecks). It returns a user-facing reason when the details are invalid.
+func validatePaymentInfo(info *commonpb.PaymentInfo, now time.Time) error {
+	if info == nil {
+		return errors.New("payment info is missing")
+	}
+	for _, c := range fieldChecks(info, now) {
+		if c.err != nil {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// paymentInfoViolations is like validatePaymentInfo but reports every invalid
+// field instead of stopping at the first one.
+func paymentInfoViolations(info *commonpb.PaymentInfo, now time.Time) []*commonpb.FieldViolation {
+	if info == nil {
+		return []*commonpb.FieldViolation{{Field: "payment_info", Description: "payment info is missing"}}
+	}
+	var violations []*commonpb.FieldViolation
+	for _, c := range fieldChecks(info, now) {
+		if c.err != nil {
+			violations = append(violations, &commonpb.FieldViolation{Field: "payment_info." + c.field, Description: c.err.Error()})
+		}
+	}
+	return violations
+}
+
+// fieldCheck is the outcome of checking one field of a PaymentInfo.
+type fieldCheck struct {
+	field string // Path below payment_info, e.g. "wallet.account_id"
+	err   error  // Nil if the field is valid
+}
+
+// fieldChecks checks the amount and the fields of info's payment method:
+//   - CARD: a Luhn-valid card number, an expiry (MM/YY) not in the past
+//     relative to now, and a 3-4 digit CVV
+//   - WALLET: a provider and an account ID
+//   - BANK_TRANSFER: an account holder and a valid IBAN
+func fieldChecks(info *commonpb.PaymentInfo, now time.Time) []fieldCheck {
+	checks := []fieldCheck{{"amount", validateAmount(info.Amount)}}
+	switch method := paymentMethod(info); method {
+	case commonpb.PaymentMethodType_CARD:
+		checks = append(checks,
+			fieldCheck{"card_number", validateCardNumber(info.CardNumber)},
+			fieldCheck{"expiry_date", validateExpiry(info.ExpiryDate, now)},
+			fieldCheck{"cvv", validateCVV(info.Cvv)},
+		)
+	case commonpb.PaymentMethodType_WALLET:
+		checks = append(checks,
+			fieldCheck{"wallet.provider", required("wallet provider", info.GetWallet().GetProvider())},
+			fieldCheck{"wallet.account_id", required("wallet account ID", info.GetWallet().GetAccountId())},
+		)
+	case commonpb.PaymentMethodType_BANK_TRANSFER:
+		checks = append(checks,
+			fieldCheck{"bank_transfer.account_holder", required("account holder", info.GetBankTransfer().GetAccountHolder())},
+			fieldCheck{"bank_transfer.iban", validateIBAN(info.GetBankTransfer().GetIban())},
+		)
+	default:
+		checks = append(checks, fieldCheck{"method_type", fmt.Errorf("payment method %s is not supported", method)})
+	}
+	return checks
+}
+
+// paymentMethod returns how info is paid; an unspecified method is a card.
+func paymentMethod(info *commonpb.PaymentInfo) commonpb.PaymentMethodType {
+	if info.GetMethodType() == commonpb.PaymentMethodType_PAYMENT_METHOD_TYPE_UNSPECIFIED {
+		return commonpb.PaymentMethodType_CARD
+	}
+	return info.GetMethodType()
+}
+
+// required checks a free-form field is not blank.
+func required(name, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("%s is required", name)
+	}
+	return nil
+}
+
+// validateAmount checks the amount is a well-formed, non-negative Money.
+func validateAmount(amount *commonpb.Money) error {
+	if err := money.Validate(amount); err != nil {
+		return err
+	}
+	if money.IsNegative(amount) {
+		return errors.New("amount must not be negative")
+	}
+	return nil
+}
+
+// validateCardNumber checks the number (spaces and dashes ignored) is 12-19
+// digits long and passes the Luhn checksum.
+func validateCardNumber(number string) error {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if len(digits) < 12 || len(digits) > 19 {
+		return errors.New("card number must have 12 to 19 digits")
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		c := digits[len(digits)-1-i]
+		if c < '0' || c > '9' {
+			return errors.New("card number must contain only digits")
+		}
+		d := int(c - '0')
+		if i%2 == 1 { // Double every second digit from the right
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	if sum%10 != 0 {
+		return errors.New("card number failed checksum")
+	}
+	return nil
+}
+
+// validateExpiry checks an MM/YY expiry date; the card is valid until the end of that month.
+func validateExpiry(expiry string, now time.Time) error {
+	month, year, ok := strings.Cut(expiry, "/")
+	m, errM := strconv.Atoi(month)
+	y, errY := strconv.Atoi(year)
+	if !ok || len(month) != 2 || len(year) != 2 || errM != nil || errY != nil || m < 1 || m > 12 {
+		return fmt.Errorf("expiry date %q must be in MM/YY format", expiry)
+	}
+	// First instant of the month after expiry, in UTC
+	expiresAt := time.Date(2000+y, time.Month(m)+1, 1, 0, 0, 0, 0, time.UTC)
+	if !now.Before(expiresAt) {
+		return errors.New("card has expired")
+	}
+	return nil
+}
+
+// validateIBAN checks an IBAN (spaces ignored, any case): a country code, two
+// check digits and up to 30 letters or digits, 15 to 34 characters in all,
+// passing the ISO 7064 mod 97 checksum.
+func validateIBAN(iban string) error {
+	iban = strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+	if len(iban) < 15 || len(iban) > 34 {
+		return errors.New("IBAN must have 15 to 34 characters")
+	}
+	if iban[0] < 'A' || iban[0] > 'Z' || iban[1] < 'A' || iban[1] > 'Z' || iban[2] < '0' || iban[2] > '9' || iban[3] < '0' || iban[3] > '9' {
+		return errors.New("IBAN must start with a country code and two check digits")
+	}
+	// Move the first four characters to the end, read letters as 10-35 and
+	// take the whole number mod 97, digit by digit
+	rem := 0
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return errors.New("IBAN must contain only letters and digits")
+		}
+	}
+	if rem != 1 {
+		return errors.New("IBAN failed checksum")
+	}
+	return nil
+}
+
+// validateCVV checks the CVV is 3 or 4 digits.
+func validateCVV(cvv string) error {
+	if len(cvv) < 3 || len(cvv) > 4 {
+		return errors.New("CVV must be 3 or 4 digits")
+	}
+	for _, c := range cvv {
+		if c < '0' || c > '9' {
+			return errors.New("CVV must be 3 or 4 digits")
+		}
+	}
+	return nil
+}
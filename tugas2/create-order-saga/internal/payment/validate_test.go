@@ -0,0 +1,87 @@
+package payment_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/clock"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// TestProcessPaymentCardValidation runs one card field at a time through
+// ProcessPayment on 15 May 2024: an invalid field fails the payment with a
+// message naming the problem and nothing is charged, while a valid one
+// reaches the gateway.
+func TestProcessPaymentCardValidation(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		edit    func(*commonpb.PaymentInfo)
+		wantErr string // Empty if the payment succeeds
+	}{
+		{"valid", func(*commonpb.PaymentInfo) {}, ""},
+		{"number with spaces", func(p *commonpb.PaymentInfo) { p.CardNumber = "4242 4242 4242 4242" }, ""},
+		{"dummy number", func(p *commonpb.PaymentInfo) { p.CardNumber = "xxxx-xxxx-xxxx-1234" }, "only digits"},
+		{"number too short", func(p *commonpb.PaymentInfo) { p.CardNumber = "42424242424" }, "12 to 19 digits"},
+		{"number too long", func(p *commonpb.PaymentInfo) { p.CardNumber = "42424242424242424242" }, "12 to 19 digits"},
+		{"number failing Luhn", func(p *commonpb.PaymentInfo) { p.CardNumber = "4242424242424241" }, "failed checksum"},
+		{"expiring this month", func(p *commonpb.PaymentInfo) { p.ExpiryDate = "05/24" }, ""},
+		{"expired last month", func(p *commonpb.PaymentInfo) { p.ExpiryDate = "04/24" }, "expired"},
+		{"expiry without a slash", func(p *commonpb.PaymentInfo) { p.ExpiryDate = "1230" }, "MM/YY"},
+		{"expiry single-digit month", func(p *commonpb.PaymentInfo) { p.ExpiryDate = "1/30" }, "MM/YY"},
+		{"expiry month 13", func(p *commonpb.PaymentInfo) { p.ExpiryDate = "13/30" }, "MM/YY"},
+		{"four-digit CVV", func(p *commonpb.PaymentInfo) { p.Cvv = "1234" }, ""},
+		{"two-digit CVV", func(p *commonpb.PaymentInfo) { p.Cvv = "12" }, "CVV"},
+		{"five-digit CVV", func(p *commonpb.PaymentInfo) { p.Cvv = "12345" }, "CVV"},
+		{"CVV with letters", func(p *commonpb.PaymentInfo) { p.Cvv = "12a" }, "CVV"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := &recordingGateway{name: "card"}
+			s := newServer(paymentservice.WithGateway(gateway), paymentservice.WithClock(clock.NewFake(now)))
+			info := sagatest.SamplePayment()
+			tc.edit(info)
+
+			resp, err := s.ProcessPayment(context.Background(), &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: info})
+			if err != nil {
+				t.Fatalf("ProcessPayment: %v", err)
+			}
+			if tc.wantErr == "" {
+				if resp.GetStatus() != paymentpb.PaymentStatus_SUCCESS || len(gateway.charged) != 1 {
+					t.Errorf("ProcessPayment = %v with %d charges, want SUCCESS charged once", resp, len(gateway.charged))
+				}
+				return
+			}
+			if resp.GetStatus() != paymentpb.PaymentStatus_FAILED || !strings.Contains(resp.GetMessage(), tc.wantErr) {
+				t.Errorf("ProcessPayment = %s %q, want FAILED mentioning %q", resp.GetStatus(), resp.GetMessage(), tc.wantErr)
+			}
+			if len(gateway.charged) != 0 {
+				t.Errorf("gateway charged %d times for invalid details", len(gateway.charged))
+			}
+		})
+	}
+}
+
+// TestValidatePaymentReportsEveryField checks ValidatePayment lists each
+// invalid card field, where ProcessPayment stops at the first.
+func TestValidatePaymentReportsEveryField(t *testing.T) {
+	s := newServer()
+	info := sagatest.SamplePayment()
+	info.CardNumber, info.ExpiryDate, info.Cvv = "xxxx-xxxx-xxxx-1234", "01/20", "1"
+	resp, err := s.ValidatePayment(context.Background(), &paymentpb.ValidatePaymentRequest{PaymentInfo: info})
+	if err != nil {
+		t.Fatalf("ValidatePayment: %v", err)
+	}
+	var fields []string
+	for _, v := range resp.GetViolations() {
+		fields = append(fields, v.GetField())
+	}
+	want := "payment_info.card_number,payment_info.expiry_date,payment_info.cvv"
+	if resp.GetValid() || strings.Join(fields, ",") != want {
+		t.Errorf("ValidatePayment violations = %v, want %s", fields, want)
+	}
+}
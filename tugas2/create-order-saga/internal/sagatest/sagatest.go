@@ -0,0 +1,322 @@
+// Package sagatest runs the real Order, Payment and Shipping services on
+// in-memory bufconn listeners and wires an orchestrator to them, so the whole
+// saga can be exercised end to end by `go test` without external processes.
+package sagatest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"create-order-saga/internal/buildinfo"
+	"create-order-saga/internal/orchestrator"
+	orderservice "create-order-saga/internal/order"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/server"
+	shippingservice "create-order-saga/internal/shipping"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
+	commonpb "create-order-saga/proto/common"
+	infopb "create-order-saga/proto/info"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+const bufSize = 1 << 20
+
+// config holds the knobs applied by New.
+type config struct {
+	paymentFails   bool
+	paymentGateway paymentservice.Gateway
+	shippingFails  bool
+	latency        time.Duration
+	orderOpts      []orderservice.Option
+	paymentOpts    []paymentservice.Option
+	shippingOpts   []shippingservice.Option
+	orchOpts       []orchestrator.Option
+	clientOpts     []grpc_clients.Option
+	apiKeys        []string
+	warehouses     map[string]string
+	taxRates       orderservice.TaxRates
+	clock          clock.Clock
+	ids            ids.Generator
+}
+
+// Option configures a Harness.
+type Option func(*config)
+
+// WithPaymentFailure makes every otherwise valid payment be declined.
+func WithPaymentFailure() Option {
+	return func(c *config) { c.paymentFails = true }
+}
+
+// WithPaymentGateway charges payments through g, e.g. to script declines and
+// gateway outages. It overrides WithPaymentFailure.
+func WithPaymentGateway(g paymentservice.Gateway) Option {
+	return func(c *config) { c.paymentGateway = g }
+}
+
+// WithShippingFailure makes every ArrangeShipping and ReserveShipping call fail.
+func WithShippingFailure() Option {
+	return func(c *config) { c.shippingFails = true }
+}
+
+// WithWarehouses sets the warehouse stocking each product, so orders mixing
+// warehouses get several shipments (see shippingservice.WithWarehouses).
+func WithWarehouses(warehouses map[string]string) Option {
+	return func(c *config) { c.warehouses = warehouses }
+}
+
+// WithTaxRates sets the tax the Order service charges by destination, which
+// the saga adds to the amount it charges (see orderservice.WithTaxRates).
+func WithTaxRates(rates orderservice.TaxRates) Option {
+	return func(c *config) { c.taxRates = rates }
+}
+
+// WithClock makes the services and the orchestrator read the time from c, so
+// recorded timestamps are predictable. Client retry backoff keeps the real
+// clock unless set with WithClientOptions(grpc_clients.WithClock(...)).
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) { cfg.clock = c }
+}
+
+// WithIDGenerator makes the services and the orchestrator generate every
+// order, payment, shipment and saga ID with g, e.g. an ids.Sequence.
+func WithIDGenerator(g ids.Generator) Option {
+	return func(c *config) { c.ids = g }
+}
+
+// WithLatency delays every RPC on every service by d.
+func WithLatency(d time.Duration) Option {
+	return func(c *config) { c.latency = d }
+}
+
+// WithOrderOptions passes options through to the Order service, after the
+// harness's own, e.g. to seed stock or a price catalog.
+func WithOrderOptions(opts ...orderservice.Option) Option {
+	return func(c *config) { c.orderOpts = append(c.orderOpts, opts...) }
+}
+
+// WithPaymentOptions passes options through to the Payment service, after the
+// harness's own, e.g. to set an amount limit.
+func WithPaymentOptions(opts ...paymentservice.Option) Option {
+	return func(c *config) { c.paymentOpts = append(c.paymentOpts, opts...) }
+}
+
+// WithShippingOptions passes options through to the Shipping service, after
+// the harness's own, e.g. to make only some parcels fail.
+func WithShippingOptions(opts ...shippingservice.Option) Option {
+	return func(c *config) { c.shippingOpts = append(c.shippingOpts, opts...) }
+}
+
+// WithOrchestratorOptions passes options through to the orchestrator.
+func WithOrchestratorOptions(opts ...orchestrator.Option) Option {
+	return func(c *config) { c.orchOpts = append(c.orchOpts, opts...) }
+}
+
+// WithClientOptions passes options through to the service clients.
+func WithClientOptions(opts ...grpc_clients.Option) Option {
+	return func(c *config) { c.clientOpts = append(c.clientOpts, opts...) }
+}
+
+// WithServerAPIKeys makes every service require one of keys. Pass the client
+// key with WithClientOptions(grpc_clients.WithAPIKey(...)).
+func WithServerAPIKeys(keys ...string) Option {
+	return func(c *config) { c.apiKeys = append(c.apiKeys, keys...) }
+}
+
+// Harness is a running saga stack. Unless a failure is forced, payments and
+// shipping always succeed so outcomes are deterministic.
+type Harness struct {
+	Order        *orderservice.Server
+	Payment      *paymentservice.Server
+	Shipping     *shippingservice.Server
+	Clients      *grpc_clients.ServiceClients
+	Orchestrator *orchestrator.Orchestrator
+
+	adminDialOpts []grpc.DialOption // Dial the services directly, bypassing Clients
+}
+
+// New starts the stack; it is torn down automatically when the test ends.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	paymentFailureRate, shippingFailureRate := 0.0, 0.0
+	if cfg.paymentFails {
+		paymentFailureRate = 1
+	}
+	if cfg.shippingFails {
+		shippingFailureRate = 1
+	}
+
+	orderOpts := []orderservice.Option{
+		orderservice.WithSimulatedLatency(cfg.latency, cfg.latency),
+		orderservice.WithTaxRates(cfg.taxRates),
+	}
+	paymentOpts := []paymentservice.Option{
+		paymentservice.WithSimulatedLatency(cfg.latency, cfg.latency),
+		paymentservice.WithFailureRate(paymentFailureRate),
+	}
+	if cfg.paymentGateway != nil {
+		paymentOpts = append(paymentOpts, paymentservice.WithGateway(cfg.paymentGateway))
+	}
+	shippingOpts := []shippingservice.Option{
+		shippingservice.WithSimulatedLatency(cfg.latency, cfg.latency),
+		shippingservice.WithFailureRate(shippingFailureRate),
+		shippingservice.WithWarehouses(cfg.warehouses),
+	}
+	var orchOpts []orchestrator.Option
+	if cfg.clock != nil {
+		orderOpts = append(orderOpts, orderservice.WithClock(cfg.clock))
+		paymentOpts = append(paymentOpts, paymentservice.WithClock(cfg.clock))
+		shippingOpts = append(shippingOpts, shippingservice.WithClock(cfg.clock))
+		orchOpts = append(orchOpts, orchestrator.WithClock(cfg.clock))
+	}
+	if cfg.ids != nil {
+		orderOpts = append(orderOpts, orderservice.WithIDGenerator(cfg.ids))
+		paymentOpts = append(paymentOpts, paymentservice.WithIDGenerator(cfg.ids))
+		shippingOpts = append(shippingOpts, shippingservice.WithIDGenerator(cfg.ids))
+		orchOpts = append(orchOpts, orchestrator.WithIDGenerator(cfg.ids))
+	}
+
+	h := &Harness{
+		Order:    orderservice.NewServer(append(orderOpts, cfg.orderOpts...)...),
+		Payment:  paymentservice.NewServer(append(paymentOpts, cfg.paymentOpts...)...),
+		Shipping: shippingservice.NewServer(append(shippingOpts, cfg.shippingOpts...)...),
+	}
+
+	listeners := map[string]*bufconn.Listener{
+		grpc_clients.OrderService:    serve(t, cfg, grpc_clients.OrderService, &orderpb.OrderService_ServiceDesc, h.Order, h.Order.FailureAdmin()),
+		grpc_clients.PaymentService:  serve(t, cfg, grpc_clients.PaymentService, &paymentpb.PaymentService_ServiceDesc, h.Payment, h.Payment.FailureAdmin()),
+		grpc_clients.ShippingService: serve(t, cfg, grpc_clients.ShippingService, &shippingpb.ShippingService_ServiceDesc, h.Shipping, h.Shipping.FailureAdmin()),
+	}
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		return listeners[addr].DialContext(ctx)
+	}
+	h.adminDialOpts = []grpc.DialOption{grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if len(cfg.apiKeys) > 0 {
+		h.adminDialOpts = append(h.adminDialOpts, grpc.WithUnaryInterceptor(interceptors.APIKeyUnaryClientInterceptor(cfg.apiKeys[0])))
+	}
+
+	clientOpts := append([]grpc_clients.Option{grpc_clients.WithDialOptions(grpc.WithContextDialer(dialer))}, cfg.clientOpts...)
+	clients, err := grpc_clients.NewServiceClients(
+		"passthrough:///"+grpc_clients.OrderService,
+		"passthrough:///"+grpc_clients.PaymentService,
+		"passthrough:///"+grpc_clients.ShippingService,
+		clientOpts...,
+	)
+	if err != nil {
+		t.Fatalf("creating service clients: %v", err)
+	}
+	t.Cleanup(func() { clients.Close() })
+	h.Clients = clients
+	h.Orchestrator = orchestrator.NewOrchestrator(clients, append(orchOpts, cfg.orchOpts...)...)
+	t.Cleanup(func() {
+		// Orders may still be completed in the background (see orchestrator.WithAsyncComplete)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.Orchestrator.WaitForCompletions(ctx)
+		h.Orchestrator.Close()
+	})
+	return h
+}
+
+// serve starts a gRPC server for the service named name, reporting SERVING in
+// its health check, its build through the InfoService (as of starting), and
+// with its FailureAdmin service enabled, on a new bufconn listener.
+func serve(t testing.TB, cfg *config, name string, desc *grpc.ServiceDesc, impl any, admin adminpb.FailureAdminServer) *bufconn.Listener {
+	lis := bufconn.Listen(bufSize)
+	var serverCfg server.Config
+	if len(cfg.apiKeys) > 0 {
+		serverCfg.Auth = interceptors.NewStaticKeys(cfg.apiKeys...)
+	}
+	s := server.NewGRPCServer(serverCfg)
+	server.RegisterHealth(s, desc.ServiceName)
+	s.RegisterService(desc, impl)
+	adminpb.RegisterFailureAdminServer(s, admin)
+	infopb.RegisterInfoServiceServer(s, buildinfo.NewServer(buildinfo.Info(name, nil)))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis
+}
+
+// FailureAdmin returns a client of the FailureAdmin service of service, one of
+// grpc_clients.OrderService, PaymentService or ShippingService. The
+// connection is closed when the test ends.
+func (h *Harness) FailureAdmin(t testing.TB, service string) adminpb.FailureAdminClient {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///"+service, h.adminDialOpts...)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", service, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return adminpb.NewFailureAdminClient(conn)
+}
+
+// Run executes one saga for userID with a valid sample payment and address.
+func (h *Harness) Run(ctx context.Context, userID string) (*orchestrator.SagaState, error) {
+	return h.Orchestrator.RunCreateOrderSaga(ctx, SampleOrder(userID), SamplePayment(), SampleAddress())
+}
+
+// OrderStatus returns the stored status of an order, or false if it does not exist.
+func (h *Harness) OrderStatus(orderID string) (orderpb.OrderStatus, bool) {
+	order, ok := h.Order.Lookup(context.Background(), orderID)
+	return order.GetStatus(), ok
+}
+
+// PaymentStatus returns the stored status of a payment, or false if it does not exist.
+func (h *Harness) PaymentStatus(paymentID string) (paymentpb.PaymentStatus, bool) {
+	payment, ok := h.Payment.Lookup(context.Background(), paymentID)
+	return payment.GetStatus(), ok
+}
+
+// ShipmentStatus returns the stored status of a shipment, or false if it does not exist.
+func (h *Harness) ShipmentStatus(shipmentID string) (shippingpb.ShippingStatus, bool) {
+	shipment, ok := h.Shipping.Lookup(context.Background(), shipmentID)
+	return shipment.GetStatus(), ok
+}
+
+// SampleOrder returns a small two-item order for userID.
+func SampleOrder(userID string) *commonpb.OrderDetails {
+	return &commonpb.OrderDetails{
+		UserId: userID,
+		Items: []*commonpb.Item{
+			{ProductId: "prod-A", Name: "Widget", Sku: "WID-A-001", WeightGrams: 250, Quantity: 2, Price: money.MustParse(money.DefaultCurrency, "10.50")},
+			{ProductId: "prod-B", Name: "Gadget", Sku: "GAD-B-002", WeightGrams: 1200, Quantity: 1, Price: money.MustParse(money.DefaultCurrency, "25.00")},
+		},
+	}
+}
+
+// SamplePayment returns valid card details covering SampleOrder.
+func SamplePayment() *commonpb.PaymentInfo {
+	return &commonpb.PaymentInfo{
+		CardNumber: "4242-4242-4242-4242", // Luhn-valid test number
+		ExpiryDate: "12/30",
+		Cvv:        "123",
+		Amount:     money.MustParse(money.DefaultCurrency, "46.00"), // 2*10.50 + 25.00
+	}
+}
+
+// SampleAddress returns a shipping address.
+func SampleAddress() *commonpb.ShippingAddress {
+	return &commonpb.ShippingAddress{
+		Street:  "123 Saga Lane",
+		City:    "Orchestration City",
+		State:   "Workflow",
+		ZipCode: "98765",
+		Country: "GoLand",
+	}
+}
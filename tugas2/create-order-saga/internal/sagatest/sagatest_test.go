@@ -0,0 +1,1291 @@
+package sagatest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"create-order-saga/internal/buildinfo"
+	"create-order-saga/internal/orchestrator"
+	orderservice "create-order-saga/internal/order"
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/internal/server"
+	shippingservice "create-order-saga/internal/shipping"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/grpc_clients"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+func TestSagaHappyPath(t *testing.T) {
+	h := sagatest.New(t)
+	state, err := h.Run(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_COMPLETED {
+		t.Errorf("order is %s, want COMPLETED", got)
+	}
+	if got, _ := h.PaymentStatus(state.PaymentID); got != paymentpb.PaymentStatus_SUCCESS {
+		t.Errorf("payment is %s, want SUCCESS", got)
+	}
+	if len(state.ShipmentIDs) == 0 {
+		t.Fatal("saga reserved no shipment")
+	}
+	for _, id := range state.ShipmentIDs {
+		if got, _ := h.ShipmentStatus(id); got != shippingpb.ShippingStatus_SHIPPED {
+			t.Errorf("shipment %s is %s, want SHIPPED", id, got)
+		}
+	}
+}
+
+func TestSagaPaymentFailureCompensates(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithPaymentFailure())
+	state, err := h.Run(context.Background(), "user-1")
+	if !errors.Is(err, orchestrator.ErrPaymentFailed) {
+		t.Fatalf("saga error = %v, want ErrPaymentFailed", err)
+	}
+	if errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Errorf("compensation failed: %v", err)
+	}
+	if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("order is %s, want CANCELLED", got)
+	}
+	if len(state.ShipmentIDs) == 0 {
+		t.Fatal("saga reserved no shipment before paying")
+	}
+	for _, id := range state.ShipmentIDs {
+		if got, _ := h.ShipmentStatus(id); got != shippingpb.ShippingStatus_CANCELLED {
+			t.Errorf("shipment %s is %s, want CANCELLED", id, got)
+		}
+	}
+	for _, payment := range h.Payment.OrderPayments(context.Background(), state.OrderID.GetId()) {
+		if payment.GetStatus() == paymentpb.PaymentStatus_SUCCESS {
+			t.Errorf("payment %s was taken for a failed saga", payment.GetId())
+		}
+	}
+}
+
+// TestSagaPaymentOverLimitCompensates runs a saga for more than the Payment
+// service's limit: the payment is held for review, and the saga compensates
+// as it would for a decline.
+func TestSagaPaymentOverLimitCompensates(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithPaymentOptions(paymentservice.WithMaxAmount(money.MustParse(money.DefaultCurrency, "45.99"))))
+	state, err := h.Run(context.Background(), "user-1")
+	if !errors.Is(err, orchestrator.ErrPaymentFailed) || errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Fatalf("saga error = %v, want ErrPaymentFailed with compensation succeeding", err)
+	}
+	payments := h.Payment.OrderPayments(context.Background(), state.OrderID.GetId())
+	if len(payments) != 1 || payments[0].GetStatus() != paymentpb.PaymentStatus_PENDING_REVIEW {
+		t.Errorf("order payments = %v, want one PENDING_REVIEW payment", payments)
+	}
+	if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("order is %s, want CANCELLED", got)
+	}
+	for _, id := range state.ShipmentIDs {
+		if got, _ := h.ShipmentStatus(id); got != shippingpb.ShippingStatus_CANCELLED {
+			t.Errorf("shipment %s is %s, want CANCELLED", id, got)
+		}
+	}
+}
+
+func TestSagaShippingFailureCompensates(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithShippingFailure())
+	state, err := h.Run(context.Background(), "user-1")
+	if !errors.Is(err, orchestrator.ErrShippingFailed) {
+		t.Fatalf("saga error = %v, want ErrShippingFailed", err)
+	}
+	if errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Errorf("compensation failed: %v", err)
+	}
+	if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("order is %s, want CANCELLED", got)
+	}
+	if state.PaymentID != "" {
+		t.Errorf("payment %s was taken although shipping failed first", state.PaymentID)
+	}
+	if payments := h.Payment.OrderPayments(context.Background(), state.OrderID.GetId()); len(payments) != 0 {
+		t.Errorf("%d payment(s) recorded for the order, want none", len(payments))
+	}
+}
+
+// TestSagaRecordsDeterministic runs the same saga on two stacks with a fake
+// clock and sequential IDs: the order, payment and shipment they store are
+// identical byte for byte, carry the sequence's IDs and the fake time, and
+// two orders of one user are kept apart.
+func TestSagaRecordsDeterministic(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	run := func() (*orchestrator.SagaState, [][]byte) {
+		h := sagatest.New(t, sagatest.WithClock(clock.NewFake(start)), sagatest.WithIDGenerator(ids.NewSequence()))
+		ctx := context.Background()
+		var state *orchestrator.SagaState
+		for range 2 {
+			var err error
+			if state, err = h.Run(ctx, "user-1"); err != nil {
+				t.Fatalf("saga failed: %v", err)
+			}
+		}
+		first, _ := h.Order.Lookup(ctx, "order-1")
+		if first.GetStatus() != orderpb.OrderStatus_COMPLETED {
+			t.Errorf("user-1's first order is %s, want it kept as COMPLETED", first.GetStatus())
+		}
+		order, _ := h.Order.Lookup(ctx, state.OrderID.GetId())
+		payment, _ := h.Payment.Lookup(ctx, state.PaymentID)
+		shipment, _ := h.Shipping.Lookup(ctx, state.ShipmentIDs[0])
+		if !order.GetCreatedAt().AsTime().Equal(start) || !payment.GetCreatedAt().AsTime().Equal(start) || !shipment.GetCreatedAt().AsTime().Equal(start) {
+			t.Errorf("records created at %v, %v, %v; want the fake clock's %v",
+				order.GetCreatedAt().AsTime(), payment.GetCreatedAt().AsTime(), shipment.GetCreatedAt().AsTime(), start)
+		}
+		var records [][]byte
+		for _, m := range []proto.Message{first, order, payment, shipment} {
+			b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, b)
+		}
+		return state, records
+	}
+
+	state, records := run()
+	if state.SagaID != "saga-2" || state.OrderID.GetId() != "order-2" || state.PaymentID != "pay-2" || !slices.Equal(state.ShipmentIDs, []string{"ship-2"}) {
+		t.Errorf("second saga = %s, want saga-2, order-2, pay-2 and ship-2", state)
+	}
+	_, again := run()
+	for i, name := range []string{"first order", "order", "payment", "shipment"} {
+		if !bytes.Equal(records[i], again[i]) {
+			t.Errorf("%s records differ between identical runs", name)
+		}
+	}
+}
+
+// TestSagaClientReferenceRoundTrip runs a saga for an order tagged with
+// metadata and a client reference: the saga echoes the reference, and the
+// order found by it over gRPC carries both as submitted.
+func TestSagaClientReferenceRoundTrip(t *testing.T) {
+	h := sagatest.New(t)
+	ctx := context.Background()
+	details := sagatest.SampleOrder("user-1")
+	details.ClientReferenceId = "web-1001"
+	details.Metadata = map[string]string{"channel": "web", "promo": "SPRING24"}
+	state, err := h.Orchestrator.RunCreateOrderSaga(ctx, details, sagatest.SamplePayment(), sagatest.SampleAddress())
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+	if state.ClientReferenceID != "web-1001" || !strings.Contains(state.String(), "ref=web-1001") {
+		t.Errorf("saga state = %s, want it to echo the client reference", state)
+	}
+
+	order, err := h.Clients.Order.GetOrderByClientReference(ctx, &orderpb.GetOrderByClientReferenceRequest{ClientReferenceId: "web-1001"})
+	if err != nil {
+		t.Fatalf("GetOrderByClientReference: %v", err)
+	}
+	if order.GetId() != state.OrderID.GetId() || order.GetStatus() != orderpb.OrderStatus_COMPLETED {
+		t.Errorf("order by reference = %s (%s), want the saga's completed order %s", order.GetId(), order.GetStatus(), state.OrderID.GetId())
+	}
+	if !maps.Equal(order.GetMetadata(), details.Metadata) || order.GetClientReferenceId() != "web-1001" {
+		t.Errorf("order metadata = %v, reference %q; want %v and web-1001", order.GetMetadata(), order.GetClientReferenceId(), details.Metadata)
+	}
+}
+
+// record is the timestamps of a stored order, payment or shipment.
+type record interface {
+	GetCreatedAt() *timestamppb.Timestamp
+	GetUpdatedAt() *timestamppb.Timestamp
+}
+
+// TestSagaRecordTimestamps runs a saga and cancels its order half an hour
+// later on a fake clock, reading each record back through its Get and List
+// RPCs: created_at stays at the saga's time while updated_at follows every
+// status change.
+func TestSagaRecordTimestamps(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	h := sagatest.New(t, sagatest.WithClock(fake))
+	ctx := context.Background()
+	state, err := h.Run(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("saga failed: %v", err)
+	}
+
+	// fetch reads the saga's order, payment and shipment through each RPC
+	// exposing it, by name.
+	fetch := func() map[string]record {
+		t.Helper()
+		order, err := h.Clients.Order.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: state.OrderID})
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		orders, err := h.Clients.Order.ListOrders(ctx, &orderpb.ListOrdersRequest{})
+		if err != nil || len(orders.GetOrders()) != 1 {
+			t.Fatalf("ListOrders = %v, %v; want the saga's order", orders, err)
+		}
+		payment, err := h.Clients.Payment.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: state.PaymentID})
+		if err != nil {
+			t.Fatalf("GetPayment: %v", err)
+		}
+		payments, err := h.Clients.Payment.ListPayments(ctx, &paymentpb.ListPaymentsRequest{OrderId: state.OrderID})
+		if err != nil || len(payments.GetPayments()) != 1 {
+			t.Fatalf("ListPayments = %v, %v; want the saga's payment", payments, err)
+		}
+		shipment, err := h.Clients.Shipping.GetShipment(ctx, &shippingpb.GetShipmentRequest{ShipmentId: state.ShipmentIDs[0]})
+		if err != nil {
+			t.Fatalf("GetShipment: %v", err)
+		}
+		shipments, err := h.Clients.Shipping.ListShipments(ctx, &shippingpb.ListShipmentsRequest{OrderId: state.OrderID})
+		if err != nil || len(shipments.GetShipments()) != 1 {
+			t.Fatalf("ListShipments = %v, %v; want the saga's shipment", shipments, err)
+		}
+		return map[string]record{
+			"GetOrder": order, "ListOrders": orders.GetOrders()[0],
+			"GetPayment": payment, "ListPayments": payments.GetPayments()[0],
+			"GetShipment": shipment, "ListShipments": shipments.GetShipments()[0],
+		}
+	}
+	check := func(when string, updated time.Time) {
+		t.Helper()
+		for rpc, r := range fetch() {
+			if got := r.GetCreatedAt().AsTime(); !got.Equal(start) {
+				t.Errorf("%s: %s created_at = %v, want %v", when, rpc, got, start)
+			}
+			if got := r.GetUpdatedAt().AsTime(); !got.Equal(updated) {
+				t.Errorf("%s: %s updated_at = %v, want %v", when, rpc, got, updated)
+			}
+		}
+	}
+	check("after the saga", start)
+
+	fake.Advance(30 * time.Minute)
+	if _, err := h.Orchestrator.ExecuteCancelOrderSaga(ctx, state.OrderID.GetId()); err != nil {
+		t.Fatalf("ExecuteCancelOrderSaga: %v", err)
+	}
+	check("after cancelling", start.Add(30*time.Minute))
+}
+
+// TestSagaTimeoutCompensates gives the saga a deadline that runs out while the
+// payment gateway is still charging: the saga fails at ProcessPayment with
+// DeadlineExceeded and, despite its context being done, undoes the order and
+// its shipments, marking both as cancelled by the timeout.
+func TestSagaTimeoutCompensates(t *testing.T) {
+	slowGateway := paymentservice.GatewayFunc(func(ctx context.Context, orderID string, info *commonpb.PaymentInfo) (string, error) {
+		select {
+		case <-time.After(time.Minute):
+			return "txn-" + orderID, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+	h := sagatest.New(t, sagatest.WithPaymentGateway(slowGateway))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	state, err := h.Run(ctx, "user-1")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("saga took %v, want it to give up at its deadline", elapsed)
+	}
+	var stepErr *orchestrator.StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != "ProcessPayment" || stepErr.Status.Code() != codes.DeadlineExceeded {
+		t.Fatalf("saga error = %v, want ProcessPayment to fail with DeadlineExceeded", err)
+	}
+	if errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Errorf("compensation failed: %v", err)
+	}
+
+	order, _ := h.Order.Lookup(context.Background(), state.OrderID.GetId())
+	if order.GetStatus() != orderpb.OrderStatus_CANCELLED || order.GetCancellationReason() != orchestrator.CancelReasonSagaTimeout || order.GetCancellationCause() != commonpb.CompensationCause_SAGA_TIMEOUT {
+		t.Errorf("order is %s (%q, %s), want CANCELLED by the saga timeout", order.GetStatus(), order.GetCancellationReason(), order.GetCancellationCause())
+	}
+	if len(state.ShipmentIDs) == 0 {
+		t.Fatal("saga reserved no shipment before paying")
+	}
+	for _, id := range state.ShipmentIDs {
+		shipment, _ := h.Shipping.Lookup(context.Background(), id)
+		if shipment.GetStatus() != shippingpb.ShippingStatus_CANCELLED || shipment.GetCancellationCause() != commonpb.CompensationCause_SAGA_TIMEOUT {
+			t.Errorf("shipment %s is %s (%s), want CANCELLED by the saga timeout", id, shipment.GetStatus(), shipment.GetCancellationCause())
+		}
+	}
+	for _, payment := range h.Payment.OrderPayments(context.Background(), state.OrderID.GetId()) {
+		if payment.GetStatus() == paymentpb.PaymentStatus_SUCCESS {
+			t.Errorf("payment %s was taken for a timed out saga", payment.GetId())
+		}
+	}
+}
+
+// TestSagaPartlyOutOfStock orders two products, one of them out of stock. The
+// Order service takes stock for all of an order's items or none, so the saga
+// fails at CreateOrder with the short product reported and nothing to
+// release: the other product's units are untouched and nothing was charged or
+// shipped.
+func TestSagaPartlyOutOfStock(t *testing.T) {
+	h := sagatest.New(t,
+		sagatest.WithOrderOptions(orderservice.WithStock(map[string]int64{"prod-A": 10, "prod-B": 0})),
+		sagatest.WithIDGenerator(ids.Derived()),
+	)
+	ctx := context.Background()
+	state, err := h.Run(ctx, "user-1")
+
+	var stepErr *orchestrator.StepError
+	if !errors.As(err, &stepErr) || !errors.Is(err, orchestrator.ErrCreateOrderFailed) || stepErr.Status.Code() != codes.FailedPrecondition {
+		t.Fatalf("saga error = %v, want CreateOrder failing with FailedPrecondition", err)
+	}
+	if stepErr.Info.GetReason() != errinfo.ReasonOutOfStock || stepErr.Info.GetMetadata()["product_ids"] != "prod-B" {
+		t.Errorf("error info = %v, want OUT_OF_STOCK for prod-B only", stepErr.Info)
+	}
+	var short []string
+	for _, detail := range stepErr.Status.Details() {
+		if shortage, ok := detail.(*orderpb.StockShortage); ok {
+			for _, item := range shortage.GetItems() {
+				short = append(short, fmt.Sprintf("%s:%d/%d", item.GetProductId(), item.GetAvailable(), item.GetRequested()))
+			}
+		}
+	}
+	if len(short) != 1 || short[0] != "prod-B:0/1" {
+		t.Errorf("stock shortage = %v, want [prod-B:0/1] (available/requested)", short)
+	}
+
+	if state.OrderID != nil {
+		t.Errorf("order %s was created without stock", state.OrderID.GetId())
+	}
+	if got := h.Order.Stock(ctx); got["prod-A"] != 10 || got["prod-B"] != 0 {
+		t.Errorf("stock after the failed saga = %v, want prod-A:10 prod-B:0", got)
+	}
+	// Derived IDs would have named the order after its user
+	if payments := h.Payment.OrderPayments(ctx, "order-user-1"); len(payments) != 0 {
+		t.Errorf("%d payment(s) taken for an order that was never created", len(payments))
+	}
+	if shipments := h.Shipping.OrderShipments(ctx, "order-user-1"); len(shipments) != 0 {
+		t.Errorf("%d shipment(s) reserved for an order that was never created", len(shipments))
+	}
+}
+
+func TestSagaAPIKeyAuth(t *testing.T) {
+	t.Run("valid key", func(t *testing.T) {
+		h := sagatest.New(t,
+			sagatest.WithServerAPIKeys("secret"),
+			sagatest.WithClientOptions(grpc_clients.WithAPIKey("secret")),
+		)
+		if _, err := h.Run(context.Background(), "user-1"); err != nil {
+			t.Fatalf("saga failed with a valid key: %v", err)
+		}
+	})
+	for name, opts := range map[string][]sagatest.Option{
+		"wrong key": {sagatest.WithServerAPIKeys("secret"), sagatest.WithClientOptions(grpc_clients.WithAPIKey("guess"))},
+		"no key":    {sagatest.WithServerAPIKeys("secret")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := sagatest.New(t, opts...)
+			state, err := h.Run(context.Background(), "user-1")
+			var stepErr *orchestrator.StepError
+			if !errors.As(err, &stepErr) || stepErr.Status.Code() != codes.Unauthenticated {
+				t.Fatalf("saga error = %v, want a step failing with Unauthenticated", err)
+			}
+			if state.OrderID != nil {
+				t.Errorf("order %s was created without valid credentials", state.OrderID.GetId())
+			}
+		})
+	}
+	t.Run("health and reflection exempt", func(t *testing.T) {
+		h := sagatest.New(t, sagatest.WithServerAPIKeys("secret"))
+		ctx := context.Background()
+		for _, service := range []string{grpc_clients.OrderService, grpc_clients.PaymentService, grpc_clients.ShippingService} {
+			if err := h.Clients.CheckHealth(ctx, service); err != nil {
+				t.Errorf("health check of %s without a key: %v", service, err)
+			}
+		}
+		if err := h.Clients.WaitReady(ctx); err != nil {
+			t.Errorf("WaitReady without a key: %v", err)
+		}
+
+		// The harness does not serve reflection, so check it on a server
+		// built the same way with reflection registered, as -reflection does
+		lis := bufconn.Listen(1 << 20)
+		s := server.NewGRPCServer(server.Config{Auth: interceptors.NewStaticKeys("secret")})
+		orderpb.RegisterOrderServiceServer(s, orderservice.NewServer())
+		reflection.Register(s)
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+		conn, err := grpc.NewClient("passthrough:///order",
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		)
+		if err != nil {
+			t.Fatalf("dialing: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		if err == nil {
+			err = stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+		}
+		var resp *reflectionpb.ServerReflectionResponse
+		if err == nil {
+			resp, err = stream.Recv()
+		}
+		if err != nil {
+			t.Fatalf("reflection without a key: %v", err)
+		}
+		var services []string
+		for _, svc := range resp.GetListServicesResponse().GetService() {
+			services = append(services, svc.GetName())
+		}
+		if !slices.Contains(services, orderpb.OrderService_ServiceDesc.ServiceName) {
+			t.Errorf("reflection listed %v, want the Order service", services)
+		}
+		if _, err := orderpb.NewOrderServiceClient(conn).GetOrder(ctx, &orderpb.GetOrderRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("GetOrder without a key = %v, want Unauthenticated", err)
+		}
+	})
+}
+
+// TestSimulatedLatencyDeadline slows every service well past the client's
+// deadline and checks each RPC fails with DeadlineExceeded once the deadline
+// fires, without waiting out the latency or changing anything.
+func TestSimulatedLatencyDeadline(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithLatency(5*time.Second))
+	for name, call := range map[string]func(context.Context) error{
+		"CreateOrder": func(ctx context.Context) error {
+			_, err := h.Clients.Order.CreateOrder(ctx, &orderpb.CreateOrderRequest{Details: sagatest.SampleOrder("user-1")})
+			return err
+		},
+		"ProcessPayment": func(ctx context.Context) error {
+			_, err := h.Clients.Payment.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: sagatest.SamplePayment()})
+			return err
+		},
+		"QuoteShipping": func(ctx context.Context) error {
+			_, err := h.Clients.Shipping.QuoteShipping(ctx, &shippingpb.QuoteShippingRequest{Address: sagatest.SampleAddress(), Items: sagatest.SampleOrder("user-1").GetItems()})
+			return err
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := call(ctx)
+		cancel()
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("%s = %v, want DeadlineExceeded", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s returned after %v, want soon after the 50ms deadline", name, elapsed)
+		}
+	}
+	if events := h.Order.OutboxEvents(); len(events) != 0 { // Every order is written with its event
+		t.Errorf("%d orders created by a call that timed out", len(events))
+	}
+	if payments := h.Payment.OrderPayments(context.Background(), "order-1"); len(payments) != 0 {
+		t.Errorf("%d payments taken by a call that timed out", len(payments))
+	}
+}
+
+// TestConcurrentSagas runs 100 sagas at once against one stack whose gateway
+// declines every third charge, then checks each saga left the services in
+// the state its outcome promises: completed sagas hold a COMPLETED order, one
+// successful payment and SHIPPED shipments; declined ones a CANCELLED order,
+// CANCELLED shipments and no successful payment.
+func TestConcurrentSagas(t *testing.T) {
+	var charges atomic.Int64
+	// Sequential IDs, as the default derives an order's ID from its user and
+	// each user places several orders here.
+	h := sagatest.New(t, sagatest.WithIDGenerator(ids.NewSequence()), sagatest.WithPaymentGateway(paymentservice.GatewayFunc(
+		func(_ context.Context, orderID string, _ *commonpb.PaymentInfo) (string, error) {
+			if charges.Add(1)%3 == 0 {
+				return "", paymentservice.ErrDeclined
+			}
+			return "txn-" + orderID, nil
+		})))
+
+	const n = 100
+	states := make([]*orchestrator.SagaState, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			states[i], errs[i] = h.Run(context.Background(), fmt.Sprintf("user-%d", i%10))
+		}()
+	}
+	wg.Wait()
+
+	ctx := context.Background()
+	sagaIDs, orderIDs := make(map[string]bool), make(map[string]bool)
+	completed := 0
+	for i, state := range states {
+		if state == nil || state.OrderID == nil {
+			t.Errorf("saga %d created no order: %v", i, errs[i])
+			continue
+		}
+		if sagaIDs[state.SagaID] || orderIDs[state.OrderID.GetId()] {
+			t.Errorf("saga %d reused saga ID %s or order ID %s", i, state.SagaID, state.OrderID.GetId())
+		}
+		sagaIDs[state.SagaID], orderIDs[state.OrderID.GetId()] = true, true
+		if len(state.ShipmentIDs) == 0 {
+			t.Errorf("saga %d reserved no shipment", i)
+		}
+
+		wantOrder, wantShipment, wantPaid := orderpb.OrderStatus_COMPLETED, shippingpb.ShippingStatus_SHIPPED, 1
+		switch {
+		case errs[i] == nil:
+			completed++
+		case errors.Is(errs[i], orchestrator.ErrPaymentFailed) && !errors.Is(errs[i], orchestrator.ErrCompensationFailed):
+			wantOrder, wantShipment, wantPaid = orderpb.OrderStatus_CANCELLED, shippingpb.ShippingStatus_CANCELLED, 0
+		default:
+			t.Errorf("saga %d (%s) failed: %v", i, state, errs[i])
+			continue
+		}
+		if got, _ := h.OrderStatus(state.OrderID.GetId()); got != wantOrder {
+			t.Errorf("saga %d (%s): order is %s, want %s", i, state, got, wantOrder)
+		}
+		for _, id := range state.ShipmentIDs {
+			if got, _ := h.ShipmentStatus(id); got != wantShipment {
+				t.Errorf("saga %d (%s): shipment %s is %s, want %s", i, state, id, got, wantShipment)
+			}
+		}
+		paid := 0
+		for _, payment := range h.Payment.OrderPayments(ctx, state.OrderID.GetId()) {
+			if payment.GetStatus() == paymentpb.PaymentStatus_SUCCESS {
+				paid++
+			}
+		}
+		if paid != wantPaid {
+			t.Errorf("saga %d (%s): %d successful payment(s), want %d", i, state, paid, wantPaid)
+		}
+	}
+	if declined := int(charges.Load()) / 3; completed != n-declined {
+		t.Errorf("%d sagas completed, want %d of %d with %d charges declined", completed, n-declined, n, declined)
+	}
+}
+
+// BenchmarkSaga runs whole sagas with the steps taken one after another and
+// with shipping reserved while the payment is taken. Every RPC is delayed by
+// a millisecond so the benchmark measures the saga's critical path rather
+// than in-process call overhead.
+func BenchmarkSaga(b *testing.B) {
+	for _, bc := range []struct {
+		name     string
+		parallel bool
+	}{
+		{"sequential", false},
+		{"parallel", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			h := sagatest.New(b,
+				sagatest.WithLatency(time.Millisecond),
+				sagatest.WithOrchestratorOptions(orchestrator.WithParallelSteps(bc.parallel)),
+			)
+			b.ResetTimer()
+			for range b.N {
+				if _, err := h.Run(context.Background(), "user-1"); err != nil {
+					b.Fatalf("saga failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCompensationNotFound runs compensations for records that do not
+// exist on every service from many goroutines at once. They only take the
+// read lock, so they proceed in parallel instead of queueing on the write lock.
+func BenchmarkCompensationNotFound(b *testing.B) {
+	h := sagatest.New(b)
+	ctx := context.Background()
+	orderID := &commonpb.OrderID{Id: "order-missing"}
+	for _, bc := range []struct {
+		name   string
+		cancel func() (*commonpb.CompensationResponse, error)
+	}{
+		{"CancelOrder", func() (*commonpb.CompensationResponse, error) {
+			return h.Order.CancelOrder(ctx, &orderpb.CancelOrderRequest{OrderId: orderID})
+		}},
+		{"RefundPayment", func() (*commonpb.CompensationResponse, error) {
+			return h.Payment.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{OrderId: orderID, PaymentId: "pay-missing"})
+		}},
+		{"CancelShipping", func() (*commonpb.CompensationResponse, error) {
+			return h.Shipping.CancelShipping(ctx, &shippingpb.CancelShippingRequest{OrderId: orderID, ShipmentId: "ship-missing"})
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					resp, err := bc.cancel()
+					if err != nil || resp.GetCode() != commonpb.CompensationCode_NOT_FOUND {
+						b.Errorf("%s of a missing record = %v, %v; want NOT_FOUND", bc.name, resp, err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// TestFailureAdminAtRuntime configures failure simulation through the
+// FailureAdmin service of Payment and Shipping over bufconn, and checks the
+// following ProcessPayment and ArrangeShipping calls, and a saga, obey it.
+func TestFailureAdminAtRuntime(t *testing.T) {
+	h := sagatest.New(t)
+	ctx := context.Background()
+	payments := h.FailureAdmin(t, grpc_clients.PaymentService)
+	shipping := h.FailureAdmin(t, grpc_clients.ShippingService)
+	pay := func() error {
+		_, err := h.Clients.Payment.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: sagatest.SamplePayment()})
+		return err
+	}
+	ship := func() error {
+		_, err := h.Clients.Shipping.ArrangeShipping(ctx, &shippingpb.ArrangeShippingRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, Address: sagatest.SampleAddress(), Items: sagatest.SampleOrder("user-1").GetItems()})
+		return err
+	}
+
+	want := &adminpb.FailureConfig{FailNextN: 2, ErrorCode: int32(codes.ResourceExhausted)}
+	got, err := payments.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{Config: want})
+	if err != nil || !proto.Equal(got, want) {
+		t.Fatalf("SetFailureConfig = %v, %v; want %v", got, err, want)
+	}
+	for i := range 2 {
+		if err := pay(); status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("ProcessPayment %d = %v, want ResourceExhausted", i+1, err)
+		}
+	}
+	if err := pay(); err != nil {
+		t.Fatalf("ProcessPayment after the failures ran out = %v", err)
+	}
+	if got, err := payments.GetFailureConfig(ctx, &adminpb.GetFailureConfigRequest{}); err != nil || got.GetFailNextN() != 0 || got.GetErrorCode() != want.ErrorCode {
+		t.Errorf("GetFailureConfig = %v, %v; want fail_next_n used up", got, err)
+	}
+	if _, err := payments.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{Config: &adminpb.FailureConfig{FailureRate: 1.5}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SetFailureConfig out of range = %v, want InvalidArgument", err)
+	}
+
+	if _, err := shipping.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{Config: &adminpb.FailureConfig{FailureRate: 1}}); err != nil {
+		t.Fatalf("SetFailureConfig on shipping: %v", err)
+	}
+	for range 3 { // Below the client circuit breaker threshold
+		if err := ship(); status.Code(err) != codes.Unavailable {
+			t.Fatalf("ArrangeShipping at rate 1 = %v, want Unavailable", err)
+		}
+	}
+	if err := pay(); err != nil {
+		t.Errorf("ProcessPayment with only shipping failing = %v", err)
+	}
+	if _, err := shipping.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{}); err != nil {
+		t.Fatalf("clearing the shipping config: %v", err)
+	}
+	if err := ship(); err != nil {
+		t.Errorf("ArrangeShipping after clearing = %v", err)
+	}
+
+	// Flipping Payment to always fail between sagas fails the next one
+	if _, err := payments.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{Config: &adminpb.FailureConfig{FailureRate: 1}}); err != nil {
+		t.Fatalf("SetFailureConfig: %v", err)
+	}
+	if _, err := h.Run(ctx, "user-1"); !errors.Is(err, orchestrator.ErrPaymentFailed) {
+		t.Errorf("saga with payments failing = %v, want ErrPaymentFailed", err)
+	}
+	if _, err := payments.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{}); err != nil {
+		t.Fatalf("clearing the payment config: %v", err)
+	}
+	if _, err := h.Run(ctx, "user-2"); err != nil {
+		t.Errorf("saga after clearing = %v", err)
+	}
+}
+
+// TestFailureAdminLatency slows services down through their FailureAdmin:
+// a delayed Order service only slows the saga, while a Payment service slower
+// than the saga's deadline fails ProcessPayment with DeadlineExceeded as soon
+// as the deadline passes, and the saga compensates.
+func TestFailureAdminLatency(t *testing.T) {
+	h := sagatest.New(t)
+	ctx := context.Background()
+	orders := h.FailureAdmin(t, grpc_clients.OrderService)
+	payments := h.FailureAdmin(t, grpc_clients.PaymentService)
+
+	if _, err := orders.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{Config: &adminpb.FailureConfig{LatencyMs: 50, LatencyMaxMs: 60}}); err != nil {
+		t.Fatalf("SetFailureConfig on order: %v", err)
+	}
+	start := time.Now()
+	if _, err := h.Clients.Order.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: &commonpb.OrderID{Id: "order-unknown"}}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetOrder of an unknown order = %v, want NotFound after the delay", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("GetOrder took %v, want at least the 50ms latency", elapsed)
+	}
+	start = time.Now()
+	if _, err := h.Run(ctx, "user-1"); err != nil {
+		t.Fatalf("saga with a slow Order service = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("saga took %v, want CreateOrder and CompleteOrder delayed by 50ms each", elapsed)
+	}
+	if _, err := orders.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{}); err != nil {
+		t.Fatalf("clearing the order config: %v", err)
+	}
+
+	if _, err := payments.SetFailureConfig(ctx, &adminpb.SetFailureConfigRequest{Config: &adminpb.FailureConfig{LatencyMs: 60_000}}); err != nil {
+		t.Fatalf("SetFailureConfig on payment: %v", err)
+	}
+	sagaCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	state, err := h.Run(sagaCtx, "user-2")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("saga took %v, want the payment delay cut short at its deadline", elapsed)
+	}
+	var stepErr *orchestrator.StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != "ProcessPayment" || stepErr.Status.Code() != codes.DeadlineExceeded {
+		t.Fatalf("saga error = %v, want ProcessPayment to fail with DeadlineExceeded", err)
+	}
+	if errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Errorf("compensation failed: %v", err)
+	}
+	if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("order is %s, want CANCELLED", got)
+	}
+	if payments := h.Payment.OrderPayments(ctx, state.OrderID.GetId()); len(payments) != 0 {
+		t.Errorf("payments %v were recorded behind the delay, want none", payments)
+	}
+}
+
+// TestSagaPendingCompletionSurvivesRestart makes CompleteOrder fail until the
+// saga queues the completion in a file store, then restarts the orchestrator
+// on the same store: its background retrier completes the order.
+func TestSagaPendingCompletionSurvivesRestart(t *testing.T) {
+	const completeOrder = "/order.OrderService/CompleteOrder"
+	var failures atomic.Int32
+	failures.Store(4) // The saga's three attempts and the first background one
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if method == completeOrder && failures.Add(-1) >= 0 {
+			return status.Error(codes.Unavailable, "order service restarting")
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	path := filepath.Join(t.TempDir(), "completions.jsonl")
+	store, err := orchestrator.NewFileCompletionStore(path)
+	if err != nil {
+		t.Fatalf("NewFileCompletionStore: %v", err)
+	}
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	once := grpc_clients.RetryPolicy{MaxAttempts: 1}
+	h := sagatest.New(t,
+		sagatest.WithClock(fake),
+		sagatest.WithClientOptions(
+			grpc_clients.WithServiceRetryConfig(grpc_clients.OrderService, grpc_clients.ServiceRetryConfig{Forward: once, Compensation: once}),
+			grpc_clients.WithDialOptions(grpc.WithChainUnaryInterceptor(failing)),
+		),
+		sagatest.WithOrchestratorOptions(orchestrator.WithCompletionStore(store)),
+	)
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	var state *orchestrator.SagaState
+	go func() {
+		var err error
+		state, err = h.Run(ctx, "user-1")
+		done <- err
+	}()
+	for waiting := true; waiting; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("saga failed: %v", err)
+			}
+			waiting = false
+		case <-time.After(time.Millisecond):
+			if fake.Waiters() > 0 {
+				fake.Advance(time.Second)
+			}
+		}
+	}
+	orderID := state.OrderID.GetId()
+	if got, _ := h.OrderStatus(orderID); got != orderpb.OrderStatus_PENDING {
+		t.Fatalf("order is %s after CompleteOrder kept failing, want PENDING", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Orchestrator.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/completions/pending", nil))
+	var pending []orchestrator.PendingCompletion
+	if err := json.Unmarshal(rec.Body.Bytes(), &pending); err != nil || len(pending) != 1 || pending[0].OrderID != orderID {
+		t.Fatalf("GET /completions/pending = %s (%v), want the saga's order", rec.Body, err)
+	}
+	h.Orchestrator.Close()
+
+	reopened, err := orchestrator.NewFileCompletionStore(path)
+	if err != nil {
+		t.Fatalf("reopening the completion store: %v", err)
+	}
+	restarted := orchestrator.NewOrchestrator(h.Clients, orchestrator.WithClock(fake), orchestrator.WithCompletionStore(reopened))
+	t.Cleanup(func() { restarted.Close() })
+	if pending, _ := restarted.PendingCompletions(); len(pending) != 1 || pending[0].OrderID != orderID {
+		t.Fatalf("pending completions after the restart = %+v, want the saga's order", pending)
+	}
+	retrierCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go restarted.RunCompletionRetrier(retrierCtx, time.Second)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got, _ := h.OrderStatus(orderID); got == orderpb.OrderStatus_COMPLETED {
+			break
+		}
+		if time.Now().After(deadline) {
+			pending, _ := restarted.PendingCompletions()
+			t.Fatalf("order never COMPLETED; pending completions: %+v", pending)
+		}
+		fake.Advance(time.Second)
+		time.Sleep(time.Millisecond)
+	}
+	if n := failures.Load(); n >= 0 {
+		t.Errorf("%d injected CompleteOrder failures unused, want the background retrier to have hit one", n+1)
+	}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		if pending, _ := restarted.PendingCompletions(); len(pending) == 0 {
+			return
+		}
+	}
+	pending, _ = restarted.PendingCompletions()
+	t.Errorf("pending completions after the order completed = %+v, want none", pending)
+}
+
+// TestSagaCompensationCancelReason checks the order a failed saga cancels
+// records the step that failed, and when it was cancelled.
+func TestSagaCompensationCancelReason(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		opt        sagatest.Option
+		wantReason string
+		wantCause  commonpb.CompensationCause
+	}{
+		{"payment", sagatest.WithPaymentFailure(), orchestrator.CancelReasonPaymentFailed, commonpb.CompensationCause_PAYMENT_FAILED},
+		{"shipping", sagatest.WithShippingFailure(), orchestrator.CancelReasonShippingFailed, commonpb.CompensationCause_SHIPPING_FAILED},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+			h := sagatest.New(t, tc.opt, sagatest.WithClock(fake))
+			ctx := context.Background()
+			state, err := h.Run(ctx, "user-1")
+			if err == nil {
+				t.Fatal("saga succeeded, want it to fail")
+			}
+			order, err := h.Clients.Order.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: state.OrderID})
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if order.GetStatus() != orderpb.OrderStatus_CANCELLED || order.GetCancellationReason() != tc.wantReason || order.GetCancellationCause() != tc.wantCause {
+				t.Errorf("order is %s (%q, %s), want CANCELLED for %q (%s)", order.GetStatus(), order.GetCancellationReason(), order.GetCancellationCause(), tc.wantReason, tc.wantCause)
+			}
+			if !order.GetCancelledAt().AsTime().Equal(fake.Now()) {
+				t.Errorf("cancelled at %v, want %v", order.GetCancelledAt().AsTime(), fake.Now())
+			}
+		})
+	}
+}
+
+// threeWarehouseOrder returns an order for userID of one product from each
+// of the warehouses east, west and north.
+func threeWarehouseOrder(userID string) *commonpb.OrderDetails {
+	details := sagatest.SampleOrder(userID)
+	details.Items = append(details.Items, &commonpb.Item{ProductId: "prod-C", Name: "Gizmo", Sku: "GIZ-C-003", WeightGrams: 500, Quantity: 1, Price: money.MustParse(money.DefaultCurrency, "5.00")})
+	return details
+}
+
+var threeWarehouses = map[string]string{"prod-A": "east", "prod-B": "west", "prod-C": "north"}
+
+// TestSagaWarehouseShipments ships an order from one, two and three
+// warehouses: the saga holds one shipment per warehouse and every one of them
+// is stored under the order and shipped.
+func TestSagaWarehouseShipments(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		warehouses map[string]string
+		want       []string
+	}{
+		{"one warehouse", map[string]string{"prod-A": "east", "prod-B": "east", "prod-C": "east"}, []string{"east"}},
+		{"two warehouses", map[string]string{"prod-A": "east", "prod-B": "west", "prod-C": "west"}, []string{"east", "west"}},
+		{"unmapped product", map[string]string{"prod-A": "east"}, []string{"east", shippingservice.DefaultWarehouse}},
+		{"three warehouses", threeWarehouses, []string{"east", "north", "west"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := sagatest.New(t, sagatest.WithWarehouses(tc.warehouses))
+			ctx := context.Background()
+			state, err := h.Orchestrator.RunCreateOrderSaga(ctx, threeWarehouseOrder("user-1"), sagatest.SamplePayment(), sagatest.SampleAddress())
+			if err != nil {
+				t.Fatalf("saga failed: %v", err)
+			}
+			if len(state.ShipmentIDs) != len(tc.want) {
+				t.Fatalf("saga holds shipments %v, want one per warehouse of %v", state.ShipmentIDs, tc.want)
+			}
+			listed, err := h.Clients.Shipping.ListShipments(ctx, &shippingpb.ListShipmentsRequest{OrderId: state.OrderID})
+			if err != nil {
+				t.Fatalf("ListShipments: %v", err)
+			}
+			var warehouses, ids []string
+			for _, shipment := range listed.GetShipments() {
+				warehouses = append(warehouses, shipment.GetWarehouse())
+				ids = append(ids, shipment.GetId())
+				if shipment.GetStatus() != shippingpb.ShippingStatus_SHIPPED {
+					t.Errorf("shipment %s from %s is %s, want SHIPPED", shipment.GetId(), shipment.GetWarehouse(), shipment.GetStatus())
+				}
+			}
+			slices.Sort(warehouses)
+			slices.Sort(ids)
+			if !slices.Equal(warehouses, slices.Sorted(slices.Values(tc.want))) {
+				t.Errorf("order ships from %v, want %v", warehouses, tc.want)
+			}
+			if !slices.Equal(ids, slices.Sorted(slices.Values(state.ShipmentIDs))) {
+				t.Errorf("order's shipments %v, want the saga's %v", ids, state.ShipmentIDs)
+			}
+		})
+	}
+}
+
+// TestSagaPartialShipmentCancelled makes each parcel fail half the time and
+// runs three-warehouse sagas until one fails after two of its three shipments
+// were created: both are cancelled along with the order.
+func TestSagaPartialShipmentCancelled(t *testing.T) {
+	once := grpc_clients.RetryPolicy{MaxAttempts: 1}
+	h := sagatest.New(t,
+		sagatest.WithWarehouses(threeWarehouses),
+		sagatest.WithShippingOptions(shippingservice.WithFailureRate(0.5)),
+		sagatest.WithClientOptions(
+			grpc_clients.WithServiceRetryConfig(grpc_clients.ShippingService, grpc_clients.ServiceRetryConfig{Forward: once, Compensation: grpc_clients.DefaultCompensationPolicy}),
+			grpc_clients.WithBreakerConfig(grpc_clients.ShippingService, grpc_clients.BreakerConfig{FailureThreshold: 1000}),
+		),
+	)
+	ctx := context.Background()
+	for i := range 200 {
+		state, err := h.Orchestrator.RunCreateOrderSaga(ctx, threeWarehouseOrder(fmt.Sprintf("user-%d", i)), sagatest.SamplePayment(), sagatest.SampleAddress())
+		if !errors.Is(err, orchestrator.ErrShippingFailed) {
+			continue
+		}
+		if errors.Is(err, orchestrator.ErrCompensationFailed) {
+			t.Fatalf("compensation failed: %v", err)
+		}
+		shipments := h.Shipping.OrderShipments(ctx, state.OrderID.GetId())
+		for _, shipment := range shipments {
+			if shipment.GetStatus() != shippingpb.ShippingStatus_CANCELLED {
+				t.Errorf("shipment %s from %s of a failed saga is %s, want CANCELLED", shipment.GetId(), shipment.GetWarehouse(), shipment.GetStatus())
+			}
+		}
+		if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+			t.Errorf("order of a failed saga is %s, want CANCELLED", got)
+		}
+		if len(shipments) == 2 {
+			return
+		}
+	}
+	t.Fatal("no saga failed after creating two of its three shipments")
+}
+
+// failConfirmShipping is a client interceptor failing every ConfirmShipping
+// call, after the saga has taken the payment.
+func failConfirmShipping(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if method == "/shipping.ShippingService/ConfirmShipping" {
+		return status.Error(codes.FailedPrecondition, "carrier rejected the pickup")
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// TestSagaCompensationCarriesCause fails ConfirmShipping after the payment was
+// taken: the order, the refund and the shipment all record shipping_failed
+// as the reason, with the SHIPPING_FAILED cause, and the Get and List RPCs
+// report it.
+func TestSagaCompensationCarriesCause(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithClientOptions(grpc_clients.WithDialOptions(grpc.WithChainUnaryInterceptor(failConfirmShipping))))
+	ctx := context.Background()
+	state, err := h.Run(ctx, "user-1")
+	if !errors.Is(err, orchestrator.ErrShippingFailed) || errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Fatalf("saga error = %v, want ErrShippingFailed with compensation succeeding", err)
+	}
+	const wantReason, wantCause = orchestrator.CancelReasonShippingFailed, commonpb.CompensationCause_SHIPPING_FAILED
+
+	order, err := h.Clients.Order.GetOrder(ctx, &orderpb.GetOrderRequest{OrderId: state.OrderID})
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if order.GetCancellationReason() != wantReason || order.GetCancellationCause() != wantCause {
+		t.Errorf("order cancelled for %q (%s), want %q (%s)", order.GetCancellationReason(), order.GetCancellationCause(), wantReason, wantCause)
+	}
+	history := order.GetStatusHistory()
+	if last := history[len(history)-1]; last.GetStatus() != orderpb.OrderStatus_CANCELLED || last.GetReason() != wantReason || last.GetCause() != wantCause {
+		t.Errorf("last order status change = %v, want CANCELLED for %q (%s)", last, wantReason, wantCause)
+	}
+
+	payments := h.Payment.OrderPayments(ctx, state.OrderID.GetId())
+	if len(payments) != 1 {
+		t.Fatalf("%d payments for the order, want 1", len(payments))
+	}
+	payment, err := h.Clients.Payment.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: payments[0].GetId()})
+	if err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	if payment.GetStatus() != paymentpb.PaymentStatus_REFUNDED || payment.GetRefundReason() != wantReason || payment.GetRefundCause() != wantCause {
+		t.Errorf("payment is %s, refunded for %q (%s), want REFUNDED for %q (%s)", payment.GetStatus(), payment.GetRefundReason(), payment.GetRefundCause(), wantReason, wantCause)
+	}
+	refunds, err := h.Clients.Payment.ListRefunds(ctx, &paymentpb.ListRefundsRequest{PaymentId: payment.GetId()})
+	if err != nil || len(refunds.GetRefunds()) != 1 {
+		t.Fatalf("ListRefunds = %v, %v; want one refund", refunds, err)
+	}
+	if refund := refunds.GetRefunds()[0]; refund.GetReason() != wantReason || refund.GetCause() != wantCause {
+		t.Errorf("refund recorded for %q (%s), want %q (%s)", refund.GetReason(), refund.GetCause(), wantReason, wantCause)
+	}
+
+	for _, id := range state.ShipmentIDs {
+		shipment, err := h.Clients.Shipping.GetShipment(ctx, &shippingpb.GetShipmentRequest{ShipmentId: id})
+		if err != nil {
+			t.Fatalf("GetShipment: %v", err)
+		}
+		if shipment.GetStatus() != shippingpb.ShippingStatus_CANCELLED || shipment.GetCancellationReason() != wantReason || shipment.GetCancellationCause() != wantCause {
+			t.Errorf("shipment %s is %s for %q (%s), want CANCELLED for %q (%s)", id, shipment.GetStatus(), shipment.GetCancellationReason(), shipment.GetCancellationCause(), wantReason, wantCause)
+		}
+	}
+}
+
+// TestSagaReceipt fetches the receipt of a saga's payment over gRPC: a
+// completed saga's lists the order's items and its shipping and totals the
+// charge, and one
+// compensated after ConfirmShipping failed ends with the refund as a
+// negative line and totals nothing.
+func TestSagaReceipt(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		opts       []sagatest.Option
+		wantRefund bool
+	}{
+		{"completed", nil, false},
+		{"refunded", []sagatest.Option{sagatest.WithClientOptions(grpc_clients.WithDialOptions(grpc.WithChainUnaryInterceptor(failConfirmShipping)))}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := sagatest.New(t, tc.opts...)
+			ctx := context.Background()
+			state, err := h.Run(ctx, "user-1")
+			if tc.wantRefund != (err != nil) {
+				t.Fatalf("saga error = %v", err)
+			}
+			payments := h.Payment.OrderPayments(ctx, state.OrderID.GetId())
+			if len(payments) != 1 {
+				t.Fatalf("%d payments for the order, want 1", len(payments))
+			}
+			receipt, err := h.Clients.Payment.GetReceipt(ctx, &paymentpb.GetReceiptRequest{PaymentId: payments[0].GetId()})
+			if err != nil {
+				t.Fatalf("GetReceipt: %v", err)
+			}
+
+			var got []string
+			for _, line := range receipt.GetLines() {
+				got = append(got, fmt.Sprintf("%s x%d %s", line.GetDescription(), line.GetQuantity(), money.Format(line.GetAmount())))
+			}
+			want := []string{"Widget x2 21.00 USD", "Gadget x1 25.00 USD", "Shipping, tax and other charges x0 5.00 USD"}
+			wantTotal := "51.00 USD"
+			if tc.wantRefund {
+				want = append(want, "Refund ("+orchestrator.CancelReasonShippingFailed+") x0 -51.00 USD")
+				wantTotal = "0.00 USD"
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("receipt lines = %q, want %q", got, want)
+			}
+			if money.Format(receipt.GetTotal()) != wantTotal || money.Format(receipt.GetCharged()) != "51.00 USD" {
+				t.Errorf("receipt charged %s totalling %s, want 51.00 USD totalling %s", money.Format(receipt.GetCharged()), money.Format(receipt.GetTotal()), wantTotal)
+			}
+			if receipt.GetOrderId().GetId() != state.OrderID.GetId() || !strings.Contains(receipt.GetText(), state.OrderID.GetId()) {
+				t.Errorf("receipt is for order %s, want %s; text:\n%s", receipt.GetOrderId().GetId(), state.OrderID.GetId(), receipt.GetText())
+			}
+		})
+	}
+}
+
+// TestSagaDuplicatePayment submits the same order twice under a payment
+// duplicate window: the second saga fails with ErrDuplicatePayment and is
+// compensated without charging, until it is resubmitted with the duplicate
+// allowed.
+func TestSagaDuplicatePayment(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithPaymentOptions(paymentservice.WithDuplicateWindow(time.Minute)))
+	ctx := context.Background()
+	if _, err := h.Run(ctx, "user-1"); err != nil {
+		t.Fatalf("first saga: %v", err)
+	}
+
+	state, err := h.Run(ctx, "user-1")
+	if !errors.Is(err, orchestrator.ErrDuplicatePayment) || !errors.Is(err, orchestrator.ErrPaymentFailed) || errors.Is(err, orchestrator.ErrCompensationFailed) {
+		t.Fatalf("second saga error = %v, want ErrDuplicatePayment and ErrPaymentFailed with compensation succeeding", err)
+	}
+	if got, _ := h.OrderStatus(state.OrderID.GetId()); got != orderpb.OrderStatus_CANCELLED {
+		t.Errorf("second order is %s, want CANCELLED", got)
+	}
+	for _, id := range state.ShipmentIDs {
+		if got, _ := h.ShipmentStatus(id); got != shippingpb.ShippingStatus_CANCELLED {
+			t.Errorf("shipment %s is %s, want CANCELLED", id, got)
+		}
+	}
+	payments := h.Payment.OrderPayments(ctx, state.OrderID.GetId())
+	if len(payments) != 1 || payments[0].GetStatus() != paymentpb.PaymentStatus_DUPLICATE_SUSPECTED {
+		t.Errorf("second order's payments = %v, want one DUPLICATE_SUSPECTED", payments)
+	}
+
+	state, err = h.Run(orchestrator.WithDuplicatePaymentAllowed(ctx), "user-1")
+	if err != nil {
+		t.Fatalf("saga with the duplicate allowed: %v", err)
+	}
+	if got, _ := h.PaymentStatus(state.PaymentID); got != paymentpb.PaymentStatus_SUCCESS {
+		t.Errorf("allowed duplicate payment is %s, want SUCCESS", got)
+	}
+}
+
+// TestSagaFailureReason makes every shipment fail over gRPC: the shipping
+// service's CARRIER_UNAVAILABLE reason, with the order and warehouse, reaches
+// the saga's StepError and its failed event.
+func TestSagaFailureReason(t *testing.T) {
+	h := sagatest.New(t, sagatest.WithShippingFailure())
+	state, err := h.Run(interceptors.WithSagaID(context.Background(), "saga-1"), "user-1")
+
+	var stepErr *orchestrator.StepError
+	if !errors.As(err, &stepErr) || !errors.Is(err, orchestrator.ErrShippingFailed) {
+		t.Fatalf("saga error = %v, want a shipping StepError", err)
+	}
+	info := stepErr.Info
+	if info.GetReason() != errinfo.ReasonCarrierUnavailable || info.GetDomain() != errinfo.DomainShipping ||
+		info.GetMetadata()["order_id"] != state.OrderID.GetId() || info.GetMetadata()["warehouse"] == "" {
+		t.Errorf("error info = %v, want %s from %s for order %s and its warehouse", info, errinfo.ReasonCarrierUnavailable, errinfo.DomainShipping, state.OrderID.GetId())
+	}
+
+	events, err := h.Orchestrator.ExportSaga("saga-1")
+	if err != nil {
+		t.Fatalf("ExportSaga: %v", err)
+	}
+	var reasons []string
+	for _, event := range events {
+		if event.Type == orchestrator.EventStepFailed {
+			reasons = append(reasons, event.Step+" "+event.Reason)
+		}
+	}
+	if want := []string{stepErr.Step + " " + errinfo.ReasonCarrierUnavailable}; !slices.Equal(reasons, want) {
+		t.Errorf("failed events = %q, want %q", reasons, want)
+	}
+}
+
+// TestSagaServiceInfo starts the stack with the version fields injected as
+// -ldflags would and connects an orchestrator the way its main does: every
+// service reports the injected version over GetInfo, each saga's
+// SAGA_STARTED audit entry lists the versions, and GET /info serves them.
+func TestSagaServiceInfo(t *testing.T) {
+	old := [3]string{buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime}
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = "v1.4.0", "1a2b3c4d5e6f", "2024-05-01T10:00:00Z"
+	t.Cleanup(func() { buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = old[0], old[1], old[2] })
+	h := sagatest.New(t)
+	ctx := context.Background()
+
+	infos, err := h.Clients.ServiceInfo(ctx)
+	if err != nil {
+		t.Fatalf("ServiceInfo: %v", err)
+	}
+	for _, service := range []string{grpc_clients.OrderService, grpc_clients.PaymentService, grpc_clients.ShippingService} {
+		info := infos[service]
+		if info.GetService() != service || info.GetVersion() != "v1.4.0" || info.GetCommit() != "1a2b3c4d5e6f" || info.GetBuildTime() != "2024-05-01T10:00:00Z" {
+			t.Errorf("%s info = %v, want the injected version", service, info)
+		}
+	}
+
+	orch := orchestrator.NewOrchestrator(h.Clients, orchestrator.WithServiceInfo(infos))
+	t.Cleanup(func() { orch.Close() })
+	if _, err := orch.RunCreateOrderSaga(interceptors.WithSagaID(ctx, "saga-1"), sagatest.SampleOrder("user-1"), sagatest.SamplePayment(), sagatest.SampleAddress()); err != nil {
+		t.Fatalf("saga: %v", err)
+	}
+	trail, err := orch.GetAuditTrail("saga-1")
+	if err != nil || len(trail) == 0 {
+		t.Fatalf("GetAuditTrail = %v, %v", trail, err)
+	}
+	const versions = "versions=order:v1.4.0@1a2b3c4d,payment:v1.4.0@1a2b3c4d,shipping:v1.4.0@1a2b3c4d"
+	if started := trail[0]; started.Type != orchestrator.AuditSagaStarted || !strings.Contains(started.Detail, versions) {
+		t.Errorf("first audit entry = %+v, want SAGA_STARTED with %q", started, versions)
+	}
+
+	w := httptest.NewRecorder()
+	orch.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/info", nil))
+	var body struct {
+		Orchestrator struct{ Version string }
+		Services     map[string]struct{ Version, Commit string }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("GET /info = %d, %v:\n%s", w.Code, err, w.Body)
+	}
+	if len(body.Services) != 3 || body.Services[grpc_clients.ShippingService].Version != "v1.4.0" || body.Orchestrator.Version != "v1.4.0" {
+		t.Errorf("GET /info = %s, want the orchestrator and all three services at v1.4.0", w.Body)
+	}
+}
+
+// TestSagaCompensationActor fails ConfirmShipping so that every compensation
+// runs over gRPC: each service reports the time it applied the compensation
+// and the actor the clients named, and the orchestrator audits both.
+func TestSagaCompensationActor(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		clientOpts []grpc_clients.Option
+		ctxActor   string // Named in the saga's context, overriding the clients'
+		wantActor  string
+	}{
+		{"default", nil, "", grpc_clients.DefaultActor},
+		{"client actor", []grpc_clients.Option{grpc_clients.WithActor("ops-console")}, "", "ops-console"},
+		{"context actor", nil, "support-agent", "support-agent"},
+		{"no actor", []grpc_clients.Option{grpc_clients.WithActor("")}, "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+			clientOpts := append([]grpc_clients.Option{grpc_clients.WithDialOptions(grpc.WithChainUnaryInterceptor(failConfirmShipping))}, tc.clientOpts...)
+			h := sagatest.New(t, sagatest.WithClock(clock.NewFake(now)), sagatest.WithClientOptions(clientOpts...))
+			ctx := interceptors.WithSagaID(context.Background(), "saga-1")
+			if tc.ctxActor != "" {
+				ctx = interceptors.WithActor(ctx, tc.ctxActor)
+			}
+			if _, err := h.Run(ctx, "user-1"); !errors.Is(err, orchestrator.ErrShippingFailed) || errors.Is(err, orchestrator.ErrCompensationFailed) {
+				t.Fatalf("saga error = %v, want ErrShippingFailed with compensation succeeding", err)
+			}
+
+			want := "compensated_at=" + now.Format(time.RFC3339Nano)
+			if tc.wantActor != "" {
+				want += " actor=" + tc.wantActor
+			}
+			trail, err := h.Orchestrator.GetAuditTrail("saga-1")
+			if err != nil {
+				t.Fatalf("GetAuditTrail: %v", err)
+			}
+			compensated := map[string]string{}
+			for _, entry := range trail {
+				if entry.Type == orchestrator.AuditCompensationSucceeded {
+					compensated[entry.Step] = entry.Detail
+				}
+			}
+			for _, step := range []string{"CancelShipping", "RefundPayment", "CancelOrder"} {
+				if got, ok := compensated[step]; !ok || !strings.HasSuffix(got, want) {
+					t.Errorf("%s audited as %q (found %t), want it to end %q", step, got, ok, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// Package server holds the boilerplate shared by the service binaries:
+// serving a gRPC server and shutting it down gracefully on SIGINT/SIGTERM.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/metrics"
+	"create-order-saga/pkg/validate"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+)
+
+// DefaultDrainTimeout is how long in-flight RPCs get to finish on shutdown.
+const DefaultDrainTimeout = 10 * time.Second
+
+// DefaultKeepaliveMinTime is the most frequent keepalive ping the services
+// accept by default, below grpc_clients.DefaultKeepalive's interval so the
+// orchestrator's pings keep idle connections open without being refused.
+const DefaultKeepaliveMinTime = 10 * time.Second
+
+// SignalContext returns a context that is cancelled on SIGINT or SIGTERM.
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// Config configures a saga service's gRPC server. The zero value keeps gRPC's
+// transport defaults and installs only the interceptors every service needs.
+type Config struct {
+	MaxRecvMsgSize       int           // Largest request accepted, in bytes; larger ones fail with ResourceExhausted (gRPC's 4 MiB if 0)
+	MaxSendMsgSize       int           // Largest response sent, in bytes (unlimited if 0)
+	MaxConcurrentStreams uint32        // Concurrent RPCs per client connection (unlimited if 0)
+	KeepaliveMinTime     time.Duration // Clients pinging more often than this are disconnected (gRPC's 5m if 0)
+	KeepaliveNoStream    bool          // Allow keepalive pings on connections without active RPCs
+	KeepaliveTime        time.Duration // Ping clients after this long without activity (gRPC's 2h if 0)
+	KeepaliveTimeout     time.Duration // Close the connection if a ping is not answered within this (gRPC's 20s if 0)
+
+	Metrics     *metrics.Registry              // Records every RPC (none if nil)
+	SlowRequest time.Duration                  // Logs RPCs taking at least this long (disabled if 0)
+	Auth        interceptors.Authenticator     // Authenticates every RPC except health checks (none if nil)
+	RateLimit   *interceptors.RateLimiter      // Limits each tenant's unary RPCs, refusing the excess with a retry hint (unlimited if nil)
+	Unary       []grpc.UnaryServerInterceptor  // Service-specific interceptors, e.g. chaos injection
+	Stream      []grpc.StreamServerInterceptor // Service-specific stream interceptors
+}
+
+// NewGRPCServer creates a gRPC server configured by cfg. It owns the
+// interceptor chain so every service runs it in the same order:
+//
+//  1. request/saga ID propagation
+//  2. tenant and actor extraction
+//  3. metrics, so rejected calls are counted too
+//  4. slow-request logging
+//  5. authentication
+//  6. rate limiting, so unauthenticated calls do not use up a tenant's rate
+//  7. cfg.Unary, in order
+//  8. rejection of requests missing required fields, so handlers never see them
+//
+// Stream RPCs run tenant extraction, authentication, cfg.Stream, then request
+// validation. opts
+// are applied last, for settings Config does not cover; they must not add
+// interceptors.
+func NewGRPCServer(cfg Config, opts ...grpc.ServerOption) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{
+		interceptors.RequestIDUnaryServerInterceptor(),
+		interceptors.TenantUnaryServerInterceptor(),
+		interceptors.ActorUnaryServerInterceptor(),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		interceptors.TenantStreamServerInterceptor(),
+	}
+	if cfg.Metrics != nil {
+		unary = append(unary, cfg.Metrics.UnaryServerInterceptor())
+	}
+	if cfg.SlowRequest > 0 {
+		unary = append(unary, interceptors.SlowRequestUnaryServerInterceptor(cfg.SlowRequest))
+	}
+	if cfg.Auth != nil {
+		unary = append(unary, interceptors.AuthUnaryServerInterceptor(cfg.Auth))
+		stream = append(stream, interceptors.AuthStreamServerInterceptor(cfg.Auth))
+	}
+	if cfg.RateLimit != nil {
+		unary = append(unary, interceptors.RateLimitUnaryServerInterceptor(cfg.RateLimit))
+	}
+	unary = append(unary, cfg.Unary...)
+	unary = append(unary, validate.UnaryServerInterceptor())
+	stream = append(stream, cfg.Stream...)
+	stream = append(stream, validate.StreamServerInterceptor())
+
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		serverOpts = append(serverOpts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+	if cfg.KeepaliveMinTime > 0 || cfg.KeepaliveNoStream {
+		serverOpts = append(serverOpts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.KeepaliveMinTime,
+			PermitWithoutStream: cfg.KeepaliveNoStream,
+		}))
+	}
+	if cfg.KeepaliveTime > 0 || cfg.KeepaliveTimeout > 0 {
+		serverOpts = append(serverOpts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}))
+	}
+	return grpc.NewServer(append(serverOpts, opts...)...)
+}
+
+// RegisterHealth registers the standard gRPC health service on s, reporting
+// SERVING for the server as a whole ("") and for each named service.
+func RegisterHealth(s *grpc.Server, services ...string) *health.Server {
+	hs := health.NewServer()
+	for _, service := range services {
+		hs.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(s, hs)
+	return hs
+}
+
+// PortInUseError reports that a service could not listen because another
+// process already holds its port.
+type PortInUseError struct {
+	Name string // Service that tried to listen, e.g. "Order Service"
+	Addr string
+	Err  error
+}
+
+func (e *PortInUseError) Error() string {
+	port := e.Addr
+	if _, p, err := net.SplitHostPort(e.Addr); err == nil {
+		port = p
+	}
+	return fmt.Sprintf("%s cannot listen on %s: port %s is already in use. "+
+		"Stop the process holding it (e.g. another instance of this service; see `lsof -i :%s`) or choose a different address",
+		e.Name, e.Addr, port, port)
+}
+
+func (e *PortInUseError) Unwrap() error { return e.Err }
+
+// Listen opens a TCP listener on addr for the named service. If the port is
+// taken it returns a *PortInUseError explaining how to resolve the conflict.
+func Listen(name, addr string) (net.Listener, error) {
+	lis, err := net.Listen("tcp", addr)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return nil, &PortInUseError{Name: name, Addr: addr, Err: err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s cannot listen on %s: %w", name, addr, err)
+	}
+	return lis, nil
+}
+
+// ListenHTTP serves h on addr in the background and returns a function that
+// shuts the HTTP server down, suitable as one of Serve's closers. An empty
+// addr disables the server and returns a no-op closer.
+func ListenHTTP(name, addr string, h http.Handler) (func() error, error) {
+	if addr == "" {
+		return func() error { return nil }, nil
+	}
+	lis, err := Listen(name, addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: h}
+	go func() {
+		log.Printf("%s listening at %v", name, lis.Addr())
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s stopped: %v", name, err)
+		}
+	}()
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}, nil
+}
+
+// Serve runs s on lis until ctx is done, then flips hs (if not nil) to
+// NOT_SERVING, stops accepting new RPCs and waits up to drainTimeout for
+// in-flight RPCs before forcing a Stop. The listener is closed by the gRPC
+// server. Any closers (e.g. repositories) are closed after the server has stopped.
+func Serve(ctx context.Context, name string, s *grpc.Server, hs *health.Server, lis net.Listener, drainTimeout time.Duration, closers ...func() error) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("%s listening at %v", name, lis.Addr())
+		serveErr <- s.Serve(lis)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// Serve returned without a shutdown request
+		return err
+	case <-ctx.Done():
+	}
+
+	if hs != nil {
+		// Tell load balancers and probes to stop routing new work here
+		hs.Shutdown()
+	}
+	log.Printf("%s shutting down: draining in-flight RPCs (timeout %v)", name, drainTimeout)
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		log.Printf("%s drained all in-flight RPCs", name)
+	case <-time.After(drainTimeout):
+		log.Printf("%s drain timeout exceeded, forcing stop", name)
+		s.Stop()
+		<-stopped
+	}
+
+	var errs []error
+	if err := <-serveErr; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		errs = append(errs, err)
+	}
+	for _, closeFn := range closers {
+		if err := closeFn(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	log.Printf("%s stopped", name)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,319 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	paymentservice "create-order-saga/internal/payment"
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/internal/server"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/metrics"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+const createOrder = "/order.OrderService/CreateOrder"
+
+// stubOrders answers CreateOrder, counting the calls that reach it.
+type stubOrders struct {
+	orderpb.UnimplementedOrderServiceServer
+	calls int
+}
+
+func (s *stubOrders) CreateOrder(context.Context, *orderpb.CreateOrderRequest) (*orderpb.CreateOrderResponse, error) {
+	s.calls++
+	return &orderpb.CreateOrderResponse{}, nil
+}
+
+// serve runs a server built by NewGRPCServer(cfg) on a bufconn listener and
+// returns a client for it along with the stub handling its calls.
+func serve(t *testing.T, cfg server.Config) (orderpb.OrderServiceClient, *stubOrders) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := server.NewGRPCServer(cfg)
+	stub := &stubOrders{}
+	orderpb.RegisterOrderServiceServer(s, stub)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///order",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return orderpb.NewOrderServiceClient(conn), stub
+}
+
+// validOrder is a CreateOrder request passing validation whose idempotency
+// key is padding bytes long.
+func validOrder(padding int) *orderpb.CreateOrderRequest {
+	return &orderpb.CreateOrderRequest{Details: &commonpb.OrderDetails{}, RequestId: strings.Repeat("x", padding)}
+}
+
+func TestOversizedRequestRejected(t *testing.T) {
+	client, stub := serve(t, server.Config{MaxRecvMsgSize: 1024})
+
+	if _, err := client.CreateOrder(context.Background(), validOrder(512)); err != nil {
+		t.Fatalf("request under the limit: %v", err)
+	}
+	_, err := client.CreateOrder(context.Background(), validOrder(2048))
+	if got := status.Code(err); got != codes.ResourceExhausted {
+		t.Errorf("request over the limit returned %v, want ResourceExhausted", err)
+	}
+	if stub.calls != 1 {
+		t.Errorf("handler ran %d times, want only for the request under the limit", stub.calls)
+	}
+}
+
+// TestInterceptorOrder pins the chain documented on NewGRPCServer by what
+// each stage can observe of the others.
+func TestInterceptorOrder(t *testing.T) {
+	var seen []string // Method-specific interceptor's view of each call that reaches it
+	observe := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		requestID, _ := interceptors.RequestIDFromContext(ctx)
+		seen = append(seen, requestID+"/"+interceptors.TenantFromContext(ctx))
+		return handler(ctx, req)
+	}
+	reg := metrics.NewRegistry()
+	client, stub := serve(t, server.Config{
+		Metrics:   reg,
+		Auth:      interceptors.NewStaticKeys("secret"),
+		RateLimit: interceptors.NewRateLimiter(0.001, 1, nil),
+		Unary:     []grpc.UnaryServerInterceptor{observe},
+	})
+	call := func(key string, req *orderpb.CreateOrderRequest) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			interceptors.RequestIDHeader, "req-1", interceptors.TenantHeader, "tenant-a")
+		if key != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, interceptors.APIKeyHeader, key)
+		}
+		_, err := client.CreateOrder(ctx, req)
+		return err
+	}
+
+	// Authentication runs before rate limiting: refused calls leave the
+	// tenant's single token for the authenticated one.
+	for range 3 {
+		if err := call("guess", validOrder(0)); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("call with a wrong key returned %v, want Unauthenticated", err)
+		}
+	}
+	if len(seen) != 0 {
+		t.Errorf("unauthenticated calls reached the method-specific interceptors: %v", seen)
+	}
+	// Validation runs after the method-specific interceptors, which see the
+	// request and tenant IDs extracted first.
+	if err := call("secret", &orderpb.CreateOrderRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("malformed request returned %v, want InvalidArgument", err)
+	}
+	if len(seen) != 1 || seen[0] != "req-1/tenant-a" {
+		t.Errorf("method-specific interceptors saw %v, want [req-1/tenant-a]", seen)
+	}
+	if stub.calls != 0 {
+		t.Errorf("handler ran for a malformed request")
+	}
+	// The malformed request used the tenant's token.
+	if err := call("secret", validOrder(0)); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("call over the rate limit returned %v, want ResourceExhausted", err)
+	}
+	// Metrics run before authentication, so refused calls are counted too.
+	for code, want := range map[codes.Code]uint64{codes.Unauthenticated: 3, codes.InvalidArgument: 1, codes.ResourceExhausted: 1} {
+		if got := reg.Handled(createOrder, code); got != want {
+			t.Errorf("metrics counted %d %s calls, want %d", got, code, want)
+		}
+	}
+}
+
+// TestServeHealthShutdown serves the health service over bufconn with Serve:
+// every registered service reports SERVING, and cancelling Serve's context
+// flips them to NOT_SERVING before the server drains.
+func TestServeHealthShutdown(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	s := server.NewGRPCServer(server.Config{})
+	service := orderpb.OrderService_ServiceDesc.ServiceName
+	hs := server.RegisterHealth(s, service)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, "order", s, hs, lis, 100*time.Millisecond) }()
+
+	conn, err := grpc.NewClient("passthrough:///order",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	for _, name := range []string{"", service} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+		if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Check(%q) = %v, %v; want SERVING", name, resp, err)
+		}
+	}
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "inventory.InventoryService"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Check of an unregistered service = %v, want NotFound", err)
+	}
+
+	watch, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if resp, err := watch.Recv(); err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("first Watch status = %v, %v; want SERVING", resp, err)
+	}
+	cancel()
+	if resp, err := watch.Recv(); err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Watch status after shutdown began = %v, %v; want NOT_SERVING", resp, err)
+	}
+	// The open Watch stream holds up the drain until the timeout forces a stop.
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after the drain timeout")
+	}
+}
+
+// TestServiceMetricsEndpoint wires a Payment service the way its main does,
+// with a metrics registry on the gRPC server and /metrics served by
+// ListenHTTP, and checks a call shows up in a scrape over HTTP.
+func TestServiceMetricsEndpoint(t *testing.T) {
+	reg := metrics.NewRegistry()
+	lis := bufconn.Listen(1 << 20)
+	s := server.NewGRPCServer(server.Config{Metrics: reg})
+	paymentpb.RegisterPaymentServiceServer(s, paymentservice.NewServer(paymentservice.WithFailureRate(0)))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///payment",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer conn.Close()
+
+	// Find a free port for the metrics server, as --metrics-addr would name one
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg)
+	closeMetrics, err := server.ListenHTTP("Payment Service metrics", addr, mux)
+	if err != nil {
+		t.Fatalf("ListenHTTP: %v", err)
+	}
+	defer closeMetrics()
+
+	const sample = `grpc_server_handled_total{grpc_method="/payment.PaymentService/ProcessPayment",grpc_code="OK"} `
+	scrape := func() string {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			t.Fatalf("scraping: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("scrape = %d, %v; want 200", resp.StatusCode, err)
+		}
+		return string(body)
+	}
+	if body := scrape(); strings.Contains(body, sample) {
+		t.Fatalf("ProcessPayment counted before any call:\n%s", body)
+	}
+	client := paymentpb.NewPaymentServiceClient(conn)
+	req := &paymentpb.ProcessPaymentRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, PaymentInfo: sagatest.SamplePayment()}
+	if _, err := client.ProcessPayment(context.Background(), req); err != nil {
+		t.Fatalf("ProcessPayment: %v", err)
+	}
+	if body := scrape(); !strings.Contains(body, sample+"1\n") {
+		t.Errorf("scrape after one ProcessPayment lacks %q1:\n%s", sample, body)
+	}
+}
+
+// readCounter is a connection counting the reads that return data.
+type readCounter struct {
+	net.Conn
+	reads *atomic.Int64
+}
+
+func (c readCounter) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.reads.Add(1)
+	}
+	return n, err
+}
+
+// TestServerKeepalivePings checks a server with KeepaliveTime set pings a
+// client that has gone idle, and one without it leaves the client alone.
+func TestServerKeepalivePings(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      server.Config
+		wantPing bool
+	}{
+		{"keepalive", server.Config{KeepaliveTime: time.Second, KeepaliveTimeout: time.Second}, true},
+		{"gRPC defaults", server.Config{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lis := bufconn.Listen(1 << 20)
+			s := server.NewGRPCServer(tc.cfg)
+			orderpb.RegisterOrderServiceServer(s, &stubOrders{})
+			go s.Serve(lis)
+			t.Cleanup(s.Stop)
+			var reads atomic.Int64
+			conn, err := grpc.NewClient("passthrough:///order",
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+					conn, err := lis.DialContext(ctx)
+					return readCounter{conn, &reads}, err
+				}),
+			)
+			if err != nil {
+				t.Fatalf("dialing: %v", err)
+			}
+			defer conn.Close()
+
+			if _, err := orderpb.NewOrderServiceClient(conn).CreateOrder(context.Background(), validOrder(0)); err != nil {
+				t.Fatalf("CreateOrder: %v", err)
+			}
+			time.Sleep(200 * time.Millisecond) // For the last frames of the call to arrive
+			before := reads.Load()
+			time.Sleep(1500 * time.Millisecond)
+			if pinged := reads.Load() > before; pinged != tc.wantPing {
+				t.Errorf("server sent something to the idle client: %t, want %t", pinged, tc.wantPing)
+			}
+			if state := conn.GetState(); state != connectivity.Ready {
+				t.Errorf("connection after idling is %s, want READY", state)
+			}
+		})
+	}
+}
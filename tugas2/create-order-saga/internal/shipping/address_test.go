@@ -0,0 +1,107 @@
+package shipping_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/sagatest"
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// addressWith returns SampleAddress changed by edit.
+func addressWith(edit func(a *commonpb.ShippingAddress)) *commonpb.ShippingAddress {
+	addr := sagatest.SampleAddress()
+	edit(addr)
+	return addr
+}
+
+// addressCases are addresses with the fields each must be refused for; none
+// means the address is complete.
+var addressCases = []struct {
+	name       string
+	addr       *commonpb.ShippingAddress
+	wantFields []string
+}{
+	{"complete", sagatest.SampleAddress(), nil},
+	{"missing address", nil, []string{"address"}},
+	{"empty address", &commonpb.ShippingAddress{}, []string{"address.street", "address.city", "address.zip_code", "address.country"}},
+	{"missing street", addressWith(func(a *commonpb.ShippingAddress) { a.Street = "" }), []string{"address.street"}},
+	{"blank city", addressWith(func(a *commonpb.ShippingAddress) { a.City = " \t" }), []string{"address.city"}},
+	{"missing country", addressWith(func(a *commonpb.ShippingAddress) { a.Country = "" }), []string{"address.country"}},
+	{"missing zip code", addressWith(func(a *commonpb.ShippingAddress) { a.ZipCode = "" }), []string{"address.zip_code"}},
+	{"no zip code where there are none", addressWith(func(a *commonpb.ShippingAddress) { a.Country, a.ZipCode = "HK", "" }), nil},
+	{"missing state where optional", addressWith(func(a *commonpb.ShippingAddress) { a.Country, a.State = "GB", "" }), nil},
+	{"missing state in the US", addressWith(func(a *commonpb.ShippingAddress) { a.Country, a.State = "US", "" }), []string{"address.state"}},
+	{"missing state in lower-case ca", addressWith(func(a *commonpb.ShippingAddress) { a.Country, a.State = " ca ", "" }), []string{"address.state"}},
+	{"missing street and city", addressWith(func(a *commonpb.ShippingAddress) { a.Street, a.City = "", "" }), []string{"address.street", "address.city"}},
+}
+
+// TestArrangeShippingAddress ships to each address case through
+// ArrangeShipping and ReserveShipping: incomplete addresses are refused with
+// InvalidArgument naming every missing field, before any shipment is created.
+func TestArrangeShippingAddress(t *testing.T) {
+	for _, tc := range addressCases {
+		for _, reserve := range []bool{false, true} {
+			name := tc.name + "/arrange"
+			if reserve {
+				name = tc.name + "/reserve"
+			}
+			t.Run(name, func(t *testing.T) {
+				s := newServer()
+				ctx := context.Background()
+				arrange := s.ArrangeShipping
+				if reserve {
+					arrange = s.ReserveShipping
+				}
+				req := arrangeRequest("order-1")
+				req.Address = tc.addr
+				resp, err := arrange(ctx, req)
+
+				if tc.wantFields == nil {
+					if err != nil || resp.GetShipmentId() == "" {
+						t.Fatalf("shipping to a complete address = %v, %v; want a shipment", resp, err)
+					}
+					return
+				}
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("shipping to %v = %v, %v; want InvalidArgument", tc.addr, resp, err)
+				}
+				for _, field := range tc.wantFields {
+					if !strings.Contains(status.Convert(err).Message(), field+":") {
+						t.Errorf("error %q does not name %s", status.Convert(err).Message(), field)
+					}
+				}
+				if shipments := s.OrderShipments(ctx, "order-1"); len(shipments) != 0 {
+					t.Errorf("shipments created = %v, want none", shipments)
+				}
+			})
+		}
+	}
+}
+
+// TestValidateShippingAddress checks ValidateShipping reports exactly the
+// fields ArrangeShipping refuses an address for.
+func TestValidateShippingAddress(t *testing.T) {
+	s := newServer()
+	for _, tc := range addressCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := s.ValidateShipping(context.Background(), &shippingpb.ValidateShippingRequest{Address: tc.addr})
+			if err != nil {
+				t.Fatalf("ValidateShipping: %v", err)
+			}
+			var fields []string
+			for _, v := range resp.GetViolations() {
+				fields = append(fields, v.GetField())
+			}
+			if resp.GetValid() != (tc.wantFields == nil) || !slices.Equal(fields, tc.wantFields) {
+				t.Errorf("ValidateShipping = %v, want violations of %q", resp, tc.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package shipping
+
+import (
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+)
+
+// carrier is a simulated shipping carrier that accepts parcels up to a weight.
+type carrier struct {
+	name         string
+	maxGrams     int64 // Heaviest parcel accepted; 0 means no limit
+	baseCents    int64 // Flat fee per parcel
+	perKiloCents int64 // Fee per started kilogram
+}
+
+// carriers are tried in order; the first one accepting the parcel's weight is used.
+var carriers = []carrier{
+	{name: "Parcel Post", maxGrams: 2000, baseCents: 500},
+	{name: "Ground Courier", maxGrams: 30000, baseCents: 800, perKiloCents: 50},
+	{name: "Freight", baseCents: 4000, perKiloCents: 30},
+}
+
+// itemsCurrency returns the currency the items are priced in, the currency
+// their shipping is charged in. Items without one, or with several, ship in
+// money.DefaultCurrency.
+func itemsCurrency(items []*commonpb.Item) string {
+	currency, err := money.ItemsCurrency(items)
+	if err != nil || money.ValidateCurrency(currency) != nil {
+		return money.DefaultCurrency
+	}
+	return currency
+}
+
+// parcelWeight returns the total weight of the items, ignoring negative weights and quantities.
+func parcelWeight(items []*commonpb.Item) int64 {
+	var grams int64
+	for _, item := range items {
+		if item.GetWeightGrams() > 0 && item.GetQuantity() > 0 {
+			grams += int64(item.GetWeightGrams()) * int64(item.GetQuantity())
+		}
+	}
+	return grams
+}
+
+// selectCarrier picks the carrier for a parcel and quotes its cost in
+// currency. Carriers charge the same amounts whatever the currency.
+func selectCarrier(grams int64, currency string) (string, *commonpb.Money) {
+	for _, c := range carriers {
+		if c.maxGrams == 0 || grams <= c.maxGrams {
+			kilos := (grams + 999) / 1000
+			return c.name, money.FromMinor(currency, c.baseCents+kilos*c.perKiloCents)
+		}
+	}
+	panic("shipping: no carrier accepts the parcel") // The last carrier has no limit
+}
@@ -0,0 +1,170 @@
+package shipping
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// manifestDateLayout is the layout of ExportManifestRequest.date.
+const manifestDateLayout = "2006-01-02"
+
+// manifestHeader names the columns of a manifest's CSV.
+var manifestHeader = []string{
+	"shipment_id", "order_id", "warehouse", "carrier", "status",
+	"street", "city", "state", "zip_code", "country",
+	"product_id", "sku", "name", "quantity",
+}
+
+// manifestFilter selects the shipments ExportManifest exports.
+type manifestFilter struct {
+	day      time.Time // Start of the UTC day shipments were created on; zero for any day
+	statuses map[shippingpb.ShippingStatus]bool
+}
+
+// parseManifestFilter checks the date and statuses of an ExportManifest
+// request. No statuses means every status but CANCELLED, which is refused.
+func parseManifestFilter(req *shippingpb.ExportManifestRequest) (manifestFilter, error) {
+	var f manifestFilter
+	if date := strings.TrimSpace(req.GetDate()); date != "" {
+		day, err := time.Parse(manifestDateLayout, date)
+		if err != nil {
+			return manifestFilter{}, status.Errorf(codes.InvalidArgument, "date %q is not a YYYY-MM-DD date", req.GetDate())
+		}
+		f.day = day
+	}
+	for _, st := range req.GetStatuses() {
+		if st == shippingpb.ShippingStatus_CANCELLED || st == shippingpb.ShippingStatus_SHIPPING_STATUS_UNSPECIFIED {
+			return manifestFilter{}, status.Errorf(codes.InvalidArgument, "status %s cannot be exported, manifests list shipments to pick", st)
+		}
+		if f.statuses == nil {
+			f.statuses = make(map[shippingpb.ShippingStatus]bool)
+		}
+		f.statuses[st] = true
+	}
+	return f, nil
+}
+
+// matches reports whether shipment belongs on a manifest filtered by f.
+func (f manifestFilter) matches(shipment *shippingpb.Shipment) bool {
+	if shipment.Status == shippingpb.ShippingStatus_CANCELLED {
+		return false
+	}
+	if f.statuses != nil && !f.statuses[shipment.Status] {
+		return false
+	}
+	if !f.day.IsZero() {
+		created := shipment.GetCreatedAt().AsTime()
+		if created.Before(f.day) || !created.Before(f.day.AddDate(0, 0, 1)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportManifest returns the shipments in the caller's tenant that are not
+// cancelled and match the request's filters, as a pick list for warehouse
+// staff. Entries are ordered by warehouse, then creation time, then shipment
+// ID, so the same shipments always export the same way.
+func (s *Server) ExportManifest(ctx context.Context, req *shippingpb.ExportManifestRequest) (*shippingpb.ManifestResponse, error) {
+	log.Printf("Received ExportManifest request for date: %q, statuses: %v", req.GetDate(), req.GetStatuses())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ExportManifest aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	f, err := parseManifestFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := interceptors.TenantFromContext(ctx)
+	var entries []*shippingpb.ManifestEntry
+	s.mu.RLock()
+	for key, shipment := range s.shipments {
+		if key.tenant != tenant || !f.matches(shipment) {
+			continue
+		}
+		entries = append(entries, manifestEntry(shipment))
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(entries, func(a, b *shippingpb.ManifestEntry) int {
+		if c := strings.Compare(a.Warehouse, b.Warehouse); c != 0 {
+			return c
+		}
+		if c := a.GetCreatedAt().AsTime().Compare(b.GetCreatedAt().AsTime()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ShipmentId, b.ShipmentId)
+	})
+
+	data, err := manifestCSV(entries)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "writing manifest CSV: %v", err)
+	}
+	log.Printf("Exported a manifest of %d shipment(s)", len(entries))
+	return &shippingpb.ManifestResponse{Entries: entries, Csv: data}, nil
+}
+
+// manifestEntry copies what a manifest lists of shipment. Caller holds s.mu.
+func manifestEntry(shipment *shippingpb.Shipment) *shippingpb.ManifestEntry {
+	entry := &shippingpb.ManifestEntry{
+		ShipmentId: shipment.Id,
+		OrderId:    proto.Clone(shipment.GetOrderId()).(*commonpb.OrderID),
+		Address:    proto.Clone(shipment.GetAddress()).(*commonpb.ShippingAddress),
+		Status:     shipment.Status,
+		Warehouse:  shipment.Warehouse,
+		Carrier:    shipment.Carrier,
+		CreatedAt:  shipment.CreatedAt,
+	}
+	for _, item := range shipment.Items {
+		entry.Items = append(entry.Items, proto.Clone(item).(*commonpb.Item))
+	}
+	return entry
+}
+
+// manifestCSV renders entries as CSV: a header row, then a row per item. A
+// shipment without items gets a single row with the item columns empty.
+func manifestCSV(entries []*shippingpb.ManifestEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(manifestHeader); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		addr := entry.GetAddress()
+		shipment := []string{
+			entry.ShipmentId, entry.GetOrderId().GetId(), entry.Warehouse, entry.Carrier, entry.Status.String(),
+			addr.GetStreet(), addr.GetCity(), addr.GetState(), addr.GetZipCode(), addr.GetCountry(),
+		}
+		if len(entry.Items) == 0 {
+			if err := w.Write(append(shipment, "", "", "", "")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, item := range entry.Items {
+			row := append(slices.Clip(shipment), item.ProductId, item.Sku, item.Name, strconv.Itoa(int(item.Quantity)))
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,158 @@
+package shipping_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/sagatest"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/ids"
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// manifestHeader is the header row of every manifest CSV.
+const manifestHeader = "shipment_id,order_id,warehouse,carrier,status,street,city,state,zip_code,country,product_id,sku,name,quantity\n"
+
+// csvRow renders the manifest CSV row expected for an item of a shipment to
+// street, the rest of the address being SampleAddress's.
+func csvRow(shipment *shippingpb.Shipment, street, product, sku, name string, quantity int) string {
+	return fmt.Sprintf("%s,%s,%s,%s,SHIPPED,%s,Orchestration City,Workflow,98765,GoLand,%s,%s,%s,%d\n",
+		shipment.GetId(), shipment.GetOrderId().GetId(), shipment.GetWarehouse(), shipment.GetCarrier(), street, product, sku, name, quantity)
+}
+
+// TestSagaManifest runs three sagas splitting their orders between the east
+// and west warehouses, two on May 1st and one on May 2nd with an address
+// needing CSV quoting, then cancels one shipment: a day's manifest lists the
+// day's other shipments by warehouse and creation time, with what to pick
+// for each, in the entries and the CSV alike.
+func TestSagaManifest(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	h := sagatest.New(t,
+		sagatest.WithClock(fake),
+		sagatest.WithIDGenerator(ids.NewSequence()),
+		sagatest.WithWarehouses(map[string]string{"prod-A": "east", "prod-B": "west"}),
+	)
+	ctx := context.Background()
+	const quotedStreet = `12 "Old" Mill Rd, Unit 4`
+	run := func(userID string, addr *commonpb.ShippingAddress) map[string]*shippingpb.Shipment {
+		t.Helper()
+		state, err := h.Orchestrator.RunCreateOrderSaga(ctx, sagatest.SampleOrder(userID), sagatest.SamplePayment(), addr)
+		if err != nil {
+			t.Fatalf("saga for %s: %v", userID, err)
+		}
+		byWarehouse := make(map[string]*shippingpb.Shipment)
+		for _, id := range state.ShipmentIDs {
+			shipment, _ := h.Shipping.Lookup(ctx, id)
+			byWarehouse[shipment.GetWarehouse()] = shipment
+		}
+		if len(byWarehouse) != 2 {
+			t.Fatalf("saga for %s shipped from %v, want east and west", userID, byWarehouse)
+		}
+		fake.Advance(time.Minute)
+		return byWarehouse
+	}
+	first := run("user-1", sagatest.SampleAddress())
+	second := run("user-2", sagatest.SampleAddress())
+	fake.Set(start.AddDate(0, 0, 1))
+	quoted := sagatest.SampleAddress()
+	quoted.Street = quotedStreet
+	third := run("user-3", quoted)
+	cancelled := second["east"]
+	if _, err := h.Clients.Shipping.CancelShipping(ctx, &shippingpb.CancelShippingRequest{OrderId: cancelled.GetOrderId(), ShipmentId: cancelled.GetId()}); err != nil {
+		t.Fatalf("CancelShipping: %v", err)
+	}
+
+	street := sagatest.SampleAddress().GetStreet()
+	for _, tc := range []struct {
+		name      string
+		req       *shippingpb.ExportManifestRequest
+		shipments []*shippingpb.Shipment
+		csv       string
+	}{
+		{
+			name:      "first day",
+			req:       &shippingpb.ExportManifestRequest{Date: "2024-05-01"},
+			shipments: []*shippingpb.Shipment{first["east"], first["west"], second["west"]},
+			csv: manifestHeader +
+				csvRow(first["east"], street, "prod-A", "WID-A-001", "Widget", 2) +
+				csvRow(first["west"], street, "prod-B", "GAD-B-002", "Gadget", 1) +
+				csvRow(second["west"], street, "prod-B", "GAD-B-002", "Gadget", 1),
+		},
+		{
+			name:      "second day",
+			req:       &shippingpb.ExportManifestRequest{Date: "2024-05-02", Statuses: []shippingpb.ShippingStatus{shippingpb.ShippingStatus_SHIPPED}},
+			shipments: []*shippingpb.Shipment{third["east"], third["west"]},
+			csv: manifestHeader +
+				csvRow(third["east"], `"12 ""Old"" Mill Rd, Unit 4"`, "prod-A", "WID-A-001", "Widget", 2) +
+				csvRow(third["west"], `"12 ""Old"" Mill Rd, Unit 4"`, "prod-B", "GAD-B-002", "Gadget", 1),
+		},
+		{
+			name:      "every day",
+			req:       &shippingpb.ExportManifestRequest{},
+			shipments: []*shippingpb.Shipment{first["east"], third["east"], first["west"], second["west"], third["west"]},
+		},
+		{
+			name: "empty day",
+			req:  &shippingpb.ExportManifestRequest{Date: "2024-04-30"},
+			csv:  manifestHeader,
+		},
+		{
+			name: "no shipment in the status",
+			req:  &shippingpb.ExportManifestRequest{Statuses: []shippingpb.ShippingStatus{shippingpb.ShippingStatus_DELIVERED}},
+			csv:  manifestHeader,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := h.Clients.Shipping.ExportManifest(ctx, tc.req)
+			if err != nil {
+				t.Fatalf("ExportManifest: %v", err)
+			}
+			var got, want []string
+			for _, entry := range resp.GetEntries() {
+				got = append(got, entry.GetShipmentId())
+			}
+			for _, shipment := range tc.shipments {
+				want = append(want, shipment.GetId())
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("manifest lists %v, want %v", got, want)
+			}
+			for i, entry := range resp.GetEntries() {
+				shipment := tc.shipments[i]
+				items := entry.GetItems()
+				if entry.GetOrderId().GetId() != shipment.GetOrderId().GetId() || entry.GetWarehouse() != shipment.GetWarehouse() ||
+					entry.GetAddress().GetStreet() != shipment.GetAddress().GetStreet() || entry.GetStatus() != shippingpb.ShippingStatus_SHIPPED ||
+					len(items) != 1 || items[0].GetProductId() != shipment.GetItems()[0].GetProductId() || items[0].GetQuantity() != shipment.GetItems()[0].GetQuantity() {
+					t.Errorf("entry %d = %v, want shipment %v", i, entry, shipment)
+				}
+			}
+			if tc.csv != "" && string(resp.GetCsv()) != tc.csv {
+				t.Errorf("CSV =\n%s\nwant\n%s", resp.GetCsv(), tc.csv)
+			}
+		})
+	}
+}
+
+// TestExportManifestRequests checks a malformed date and the CANCELLED or
+// unspecified status are refused with InvalidArgument.
+func TestExportManifestRequests(t *testing.T) {
+	s := newServer()
+	for _, req := range []*shippingpb.ExportManifestRequest{
+		{Date: "05/01/2024"},
+		{Date: "2024-02-30"},
+		{Statuses: []shippingpb.ShippingStatus{shippingpb.ShippingStatus_CANCELLED}},
+		{Statuses: []shippingpb.ShippingStatus{shippingpb.ShippingStatus_SHIPPED, shippingpb.ShippingStatus_SHIPPING_STATUS_UNSPECIFIED}},
+	} {
+		if _, err := s.ExportManifest(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("ExportManifest(%v) = %v, want InvalidArgument", req, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package shipping_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// confirmRequest confirms shipmentIDs of orderID.
+func confirmRequest(orderID string, shipmentIDs ...string) *shippingpb.ConfirmShippingRequest {
+	return &shippingpb.ConfirmShippingRequest{OrderId: &commonpb.OrderID{Id: orderID}, ShipmentIds: shipmentIDs}
+}
+
+// TestReserveThenConfirm reserves a shipment, which holds it without a
+// tracking number, then confirms it: it ships once, however often the
+// reservation or confirmation is repeated.
+func TestReserveThenConfirm(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	reserved, err := s.ReserveShipping(ctx, arrangeRequest("order-1"))
+	if err != nil {
+		t.Fatalf("ReserveShipping: %v", err)
+	}
+	id := reserved.GetShipmentId()
+	if shipment, _ := s.Lookup(ctx, id); reserved.GetStatus() != shippingpb.ShippingStatus_RESERVED || shipment.GetStatus() != shippingpb.ShippingStatus_RESERVED || shipment.GetTrackingNumber() != "" {
+		t.Fatalf("reserved shipment is %s (stored %s, tracking %q), want RESERVED without tracking", reserved.GetStatus(), shipment.GetStatus(), shipment.GetTrackingNumber())
+	}
+	again, err := s.ReserveShipping(ctx, arrangeRequest("order-1"))
+	if err != nil || again.GetShipmentId() != id {
+		t.Fatalf("repeated ReserveShipping = %v, %v; want shipment %s again", again, err, id)
+	}
+
+	confirmed, err := s.ConfirmShipping(ctx, confirmRequest("order-1", id))
+	if err != nil {
+		t.Fatalf("ConfirmShipping: %v", err)
+	}
+	shipment, _ := s.Lookup(ctx, id)
+	if confirmed.GetStatus() != shippingpb.ShippingStatus_SHIPPED || shipment.GetStatus() != shippingpb.ShippingStatus_SHIPPED || shipment.GetTrackingNumber() == "" {
+		t.Fatalf("confirmed shipment is %s (stored %s, tracking %q), want SHIPPED with tracking", confirmed.GetStatus(), shipment.GetStatus(), shipment.GetTrackingNumber())
+	}
+	if _, err := s.ConfirmShipping(ctx, confirmRequest("order-1", id)); err != nil {
+		t.Fatalf("repeated ConfirmShipping: %v", err)
+	}
+	if after, _ := s.Lookup(ctx, id); after.GetTrackingNumber() != shipment.GetTrackingNumber() {
+		t.Errorf("repeated ConfirmShipping changed the tracking number from %s to %s", shipment.GetTrackingNumber(), after.GetTrackingNumber())
+	}
+	if shipments := s.OrderShipments(ctx, "order-1"); len(shipments) != 1 {
+		t.Errorf("order has %d shipments, want 1", len(shipments))
+	}
+}
+
+// TestReserveThenCancel releases a reservation: the shipment is cancelled
+// without ever shipping, and can no longer be confirmed.
+func TestReserveThenCancel(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	reserved, err := s.ReserveShipping(ctx, arrangeRequest("order-1"))
+	if err != nil {
+		t.Fatalf("ReserveShipping: %v", err)
+	}
+	id := reserved.GetShipmentId()
+	resp, err := s.CancelShipping(ctx, &shippingpb.CancelShippingRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, ShipmentId: id})
+	if err != nil || !resp.GetSuccess() || resp.GetMessage() != "Shipping reservation released" {
+		t.Fatalf("CancelShipping = %v, %v; want the reservation released", resp, err)
+	}
+	shipment, _ := s.Lookup(ctx, id)
+	if shipment.GetStatus() != shippingpb.ShippingStatus_CANCELLED || shipment.GetTrackingNumber() != "" {
+		t.Errorf("released shipment is %s with tracking %q, want CANCELLED without tracking", shipment.GetStatus(), shipment.GetTrackingNumber())
+	}
+
+	_, err = s.ConfirmShipping(ctx, confirmRequest("order-1", id))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("ConfirmShipping of a released reservation = %v, want FailedPrecondition", err)
+	}
+	if shipment, _ := s.Lookup(ctx, id); shipment.GetStatus() != shippingpb.ShippingStatus_CANCELLED {
+		t.Errorf("released shipment is %s after a refused confirmation, want CANCELLED", shipment.GetStatus())
+	}
+}
+
+// TestConfirmShippingAllOrNothing refuses confirmations naming no shipment,
+// an unknown one or another order's, and confirms none of the shipments
+// listed alongside.
+func TestConfirmShippingAllOrNothing(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	mine, err := s.ReserveShipping(ctx, arrangeRequest("order-1"))
+	if err != nil {
+		t.Fatalf("ReserveShipping: %v", err)
+	}
+	theirs, err := s.ReserveShipping(ctx, arrangeRequest("order-2"))
+	if err != nil {
+		t.Fatalf("ReserveShipping: %v", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		ids      []string
+		wantCode codes.Code
+	}{
+		{"no shipments", nil, codes.InvalidArgument},
+		{"unknown shipment", []string{mine.GetShipmentId(), "ship-missing"}, codes.NotFound},
+		{"another order's", []string{mine.GetShipmentId(), theirs.GetShipmentId()}, codes.FailedPrecondition},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.ConfirmShipping(ctx, confirmRequest("order-1", tc.ids...))
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("ConfirmShipping = %v, want %v", err, tc.wantCode)
+			}
+			for _, id := range []string{mine.GetShipmentId(), theirs.GetShipmentId()} {
+				if shipment, _ := s.Lookup(ctx, id); shipment.GetStatus() != shippingpb.ShippingStatus_RESERVED {
+					t.Errorf("shipment %s is %s after a refused confirmation, want RESERVED", id, shipment.GetStatus())
+				}
+			}
+		})
+	}
+}
@@ -2,103 +2,474 @@ package shipping
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"math/rand" // For simulating success/failure
+	"slices"
+	"strings"
+	"time"
 
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/errinfo"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	"create-order-saga/pkg/money"
+	adminpb "create-order-saga/proto/admin"
 	commonpb "create-order-saga/proto/common"
 	shippingpb "create-order-saga/proto/shipping"
 	"sync"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// shipmentKey partitions stored shipments by tenant so IDs never collide across tenants.
+type shipmentKey struct {
+	tenant string
+	id     string
+}
+
+// keyFor builds the store key for a shipment ID using the caller's tenant.
+func keyFor(ctx context.Context, shipmentID string) shipmentKey {
+	return shipmentKey{tenant: interceptors.TenantFromContext(ctx), id: shipmentID}
+}
+
 // Server implements the ShippingServiceServer interface.
 type Server struct {
 	shippingpb.UnimplementedShippingServiceServer // Embed for forward compatibility
-	shipments                                     map[string]*shippingpb.Shipment
+	shipments                                     map[shipmentKey]*shippingpb.Shipment
+	byOrder                                       map[shipmentKey][]string                                    // Shipment IDs of each order, keyed by tenant and order ID
+	byTracking                                    map[string]shipmentKey                                      // Shipment of each tracking number, whatever its tenant
+	trackers                                      map[shipmentKey]map[chan *shippingpb.TrackingEvent]struct{} // TrackShipment streams of each shipment
+	warehouses                                    map[string]string                                           // Product ID -> warehouse stocking it
 	mu                                            sync.RWMutex
+	latency                                       simulation.Latency // Artificial delay applied to every RPC
+	failureRate                                   float64            // Probability in [0, 1] that arranging shipping fails
+	clock                                         clock.Clock
+	ids                                           ids.Generator
+	failures                                      *simulation.FailureSimulator // Runtime-configurable latency, and failures injected into ArrangeShipping and ReserveShipping
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithSimulatedLatency delays every RPC by a random duration in [min, max]
+// to exercise client timeouts and retries. Pass max <= min for a fixed delay.
+func WithSimulatedLatency(min, max time.Duration) Option {
+	return func(s *Server) {
+		s.latency = simulation.Latency{Min: min, Max: max}
+	}
+}
+
+// DefaultFailureRate is the probability that arranging shipping fails.
+const DefaultFailureRate = 0.2
+
+// WithFailureRate sets the probability in [0, 1] that arranging shipping
+// fails (DefaultFailureRate by default).
+func WithFailureRate(rate float64) Option {
+	return func(s *Server) {
+		s.failureRate = rate
+	}
+}
+
+// WithFailureSimulator injects latency into every RPC and failures into
+// ArrangeShipping and ReserveShipping as configured on f, e.g. through the FailureAdmin service. By default the server has its own
+// simulator that injects nothing until configured.
+func WithFailureSimulator(f *simulation.FailureSimulator) Option {
+	return func(s *Server) {
+		s.failures = f
+	}
+}
+
+// WithWarehouses sets the warehouse stocking each product ID. Items of one
+// order stocked in different warehouses ship separately; unmapped products
+// ship from DefaultWarehouse.
+func WithWarehouses(warehouses map[string]string) Option {
+	return func(s *Server) {
+		s.warehouses = warehouses
+	}
+}
+
+// WithIDGenerator sets how shipment IDs are generated (ids.Derived by default:
+// "ship-<order ID>", suffixed with the warehouse when an order ships from several).
+func WithIDGenerator(g ids.Generator) Option {
+	return func(s *Server) {
+		s.ids = g
+	}
+}
+
+// WithClock sets the clock used for time-dependent behaviour (the real clock by default).
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
 }
 
 // NewServer creates a new Shipping service server.
-func NewServer() *Server {
-	return &Server{
-		shipments: make(map[string]*shippingpb.Shipment),
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		clock:       clock.Real(),
+		ids:         ids.Derived(),
+		failureRate: DefaultFailureRate,
+		shipments:   make(map[shipmentKey]*shippingpb.Shipment),
+		byOrder:     make(map[shipmentKey][]string),
+		byTracking:  make(map[string]shipmentKey),
+		trackers:    make(map[shipmentKey]map[chan *shippingpb.TrackingEvent]struct{}),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.failures == nil {
+		s.failures = simulation.NewFailureSimulator(s.clock)
+	}
+	s.latency.Clock = s.clock
+	return s
 }
 
-// ArrangeShipping handles arranging shipping for an order.
-// Simulates success or failure.
+// FailureAdmin returns the FailureAdmin service controlling the latency
+// injected into every RPC and the failures injected into ArrangeShipping and
+// ReserveShipping, for registration on the server's gRPC server.
+func (s *Server) FailureAdmin() adminpb.FailureAdminServer {
+	return s.failures
+}
+
+// sleep simulates a slow service before an RPC is handled: the delay set by
+// WithSimulatedLatency, then any configured at runtime through the
+// FailureAdmin service. Either returns early with an error if ctx is done.
+func (s *Server) sleep(ctx context.Context) error {
+	if err := s.latency.Sleep(ctx); err != nil {
+		return err
+	}
+	return s.failures.Delay(ctx)
+}
+
+// Lookup returns a copy of the stored shipment in the caller's tenant, for
+// in-process inspection (e.g. end-to-end checks).
+func (s *Server) Lookup(ctx context.Context, shipmentID string) (*shippingpb.Shipment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	shipment, ok := s.shipments[keyFor(ctx, shipmentID)]
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(shipment).(*shippingpb.Shipment), true
+}
+
+// OrderShipments returns copies of the shipments created for an order in the
+// caller's tenant, in creation order, for in-process inspection.
+func (s *Server) OrderShipments(ctx context.Context, orderID string) []*shippingpb.Shipment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var shipments []*shippingpb.Shipment
+	for _, id := range s.byOrder[keyFor(ctx, orderID)] {
+		shipments = append(shipments, proto.Clone(s.shipments[keyFor(ctx, id)]).(*shippingpb.Shipment))
+	}
+	return shipments
+}
+
+// ArrangeShipping handles arranging shipping for an order, creating one
+// shipment per warehouse the items ship from. Simulates success or failure
+// per shipment: if a shipment fails after others were created, the error
+// carries a PartialShipmentFailure detail listing them so they can be cancelled.
+// Retries reuse shipments that were already created and not cancelled.
+// It is ReserveShipping and ConfirmShipping in one call.
 func (s *Server) ArrangeShipping(ctx context.Context, req *shippingpb.ArrangeShippingRequest) (*shippingpb.ArrangeShippingResponse, error) {
-	orderID := req.OrderId.Id
-	log.Printf("Received ArrangeShipping request for order ID: %s, Address: %s", orderID, req.Address.City)
+	orderID := req.GetOrderId().GetId()
+	log.Printf("Received ArrangeShipping request for order ID: %s, Address: %s", orderID, req.GetAddress().GetCity())
 
-	// 1. Generate a unique shipment ID
-	shipmentID := "ship-" + orderID // Replace with actual ID generation
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ArrangeShipping aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	reserved, err := s.reserve(ctx, req, "ArrangeShipping")
+	if err != nil {
+		return nil, err
+	}
+	return s.confirm(ctx, orderID, reserved.ShipmentIds)
+}
+
+// ReserveShipping holds carrier capacity for an order's shipments the way
+// ArrangeShipping creates them, leaving them RESERVED until ConfirmShipping
+// ships them or CancelShipping releases them.
+func (s *Server) ReserveShipping(ctx context.Context, req *shippingpb.ArrangeShippingRequest) (*shippingpb.ArrangeShippingResponse, error) {
+	log.Printf("Received ReserveShipping request for order ID: %s, Address: %s", req.GetOrderId().GetId(), req.GetAddress().GetCity())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ReserveShipping aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	return s.reserve(ctx, req, "ReserveShipping")
+}
+
+// ConfirmShipping ships an order's reserved shipments. Shipments that already
+// shipped are left as they are, so retries are safe. If any shipment is
+// unknown, belongs to another order or was cancelled (its reservation
+// released), nothing is confirmed.
+func (s *Server) ConfirmShipping(ctx context.Context, req *shippingpb.ConfirmShippingRequest) (*shippingpb.ArrangeShippingResponse, error) {
+	orderID := req.GetOrderId().GetId()
+	log.Printf("Received ConfirmShipping request for order ID: %s, Shipment IDs: %s", orderID, strings.Join(req.GetShipmentIds(), ", "))
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ConfirmShipping aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if len(req.GetShipmentIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "shipment IDs are required")
+	}
+	return s.confirm(ctx, orderID, req.GetShipmentIds())
+}
+
+// reserve creates the order's RESERVED shipments, one per warehouse parcel,
+// applying the failures injected into operation.
+func (s *Server) reserve(ctx context.Context, req *shippingpb.ArrangeShippingRequest, operation string) (*shippingpb.ArrangeShippingResponse, error) {
+	orderID := req.GetOrderId().GetId()
+
+	// Refuse to ship to an incomplete address before anything is arranged
+	if violations := validateAddress(req.GetAddress()); len(violations) > 0 {
+		log.Printf("%s for order %s refused: %s", operation, orderID, violationsString(violations))
+		return nil, addressError(violations)
+	}
+
+	// Apply any failure configured at runtime through the FailureAdmin service
+	if err := s.failures.Inject(ctx, operation); err != nil {
+		return nil, err
+	}
+
+	// 1. Split the order into one parcel per warehouse
+	parcels := splitByWarehouse(req.Items, s.warehouses)
+	var shipments []*shippingpb.Shipment
+	for _, p := range parcels {
+		shipment, err := s.arrangeParcel(ctx, req, p, len(parcels) > 1)
+		if err != nil {
+			return nil, s.partialFailure(ctx, orderID, err)
+		}
+		shipments = append(shipments, shipment)
+	}
+
+	// 2. Return response with RESERVED status
+	return shipmentsResponse(orderID, shippingpb.ShippingStatus_RESERVED, shipments)
+}
 
-	// 2. Simulate shipping arrangement (e.g., call a carrier API)
-	//    Randomly succeed or fail for demonstration purposes.
-	succeeded := rand.Intn(10) > 1 // 80% chance of success
+// confirm moves the order's RESERVED shipments to SHIPPED after checking that
+// every one of them can be, giving each a tracking number carriers report
+// updates under.
+func (s *Server) confirm(ctx context.Context, orderID string, shipmentIDs []string) (*shippingpb.ArrangeShippingResponse, error) {
+	s.mu.Lock()
+	shipments := make([]*shippingpb.Shipment, len(shipmentIDs))
+	keys := make([]shipmentKey, len(shipmentIDs))
+	for i, shipmentID := range shipmentIDs {
+		keys[i] = keyFor(ctx, shipmentID)
+		shipment, ok := s.shipments[keys[i]]
+		ids := map[string]string{"order_id": orderID, "shipment_id": shipmentID}
+		switch {
+		case !ok:
+			s.mu.Unlock()
+			return nil, errinfo.Errorf(codes.NotFound, errinfo.New(errinfo.DomainShipping, errinfo.ReasonShipmentNotFound, ids), "shipment %s not found", shipmentID)
+		case shipment.GetOrderId().GetId() != orderID:
+			s.mu.Unlock()
+			return nil, errinfo.Errorf(codes.FailedPrecondition, errinfo.New(errinfo.DomainShipping, errinfo.ReasonShipmentMismatch, ids), "shipment %s does not belong to order %s", shipmentID, orderID)
+		case shipment.Status == shippingpb.ShippingStatus_CANCELLED:
+			s.mu.Unlock()
+			return nil, errinfo.Errorf(codes.FailedPrecondition, errinfo.New(errinfo.DomainShipping, errinfo.ReasonShipmentCancelled, ids), "shipment %s was cancelled, its reservation is released", shipmentID)
+		}
+		shipments[i] = shipment
+	}
+	now := s.clock.Now()
+	for i, shipment := range shipments {
+		if shipment.Status == shippingpb.ShippingStatus_RESERVED {
+			shipment.Status = shippingpb.ShippingStatus_SHIPPED
+			shipment.UpdatedAt = timestamppb.New(now)
+			shipment.TrackingNumber = s.ids.NewID("trk", trackingKeyFor(keys[i]))
+			s.byTracking[shipment.TrackingNumber] = keys[i]
+			s.recordLocked(keys[i], shipment, EventShipped, now)
+		}
+		shipments[i] = proto.Clone(shipment).(*shippingpb.Shipment)
+	}
+	s.mu.Unlock()
+	log.Printf("Shipment(s) %s for order %s confirmed with status SHIPPED", strings.Join(shipmentIDs, ", "), orderID)
+	return shipmentsResponse(orderID, shippingpb.ShippingStatus_SHIPPED, shipments)
+}
+
+// shipmentsResponse summarises an order's shipments, totalling their cost.
+func shipmentsResponse(orderID string, st shippingpb.ShippingStatus, shipments []*shippingpb.Shipment) (*shippingpb.ArrangeShippingResponse, error) {
+	resp := &shippingpb.ArrangeShippingResponse{Status: st}
+	for _, shipment := range shipments {
+		var err error
+		if resp.ShipmentId == "" {
+			resp.ShipmentId = shipment.Id
+			resp.Carrier = shipment.Carrier
+			resp.Cost = shipment.Cost
+		} else if resp.Cost, err = money.Add(resp.Cost, shipment.Cost); err != nil {
+			return nil, status.Errorf(codes.Internal, "totalling shipping cost for order %s: %v", orderID, err)
+		}
+		resp.ShipmentIds = append(resp.ShipmentIds, shipment.Id)
+	}
+	return resp, nil
+}
+
+// arrangeParcel reserves the shipment for one warehouse's parcel, or returns the
+// existing one if a previous attempt already created it.
+func (s *Server) arrangeParcel(ctx context.Context, req *shippingpb.ArrangeShippingRequest, p parcel, split bool) (*shippingpb.Shipment, error) {
+	orderID := req.OrderId.Id
+	if existing, ok := s.activeShipment(ctx, orderID, p.warehouse); ok {
+		log.Printf("Shipment %s for order %s already arranged, reusing it", existing.Id, orderID)
+		return existing, nil
+	}
+
+	// Simulate shipping arrangement (e.g., call a carrier API)
+	// Randomly succeed or fail for demonstration purposes.
+	succeeded := rand.Float64() >= s.failureRate // 80% chance of success by default
 
 	if !succeeded {
-		log.Printf("Failed to arrange shipping for order %s (simulated failure)", orderID)
+		log.Printf("Failed to arrange shipping from %s for order %s (simulated failure)", p.warehouse, orderID)
 		// Return a gRPC error to signal failure to the orchestrator
-		return nil, status.Errorf(codes.Internal, "Failed to arrange shipping for order %s: Carrier unavailable", orderID)
+		info := errinfo.New(errinfo.DomainShipping, errinfo.ReasonCarrierUnavailable, map[string]string{"order_id": orderID, "warehouse": p.warehouse})
+		return nil, errinfo.Errorf(codes.Internal, info, "Failed to arrange shipping for order %s: Carrier unavailable", orderID)
 	}
 
-	// 3. Create and persist shipment record (in memory for now)
+	// Generate the shipment ID, then weigh the parcel to choose the carrier and its cost
+	shipmentID := s.ids.NewID("ship", shipmentKeyFor(orderID, p.warehouse, split))
+	weight := parcelWeight(p.items)
+	carrierName, cost := selectCarrier(weight, itemsCurrency(req.Items))
+
+	// Create and persist shipment record (in memory for now)
 	newShipment := &shippingpb.Shipment{
-		Id:      shipmentID,
-		OrderId: req.OrderId,
-		Address: req.Address,
-		Status:  shippingpb.ShippingStatus_PENDING, // Initial status
-		// TrackingNumber: // Get from carrier API if successful
+		Id:          shipmentID,
+		OrderId:     req.OrderId,
+		Address:     req.Address,
+		Status:      shippingpb.ShippingStatus_PENDING, // Initial status
+		WeightGrams: weight,
+		Carrier:     carrierName,
+		Cost:        cost,
+		Warehouse:   p.warehouse,
+		Items:       p.items,
+		// TrackingNumber is assigned when the shipment ships
 	}
-	// --- Modified Logic ---
-	// Set status directly to SHIPPED on success
-	newShipment.Status = shippingpb.ShippingStatus_SHIPPED
+	// Hold the carrier's capacity until the shipment is confirmed or cancelled
+	newShipment.Status = shippingpb.ShippingStatus_RESERVED
+	now := s.clock.Now()
+	newShipment.CreatedAt = timestamppb.New(now)
+	newShipment.UpdatedAt = timestamppb.New(now)
 
-	// Persist
+	// Persist, indexing the shipment under its order, unless a concurrent
+	// attempt arranged this parcel first
 	s.mu.Lock()
-	s.shipments[shipmentID] = newShipment
+	if existing, ok := s.activeShipmentLocked(ctx, orderID, p.warehouse); ok {
+		existing = proto.Clone(existing).(*shippingpb.Shipment)
+		s.mu.Unlock()
+		log.Printf("Shipment %s for order %s arranged concurrently, reusing it", existing.Id, orderID)
+		return existing, nil
+	}
+	s.shipments[keyFor(ctx, shipmentID)] = newShipment
+	orderKey := keyFor(ctx, orderID)
+	if !slices.Contains(s.byOrder[orderKey], shipmentID) {
+		s.byOrder[orderKey] = append(s.byOrder[orderKey], shipmentID)
+	}
 	s.mu.Unlock()
-	log.Printf("Shipment %s created and stored for order %s with status SHIPPED. Record: %+v", shipmentID, orderID, newShipment)
+	log.Printf("Shipment %s created and stored for order %s with status RESERVED", shipmentID, orderID)
+	log.Printf("DEBUG: Shipment record stored: %+v", newShipment)
+	return proto.Clone(newShipment).(*shippingpb.Shipment), nil
+}
 
-	// 4. Return response with SHIPPED status
-	return &shippingpb.ArrangeShippingResponse{
-		ShipmentId: shipmentID,
-		Status:     newShipment.Status, // Should be SHIPPED
-	}, nil
+// activeShipment returns a copy of the order's shipment from warehouse,
+// unless it was cancelled.
+func (s *Server) activeShipment(ctx context.Context, orderID, warehouse string) (*shippingpb.Shipment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	shipment, ok := s.activeShipmentLocked(ctx, orderID, warehouse)
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(shipment).(*shippingpb.Shipment), true
+}
+
+// activeShipmentLocked returns the order's stored shipment from warehouse,
+// unless it was cancelled. Caller holds s.mu.
+func (s *Server) activeShipmentLocked(ctx context.Context, orderID, warehouse string) (*shippingpb.Shipment, bool) {
+	for _, id := range s.byOrder[keyFor(ctx, orderID)] {
+		shipment := s.shipments[keyFor(ctx, id)]
+		if shipment.Warehouse == warehouse && shipment.Status != shippingpb.ShippingStatus_CANCELLED {
+			return shipment, true
+		}
+	}
+	return nil, false
+}
+
+// partialFailure attaches the order's shipments that are still active, if
+// any, to err as a PartialShipmentFailure detail.
+func (s *Server) partialFailure(ctx context.Context, orderID string, err error) error {
+	var created []string
+	for _, shipment := range s.OrderShipments(ctx, orderID) {
+		if shipment.Status != shippingpb.ShippingStatus_CANCELLED {
+			created = append(created, shipment.Id)
+		}
+	}
+	if len(created) == 0 {
+		return err
+	}
+	log.Printf("Arranging shipping for order %s failed after creating shipments %s", orderID, strings.Join(created, ", "))
+	st, detailErr := status.Convert(err).WithDetails(&shippingpb.PartialShipmentFailure{ShipmentIds: created})
+	if detailErr != nil {
+		return err
+	}
+	return st.Err()
 }
 
 // CancelShipping handles the compensation action for cancelling shipping.
 func (s *Server) CancelShipping(ctx context.Context, req *shippingpb.CancelShippingRequest) (*commonpb.CompensationResponse, error) {
 	orderID := req.OrderId.Id
 	shipmentID := req.ShipmentId
-	log.Printf("Received CancelShipping request for order ID: %s, Shipment ID: %s", orderID, shipmentID)
+	log.Printf("Received CancelShipping request for order ID: %s, Shipment ID: %s (reason: %q, cause: %s)", orderID, shipmentID, req.GetReason(), req.GetCause())
 
-	// 1. Find the shipment record (e.g., shipment, exists := s.shipments[shipmentID])
-	//    Ensure it belongs to the correct orderID.
-	// 1. Find the shipment record
-	s.mu.Lock()
-	shipment, exists := s.shipments[shipmentID]
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("CancelShipping aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	// 1. Find the shipment record (only within the caller's tenant)
+	//    Ensure it belongs to the correct orderID. Shipments are never removed
+	//    and keep their order, so both checks only need the read lock; the
+	//    write lock is only taken to change the shipment.
+	key := keyFor(ctx, shipmentID)
+	s.mu.RLock()
+	shipment, exists := s.shipments[key]
+	ownerID := shipment.GetOrderId().GetId()
+	s.mu.RUnlock()
 	if !exists {
-		s.mu.Unlock()
 		log.Printf("CancelShipping failed: Shipment %s not found", shipmentID)
-		return nil, status.Errorf(codes.NotFound, "Shipment %s not found", shipmentID)
+		return &commonpb.CompensationResponse{Message: fmt.Sprintf("Shipment %s not found", shipmentID), Code: commonpb.CompensationCode_NOT_FOUND}, nil
 	}
 	// Optional: Verify order ID
-	if shipment.OrderId.Id != orderID {
-		s.mu.Unlock()
+	if ownerID != orderID {
 		log.Printf("CancelShipping failed: Shipment %s does not belong to order %s", shipmentID, orderID)
-		return nil, status.Errorf(codes.InvalidArgument, "Shipment %s does not belong to order %s", shipmentID, orderID)
+		return &commonpb.CompensationResponse{Message: fmt.Sprintf("Shipment %s does not belong to order %s", shipmentID, orderID), Code: commonpb.CompensationCode_CONFLICT}, nil
 	}
+	s.mu.Lock()
+	shipment = s.shipments[key]
 
 	// 2. Check if cancellation is possible
 	if shipment.Status == shippingpb.ShippingStatus_CANCELLED {
+		cancelledAt := shipment.CancelledAt
 		s.mu.Unlock()
 		log.Printf("CancelShipping skipped: Shipment %s already cancelled", shipmentID)
-		return &commonpb.CompensationResponse{Success: true, Message: "Shipment already cancelled"}, nil
+		return &commonpb.CompensationResponse{
+			Success:        true,
+			Message:        "Shipment already cancelled",
+			AlreadyApplied: true,
+			Code:           commonpb.CompensationCode_ALREADY_DONE,
+			CompensatedAt:  cancelledAt,
+			Actor:          interceptors.ActorFromContext(ctx),
+		}, nil
 	}
 	// In a real system, you might prevent cancelling if already SHIPPED,
 	// but for this example, we allow setting to CANCELLED from SHIPPED.
@@ -111,23 +482,226 @@ func (s *Server) CancelShipping(ctx context.Context, req *shippingpb.CancelShipp
 	// 3. Perform cancellation action (simulation)
 	// Assume cancellation is successful for this example.
 
-	// 4. Update shipment status to CANCELLED
+	// 4. Update shipment status to CANCELLED, recording why and when. A
+	//    reserved shipment's carrier capacity is released with it.
+	released := shipment.Status == shippingpb.ShippingStatus_RESERVED
+	now := timestamppb.New(s.clock.Now())
 	shipment.Status = shippingpb.ShippingStatus_CANCELLED
+	shipment.UpdatedAt = now
+	shipment.CancelledAt = now
+	shipment.CancellationReason = req.GetReason()
+	shipment.CancellationCause = req.GetCause()
+	if shipment.TrackingNumber != "" {
+		// Let anyone tracking the shipped parcel know it is not coming
+		s.recordLocked(key, shipment, EventCancelled, now.AsTime())
+	}
 	s.mu.Unlock() // Unlock before logging
-	log.Printf("Shipment %s for order %s status updated to CANCELLED.", shipmentID, orderID)
+	log.Printf("Shipment %s for order %s status updated to CANCELLED (reservation released: %t).", shipmentID, orderID, released)
 
 	// 5. Return success response
+	message := "Shipping cancelled successfully"
+	if released {
+		message = "Shipping reservation released"
+	}
 	return &commonpb.CompensationResponse{
-		Success: true,
-		Message: "Shipping cancelled successfully",
+		Success:       true,
+		Message:       message,
+		Code:          commonpb.CompensationCode_COMPLETED,
+		CompensatedAt: now,
+		Actor:         interceptors.ActorFromContext(ctx),
 	}, nil
+}
 
-	// Example error handling:
-	// if !exists {
-	// 	return nil, status.Errorf(codes.NotFound, "Shipment %s not found", shipmentID)
-	// }
-	// if shipment.Status == shippingpb.ShippingStatus_SHIPPED {
-	//  return nil, status.Errorf(codes.FailedPrecondition, "Cannot cancel already shipped shipment %s", shipmentID)
-	// }
-	// return nil, status.Errorf(codes.Internal, "Failed to cancel shipment %s", shipmentID)
+// GetShipment returns a copy of a shipment in the caller's tenant.
+func (s *Server) GetShipment(ctx context.Context, req *shippingpb.GetShipmentRequest) (*shippingpb.Shipment, error) {
+	shipmentID := req.GetShipmentId()
+	log.Printf("Received GetShipment request for shipment ID: %s", shipmentID)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("GetShipment aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if shipmentID == "" {
+		return nil, status.Error(codes.InvalidArgument, "shipment ID is required")
+	}
+	shipment, ok := s.Lookup(ctx, shipmentID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "shipment %s not found", shipmentID)
+	}
+	return shipment, nil
+}
+
+// ListShipments returns the shipments arranged for an order in the caller's tenant.
+func (s *Server) ListShipments(ctx context.Context, req *shippingpb.ListShipmentsRequest) (*shippingpb.ListShipmentsResponse, error) {
+	orderID := req.GetOrderId().GetId()
+	log.Printf("Received ListShipments request for order ID: %s", orderID)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ListShipments aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if orderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "order ID is required")
+	}
+	return &shippingpb.ListShipmentsResponse{Shipments: s.OrderShipments(ctx, orderID)}, nil
+}
+
+// UpdateShippingAddress replaces the address of a shipment in the caller's
+// tenant that the carrier has not picked up yet, re-selecting its carrier and
+// cost, and keeps the replaced address in the shipment's address history. A
+// SHIPPED shipment has its label but waits for pickup, so it can still be
+// redirected. Shipments the carrier has, or that were cancelled, are refused
+// with codes.FailedPrecondition.
+func (s *Server) UpdateShippingAddress(ctx context.Context, req *shippingpb.UpdateShippingAddressRequest) (*shippingpb.Shipment, error) {
+	shipmentID := req.GetShipmentId()
+	log.Printf("Received UpdateShippingAddress request for shipment ID: %s, city: %s", shipmentID, req.GetAddress().GetCity())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("UpdateShippingAddress aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	if shipmentID == "" {
+		return nil, status.Error(codes.InvalidArgument, "shipment ID is required")
+	}
+	if violations := validateAddress(req.GetAddress()); len(violations) > 0 {
+		return nil, addressError(violations)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shipment, ok := s.shipments[keyFor(ctx, shipmentID)]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "shipment %s not found", shipmentID)
+	}
+	// Only a shipment the carrier has not picked up yet can be redirected
+	if !beforePickup(shipment.Status) {
+		log.Printf("UpdateShippingAddress failed: Shipment %s is %s", shipmentID, shipment.Status)
+		return nil, status.Errorf(codes.FailedPrecondition, "shipment %s is %s, the carrier has already picked it up", shipmentID, shipment.Status)
+	}
+
+	now := timestamppb.New(s.clock.Now())
+	shipment.AddressHistory = append(shipment.AddressHistory, &shippingpb.AddressChange{
+		PreviousAddress: shipment.Address,
+		ChangedAt:       now,
+	})
+	shipment.Address = proto.Clone(req.GetAddress()).(*commonpb.ShippingAddress)
+	shipment.Carrier, shipment.Cost = selectCarrier(shipment.WeightGrams, shipment.GetCost().GetCurrencyCode())
+	shipment.UpdatedAt = now
+	log.Printf("Shipment %s for order %s now ships to %s via %s", shipmentID, shipment.GetOrderId().GetId(), shipment.Address.City, shipment.Carrier)
+	return proto.Clone(shipment).(*shippingpb.Shipment), nil
+}
+
+// beforePickup reports whether a shipment in status st has not been handed to
+// the carrier yet: it is PENDING, RESERVED, or SHIPPED with a label but no
+// carrier scan. The carrier's first update moves it to IN_TRANSIT.
+func beforePickup(st shippingpb.ShippingStatus) bool {
+	switch st {
+	case shippingpb.ShippingStatus_PENDING, shippingpb.ShippingStatus_RESERVED, shippingpb.ShippingStatus_SHIPPED:
+		return true
+	}
+	return false
+}
+
+// ValidateShipping checks a shipping address the way ArrangeShipping would
+// receive it, without arranging or storing a shipment.
+func (s *Server) ValidateShipping(ctx context.Context, req *shippingpb.ValidateShippingRequest) (*commonpb.ValidationResponse, error) {
+	log.Printf("Received ValidateShipping request for city: %s", req.GetAddress().GetCity())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("ValidateShipping aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	violations := validateAddress(req.GetAddress())
+	return &commonpb.ValidationResponse{Valid: len(violations) == 0, Violations: violations}, nil
+}
+
+// noPostalCodes are the countries (ISO 3166-1 alpha-2) whose addresses have
+// no postal code, so the zip code may be left empty.
+var noPostalCodes = map[string]bool{
+	"AE": true, "AG": true, "AO": true, "BS": true, "BZ": true, "FJ": true,
+	"GH": true, "HK": true, "JM": true, "MO": true, "QA": true, "TT": true,
+	"UG": true, "ZW": true,
+}
+
+// statesRequired are the countries (ISO 3166-1 alpha-2) whose addresses must
+// name a state or province.
+var statesRequired = map[string]bool{"US": true, "CA": true, "AU": true}
+
+// validateAddress lists the required address fields that are empty. Street,
+// city and country are always required; the zip code unless the country has
+// no postal codes, and the state only where the country needs one.
+func validateAddress(addr *commonpb.ShippingAddress) []*commonpb.FieldViolation {
+	if addr == nil {
+		return []*commonpb.FieldViolation{{Field: "address", Description: "shipping address is missing"}}
+	}
+	country := strings.ToUpper(strings.TrimSpace(addr.Country))
+	var violations []*commonpb.FieldViolation
+	for _, f := range []struct {
+		name, value string
+		required    bool
+	}{
+		{"street", addr.Street, true},
+		{"city", addr.City, true},
+		{"state", addr.State, statesRequired[country]},
+		{"zip_code", addr.ZipCode, !noPostalCodes[country]},
+		{"country", addr.Country, true},
+	} {
+		if f.required && strings.TrimSpace(f.value) == "" {
+			violations = append(violations, &commonpb.FieldViolation{Field: "address." + f.name, Description: f.name + " is required"})
+		}
+	}
+	return violations
+}
+
+// addressError refuses an address with violations, naming every one.
+func addressError(violations []*commonpb.FieldViolation) error {
+	return status.Errorf(codes.InvalidArgument, "invalid shipping address: %s", violationsString(violations))
+}
+
+// violationsString lists violations for messages, e.g.
+// "address.city: city is required; address.country: country is required".
+func violationsString(violations []*commonpb.FieldViolation) string {
+	parts := make([]string, len(violations))
+	for i, v := range violations {
+		parts[i] = v.Field + ": " + v.Description
+	}
+	return strings.Join(parts, "; ")
+}
+
+// QuoteShipping prices shipping the items the way ArrangeShipping would (one
+// parcel per warehouse, each with the carrier its weight calls for) without
+// arranging anything, so the cost can be charged up front. The quote is in the
+// requested currency, or else the items'.
+func (s *Server) QuoteShipping(ctx context.Context, req *shippingpb.QuoteShippingRequest) (*shippingpb.QuoteShippingResponse, error) {
+	log.Printf("Received QuoteShipping request for %d item(s) to city: %s", len(req.GetItems()), req.GetAddress().GetCity())
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("QuoteShipping aborted during simulated latency: %v", err)
+		return nil, err
+	}
+
+	currency := req.GetCurrencyCode()
+	if currency == "" {
+		currency = itemsCurrency(req.GetItems())
+	} else if err := money.ValidateCurrency(currency); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "currency_code: %v", err)
+	}
+	total := money.New(currency, 0, 0)
+	for _, p := range splitByWarehouse(req.GetItems(), s.warehouses) {
+		_, cost := selectCarrier(parcelWeight(p.items), currency)
+		var err error
+		if total, err = money.Add(total, cost); err != nil {
+			return nil, status.Errorf(codes.Internal, "totalling shipping quote: %v", err)
+		}
+	}
+	return &shippingpb.QuoteShippingResponse{Cost: total}, nil
 }
@@ -0,0 +1,308 @@
+package shipping_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/internal/sagatest"
+	shippingservice "create-order-saga/internal/shipping"
+	"create-order-saga/pkg/ids"
+	"create-order-saga/pkg/interceptors"
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// newServer returns a Shipping server whose carriers always take the parcel.
+func newServer(opts ...shippingservice.Option) *shippingservice.Server {
+	return shippingservice.NewServer(append([]shippingservice.Option{shippingservice.WithFailureRate(0)}, opts...)...)
+}
+
+// arrangeRequest ships SampleOrder's items to SampleAddress for orderID.
+func arrangeRequest(orderID string) *shippingpb.ArrangeShippingRequest {
+	return &shippingpb.ArrangeShippingRequest{
+		OrderId: &commonpb.OrderID{Id: orderID},
+		Address: sagatest.SampleAddress(),
+		Items:   sagatest.SampleOrder("user-1").GetItems(),
+	}
+}
+
+// TestConcurrentArrangeCancelRead arranges shipments from many goroutines
+// while others cancel every other one and read them back; run with -race.
+func TestConcurrentArrangeCancelRead(t *testing.T) {
+	const n = 100
+	s := newServer(shippingservice.WithIDGenerator(ids.NewSequence()))
+	ctx := context.Background()
+
+	shipmentIDs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		orderID := fmt.Sprintf("order-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.ArrangeShipping(ctx, arrangeRequest(orderID))
+			if err != nil {
+				t.Errorf("ArrangeShipping %s: %v", orderID, err)
+				return
+			}
+			shipmentIDs[i] = resp.GetShipmentId()
+			if i%2 == 0 {
+				cancelled, err := s.CancelShipping(ctx, &shippingpb.CancelShippingRequest{OrderId: &commonpb.OrderID{Id: orderID}, ShipmentId: resp.GetShipmentId()})
+				if err != nil || !cancelled.GetSuccess() {
+					t.Errorf("CancelShipping %s = %v, %v", orderID, cancelled, err)
+				}
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.ListShipments(ctx, &shippingpb.ListShipmentsRequest{OrderId: &commonpb.OrderID{Id: orderID}}); err != nil {
+				t.Errorf("ListShipments: %v", err)
+			}
+			if _, err := s.ExportManifest(ctx, &shippingpb.ExportManifestRequest{}); err != nil {
+				t.Errorf("ExportManifest: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	for i, id := range shipmentIDs {
+		shipment, err := s.GetShipment(ctx, &shippingpb.GetShipmentRequest{ShipmentId: id})
+		if err != nil {
+			t.Fatalf("GetShipment %s: %v", id, err)
+		}
+		want := shippingpb.ShippingStatus_SHIPPED
+		if i%2 == 0 {
+			want = shippingpb.ShippingStatus_CANCELLED
+		}
+		if shipment.GetStatus() != want {
+			t.Errorf("shipment %s is %s, want %s", id, shipment.GetStatus(), want)
+		}
+	}
+	manifest, err := s.ExportManifest(ctx, &shippingpb.ExportManifestRequest{})
+	if err != nil {
+		t.Fatalf("ExportManifest: %v", err)
+	}
+	if got := len(manifest.GetEntries()); got != n/2 {
+		t.Errorf("manifest lists %d shipments, want %d", got, n/2)
+	}
+}
+
+// TestConcurrentArrangeSameOrder arranges shipping for one order from many
+// goroutines at once: they all get the same single shipment.
+func TestConcurrentArrangeSameOrder(t *testing.T) {
+	s := newServer(shippingservice.WithIDGenerator(ids.NewSequence()))
+	ctx := context.Background()
+
+	const n = 50
+	got := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.ArrangeShipping(ctx, arrangeRequest("order-1"))
+			if err != nil {
+				t.Errorf("ArrangeShipping: %v", err)
+				return
+			}
+			got[i] = resp.GetShipmentId()
+		}()
+	}
+	wg.Wait()
+	if shipments := s.OrderShipments(ctx, "order-1"); len(shipments) != 1 {
+		t.Fatalf("order has %d shipments, want 1", len(shipments))
+	}
+	for _, id := range got {
+		if id != got[0] {
+			t.Errorf("ArrangeShipping returned shipments %s and %s for one order", got[0], id)
+		}
+	}
+}
+
+// TestUpdateShippingAddressBeforePickup redirects a confirmed shipment that
+// waits for pickup, then is refused once the carrier reports it in transit.
+func TestUpdateShippingAddressBeforePickup(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	resp, err := s.ArrangeShipping(ctx, arrangeRequest("order-1"))
+	if err != nil {
+		t.Fatalf("ArrangeShipping: %v", err)
+	}
+	newAddr := sagatest.SampleAddress()
+	newAddr.City = "Compensation Town"
+
+	updated, err := s.UpdateShippingAddress(ctx, &shippingpb.UpdateShippingAddressRequest{ShipmentId: resp.GetShipmentId(), Address: newAddr})
+	if err != nil {
+		t.Fatalf("UpdateShippingAddress of a SHIPPED shipment awaiting pickup: %v", err)
+	}
+	if updated.GetAddress().GetCity() != "Compensation Town" {
+		t.Errorf("address city = %q, want Compensation Town", updated.GetAddress().GetCity())
+	}
+	if history := updated.GetAddressHistory(); len(history) != 1 || history[0].GetPreviousAddress().GetCity() != sagatest.SampleAddress().GetCity() {
+		t.Errorf("address history = %v, want the sample address replaced", history)
+	}
+
+	if _, _, err := s.ApplyCarrierEvent(updated.GetTrackingNumber(), "in_transit", time.Time{}); err != nil {
+		t.Fatalf("ApplyCarrierEvent: %v", err)
+	}
+	_, err = s.UpdateShippingAddress(ctx, &shippingpb.UpdateShippingAddressRequest{ShipmentId: resp.GetShipmentId(), Address: sagatest.SampleAddress()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("UpdateShippingAddress in transit = %v, want FailedPrecondition", err)
+	}
+	if got, _ := s.Lookup(ctx, resp.GetShipmentId()); got.GetAddress().GetCity() != "Compensation Town" {
+		t.Errorf("refused update changed the address to %q", got.GetAddress().GetCity())
+	}
+}
+
+// TestUpdateShippingAddressStates tries to redirect shipments in each state,
+// and with an invalid address: only shipments not yet picked up change, and a
+// refused update leaves the shipment as it was.
+func TestUpdateShippingAddressStates(t *testing.T) {
+	newAddr := sagatest.SampleAddress()
+	newAddr.City = "Compensation Town"
+	noCity := sagatest.SampleAddress()
+	noCity.City = " "
+	for _, tc := range []struct {
+		name     string
+		prepare  func(t *testing.T, s *shippingservice.Server, shipmentID string)
+		reserve  bool
+		addr     *commonpb.ShippingAddress
+		wantCode codes.Code
+	}{
+		{name: "reserved", reserve: true, addr: newAddr, wantCode: codes.OK},
+		{name: "shipped", addr: newAddr, wantCode: codes.OK},
+		{name: "cancelled", addr: newAddr, wantCode: codes.FailedPrecondition, prepare: func(t *testing.T, s *shippingservice.Server, shipmentID string) {
+			if _, err := s.CancelShipping(context.Background(), &shippingpb.CancelShippingRequest{OrderId: &commonpb.OrderID{Id: "order-1"}, ShipmentId: shipmentID}); err != nil {
+				t.Fatalf("CancelShipping: %v", err)
+			}
+		}},
+		{name: "delivered", addr: newAddr, wantCode: codes.FailedPrecondition, prepare: func(t *testing.T, s *shippingservice.Server, shipmentID string) {
+			shipment, _ := s.Lookup(context.Background(), shipmentID)
+			for _, event := range []string{"in_transit", "out_for_delivery", "delivered"} {
+				if _, _, err := s.ApplyCarrierEvent(shipment.GetTrackingNumber(), event, time.Time{}); err != nil {
+					t.Fatalf("ApplyCarrierEvent %q: %v", event, err)
+				}
+			}
+		}},
+		{name: "missing city", addr: noCity, wantCode: codes.InvalidArgument},
+		{name: "no address", wantCode: codes.InvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServer()
+			ctx := context.Background()
+			arrange := s.ArrangeShipping
+			if tc.reserve {
+				arrange = s.ReserveShipping
+			}
+			resp, err := arrange(ctx, arrangeRequest("order-1"))
+			if err != nil {
+				t.Fatalf("arranging the shipment: %v", err)
+			}
+			shipmentID := resp.GetShipmentId()
+			if tc.prepare != nil {
+				tc.prepare(t, s, shipmentID)
+			}
+			before, _ := s.Lookup(ctx, shipmentID)
+
+			updated, err := s.UpdateShippingAddress(ctx, &shippingpb.UpdateShippingAddressRequest{ShipmentId: shipmentID, Address: tc.addr})
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("UpdateShippingAddress = %v, want %v", err, tc.wantCode)
+			}
+			after, _ := s.Lookup(ctx, shipmentID)
+			if tc.wantCode != codes.OK {
+				if !proto.Equal(after, before) {
+					t.Errorf("refused update changed the shipment from %v to %v", before, after)
+				}
+				return
+			}
+			if updated.GetStatus() != before.GetStatus() || updated.GetAddress().GetCity() != "Compensation Town" || !proto.Equal(after, updated) {
+				t.Errorf("updated shipment = %v, want it %s and shipping to Compensation Town", updated, before.GetStatus())
+			}
+			if history := updated.GetAddressHistory(); len(history) != 1 || !proto.Equal(history[0].GetPreviousAddress(), sagatest.SampleAddress()) {
+				t.Errorf("address history = %v, want the sample address", history)
+			}
+		})
+	}
+
+	_, err := newServer().UpdateShippingAddress(context.Background(), &shippingpb.UpdateShippingAddressRequest{ShipmentId: "ship-missing", Address: newAddr})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateShippingAddress of a missing shipment = %v, want NotFound", err)
+	}
+}
+
+// TestTenantIsolation checks that another tenant can neither read nor cancel
+// a shipment, even knowing its ID.
+func TestTenantIsolation(t *testing.T) {
+	s := newServer()
+	tenantA := interceptors.WithTenant(context.Background(), "tenant-a")
+	tenantB := interceptors.WithTenant(context.Background(), "tenant-b")
+	arranged, err := s.ArrangeShipping(tenantA, arrangeRequest("order-1"))
+	if err != nil {
+		t.Fatalf("ArrangeShipping: %v", err)
+	}
+	orderID, shipmentID := &commonpb.OrderID{Id: "order-1"}, arranged.GetShipmentId()
+
+	if _, err := s.GetShipment(tenantB, &shippingpb.GetShipmentRequest{ShipmentId: shipmentID}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetShipment from another tenant returned %v, want NotFound", err)
+	}
+	if list, err := s.ListShipments(tenantB, &shippingpb.ListShipmentsRequest{OrderId: orderID}); err != nil || len(list.GetShipments()) != 0 {
+		t.Errorf("ListShipments from another tenant = %v, %v; want no shipments", list.GetShipments(), err)
+	}
+	resp, err := s.CancelShipping(tenantB, &shippingpb.CancelShippingRequest{OrderId: orderID, ShipmentId: shipmentID, Reason: "not mine"})
+	if err != nil || resp.GetSuccess() || resp.GetCode() != commonpb.CompensationCode_NOT_FOUND {
+		t.Errorf("CancelShipping from another tenant = %v, %v; want NOT_FOUND", resp, err)
+	}
+
+	shipment, err := s.GetShipment(tenantA, &shippingpb.GetShipmentRequest{ShipmentId: shipmentID})
+	if err != nil {
+		t.Fatalf("GetShipment from the owning tenant: %v", err)
+	}
+	if shipment.GetStatus() != shippingpb.ShippingStatus_SHIPPED {
+		t.Errorf("shipment is %s after another tenant's cancellation, want SHIPPED", shipment.GetStatus())
+	}
+}
+
+// TestCancelShippingCodes checks the CompensationCode CancelShipping answers
+// with as a shipment is cancelled and cancelled again; none is retryable.
+func TestCancelShippingCodes(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	arranged, err := s.ArrangeShipping(ctx, arrangeRequest("order-1"))
+	if err != nil {
+		t.Fatalf("ArrangeShipping: %v", err)
+	}
+	shipmentID := arranged.GetShipmentId()
+
+	for _, tc := range []struct {
+		name        string
+		orderID     string
+		shipmentID  string
+		wantCode    commonpb.CompensationCode
+		wantSuccess bool
+		wantApplied bool // AlreadyApplied
+	}{
+		{"unknown shipment", "order-1", "ship-404", commonpb.CompensationCode_NOT_FOUND, false, false},
+		{"another order's shipment", "order-9", shipmentID, commonpb.CompensationCode_CONFLICT, false, false},
+		{"first cancellation", "order-1", shipmentID, commonpb.CompensationCode_COMPLETED, true, false},
+		{"repeated cancellation", "order-1", shipmentID, commonpb.CompensationCode_ALREADY_DONE, true, true},
+	} {
+		resp, err := s.CancelShipping(ctx, &shippingpb.CancelShippingRequest{OrderId: &commonpb.OrderID{Id: tc.orderID}, ShipmentId: tc.shipmentID})
+		if err != nil {
+			t.Fatalf("%s: CancelShipping: %v", tc.name, err)
+		}
+		if resp.GetCode() != tc.wantCode || resp.GetSuccess() != tc.wantSuccess || resp.GetAlreadyApplied() != tc.wantApplied || resp.GetRetryable() {
+			t.Errorf("%s: CancelShipping = %v, want code %s, success %t, already applied %t, not retryable", tc.name, resp, tc.wantCode, tc.wantSuccess, tc.wantApplied)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package shipping
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// Tracking events recorded by the service itself rather than pushed by a carrier.
+const (
+	EventShipped   = "shipped"
+	EventCancelled = "cancelled"
+)
+
+// carrierEvents maps the events carriers push to the status they move a shipment to.
+var carrierEvents = map[string]shippingpb.ShippingStatus{
+	"in_transit":       shippingpb.ShippingStatus_IN_TRANSIT,
+	"out_for_delivery": shippingpb.ShippingStatus_OUT_FOR_DELIVERY,
+	"delivered":        shippingpb.ShippingStatus_DELIVERED,
+	"returned":         shippingpb.ShippingStatus_RETURNED,
+}
+
+// trackerBuffer is how many tracking events a TrackShipment stream may fall
+// behind by before it is dropped.
+const trackerBuffer = 16
+
+// Errors returned by ApplyCarrierEvent.
+var (
+	ErrUnknownTrackingNumber = errors.New("unknown tracking number")
+	ErrUnknownCarrierEvent   = errors.New("unknown carrier event")
+	ErrInvalidTransition     = errors.New("invalid status transition")
+)
+
+// trackingKeyFor returns the key a shipment's tracking number is derived
+// from. Carriers do not know tenants, so the number includes the tenant to
+// stay unique across them.
+func trackingKeyFor(key shipmentKey) string {
+	if key.tenant == "" {
+		return key.id
+	}
+	return key.tenant + "-" + key.id
+}
+
+// carrierTransitions lists the statuses a carrier update may move a shipment
+// on to from each status, forward only: a parcel is picked up, travels, goes
+// out for delivery and is delivered, or is returned once on its way. Repeated
+// in_transit scans at further hubs are recorded too.
+var carrierTransitions = map[shippingpb.ShippingStatus][]shippingpb.ShippingStatus{
+	shippingpb.ShippingStatus_SHIPPED:          {shippingpb.ShippingStatus_IN_TRANSIT},
+	shippingpb.ShippingStatus_IN_TRANSIT:       {shippingpb.ShippingStatus_IN_TRANSIT, shippingpb.ShippingStatus_OUT_FOR_DELIVERY, shippingpb.ShippingStatus_RETURNED},
+	shippingpb.ShippingStatus_OUT_FOR_DELIVERY: {shippingpb.ShippingStatus_DELIVERED, shippingpb.ShippingStatus_RETURNED},
+}
+
+// canTransition reports whether a carrier update may move a shipment from
+// status from to status to.
+func canTransition(from, to shippingpb.ShippingStatus) bool {
+	return slices.Contains(carrierTransitions[from], to)
+}
+
+// isFinal reports whether a shipment in status st will not change again.
+func isFinal(st shippingpb.ShippingStatus) bool {
+	switch st {
+	case shippingpb.ShippingStatus_DELIVERED, shippingpb.ShippingStatus_RETURNED, shippingpb.ShippingStatus_CANCELLED:
+		return true
+	}
+	return false
+}
+
+// recordLocked appends event to the shipment's tracking history and passes it
+// to the shipment's TrackShipment streams. A stream too far behind to take it
+// is closed and dropped rather than holding up the caller. Caller holds s.mu
+// for writing.
+func (s *Server) recordLocked(key shipmentKey, shipment *shippingpb.Shipment, event string, occurredAt time.Time) {
+	e := &shippingpb.TrackingEvent{
+		ShipmentId:     shipment.Id,
+		TrackingNumber: shipment.TrackingNumber,
+		Event:          event,
+		Status:         shipment.Status,
+		OccurredAt:     timestamppb.New(occurredAt),
+		RecordedAt:     timestamppb.New(s.clock.Now()),
+	}
+	shipment.TrackingHistory = append(shipment.TrackingHistory, e)
+	for ch := range s.trackers[key] {
+		select {
+		case ch <- proto.Clone(e).(*shippingpb.TrackingEvent):
+		default:
+			log.Printf("WARNING: Tracking stream for shipment %s fell behind, dropping it", shipment.Id)
+			close(ch)
+			delete(s.trackers[key], ch)
+		}
+	}
+	if isFinal(shipment.Status) {
+		// Nothing follows a final status: end the shipment's streams
+		for ch := range s.trackers[key] {
+			close(ch)
+		}
+		delete(s.trackers, key)
+	}
+}
+
+// ApplyCarrierEvent applies an update pushed by a carrier to the shipment with
+// trackingNumber, whatever its tenant, and records it in the shipment's
+// tracking history. Only the forward moves in carrierTransitions are applied;
+// others fail with ErrInvalidTransition. The same event reported again at the
+// same time is accepted without being recorded twice (duplicate is true).
+// occurredAt is the recording time if zero.
+func (s *Server) ApplyCarrierEvent(trackingNumber, event string, occurredAt time.Time) (shipment *shippingpb.Shipment, duplicate bool, err error) {
+	next, ok := carrierEvents[event]
+	if !ok {
+		return nil, false, fmt.Errorf("%w %q", ErrUnknownCarrierEvent, event)
+	}
+	if occurredAt.IsZero() {
+		occurredAt = s.clock.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byTracking[trackingNumber]
+	if !ok {
+		return nil, false, fmt.Errorf("%w %q", ErrUnknownTrackingNumber, trackingNumber)
+	}
+	stored := s.shipments[key]
+	if history := stored.TrackingHistory; len(history) > 0 {
+		last := history[len(history)-1]
+		if last.Event == event && last.OccurredAt.AsTime().Equal(occurredAt) {
+			return proto.Clone(stored).(*shippingpb.Shipment), true, nil
+		}
+	}
+	if !canTransition(stored.Status, next) {
+		return nil, false, fmt.Errorf("%w: shipment %s is %s, cannot move to %s on %q", ErrInvalidTransition, stored.Id, stored.Status, next, event)
+	}
+
+	stored.Status = next
+	stored.UpdatedAt = timestamppb.New(s.clock.Now())
+	s.recordLocked(key, stored, event, occurredAt)
+	log.Printf("Shipment %s for order %s is now %s (carrier event %q)", stored.Id, stored.GetOrderId().GetId(), next, event)
+	return proto.Clone(stored).(*shippingpb.Shipment), false, nil
+}
+
+// TrackShipment streams a shipment's tracking history in the caller's tenant,
+// then each new tracking event until the shipment reaches a final status or
+// the caller goes away.
+func (s *Server) TrackShipment(req *shippingpb.TrackShipmentRequest, stream shippingpb.ShippingService_TrackShipmentServer) error {
+	ctx := stream.Context()
+	shipmentID := req.GetShipmentId()
+	log.Printf("Received TrackShipment request for shipment ID: %s", shipmentID)
+
+	// Simulate a slow service, honouring the caller's deadline
+	if err := s.sleep(ctx); err != nil {
+		log.Printf("TrackShipment aborted during simulated latency: %v", err)
+		return err
+	}
+
+	if shipmentID == "" {
+		return status.Error(codes.InvalidArgument, "shipment ID is required")
+	}
+
+	// Take the history and register for what follows it in one go, so no
+	// event is missed or sent twice
+	key := keyFor(ctx, shipmentID)
+	s.mu.Lock()
+	shipment, ok := s.shipments[key]
+	if !ok {
+		s.mu.Unlock()
+		return status.Errorf(codes.NotFound, "shipment %s not found", shipmentID)
+	}
+	history := make([]*shippingpb.TrackingEvent, len(shipment.TrackingHistory))
+	for i, e := range shipment.TrackingHistory {
+		history[i] = proto.Clone(e).(*shippingpb.TrackingEvent)
+	}
+	var updates chan *shippingpb.TrackingEvent
+	if !isFinal(shipment.Status) {
+		updates = make(chan *shippingpb.TrackingEvent, trackerBuffer)
+		if s.trackers[key] == nil {
+			s.trackers[key] = make(map[chan *shippingpb.TrackingEvent]struct{})
+		}
+		s.trackers[key][updates] = struct{}{}
+	}
+	s.mu.Unlock()
+	if updates != nil {
+		defer s.stopTracking(key, updates)
+	}
+
+	for _, e := range history {
+		if err := stream.Send(e); err != nil {
+			return err
+		}
+	}
+	if updates == nil {
+		return nil
+	}
+	for {
+		select {
+		case e, ok := <-updates:
+			if !ok {
+				if isFinal(s.trackedStatus(key)) {
+					return nil
+				}
+				return status.Errorf(codes.ResourceExhausted, "tracking stream for shipment %s fell behind", shipmentID)
+			}
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// stopTracking unregisters a TrackShipment stream, unless it was already dropped.
+func (s *Server) stopTracking(key shipmentKey, updates chan *shippingpb.TrackingEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.trackers[key][updates]; ok {
+		delete(s.trackers[key], updates)
+		if len(s.trackers[key]) == 0 {
+			delete(s.trackers, key)
+		}
+	}
+}
+
+// trackedStatus returns the current status of the shipment stored under key.
+func (s *Server) trackedStatus(key shipmentKey) shippingpb.ShippingStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.shipments[key].GetStatus()
+}
+
+// carrierUpdate is the JSON body carriers post to the webhook. Timestamp is
+// RFC 3339 and optional.
+type carrierUpdate struct {
+	TrackingNumber string `json:"tracking_number"`
+	Event          string `json:"event"`
+	Timestamp      string `json:"timestamp"`
+}
+
+// carrierUpdateResult is the webhook's JSON response.
+type carrierUpdateResult struct {
+	ShipmentID string `json:"shipment_id"`
+	Status     string `json:"status"`
+	Duplicate  bool   `json:"duplicate"`
+}
+
+// maxCarrierUpdateBytes caps the webhook's request body.
+const maxCarrierUpdateBytes = 64 << 10
+
+// CarrierSignatureHeader carries the signature of a carrier update: "sha256="
+// and the hex HMAC-SHA256 of the body under the secret shared with carriers.
+const CarrierSignatureHeader = "X-Carrier-Signature"
+
+// SignCarrierUpdate returns the CarrierSignatureHeader value of an update body.
+func SignCarrierUpdate(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CarrierWebhookHandler returns the HTTP handler carriers push tracking
+// updates to, serving POST /carrier/webhook with a JSON body of
+// tracking_number, event (in_transit, out_for_delivery, delivered or
+// returned) and timestamp. Tracking numbers are easy to guess, so every
+// update must be signed under secret (see SignCarrierUpdate); unsigned or
+// badly signed ones get 401, and with an empty secret every update does. It
+// responds 404 for unknown tracking numbers and 409 for updates the
+// shipment's status does not allow.
+func (s *Server) CarrierWebhookHandler(secret string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /carrier/webhook", func(w http.ResponseWriter, r *http.Request) {
+		s.handleCarrierWebhook(w, r, secret)
+	})
+	return mux
+}
+
+func (s *Server) handleCarrierWebhook(w http.ResponseWriter, r *http.Request, secret string) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCarrierUpdateBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading carrier update: %v", err), http.StatusBadRequest)
+		return
+	}
+	signature := r.Header.Get(CarrierSignatureHeader)
+	if secret == "" || !hmac.Equal([]byte(signature), []byte(SignCarrierUpdate(secret, body))) {
+		log.Printf("Carrier update from %s refused: missing or invalid signature", r.RemoteAddr)
+		http.Error(w, "missing or invalid "+CarrierSignatureHeader, http.StatusUnauthorized)
+		return
+	}
+	var update carrierUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		http.Error(w, fmt.Sprintf("invalid carrier update: %v", err), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Received carrier update %q for tracking number %s", update.Event, update.TrackingNumber)
+	if update.TrackingNumber == "" || update.Event == "" {
+		http.Error(w, "tracking_number and event are required", http.StatusBadRequest)
+		return
+	}
+	var occurredAt time.Time
+	if update.Timestamp != "" {
+		var err error
+		if occurredAt, err = time.Parse(time.RFC3339, update.Timestamp); err != nil {
+			http.Error(w, fmt.Sprintf("invalid timestamp %q: want RFC 3339", update.Timestamp), http.StatusBadRequest)
+			return
+		}
+	}
+
+	shipment, duplicate, err := s.ApplyCarrierEvent(update.TrackingNumber, update.Event, occurredAt)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrUnknownCarrierEvent):
+			code = http.StatusBadRequest
+		case errors.Is(err, ErrUnknownTrackingNumber):
+			code = http.StatusNotFound
+		case errors.Is(err, ErrInvalidTransition):
+			code = http.StatusConflict
+		}
+		log.Printf("Carrier update %q for tracking number %s refused: %v", update.Event, update.TrackingNumber, err)
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(carrierUpdateResult{ShipmentID: shipment.Id, Status: shipment.Status.String(), Duplicate: duplicate}); err != nil {
+		log.Printf("WARNING: Writing carrier update response: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package shipping_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	shippingservice "create-order-saga/internal/shipping"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+const carrierSecret = "carrier-secret"
+
+// shipped arranges shipping for orderID and returns the tracking number of
+// its shipment.
+func shipped(t *testing.T, s *shippingservice.Server, orderID string) string {
+	t.Helper()
+	resp, err := s.ArrangeShipping(context.Background(), arrangeRequest(orderID))
+	if err != nil {
+		t.Fatalf("ArrangeShipping: %v", err)
+	}
+	shipment, _ := s.Lookup(context.Background(), resp.GetShipmentId())
+	return shipment.GetTrackingNumber()
+}
+
+// postCarrierUpdate posts body to the carrier webhook with the given
+// signature header, if any, and returns the response code.
+func postCarrierUpdate(t *testing.T, h http.Handler, body, signature string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/carrier/webhook", strings.NewReader(body))
+	if signature != "" {
+		req.Header.Set(shippingservice.CarrierSignatureHeader, signature)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestCarrierWebhookRequiresSignature(t *testing.T) {
+	s := newServer()
+	trackingNumber := shipped(t, s, "order-1")
+	body := `{"tracking_number":"` + trackingNumber + `","event":"in_transit"}`
+
+	for _, tc := range []struct {
+		name      string
+		secret    string
+		signature string
+		want      int
+	}{
+		{"unsigned", carrierSecret, "", http.StatusUnauthorized},
+		{"wrong secret", carrierSecret, shippingservice.SignCarrierUpdate("guess", []byte(body)), http.StatusUnauthorized},
+		{"no secret configured", "", shippingservice.SignCarrierUpdate("", []byte(body)), http.StatusUnauthorized},
+		{"signed", carrierSecret, shippingservice.SignCarrierUpdate(carrierSecret, []byte(body)), http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := postCarrierUpdate(t, s.CarrierWebhookHandler(tc.secret), body, tc.signature); got != tc.want {
+				t.Errorf("webhook answered %d, want %d", got, tc.want)
+			}
+		})
+	}
+	shipment, _ := s.Lookup(context.Background(), "ship-order-1")
+	if got := shipment.GetStatus(); got != shippingpb.ShippingStatus_IN_TRANSIT {
+		t.Errorf("shipment is %s, want IN_TRANSIT after the one signed update", got)
+	}
+}
+
+func TestCarrierWebhookRefusesOutOfOrderEvents(t *testing.T) {
+	post := func(t *testing.T, s *shippingservice.Server, trackingNumber, event string) int {
+		t.Helper()
+		body := `{"tracking_number":"` + trackingNumber + `","event":"` + event + `"}`
+		return postCarrierUpdate(t, s.CarrierWebhookHandler(carrierSecret), body, shippingservice.SignCarrierUpdate(carrierSecret, []byte(body)))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		events []string // Applied in order; all but the last must be accepted
+		want   int      // Response to the last event
+	}{
+		{"forward", []string{"in_transit", "in_transit", "out_for_delivery", "delivered"}, http.StatusOK},
+		{"returned in transit", []string{"in_transit", "returned"}, http.StatusOK},
+		{"backwards", []string{"in_transit", "out_for_delivery", "in_transit"}, http.StatusConflict},
+		{"delivered before pickup", []string{"delivered"}, http.StatusConflict},
+		{"returned before pickup", []string{"returned"}, http.StatusConflict},
+		{"skips out for delivery", []string{"in_transit", "delivered"}, http.StatusConflict},
+		{"after delivery", []string{"in_transit", "out_for_delivery", "delivered", "returned"}, http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServer()
+			trackingNumber := shipped(t, s, "order-1")
+			last := len(tc.events) - 1
+			for _, event := range tc.events[:last] {
+				if got := post(t, s, trackingNumber, event); got != http.StatusOK {
+					t.Fatalf("%q answered %d, want 200", event, got)
+				}
+			}
+			before, _ := s.Lookup(context.Background(), "ship-order-1")
+			if got := post(t, s, trackingNumber, tc.events[last]); got != tc.want {
+				t.Errorf("%q answered %d, want %d", tc.events[last], got, tc.want)
+			}
+			if after, _ := s.Lookup(context.Background(), "ship-order-1"); tc.want != http.StatusOK && after.GetStatus() != before.GetStatus() {
+				t.Errorf("refused %q moved the shipment from %s to %s", tc.events[last], before.GetStatus(), after.GetStatus())
+			}
+		})
+	}
+}
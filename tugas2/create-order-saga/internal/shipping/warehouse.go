@@ -0,0 +1,70 @@
+package shipping
+
+import (
+	"fmt"
+	"strings"
+
+	commonpb "create-order-saga/proto/common"
+)
+
+// DefaultWarehouse stocks every product not mapped to another warehouse.
+const DefaultWarehouse = "main"
+
+// parcel is the part of an order shipped from one warehouse.
+type parcel struct {
+	warehouse string
+	items     []*commonpb.Item
+}
+
+// splitByWarehouse groups the items into one parcel per warehouse, in the
+// order each warehouse first appears. An order without items yields a single
+// empty parcel from DefaultWarehouse.
+func splitByWarehouse(items []*commonpb.Item, warehouses map[string]string) []parcel {
+	var parcels []parcel
+	index := make(map[string]int)
+	for _, item := range items {
+		warehouse, ok := warehouses[item.GetProductId()]
+		if !ok || warehouse == "" {
+			warehouse = DefaultWarehouse
+		}
+		i, ok := index[warehouse]
+		if !ok {
+			i = len(parcels)
+			index[warehouse] = i
+			parcels = append(parcels, parcel{warehouse: warehouse})
+		}
+		parcels[i].items = append(parcels[i].items, item)
+	}
+	if len(parcels) == 0 {
+		parcels = append(parcels, parcel{warehouse: DefaultWarehouse})
+	}
+	return parcels
+}
+
+// shipmentKeyFor returns the key an order's shipment from warehouse is
+// generated for: the order ID, suffixed with the warehouse if the order is
+// split across several.
+func shipmentKeyFor(orderID, warehouse string, split bool) string {
+	if !split {
+		return orderID
+	}
+	return orderID + "-" + warehouse
+}
+
+// ParseWarehouses parses a comma-separated list of product=warehouse entries,
+// e.g. "prod-A=east,prod-B=west". An empty spec maps nothing.
+func ParseWarehouses(spec string) (map[string]string, error) {
+	warehouses := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		product, warehouse, ok := strings.Cut(entry, "=")
+		if !ok || product == "" || warehouse == "" {
+			return nil, fmt.Errorf("warehouse entry %q: want product=warehouse", entry)
+		}
+		warehouses[product] = warehouse
+	}
+	return warehouses, nil
+}
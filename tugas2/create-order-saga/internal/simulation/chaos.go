@@ -0,0 +1,90 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"create-order-saga/pkg/errinfo"
+)
+
+// ChaosRule describes the faults injected into one RPC method.
+type ChaosRule struct {
+	FailureRate float64 // Probability in [0, 1] that the call fails with codes.Unavailable
+	Latency     Latency // Delay added before the call is handled (or failed)
+}
+
+// ChaosRules maps a method to its rule. Keys are either full gRPC method names
+// ("/payment.PaymentService/ProcessPayment") or bare method names ("ProcessPayment").
+type ChaosRules map[string]ChaosRule
+
+// lookup returns the rule for a full method name, preferring an exact match.
+func (r ChaosRules) lookup(fullMethod string) (ChaosRule, bool) {
+	if rule, ok := r[fullMethod]; ok {
+		return rule, true
+	}
+	rule, ok := r[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]
+	return rule, ok
+}
+
+// ParseChaosRules parses a comma-separated list of method=rate[@latency]
+// entries, where latency is a duration or a min-max range, e.g.
+// "ProcessPayment=0.3,ArrangeShipping=0.1@50ms-200ms". An empty spec yields no rules.
+func ParseChaosRules(spec string) (ChaosRules, error) {
+	rules := make(ChaosRules)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		method, value, ok := strings.Cut(entry, "=")
+		if !ok || method == "" {
+			return nil, fmt.Errorf("chaos rule %q: want method=rate[@latency]", entry)
+		}
+		rateText, latencyText, hasLatency := strings.Cut(value, "@")
+		rate, err := strconv.ParseFloat(rateText, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("chaos rule %q: failure rate must be a number in [0, 1]", entry)
+		}
+		rule := ChaosRule{FailureRate: rate}
+		if hasLatency {
+			minText, maxText, isRange := strings.Cut(latencyText, "-")
+			if rule.Latency.Min, err = time.ParseDuration(minText); err != nil {
+				return nil, fmt.Errorf("chaos rule %q: %w", entry, err)
+			}
+			if isRange {
+				if rule.Latency.Max, err = time.ParseDuration(maxText); err != nil {
+					return nil, fmt.Errorf("chaos rule %q: %w", entry, err)
+				}
+			}
+		}
+		rules[method] = rule
+	}
+	return rules, nil
+}
+
+// ChaosUnaryServerInterceptor injects the configured latency and failures into
+// matching methods; other methods are untouched. It is meant for resilience
+// testing only and must be installed explicitly.
+func ChaosUnaryServerInterceptor(rules ChaosRules) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		rule, ok := rules.lookup(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+		if err := rule.Latency.Sleep(ctx); err != nil {
+			return nil, err
+		}
+		if rule.FailureRate > 0 && rand.Float64() < rule.FailureRate {
+			detail := errinfo.New(errinfo.DomainSimulation, errinfo.ReasonInjectedFailure, map[string]string{"operation": info.FullMethod})
+			return nil, errinfo.Errorf(codes.Unavailable, detail, "chaos: injected failure for %s", info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,98 @@
+package simulation_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/errinfo"
+)
+
+func TestParseChaosRules(t *testing.T) {
+	rules, err := simulation.ParseChaosRules(" ProcessPayment=1 , /shipping.ShippingService/ArrangeShipping=0.25@10ms-20ms,CreateOrder=0@5ms")
+	if err != nil {
+		t.Fatalf("ParseChaosRules: %v", err)
+	}
+	want := simulation.ChaosRules{
+		"ProcessPayment": {FailureRate: 1},
+		"/shipping.ShippingService/ArrangeShipping": {FailureRate: 0.25, Latency: simulation.Latency{Min: 10 * time.Millisecond, Max: 20 * time.Millisecond}},
+		"CreateOrder": {FailureRate: 0, Latency: simulation.Latency{Min: 5 * time.Millisecond}},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rules = %v, want %v", rules, want)
+	}
+	for method, rule := range want {
+		if rules[method] != rule {
+			t.Errorf("rule for %s = %+v, want %+v", method, rules[method], rule)
+		}
+	}
+	if rules, err := simulation.ParseChaosRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("empty spec = %v, %v; want no rules", rules, err)
+	}
+	for _, spec := range []string{"ProcessPayment", "=0.5", "ProcessPayment=1.5", "ProcessPayment=-0.1", "ProcessPayment=often", "ProcessPayment=0.5@soon", "ProcessPayment=0.5@1ms-later"} {
+		if _, err := simulation.ParseChaosRules(spec); err == nil {
+			t.Errorf("ParseChaosRules(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+// TestChaosUnaryServerInterceptor fails every call to a method at rate 1
+// without reaching the handler, and leaves methods at rate 0 or without a
+// rule untouched.
+func TestChaosUnaryServerInterceptor(t *testing.T) {
+	intercept := simulation.ChaosUnaryServerInterceptor(simulation.ChaosRules{
+		"ProcessPayment": {FailureRate: 1},
+		"/shipping.ShippingService/QuoteShipping": {FailureRate: 0},
+	})
+	call := func(method string) (int, error) {
+		calls := 0
+		_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(context.Context, interface{}) (interface{}, error) {
+			calls++
+			return "ok", nil
+		})
+		return calls, err
+	}
+
+	const failing = "/payment.PaymentService/ProcessPayment"
+	for range 100 {
+		calls, err := call(failing)
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("%s = %v, want Unavailable on every call", failing, err)
+		}
+		if calls != 0 {
+			t.Fatalf("handler ran %d times for an injected failure", calls)
+		}
+		info, ok := errinfo.From(err)
+		if !ok || info.GetReason() != errinfo.ReasonInjectedFailure || info.GetMetadata()["operation"] != failing {
+			t.Fatalf("error info = %v, want %s for %s", info, errinfo.ReasonInjectedFailure, failing)
+		}
+	}
+	for _, method := range []string{"/shipping.ShippingService/QuoteShipping", "/payment.PaymentService/RefundPayment", "/order.OrderService/ProcessPayment2"} {
+		for range 100 {
+			if calls, err := call(method); err != nil || calls != 1 {
+				t.Fatalf("%s = %v with %d handler calls, want it untouched", method, err, calls)
+			}
+		}
+	}
+}
+
+// TestChaosLatencyHonoursDeadline adds a rule's latency before the handler and
+// gives up with the context's error when the deadline comes first.
+func TestChaosLatencyHonoursDeadline(t *testing.T) {
+	intercept := simulation.ChaosUnaryServerInterceptor(simulation.ChaosRules{"CreateOrder": {Latency: simulation.Latency{Min: time.Minute}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	called := false
+	_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/order.OrderService/CreateOrder"}, func(context.Context, interface{}) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	if status.Code(err) != codes.DeadlineExceeded || called {
+		t.Errorf("slow call past its deadline = %v (handler called: %v), want DeadlineExceeded without the handler", err, called)
+	}
+}
@@ -0,0 +1,140 @@
+package simulation
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/errinfo"
+	adminpb "create-order-saga/proto/admin"
+)
+
+// FailureSimulator injects latency into a service's RPCs and failures into
+// its main operation according to a FailureConfig that can be changed at
+// runtime through the FailureAdmin service it implements. The zero
+// configuration injects nothing.
+type FailureSimulator struct {
+	adminpb.UnimplementedFailureAdminServer
+
+	mu    sync.Mutex
+	cfg   *adminpb.FailureConfig
+	clock clock.Clock
+}
+
+// NewFailureSimulator creates a simulator that injects nothing until
+// configured. Injected latency waits on c (the real clock if nil).
+func NewFailureSimulator(c clock.Clock) *FailureSimulator {
+	return &FailureSimulator{cfg: &adminpb.FailureConfig{}, clock: clock.OrReal(c)}
+}
+
+// Config returns a copy of the current configuration.
+func (f *FailureSimulator) Config() *adminpb.FailureConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return proto.Clone(f.cfg).(*adminpb.FailureConfig)
+}
+
+// SetConfig replaces the configuration, rejecting out-of-range values with a
+// codes.InvalidArgument error. A nil cfg clears it.
+func (f *FailureSimulator) SetConfig(cfg *adminpb.FailureConfig) error {
+	if cfg == nil {
+		cfg = &adminpb.FailureConfig{}
+	}
+	switch {
+	case cfg.FailureRate < 0 || cfg.FailureRate > 1:
+		return status.Errorf(codes.InvalidArgument, "failure_rate %v is not in [0, 1]", cfg.FailureRate)
+	case cfg.FailNextN < 0:
+		return status.Errorf(codes.InvalidArgument, "fail_next_n %d is negative", cfg.FailNextN)
+	case cfg.LatencyMs < 0:
+		return status.Errorf(codes.InvalidArgument, "latency_ms %d is negative", cfg.LatencyMs)
+	case cfg.LatencyMaxMs < 0:
+		return status.Errorf(codes.InvalidArgument, "latency_max_ms %d is negative", cfg.LatencyMaxMs)
+	case cfg.LatencyProbability < 0 || cfg.LatencyProbability > 1:
+		return status.Errorf(codes.InvalidArgument, "latency_probability %v is not in [0, 1]", cfg.LatencyProbability)
+	case cfg.ErrorCode < 0 || cfg.ErrorCode > int32(codes.Unauthenticated):
+		return status.Errorf(codes.InvalidArgument, "error_code %d is not a gRPC status code", cfg.ErrorCode)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cfg = proto.Clone(cfg).(*adminpb.FailureConfig)
+	return nil
+}
+
+// Delay waits for the configured latency, if the call is to be delayed,
+// returning a codes.DeadlineExceeded (or codes.Canceled) error as soon as ctx
+// is done. Services call it before handling each RPC. A nil simulator waits
+// for nothing.
+func (f *FailureSimulator) Delay(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	latency := Latency{
+		Min:   time.Duration(f.cfg.LatencyMs) * time.Millisecond,
+		Max:   time.Duration(f.cfg.LatencyMaxMs) * time.Millisecond,
+		Clock: f.clock,
+	}
+	probability := f.cfg.LatencyProbability
+	f.mu.Unlock()
+
+	if probability > 0 && rand.Float64() >= probability {
+		return nil
+	}
+	return latency.Sleep(ctx)
+}
+
+// Inject returns an injected failure for operation, if one is due. Latency
+// is not applied here but by Delay. A nil simulator injects nothing.
+func (f *FailureSimulator) Inject(ctx context.Context, operation string) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	fail := false
+	if f.cfg.FailNextN > 0 {
+		f.cfg.FailNextN--
+		fail = true
+	} else if f.cfg.FailureRate > 0 && rand.Float64() < f.cfg.FailureRate {
+		fail = true
+	}
+	code := injectedCode(f.cfg)
+	f.mu.Unlock()
+
+	if !fail {
+		return nil
+	}
+	log.Printf("Injecting simulated %s failure into %s", code, operation)
+	info := errinfo.New(errinfo.DomainSimulation, errinfo.ReasonInjectedFailure, map[string]string{"operation": operation})
+	return errinfo.Errorf(code, info, "simulated failure injected into %s", operation)
+}
+
+// injectedCode returns the status code of failures injected under cfg.
+func injectedCode(cfg *adminpb.FailureConfig) codes.Code {
+	if cfg.ErrorCode == 0 {
+		return codes.Unavailable
+	}
+	return codes.Code(cfg.ErrorCode)
+}
+
+// SetFailureConfig implements the FailureAdmin service.
+func (f *FailureSimulator) SetFailureConfig(ctx context.Context, req *adminpb.SetFailureConfigRequest) (*adminpb.FailureConfig, error) {
+	if err := f.SetConfig(req.GetConfig()); err != nil {
+		return nil, err
+	}
+	cfg := f.Config()
+	log.Printf("Failure simulation configured: rate=%v fail_next_n=%d latency_ms=%d latency_max_ms=%d latency_probability=%v error_code=%s",
+		cfg.FailureRate, cfg.FailNextN, cfg.LatencyMs, cfg.LatencyMaxMs, cfg.LatencyProbability, injectedCode(cfg))
+	return cfg, nil
+}
+
+// GetFailureConfig implements the FailureAdmin service.
+func (f *FailureSimulator) GetFailureConfig(ctx context.Context, req *adminpb.GetFailureConfigRequest) (*adminpb.FailureConfig, error) {
+	return f.Config(), nil
+}
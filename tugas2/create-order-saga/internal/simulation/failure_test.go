@@ -0,0 +1,152 @@
+package simulation_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/clock"
+	adminpb "create-order-saga/proto/admin"
+)
+
+// TestFailureSimulatorSetConfig checks out-of-range configurations are
+// refused with InvalidArgument and leave the current one in place.
+func TestFailureSimulatorSetConfig(t *testing.T) {
+	sim := simulation.NewFailureSimulator(nil)
+	valid := &adminpb.FailureConfig{FailureRate: 0.5, LatencyMs: 10, LatencyMaxMs: 20, LatencyProbability: 0.25}
+	if err := sim.SetConfig(valid); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	for _, cfg := range []*adminpb.FailureConfig{
+		{FailureRate: 1.5},
+		{FailNextN: -1},
+		{LatencyMs: -1},
+		{LatencyMaxMs: -1},
+		{LatencyProbability: -0.1},
+		{LatencyProbability: 1.1},
+		{ErrorCode: int32(codes.Unauthenticated) + 1},
+	} {
+		if err := sim.SetConfig(cfg); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("SetConfig(%v) = %v, want InvalidArgument", cfg, err)
+		}
+	}
+	if got := sim.Config(); got.LatencyMaxMs != 20 || got.LatencyProbability != 0.25 {
+		t.Errorf("config after refused updates = %v, want %v", got, valid)
+	}
+}
+
+// TestFailureSimulatorDelay checks a configured range delays calls on the
+// simulator's clock for between latency_ms and latency_max_ms.
+func TestFailureSimulatorDelay(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	sim := simulation.NewFailureSimulator(fake)
+	if err := sim.SetConfig(&adminpb.FailureConfig{LatencyMs: 10_000, LatencyMaxMs: 20_000}); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		done := make(chan error, 1)
+		go func() { done <- sim.Delay(context.Background()) }()
+		for fake.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		fake.Advance(10*time.Second - time.Millisecond)
+		select {
+		case err := <-done:
+			t.Fatalf("Delay returned %v before latency_ms passed", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		fake.Advance(10*time.Second + time.Millisecond)
+		if err := <-done; err != nil {
+			t.Fatalf("Delay = %v, want nil once latency_max_ms passed", err)
+		}
+	}
+
+	var nilSim *simulation.FailureSimulator
+	if err := nilSim.Delay(context.Background()); err != nil {
+		t.Errorf("nil simulator Delay = %v, want nil", err)
+	}
+}
+
+// TestFailureSimulatorDelayProbability checks latency_probability delays
+// about that share of calls, and 0 delays every call.
+func TestFailureSimulatorDelayProbability(t *testing.T) {
+	const calls, latency = 100, 5 * time.Millisecond
+	for _, tc := range []struct {
+		probability float64
+		min, max    int
+	}{
+		{0, calls, calls},
+		{0.5, 20, 80},
+		{1, calls, calls},
+	} {
+		sim := simulation.NewFailureSimulator(nil)
+		if err := sim.SetConfig(&adminpb.FailureConfig{LatencyMs: int32(latency / time.Millisecond), LatencyProbability: tc.probability}); err != nil {
+			t.Fatal(err)
+		}
+		delayed := 0
+		for range calls {
+			start := time.Now()
+			if err := sim.Delay(context.Background()); err != nil {
+				t.Fatalf("Delay: %v", err)
+			}
+			if time.Since(start) >= latency {
+				delayed++
+			}
+		}
+		if delayed < tc.min || delayed > tc.max {
+			t.Errorf("probability %v delayed %d of %d calls, want %d to %d", tc.probability, delayed, calls, tc.min, tc.max)
+		}
+	}
+}
+
+// TestFailureSimulatorDelayCancelled checks a caller giving up interrupts the
+// delay promptly with the matching status code.
+func TestFailureSimulatorDelayCancelled(t *testing.T) {
+	sim := simulation.NewFailureSimulator(nil)
+	if err := sim.SetConfig(&adminpb.FailureConfig{LatencyMs: 60_000}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sim.Delay(ctx); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Delay past the deadline = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Delay took %v with a 20ms deadline", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := sim.Delay(ctx); status.Code(err) != codes.Canceled {
+		t.Errorf("Delay of a cancelled call = %v, want Canceled", err)
+	}
+}
+
+// TestFailureSimulatorInject checks fail_next_n fails exactly that many calls
+// with the configured code, and that injection no longer delays.
+func TestFailureSimulatorInject(t *testing.T) {
+	sim := simulation.NewFailureSimulator(nil)
+	if err := sim.SetConfig(&adminpb.FailureConfig{FailNextN: 2, ErrorCode: int32(codes.ResourceExhausted), LatencyMs: 60_000}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		start := time.Now()
+		err := sim.Inject(context.Background(), "CreateOrder")
+		if want := codes.ResourceExhausted; i < 2 && status.Code(err) != want {
+			t.Errorf("call %d = %v, want an injected %s", i, err, want)
+		} else if i == 2 && err != nil {
+			t.Errorf("call %d = %v, want nil after fail_next_n ran out", i, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Inject took %v, want the latency left to Delay", elapsed)
+		}
+	}
+	if n := sim.Config().FailNextN; n != 0 {
+		t.Errorf("fail_next_n after the failures = %d, want 0", n)
+	}
+}
@@ -0,0 +1,48 @@
+// Package simulation contains helpers the services use to simulate
+// real-world behaviour (slowness, failures) for testing the saga.
+package simulation
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"create-order-saga/pkg/clock"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Latency describes an artificial delay applied to every RPC.
+// A random duration in [Min, Max] is chosen for each call; if Max <= Min, Min is used.
+type Latency struct {
+	Min   time.Duration
+	Max   time.Duration
+	Clock clock.Clock // Used to wait out the delay; the real clock if nil
+}
+
+// Duration picks the delay for a single call.
+func (l Latency) Duration() time.Duration {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + time.Duration(rand.Int63n(int64(l.Max-l.Min)+1))
+}
+
+// Sleep waits for the simulated latency, returning a codes.DeadlineExceeded
+// (or codes.Canceled) error if ctx is done first.
+func (l Latency) Sleep(ctx context.Context) error {
+	d := l.Duration()
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-clock.OrReal(l.Clock).After(d):
+		return nil
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return status.Error(codes.Canceled, "request cancelled during simulated latency")
+		}
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded during simulated latency")
+	}
+}
@@ -0,0 +1,63 @@
+package simulation_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/internal/simulation"
+	"create-order-saga/pkg/clock"
+)
+
+func TestLatencyDuration(t *testing.T) {
+	if d := (simulation.Latency{Min: 5 * time.Millisecond}).Duration(); d != 5*time.Millisecond {
+		t.Errorf("fixed latency = %v, want 5ms", d)
+	}
+	if d := (simulation.Latency{Min: 5 * time.Millisecond, Max: time.Millisecond}).Duration(); d != 5*time.Millisecond {
+		t.Errorf("latency with Max below Min = %v, want Min", d)
+	}
+	l := simulation.Latency{Min: 10 * time.Millisecond, Max: 20 * time.Millisecond}
+	for range 100 {
+		if d := l.Duration(); d < l.Min || d > l.Max {
+			t.Fatalf("latency %v outside [%v, %v]", d, l.Min, l.Max)
+		}
+	}
+}
+
+// TestLatencySleep checks Sleep waits out the latency on its clock, and
+// returns DeadlineExceeded or Canceled as soon as the context ends first.
+func TestLatencySleep(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	l := simulation.Latency{Min: time.Minute, Clock: fake}
+	done := make(chan error, 1)
+	go func() { done <- l.Sleep(context.Background()) }()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Sleep returned %v before its latency passed", err)
+	default:
+	}
+	fake.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Errorf("Sleep = %v, want nil once the latency passed", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Sleep(ctx); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Sleep past the deadline = %v, want DeadlineExceeded", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := l.Sleep(ctx); status.Code(err) != codes.Canceled {
+		t.Errorf("Sleep with a cancelled context = %v, want Canceled", err)
+	}
+	if err := (simulation.Latency{}).Sleep(ctx); err != nil {
+		t.Errorf("Sleep without latency = %v, want nil even with a cancelled context", err)
+	}
+}
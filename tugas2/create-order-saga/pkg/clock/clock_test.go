@@ -0,0 +1,84 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"create-order-saga/pkg/clock"
+)
+
+var start = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// fired reports whether ch has a value ready, and the value.
+func fired(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	fake := clock.NewFake(start)
+	ttl := fake.After(time.Minute)
+	later := fake.After(time.Hour)
+	if n := fake.Waiters(); n != 2 {
+		t.Fatalf("Waiters = %d, want 2", n)
+	}
+
+	fake.Advance(59 * time.Second)
+	if _, ok := fired(ttl); ok {
+		t.Fatal("a minute's After fired 59s in")
+	}
+	fake.Advance(time.Second)
+	if got, ok := fired(ttl); !ok || !got.Equal(start.Add(time.Minute)) {
+		t.Fatalf("a minute's After at the deadline = %v, %v; want %v", got, ok, start.Add(time.Minute))
+	}
+	if _, ok := fired(later); ok {
+		t.Error("an hour's After fired a minute in")
+	}
+	if n := fake.Waiters(); n != 1 {
+		t.Errorf("Waiters = %d, want 1", n)
+	}
+
+	fake.Set(start.Add(2 * time.Hour))
+	if got, ok := fired(later); !ok || !got.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("an hour's After after Set = %v, %v; want the time it was set to", got, ok)
+	}
+	if got := fake.Now(); !got.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("Now = %v, want %v", got, start.Add(2*time.Hour))
+	}
+}
+
+func TestFakeAfterNonPositive(t *testing.T) {
+	fake := clock.NewFake(start)
+	for _, d := range []time.Duration{0, -time.Second} {
+		if got, ok := fired(fake.After(d)); !ok || !got.Equal(start) {
+			t.Errorf("After(%v) = %v, %v; want it fired at the current time", d, got, ok)
+		}
+	}
+	if n := fake.Waiters(); n != 0 {
+		t.Errorf("Waiters = %d, want 0", n)
+	}
+}
+
+// TestFakeSetBackwards checks the fake clock never runs backwards.
+func TestFakeSetBackwards(t *testing.T) {
+	fake := clock.NewFake(start)
+	fake.Set(start.Add(-time.Hour))
+	if got := fake.Now(); !got.Equal(start) {
+		t.Errorf("Now after setting the clock back = %v, want %v", got, start)
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	fake := clock.NewFake(start)
+	if got := clock.OrReal(fake); got != fake {
+		t.Errorf("OrReal(fake) = %v, want the fake", got)
+	}
+	before := time.Now()
+	if got := clock.OrReal(nil).Now(); got.Before(before) {
+		t.Errorf("OrReal(nil).Now() = %v, want the real time", got)
+	}
+}
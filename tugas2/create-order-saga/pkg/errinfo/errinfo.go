@@ -0,0 +1,97 @@
+// Package errinfo gives the saga services' errors a machine-readable reason:
+// an ErrorInfo status detail (google.rpc.ErrorInfo) naming why the call
+// failed, the service that failed it and the IDs involved, so callers can act
+// on failures without parsing messages.
+package errinfo
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domains of the services reporting errors.
+const (
+	DomainOrder      = "order.saga"
+	DomainPayment    = "payment.saga"
+	DomainShipping   = "shipping.saga"
+	DomainSimulation = "simulation.saga" // Failures injected for testing, whatever the service
+)
+
+// Reasons for failed calls. Metadata keys are snake_case, e.g. order_id.
+const (
+	ReasonOrderTooLarge      = "ORDER_TOO_LARGE"       // Too many items, or too many of one; metadata: field
+	ReasonInvalidOrder       = "INVALID_ORDER"         // Missing user, items or SKUs, or quantities, prices or shipping cost unusable for a total; metadata: field, unless the total failed
+	ReasonUnknownProduct     = "UNKNOWN_PRODUCT"       // Not in the price catalog; metadata: product_id, field
+	ReasonPriceMismatch      = "PRICE_MISMATCH"        // Submitted prices differ from the catalog's; metadata: product_ids
+	ReasonOutOfStock         = "OUT_OF_STOCK"          // Not enough units in stock; metadata: product_ids
+	ReasonGatewayUnavailable = "GATEWAY_UNAVAILABLE"   // The payment gateway could not be reached; metadata: order_id
+	ReasonCurrencyRejected   = "CURRENCY_NOT_ACCEPTED" // Not an accepted currency; metadata: order_id, currency
+	ReasonCurrencyMismatch   = "CURRENCY_MISMATCH"     // The amount is not in the order's currency; metadata: order_id, order_currency, payment_currency
+	ReasonCarrierUnavailable = "CARRIER_UNAVAILABLE"   // No carrier took the parcel; metadata: order_id, warehouse
+	ReasonShipmentNotFound   = "SHIPMENT_NOT_FOUND"    // metadata: order_id, shipment_id
+	ReasonShipmentMismatch   = "SHIPMENT_WRONG_ORDER"  // The shipment belongs to another order; metadata: order_id, shipment_id
+	ReasonShipmentCancelled  = "SHIPMENT_CANCELLED"    // The reservation was released; metadata: order_id, shipment_id
+	ReasonInjectedFailure    = "INJECTED_FAILURE"      // Failure simulation; metadata: operation
+)
+
+// New returns an ErrorInfo for reason in domain. Empty metadata values are left out.
+func New(domain, reason string, metadata map[string]string) *errdetails.ErrorInfo {
+	info := &errdetails.ErrorInfo{Domain: domain, Reason: reason}
+	for k, v := range metadata {
+		if v == "" {
+			continue
+		}
+		if info.Metadata == nil {
+			info.Metadata = make(map[string]string)
+		}
+		info.Metadata[k] = v
+	}
+	return info
+}
+
+// Attach returns st with info added to its details. st is returned unchanged
+// if info cannot be attached (e.g. st is OK).
+func Attach(st *status.Status, info *errdetails.ErrorInfo) *status.Status {
+	detailed, err := st.WithDetails(info)
+	if err != nil {
+		log.Printf("WARNING: Attaching error info %s: %v", info.GetReason(), err)
+		return st
+	}
+	return detailed
+}
+
+// Errorf is status.Errorf with info attached.
+func Errorf(code codes.Code, info *errdetails.ErrorInfo, format string, a ...any) error {
+	return Attach(status.Newf(code, format, a...), info).Err()
+}
+
+// From returns the ErrorInfo attached to a status error, looking through
+// wrapping errors.
+func From(err error) (*errdetails.ErrorInfo, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info, true
+		}
+	}
+	return nil, false
+}
+
+// Format renders info compactly for log lines, e.g.
+// "OUT_OF_STOCK (order.saga) product_ids=p1,p2".
+func Format(info *errdetails.ErrorInfo) string {
+	out := fmt.Sprintf("%s (%s)", info.GetReason(), info.GetDomain())
+	for _, k := range slices.Sorted(maps.Keys(info.GetMetadata())) {
+		out += " " + k + "=" + info.GetMetadata()[k]
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package errinfo_test
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/errinfo"
+	orderpb "create-order-saga/proto/order"
+)
+
+// TestRoundTrip sends an error with an ErrorInfo through its wire form, as a
+// gRPC call does, and checks From recovers the reason, domain and metadata,
+// including through a wrapping error and next to another detail.
+func TestRoundTrip(t *testing.T) {
+	info := errinfo.New(errinfo.DomainOrder, errinfo.ReasonOutOfStock, map[string]string{"product_ids": "prod-B", "order_id": ""})
+	st := status.New(codes.FailedPrecondition, "not enough stock")
+	st, err := st.WithDetails(&orderpb.StockShortage{Items: []*orderpb.ShortItem{{ProductId: "prod-B", Requested: 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = errinfo.Attach(st, info)
+
+	wire, err := proto.Marshal(st.Proto())
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := &spb.Status{}
+	if err := proto.Unmarshal(wire, received); err != nil {
+		t.Fatal(err)
+	}
+	err = fmt.Errorf("CreateOrder: %w", status.ErrorProto(received))
+
+	got, ok := errinfo.From(err)
+	if !ok {
+		t.Fatalf("From(%v) found no error info", err)
+	}
+	want := &errdetails.ErrorInfo{Domain: errinfo.DomainOrder, Reason: errinfo.ReasonOutOfStock, Metadata: map[string]string{"product_ids": "prod-B"}}
+	if !proto.Equal(got, want) {
+		t.Errorf("From = %v, want %v without the empty order_id", got, want)
+	}
+	if details := status.Convert(err).Details(); len(details) != 2 {
+		t.Errorf("details = %v, want the stock shortage kept next to the error info", details)
+	}
+	if got, want := errinfo.Format(got), "OUT_OF_STOCK (order.saga) product_ids=prod-B"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
+
+// TestErrorf checks Errorf keeps the code and message and attaches info.
+func TestErrorf(t *testing.T) {
+	info := errinfo.New(errinfo.DomainShipping, errinfo.ReasonCarrierUnavailable, map[string]string{"order_id": "order-1", "warehouse": "wh-east"})
+	err := errinfo.Errorf(codes.Internal, info, "no carrier for order %s", "order-1")
+	if st := status.Convert(err); st.Code() != codes.Internal || st.Message() != "no carrier for order order-1" {
+		t.Errorf("status = %s %q, want Internal with the formatted message", st.Code(), st.Message())
+	}
+	if got, _ := errinfo.From(err); got.GetReason() != errinfo.ReasonCarrierUnavailable || got.GetMetadata()["warehouse"] != "wh-east" {
+		t.Errorf("From = %v, want %v", got, info)
+	}
+	if got, want := errinfo.Format(info), "CARRIER_UNAVAILABLE (shipping.saga) order_id=order-1 warehouse=wh-east"; got != want {
+		t.Errorf("Format = %q, want %q with the metadata sorted", got, want)
+	}
+}
+
+// TestFromWithoutInfo checks From reports errors carrying no ErrorInfo.
+func TestFromWithoutInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"nil", nil},
+		{"plain error", fmt.Errorf("boom")},
+		{"status without details", status.Error(codes.Unavailable, "down")},
+		{"OK status", errinfo.Attach(status.New(codes.OK, ""), errinfo.New(errinfo.DomainOrder, errinfo.ReasonOutOfStock, nil)).Err()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if info, ok := errinfo.From(tc.err); ok || info != nil {
+				t.Errorf("From = %v, %t; want nothing", info, ok)
+			}
+		})
+	}
+}
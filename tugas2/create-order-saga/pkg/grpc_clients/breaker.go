@@ -0,0 +1,192 @@
+package grpc_clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/clock"
+)
+
+// ErrCircuitOpen is returned (wrapped in a *CircuitOpenError) when a call is
+// rejected because the service's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError reports which service rejected the call. It matches
+// ErrCircuitOpen with errors.Is and converts to a codes.Unavailable status.
+type CircuitOpenError struct {
+	Service string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s service: %v", e.Service, ErrCircuitOpen)
+}
+
+// Is lets errors.Is(err, ErrCircuitOpen) match.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// GRPCStatus lets status.Code report codes.Unavailable for a rejected call.
+func (e *CircuitOpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Calls flow normally
+	BreakerOpen                         // Calls fail immediately
+	BreakerHalfOpen                     // A limited number of probe calls are allowed
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "CLOSED"
+	case BreakerOpen:
+		return "OPEN"
+	case BreakerHalfOpen:
+		return "HALF_OPEN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// BreakerConfig configures a circuit breaker.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the breaker
+	CoolDown         time.Duration // Time spent open before allowing probe calls
+	HalfOpenMaxCalls int           // Concurrent probe calls allowed while half-open
+}
+
+// DefaultBreakerConfig is used for every service unless overridden.
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	CoolDown:         10 * time.Second,
+	HalfOpenMaxCalls: 1,
+}
+
+// CircuitBreaker tracks the health of one downstream service.
+type CircuitBreaker struct {
+	service string
+	cfg     BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	inFlight int // Probe calls currently running while half-open
+	clock    clock.Clock
+}
+
+// NewCircuitBreaker creates a closed circuit breaker for the given service.
+// Its cool-down is timed on c (the real clock if nil).
+func NewCircuitBreaker(service string, cfg BreakerConfig, c clock.Clock) *CircuitBreaker {
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.HalfOpenMaxCalls < 1 {
+		cfg.HalfOpenMaxCalls = 1
+	}
+	return &CircuitBreaker{
+		service: service,
+		cfg:     cfg,
+		state:   BreakerClosed,
+		clock:   clock.OrReal(c),
+	}
+}
+
+// State returns the current state, moving from open to half-open once the cool-down has elapsed.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshLocked()
+	return b.state
+}
+
+// refreshLocked moves an open breaker to half-open after the cool-down. Caller holds b.mu.
+func (b *CircuitBreaker) refreshLocked() {
+	if b.state == BreakerOpen && b.clock.Now().Sub(b.openedAt) >= b.cfg.CoolDown {
+		b.setStateLocked(BreakerHalfOpen)
+	}
+}
+
+func (b *CircuitBreaker) setStateLocked(to BreakerState) {
+	if b.state == to {
+		return
+	}
+	log.Printf("[%s] circuit breaker %s -> %s", b.service, b.state, to)
+	b.state = to
+}
+
+// allow reports whether a call may proceed and reserves a probe slot if half-open.
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshLocked()
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.inFlight >= b.cfg.HalfOpenMaxCalls {
+			return false
+		}
+		b.inFlight++
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of an allowed call.
+func (b *CircuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.inFlight > 0 {
+		b.inFlight--
+	}
+	if !failed {
+		b.failures = 0
+		b.setStateLocked(BreakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.openedAt = b.clock.Now()
+		b.inFlight = 0
+		b.setStateLocked(BreakerOpen)
+	}
+}
+
+// isBreakerFailure reports whether err indicates the service itself is unhealthy,
+// as opposed to a business-level rejection or a caller cancellation.
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// UnaryClientInterceptor rejects calls with a *CircuitOpenError while the breaker is open.
+func (b *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !b.allow() {
+			return &CircuitOpenError{Service: b.service}
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(isBreakerFailure(err))
+		return err
+	}
+}
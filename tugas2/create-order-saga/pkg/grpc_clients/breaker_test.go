@@ -0,0 +1,113 @@
+package grpc_clients_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/grpc_clients"
+)
+
+// breakerCall makes one call through b's interceptor to an invoker returning
+// err, reporting the call's error and whether the invoker ran.
+func breakerCall(b *grpc_clients.CircuitBreaker, err error) (error, bool) {
+	invoked := false
+	invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		invoked = true
+		return err
+	}
+	return b.UnaryClientInterceptor()(context.Background(), "/payment.PaymentService/GetPayment", nil, nil, nil, invoker), invoked
+}
+
+// TestCircuitBreakerCycle walks a breaker from closed to open, half-open and
+// closed again, then back to open from a failed probe.
+func TestCircuitBreakerCycle(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	b := grpc_clients.NewCircuitBreaker("Payment", grpc_clients.BreakerConfig{FailureThreshold: 3, CoolDown: 10 * time.Second, HalfOpenMaxCalls: 1}, fake)
+	unavailable := status.Error(codes.Unavailable, "down")
+	expect := func(want grpc_clients.BreakerState) {
+		t.Helper()
+		if got := b.State(); got != want {
+			t.Fatalf("breaker is %s, want %s", got, want)
+		}
+	}
+
+	// Business errors and successes never open it
+	breakerCall(b, status.Error(codes.InvalidArgument, "bad request"))
+	breakerCall(b, unavailable)
+	breakerCall(b, unavailable)
+	breakerCall(b, nil)
+	expect(grpc_clients.BreakerClosed)
+
+	// Closed -> open after FailureThreshold consecutive failures
+	for range 3 {
+		breakerCall(b, unavailable)
+	}
+	expect(grpc_clients.BreakerOpen)
+	err, invoked := breakerCall(b, nil)
+	if invoked || !errors.Is(err, grpc_clients.ErrCircuitOpen) || status.Code(err) != codes.Unavailable {
+		t.Fatalf("call while open = %v (invoked %t), want a rejected Unavailable ErrCircuitOpen", err, invoked)
+	}
+
+	// Open -> half-open once the cool-down has elapsed
+	fake.Advance(9 * time.Second)
+	expect(grpc_clients.BreakerOpen)
+	fake.Advance(time.Second)
+	expect(grpc_clients.BreakerHalfOpen)
+
+	// Half-open -> open when the probe fails, restarting the cool-down
+	if _, invoked := breakerCall(b, unavailable); !invoked {
+		t.Fatal("probe call was rejected while half-open")
+	}
+	expect(grpc_clients.BreakerOpen)
+	fake.Advance(10 * time.Second)
+	expect(grpc_clients.BreakerHalfOpen)
+
+	// Half-open -> closed when the probe succeeds
+	if err, invoked := breakerCall(b, nil); err != nil || !invoked {
+		t.Fatalf("probe call = %v (invoked %t), want it to go through", err, invoked)
+	}
+	expect(grpc_clients.BreakerClosed)
+	breakerCall(b, unavailable)
+	breakerCall(b, unavailable)
+	expect(grpc_clients.BreakerClosed)
+}
+
+// TestCircuitBreakerHalfOpenLimit checks that a half-open breaker lets only
+// HalfOpenMaxCalls probes through at once.
+func TestCircuitBreakerHalfOpenLimit(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	b := grpc_clients.NewCircuitBreaker("Payment", grpc_clients.BreakerConfig{FailureThreshold: 1, CoolDown: time.Second, HalfOpenMaxCalls: 1}, fake)
+	breakerCall(b, status.Error(codes.Unavailable, "down"))
+	fake.Advance(time.Second)
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		err := b.UnaryClientInterceptor()(context.Background(), "/payment.PaymentService/GetPayment", nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				close(probing)
+				<-release
+				return nil
+			})
+		done <- err
+	}()
+	<-probing
+	if err, invoked := breakerCall(b, nil); invoked || !errors.Is(err, grpc_clients.ErrCircuitOpen) {
+		t.Errorf("second probe = %v (invoked %t), want it rejected", err, invoked)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first probe: %v", err)
+	}
+	if got := b.State(); got != grpc_clients.BreakerClosed {
+		t.Errorf("breaker is %s after a successful probe, want CLOSED", got)
+	}
+}
@@ -0,0 +1,106 @@
+package grpc_clients
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RetryBudgetConfig limits the retries shared by every call made with one
+// RetryBudget. A zero field means that dimension is unlimited.
+type RetryBudgetConfig struct {
+	MaxRetries   int           // Retry attempts allowed in total (the first attempt of a call is free)
+	MaxRetryTime time.Duration // Time allowed in total for backoff waits and retried attempts
+}
+
+// RetryBudget is a pool of retries shared across calls, e.g. all the steps of
+// one saga, so that retries spent by early calls leave fewer for later ones.
+// It is safe for concurrent use.
+type RetryBudget struct {
+	cfg RetryBudgetConfig
+
+	mu      sync.Mutex
+	retries int           // Retries spent so far
+	spent   time.Duration // Retry time spent so far
+}
+
+// NewRetryBudget creates a full budget.
+func NewRetryBudget(cfg RetryBudgetConfig) *RetryBudget {
+	return &RetryBudget{cfg: cfg}
+}
+
+// Remaining returns the retries and retry time left. A dimension without a
+// limit reports -1.
+func (b *RetryBudget) Remaining() (retries int, retryTime time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remainingLocked()
+}
+
+func (b *RetryBudget) remainingLocked() (retries int, retryTime time.Duration) {
+	retries, retryTime = -1, -1
+	if b.cfg.MaxRetries > 0 {
+		retries = max(b.cfg.MaxRetries-b.retries, 0)
+	}
+	if b.cfg.MaxRetryTime > 0 {
+		retryTime = max(b.cfg.MaxRetryTime-b.spent, 0)
+	}
+	return retries, retryTime
+}
+
+// String describes the remaining budget for log lines, e.g. "2 retries, 1.5s left".
+func (b *RetryBudget) String() string {
+	retries, retryTime := b.Remaining()
+	r, t := "unlimited retries", "unlimited time"
+	if retries == 1 {
+		r = "1 retry"
+	} else if retries >= 0 {
+		r = fmt.Sprintf("%d retries", retries)
+	}
+	if retryTime >= 0 {
+		t = retryTime.String()
+	}
+	return r + ", " + t + " left"
+}
+
+// reserve takes one retry from the budget if a retry is left and the backoff
+// wait fits in the remaining time. A nil budget always allows the retry.
+func (b *RetryBudget) reserve(wait time.Duration) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	retries, retryTime := b.remainingLocked()
+	if retries == 0 || (retryTime >= 0 && wait >= retryTime) {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// charge records time spent on a reserved retry (its backoff and the attempt).
+func (b *RetryBudget) charge(d time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent += d
+}
+
+type retryBudgetKey struct{}
+
+// ContextWithRetryBudget returns a context whose forward calls draw their
+// retries from b. Compensation calls ignore the budget: they keep retrying
+// per their own policy because giving up leaves the system inconsistent.
+func ContextWithRetryBudget(ctx context.Context, b *RetryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, b)
+}
+
+// RetryBudgetFromContext returns the retry budget stored in ctx, if any.
+func RetryBudgetFromContext(ctx context.Context) (*RetryBudget, bool) {
+	b, ok := ctx.Value(retryBudgetKey{}).(*RetryBudget)
+	return b, ok && b != nil
+}
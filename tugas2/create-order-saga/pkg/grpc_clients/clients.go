@@ -1,60 +1,304 @@
 package grpc_clients
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure" // Use insecure for example only
+	"google.golang.org/grpc/keepalive"
 
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/interceptors"
 	orderpb "create-order-saga/proto/order"
 	paymentpb "create-order-saga/proto/payment"
 	shippingpb "create-order-saga/proto/shipping"
 )
 
+// Service names used to key per-service configuration.
+const (
+	OrderService    = "order"
+	PaymentService  = "payment"
+	ShippingService = "shipping"
+)
+
 // ServiceClients holds clients for all required services.
 type ServiceClients struct {
 	Order    orderpb.OrderServiceClient
 	Payment  paymentpb.PaymentServiceClient
 	Shipping shippingpb.ShippingServiceClient
+
+	breakers    map[string]*CircuitBreaker
+	pools       map[string]*connPool
+	addrs       map[string]string
+	stopWatches context.CancelFunc // Stops the connection state watchers, if running
+}
+
+// States returns the current circuit breaker state of every service, keyed by service name.
+func (c *ServiceClients) States() map[string]BreakerState {
+	states := make(map[string]BreakerState, len(c.breakers))
+	for service, b := range c.breakers {
+		states[service] = b.State()
+	}
+	return states
+}
+
+// options holds the configuration applied by NewServiceClients.
+type options struct {
+	retry        map[string]ServiceRetryConfig
+	breakers     map[string]BreakerConfig
+	apiKeys      map[string]string
+	actor        string
+	poolSize     int
+	readyTimeout time.Duration
+	watchState   bool
+	clock        clock.Clock
+	keepalive    keepalive.ClientParameters
+	dialOpts     []grpc.DialOption
+}
+
+// Option configures NewServiceClients.
+type Option func(*options)
+
+// WithWaitForReady makes NewServiceClients block until every connection is
+// READY, failing with an *UnreachableError if a service is not reachable within timeout.
+func WithWaitForReady(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readyTimeout = timeout
+	}
+}
+
+// WithPoolSize opens n connections to each service and spreads calls over
+// them round-robin (DefaultPoolSize by default). Values below 1 are ignored.
+func WithPoolSize(n int) Option {
+	return func(o *options) {
+		if n >= 1 {
+			o.poolSize = n
+		}
+	}
+}
+
+// WithStateWatcher starts a background goroutine per connection that logs
+// connectivity state transitions until Close is called.
+func WithStateWatcher() Option {
+	return func(o *options) {
+		o.watchState = true
+	}
+}
+
+// WithBreakerConfig sets the circuit breaker configuration for one service.
+func WithBreakerConfig(service string, cfg BreakerConfig) Option {
+	return func(o *options) {
+		o.breakers[service] = cfg
+	}
+}
+
+// WithServiceRetryConfig sets the retry configuration for one service
+// (OrderService, PaymentService or ShippingService).
+func WithServiceRetryConfig(service string, cfg ServiceRetryConfig) Option {
+	return func(o *options) {
+		o.retry[service] = cfg
+	}
+}
+
+// DefaultKeepalive pings an idle connection every 30s so that proxies and
+// load balancers do not silently drop it, and closes it if a ping goes
+// unanswered for 10s so the next call reconnects instead of failing. The
+// services must accept pings this often (see server.DefaultKeepaliveMinTime);
+// gRPC's default enforcement refuses them and closes the connection.
+var DefaultKeepalive = keepalive.ClientParameters{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// WithKeepalive sets the keepalive pings sent on every connection (none by
+// default). A zero Time disables them; gRPC raises a Time below 10s to 10s.
+func WithKeepalive(params keepalive.ClientParameters) Option {
+	return func(o *options) {
+		o.keepalive = params
+	}
+}
+
+// WithDialOptions appends extra dial options to every connection, e.g. a
+// custom dialer for in-memory (bufconn) servers in tests.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+// WithAPIKey sends key as "x-api-key" metadata on every call to every
+// service, for services that require authentication.
+func WithAPIKey(key string) Option {
+	return func(o *options) {
+		for _, service := range []string{OrderService, PaymentService, ShippingService} {
+			o.apiKeys[service] = key
+		}
+	}
+}
+
+// WithServiceAPIKey sets the API key sent to one service, overriding WithAPIKey
+// if applied after it. An empty key sends none.
+func WithServiceAPIKey(service, key string) Option {
+	return func(o *options) {
+		o.apiKeys[service] = key
+	}
+}
+
+// DefaultActor is the actor the clients name themselves in calls by default
+// (see interceptors.ActorHeader).
+const DefaultActor = "saga-orchestrator"
+
+// WithActor sets the actor sent with calls whose context names none
+// (DefaultActor by default). An empty actor sends none.
+func WithActor(actor string) Option {
+	return func(o *options) {
+		o.actor = actor
+	}
+}
+
+// WithClock sets the clock used for retry backoff and breaker cool-downs
+// (the real clock by default).
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+func defaultOptions() *options {
+	return &options{
+		retry: map[string]ServiceRetryConfig{
+			OrderService:    DefaultServiceRetryConfig(),
+			PaymentService:  DefaultServiceRetryConfig(),
+			ShippingService: DefaultServiceRetryConfig(),
+		},
+		breakers: map[string]BreakerConfig{
+			OrderService:    DefaultBreakerConfig,
+			PaymentService:  DefaultBreakerConfig,
+			ShippingService: DefaultBreakerConfig,
+		},
+		apiKeys:  make(map[string]string),
+		actor:    DefaultActor,
+		poolSize: DefaultPoolSize,
+		clock:    clock.Real(),
+	}
+}
+
+// dialOptions returns the dial options for the given service.
+func (o *options) dialOptions(service string, breaker *CircuitBreaker) []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// The request ID interceptor runs first so every retry attempt shares the same ID.
+		// The breaker wraps the retries so one logical call counts as one outcome,
+		// and an open breaker fails fast without retrying.
+		grpc.WithChainUnaryInterceptor(
+			interceptors.RequestIDUnaryClientInterceptor(),
+			interceptors.TenantUnaryClientInterceptor(),
+			interceptors.ActorUnaryClientInterceptor(o.actor),
+			breaker.UnaryClientInterceptor(),
+			retryUnaryClientInterceptor(service, o.retry[service], o.clock),
+		),
+	}
+	if key := o.apiKeys[service]; key != "" {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(interceptors.APIKeyUnaryClientInterceptor(key)))
+	}
+	if o.keepalive.Time > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(o.keepalive))
+	}
+	return append(opts, o.dialOpts...)
 }
 
 // NewServiceClients creates and returns gRPC clients for the saga services.
-func NewServiceClients(orderAddr, paymentAddr, shippingAddr string) (*ServiceClients, error) {
-	// Establish connection to Order Service
-	orderConn, err := grpc.Dial(orderAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Printf("Failed to connect to Order Service at %s: %v", orderAddr, err)
-		return nil, err
-	}
-	orderClient := orderpb.NewOrderServiceClient(orderConn)
-	log.Printf("Connected to Order Service at %s", orderAddr)
-
-	// Establish connection to Payment Service
-	paymentConn, err := grpc.Dial(paymentAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Printf("Failed to connect to Payment Service at %s: %v", paymentAddr, err)
-		// Consider closing orderConn here if needed
-		return nil, err
-	}
-	paymentClient := paymentpb.NewPaymentServiceClient(paymentConn)
-	log.Printf("Connected to Payment Service at %s", paymentAddr)
-
-	// Establish connection to Shipping Service
-	shippingConn, err := grpc.Dial(shippingAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Printf("Failed to connect to Shipping Service at %s: %v", shippingAddr, err)
-		// Consider closing orderConn and paymentConn here if needed
-		return nil, err
-	}
-	shippingClient := shippingpb.NewShippingServiceClient(shippingConn)
-	log.Printf("Connected to Shipping Service at %s", shippingAddr)
-
-	return &ServiceClients{
-		Order:    orderClient,
-		Payment:  paymentClient,
-		Shipping: shippingClient,
-	}, nil
-
-	// Note: Connections should ideally be closed gracefully when the application shuts down.
-	// This basic example doesn't include connection closing logic.
+func NewServiceClients(orderAddr, paymentAddr, shippingAddr string, opts ...Option) (*ServiceClients, error) {
+	cfg := defaultOptions()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	c := &ServiceClients{
+		breakers: map[string]*CircuitBreaker{
+			OrderService:    NewCircuitBreaker(OrderService, cfg.breakers[OrderService], cfg.clock),
+			PaymentService:  NewCircuitBreaker(PaymentService, cfg.breakers[PaymentService], cfg.clock),
+			ShippingService: NewCircuitBreaker(ShippingService, cfg.breakers[ShippingService], cfg.clock),
+		},
+		pools: make(map[string]*connPool),
+		addrs: make(map[string]string),
+	}
+
+	// Establish connections to Order, Payment and Shipping Services (in that order)
+	targets := []struct{ service, addr string }{
+		{OrderService, orderAddr},
+		{PaymentService, paymentAddr},
+		{ShippingService, shippingAddr},
+	}
+	for _, t := range targets {
+		// Every connection of a service shares its circuit breaker
+		conns := make([]*grpc.ClientConn, 0, cfg.poolSize)
+		for range cfg.poolSize {
+			conn, err := grpc.NewClient(t.addr, cfg.dialOptions(t.service, c.breakers[t.service])...)
+			if err != nil {
+				log.Printf("Failed to create %s service client for %s: %v", t.service, t.addr, err)
+				c.pools[t.service] = newConnPool(conns) // Closed below
+				c.Close()
+				return nil, err
+			}
+			conns = append(conns, conn)
+		}
+		c.pools[t.service] = newConnPool(conns)
+		c.addrs[t.service] = t.addr
+		if cfg.poolSize > 1 {
+			log.Printf("Created %s service client for %s with %d connections", t.service, t.addr, cfg.poolSize)
+		} else {
+			log.Printf("Created %s service client for %s", t.service, t.addr)
+		}
+	}
+
+	if cfg.watchState {
+		var watchCtx context.Context
+		watchCtx, c.stopWatches = context.WithCancel(context.Background())
+		for service, pool := range c.pools {
+			for i, conn := range pool.conns {
+				name := service
+				if len(pool.conns) > 1 {
+					name = fmt.Sprintf("%s#%d", service, i)
+				}
+				go watchState(watchCtx, conn, name)
+			}
+		}
+	}
+
+	// grpc.NewClient does not connect; optionally make sure every service is actually reachable.
+	if cfg.readyTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.readyTimeout)
+		defer cancel()
+		if err := c.WaitReady(ctx); err != nil {
+			log.Printf("Downstream service not ready: %v", err)
+			c.Close()
+			return nil, err
+		}
+		log.Printf("All downstream services are ready")
+	}
+
+	c.Order = orderpb.NewOrderServiceClient(c.pools[OrderService])
+	c.Payment = paymentpb.NewPaymentServiceClient(c.pools[PaymentService])
+	c.Shipping = shippingpb.NewShippingServiceClient(c.pools[ShippingService])
+	return c, nil
+}
+
+// Close stops the state watchers and closes all underlying connections.
+func (c *ServiceClients) Close() error {
+	if c.stopWatches != nil {
+		c.stopWatches()
+	}
+	var firstErr error
+	for service, pool := range c.pools {
+		for _, conn := range pool.conns {
+			if err := conn.Close(); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("closing %s connection: %w", service, err)
+			}
+		}
+	}
+	return firstErr
 }
@@ -0,0 +1,143 @@
+// Package fakes provides programmable in-memory implementations of the saga
+// service clients, so orchestrator logic can be exercised without gRPC plumbing.
+// Each fake records its calls, can delay responses, and lets tests script
+// responses per method through the *Func fields.
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Method names recorded by the fakes.
+const (
+	CreateOrder               = "Order.CreateOrder"
+	CancelOrder               = "Order.CancelOrder"
+	CompleteOrder             = "Order.CompleteOrder"
+	ValidateOrder             = "Order.ValidateOrder"
+	GetOrder                  = "Order.GetOrder"
+	GetOrderByClientReference = "Order.GetOrderByClientReference"
+	ListOrders                = "Order.ListOrders"
+	GetOrdersByUser           = "Order.GetOrdersByUser"
+	ProcessPayment            = "Payment.ProcessPayment"
+	RefundPayment             = "Payment.RefundPayment"
+	ValidatePayment           = "Payment.ValidatePayment"
+	GetPayment                = "Payment.GetPayment"
+	ListPayments              = "Payment.ListPayments"
+	GetReceipt                = "Payment.GetReceipt"
+	ListRefunds               = "Payment.ListRefunds"
+	ArrangeShipping           = "Shipping.ArrangeShipping"
+	ReserveShipping           = "Shipping.ReserveShipping"
+	ConfirmShipping           = "Shipping.ConfirmShipping"
+	CancelShipping            = "Shipping.CancelShipping"
+	ValidateShipping          = "Shipping.ValidateShipping"
+	QuoteShipping             = "Shipping.QuoteShipping"
+	GetShipment               = "Shipping.GetShipment"
+	ListShipments             = "Shipping.ListShipments"
+	UpdateShippingAddress     = "Shipping.UpdateShippingAddress"
+	TrackShipment             = "Shipping.TrackShipment"
+	ExportManifest            = "Shipping.ExportManifest"
+)
+
+// Call is a single recorded RPC.
+type Call struct {
+	Method  string
+	Request proto.Message
+}
+
+// Recorder collects calls made against one or more fakes in the order they happened.
+// Share one Recorder between fakes to assert the exact cross-service call sequence.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) record(method string, req proto.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Request: proto.Clone(req)})
+}
+
+// Calls returns a copy of all recorded calls.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Methods returns the recorded method names in call order.
+func (r *Recorder) Methods() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	methods := make([]string, len(r.calls))
+	for i, c := range r.calls {
+		methods[i] = c.Method
+	}
+	return methods
+}
+
+// Reset forgets all recorded calls.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// Result is one scripted response.
+type Result[Resp any] struct {
+	Resp Resp
+	Err  error
+}
+
+// Script returns a handler that replays results in order; once exhausted it keeps
+// returning the last result. Use it to fill a fake's *Func field.
+func Script[Req, Resp any](results ...Result[Resp]) func(context.Context, Req) (Resp, error) {
+	var mu sync.Mutex
+	next := 0
+	return func(context.Context, Req) (Resp, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(results) == 0 {
+			var zero Resp
+			return zero, nil
+		}
+		r := results[next]
+		if next < len(results)-1 {
+			next++
+		}
+		return r.Resp, r.Err
+	}
+}
+
+// base holds the behaviour shared by every fake.
+type base struct {
+	Recorder *Recorder     // Optional; calls are recorded when set
+	Latency  time.Duration // Delay applied before every call, honouring ctx
+}
+
+// begin records the call and applies the configured latency.
+func (b *base) begin(ctx context.Context, method string, req proto.Message) error {
+	if b.Recorder != nil {
+		b.Recorder.record(method, req)
+	}
+	if b.Latency <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(b.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
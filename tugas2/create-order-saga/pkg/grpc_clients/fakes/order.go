@@ -0,0 +1,120 @@
+package fakes
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+// OrderClient is a fake Order service client. Nil *Func fields use a default
+// successful response.
+type OrderClient struct {
+	base
+	CreateOrderFunc   func(context.Context, *orderpb.CreateOrderRequest) (*orderpb.CreateOrderResponse, error)
+	CancelOrderFunc   func(context.Context, *orderpb.CancelOrderRequest) (*commonpb.CompensationResponse, error)
+	CompleteOrderFunc func(context.Context, *orderpb.CompleteOrderRequest) (*commonpb.CompensationResponse, error)
+	ValidateOrderFunc func(context.Context, *orderpb.ValidateOrderRequest) (*commonpb.ValidationResponse, error)
+	// GetOrderFunc defaults to a codes.NotFound error.
+	GetOrderFunc func(context.Context, *orderpb.GetOrderRequest) (*orderpb.Order, error)
+	// GetOrderByClientReferenceFunc defaults to a codes.NotFound error.
+	GetOrderByClientReferenceFunc func(context.Context, *orderpb.GetOrderByClientReferenceRequest) (*orderpb.Order, error)
+	ListOrdersFunc                func(context.Context, *orderpb.ListOrdersRequest) (*orderpb.ListOrdersResponse, error)
+	// GetOrdersByUserFunc defaults to a codes.Unimplemented error, as there is no stream to return.
+	GetOrdersByUserFunc func(context.Context, *orderpb.GetOrdersByUserRequest) (orderpb.OrderService_GetOrdersByUserClient, error)
+}
+
+// NewOrderClient creates a fake Order client recording into rec (which may be nil).
+func NewOrderClient(rec *Recorder) *OrderClient {
+	return &OrderClient{base: base{Recorder: rec}}
+}
+
+var _ orderpb.OrderServiceClient = (*OrderClient)(nil)
+
+func (f *OrderClient) CreateOrder(ctx context.Context, in *orderpb.CreateOrderRequest, _ ...grpc.CallOption) (*orderpb.CreateOrderResponse, error) {
+	if err := f.begin(ctx, CreateOrder, in); err != nil {
+		return nil, err
+	}
+	if f.CreateOrderFunc != nil {
+		return f.CreateOrderFunc(ctx, in)
+	}
+	return &orderpb.CreateOrderResponse{
+		OrderId:     &commonpb.OrderID{Id: "order-" + in.GetDetails().GetUserId()},
+		Status:      orderpb.OrderStatus_PENDING,
+		OrderNumber: "ORD-2024-000001",
+	}, nil
+}
+
+func (f *OrderClient) CancelOrder(ctx context.Context, in *orderpb.CancelOrderRequest, _ ...grpc.CallOption) (*commonpb.CompensationResponse, error) {
+	if err := f.begin(ctx, CancelOrder, in); err != nil {
+		return nil, err
+	}
+	if f.CancelOrderFunc != nil {
+		return f.CancelOrderFunc(ctx, in)
+	}
+	return &commonpb.CompensationResponse{Success: true, Message: "Order cancelled successfully", Code: commonpb.CompensationCode_COMPLETED}, nil
+}
+
+func (f *OrderClient) CompleteOrder(ctx context.Context, in *orderpb.CompleteOrderRequest, _ ...grpc.CallOption) (*commonpb.CompensationResponse, error) {
+	if err := f.begin(ctx, CompleteOrder, in); err != nil {
+		return nil, err
+	}
+	if f.CompleteOrderFunc != nil {
+		return f.CompleteOrderFunc(ctx, in)
+	}
+	return &commonpb.CompensationResponse{Success: true, Message: "Order completed", Code: commonpb.CompensationCode_COMPLETED}, nil
+}
+
+func (f *OrderClient) ValidateOrder(ctx context.Context, in *orderpb.ValidateOrderRequest, _ ...grpc.CallOption) (*commonpb.ValidationResponse, error) {
+	if err := f.begin(ctx, ValidateOrder, in); err != nil {
+		return nil, err
+	}
+	if f.ValidateOrderFunc != nil {
+		return f.ValidateOrderFunc(ctx, in)
+	}
+	return &commonpb.ValidationResponse{Valid: true}, nil
+}
+
+func (f *OrderClient) GetOrder(ctx context.Context, in *orderpb.GetOrderRequest, _ ...grpc.CallOption) (*orderpb.Order, error) {
+	if err := f.begin(ctx, GetOrder, in); err != nil {
+		return nil, err
+	}
+	if f.GetOrderFunc != nil {
+		return f.GetOrderFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.NotFound, "order %s not found", in.GetOrderId().GetId())
+}
+
+func (f *OrderClient) GetOrderByClientReference(ctx context.Context, in *orderpb.GetOrderByClientReferenceRequest, _ ...grpc.CallOption) (*orderpb.Order, error) {
+	if err := f.begin(ctx, GetOrderByClientReference, in); err != nil {
+		return nil, err
+	}
+	if f.GetOrderByClientReferenceFunc != nil {
+		return f.GetOrderByClientReferenceFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.NotFound, "no order with client reference %s", in.GetClientReferenceId())
+}
+
+func (f *OrderClient) ListOrders(ctx context.Context, in *orderpb.ListOrdersRequest, _ ...grpc.CallOption) (*orderpb.ListOrdersResponse, error) {
+	if err := f.begin(ctx, ListOrders, in); err != nil {
+		return nil, err
+	}
+	if f.ListOrdersFunc != nil {
+		return f.ListOrdersFunc(ctx, in)
+	}
+	return &orderpb.ListOrdersResponse{}, nil
+}
+
+func (f *OrderClient) GetOrdersByUser(ctx context.Context, in *orderpb.GetOrdersByUserRequest, _ ...grpc.CallOption) (orderpb.OrderService_GetOrdersByUserClient, error) {
+	if err := f.begin(ctx, GetOrdersByUser, in); err != nil {
+		return nil, err
+	}
+	if f.GetOrdersByUserFunc != nil {
+		return f.GetOrdersByUserFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "no orders stream for user %s", in.GetUserId())
+}
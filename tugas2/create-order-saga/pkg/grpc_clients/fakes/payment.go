@@ -0,0 +1,106 @@
+package fakes
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// PaymentClient is a fake Payment service client. Nil *Func fields use a default
+// successful response.
+type PaymentClient struct {
+	base
+	ProcessPaymentFunc  func(context.Context, *paymentpb.ProcessPaymentRequest) (*paymentpb.ProcessPaymentResponse, error)
+	RefundPaymentFunc   func(context.Context, *paymentpb.RefundPaymentRequest) (*commonpb.CompensationResponse, error)
+	ValidatePaymentFunc func(context.Context, *paymentpb.ValidatePaymentRequest) (*commonpb.ValidationResponse, error)
+	GetPaymentFunc      func(context.Context, *paymentpb.GetPaymentRequest) (*paymentpb.Payment, error)
+	ListPaymentsFunc    func(context.Context, *paymentpb.ListPaymentsRequest) (*paymentpb.ListPaymentsResponse, error)
+	GetReceiptFunc      func(context.Context, *paymentpb.GetReceiptRequest) (*paymentpb.Receipt, error)
+	ListRefundsFunc     func(context.Context, *paymentpb.ListRefundsRequest) (*paymentpb.ListRefundsResponse, error)
+}
+
+// NewPaymentClient creates a fake Payment client recording into rec (which may be nil).
+func NewPaymentClient(rec *Recorder) *PaymentClient {
+	return &PaymentClient{base: base{Recorder: rec}}
+}
+
+var _ paymentpb.PaymentServiceClient = (*PaymentClient)(nil)
+
+func (f *PaymentClient) ProcessPayment(ctx context.Context, in *paymentpb.ProcessPaymentRequest, _ ...grpc.CallOption) (*paymentpb.ProcessPaymentResponse, error) {
+	if err := f.begin(ctx, ProcessPayment, in); err != nil {
+		return nil, err
+	}
+	if f.ProcessPaymentFunc != nil {
+		return f.ProcessPaymentFunc(ctx, in)
+	}
+	return &paymentpb.ProcessPaymentResponse{
+		PaymentId: "pay-" + in.GetOrderId().GetId(),
+		Status:    paymentpb.PaymentStatus_SUCCESS,
+		Message:   "Payment processed successfully.",
+	}, nil
+}
+
+func (f *PaymentClient) RefundPayment(ctx context.Context, in *paymentpb.RefundPaymentRequest, _ ...grpc.CallOption) (*commonpb.CompensationResponse, error) {
+	if err := f.begin(ctx, RefundPayment, in); err != nil {
+		return nil, err
+	}
+	if f.RefundPaymentFunc != nil {
+		return f.RefundPaymentFunc(ctx, in)
+	}
+	return &commonpb.CompensationResponse{Success: true, Message: "Payment refunded successfully", Code: commonpb.CompensationCode_COMPLETED, Refunded: true}, nil
+}
+
+func (f *PaymentClient) ValidatePayment(ctx context.Context, in *paymentpb.ValidatePaymentRequest, _ ...grpc.CallOption) (*commonpb.ValidationResponse, error) {
+	if err := f.begin(ctx, ValidatePayment, in); err != nil {
+		return nil, err
+	}
+	if f.ValidatePaymentFunc != nil {
+		return f.ValidatePaymentFunc(ctx, in)
+	}
+	return &commonpb.ValidationResponse{Valid: true}, nil
+}
+
+func (f *PaymentClient) GetPayment(ctx context.Context, in *paymentpb.GetPaymentRequest, _ ...grpc.CallOption) (*paymentpb.Payment, error) {
+	if err := f.begin(ctx, GetPayment, in); err != nil {
+		return nil, err
+	}
+	if f.GetPaymentFunc != nil {
+		return f.GetPaymentFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.NotFound, "payment %s not found", in.GetPaymentId())
+}
+
+func (f *PaymentClient) ListPayments(ctx context.Context, in *paymentpb.ListPaymentsRequest, _ ...grpc.CallOption) (*paymentpb.ListPaymentsResponse, error) {
+	if err := f.begin(ctx, ListPayments, in); err != nil {
+		return nil, err
+	}
+	if f.ListPaymentsFunc != nil {
+		return f.ListPaymentsFunc(ctx, in)
+	}
+	return &paymentpb.ListPaymentsResponse{}, nil
+}
+
+func (f *PaymentClient) ListRefunds(ctx context.Context, in *paymentpb.ListRefundsRequest, _ ...grpc.CallOption) (*paymentpb.ListRefundsResponse, error) {
+	if err := f.begin(ctx, ListRefunds, in); err != nil {
+		return nil, err
+	}
+	if f.ListRefundsFunc != nil {
+		return f.ListRefundsFunc(ctx, in)
+	}
+	return &paymentpb.ListRefundsResponse{}, nil
+}
+
+func (f *PaymentClient) GetReceipt(ctx context.Context, in *paymentpb.GetReceiptRequest, _ ...grpc.CallOption) (*paymentpb.Receipt, error) {
+	if err := f.begin(ctx, GetReceipt, in); err != nil {
+		return nil, err
+	}
+	if f.GetReceiptFunc != nil {
+		return f.GetReceiptFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.NotFound, "payment %s not found", in.GetPaymentId())
+}
@@ -0,0 +1,161 @@
+package fakes
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// ShippingClient is a fake Shipping service client. Nil *Func fields use a default
+// successful response.
+type ShippingClient struct {
+	base
+	ArrangeShippingFunc       func(context.Context, *shippingpb.ArrangeShippingRequest) (*shippingpb.ArrangeShippingResponse, error)
+	ReserveShippingFunc       func(context.Context, *shippingpb.ArrangeShippingRequest) (*shippingpb.ArrangeShippingResponse, error)
+	ConfirmShippingFunc       func(context.Context, *shippingpb.ConfirmShippingRequest) (*shippingpb.ArrangeShippingResponse, error)
+	CancelShippingFunc        func(context.Context, *shippingpb.CancelShippingRequest) (*commonpb.CompensationResponse, error)
+	ValidateShippingFunc      func(context.Context, *shippingpb.ValidateShippingRequest) (*commonpb.ValidationResponse, error)
+	QuoteShippingFunc         func(context.Context, *shippingpb.QuoteShippingRequest) (*shippingpb.QuoteShippingResponse, error)
+	GetShipmentFunc           func(context.Context, *shippingpb.GetShipmentRequest) (*shippingpb.Shipment, error)
+	ListShipmentsFunc         func(context.Context, *shippingpb.ListShipmentsRequest) (*shippingpb.ListShipmentsResponse, error)
+	UpdateShippingAddressFunc func(context.Context, *shippingpb.UpdateShippingAddressRequest) (*shippingpb.Shipment, error)
+	TrackShipmentFunc         func(context.Context, *shippingpb.TrackShipmentRequest) (shippingpb.ShippingService_TrackShipmentClient, error)
+	ExportManifestFunc        func(context.Context, *shippingpb.ExportManifestRequest) (*shippingpb.ManifestResponse, error)
+}
+
+// NewShippingClient creates a fake Shipping client recording into rec (which may be nil).
+func NewShippingClient(rec *Recorder) *ShippingClient {
+	return &ShippingClient{base: base{Recorder: rec}}
+}
+
+var _ shippingpb.ShippingServiceClient = (*ShippingClient)(nil)
+
+func (f *ShippingClient) ArrangeShipping(ctx context.Context, in *shippingpb.ArrangeShippingRequest, _ ...grpc.CallOption) (*shippingpb.ArrangeShippingResponse, error) {
+	if err := f.begin(ctx, ArrangeShipping, in); err != nil {
+		return nil, err
+	}
+	if f.ArrangeShippingFunc != nil {
+		return f.ArrangeShippingFunc(ctx, in)
+	}
+	shipmentID := "ship-" + in.GetOrderId().GetId()
+	return &shippingpb.ArrangeShippingResponse{
+		ShipmentId:  shipmentID,
+		Status:      shippingpb.ShippingStatus_SHIPPED,
+		ShipmentIds: []string{shipmentID},
+	}, nil
+}
+
+func (f *ShippingClient) ReserveShipping(ctx context.Context, in *shippingpb.ArrangeShippingRequest, _ ...grpc.CallOption) (*shippingpb.ArrangeShippingResponse, error) {
+	if err := f.begin(ctx, ReserveShipping, in); err != nil {
+		return nil, err
+	}
+	if f.ReserveShippingFunc != nil {
+		return f.ReserveShippingFunc(ctx, in)
+	}
+	shipmentID := "ship-" + in.GetOrderId().GetId()
+	return &shippingpb.ArrangeShippingResponse{
+		ShipmentId:  shipmentID,
+		Status:      shippingpb.ShippingStatus_RESERVED,
+		ShipmentIds: []string{shipmentID},
+	}, nil
+}
+
+func (f *ShippingClient) ConfirmShipping(ctx context.Context, in *shippingpb.ConfirmShippingRequest, _ ...grpc.CallOption) (*shippingpb.ArrangeShippingResponse, error) {
+	if err := f.begin(ctx, ConfirmShipping, in); err != nil {
+		return nil, err
+	}
+	if f.ConfirmShippingFunc != nil {
+		return f.ConfirmShippingFunc(ctx, in)
+	}
+	resp := &shippingpb.ArrangeShippingResponse{Status: shippingpb.ShippingStatus_SHIPPED, ShipmentIds: in.GetShipmentIds()}
+	if len(resp.ShipmentIds) > 0 {
+		resp.ShipmentId = resp.ShipmentIds[0]
+	}
+	return resp, nil
+}
+
+func (f *ShippingClient) CancelShipping(ctx context.Context, in *shippingpb.CancelShippingRequest, _ ...grpc.CallOption) (*commonpb.CompensationResponse, error) {
+	if err := f.begin(ctx, CancelShipping, in); err != nil {
+		return nil, err
+	}
+	if f.CancelShippingFunc != nil {
+		return f.CancelShippingFunc(ctx, in)
+	}
+	return &commonpb.CompensationResponse{Success: true, Message: "Shipping cancelled successfully", Code: commonpb.CompensationCode_COMPLETED}, nil
+}
+
+func (f *ShippingClient) ValidateShipping(ctx context.Context, in *shippingpb.ValidateShippingRequest, _ ...grpc.CallOption) (*commonpb.ValidationResponse, error) {
+	if err := f.begin(ctx, ValidateShipping, in); err != nil {
+		return nil, err
+	}
+	if f.ValidateShippingFunc != nil {
+		return f.ValidateShippingFunc(ctx, in)
+	}
+	return &commonpb.ValidationResponse{Valid: true}, nil
+}
+
+func (f *ShippingClient) QuoteShipping(ctx context.Context, in *shippingpb.QuoteShippingRequest, _ ...grpc.CallOption) (*shippingpb.QuoteShippingResponse, error) {
+	if err := f.begin(ctx, QuoteShipping, in); err != nil {
+		return nil, err
+	}
+	if f.QuoteShippingFunc != nil {
+		return f.QuoteShippingFunc(ctx, in)
+	}
+	return &shippingpb.QuoteShippingResponse{Cost: money.New(money.DefaultCurrency, 0, 0)}, nil
+}
+
+func (f *ShippingClient) GetShipment(ctx context.Context, in *shippingpb.GetShipmentRequest, _ ...grpc.CallOption) (*shippingpb.Shipment, error) {
+	if err := f.begin(ctx, GetShipment, in); err != nil {
+		return nil, err
+	}
+	if f.GetShipmentFunc != nil {
+		return f.GetShipmentFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.NotFound, "shipment %s not found", in.GetShipmentId())
+}
+
+func (f *ShippingClient) ListShipments(ctx context.Context, in *shippingpb.ListShipmentsRequest, _ ...grpc.CallOption) (*shippingpb.ListShipmentsResponse, error) {
+	if err := f.begin(ctx, ListShipments, in); err != nil {
+		return nil, err
+	}
+	if f.ListShipmentsFunc != nil {
+		return f.ListShipmentsFunc(ctx, in)
+	}
+	return &shippingpb.ListShipmentsResponse{}, nil
+}
+
+func (f *ShippingClient) UpdateShippingAddress(ctx context.Context, in *shippingpb.UpdateShippingAddressRequest, _ ...grpc.CallOption) (*shippingpb.Shipment, error) {
+	if err := f.begin(ctx, UpdateShippingAddress, in); err != nil {
+		return nil, err
+	}
+	if f.UpdateShippingAddressFunc != nil {
+		return f.UpdateShippingAddressFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.NotFound, "shipment %s not found", in.GetShipmentId())
+}
+
+func (f *ShippingClient) TrackShipment(ctx context.Context, in *shippingpb.TrackShipmentRequest, _ ...grpc.CallOption) (shippingpb.ShippingService_TrackShipmentClient, error) {
+	if err := f.begin(ctx, TrackShipment, in); err != nil {
+		return nil, err
+	}
+	if f.TrackShipmentFunc != nil {
+		return f.TrackShipmentFunc(ctx, in)
+	}
+	return nil, status.Errorf(codes.NotFound, "shipment %s not found", in.GetShipmentId())
+}
+
+func (f *ShippingClient) ExportManifest(ctx context.Context, in *shippingpb.ExportManifestRequest, _ ...grpc.CallOption) (*shippingpb.ManifestResponse, error) {
+	if err := f.begin(ctx, ExportManifest, in); err != nil {
+		return nil, err
+	}
+	if f.ExportManifestFunc != nil {
+		return f.ExportManifestFunc(ctx, in)
+	}
+	return &shippingpb.ManifestResponse{}, nil
+}
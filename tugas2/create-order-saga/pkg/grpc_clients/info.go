@@ -0,0 +1,28 @@
+package grpc_clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	infopb "create-order-saga/proto/info"
+)
+
+// ServiceInfo asks every service for its build and version information (see
+// the InfoService), keyed by service name. Services that cannot answer, e.g.
+// builds predating the InfoService, are left out and their errors joined.
+func (c *ServiceClients) ServiceInfo(ctx context.Context) (map[string]*infopb.ServiceInfo, error) {
+	infos := make(map[string]*infopb.ServiceInfo, len(c.pools))
+	var errs []error
+	for _, service := range []string{OrderService, PaymentService, ShippingService} {
+		info, err := infopb.NewInfoServiceClient(c.pools[service]).GetInfo(ctx, &emptypb.Empty{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s service info: %w", service, err))
+			continue
+		}
+		infos[service] = info
+	}
+	return infos, errors.Join(errs...)
+}
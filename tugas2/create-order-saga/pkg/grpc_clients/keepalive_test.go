@@ -0,0 +1,80 @@
+package grpc_clients_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/test/bufconn"
+
+	"create-order-saga/internal/server"
+	"create-order-saga/pkg/grpc_clients"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// writeCounter is a connection counting the writes made on it.
+type writeCounter struct {
+	net.Conn
+	writes *atomic.Int64
+}
+
+func (c writeCounter) Write(b []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(b)
+}
+
+// TestKeepaliveIdleConnection leaves a connection idle for longer than the
+// keepalive interval against a server enforcing the services' policy: the
+// client pings it, the server accepts the pings, and the next call goes out
+// on the same connection. gRPC pings at most every 10s, so this takes a
+// while and is skipped in short mode.
+func TestKeepaliveIdleConnection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for a keepalive ping")
+	}
+	lis := bufconn.Listen(1 << 20)
+	counter := &connCounter{}
+	s := server.NewGRPCServer(server.Config{KeepaliveMinTime: server.DefaultKeepaliveMinTime, KeepaliveNoStream: true}, grpc.StatsHandler(counter))
+	paymentpb.RegisterPaymentServiceServer(s, &flakyPayment{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	var writes atomic.Int64
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		conn, err := lis.DialContext(ctx)
+		return writeCounter{conn, &writes}, err
+	})
+	clients, err := grpc_clients.NewServiceClients("passthrough:///order", "passthrough:///payment", "passthrough:///shipping",
+		grpc_clients.WithDialOptions(dialer),
+		grpc_clients.WithKeepalive(keepalive.ClientParameters{Time: 10 * time.Second, Timeout: time.Second, PermitWithoutStream: true}))
+	if err != nil {
+		t.Fatalf("NewServiceClients: %v", err)
+	}
+	defer clients.Close()
+
+	ctx := context.Background()
+	if _, err := clients.Payment.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: "pay-1"}); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	time.Sleep(time.Second) // For the last frames of the call to go out
+	before := writes.Load()
+	time.Sleep(11 * time.Second)
+
+	if writes.Load() == before {
+		t.Error("the client wrote nothing while idle, want a keepalive ping")
+	}
+	if state := clients.ConnState(grpc_clients.PaymentService); state != connectivity.Ready {
+		t.Errorf("connection after idling is %s, want READY", state)
+	}
+	if _, err := clients.Payment.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: "pay-1"}); err != nil {
+		t.Fatalf("call after idling: %v", err)
+	}
+	if got := counter.perConn(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("calls per connection = %v, want both on one connection", got)
+	}
+}
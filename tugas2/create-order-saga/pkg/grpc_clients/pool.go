@@ -0,0 +1,61 @@
+package grpc_clients
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// DefaultPoolSize is the number of connections opened to each service.
+const DefaultPoolSize = 1
+
+// connPool spreads calls to one service round-robin over several connections,
+// so a busy service is not limited by the concurrent stream limit of a single
+// HTTP/2 connection. It implements grpc.ClientConnInterface, so generated
+// clients can use it in place of a single connection.
+type connPool struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+	calls []atomic.Uint64 // Calls started on each connection
+}
+
+func newConnPool(conns []*grpc.ClientConn) *connPool {
+	return &connPool{conns: conns, calls: make([]atomic.Uint64, len(conns))}
+}
+
+// pick returns the next connection in turn.
+func (p *connPool) pick() *grpc.ClientConn {
+	i := int((p.next.Add(1) - 1) % uint64(len(p.conns)))
+	p.calls[i].Add(1)
+	return p.conns[i]
+}
+
+// Invoke performs a unary RPC on the next connection.
+func (p *connPool) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	return p.pick().Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream begins a streaming RPC on the next connection.
+func (p *connPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return p.pick().NewStream(ctx, desc, method, opts...)
+}
+
+// callCounts returns how many calls each connection has carried.
+func (p *connPool) callCounts() []uint64 {
+	counts := make([]uint64, len(p.calls))
+	for i := range p.calls {
+		counts[i] = p.calls[i].Load()
+	}
+	return counts
+}
+
+// PoolCalls returns how many calls each connection in a service's pool has
+// carried, in connection order, or nil for an unknown service.
+func (c *ServiceClients) PoolCalls(service string) []uint64 {
+	pool, ok := c.pools[service]
+	if !ok {
+		return nil
+	}
+	return pool.callCounts()
+}
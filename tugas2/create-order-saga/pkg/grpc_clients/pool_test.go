@@ -0,0 +1,113 @@
+package grpc_clients_test
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/test/bufconn"
+
+	"create-order-saga/pkg/grpc_clients"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// connKey is the context key under which connCounter tags connections.
+type connKey struct{}
+
+// connCounter is a server stats handler counting the RPCs received on each
+// connection, numbered in the order they were accepted.
+type connCounter struct {
+	mu    sync.Mutex
+	calls []int
+}
+
+func (c *connCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, 0)
+	return context.WithValue(ctx, connKey{}, len(c.calls)-1)
+}
+
+func (c *connCounter) HandleConn(context.Context, stats.ConnStats)                     {}
+func (c *connCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context { return ctx }
+
+func (c *connCounter) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	if _, ok := s.(*stats.Begin); !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[ctx.Value(connKey{}).(int)]++
+}
+
+// perConn returns the RPCs received on each connection so far.
+func (c *connCounter) perConn() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.calls)
+}
+
+// dialPooled serves a Payment service counting RPCs per connection and
+// returns clients for it opened with opts. The Order and Shipping addresses
+// lead nowhere; their connections are never used.
+func dialPooled(t *testing.T, opts ...grpc_clients.Option) (*grpc_clients.ServiceClients, *connCounter) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	counter := &connCounter{}
+	s := grpc.NewServer(grpc.StatsHandler(counter))
+	paymentpb.RegisterPaymentServiceServer(s, &flakyPayment{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) })
+	clients, err := grpc_clients.NewServiceClients("passthrough:///order", "passthrough:///payment", "passthrough:///shipping",
+		append([]grpc_clients.Option{grpc_clients.WithDialOptions(dialer)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewServiceClients: %v", err)
+	}
+	t.Cleanup(func() { clients.Close() })
+	return clients, counter
+}
+
+// TestPoolSpreadsCalls makes calls through a pool of three connections and
+// checks the server receives them on three connections, in equal shares.
+func TestPoolSpreadsCalls(t *testing.T) {
+	clients, counter := dialPooled(t, grpc_clients.WithPoolSize(3))
+	for range 9 {
+		if _, err := clients.Payment.GetPayment(context.Background(), &paymentpb.GetPaymentRequest{PaymentId: "pay-1"}); err != nil {
+			t.Fatalf("GetPayment: %v", err)
+		}
+	}
+	if got := counter.perConn(); !slices.Equal(got, []int{3, 3, 3}) {
+		t.Errorf("server received %v calls per connection, want 3 on each of 3", got)
+	}
+	if got := clients.PoolCalls(grpc_clients.PaymentService); !slices.Equal(got, []uint64{3, 3, 3}) {
+		t.Errorf("PoolCalls(payment) = %v, want [3 3 3]", got)
+	}
+	if got := clients.PoolCalls(grpc_clients.OrderService); !slices.Equal(got, []uint64{0, 0, 0}) {
+		t.Errorf("PoolCalls(order) = %v, want three idle connections", got)
+	}
+	if got := clients.PoolCalls("inventory"); got != nil {
+		t.Errorf("PoolCalls of an unknown service = %v, want nil", got)
+	}
+}
+
+// TestPoolDefaultSingleConnection checks calls share one connection unless
+// a pool size is set, and that sizes below 1 keep the default.
+func TestPoolDefaultSingleConnection(t *testing.T) {
+	for _, opts := range [][]grpc_clients.Option{nil, {grpc_clients.WithPoolSize(0)}} {
+		clients, counter := dialPooled(t, opts...)
+		for range 4 {
+			if _, err := clients.Payment.GetPayment(context.Background(), &paymentpb.GetPaymentRequest{PaymentId: "pay-1"}); err != nil {
+				t.Fatalf("GetPayment: %v", err)
+			}
+		}
+		if got := counter.perConn(); !slices.Equal(got, []int{4}) {
+			t.Errorf("server received %v calls per connection, want all 4 on one", got)
+		}
+	}
+}
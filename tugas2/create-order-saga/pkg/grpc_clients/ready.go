@@ -0,0 +1,179 @@
+package grpc_clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// healthServiceNames maps each service to the name it reports in the gRPC health API.
+var healthServiceNames = map[string]string{
+	OrderService:    orderpb.OrderService_ServiceDesc.ServiceName,
+	PaymentService:  paymentpb.PaymentService_ServiceDesc.ServiceName,
+	ShippingService: shippingpb.ShippingService_ServiceDesc.ServiceName,
+}
+
+// UnreachableError reports a downstream service that did not become ready in time.
+type UnreachableError struct {
+	Service   string
+	Addr      string
+	LastState connectivity.State
+	Err       error // Usually context.DeadlineExceeded
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("%s service at %s unreachable: %v (last state %s)", e.Service, e.Addr, e.Err, e.LastState)
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// NotServingError reports a reachable downstream service whose health check did
+// not report SERVING in time (e.g. it is draining during shutdown).
+type NotServingError struct {
+	Service string
+	Addr    string
+	Status  healthpb.HealthCheckResponse_ServingStatus
+	Err     error
+}
+
+func (e *NotServingError) Error() string {
+	return fmt.Sprintf("%s service at %s not serving: %v (last status %s)", e.Service, e.Addr, e.Err, e.Status)
+}
+
+func (e *NotServingError) Unwrap() error {
+	return e.Err
+}
+
+// waitForServing watches the service's health status until it reports SERVING or
+// ctx is done. Services that do not implement the health API are treated as serving.
+func waitForServing(ctx context.Context, conn *grpc.ClientConn, service, addr string) error {
+	watchCtx, cancel := context.WithCancel(ctx) // Ends the stream once we have an answer
+	defer cancel()
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	stream, err := healthpb.NewHealthClient(conn).Watch(watchCtx, &healthpb.HealthCheckRequest{Service: healthServiceNames[service]})
+	for err == nil {
+		var resp *healthpb.HealthCheckResponse
+		if resp, err = stream.Recv(); err == nil {
+			last = resp.GetStatus()
+			if last == healthpb.HealthCheckResponse_SERVING {
+				return nil
+			}
+			log.Printf("[%s] health status: %s, waiting", service, last)
+		}
+	}
+	if status.Code(err) == codes.Unimplemented {
+		log.Printf("[%s] health service not implemented, assuming serving", service)
+		return nil
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return &NotServingError{Service: service, Addr: addr, Status: last, Err: err}
+}
+
+// waitForReady triggers a connection attempt and blocks until conn is READY or ctx is done.
+func waitForReady(ctx context.Context, conn *grpc.ClientConn, service, addr string) error {
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return &UnreachableError{Service: service, Addr: addr, LastState: conn.GetState(), Err: ctx.Err()}
+		}
+	}
+}
+
+// WaitReady blocks until every service connection is READY and its health check
+// reports SERVING. It returns an *UnreachableError or *NotServingError naming the
+// first service that is not ready when ctx is done. The orchestrator calls this
+// before accepting traffic.
+func (c *ServiceClients) WaitReady(ctx context.Context) error {
+	for _, service := range []string{OrderService, PaymentService, ShippingService} {
+		pool, ok := c.pools[service]
+		if !ok {
+			continue
+		}
+		for _, conn := range pool.conns {
+			if err := waitForReady(ctx, conn, service, c.addrs[service]); err != nil {
+				return err
+			}
+		}
+		if err := waitForServing(ctx, pool.conns[0], service, c.addrs[service]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errNotServing is the cause of a *NotServingError from CheckHealth.
+var errNotServing = errors.New("health check did not report SERVING")
+
+// CheckHealth asks a service's health check for its current status once. It
+// fails with an *UnreachableError if the service cannot be reached, or a
+// *NotServingError if it is not SERVING. Services that do not implement the
+// health API count as serving. The check uses a health watch stream, so it
+// bypasses the unary retry and circuit breaker interceptors.
+func (c *ServiceClients) CheckHealth(ctx context.Context, service string) error {
+	pool, ok := c.pools[service]
+	if !ok || len(pool.conns) == 0 {
+		return fmt.Errorf("unknown service %q", service)
+	}
+	watchCtx, cancel := context.WithCancel(ctx) // Ends the stream once we have an answer
+	defer cancel()
+	stream, err := healthpb.NewHealthClient(pool.conns[0]).Watch(watchCtx, &healthpb.HealthCheckRequest{Service: healthServiceNames[service]})
+	var resp *healthpb.HealthCheckResponse
+	if err == nil {
+		resp, err = stream.Recv()
+	}
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		return nil
+	case err != nil:
+		return &UnreachableError{Service: service, Addr: c.addrs[service], LastState: c.ConnState(service), Err: err}
+	case resp.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+		return &NotServingError{Service: service, Addr: c.addrs[service], Status: resp.GetStatus(), Err: errNotServing}
+	}
+	return nil
+}
+
+// ConnState returns the current connectivity state of a service's connection
+// (READY if any connection of its pool is), or connectivity.Shutdown for an
+// unknown service.
+func (c *ServiceClients) ConnState(service string) connectivity.State {
+	pool, ok := c.pools[service]
+	if !ok || len(pool.conns) == 0 {
+		return connectivity.Shutdown
+	}
+	for _, conn := range pool.conns {
+		if state := conn.GetState(); state == connectivity.Ready {
+			return state
+		}
+	}
+	return pool.conns[0].GetState()
+}
+
+// watchState logs every connectivity state transition of conn until ctx is done.
+func watchState(ctx context.Context, conn *grpc.ClientConn, service string) {
+	state := conn.GetState()
+	log.Printf("[%s] connection state: %s", service, state)
+	for conn.WaitForStateChange(ctx, state) {
+		next := conn.GetState()
+		log.Printf("[%s] connection state: %s -> %s", service, state, next)
+		state = next
+	}
+}
@@ -0,0 +1,166 @@
+package grpc_clients_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"create-order-saga/pkg/grpc_clients"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// serveHealth serves a health check reporting serviceName as st on addr
+// ("127.0.0.1:0" for any free port) and returns the server and the address
+// it listens on.
+func serveHealth(t *testing.T, addr, serviceName string, st healthpb.HealthCheckResponse_ServingStatus) (*grpc.Server, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listening on %s: %v", addr, err)
+	}
+	s := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus(serviceName, st)
+	healthpb.RegisterHealthServer(s, hs)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return s, lis.Addr().String()
+}
+
+// closedAddr returns a local address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	return addr
+}
+
+// TestWaitForReadyUnreachable points the Payment client at a closed port and
+// checks NewServiceClients fails with an *UnreachableError naming it, while
+// the same setup with every service up succeeds.
+func TestWaitForReadyUnreachable(t *testing.T) {
+	_, orderAddr := serveHealth(t, "127.0.0.1:0", orderpb.OrderService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	_, shippingAddr := serveHealth(t, "127.0.0.1:0", shippingpb.ShippingService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	paymentAddr := closedAddr(t)
+
+	start := time.Now()
+	clients, err := grpc_clients.NewServiceClients(orderAddr, paymentAddr, shippingAddr, grpc_clients.WithWaitForReady(300*time.Millisecond))
+	if err == nil {
+		clients.Close()
+		t.Fatal("NewServiceClients succeeded with the Payment service down")
+	}
+	var unreachable *grpc_clients.UnreachableError
+	if !errors.As(err, &unreachable) || unreachable.Service != grpc_clients.PaymentService || unreachable.Addr != paymentAddr {
+		t.Fatalf("error = %v, want an *UnreachableError for payment at %s", err, paymentAddr)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "payment service at "+paymentAddr+" unreachable") {
+		t.Errorf("error = %q, want the payment service named as unreachable past the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("NewServiceClients took %v, want about the 300ms ready timeout", elapsed)
+	}
+
+	_, paymentAddr = serveHealth(t, "127.0.0.1:0", paymentpb.PaymentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	clients, err = grpc_clients.NewServiceClients(orderAddr, paymentAddr, shippingAddr, grpc_clients.WithWaitForReady(5*time.Second))
+	if err != nil {
+		t.Fatalf("NewServiceClients with every service up: %v", err)
+	}
+	clients.Close()
+}
+
+// TestWaitForReadyNotServing checks a reachable service whose health check
+// does not report SERVING fails readiness with a *NotServingError naming it.
+func TestWaitForReadyNotServing(t *testing.T) {
+	_, orderAddr := serveHealth(t, "127.0.0.1:0", orderpb.OrderService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	_, paymentAddr := serveHealth(t, "127.0.0.1:0", paymentpb.PaymentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	_, shippingAddr := serveHealth(t, "127.0.0.1:0", shippingpb.ShippingService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	_, err := grpc_clients.NewServiceClients(orderAddr, paymentAddr, shippingAddr, grpc_clients.WithWaitForReady(300*time.Millisecond))
+	var notServing *grpc_clients.NotServingError
+	if !errors.As(err, &notServing) || notServing.Service != grpc_clients.ShippingService || notServing.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("error = %v, want a *NotServingError for shipping", err)
+	}
+}
+
+// waitState polls ConnState until service's connection is in one of states,
+// failing the test after a few seconds.
+func waitState(t *testing.T, c *grpc_clients.ServiceClients, service string, states ...connectivity.State) connectivity.State {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state := c.ConnState(service)
+		if slices.Contains(states, state) {
+			return state
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s connection is %s, want one of %v", service, state, states)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestConnStateServerRestart stops the Payment server under a ready client
+// and starts it again on the same address: ConnState follows the connection
+// from READY to not ready and back, CheckHealth fails while the server is
+// down, and WaitReady reconnects once it is up.
+func TestConnStateServerRestart(t *testing.T) {
+	_, orderAddr := serveHealth(t, "127.0.0.1:0", orderpb.OrderService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	_, shippingAddr := serveHealth(t, "127.0.0.1:0", shippingpb.ShippingService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	payment, paymentAddr := serveHealth(t, "127.0.0.1:0", paymentpb.PaymentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	clients, err := grpc_clients.NewServiceClients(orderAddr, paymentAddr, shippingAddr, grpc_clients.WithStateWatcher())
+	if err != nil {
+		t.Fatalf("NewServiceClients: %v", err)
+	}
+	defer clients.Close()
+	if state := clients.ConnState(grpc_clients.PaymentService); state != connectivity.Idle {
+		t.Errorf("payment connection before any call is %s, want IDLE", state)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := clients.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady: %v", err)
+	}
+	if state := clients.ConnState(grpc_clients.PaymentService); state != connectivity.Ready {
+		t.Fatalf("payment connection after WaitReady is %s, want READY", state)
+	}
+
+	payment.Stop()
+	waitState(t, clients, grpc_clients.PaymentService, connectivity.Idle, connectivity.Connecting, connectivity.TransientFailure)
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelCheck()
+	var unreachable *grpc_clients.UnreachableError
+	if err := clients.CheckHealth(checkCtx, grpc_clients.PaymentService); !errors.As(err, &unreachable) || unreachable.Service != grpc_clients.PaymentService {
+		t.Errorf("CheckHealth with the server down = %v, want an *UnreachableError for payment", err)
+	}
+	if state := clients.ConnState(grpc_clients.OrderService); state != connectivity.Ready {
+		t.Errorf("order connection is %s, want it unaffected", state)
+	}
+
+	serveHealth(t, paymentAddr, paymentpb.PaymentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	if err := clients.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady after the restart: %v", err)
+	}
+	waitState(t, clients, grpc_clients.PaymentService, connectivity.Ready)
+	if err := clients.CheckHealth(ctx, grpc_clients.PaymentService); err != nil {
+		t.Errorf("CheckHealth after the restart: %v", err)
+	}
+	if state := clients.ConnState("inventory"); state != connectivity.Shutdown {
+		t.Errorf("ConnState of an unknown service = %s, want SHUTDOWN", state)
+	}
+}
@@ -0,0 +1,245 @@
+package grpc_clients
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/clock"
+)
+
+// RetryPolicy controls how a single unary RPC is retried and timed out.
+type RetryPolicy struct {
+	MaxAttempts    int           // Total attempts including the first one (1 disables retries)
+	InitialBackoff time.Duration // Backoff before the first retry
+	MaxBackoff     time.Duration // Upper bound for the backoff between attempts
+	Multiplier     float64       // Growth factor applied to the backoff after each retry
+	Timeout        time.Duration // Per-attempt timeout used when the caller's context has no deadline
+}
+
+// ServiceRetryConfig holds the retry policies for one downstream service.
+// Compensation RPCs use their own (usually more aggressive) policy because
+// a failed compensation leaves the system inconsistent.
+type ServiceRetryConfig struct {
+	Forward      RetryPolicy
+	Compensation RetryPolicy
+}
+
+// DefaultForwardPolicy is used for forward saga steps (CreateOrder, ReserveShipping, ...).
+var DefaultForwardPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     1 * time.Second,
+	Multiplier:     2,
+	Timeout:        5 * time.Second,
+}
+
+// DefaultCompensationPolicy is used for compensation RPCs (CancelOrder, RefundPayment, CancelShipping).
+var DefaultCompensationPolicy = RetryPolicy{
+	MaxAttempts:    6,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     3 * time.Second,
+	Multiplier:     2,
+	Timeout:        5 * time.Second,
+}
+
+// DefaultServiceRetryConfig returns the retry configuration used when none is specified.
+func DefaultServiceRetryConfig() ServiceRetryConfig {
+	return ServiceRetryConfig{
+		Forward:      DefaultForwardPolicy,
+		Compensation: DefaultCompensationPolicy,
+	}
+}
+
+// compensationMethods lists the full gRPC method names of compensation actions.
+var compensationMethods = map[string]bool{
+	"/order.OrderService/CancelOrder":          true,
+	"/payment.PaymentService/RefundPayment":    true,
+	"/shipping.ShippingService/CancelShipping": true,
+}
+
+// IsCompensationMethod reports whether the full gRPC method name is a compensation RPC.
+func IsCompensationMethod(method string) bool {
+	return compensationMethods[method]
+}
+
+// nonIdempotentMethods lists the full gRPC method names that must never be
+// retried: a timeout may hide a call that succeeded, and repeating it would
+// do it again. ProcessPayment has no request ID to deduplicate by, so a
+// retry could charge the customer twice.
+var nonIdempotentMethods = map[string]bool{
+	"/payment.PaymentService/ProcessPayment": true,
+}
+
+// IsRetrySafe reports whether the full gRPC method name may be retried.
+func IsRetrySafe(method string) bool {
+	return !nonIdempotentMethods[method]
+}
+
+// retryCallOption carries a per-call RetryPolicy override through grpc.CallOption.
+type retryCallOption struct {
+	grpc.EmptyCallOption
+	policy RetryPolicy
+}
+
+// WithRetryPolicy overrides the retry policy for a single call.
+func WithRetryPolicy(p RetryPolicy) grpc.CallOption {
+	return retryCallOption{policy: p}
+}
+
+// WithoutRetry disables retries for a single call.
+func WithoutRetry() grpc.CallOption {
+	return retryCallOption{policy: RetryPolicy{MaxAttempts: 1}}
+}
+
+type retryPolicyKey struct{}
+
+// ContextWithRetryPolicy returns a context that overrides the retry policy for
+// every call made with it. A grpc.CallOption override takes precedence.
+func ContextWithRetryPolicy(ctx context.Context, p RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// RetryUnaryClientInterceptor returns an interceptor that applies a default
+// timeout to calls without a deadline and retries calls failing with
+// codes.Unavailable using jittered exponential backoff. Methods that are not
+// retry-safe (see IsRetrySafe) are called once whatever the policy. Calls refused with
+// codes.ResourceExhausted are retried too when the error carries a RetryInfo
+// detail; any hinted wait is used instead of the backoff. Forward calls stop
+// retrying early once the context's RetryBudget (if any) is exhausted.
+func RetryUnaryClientInterceptor(service string, cfg ServiceRetryConfig) grpc.UnaryClientInterceptor {
+	return retryUnaryClientInterceptor(service, cfg, clock.Real())
+}
+
+func retryUnaryClientInterceptor(service string, cfg ServiceRetryConfig, clk clock.Clock) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy := cfg.Forward
+		if IsCompensationMethod(method) {
+			policy = cfg.Compensation
+		}
+		if p, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy); ok {
+			policy = p
+		}
+		// Strip our own call options so they are not passed to the invoker.
+		callOpts := make([]grpc.CallOption, 0, len(opts))
+		for _, opt := range opts {
+			if r, ok := opt.(retryCallOption); ok {
+				policy = r.policy
+				continue
+			}
+			callOpts = append(callOpts, opt)
+		}
+		if policy.MaxAttempts < 1 || !IsRetrySafe(method) {
+			policy.MaxAttempts = 1
+		}
+		var budget *RetryBudget
+		if !IsCompensationMethod(method) {
+			budget, _ = RetryBudgetFromContext(ctx)
+		}
+
+		backoff := policy.InitialBackoff
+		var err error
+		var retryStart time.Time // When the current retry's backoff began; zero for the first attempt
+		for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+			err = invokeWithTimeout(ctx, policy.Timeout, method, req, reply, cc, invoker, callOpts...)
+			if !retryStart.IsZero() {
+				budget.charge(clk.Now().Sub(retryStart))
+			}
+			if err == nil || attempt == policy.MaxAttempts {
+				return err
+			}
+			hint, hinted, ok := retryable(err)
+			if !ok {
+				return err
+			}
+
+			code := status.Code(err)
+			wait := jitter(backoff)
+			if hinted {
+				wait = hint
+			}
+			if !budget.reserve(wait) {
+				log.Printf("[%s] %s attempt %d/%d failed with %s, retry budget exhausted (%s): %v", service, method, attempt, policy.MaxAttempts, code, budget, err)
+				return err
+			}
+			if budget != nil {
+				log.Printf("[%s] %s attempt %d/%d failed with %s, retrying in %v (budget: %s): %v", service, method, attempt, policy.MaxAttempts, code, wait, budget, err)
+			} else {
+				log.Printf("[%s] %s attempt %d/%d failed with %s, retrying in %v: %v", service, method, attempt, policy.MaxAttempts, code, wait, err)
+			}
+			retryStart = clk.Now()
+			select {
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			case <-clk.After(wait):
+			}
+			backoff = nextBackoff(backoff, policy)
+		}
+		return err
+	}
+}
+
+// invokeWithTimeout calls the invoker, adding the timeout only if ctx has no deadline.
+func invokeWithTimeout(ctx context.Context, timeout time.Duration, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// RetryDelay returns the wait hinted by the RetryInfo detail of a status
+// error, e.g. one refused by a rate limit, if it carries one.
+func RetryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return max(info.GetRetryDelay().AsDuration(), 0), true
+		}
+	}
+	return 0, false
+}
+
+// retryable reports whether a failed attempt may be retried, and the wait
+// its error hints at if any: Unavailable errors always are, ResourceExhausted
+// ones only when they say how long to wait.
+func retryable(err error) (hint time.Duration, hinted, ok bool) {
+	hint, hinted = RetryDelay(err)
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return hint, hinted, true
+	case codes.ResourceExhausted:
+		return hint, hinted, hinted
+	}
+	return 0, false, false
+}
+
+// jitter returns a random duration in [d/2, d) to avoid retry storms.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)))
+}
+
+func nextBackoff(current time.Duration, p RetryPolicy) time.Duration {
+	if p.Multiplier < 1 {
+		return current
+	}
+	next := time.Duration(float64(current) * p.Multiplier)
+	if p.MaxBackoff > 0 && next > p.MaxBackoff {
+		next = p.MaxBackoff
+	}
+	return next
+}
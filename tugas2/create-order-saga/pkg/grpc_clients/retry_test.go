@@ -0,0 +1,234 @@
+package grpc_clients_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"create-order-saga/pkg/grpc_clients"
+	commonpb "create-order-saga/proto/common"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// flakyPayment fails the first failures calls of every RPC with code, then
+// succeeds, counting the calls it receives. A non-zero hint is attached to
+// the failures as a RetryInfo detail.
+type flakyPayment struct {
+	paymentpb.UnimplementedPaymentServiceServer
+	failures int32
+	code     codes.Code
+	hint     time.Duration
+	calls    atomic.Int32
+}
+
+func (f *flakyPayment) fail() error {
+	if f.calls.Add(1) > f.failures {
+		return nil
+	}
+	st := status.New(f.code, "flaky")
+	if f.hint != 0 {
+		st, _ = st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(f.hint)})
+	}
+	return st.Err()
+}
+
+func (f *flakyPayment) ProcessPayment(context.Context, *paymentpb.ProcessPaymentRequest) (*paymentpb.ProcessPaymentResponse, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return &paymentpb.ProcessPaymentResponse{Status: paymentpb.PaymentStatus_SUCCESS}, nil
+}
+
+func (f *flakyPayment) RefundPayment(context.Context, *paymentpb.RefundPaymentRequest) (*commonpb.CompensationResponse, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return &commonpb.CompensationResponse{Success: true}, nil
+}
+
+func (f *flakyPayment) GetPayment(context.Context, *paymentpb.GetPaymentRequest) (*paymentpb.Payment, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return &paymentpb.Payment{}, nil
+}
+
+// fastRetries retries 3 times in both directions with negligible backoff.
+var fastRetries = grpc_clients.ServiceRetryConfig{
+	Forward:      grpc_clients.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Timeout: time.Second},
+	Compensation: grpc_clients.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Timeout: time.Second},
+}
+
+// dialFlaky serves impl on a bufconn listener and returns a Payment client
+// whose calls go through the retry interceptor.
+func dialFlaky(t *testing.T, impl *flakyPayment) paymentpb.PaymentServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	paymentpb.RegisterPaymentServiceServer(s, impl)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///payment",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithUnaryInterceptor(grpc_clients.RetryUnaryClientInterceptor(grpc_clients.PaymentService, fastRetries)),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return paymentpb.NewPaymentServiceClient(conn)
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		failures  int32
+		code      codes.Code
+		call      func(context.Context, paymentpb.PaymentServiceClient) error
+		wantCode  codes.Code
+		wantCalls int32
+	}{
+		{
+			name: "compensation retried until it succeeds", failures: 2, code: codes.Unavailable,
+			call: func(ctx context.Context, c paymentpb.PaymentServiceClient) error {
+				_, err := c.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{PaymentId: "pay-1"})
+				return err
+			},
+			wantCode: codes.OK, wantCalls: 3,
+		},
+		{
+			name: "idempotent forward call retried until it succeeds", failures: 1, code: codes.Unavailable,
+			call: func(ctx context.Context, c paymentpb.PaymentServiceClient) error {
+				_, err := c.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: "pay-1"})
+				return err
+			},
+			wantCode: codes.OK, wantCalls: 2,
+		},
+		{
+			name: "attempts exhausted", failures: 5, code: codes.Unavailable,
+			call: func(ctx context.Context, c paymentpb.PaymentServiceClient) error {
+				_, err := c.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: "pay-1"})
+				return err
+			},
+			wantCode: codes.Unavailable, wantCalls: 3,
+		},
+		{
+			name: "ProcessPayment never retried", failures: 1, code: codes.Unavailable,
+			call: func(ctx context.Context, c paymentpb.PaymentServiceClient) error {
+				_, err := c.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{})
+				return err
+			},
+			wantCode: codes.Unavailable, wantCalls: 1,
+		},
+		{
+			name: "ProcessPayment not retried under a per-call policy", failures: 1, code: codes.Unavailable,
+			call: func(ctx context.Context, c paymentpb.PaymentServiceClient) error {
+				_, err := c.ProcessPayment(ctx, &paymentpb.ProcessPaymentRequest{}, grpc_clients.WithRetryPolicy(fastRetries.Forward))
+				return err
+			},
+			wantCode: codes.Unavailable, wantCalls: 1,
+		},
+		{
+			name: "non-transient error not retried", failures: 1, code: codes.InvalidArgument,
+			call: func(ctx context.Context, c paymentpb.PaymentServiceClient) error {
+				_, err := c.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{PaymentId: "pay-1"})
+				return err
+			},
+			wantCode: codes.InvalidArgument, wantCalls: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			impl := &flakyPayment{failures: tc.failures, code: tc.code}
+			client := dialFlaky(t, impl)
+			err := tc.call(context.Background(), client)
+			if got := status.Code(err); got != tc.wantCode {
+				t.Errorf("call returned %v, want %s", err, tc.wantCode)
+			}
+			if got := impl.calls.Load(); got != tc.wantCalls {
+				t.Errorf("server received %d calls, want %d", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// TestRetryInterceptorHint fails a call once with a RetryInfo hint: the
+// interceptor waits about the hinted time instead of its own backoff, longer
+// or shorter, and a ResourceExhausted refusal without a hint is not retried.
+func TestRetryInterceptorHint(t *testing.T) {
+	slow := grpc_clients.RetryPolicy{MaxAttempts: 3, InitialBackoff: 5 * time.Second, Multiplier: 2, Timeout: time.Second}
+	for _, tc := range []struct {
+		name      string
+		code      codes.Code
+		hint      time.Duration
+		opts      []grpc.CallOption
+		wantCalls int32
+		wantWait  time.Duration // About how long the call takes
+	}{
+		{name: "rate limited, hint over the backoff", code: codes.ResourceExhausted, hint: 300 * time.Millisecond, wantCalls: 2, wantWait: 300 * time.Millisecond},
+		{name: "unavailable, hint under the backoff", code: codes.Unavailable, hint: 50 * time.Millisecond, opts: []grpc.CallOption{grpc_clients.WithRetryPolicy(slow)}, wantCalls: 2, wantWait: 50 * time.Millisecond},
+		{name: "rate limited without a hint", code: codes.ResourceExhausted, wantCalls: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			impl := &flakyPayment{failures: 1, code: tc.code, hint: tc.hint}
+			client := dialFlaky(t, impl)
+			start := time.Now()
+			_, err := client.GetPayment(context.Background(), &paymentpb.GetPaymentRequest{PaymentId: "pay-1"}, tc.opts...)
+			elapsed := time.Since(start)
+			if got := impl.calls.Load(); got != tc.wantCalls {
+				t.Errorf("server received %d calls, want %d", got, tc.wantCalls)
+			}
+			if tc.wantCalls == 1 {
+				if status.Code(err) != tc.code {
+					t.Errorf("call returned %v, want %s", err, tc.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("call after the hinted wait: %v", err)
+			}
+			if elapsed < tc.wantWait || elapsed > tc.wantWait+500*time.Millisecond {
+				t.Errorf("call took %v, want about the %v hint", elapsed, tc.wantWait)
+			}
+		})
+	}
+}
+
+// TestRetryDelay checks the hint is read from a status error's RetryInfo.
+func TestRetryDelay(t *testing.T) {
+	hinted := func(d time.Duration) error {
+		st, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(d)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st.Err()
+	}
+	for _, tc := range []struct {
+		name   string
+		err    error
+		want   time.Duration
+		wantOK bool
+	}{
+		{"hint", hinted(1500 * time.Millisecond), 1500 * time.Millisecond, true},
+		{"negative hint", hinted(-time.Second), 0, true},
+		{"no detail", status.Error(codes.ResourceExhausted, "slow down"), 0, false},
+		{"not a status", context.Canceled, 0, false},
+		{"nil", nil, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, ok := grpc_clients.RetryDelay(tc.err); got != tc.want || ok != tc.wantOK {
+				t.Errorf("RetryDelay = %v, %t; want %v, %t", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package ids generates the IDs of new records (orders, payments, shipments,
+// sagas) so that tests can make them predictable.
+package ids
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Generator creates the ID of a new record. kind names the type of record and
+// is used as the ID's prefix ("order", "pay", "ship", "saga"); key is what the
+// record is created for, e.g. the user ID of an order or the order ID of a
+// payment, and is empty if there is nothing natural to key on.
+type Generator interface {
+	NewID(kind, key string) string
+}
+
+// Derived returns a Generator building IDs as "<kind>-<key>", the services'
+// default scheme: a retried request for the same key maps to the same record.
+// An empty key falls back to a random ID.
+func Derived() Generator {
+	return derived{}
+}
+
+type derived struct{}
+
+func (derived) NewID(kind, key string) string {
+	if key == "" {
+		return randomID(kind)
+	}
+	return kind + "-" + key
+}
+
+// Random returns a Generator building "<kind>-<uuid>" IDs from random
+// (version 4) UUIDs, ignoring the key.
+func Random() Generator {
+	return random{}
+}
+
+type random struct{}
+
+func (random) NewID(kind, _ string) string {
+	return randomID(kind)
+}
+
+func randomID(kind string) string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%s-%x-%x-%x-%x-%x", kind, b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Parse returns the Generator named by scheme, for flags: "derived",
+// "random" (or "uuid"), "ulid" or "sequence".
+func Parse(scheme string) (Generator, error) {
+	switch scheme {
+	case "derived":
+		return Derived(), nil
+	case "random", "uuid":
+		return Random(), nil
+	case "ulid":
+		return ULID(nil), nil
+	case "sequence":
+		return NewSequence(), nil
+	default:
+		return nil, fmt.Errorf("unknown ID scheme %q: want derived, random, ulid or sequence", scheme)
+	}
+}
+
+// Sequence is a Generator numbering the IDs of each kind from 1, e.g.
+// "order-1", "order-2", "pay-1", ignoring the key. It is safe for concurrent use.
+type Sequence struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+// NewSequence creates a Sequence starting at 1 for every kind.
+func NewSequence() *Sequence {
+	return &Sequence{next: make(map[string]int)}
+}
+
+// NewID returns the next ID of kind.
+func (s *Sequence) NewID(kind, _ string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next[kind]++
+	return kind + "-" + strconv.Itoa(s.next[kind])
+}
@@ -0,0 +1,123 @@
+package ids_test
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"create-order-saga/pkg/ids"
+)
+
+// TestSequence checks a Sequence numbers each kind from 1 without gaps,
+// ignoring the key.
+func TestSequence(t *testing.T) {
+	seq := ids.NewSequence()
+	for i := 1; i <= 3; i++ {
+		if got, want := seq.NewID("order", "user-1"), "order-"+strconv.Itoa(i); got != want {
+			t.Errorf("order ID %d = %q, want %q", i, got, want)
+		}
+	}
+	if got := seq.NewID("pay", ""); got != "pay-1" {
+		t.Errorf("first pay ID = %q, want pay-1", got)
+	}
+	if got := seq.NewID("order", ""); got != "order-4" {
+		t.Errorf("order ID after another kind = %q, want order-4", got)
+	}
+}
+
+// TestSequenceConcurrent draws IDs from several goroutines: each sees its IDs
+// strictly increasing, and together they use every number once.
+func TestSequenceConcurrent(t *testing.T) {
+	const workers, perWorker = 8, 1000
+	seq := ids.NewSequence()
+	got := make([][]int, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				n, err := strconv.Atoi(strings.TrimPrefix(seq.NewID("saga", ""), "saga-"))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				got[w] = append(got[w], n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for w, ns := range got {
+		for i, n := range ns {
+			if i > 0 && n <= ns[i-1] {
+				t.Fatalf("worker %d got %d after %d", w, n, ns[i-1])
+			}
+			seen[n] = true
+		}
+	}
+	for n := 1; n <= workers*perWorker; n++ {
+		if !seen[n] {
+			t.Fatalf("saga-%d was never generated", n)
+		}
+	}
+}
+
+// TestDerived checks Derived keys IDs on what they are created for, and
+// falls back to a random ID without a key.
+func TestDerived(t *testing.T) {
+	g := ids.Derived()
+	if got := g.NewID("pay", "order-7"); got != "pay-order-7" {
+		t.Errorf("NewID(pay, order-7) = %q, want pay-order-7", got)
+	}
+	if a, b := g.NewID("saga", ""), g.NewID("saga", ""); !uuidID.MatchString(a) || a == b {
+		t.Errorf("keyless IDs %q and %q, want distinct random saga IDs", a, b)
+	}
+}
+
+// uuidID matches "saga-" and a version 4 UUID.
+var uuidID = regexp.MustCompile(`^saga-[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// TestRandom checks Random builds distinct version 4 UUIDs whatever the key.
+func TestRandom(t *testing.T) {
+	g := ids.Random()
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := g.NewID("saga", "same-key")
+		if !uuidID.MatchString(id) || seen[id] {
+			t.Fatalf("NewID = %q, want a new saga-<uuid v4>", id)
+		}
+		seen[id] = true
+	}
+}
+
+// TestParse checks every scheme name maps to its generator and others fail.
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		scheme string
+		want   string // Pattern of NewID("saga", "k")
+	}{
+		{"derived", `^saga-k$`},
+		{"random", uuidID.String()},
+		{"uuid", uuidID.String()},
+		{"ulid", `^saga-[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"sequence", `^saga-1$`},
+	} {
+		t.Run(tc.scheme, func(t *testing.T) {
+			g, err := ids.Parse(tc.scheme)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if id := g.NewID("saga", "k"); !regexp.MustCompile(tc.want).MatchString(id) {
+				t.Errorf("NewID = %q, want it to match %s", id, tc.want)
+			}
+		})
+	}
+	if _, err := ids.Parse("snowflake"); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%q", "snowflake")) {
+		t.Errorf("Parse(snowflake) = %v, want an error naming the scheme", err)
+	}
+}
@@ -0,0 +1,72 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+
+	"create-order-saga/pkg/clock"
+)
+
+// crockford is the alphabet of ULIDs: Crockford's base32, without I, L, O and U.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a Generator building "<kind>-<ulid>" IDs, ignoring the key.
+// A ULID (https://github.com/ulid/spec) is a 48-bit millisecond timestamp
+// read from c (the real clock if nil) followed by 80 random bits, so IDs sort
+// by creation time. IDs created in the same millisecond increment the random
+// part, keeping them strictly increasing. It is safe for concurrent use.
+func ULID(c clock.Clock) Generator {
+	return &ulidGenerator{clock: clock.OrReal(c)}
+}
+
+type ulidGenerator struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte // Random part of the last ULID
+}
+
+func (g *ulidGenerator) NewID(kind, _ string) string {
+	ms := uint64(g.clock.Now().UnixMilli())
+	g.mu.Lock()
+	if ms > g.lastMs {
+		g.lastMs = ms
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			panic(err) // crypto/rand never fails on supported platforms
+		}
+	} else if !increment(g.entropy[:]) {
+		// The random part overflowed (or the clock went back): borrow the next millisecond
+		g.lastMs++
+	}
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[0:8], g.lastMs<<16)
+	copy(id[6:], g.entropy[:])
+	g.mu.Unlock()
+	return kind + "-" + encodeULID(id)
+}
+
+// increment adds one to a big-endian number, reporting false if it wrapped to zero.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID renders 128 bits as 26 Crockford base32 characters, the first
+// holding only the top 3 bits.
+func encodeULID(id [16]byte) string {
+	hi, lo := binary.BigEndian.Uint64(id[0:8]), binary.BigEndian.Uint64(id[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,84 @@
+package ids_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/ids"
+)
+
+// ulid returns the ULID part of a "saga-<ulid>" ID.
+func ulid(t *testing.T, id string) string {
+	t.Helper()
+	u, ok := strings.CutPrefix(id, "saga-")
+	if !ok || len(u) != 26 {
+		t.Fatalf("ID %q, want saga- and a 26 character ULID", id)
+	}
+	return u
+}
+
+// TestULIDTimestamp checks the first 10 characters encode the clock's
+// millisecond, using the spec's example ULID 01ARZ3NDEKTSV4RRFFQ69G5FAV.
+func TestULIDTimestamp(t *testing.T) {
+	g := ids.ULID(clock.NewFake(time.UnixMilli(1469922850259)))
+	if got := ulid(t, g.NewID("saga", ""))[:10]; got != "01ARZ3NDEK" {
+		t.Errorf("timestamp = %s, want 01ARZ3NDEK", got)
+	}
+}
+
+// manualClock is a clock that is set, backwards too.
+type manualClock struct{ now time.Time }
+
+func (c *manualClock) Now() time.Time                         { return c.now }
+func (c *manualClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// TestULIDMonotonic checks IDs keep increasing within a millisecond, as the
+// clock moves on and when it goes back.
+func TestULIDMonotonic(t *testing.T) {
+	c := &manualClock{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	g := ids.ULID(c)
+	prev := ulid(t, g.NewID("saga", ""))
+	for i, step := range []time.Duration{0, 0, time.Millisecond, time.Hour, -2 * time.Hour, 0} {
+		c.now = c.now.Add(step)
+		id := ulid(t, g.NewID("saga", ""))
+		if id <= prev {
+			t.Errorf("ID %d (%s) does not sort after %s", i, id, prev)
+		}
+		prev = id
+	}
+}
+
+// TestULIDUnique draws IDs from several goroutines on a frozen clock, where
+// only the random part can tell them apart: none repeats.
+func TestULIDUnique(t *testing.T) {
+	const workers, perWorker = 8, 5000
+	g := ids.ULID(clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)))
+	var mu sync.Mutex
+	seen := make(map[string]bool, workers*perWorker)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := make([]string, 0, perWorker)
+			for range perWorker {
+				local = append(local, g.NewID("saga", ""))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range local {
+				if seen[id] {
+					t.Errorf("%s generated twice", id)
+				}
+				seen[id] = true
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != workers*perWorker {
+		t.Errorf("got %d distinct IDs, want %d", len(seen), workers*perWorker)
+	}
+}
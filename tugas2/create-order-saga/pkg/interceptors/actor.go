@@ -0,0 +1,53 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ActorHeader is the metadata key naming what made a call, e.g.
+// "saga-orchestrator", so services can record who changed a record.
+const ActorHeader = "x-actor"
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the given actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the caller's actor, or "" if it did not say.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// ActorUnaryClientInterceptor sends the actor stored in the context, or
+// defaultActor if there is none, with every outgoing call. An empty
+// defaultActor sends nothing for such calls.
+func ActorUnaryClientInterceptor(defaultActor string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		actor := ActorFromContext(ctx)
+		if actor == "" {
+			actor = defaultActor
+		}
+		if actor != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, ActorHeader, actor)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// ActorUnaryServerInterceptor stores the actor from incoming metadata in the
+// handler's context.
+func ActorUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if actor := firstValue(md, ActorHeader); actor != "" {
+			ctx = WithActor(ctx, actor)
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,128 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys that may carry the caller's credentials.
+const (
+	AuthorizationHeader = "authorization" // "Bearer <token>"
+	APIKeyHeader        = "x-api-key"
+)
+
+// Authenticator decides whether a presented token or API key is valid.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) error
+}
+
+// StaticKeys is an Authenticator accepting a fixed set of keys.
+type StaticKeys struct {
+	keys [][]byte
+}
+
+// NewStaticKeys returns an Authenticator accepting any of keys. Empty keys are ignored.
+func NewStaticKeys(keys ...string) *StaticKeys {
+	s := &StaticKeys{}
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			s.keys = append(s.keys, []byte(k))
+		}
+	}
+	return s
+}
+
+// Authenticate accepts token if it matches one of the keys, comparing in constant time.
+func (s *StaticKeys) Authenticate(_ context.Context, token string) error {
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(k, []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid credentials")
+}
+
+// exemptServices are the gRPC services callable without credentials: health
+// checks for load balancers and probes, and reflection for tools like grpcurl.
+var exemptServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// isExempt reports whether fullMethod may be called without credentials.
+func isExempt(fullMethod string) bool {
+	for _, prefix := range exemptServices {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenFromMetadata returns the bearer token or API key in md, if any.
+func tokenFromMetadata(md metadata.MD) string {
+	if auth := firstValue(md, AuthorizationHeader); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return firstValue(md, APIKeyHeader)
+}
+
+// authenticate checks the credentials in the incoming metadata of ctx.
+func authenticate(ctx context.Context, auth Authenticator) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := tokenFromMetadata(md)
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "missing credentials")
+	}
+	if err := auth.Authenticate(ctx, token); err != nil {
+		if _, ok := status.FromError(err); !ok {
+			err = status.Error(codes.Unauthenticated, err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// AuthUnaryServerInterceptor rejects calls without valid credentials with
+// codes.Unauthenticated. Credentials are read from the "authorization"
+// (Bearer) or "x-api-key" metadata. Health and reflection are always allowed.
+func AuthUnaryServerInterceptor(auth Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !isExempt(info.FullMethod) {
+			if err := authenticate(ctx, auth); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamServerInterceptor is the streaming counterpart of AuthUnaryServerInterceptor.
+func AuthStreamServerInterceptor(auth Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !isExempt(info.FullMethod) {
+			if err := authenticate(ss.Context(), auth); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// APIKeyUnaryClientInterceptor attaches key as "x-api-key" metadata to every outgoing call.
+func APIKeyUnaryClientInterceptor(key string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, APIKeyHeader, key)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
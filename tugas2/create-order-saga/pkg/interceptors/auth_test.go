@@ -0,0 +1,124 @@
+package interceptors_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/interceptors"
+)
+
+const getOrder = "/order.OrderService/GetOrder"
+
+// callAuthenticated runs a unary call to method with incoming metadata md
+// through AuthUnaryServerInterceptor(auth), reporting whether the handler ran.
+func callAuthenticated(auth interceptors.Authenticator, method string, md metadata.MD) (bool, error) {
+	ran := false
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		ran = true
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	_, err := interceptors.AuthUnaryServerInterceptor(auth)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	return ran, err
+}
+
+func TestAuthUnaryServerInterceptor(t *testing.T) {
+	auth := interceptors.NewStaticKeys("secret", " ", "other")
+	for _, tc := range []struct {
+		name   string
+		method string
+		md     metadata.MD
+		want   codes.Code
+	}{
+		{"valid API key", getOrder, metadata.Pairs(interceptors.APIKeyHeader, "secret"), codes.OK},
+		{"second valid key", getOrder, metadata.Pairs(interceptors.APIKeyHeader, "other"), codes.OK},
+		{"valid bearer token", getOrder, metadata.Pairs(interceptors.AuthorizationHeader, "Bearer secret"), codes.OK},
+		{"invalid API key", getOrder, metadata.Pairs(interceptors.APIKeyHeader, "guess"), codes.Unauthenticated},
+		{"invalid bearer token", getOrder, metadata.Pairs(interceptors.AuthorizationHeader, "Bearer guess"), codes.Unauthenticated},
+		{"non-bearer authorization", getOrder, metadata.Pairs(interceptors.AuthorizationHeader, "Basic secret"), codes.Unauthenticated},
+		{"missing credentials", getOrder, metadata.MD{}, codes.Unauthenticated},
+		{"blank key", getOrder, metadata.Pairs(interceptors.APIKeyHeader, " "), codes.Unauthenticated},
+		{"health without credentials", "/grpc.health.v1.Health/Check", metadata.MD{}, codes.OK},
+		{"reflection without credentials", "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", metadata.MD{}, codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ran, err := callAuthenticated(auth, tc.method, tc.md)
+			if got := status.Code(err); got != tc.want {
+				t.Fatalf("call = %v, want %s", err, tc.want)
+			}
+			if ran != (tc.want == codes.OK) {
+				t.Errorf("handler ran = %v for a call returning %s", ran, tc.want)
+			}
+		})
+	}
+}
+
+// authFunc adapts a function to the Authenticator interface.
+type authFunc func(ctx context.Context, token string) error
+
+func (f authFunc) Authenticate(ctx context.Context, token string) error { return f(ctx, token) }
+
+// TestAuthCustomAuthenticator checks a plain error from an Authenticator is
+// reported as Unauthenticated, while a gRPC status it returns is kept.
+func TestAuthCustomAuthenticator(t *testing.T) {
+	auth := authFunc(func(_ context.Context, token string) error {
+		switch token {
+		case "expired":
+			return errors.New("token expired")
+		case "read-only":
+			return status.Error(codes.PermissionDenied, "token is read-only")
+		}
+		return nil
+	})
+	for token, want := range map[string]codes.Code{"fresh": codes.OK, "expired": codes.Unauthenticated, "read-only": codes.PermissionDenied} {
+		_, err := callAuthenticated(auth, getOrder, metadata.Pairs(interceptors.AuthorizationHeader, "Bearer "+token))
+		if got := status.Code(err); got != want {
+			t.Errorf("token %q: call = %v, want %s", token, err, want)
+		}
+	}
+}
+
+// authStream is a ServerStream carrying only a context.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authStream) Context() context.Context { return s.ctx }
+
+func TestAuthStreamServerInterceptor(t *testing.T) {
+	interceptor := interceptors.AuthStreamServerInterceptor(interceptors.NewStaticKeys("secret"))
+	info := &grpc.StreamServerInfo{FullMethod: "/order.OrderService/WatchOrder"}
+	handler := func(interface{}, grpc.ServerStream) error { return nil }
+	for key, want := range map[string]codes.Code{"secret": codes.OK, "guess": codes.Unauthenticated, "": codes.Unauthenticated} {
+		md := metadata.MD{}
+		if key != "" {
+			md = metadata.Pairs(interceptors.APIKeyHeader, key)
+		}
+		err := interceptor(nil, authStream{ctx: metadata.NewIncomingContext(context.Background(), md)}, info, handler)
+		if got := status.Code(err); got != want {
+			t.Errorf("stream with key %q = %v, want %s", key, err, want)
+		}
+	}
+}
+
+func TestAPIKeyUnaryClientInterceptor(t *testing.T) {
+	var sent []string
+	invoker := func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = md.Get(interceptors.APIKeyHeader)
+		return nil
+	}
+	if err := interceptors.APIKeyUnaryClientInterceptor("secret")(context.Background(), getOrder, nil, nil, nil, invoker); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if len(sent) != 1 || sent[0] != "secret" {
+		t.Errorf("outgoing %s = %v, want [secret]", interceptors.APIKeyHeader, sent)
+	}
+}
@@ -0,0 +1,34 @@
+package interceptors
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// SlowRequestUnaryServerInterceptor logs every RPC that takes at least
+// threshold to handle, with its outcome and the request and saga IDs so it can
+// be matched with the caller's logs.
+func SlowRequestUnaryServerInterceptor(threshold time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if d := time.Since(start); d >= threshold {
+			requestID, _ := RequestIDFromContext(ctx)
+			sagaID, _ := SagaIDFromContext(ctx)
+			log.Printf("Slow request: %s took %v (code=%s request_id=%s saga_id=%s)",
+				info.FullMethod, d, status.Code(err), orDash(requestID), orDash(sagaID))
+		}
+		return resp, err
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
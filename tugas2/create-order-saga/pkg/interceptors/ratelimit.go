@@ -0,0 +1,99 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"create-order-saga/pkg/clock"
+)
+
+// RateLimiter allows each tenant a steady rate of requests with bursts, as a
+// token bucket per tenant. It is safe for concurrent use.
+type RateLimiter struct {
+	rate  float64 // Tokens added per second
+	burst float64 // Bucket size
+	clock clock.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket // By tenant
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time // When tokens was last brought up to date
+}
+
+// NewRateLimiter allows each tenant perSecond requests per second on average
+// and up to burst at once (at least 1). Time is read from c (the real clock if nil).
+func NewRateLimiter(perSecond float64, burst int, c clock.Clock) *RateLimiter {
+	return &RateLimiter{
+		rate:    perSecond,
+		burst:   float64(max(burst, 1)),
+		clock:   clock.OrReal(c),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// String describes the limit for log lines and build info, e.g.
+// "5/s, burst 10"; a nil limiter is "off".
+func (l *RateLimiter) String() string {
+	if l == nil {
+		return "off"
+	}
+	return fmt.Sprintf("%g/s, burst %g", l.rate, l.burst)
+}
+
+// Allow takes a token from tenant's bucket. If the bucket is empty it returns
+// false and how long until a token is available.
+func (l *RateLimiter) Allow(tenant string) (retryAfter time.Duration, ok bool) {
+	now := l.clock.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, found := l.buckets[tenant]
+	if !found {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[tenant] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration(math.Ceil((1 - b.tokens) / l.rate * float64(time.Second))), false
+}
+
+// RateLimitUnaryServerInterceptor refuses calls over l's limit for the
+// caller's tenant with codes.ResourceExhausted, attaching a RetryInfo detail
+// saying how long to wait before retrying. Health checks and reflection are
+// never limited.
+func RateLimitUnaryServerInterceptor(l *RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isExempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		tenant := TenantFromContext(ctx)
+		retryAfter, ok := l.Allow(tenant)
+		if ok {
+			return handler(ctx, req)
+		}
+		log.Printf("Rate limit exceeded: %s for tenant %s refused, retry in %v", info.FullMethod, tenant, retryAfter)
+		st := status.Newf(codes.ResourceExhausted, "rate limit exceeded for tenant %s, retry in %v", tenant, retryAfter.Round(time.Millisecond))
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+			st = detailed
+		} else {
+			log.Printf("WARNING: Attaching retry info: %v", err)
+		}
+		return nil, st.Err()
+	}
+}
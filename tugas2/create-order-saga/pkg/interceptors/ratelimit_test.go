@@ -0,0 +1,92 @@
+package interceptors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/clock"
+	"create-order-saga/pkg/interceptors"
+)
+
+// TestRateLimiterAllow drains a tenant's bucket of 2 at 4 per second: the
+// next call is told to wait for the next token, which arrives on time, and
+// other tenants keep their own buckets.
+func TestRateLimiterAllow(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	l := interceptors.NewRateLimiter(4, 2, fake)
+	allow := func(tenant string, want bool, wantWait time.Duration) {
+		t.Helper()
+		if wait, ok := l.Allow(tenant); ok != want || wait != wantWait {
+			t.Errorf("Allow(%s) = %v, %t; want %v, %t", tenant, wait, ok, wantWait, want)
+		}
+	}
+
+	allow("a", true, 0)
+	allow("a", true, 0)
+	allow("a", false, 250*time.Millisecond)
+	allow("b", true, 0)
+	fake.Advance(100 * time.Millisecond)
+	allow("a", false, 150*time.Millisecond)
+	fake.Advance(150 * time.Millisecond)
+	allow("a", true, 0)
+	allow("a", false, 250*time.Millisecond)
+	fake.Advance(time.Hour)
+	allow("a", true, 0)
+	allow("a", true, 0)
+	allow("a", false, 250*time.Millisecond)
+
+	if got := l.String(); got != "4/s, burst 2" {
+		t.Errorf("String = %q, want 4/s, burst 2", got)
+	}
+	if got := (*interceptors.RateLimiter)(nil).String(); got != "off" {
+		t.Errorf("nil String = %q, want off", got)
+	}
+}
+
+// TestRateLimitUnaryServerInterceptor checks a call over the limit is refused
+// with ResourceExhausted and a RetryInfo detail holding the wait, without
+// reaching the handler, while health checks are never limited.
+func TestRateLimitUnaryServerInterceptor(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	limit := interceptors.RateLimitUnaryServerInterceptor(interceptors.NewRateLimiter(2, 1, fake))
+	ctx := interceptors.WithTenant(context.Background(), "tenant-a")
+	call := func(method string) (bool, error) {
+		ran := false
+		handler := func(context.Context, interface{}) (interface{}, error) {
+			ran = true
+			return nil, nil
+		}
+		_, err := limit(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return ran, err
+	}
+
+	if ran, err := call(getOrder); !ran || err != nil {
+		t.Fatalf("first call: ran %t, %v", ran, err)
+	}
+	ran, err := call(getOrder)
+	if ran || status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("call over the limit: ran %t, %v; want refused with ResourceExhausted", ran, err)
+	}
+	var hint *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			hint = info
+		}
+	}
+	if got := hint.GetRetryDelay().AsDuration(); hint == nil || got != 500*time.Millisecond {
+		t.Errorf("RetryInfo = %v, want a 500ms retry delay", hint)
+	}
+	if ran, err := call("/grpc.health.v1.Health/Check"); !ran || err != nil {
+		t.Errorf("health check over the limit: ran %t, %v; want it exempt", ran, err)
+	}
+	fake.Advance(500 * time.Millisecond)
+	if ran, err := call(getOrder); !ran || err != nil {
+		t.Errorf("call after the hinted wait: ran %t, %v", ran, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package interceptors contains gRPC interceptors shared by the orchestrator
+// and all saga services.
+package interceptors
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys used to propagate correlation IDs between services.
+const (
+	RequestIDHeader = "x-request-id"
+	SagaIDHeader    = "x-saga-id"
+)
+
+type requestIDKey struct{}
+type sagaIDKey struct{}
+
+// WithRequestID returns a context carrying the given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// WithSagaID returns a context carrying the given saga ID.
+func WithSagaID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sagaIDKey{}, id)
+}
+
+// SagaIDFromContext returns the saga ID stored in ctx, if any.
+func SagaIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sagaIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// NewRequestID generates a random 128-bit hex request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDUnaryClientInterceptor attaches the request ID (generating one if the
+// context has none) and the saga ID, if present, to outgoing metadata.
+func RequestIDUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		requestID, ok := RequestIDFromContext(ctx)
+		if !ok {
+			requestID = NewRequestID()
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, RequestIDHeader, requestID)
+		if sagaID, ok := SagaIDFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, SagaIDHeader, sagaID)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RequestIDUnaryServerInterceptor extracts the request and saga IDs from incoming
+// metadata (generating a request ID when absent), stores them in the handler's
+// context and echoes the request ID in the response trailer.
+func RequestIDUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		requestID := firstValue(md, RequestIDHeader)
+		if requestID == "" {
+			requestID = NewRequestID()
+		}
+		ctx = WithRequestID(ctx, requestID)
+		if sagaID := firstValue(md, SagaIDHeader); sagaID != "" {
+			ctx = WithSagaID(ctx, sagaID)
+		}
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(RequestIDHeader, requestID))
+		return handler(ctx, req)
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package interceptors_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"create-order-saga/pkg/grpc_clients"
+	"create-order-saga/pkg/interceptors"
+	paymentpb "create-order-saga/proto/payment"
+)
+
+// idRecorder answers GetPayment, failing the first failures calls with
+// Unavailable, and records the request and saga IDs each call carried.
+type idRecorder struct {
+	paymentpb.UnimplementedPaymentServiceServer
+	failures int
+
+	mu       sync.Mutex
+	requests []string
+	sagas    []string
+}
+
+func (r *idRecorder) GetPayment(ctx context.Context, _ *paymentpb.GetPaymentRequest) (*paymentpb.Payment, error) {
+	requestID, _ := interceptors.RequestIDFromContext(ctx)
+	sagaID, _ := interceptors.SagaIDFromContext(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, requestID)
+	r.sagas = append(r.sagas, sagaID)
+	if len(r.requests) <= r.failures {
+		return nil, status.Error(codes.Unavailable, "flaky")
+	}
+	return &paymentpb.Payment{}, nil
+}
+
+// dial serves r behind RequestIDUnaryServerInterceptor on a bufconn listener
+// and returns a client attaching request IDs before retrying, as the saga's
+// clients do.
+func dial(t *testing.T, r *idRecorder) paymentpb.PaymentServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors.RequestIDUnaryServerInterceptor()))
+	paymentpb.RegisterPaymentServiceServer(s, r)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	retries := grpc_clients.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Timeout: time.Second}
+	conn, err := grpc.NewClient("passthrough:///payment",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithChainUnaryInterceptor(
+			interceptors.RequestIDUnaryClientInterceptor(),
+			grpc_clients.RetryUnaryClientInterceptor(grpc_clients.PaymentService, grpc_clients.ServiceRetryConfig{Forward: retries, Compensation: retries}),
+		),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return paymentpb.NewPaymentServiceClient(conn)
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	r := &idRecorder{}
+	client := dial(t, r)
+	ctx := interceptors.WithSagaID(interceptors.WithRequestID(context.Background(), "req-1"), "saga-1")
+
+	var trailer metadata.MD
+	if _, err := client.GetPayment(ctx, &paymentpb.GetPaymentRequest{PaymentId: "pay-1"}, grpc.Trailer(&trailer)); err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	if len(r.requests) != 1 || r.requests[0] != "req-1" || r.sagas[0] != "saga-1" {
+		t.Errorf("server saw request IDs %v and saga IDs %v, want req-1 and saga-1", r.requests, r.sagas)
+	}
+	if got := trailer.Get(interceptors.RequestIDHeader); len(got) != 1 || got[0] != "req-1" {
+		t.Errorf("trailer request ID = %v, want req-1", got)
+	}
+}
+
+func TestRequestIDGeneratedOnce(t *testing.T) {
+	r := &idRecorder{failures: 2}
+	client := dial(t, r)
+
+	var trailer metadata.MD
+	if _, err := client.GetPayment(context.Background(), &paymentpb.GetPaymentRequest{PaymentId: "pay-1"}, grpc.Trailer(&trailer)); err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	if len(r.requests) != 3 {
+		t.Fatalf("server received %d attempts, want 3", len(r.requests))
+	}
+	generated := r.requests[0]
+	for i, id := range r.requests {
+		if id == "" || id != generated {
+			t.Errorf("attempt %d carried request ID %q, want every attempt to reuse %q", i+1, id, generated)
+		}
+	}
+	if got := trailer.Get(interceptors.RequestIDHeader); len(got) != 1 || got[0] != generated {
+		t.Errorf("trailer request ID = %v, want %s", got, generated)
+	}
+}
@@ -0,0 +1,73 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TenantHeader is the metadata key carrying the caller's tenant.
+const TenantHeader = "x-tenant-id"
+
+// DefaultTenant is used when a request carries no tenant.
+const DefaultTenant = "default"
+
+type tenantKey struct{}
+
+// WithTenant returns a context carrying the given tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the caller's tenant, or DefaultTenant if none is set.
+func TenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok && tenant != "" {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// TenantUnaryClientInterceptor forwards the tenant stored in the context, if any.
+func TenantUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok && tenant != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, TenantHeader, tenant)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// TenantUnaryServerInterceptor stores the tenant from incoming metadata in the
+// handler's context so stores can partition records by tenant.
+func TenantUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if tenant := firstValue(md, TenantHeader); tenant != "" {
+			ctx = WithTenant(ctx, tenant)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TenantStreamServerInterceptor is the streaming counterpart of
+// TenantUnaryServerInterceptor.
+func TenantStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		if tenant := firstValue(md, TenantHeader); tenant != "" {
+			ss = &contextStream{ServerStream: ss, ctx: WithTenant(ss.Context(), tenant)}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// contextStream is a ServerStream with a replaced context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,160 @@
+// Package metrics collects per-RPC counters and latency histograms and serves
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"create-order-saga/pkg/clock"
+)
+
+// DefaultBuckets are the latency histogram upper bounds, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type counterKey struct {
+	method string
+	code   codes.Code
+}
+
+// histogram is a cumulative latency histogram for one method.
+type histogram struct {
+	counts []uint64 // One per bucket, plus +Inf
+	sum    float64
+	total  uint64
+}
+
+// Registry holds the metrics of one process. It is safe for concurrent use.
+type Registry struct {
+	buckets []float64
+	clock   clock.Clock
+
+	mu         sync.Mutex
+	handled    map[counterKey]uint64
+	histograms map[string]*histogram
+	inFlight   map[string]int64 // RPCs being handled, by method
+}
+
+// NewRegistry creates an empty registry using DefaultBuckets.
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets:    DefaultBuckets,
+		clock:      clock.Real(),
+		handled:    make(map[counterKey]uint64),
+		histograms: make(map[string]*histogram),
+		inFlight:   make(map[string]int64),
+	}
+}
+
+// Observe records one finished RPC.
+func (r *Registry) Observe(method string, code codes.Code, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handled[counterKey{method, code}]++
+
+	h, ok := r.histograms[method]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(r.buckets)+1)}
+		r.histograms[method] = h
+	}
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(r.buckets, seconds) // First bucket with bound >= seconds
+	h.counts[i]++
+	h.sum += seconds
+	h.total++
+}
+
+// Handled returns how many RPCs to method finished with code.
+func (r *Registry) Handled(method string, code codes.Code) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.handled[counterKey{method, code}]
+}
+
+// InFlight returns how many RPCs to method are being handled right now.
+func (r *Registry) InFlight(method string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inFlight[method]
+}
+
+func (r *Registry) addInFlight(method string, delta int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight[method] += delta
+}
+
+// UnaryServerInterceptor records the outcome and latency of every unary RPC
+// and how many are in flight.
+func (r *Registry) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		r.addInFlight(info.FullMethod, 1)
+		defer r.addInFlight(info.FullMethod, -1)
+		start := r.clock.Now()
+		resp, err := handler(ctx, req)
+		r.Observe(info.FullMethod, status.Code(err), r.clock.Now().Sub(start))
+		return resp, err
+	}
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	keys := make([]counterKey, 0, len(r.handled))
+	for k := range r.handled {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	fmt.Fprintln(w, "# HELP grpc_server_handled_total Total number of RPCs completed on the server, by method and status code.")
+	fmt.Fprintln(w, "# TYPE grpc_server_handled_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "grpc_server_handled_total{grpc_method=%q,grpc_code=%q} %d\n", k.method, k.code.String(), r.handled[k])
+	}
+
+	methods := make([]string, 0, len(r.histograms))
+	for m := range r.histograms {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	fmt.Fprintln(w, "# HELP grpc_server_handling_seconds Latency of RPCs handled by the server, by method.")
+	fmt.Fprintln(w, "# TYPE grpc_server_handling_seconds histogram")
+	for _, m := range methods {
+		h := r.histograms[m]
+		var cumulative uint64
+		for i, bound := range r.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "grpc_server_handling_seconds_bucket{grpc_method=%q,le=%q} %d\n", m, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "grpc_server_handling_seconds_bucket{grpc_method=%q,le=\"+Inf\"} %d\n", m, h.total)
+		fmt.Fprintf(w, "grpc_server_handling_seconds_sum{grpc_method=%q} %g\n", m, h.sum)
+		fmt.Fprintf(w, "grpc_server_handling_seconds_count{grpc_method=%q} %d\n", m, h.total)
+	}
+
+	methods = methods[:0]
+	for m := range r.inFlight {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	fmt.Fprintln(w, "# HELP grpc_server_in_flight Number of RPCs currently being handled by the server, by method.")
+	fmt.Fprintln(w, "# TYPE grpc_server_in_flight gauge")
+	for _, m := range methods {
+		fmt.Fprintf(w, "grpc_server_in_flight{grpc_method=%q} %d\n", m, r.inFlight[m])
+	}
+}
@@ -0,0 +1,178 @@
+package metrics_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"create-order-saga/pkg/metrics"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+)
+
+const (
+	createOrder = "/order.OrderService/CreateOrder"
+	getOrder    = "/order.OrderService/GetOrder"
+	cancelOrder = "/order.OrderService/CancelOrder"
+)
+
+// stubOrders creates every order, finds none, and holds each CancelOrder
+// until released.
+type stubOrders struct {
+	orderpb.UnimplementedOrderServiceServer
+	cancelling chan struct{}
+	release    chan struct{}
+}
+
+func (s *stubOrders) CreateOrder(context.Context, *orderpb.CreateOrderRequest) (*orderpb.CreateOrderResponse, error) {
+	return &orderpb.CreateOrderResponse{}, nil
+}
+
+func (s *stubOrders) GetOrder(context.Context, *orderpb.GetOrderRequest) (*orderpb.Order, error) {
+	return nil, status.Error(codes.NotFound, "no such order")
+}
+
+func (s *stubOrders) CancelOrder(context.Context, *orderpb.CancelOrderRequest) (*commonpb.CompensationResponse, error) {
+	s.cancelling <- struct{}{}
+	<-s.release
+	return &commonpb.CompensationResponse{Success: true}, nil
+}
+
+// scrape returns every sample r serves, keyed by metric name and labels as
+// written, e.g. `grpc_server_in_flight{grpc_method="/x.Y/Z"}`.
+func scrape(t *testing.T, r *metrics.Registry) map[string]float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+	samples := make(map[string]float64)
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if i < 0 || err != nil {
+			t.Fatalf("malformed sample %q", line)
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+// TestRegistryScrape makes RPCs over bufconn through the registry's
+// interceptor and checks the scraped counters, histograms and in-flight
+// gauge carry the right method and code labels and counts.
+func TestRegistryScrape(t *testing.T) {
+	reg := metrics.NewRegistry()
+	stub := &stubOrders{cancelling: make(chan struct{}), release: make(chan struct{})}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.UnaryInterceptor(reg.UnaryServerInterceptor()))
+	orderpb.RegisterOrderServiceServer(s, stub)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///order",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := orderpb.NewOrderServiceClient(conn)
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := client.CreateOrder(ctx, &orderpb.CreateOrderRequest{}); err != nil {
+			t.Fatalf("CreateOrder: %v", err)
+		}
+	}
+	if _, err := client.GetOrder(ctx, &orderpb.GetOrderRequest{}); status.Code(err) != codes.NotFound {
+		t.Fatalf("GetOrder = %v, want NotFound", err)
+	}
+	if _, err := client.ListOrders(ctx, &orderpb.ListOrdersRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("ListOrders = %v, want Unimplemented", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := client.CancelOrder(ctx, &orderpb.CancelOrderRequest{})
+		done <- err
+	}()
+	<-stub.cancelling
+
+	samples := scrape(t, reg)
+	for sample, want := range map[string]float64{
+		`grpc_server_handled_total{grpc_method="/order.OrderService/CreateOrder",grpc_code="OK"}`:           2,
+		`grpc_server_handled_total{grpc_method="/order.OrderService/GetOrder",grpc_code="NotFound"}`:        1,
+		`grpc_server_handled_total{grpc_method="/order.OrderService/ListOrders",grpc_code="Unimplemented"}`: 1,
+		`grpc_server_handling_seconds_count{grpc_method="/order.OrderService/CreateOrder"}`:                 2,
+		`grpc_server_handling_seconds_bucket{grpc_method="/order.OrderService/CreateOrder",le="+Inf"}`:      2,
+		`grpc_server_handling_seconds_count{grpc_method="/order.OrderService/GetOrder"}`:                    1,
+		`grpc_server_in_flight{grpc_method="/order.OrderService/CancelOrder"}`:                              1,
+		`grpc_server_in_flight{grpc_method="/order.OrderService/CreateOrder"}`:                              0,
+	} {
+		if got, ok := samples[sample]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", sample, got, ok, want)
+		}
+	}
+	for sample := range samples {
+		if strings.Contains(sample, `grpc_code="OK"`) && !strings.Contains(sample, "CreateOrder") {
+			t.Errorf("unexpected sample %s: only CreateOrder succeeded", sample)
+		}
+		if strings.HasPrefix(sample, "grpc_server_handl") && strings.Contains(sample, "CancelOrder") {
+			t.Errorf("unfinished CancelOrder already counted: %s", sample)
+		}
+	}
+
+	close(stub.release)
+	if err := <-done; err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	samples = scrape(t, reg)
+	if got := samples[`grpc_server_in_flight{grpc_method="/order.OrderService/CancelOrder"}`]; got != 0 {
+		t.Errorf("CancelOrder in flight after it returned = %v, want 0", got)
+	}
+	if got := reg.Handled(cancelOrder, codes.OK); got != 1 {
+		t.Errorf("Handled(CancelOrder, OK) = %d, want 1", got)
+	}
+}
+
+// TestRegistryHistogramBuckets observes known latencies and checks each is
+// counted in the first bucket whose bound is at least that long, and in
+// every bucket above it.
+func TestRegistryHistogramBuckets(t *testing.T) {
+	reg := metrics.NewRegistry()
+	for _, d := range []time.Duration{3 * time.Millisecond, 10 * time.Millisecond, 30 * time.Millisecond, 20 * time.Second} {
+		reg.Observe(getOrder, codes.OK, d)
+	}
+	samples := scrape(t, reg)
+	bucket := func(le string) float64 {
+		return samples[`grpc_server_handling_seconds_bucket{grpc_method="/order.OrderService/GetOrder",le="`+le+`"}`]
+	}
+	for le, want := range map[string]float64{"0.005": 1, "0.01": 2, "0.025": 2, "0.05": 3, "10": 3, "+Inf": 4} {
+		if got := bucket(le); got != want {
+			t.Errorf("bucket le=%s = %v, want %v", le, got, want)
+		}
+	}
+	if got := samples[`grpc_server_handling_seconds_sum{grpc_method="/order.OrderService/GetOrder"}`]; got < 20.042 || got > 20.044 {
+		t.Errorf("sum = %v, want 20.043", got)
+	}
+	if got := reg.Handled(createOrder, codes.OK); got != 0 {
+		t.Errorf("Handled of a method never called = %d", got)
+	}
+}
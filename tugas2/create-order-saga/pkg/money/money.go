@@ -0,0 +1,239 @@
+// Package money does exact arithmetic on common.Money amounts. Amounts are
+// handled as a whole number of nanos (billionths of a unit), so sums of
+// values like 0.1 + 0.2 never drift.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	commonpb "create-order-saga/proto/common"
+)
+
+// DefaultCurrency is used for amounts given without a currency, e.g. on the command line.
+const DefaultCurrency = "USD"
+
+const nanosPerUnit = 1_000_000_000
+
+// ErrCurrencyMismatch is returned (wrapped) when amounts in different currencies are combined.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// New returns an amount of units + nanos/10^9 in the given currency.
+func New(currency string, units int64, nanos int32) *commonpb.Money {
+	return fromNanos(currency, units*nanosPerUnit+int64(nanos))
+}
+
+// FromMinor returns an amount given in hundredths of a unit (e.g. cents).
+func FromMinor(currency string, minor int64) *commonpb.Money {
+	return fromNanos(currency, minor*(nanosPerUnit/100))
+}
+
+// Parse parses a decimal amount such as "46", "10.5" or "-0.25" exactly.
+func Parse(currency, amount string) (*commonpb.Money, error) {
+	s := strings.TrimSpace(amount)
+	neg := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" || len(frac) > 9 || !digits(whole) || !digits(frac) {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (1<<63-1)/nanosPerUnit-1 {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	nanos := int64(0)
+	if frac != "" {
+		nanos, _ = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64)
+	}
+	total := units*nanosPerUnit + nanos
+	if neg {
+		total = -total
+	}
+	return fromNanos(currency, total), nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants.
+func MustParse(currency, amount string) *commonpb.Money {
+	m, err := Parse(currency, amount)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Validate checks m is present, has a three-letter currency code and
+// consistently signed units and nanos.
+func Validate(m *commonpb.Money) error {
+	if m == nil {
+		return errors.New("amount is missing")
+	}
+	if err := ValidateCurrency(m.CurrencyCode); err != nil {
+		return err
+	}
+	if m.Nanos <= -nanosPerUnit || m.Nanos >= nanosPerUnit {
+		return fmt.Errorf("nanos %d out of range", m.Nanos)
+	}
+	if (m.Units > 0 && m.Nanos < 0) || (m.Units < 0 && m.Nanos > 0) {
+		return errors.New("units and nanos must have the same sign")
+	}
+	return nil
+}
+
+// ValidateCurrency checks code looks like an ISO 4217 code: three upper-case letters.
+func ValidateCurrency(code string) error {
+	if len(code) != 3 || !letters(code) {
+		return fmt.Errorf("currency code %q must be three upper-case letters", code)
+	}
+	return nil
+}
+
+// ParseCurrencies parses a comma-separated list of currency codes, e.g.
+// "USD,EUR". An empty spec yields none.
+func ParseCurrencies(spec string) ([]string, error) {
+	var currencies []string
+	for _, code := range strings.Split(spec, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		if err := ValidateCurrency(code); err != nil {
+			return nil, err
+		}
+		currencies = append(currencies, code)
+	}
+	return currencies, nil
+}
+
+// ItemsCurrency returns the currency the items are priced in, which must be
+// the same for all of them; no items are priced in DefaultCurrency.
+func ItemsCurrency(items []*commonpb.Item) (string, error) {
+	if len(items) == 0 {
+		return DefaultCurrency, nil
+	}
+	currency := items[0].GetPrice().GetCurrencyCode()
+	for i, item := range items[1:] {
+		if err := sameCurrency(items[0].GetPrice(), item.GetPrice()); err != nil {
+			return "", fmt.Errorf("item %d: %w", i+1, err)
+		}
+	}
+	return currency, nil
+}
+
+// IsNegative reports whether m is below zero.
+func IsNegative(m *commonpb.Money) bool {
+	return nanos(m) < 0
+}
+
+// Add returns a + b, which must be in the same currency.
+func Add(a, b *commonpb.Money) (*commonpb.Money, error) {
+	if err := sameCurrency(a, b); err != nil {
+		return nil, err
+	}
+	return fromNanos(a.GetCurrencyCode(), nanos(a)+nanos(b)), nil
+}
+
+// Multiply returns m * n.
+func Multiply(m *commonpb.Money, n int64) *commonpb.Money {
+	return fromNanos(m.GetCurrencyCode(), nanos(m)*n)
+}
+
+// Rate returns m * bps / 10000, e.g. the tax on m at a rate of bps basis
+// points (725 = 7.25%), rounded half away from zero to hundredths of a unit.
+func Rate(m *commonpb.Money, bps int64) *commonpb.Money {
+	const cent = nanosPerUnit / 100
+	n := new(big.Int).Mul(big.NewInt(nanos(m)), big.NewInt(bps))
+	div := big.NewInt(10000 * cent)
+	q, r := new(big.Int).QuoRem(n, div, new(big.Int))
+	if r.CmpAbs(new(big.Int).Rsh(div, 1)) >= 0 {
+		q.Add(q, big.NewInt(int64(n.Sign())))
+	}
+	return fromNanos(m.GetCurrencyCode(), q.Int64()*cent)
+}
+
+// Compare returns -1, 0 or +1 as a is less than, equal to or greater than b,
+// which must be in the same currency.
+func Compare(a, b *commonpb.Money) (int, error) {
+	if err := sameCurrency(a, b); err != nil {
+		return 0, err
+	}
+	switch na, nb := nanos(a), nanos(b); {
+	case na < nb:
+		return -1, nil
+	case na > nb:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// ItemsTotal sums price * quantity over the items exactly. Every price must be
+// valid and in the same currency; no items total zero in DefaultCurrency.
+func ItemsTotal(items []*commonpb.Item) (*commonpb.Money, error) {
+	if len(items) == 0 {
+		return New(DefaultCurrency, 0, 0), nil
+	}
+	total := New(items[0].GetPrice().GetCurrencyCode(), 0, 0)
+	for i, item := range items {
+		if err := Validate(item.GetPrice()); err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		var err error
+		if total, err = Add(total, Multiply(item.GetPrice(), int64(item.GetQuantity()))); err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	return total, nil
+}
+
+// Format renders m as e.g. "46.00 USD", with at least two decimals.
+func Format(m *commonpb.Money) string {
+	if m == nil {
+		return "-"
+	}
+	n := nanos(m)
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	frac := strings.TrimRight(fmt.Sprintf("%09d", n%nanosPerUnit), "0")
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	return fmt.Sprintf("%s%d.%s %s", sign, n/nanosPerUnit, frac, m.GetCurrencyCode())
+}
+
+func sameCurrency(a, b *commonpb.Money) error {
+	if a.GetCurrencyCode() != b.GetCurrencyCode() {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.GetCurrencyCode(), b.GetCurrencyCode())
+	}
+	return nil
+}
+
+// nanos returns m as a whole number of nanos; a nil amount is zero.
+func nanos(m *commonpb.Money) int64 {
+	return m.GetUnits()*nanosPerUnit + int64(m.GetNanos())
+}
+
+func fromNanos(currency string, n int64) *commonpb.Money {
+	return &commonpb.Money{CurrencyCode: currency, Units: n / nanosPerUnit, Nanos: int32(n % nanosPerUnit)}
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func letters(s string) bool {
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
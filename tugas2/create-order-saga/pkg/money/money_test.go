@@ -0,0 +1,211 @@
+package money_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/money"
+	commonpb "create-order-saga/proto/common"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		units int64
+		nanos int32
+	}{
+		{"46", 46, 0},
+		{"10.5", 10, 500_000_000},
+		{"10.50", 10, 500_000_000},
+		{"-0.25", 0, -250_000_000},
+		{"-3.1", -3, -100_000_000},
+		{"0.000000001", 0, 1},
+		{" 7.10 ", 7, 100_000_000},
+		{"0", 0, 0},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := money.Parse("USD", tc.in)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if want := money.New("USD", tc.units, tc.nanos); !proto.Equal(got, want) {
+				t.Errorf("Parse = %v, want %v", got, want)
+			}
+		})
+	}
+	for _, in := range []string{"", "-", ".5", "abc", "1.2.3", "1e3", "+1", "--1", "1.0000000001", "9223372036854775807"} {
+		if got, err := money.Parse("USD", in); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+// TestMustParsePanics checks MustParse panics on what Parse rejects.
+func TestMustParsePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParse of an invalid amount did not panic")
+		}
+	}()
+	money.MustParse("USD", "ten")
+}
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		in   *commonpb.Money
+		want string
+	}{
+		{money.New("USD", 46, 0), "46.00 USD"},
+		{money.MustParse("EUR", "10.5"), "10.50 EUR"},
+		{money.MustParse("USD", "1.234"), "1.234 USD"},
+		{money.MustParse("USD", "-0.25"), "-0.25 USD"},
+		{money.MustParse("USD", "0.000000001"), "0.000000001 USD"},
+		{money.FromMinor("JPY", 1999), "19.99 JPY"},
+		{nil, "-"},
+	} {
+		if got := money.Format(tc.in); got != tc.want {
+			t.Errorf("Format(%v) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+// TestAdd includes sums that drift with binary floating point, such as
+// 0.1 + 0.2, and mixed signs that must normalise units and nanos.
+func TestAdd(t *testing.T) {
+	for _, tc := range []struct {
+		a, b, want string
+	}{
+		{"0.1", "0.2", "0.3"},
+		{"0.7", "0.1", "0.8"},
+		{"21", "25", "46"},
+		{"-1.5", "1.25", "-0.25"},
+		{"0.999999999", "0.000000001", "1"},
+		{"-0.3", "0.3", "0"},
+	} {
+		t.Run(tc.a+"+"+tc.b, func(t *testing.T) {
+			got, err := money.Add(money.MustParse("USD", tc.a), money.MustParse("USD", tc.b))
+			if err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if want := money.MustParse("USD", tc.want); !proto.Equal(got, want) {
+				t.Errorf("Add = %s, want %s", money.Format(got), money.Format(want))
+			}
+		})
+	}
+	if _, err := money.Add(money.MustParse("USD", "1"), money.MustParse("EUR", "1")); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("Add of USD and EUR = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestMultiply(t *testing.T) {
+	for _, tc := range []struct {
+		m    string
+		n    int64
+		want string
+	}{
+		{"10.50", 2, "21"},
+		{"0.1", 3, "0.3"},
+		{"-0.25", 3, "-0.75"},
+		{"19.99", 0, "0"},
+		{"0.333333333", 3, "0.999999999"},
+	} {
+		got := money.Multiply(money.MustParse("USD", tc.m), tc.n)
+		if want := money.MustParse("USD", tc.want); !proto.Equal(got, want) {
+			t.Errorf("Multiply(%s, %d) = %s, want %s", tc.m, tc.n, money.Format(got), money.Format(want))
+		}
+	}
+}
+
+// TestRate checks rates round half away from zero to cents.
+func TestRate(t *testing.T) {
+	for _, tc := range []struct {
+		m    string
+		bps  int64
+		want string
+	}{
+		{"10.00", 725, "0.73"},   // 0.725
+		{"10.00", 724, "0.72"},   // 0.724
+		{"0.10", 500, "0.01"},    // 0.005
+		{"0.10", 499, "0"},       // 0.00499
+		{"-10.00", 725, "-0.73"}, // -0.725
+		{"46.00", 0, "0"},
+		{"46.00", 10000, "46"},
+	} {
+		got := money.Rate(money.MustParse("USD", tc.m), tc.bps)
+		if want := money.MustParse("USD", tc.want); !proto.Equal(got, want) {
+			t.Errorf("Rate(%s, %d) = %s, want %s", tc.m, tc.bps, money.Format(got), money.Format(want))
+		}
+	}
+}
+
+// TestItemsTotal sums the sample order that drifted from 46.00 when prices
+// were float32, and rejects items priced in different currencies.
+func TestItemsTotal(t *testing.T) {
+	items := []*commonpb.Item{
+		{ProductId: "prod-A", Quantity: 2, Price: money.MustParse("USD", "10.50")},
+		{ProductId: "prod-B", Quantity: 1, Price: money.MustParse("USD", "25.00")},
+	}
+	got, err := money.ItemsTotal(items)
+	if err != nil || !proto.Equal(got, money.MustParse("USD", "46")) {
+		t.Errorf("ItemsTotal = %s, %v; want 46.00 USD", money.Format(got), err)
+	}
+
+	tenth := []*commonpb.Item{{ProductId: "prod-C", Quantity: 10, Price: money.MustParse("USD", "0.1")}}
+	if got, err := money.ItemsTotal(tenth); err != nil || !proto.Equal(got, money.MustParse("USD", "1")) {
+		t.Errorf("ItemsTotal of 10 x 0.10 = %s, %v; want 1.00 USD", money.Format(got), err)
+	}
+
+	items[1].Price = money.MustParse("EUR", "25.00")
+	if _, err := money.ItemsTotal(items); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("ItemsTotal of USD and EUR items = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestValidateCurrency(t *testing.T) {
+	for _, code := range []string{"USD", "EUR", "IDR"} {
+		if err := money.ValidateCurrency(code); err != nil {
+			t.Errorf("ValidateCurrency(%q) = %v, want nil", code, err)
+		}
+	}
+	for _, code := range []string{"", "usd", "US", "USDT", "U$D"} {
+		if err := money.ValidateCurrency(code); err == nil {
+			t.Errorf("ValidateCurrency(%q) succeeded, want an error", code)
+		}
+	}
+}
+
+func TestParseCurrencies(t *testing.T) {
+	got, err := money.ParseCurrencies(" USD, EUR ,,IDR,")
+	if err != nil || !slices.Equal(got, []string{"USD", "EUR", "IDR"}) {
+		t.Errorf("ParseCurrencies = %q, %v; want [USD EUR IDR]", got, err)
+	}
+	if got, err := money.ParseCurrencies(""); err != nil || got != nil {
+		t.Errorf("ParseCurrencies of an empty spec = %q, %v; want none", got, err)
+	}
+	if _, err := money.ParseCurrencies("USD,eur"); err == nil || !strings.Contains(err.Error(), `"eur"`) {
+		t.Errorf("ParseCurrencies with a lower-case code = %v, want an error naming it", err)
+	}
+}
+
+// TestItemsCurrency checks the items' shared currency is returned, no items
+// default to DefaultCurrency and mixed currencies name the odd item out.
+func TestItemsCurrency(t *testing.T) {
+	items := []*commonpb.Item{
+		{ProductId: "prod-A", Quantity: 2, Price: money.MustParse("EUR", "10.50")},
+		{ProductId: "prod-B", Quantity: 1, Price: money.MustParse("EUR", "25.00")},
+	}
+	if got, err := money.ItemsCurrency(items); err != nil || got != "EUR" {
+		t.Errorf("ItemsCurrency = %q, %v; want EUR", got, err)
+	}
+	if got, err := money.ItemsCurrency(nil); err != nil || got != money.DefaultCurrency {
+		t.Errorf("ItemsCurrency of no items = %q, %v; want %s", got, err, money.DefaultCurrency)
+	}
+	items[1].Price = money.MustParse("USD", "25.00")
+	if _, err := money.ItemsCurrency(items); !errors.Is(err, money.ErrCurrencyMismatch) || !strings.HasPrefix(err.Error(), "item 1: ") {
+		t.Errorf("ItemsCurrency of EUR and USD items = %v, want ErrCurrencyMismatch for item 1", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Package validate checks that requests to the saga services carry the nested
+// messages and IDs their handlers rely on, so a malformed request is rejected
+// with codes.InvalidArgument before the handler runs instead of panicking it.
+// Field-level rules (amounts, addresses, ...) stay with each service.
+package validate
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// Request returns a codes.InvalidArgument error naming the first required
+// field missing from req, or nil if none is. Requests without required nested
+// messages (e.g. the Validate* RPCs, which report missing fields as
+// violations) are always accepted.
+func Request(req any) error {
+	switch r := req.(type) {
+	case *orderpb.CreateOrderRequest:
+		return firstMissing(present("details", r.GetDetails() != nil))
+	case *orderpb.CancelOrderRequest:
+		return firstMissing(orderID(r.GetOrderId()))
+	case *orderpb.CompleteOrderRequest:
+		return firstMissing(orderID(r.GetOrderId()))
+	case *paymentpb.ProcessPaymentRequest:
+		return firstMissing(orderID(r.GetOrderId()), present("payment_info", r.GetPaymentInfo() != nil))
+	case *paymentpb.RefundPaymentRequest:
+		return firstMissing(orderID(r.GetOrderId()))
+	case *shippingpb.ArrangeShippingRequest:
+		return firstMissing(orderID(r.GetOrderId()), present("address", r.GetAddress() != nil))
+	case *shippingpb.ConfirmShippingRequest:
+		return firstMissing(orderID(r.GetOrderId()))
+	case *shippingpb.CancelShippingRequest:
+		return firstMissing(orderID(r.GetOrderId()))
+	case *orderpb.GetOrdersByUserRequest:
+		return firstMissing(present("user_id", r.GetUserId() != ""))
+	case *shippingpb.TrackShipmentRequest:
+		return firstMissing(present("shipment_id", r.GetShipmentId() != ""))
+	}
+	return nil
+}
+
+// UnaryServerInterceptor rejects requests failing Request without calling the handler.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := Request(req); err != nil {
+			log.Printf("Rejected malformed %s request: %v", info.FullMethod, err)
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor: every message the handler receives is checked with
+// Request, so a server-streaming RPC such as TrackShipment is rejected before
+// its handler runs.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: ss, method: info.FullMethod})
+	}
+}
+
+// validatingStream is a ServerStream checking each received message.
+type validatingStream struct {
+	grpc.ServerStream
+	method string
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := Request(m); err != nil {
+		log.Printf("Rejected malformed %s request: %v", s.method, err)
+		return err
+	}
+	return nil
+}
+
+// check is one required field and whether the request has it.
+type check struct {
+	field string
+	ok    bool
+}
+
+func present(field string, ok bool) check {
+	return check{field: field, ok: ok}
+}
+
+// orderID requires an order ID message with a non-empty ID.
+func orderID(id *commonpb.OrderID) check {
+	if id == nil {
+		return present("order_id", false)
+	}
+	return present("order_id.id", id.GetId() != "")
+}
+
+func firstMissing(checks ...check) error {
+	for _, c := range checks {
+		if !c.ok {
+			return status.Errorf(codes.InvalidArgument, "%s is required", c.field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package validate_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"create-order-saga/pkg/validate"
+	commonpb "create-order-saga/proto/common"
+	orderpb "create-order-saga/proto/order"
+	paymentpb "create-order-saga/proto/payment"
+	shippingpb "create-order-saga/proto/shipping"
+)
+
+// checked returns one empty request of every type Request checks.
+func checked() []proto.Message {
+	return []proto.Message{
+		&orderpb.CreateOrderRequest{},
+		&orderpb.CancelOrderRequest{},
+		&orderpb.CompleteOrderRequest{},
+		&orderpb.GetOrdersByUserRequest{},
+		&paymentpb.ProcessPaymentRequest{},
+		&paymentpb.RefundPaymentRequest{},
+		&shippingpb.ArrangeShippingRequest{},
+		&shippingpb.ConfirmShippingRequest{},
+		&shippingpb.CancelShippingRequest{},
+		&shippingpb.TrackShipmentRequest{},
+	}
+}
+
+// FuzzRequest decodes arbitrary bytes as each checked request type: Request
+// must never panic and must either accept the request or reject it with
+// InvalidArgument.
+func FuzzRequest(f *testing.F) {
+	orderID := &commonpb.OrderID{Id: "order-1"}
+	for _, seed := range []proto.Message{
+		&orderpb.CreateOrderRequest{Details: &commonpb.OrderDetails{UserId: "user-1"}},
+		&orderpb.CancelOrderRequest{OrderId: orderID},
+		&paymentpb.ProcessPaymentRequest{OrderId: orderID, PaymentInfo: &commonpb.PaymentInfo{}},
+		&shippingpb.ArrangeShippingRequest{OrderId: orderID, Address: &commonpb.ShippingAddress{}},
+		&orderpb.GetOrdersByUserRequest{UserId: "user-1"},
+		&shippingpb.TrackShipmentRequest{ShipmentId: "ship-1"},
+		&orderpb.CancelOrderRequest{OrderId: &commonpb.OrderID{}},
+	} {
+		b, err := proto.Marshal(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, req := range checked() {
+			if proto.Unmarshal(b, req) != nil {
+				continue
+			}
+			if err := validate.Request(req); err != nil && status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Request(%T %v) = %v, want nil or InvalidArgument", req, req, err)
+			}
+		}
+	})
+}
+
+// recvStream is a ServerStream delivering req to RecvMsg.
+type recvStream struct {
+	grpc.ServerStream
+	req proto.Message
+}
+
+func (s *recvStream) Context() context.Context { return context.Background() }
+
+func (s *recvStream) RecvMsg(m any) error {
+	proto.Merge(m.(proto.Message), s.req)
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  proto.Message
+		want codes.Code
+	}{
+		{"orders without user", &orderpb.GetOrdersByUserRequest{}, codes.InvalidArgument},
+		{"orders", &orderpb.GetOrdersByUserRequest{UserId: "user-1"}, codes.OK},
+		{"tracking without shipment", &shippingpb.TrackShipmentRequest{}, codes.InvalidArgument},
+		{"tracking", &shippingpb.TrackShipmentRequest{ShipmentId: "ship-1"}, codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ran := false
+			handler := func(_ any, ss grpc.ServerStream) error {
+				if err := ss.RecvMsg(tc.req.ProtoReflect().New().Interface()); err != nil {
+					return err
+				}
+				ran = true
+				return nil
+			}
+			err := validate.StreamServerInterceptor()(nil, &recvStream{req: tc.req}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"}, handler)
+			if got := status.Code(err); got != tc.want {
+				t.Errorf("interceptor returned %v, want %s", err, tc.want)
+			}
+			if ran != (tc.want == codes.OK) {
+				t.Errorf("handler ran past RecvMsg = %v", ran)
+			}
+		})
+	}
+}
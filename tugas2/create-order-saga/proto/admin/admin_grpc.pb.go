@@ -0,0 +1,399 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v5.29.3
+// source: admin.proto
+
+package admin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// FailureAdminClient is the client API for FailureAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FailureAdminClient interface {
+	// Replaces the failure configuration and returns it.
+	SetFailureConfig(ctx context.Context, in *SetFailureConfigRequest, opts ...grpc.CallOption) (*FailureConfig, error)
+	// Returns the current failure configuration (fail_next_n counts down as calls fail).
+	GetFailureConfig(ctx context.Context, in *GetFailureConfigRequest, opts ...grpc.CallOption) (*FailureConfig, error)
+}
+
+type failureAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFailureAdminClient(cc grpc.ClientConnInterface) FailureAdminClient {
+	return &failureAdminClient{cc}
+}
+
+func (c *failureAdminClient) SetFailureConfig(ctx context.Context, in *SetFailureConfigRequest, opts ...grpc.CallOption) (*FailureConfig, error) {
+	out := new(FailureConfig)
+	err := c.cc.Invoke(ctx, "/admin.FailureAdmin/SetFailureConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *failureAdminClient) GetFailureConfig(ctx context.Context, in *GetFailureConfigRequest, opts ...grpc.CallOption) (*FailureConfig, error) {
+	out := new(FailureConfig)
+	err := c.cc.Invoke(ctx, "/admin.FailureAdmin/GetFailureConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FailureAdminServer is the server API for FailureAdmin service.
+// All implementations must embed UnimplementedFailureAdminServer
+// for forward compatibility
+type FailureAdminServer interface {
+	// Replaces the failure configuration and returns it.
+	SetFailureConfig(context.Context, *SetFailureConfigRequest) (*FailureConfig, error)
+	// Returns the current failure configuration (fail_next_n counts down as calls fail).
+	GetFailureConfig(context.Context, *GetFailureConfigRequest) (*FailureConfig, error)
+	mustEmbedUnimplementedFailureAdminServer()
+}
+
+// UnimplementedFailureAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedFailureAdminServer struct {
+}
+
+func (UnimplementedFailureAdminServer) SetFailureConfig(context.Context, *SetFailureConfigRequest) (*FailureConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetFailureConfig not implemented")
+}
+func (UnimplementedFailureAdminServer) GetFailureConfig(context.Context, *GetFailureConfigRequest) (*FailureConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFailureConfig not implemented")
+}
+func (UnimplementedFailureAdminServer) mustEmbedUnimplementedFailureAdminServer() {}
+
+// UnsafeFailureAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FailureAdminServer will
+// result in compilation errors.
+type UnsafeFailureAdminServer interface {
+	mustEmbedUnimplementedFailureAdminServer()
+}
+
+func RegisterFailureAdminServer(s grpc.ServiceRegistrar, srv FailureAdminServer) {
+	s.RegisterService(&FailureAdmin_ServiceDesc, srv)
+}
+
+func _FailureAdmin_SetFailureConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetFailureConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailureAdminServer).SetFailureConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.FailureAdmin/SetFailureConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailureAdminServer).SetFailureConfig(ctx, req.(*SetFailureConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FailureAdmin_GetFailureConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFailureConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailureAdminServer).GetFailureConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.FailureAdmin/GetFailureConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailureAdminServer).GetFailureConfig(ctx, req.(*GetFailureConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FailureAdmin_ServiceDesc is the grpc.ServiceDesc for FailureAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FailureAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.FailureAdmin",
+	HandlerType: (*FailureAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetFailureConfig",
+			Handler:    _FailureAdmin_SetFailureConfig_Handler,
+		},
+		{
+			MethodName: "GetFailureConfig",
+			Handler:    _FailureAdmin_GetFailureConfig_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
+
+// InventoryAdminClient is the client API for InventoryAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InventoryAdminClient interface {
+	// Sets the stock of the listed products and returns every stock level.
+	SetStock(ctx context.Context, in *SetStockRequest, opts ...grpc.CallOption) (*StockLevels, error)
+	// Returns every stock level.
+	GetStock(ctx context.Context, in *GetStockRequest, opts ...grpc.CallOption) (*StockLevels, error)
+}
+
+type inventoryAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInventoryAdminClient(cc grpc.ClientConnInterface) InventoryAdminClient {
+	return &inventoryAdminClient{cc}
+}
+
+func (c *inventoryAdminClient) SetStock(ctx context.Context, in *SetStockRequest, opts ...grpc.CallOption) (*StockLevels, error) {
+	out := new(StockLevels)
+	err := c.cc.Invoke(ctx, "/admin.InventoryAdmin/SetStock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *inventoryAdminClient) GetStock(ctx context.Context, in *GetStockRequest, opts ...grpc.CallOption) (*StockLevels, error) {
+	out := new(StockLevels)
+	err := c.cc.Invoke(ctx, "/admin.InventoryAdmin/GetStock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InventoryAdminServer is the server API for InventoryAdmin service.
+// All implementations must embed UnimplementedInventoryAdminServer
+// for forward compatibility
+type InventoryAdminServer interface {
+	// Sets the stock of the listed products and returns every stock level.
+	SetStock(context.Context, *SetStockRequest) (*StockLevels, error)
+	// Returns every stock level.
+	GetStock(context.Context, *GetStockRequest) (*StockLevels, error)
+	mustEmbedUnimplementedInventoryAdminServer()
+}
+
+// UnimplementedInventoryAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedInventoryAdminServer struct {
+}
+
+func (UnimplementedInventoryAdminServer) SetStock(context.Context, *SetStockRequest) (*StockLevels, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetStock not implemented")
+}
+func (UnimplementedInventoryAdminServer) GetStock(context.Context, *GetStockRequest) (*StockLevels, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStock not implemented")
+}
+func (UnimplementedInventoryAdminServer) mustEmbedUnimplementedInventoryAdminServer() {}
+
+// UnsafeInventoryAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InventoryAdminServer will
+// result in compilation errors.
+type UnsafeInventoryAdminServer interface {
+	mustEmbedUnimplementedInventoryAdminServer()
+}
+
+func RegisterInventoryAdminServer(s grpc.ServiceRegistrar, srv InventoryAdminServer) {
+	s.RegisterService(&InventoryAdmin_ServiceDesc, srv)
+}
+
+func _InventoryAdmin_SetStock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetStockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InventoryAdminServer).SetStock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.InventoryAdmin/SetStock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InventoryAdminServer).SetStock(ctx, req.(*SetStockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InventoryAdmin_GetStock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InventoryAdminServer).GetStock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.InventoryAdmin/GetStock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InventoryAdminServer).GetStock(ctx, req.(*GetStockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// InventoryAdmin_ServiceDesc is the grpc.ServiceDesc for InventoryAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var InventoryAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.InventoryAdmin",
+	HandlerType: (*InventoryAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetStock",
+			Handler:    _InventoryAdmin_SetStock_Handler,
+		},
+		{
+			MethodName: "GetStock",
+			Handler:    _InventoryAdmin_GetStock_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
+
+// OrderAdminClient is the client API for OrderAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OrderAdminClient interface {
+	// Moves the matching orders to the archive, where GetOrder still finds them
+	// (with archived set) but they can no longer be cancelled or completed.
+	ArchiveOrders(ctx context.Context, in *ArchiveOrdersRequest, opts ...grpc.CallOption) (*ArchiveOrdersResponse, error)
+	// Deletes the matching orders, from the archive as well as the live store.
+	PurgeOrders(ctx context.Context, in *PurgeOrdersRequest, opts ...grpc.CallOption) (*PurgeOrdersResponse, error)
+}
+
+type orderAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOrderAdminClient(cc grpc.ClientConnInterface) OrderAdminClient {
+	return &orderAdminClient{cc}
+}
+
+func (c *orderAdminClient) ArchiveOrders(ctx context.Context, in *ArchiveOrdersRequest, opts ...grpc.CallOption) (*ArchiveOrdersResponse, error) {
+	out := new(ArchiveOrdersResponse)
+	err := c.cc.Invoke(ctx, "/admin.OrderAdmin/ArchiveOrders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderAdminClient) PurgeOrders(ctx context.Context, in *PurgeOrdersRequest, opts ...grpc.CallOption) (*PurgeOrdersResponse, error) {
+	out := new(PurgeOrdersResponse)
+	err := c.cc.Invoke(ctx, "/admin.OrderAdmin/PurgeOrders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OrderAdminServer is the server API for OrderAdmin service.
+// All implementations must embed UnimplementedOrderAdminServer
+// for forward compatibility
+type OrderAdminServer interface {
+	// Moves the matching orders to the archive, where GetOrder still finds them
+	// (with archived set) but they can no longer be cancelled or completed.
+	ArchiveOrders(context.Context, *ArchiveOrdersRequest) (*ArchiveOrdersResponse, error)
+	// Deletes the matching orders, from the archive as well as the live store.
+	PurgeOrders(context.Context, *PurgeOrdersRequest) (*PurgeOrdersResponse, error)
+	mustEmbedUnimplementedOrderAdminServer()
+}
+
+// UnimplementedOrderAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedOrderAdminServer struct {
+}
+
+func (UnimplementedOrderAdminServer) ArchiveOrders(context.Context, *ArchiveOrdersRequest) (*ArchiveOrdersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ArchiveOrders not implemented")
+}
+func (UnimplementedOrderAdminServer) PurgeOrders(context.Context, *PurgeOrdersRequest) (*PurgeOrdersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeOrders not implemented")
+}
+func (UnimplementedOrderAdminServer) mustEmbedUnimplementedOrderAdminServer() {}
+
+// UnsafeOrderAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OrderAdminServer will
+// result in compilation errors.
+type UnsafeOrderAdminServer interface {
+	mustEmbedUnimplementedOrderAdminServer()
+}
+
+func RegisterOrderAdminServer(s grpc.ServiceRegistrar, srv OrderAdminServer) {
+	s.RegisterService(&OrderAdmin_ServiceDesc, srv)
+}
+
+func _OrderAdmin_ArchiveOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ArchiveOrdersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderAdminServer).ArchiveOrders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.OrderAdmin/ArchiveOrders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderAdminServer).ArchiveOrders(ctx, req.(*ArchiveOrdersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderAdmin_PurgeOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeOrdersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderAdminServer).PurgeOrders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.OrderAdmin/PurgeOrders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderAdminServer).PurgeOrders(ctx, req.(*PurgeOrdersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// OrderAdmin_ServiceDesc is the grpc.ServiceDesc for OrderAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OrderAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.OrderAdmin",
+	HandlerType: (*OrderAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ArchiveOrders",
+			Handler:    _OrderAdmin_ArchiveOrders_Handler,
+		},
+		{
+			MethodName: "PurgeOrders",
+			Handler:    _OrderAdmin_PurgeOrders_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
@@ -29,6 +29,17 @@ type OrderServiceClient interface {
 	CancelOrder(ctx context.Context, in *CancelOrderRequest, opts ...grpc.CallOption) (*common.CompensationResponse, error)
 	// Marks an order as completed after the saga succeeds.
 	CompleteOrder(ctx context.Context, in *CompleteOrderRequest, opts ...grpc.CallOption) (*common.CompensationResponse, error)
+	// Checks order details without creating an order (dry run).
+	ValidateOrder(ctx context.Context, in *ValidateOrderRequest, opts ...grpc.CallOption) (*common.ValidationResponse, error)
+	// Returns an order, including why and when it was cancelled.
+	GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*Order, error)
+	// Returns the most recent order created with the given client reference ID.
+	GetOrderByClientReference(ctx context.Context, in *GetOrderByClientReferenceRequest, opts ...grpc.CallOption) (*Order, error)
+	// Lists the orders in the caller's tenant, e.g. for reconciliation.
+	ListOrders(ctx context.Context, in *ListOrdersRequest, opts ...grpc.CallOption) (*ListOrdersResponse, error)
+	// Streams a user's orders in the caller's tenant, archived ones included,
+	// oldest first, e.g. for customer support.
+	GetOrdersByUser(ctx context.Context, in *GetOrdersByUserRequest, opts ...grpc.CallOption) (OrderService_GetOrdersByUserClient, error)
 }
 
 type orderServiceClient struct {
@@ -66,6 +77,74 @@ func (c *orderServiceClient) CompleteOrder(ctx context.Context, in *CompleteOrde
 	return out, nil
 }
 
+func (c *orderServiceClient) ValidateOrder(ctx context.Context, in *ValidateOrderRequest, opts ...grpc.CallOption) (*common.ValidationResponse, error) {
+	out := new(common.ValidationResponse)
+	err := c.cc.Invoke(ctx, "/order.OrderService/ValidateOrder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	out := new(Order)
+	err := c.cc.Invoke(ctx, "/order.OrderService/GetOrder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) GetOrderByClientReference(ctx context.Context, in *GetOrderByClientReferenceRequest, opts ...grpc.CallOption) (*Order, error) {
+	out := new(Order)
+	err := c.cc.Invoke(ctx, "/order.OrderService/GetOrderByClientReference", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) ListOrders(ctx context.Context, in *ListOrdersRequest, opts ...grpc.CallOption) (*ListOrdersResponse, error) {
+	out := new(ListOrdersResponse)
+	err := c.cc.Invoke(ctx, "/order.OrderService/ListOrders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderServiceClient) GetOrdersByUser(ctx context.Context, in *GetOrdersByUserRequest, opts ...grpc.CallOption) (OrderService_GetOrdersByUserClient, error) {
+	stream, err := c.cc.NewStream(ctx, &OrderService_ServiceDesc.Streams[0], "/order.OrderService/GetOrdersByUser", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &orderServiceGetOrdersByUserClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type OrderService_GetOrdersByUserClient interface {
+	Recv() (*Order, error)
+	grpc.ClientStream
+}
+
+type orderServiceGetOrdersByUserClient struct {
+	grpc.ClientStream
+}
+
+func (x *orderServiceGetOrdersByUserClient) Recv() (*Order, error) {
+	m := new(Order)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // OrderServiceServer is the server API for OrderService service.
 // All implementations must embed UnimplementedOrderServiceServer
 // for forward compatibility
@@ -76,6 +155,17 @@ type OrderServiceServer interface {
 	CancelOrder(context.Context, *CancelOrderRequest) (*common.CompensationResponse, error)
 	// Marks an order as completed after the saga succeeds.
 	CompleteOrder(context.Context, *CompleteOrderRequest) (*common.CompensationResponse, error)
+	// Checks order details without creating an order (dry run).
+	ValidateOrder(context.Context, *ValidateOrderRequest) (*common.ValidationResponse, error)
+	// Returns an order, including why and when it was cancelled.
+	GetOrder(context.Context, *GetOrderRequest) (*Order, error)
+	// Returns the most recent order created with the given client reference ID.
+	GetOrderByClientReference(context.Context, *GetOrderByClientReferenceRequest) (*Order, error)
+	// Lists the orders in the caller's tenant, e.g. for reconciliation.
+	ListOrders(context.Context, *ListOrdersRequest) (*ListOrdersResponse, error)
+	// Streams a user's orders in the caller's tenant, archived ones included,
+	// oldest first, e.g. for customer support.
+	GetOrdersByUser(*GetOrdersByUserRequest, OrderService_GetOrdersByUserServer) error
 	mustEmbedUnimplementedOrderServiceServer()
 }
 
@@ -92,6 +182,21 @@ func (UnimplementedOrderServiceServer) CancelOrder(context.Context, *CancelOrder
 func (UnimplementedOrderServiceServer) CompleteOrder(context.Context, *CompleteOrderRequest) (*common.CompensationResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CompleteOrder not implemented")
 }
+func (UnimplementedOrderServiceServer) ValidateOrder(context.Context, *ValidateOrderRequest) (*common.ValidationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ValidateOrder not implemented")
+}
+func (UnimplementedOrderServiceServer) GetOrder(context.Context, *GetOrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrder not implemented")
+}
+func (UnimplementedOrderServiceServer) GetOrderByClientReference(context.Context, *GetOrderByClientReferenceRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrderByClientReference not implemented")
+}
+func (UnimplementedOrderServiceServer) ListOrders(context.Context, *ListOrdersRequest) (*ListOrdersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOrders not implemented")
+}
+func (UnimplementedOrderServiceServer) GetOrdersByUser(*GetOrdersByUserRequest, OrderService_GetOrdersByUserServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetOrdersByUser not implemented")
+}
 func (UnimplementedOrderServiceServer) mustEmbedUnimplementedOrderServiceServer() {}
 
 // UnsafeOrderServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -159,6 +264,99 @@ func _OrderService_CompleteOrder_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OrderService_ValidateOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).ValidateOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/order.OrderService/ValidateOrder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).ValidateOrder(ctx, req.(*ValidateOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_GetOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).GetOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/order.OrderService/GetOrder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).GetOrder(ctx, req.(*GetOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_GetOrderByClientReference_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderByClientReferenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).GetOrderByClientReference(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/order.OrderService/GetOrderByClientReference",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).GetOrderByClientReference(ctx, req.(*GetOrderByClientReferenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_ListOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOrdersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderServiceServer).ListOrders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/order.OrderService/ListOrders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderServiceServer).ListOrders(ctx, req.(*ListOrdersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderService_GetOrdersByUser_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetOrdersByUserRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OrderServiceServer).GetOrdersByUser(m, &orderServiceGetOrdersByUserServer{stream})
+}
+
+type OrderService_GetOrdersByUserServer interface {
+	Send(*Order) error
+	grpc.ServerStream
+}
+
+type orderServiceGetOrdersByUserServer struct {
+	grpc.ServerStream
+}
+
+func (x *orderServiceGetOrdersByUserServer) Send(m *Order) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // OrderService_ServiceDesc is the grpc.ServiceDesc for OrderService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -178,7 +376,29 @@ var OrderService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CompleteOrder",
 			Handler:    _OrderService_CompleteOrder_Handler,
 		},
+		{
+			MethodName: "ValidateOrder",
+			Handler:    _OrderService_ValidateOrder_Handler,
+		},
+		{
+			MethodName: "GetOrder",
+			Handler:    _OrderService_GetOrder_Handler,
+		},
+		{
+			MethodName: "GetOrderByClientReference",
+			Handler:    _OrderService_GetOrderByClientReference_Handler,
+		},
+		{
+			MethodName: "ListOrders",
+			Handler:    _OrderService_ListOrders_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetOrdersByUser",
+			Handler:       _OrderService_GetOrdersByUser_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "order.proto",
 }
@@ -23,10 +23,34 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ShippingServiceClient interface {
-	// Arranges shipping for an order.
+	// Arranges shipping for an order: reserves and confirms it in one call.
 	ArrangeShipping(ctx context.Context, in *ArrangeShippingRequest, opts ...grpc.CallOption) (*ArrangeShippingResponse, error)
-	// Cancels a previously arranged shipment (compensation action).
+	// Reserves carrier capacity for an order's shipments without shipping them.
+	// Takes the same request as ArrangeShipping; the shipments are RESERVED.
+	ReserveShipping(ctx context.Context, in *ArrangeShippingRequest, opts ...grpc.CallOption) (*ArrangeShippingResponse, error)
+	// Ships shipments reserved by ReserveShipping. Confirming a shipment that
+	// already shipped is a no-op; a cancelled one fails the call unchanged.
+	ConfirmShipping(ctx context.Context, in *ConfirmShippingRequest, opts ...grpc.CallOption) (*ArrangeShippingResponse, error)
+	// Cancels a previously arranged shipment, or releases a reservation (compensation action).
 	CancelShipping(ctx context.Context, in *CancelShippingRequest, opts ...grpc.CallOption) (*common.CompensationResponse, error)
+	// Checks a shipping address without arranging a shipment (dry run).
+	ValidateShipping(ctx context.Context, in *ValidateShippingRequest, opts ...grpc.CallOption) (*common.ValidationResponse, error)
+	// Quotes the cost of shipping items, so it can be charged before shipping is arranged.
+	QuoteShipping(ctx context.Context, in *QuoteShippingRequest, opts ...grpc.CallOption) (*QuoteShippingResponse, error)
+	// Returns a shipment record, including why it was cancelled.
+	GetShipment(ctx context.Context, in *GetShipmentRequest, opts ...grpc.CallOption) (*Shipment, error)
+	// Lists the shipments arranged for an order.
+	ListShipments(ctx context.Context, in *ListShipmentsRequest, opts ...grpc.CallOption) (*ListShipmentsResponse, error)
+	// Changes the address of a shipment the carrier has not picked up yet, re-selecting
+	// its carrier and cost. The replaced address is kept in address_history.
+	UpdateShippingAddress(ctx context.Context, in *UpdateShippingAddressRequest, opts ...grpc.CallOption) (*Shipment, error)
+	// Streams a shipment's tracking history, then each new tracking event as
+	// it is recorded, until the shipment reaches a final status (DELIVERED,
+	// RETURNED or CANCELLED) or the caller goes away.
+	TrackShipment(ctx context.Context, in *TrackShipmentRequest, opts ...grpc.CallOption) (ShippingService_TrackShipmentClient, error)
+	// Exports the shipments that are not cancelled as a pick list for
+	// warehouse staff, structured and as CSV.
+	ExportManifest(ctx context.Context, in *ExportManifestRequest, opts ...grpc.CallOption) (*ManifestResponse, error)
 }
 
 type shippingServiceClient struct {
@@ -46,6 +70,24 @@ func (c *shippingServiceClient) ArrangeShipping(ctx context.Context, in *Arrange
 	return out, nil
 }
 
+func (c *shippingServiceClient) ReserveShipping(ctx context.Context, in *ArrangeShippingRequest, opts ...grpc.CallOption) (*ArrangeShippingResponse, error) {
+	out := new(ArrangeShippingResponse)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/ReserveShipping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) ConfirmShipping(ctx context.Context, in *ConfirmShippingRequest, opts ...grpc.CallOption) (*ArrangeShippingResponse, error) {
+	out := new(ArrangeShippingResponse)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/ConfirmShipping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shippingServiceClient) CancelShipping(ctx context.Context, in *CancelShippingRequest, opts ...grpc.CallOption) (*common.CompensationResponse, error) {
 	out := new(common.CompensationResponse)
 	err := c.cc.Invoke(ctx, "/shipping.ShippingService/CancelShipping", in, out, opts...)
@@ -55,14 +97,124 @@ func (c *shippingServiceClient) CancelShipping(ctx context.Context, in *CancelSh
 	return out, nil
 }
 
+func (c *shippingServiceClient) ValidateShipping(ctx context.Context, in *ValidateShippingRequest, opts ...grpc.CallOption) (*common.ValidationResponse, error) {
+	out := new(common.ValidationResponse)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/ValidateShipping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) QuoteShipping(ctx context.Context, in *QuoteShippingRequest, opts ...grpc.CallOption) (*QuoteShippingResponse, error) {
+	out := new(QuoteShippingResponse)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/QuoteShipping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) GetShipment(ctx context.Context, in *GetShipmentRequest, opts ...grpc.CallOption) (*Shipment, error) {
+	out := new(Shipment)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/GetShipment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) ListShipments(ctx context.Context, in *ListShipmentsRequest, opts ...grpc.CallOption) (*ListShipmentsResponse, error) {
+	out := new(ListShipmentsResponse)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/ListShipments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) UpdateShippingAddress(ctx context.Context, in *UpdateShippingAddressRequest, opts ...grpc.CallOption) (*Shipment, error) {
+	out := new(Shipment)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/UpdateShippingAddress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) TrackShipment(ctx context.Context, in *TrackShipmentRequest, opts ...grpc.CallOption) (ShippingService_TrackShipmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ShippingService_ServiceDesc.Streams[0], "/shipping.ShippingService/TrackShipment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shippingServiceTrackShipmentClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ShippingService_TrackShipmentClient interface {
+	Recv() (*TrackingEvent, error)
+	grpc.ClientStream
+}
+
+type shippingServiceTrackShipmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *shippingServiceTrackShipmentClient) Recv() (*TrackingEvent, error) {
+	m := new(TrackingEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shippingServiceClient) ExportManifest(ctx context.Context, in *ExportManifestRequest, opts ...grpc.CallOption) (*ManifestResponse, error) {
+	out := new(ManifestResponse)
+	err := c.cc.Invoke(ctx, "/shipping.ShippingService/ExportManifest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShippingServiceServer is the server API for ShippingService service.
 // All implementations must embed UnimplementedShippingServiceServer
 // for forward compatibility
 type ShippingServiceServer interface {
-	// Arranges shipping for an order.
+	// Arranges shipping for an order: reserves and confirms it in one call.
 	ArrangeShipping(context.Context, *ArrangeShippingRequest) (*ArrangeShippingResponse, error)
-	// Cancels a previously arranged shipment (compensation action).
+	// Reserves carrier capacity for an order's shipments without shipping them.
+	// Takes the same request as ArrangeShipping; the shipments are RESERVED.
+	ReserveShipping(context.Context, *ArrangeShippingRequest) (*ArrangeShippingResponse, error)
+	// Ships shipments reserved by ReserveShipping. Confirming a shipment that
+	// already shipped is a no-op; a cancelled one fails the call unchanged.
+	ConfirmShipping(context.Context, *ConfirmShippingRequest) (*ArrangeShippingResponse, error)
+	// Cancels a previously arranged shipment, or releases a reservation (compensation action).
 	CancelShipping(context.Context, *CancelShippingRequest) (*common.CompensationResponse, error)
+	// Checks a shipping address without arranging a shipment (dry run).
+	ValidateShipping(context.Context, *ValidateShippingRequest) (*common.ValidationResponse, error)
+	// Quotes the cost of shipping items, so it can be charged before shipping is arranged.
+	QuoteShipping(context.Context, *QuoteShippingRequest) (*QuoteShippingResponse, error)
+	// Returns a shipment record, including why it was cancelled.
+	GetShipment(context.Context, *GetShipmentRequest) (*Shipment, error)
+	// Lists the shipments arranged for an order.
+	ListShipments(context.Context, *ListShipmentsRequest) (*ListShipmentsResponse, error)
+	// Changes the address of a shipment the carrier has not picked up yet, re-selecting
+	// its carrier and cost. The replaced address is kept in address_history.
+	UpdateShippingAddress(context.Context, *UpdateShippingAddressRequest) (*Shipment, error)
+	// Streams a shipment's tracking history, then each new tracking event as
+	// it is recorded, until the shipment reaches a final status (DELIVERED,
+	// RETURNED or CANCELLED) or the caller goes away.
+	TrackShipment(*TrackShipmentRequest, ShippingService_TrackShipmentServer) error
+	// Exports the shipments that are not cancelled as a pick list for
+	// warehouse staff, structured and as CSV.
+	ExportManifest(context.Context, *ExportManifestRequest) (*ManifestResponse, error)
 	mustEmbedUnimplementedShippingServiceServer()
 }
 
@@ -73,9 +225,36 @@ type UnimplementedShippingServiceServer struct {
 func (UnimplementedShippingServiceServer) ArrangeShipping(context.Context, *ArrangeShippingRequest) (*ArrangeShippingResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ArrangeShipping not implemented")
 }
+func (UnimplementedShippingServiceServer) ReserveShipping(context.Context, *ArrangeShippingRequest) (*ArrangeShippingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReserveShipping not implemented")
+}
+func (UnimplementedShippingServiceServer) ConfirmShipping(context.Context, *ConfirmShippingRequest) (*ArrangeShippingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmShipping not implemented")
+}
 func (UnimplementedShippingServiceServer) CancelShipping(context.Context, *CancelShippingRequest) (*common.CompensationResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CancelShipping not implemented")
 }
+func (UnimplementedShippingServiceServer) ValidateShipping(context.Context, *ValidateShippingRequest) (*common.ValidationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ValidateShipping not implemented")
+}
+func (UnimplementedShippingServiceServer) QuoteShipping(context.Context, *QuoteShippingRequest) (*QuoteShippingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QuoteShipping not implemented")
+}
+func (UnimplementedShippingServiceServer) GetShipment(context.Context, *GetShipmentRequest) (*Shipment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShipment not implemented")
+}
+func (UnimplementedShippingServiceServer) ListShipments(context.Context, *ListShipmentsRequest) (*ListShipmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListShipments not implemented")
+}
+func (UnimplementedShippingServiceServer) UpdateShippingAddress(context.Context, *UpdateShippingAddressRequest) (*Shipment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateShippingAddress not implemented")
+}
+func (UnimplementedShippingServiceServer) TrackShipment(*TrackShipmentRequest, ShippingService_TrackShipmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method TrackShipment not implemented")
+}
+func (UnimplementedShippingServiceServer) ExportManifest(context.Context, *ExportManifestRequest) (*ManifestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportManifest not implemented")
+}
 func (UnimplementedShippingServiceServer) mustEmbedUnimplementedShippingServiceServer() {}
 
 // UnsafeShippingServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -107,6 +286,42 @@ func _ShippingService_ArrangeShipping_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShippingService_ReserveShipping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ArrangeShippingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).ReserveShipping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/ReserveShipping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).ReserveShipping(ctx, req.(*ArrangeShippingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_ConfirmShipping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfirmShippingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).ConfirmShipping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/ConfirmShipping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).ConfirmShipping(ctx, req.(*ConfirmShippingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ShippingService_CancelShipping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(CancelShippingRequest)
 	if err := dec(in); err != nil {
@@ -125,6 +340,135 @@ func _ShippingService_CancelShipping_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShippingService_ValidateShipping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateShippingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).ValidateShipping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/ValidateShipping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).ValidateShipping(ctx, req.(*ValidateShippingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_QuoteShipping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuoteShippingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).QuoteShipping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/QuoteShipping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).QuoteShipping(ctx, req.(*QuoteShippingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_GetShipment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetShipmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).GetShipment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/GetShipment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).GetShipment(ctx, req.(*GetShipmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_ListShipments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListShipmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).ListShipments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/ListShipments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).ListShipments(ctx, req.(*ListShipmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_UpdateShippingAddress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateShippingAddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).UpdateShippingAddress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/UpdateShippingAddress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).UpdateShippingAddress(ctx, req.(*UpdateShippingAddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_TrackShipment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TrackShipmentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShippingServiceServer).TrackShipment(m, &shippingServiceTrackShipmentServer{stream})
+}
+
+type ShippingService_TrackShipmentServer interface {
+	Send(*TrackingEvent) error
+	grpc.ServerStream
+}
+
+type shippingServiceTrackShipmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *shippingServiceTrackShipmentServer) Send(m *TrackingEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ShippingService_ExportManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).ExportManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shipping.ShippingService/ExportManifest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).ExportManifest(ctx, req.(*ExportManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ShippingService_ServiceDesc is the grpc.ServiceDesc for ShippingService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -136,11 +480,49 @@ var ShippingService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ArrangeShipping",
 			Handler:    _ShippingService_ArrangeShipping_Handler,
 		},
+		{
+			MethodName: "ReserveShipping",
+			Handler:    _ShippingService_ReserveShipping_Handler,
+		},
+		{
+			MethodName: "ConfirmShipping",
+			Handler:    _ShippingService_ConfirmShipping_Handler,
+		},
 		{
 			MethodName: "CancelShipping",
 			Handler:    _ShippingService_CancelShipping_Handler,
 		},
+		{
+			MethodName: "ValidateShipping",
+			Handler:    _ShippingService_ValidateShipping_Handler,
+		},
+		{
+			MethodName: "QuoteShipping",
+			Handler:    _ShippingService_QuoteShipping_Handler,
+		},
+		{
+			MethodName: "GetShipment",
+			Handler:    _ShippingService_GetShipment_Handler,
+		},
+		{
+			MethodName: "ListShipments",
+			Handler:    _ShippingService_ListShipments_Handler,
+		},
+		{
+			MethodName: "UpdateShippingAddress",
+			Handler:    _ShippingService_UpdateShippingAddress_Handler,
+		},
+		{
+			MethodName: "ExportManifest",
+			Handler:    _ShippingService_ExportManifest_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TrackShipment",
+			Handler:       _ShippingService_TrackShipment_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "shipping.proto",
 }